@@ -0,0 +1,463 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"sensiblequery/lib/midware"
+	"sensiblequery/lib/settings"
+	"sensiblequery/logger"
+	"sensiblequery/model"
+	"sensiblequery/service"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const MAX_ADMIN_LIST_SIZE = 1000
+const MAX_USAGE_DAYS = 93
+
+func adminTokenResponse(ctx *gin.Context, result *model.ApiTokenResp, err error) {
+	if err == service.ErrApiTokenNotExist {
+		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "token not exist"})
+		return
+	} else if err == service.ErrApiTokenNoQuota {
+		ctx.JSON(http.StatusBadRequest, model.Response{Code: -1, Msg: err.Error()})
+		return
+	} else if err != nil {
+		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, model.Response{
+		Code: 0,
+		Msg:  "ok",
+		Data: result,
+	})
+}
+
+// checkTokenPlan 套餐须在conf/ratelimit.yaml中配置，否则返回400
+func checkTokenPlan(ctx *gin.Context, plan string) bool {
+	if plan == "" || plan == "-" || midware.PlanExists(plan) {
+		return true
+	}
+	logger.Ctx(ctx).Info("plan not exist", zap.String("plan", plan))
+	ctx.JSON(http.StatusBadRequest, model.Response{Code: -1, Msg: "plan not exist"})
+	return false
+}
+
+func getAdminListParams(ctx *gin.Context) (cursor, size int, ok bool) {
+	cursor, err := strconv.Atoi(ctx.DefaultQuery("cursor", "0"))
+	if err != nil || cursor < 0 {
+		logger.Ctx(ctx).Info("cursor invalid", zap.Error(err))
+		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "cursor invalid"})
+		return 0, 0, false
+	}
+	size, err = strconv.Atoi(ctx.DefaultQuery("size", "100"))
+	if err != nil || size <= 0 || size > MAX_ADMIN_LIST_SIZE {
+		logger.Ctx(ctx).Info("size invalid", zap.Error(err))
+		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "size invalid"})
+		return 0, 0, false
+	}
+	return cursor, size, true
+}
+
+// AdminCreateToken
+// @Summary 创建API token
+// @Tags Admin
+// @Produce json
+// @Param body body model.ApiTokenReq true "token info"
+// @Success 200 {object} model.Response{data=model.ApiTokenResp} "{"code": 0, "data": {}, "msg": "ok"}"
+// @Security BearerAuth
+// @Router /admin/tokens [post]
+func AdminCreateToken(ctx *gin.Context) {
+	logger.Ctx(ctx).Info("AdminCreateToken enter")
+
+	req := model.ApiTokenReq{}
+	if err := ctx.BindJSON(&req); err != nil {
+		logger.Ctx(ctx).Info("Bind json failed", zap.Error(err))
+		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "json error"})
+		return
+	}
+
+	if !checkTokenPlan(ctx, req.Plan) {
+		return
+	}
+	result, err := service.CreateApiToken(ctx.Request.Context(), &req)
+	if err == nil {
+		service.AddAdminAudit(ctx.Request.Context(), "create", result.Token,
+			fmt.Sprintf("label=%s owner=%s plan=%s auth=%s scopes=%s quota=%d", req.Label, req.Owner, req.Plan, req.Auth, req.Scopes, result.Quota), ctx.ClientIP())
+	}
+	adminTokenResponse(ctx, result, err)
+}
+
+// AdminUpdateToken
+// @Summary 修改API token的备注、所有者、套餐、鉴权方式、scope
+// @Tags Admin
+// @Produce json
+// @Param token path string true "token"
+// @Param body body model.ApiTokenReq true "token info"
+// @Success 200 {object} model.Response{data=model.ApiTokenResp} "{"code": 0, "data": {}, "msg": "ok"}"
+// @Security BearerAuth
+// @Router /admin/tokens/{token} [post]
+func AdminUpdateToken(ctx *gin.Context) {
+	logger.Ctx(ctx).Info("AdminUpdateToken enter")
+
+	token := ctx.Param("token")
+	req := model.ApiTokenReq{}
+	if err := ctx.BindJSON(&req); err != nil {
+		logger.Ctx(ctx).Info("Bind json failed", zap.Error(err))
+		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "json error"})
+		return
+	}
+
+	if !checkTokenPlan(ctx, req.Plan) {
+		return
+	}
+	result, err := service.UpdateApiToken(ctx.Request.Context(), token, &req)
+	if err == nil {
+		service.AddAdminAudit(ctx.Request.Context(), "update", token,
+			fmt.Sprintf("label=%s owner=%s plan=%s auth=%s scopes=%s", req.Label, req.Owner, req.Plan, req.Auth, req.Scopes), ctx.ClientIP())
+	}
+	adminTokenResponse(ctx, result, err)
+}
+
+// AdminSetTokenQuota
+// @Summary 充值或设置API token的quota总配额
+// @Tags Admin
+// @Produce json
+// @Param token path string true "token"
+// @Param body body model.ApiTokenQuotaReq true "op: add/set"
+// @Success 200 {object} model.Response{data=model.ApiTokenResp} "{"code": 0, "data": {}, "msg": "ok"}"
+// @Security BearerAuth
+// @Router /admin/tokens/{token}/quota [post]
+func AdminSetTokenQuota(ctx *gin.Context) {
+	logger.Ctx(ctx).Info("AdminSetTokenQuota enter")
+
+	token := ctx.Param("token")
+	req := model.ApiTokenQuotaReq{}
+	if err := ctx.BindJSON(&req); err != nil {
+		logger.Ctx(ctx).Info("Bind json failed", zap.Error(err))
+		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "json error"})
+		return
+	}
+
+	quota, err := service.SetApiTokenQuota(ctx.Request.Context(), token, req.Op, req.Amount)
+	if err != nil {
+		adminTokenResponse(ctx, nil, err)
+		return
+	}
+	service.AddAdminAudit(ctx.Request.Context(), "quota", token,
+		fmt.Sprintf("op=%s amount=%d quota=%d", req.Op, req.Amount, quota), ctx.ClientIP())
+
+	result, err := service.GetApiToken(ctx.Request.Context(), token)
+	adminTokenResponse(ctx, result, err)
+}
+
+func adminSetTokenStatus(ctx *gin.Context, status string) {
+	token := ctx.Param("token")
+	result, err := service.SetApiTokenStatus(ctx.Request.Context(), token, status)
+	if err == nil {
+		service.AddAdminAudit(ctx.Request.Context(), status, token, "", ctx.ClientIP())
+	}
+	adminTokenResponse(ctx, result, err)
+}
+
+// AdminSuspendToken
+// @Summary 暂停API token
+// @Tags Admin
+// @Produce json
+// @Param token path string true "token"
+// @Success 200 {object} model.Response{data=model.ApiTokenResp} "{"code": 0, "data": {}, "msg": "ok"}"
+// @Security BearerAuth
+// @Router /admin/tokens/{token}/suspend [post]
+func AdminSuspendToken(ctx *gin.Context) {
+	logger.Ctx(ctx).Info("AdminSuspendToken enter")
+	adminSetTokenStatus(ctx, model.ApiTokenSuspended)
+}
+
+// AdminResumeToken
+// @Summary 恢复暂停的API token
+// @Tags Admin
+// @Produce json
+// @Param token path string true "token"
+// @Success 200 {object} model.Response{data=model.ApiTokenResp} "{"code": 0, "data": {}, "msg": "ok"}"
+// @Security BearerAuth
+// @Router /admin/tokens/{token}/resume [post]
+func AdminResumeToken(ctx *gin.Context) {
+	logger.Ctx(ctx).Info("AdminResumeToken enter")
+	adminSetTokenStatus(ctx, model.ApiTokenActive)
+}
+
+// AdminRevokeToken
+// @Summary 吊销API token，吊销后不可恢复
+// @Tags Admin
+// @Produce json
+// @Param token path string true "token"
+// @Success 200 {object} model.Response{data=model.ApiTokenResp} "{"code": 0, "data": {}, "msg": "ok"}"
+// @Security BearerAuth
+// @Router /admin/tokens/{token}/revoke [post]
+func AdminRevokeToken(ctx *gin.Context) {
+	logger.Ctx(ctx).Info("AdminRevokeToken enter")
+	adminSetTokenStatus(ctx, model.ApiTokenRevoked)
+}
+
+// AdminRotateTokenSecret
+// @Summary 生成或轮换API token的HMAC签名密钥，新密钥仅返回一次
+// @Tags Admin
+// @Produce json
+// @Param token path string true "token"
+// @Param body body model.ApiTokenSecretReq false "grace: 旧密钥继续有效的秒数"
+// @Success 200 {object} model.Response{data=model.ApiTokenSecretResp} "{"code": 0, "data": {}, "msg": "ok"}"
+// @Security BearerAuth
+// @Router /admin/tokens/{token}/secret [post]
+func AdminRotateTokenSecret(ctx *gin.Context) {
+	logger.Ctx(ctx).Info("AdminRotateTokenSecret enter")
+
+	token := ctx.Param("token")
+	req := model.ApiTokenSecretReq{}
+	if ctx.Request.ContentLength != 0 {
+		if err := ctx.BindJSON(&req); err != nil {
+			logger.Ctx(ctx).Info("Bind json failed", zap.Error(err))
+			ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "json error"})
+			return
+		}
+	}
+	grace := int64(86400)
+	if req.Grace != nil {
+		grace = *req.Grace
+	}
+	if grace < 0 {
+		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "grace invalid"})
+		return
+	}
+
+	result, err := service.RotateApiTokenSecret(ctx.Request.Context(), token, time.Duration(grace)*time.Second)
+	if err == service.ErrApiTokenNotExist {
+		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "token not exist"})
+		return
+	} else if err != nil {
+		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: err.Error()})
+		return
+	}
+	service.AddAdminAudit(ctx.Request.Context(), "secret", token, fmt.Sprintf("grace=%d", grace), ctx.ClientIP())
+
+	ctx.JSON(http.StatusOK, model.Response{
+		Code: 0,
+		Msg:  "ok",
+		Data: result,
+	})
+}
+
+// AdminGetToken
+// @Summary 查询API token
+// @Tags Admin
+// @Produce json
+// @Param token path string true "token"
+// @Success 200 {object} model.Response{data=model.ApiTokenResp} "{"code": 0, "data": {}, "msg": "ok"}"
+// @Security BearerAuth
+// @Router /admin/tokens/{token} [get]
+func AdminGetToken(ctx *gin.Context) {
+	logger.Ctx(ctx).Info("AdminGetToken enter")
+
+	result, err := service.GetApiToken(ctx.Request.Context(), ctx.Param("token"))
+	adminTokenResponse(ctx, result, err)
+}
+
+// AdminListTokens
+// @Summary 按创建时间倒序列出API token
+// @Tags Admin
+// @Produce json
+// @Param cursor query int false "起始游标" default(0)
+// @Param size query int false "返回记录数量" default(100)
+// @Success 200 {object} model.Response{data=[]model.ApiTokenResp} "{"code": 0, "data": [{}], "msg": "ok"}"
+// @Security BearerAuth
+// @Router /admin/tokens [get]
+func AdminListTokens(ctx *gin.Context) {
+	logger.Ctx(ctx).Info("AdminListTokens enter")
+
+	cursor, size, ok := getAdminListParams(ctx)
+	if !ok {
+		return
+	}
+
+	result, total, err := service.ListApiTokens(ctx.Request.Context(), cursor, size)
+	if err != nil {
+		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "list tokens failed"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, model.Response{
+		Code: 0,
+		Msg:  "ok",
+		Data: map[string]interface{}{
+			"cursor": cursor,
+			"total":  total,
+			"tokens": result,
+		},
+	})
+}
+
+// AdminGetTokenUsage
+// @Summary 按日、按接口统计API token的使用量
+// @Tags Admin
+// @Produce json
+// @Param token path string true "token"
+// @Param start query string false "起始日期(UTC)，如20221001，默认为7天前"
+// @Param end query string false "结束日期(UTC)，如20221019，默认为今天"
+// @Success 200 {object} model.Response{data=[]model.ApiTokenUsageResp} "{"code": 0, "data": [{}], "msg": "ok"}"
+// @Security BearerAuth
+// @Router /admin/tokens/{token}/usage [get]
+func AdminGetTokenUsage(ctx *gin.Context) {
+	logger.Ctx(ctx).Info("AdminGetTokenUsage enter")
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	end, err := time.Parse("20060102", ctx.DefaultQuery("end", today.Format("20060102")))
+	if err != nil {
+		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "end invalid"})
+		return
+	}
+	start, err := time.Parse("20060102", ctx.DefaultQuery("start", end.AddDate(0, 0, -6).Format("20060102")))
+	if err != nil || start.After(end) || end.Sub(start) >= MAX_USAGE_DAYS*24*time.Hour {
+		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "start invalid"})
+		return
+	}
+
+	result, err := service.GetApiTokenUsage(ctx.Request.Context(), ctx.Param("token"), start, end)
+	if err != nil {
+		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "get usage failed"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, model.Response{
+		Code: 0,
+		Msg:  "ok",
+		Data: result,
+	})
+}
+
+// AdminListAudit
+// @Summary 按时间倒序列出管理操作记录
+// @Tags Admin
+// @Produce json
+// @Param cursor query int false "起始游标" default(0)
+// @Param size query int false "返回记录数量" default(100)
+// @Param token query string false "只返回该token相关的记录"
+// @Success 200 {object} model.Response{data=[]model.AdminAuditResp} "{"code": 0, "data": [{}], "msg": "ok"}"
+// @Security BearerAuth
+// @Router /admin/audit [get]
+func AdminListAudit(ctx *gin.Context) {
+	logger.Ctx(ctx).Info("AdminListAudit enter")
+
+	cursor, size, ok := getAdminListParams(ctx)
+	if !ok {
+		return
+	}
+
+	result, err := service.ListAdminAudit(ctx.Request.Context(), cursor, size, ctx.Query("token"))
+	if err != nil {
+		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "list audit failed"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, model.Response{
+		Code: 0,
+		Msg:  "ok",
+		Data: result,
+	})
+}
+
+// AdminListSlowQueries
+// @Summary 按SQL指纹列出ClickHouse慢查询统计，慢查询阈值见conf/query.yaml
+// @Tags Admin
+// @Produce json
+// @Param sort query string false "排序: total累计耗时, count次数, max最大耗时" default(total)
+// @Param size query int false "返回记录数量" default(100)
+// @Success 200 {object} model.Response{data=[]model.SlowQueryResp} "{"code": 0, "data": [{}], "msg": "ok"}"
+// @Security BearerAuth
+// @Router /admin/slow-queries [get]
+func AdminListSlowQueries(ctx *gin.Context) {
+	logger.Ctx(ctx).Info("AdminListSlowQueries enter")
+
+	sortBy := ctx.DefaultQuery("sort", "total")
+	if sortBy != "total" && sortBy != "count" && sortBy != "max" {
+		logger.Ctx(ctx).Info("sort invalid", zap.String("sort", sortBy))
+		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "sort invalid"})
+		return
+	}
+	_, size, ok := getAdminListParams(ctx)
+	if !ok {
+		return
+	}
+
+	result, err := service.ListSlowQueries(ctx.Request.Context(), sortBy, size)
+	if err != nil {
+		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "list slow queries failed"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, model.Response{
+		Code: 0,
+		Msg:  "ok",
+		Data: result,
+	})
+}
+
+func runtimeConfigResp(s *settings.Settings) *model.RuntimeConfigResp {
+	resp := &model.RuntimeConfigResp{
+		LogLevel:             s.LogLevel,
+		MaxHistorySize:       s.Limits.MaxHistorySize,
+		MaxHistoryLimit:      s.Limits.MaxHistoryLimit,
+		MaxHistoryBlockRange: s.Limits.MaxHistoryBlockRange,
+		MaxUtxoSize:          s.Limits.MaxUtxoSize,
+		Cache:                map[string]string{},
+		Rpc:                  redactUrl(s.Broadcast.Rpc),
+		WocKeySet:            s.Broadcast.WocKey != "",
+	}
+	for route, ttl := range s.Cache {
+		resp.Cache[route] = ttl.String()
+	}
+	for _, node := range s.Broadcast.Nodes {
+		resp.RpcNodes = append(resp.RpcNodes, redactUrl(node.Url))
+	}
+	return resp
+}
+
+// AdminGetConfig
+// @Summary 当前生效的运行时配置，见conf/runtime.yaml
+// @Tags Admin
+// @Produce json
+// @Success 200 {object} model.Response{data=model.RuntimeConfigResp} "{"code": 0, "data": {}, "msg": "ok"}"
+// @Security BearerAuth
+// @Router /admin/config [get]
+func AdminGetConfig(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, model.Response{
+		Code: 0,
+		Msg:  "ok",
+		Data: runtimeConfigResp(settings.Get()),
+	})
+}
+
+// AdminReloadConfig
+// @Summary 重新加载conf/runtime.yaml及chain.yaml中的广播配置，校验失败时保留原配置
+// @Tags Admin
+// @Produce json
+// @Success 200 {object} model.Response{data=model.RuntimeConfigResp} "{"code": 0, "data": {}, "msg": "ok"}"
+// @Security BearerAuth
+// @Router /admin/config/reload [post]
+func AdminReloadConfig(ctx *gin.Context) {
+	logger.Ctx(ctx).Info("AdminReloadConfig enter")
+
+	s, err := settings.Reload()
+	if err != nil {
+		service.AddAdminAudit(ctx.Request.Context(), "reload", "", "failed: "+err.Error(), ctx.ClientIP())
+		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: err.Error()})
+		return
+	}
+	service.AddAdminAudit(ctx.Request.Context(), "reload", "", "ok", ctx.ClientIP())
+	ctx.JSON(http.StatusOK, model.Response{
+		Code: 0,
+		Msg:  "ok",
+		Data: runtimeConfigResp(s),
+	})
+}
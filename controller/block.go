@@ -23,33 +23,33 @@ import (
 // @Security BearerAuth
 // @Router /blocks [get]
 func GetBlocksByHeightRange(ctx *gin.Context) {
-	logger.Log.Info("GetBlocksByHeightRange enter")
+	logger.Ctx(ctx).Info("GetBlocksByHeightRange enter")
 
 	// check height
 	blkStartHeightString := ctx.DefaultQuery("start", "0")
 	blkStartHeight, err := strconv.Atoi(blkStartHeightString)
 	if err != nil || blkStartHeight < 0 {
-		logger.Log.Info("blk start height invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("blk start height invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "blk start height invalid"})
 		return
 	}
 	blkEndHeightString := ctx.DefaultQuery("end", "0")
 	blkEndHeight, err := strconv.Atoi(blkEndHeightString)
 	if err != nil || blkEndHeight < 0 {
-		logger.Log.Info("blk end height invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("blk end height invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "blk end height invalid"})
 		return
 	}
 
 	if blkEndHeight <= blkStartHeight || (blkEndHeight-blkStartHeight > 1000) {
-		logger.Log.Info("blk end height invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("blk end height invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "blk end height invalid"})
 		return
 	}
 
-	result, err := service.GetBlocksByHeightRange(blkStartHeight, blkEndHeight)
+	result, err := service.GetBlocksByHeightRange(ctx.Request.Context(), blkStartHeight, blkEndHeight)
 	if err != nil {
-		logger.Log.Info("get blocks failed", zap.Error(err))
+		logger.Ctx(ctx).Info("get blocks failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "get blocks failed"})
 		return
 	}
@@ -70,20 +70,20 @@ func GetBlocksByHeightRange(ctx *gin.Context) {
 // @Security BearerAuth
 // @Router /height/{height}/block [get]
 func GetBlockByHeight(ctx *gin.Context) {
-	logger.Log.Info("GetBlockByHeight enter")
+	logger.Ctx(ctx).Info("GetBlockByHeight enter")
 
 	// check height
 	blkHeightString := ctx.Param("height")
 	blkHeight, err := strconv.Atoi(blkHeightString)
 	if err != nil || blkHeight < 0 {
-		logger.Log.Info("blk height invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("blk height invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "blk height invalid"})
 		return
 	}
 
-	result, err := service.GetBlockByHeight(blkHeight)
+	result, err := service.GetBlockByHeight(ctx.Request.Context(), blkHeight)
 	if err != nil {
-		logger.Log.Info("get block failed", zap.Error(err))
+		logger.Ctx(ctx).Info("get block failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "get block failed"})
 		return
 	}
@@ -104,21 +104,21 @@ func GetBlockByHeight(ctx *gin.Context) {
 // @Security BearerAuth
 // @Router /block/id/{blkid} [get]
 func GetBlockById(ctx *gin.Context) {
-	logger.Log.Info("GetBlockById enter")
+	logger.Ctx(ctx).Info("GetBlockById enter")
 
 	blkIdHex := ctx.Param("blkid")
 	// check
 	blkIdReverse, err := hex.DecodeString(blkIdHex)
 	if err != nil {
-		logger.Log.Info("blkid invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("blkid invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "blkid invalid"})
 		return
 	}
 	blkId := utils.ReverseBytes(blkIdReverse)
 
-	result, err := service.GetBlockById(hex.EncodeToString(blkId))
+	result, err := service.GetBlockById(ctx.Request.Context(), hex.EncodeToString(blkId))
 	if err != nil {
-		logger.Log.Info("get block failed", zap.Error(err))
+		logger.Ctx(ctx).Info("get block failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "get block failed"})
 		return
 	}
@@ -0,0 +1,260 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sensiblequery/lib/metrics"
+	"sensiblequery/lib/midware"
+	"sensiblequery/logger"
+	"sensiblequery/model"
+	"sensiblequery/service"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+// 续传时每批读取的区块数
+const blockBackfillBatch = 100
+
+func blockStreamError(msg string) *model.BlockEventResp {
+	return &model.BlockEventResp{Type: model.EventError, Msg: msg}
+}
+
+// subscribeBlockStream 订阅区块事件并检查from参数，返回需要补发的高度范围，from为-1时不补发
+func subscribeBlockStream(ctx *gin.Context) (sub *service.BlockSubscriber, from, to int, err error) {
+	from = -1
+	if fromString := ctx.Query("from"); fromString != "" {
+		from, err = strconv.Atoi(fromString)
+		if err != nil || from < 0 {
+			return nil, 0, 0, errors.New("from invalid")
+		}
+	}
+
+	sub, to, err = service.SubscribeBlocks()
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	if from < 0 {
+		return sub, -1, to, nil
+	}
+	if to < 0 {
+		// 尚未完成首次检查，补发到索引的最高区块
+		if to, err = service.GetBestBlockHeight(ctx.Request.Context()); err != nil {
+			sub.Close()
+			return nil, 0, 0, errors.New("get best block failed")
+		}
+	}
+	if to-from+1 > service.MaxBlockBackfill {
+		sub.Close()
+		return nil, 0, 0, fmt.Errorf("from too old, at most %d blocks", service.MaxBlockBackfill)
+	}
+	return sub, from, to, nil
+}
+
+// backfillBlocks 按高度分批补发[from, to]的区块
+func backfillBlocks(ctx *gin.Context, from, to int, write func([]*model.BlockEventResp) error) error {
+	if from < 0 {
+		return nil
+	}
+	for start := from; start <= to; start += blockBackfillBatch {
+		end := start + blockBackfillBatch - 1
+		if end > to {
+			end = to
+		}
+		blocks, err := service.GetBlockBriefs(ctx.Request.Context(), start, end)
+		if err != nil {
+			logger.Ctx(ctx).Info("block stream backfill failed", zap.Error(err))
+			return write([]*model.BlockEventResp{blockStreamError("get blocks failed")})
+		}
+		events := make([]*model.BlockEventResp, 0, len(blocks))
+		for _, blk := range blocks {
+			events = append(events, &model.BlockEventResp{Type: model.EventBlock, Block: blk})
+		}
+		if err := write(events); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// chargeBlockStream 每个计费周期扣减一个单位配额
+func chargeBlockStream(ctx *gin.Context) (reason string, ok bool) {
+	ok, reason, err := midware.ChargeQuota(ctx, 1)
+	if err != nil {
+		logger.Ctx(ctx).Warn("block stream charge quota failed", zap.Error(err))
+	}
+	return reason, ok
+}
+
+// SubscribeBlocksWs
+// @Summary 通过websocket推送新区块及重组事件
+// @Description 每个新的最高区块推送block事件，重组时先推送reorg事件，再按高度推送新连接的区块。from参数从指定高度补发已有区块后继续推送
+// @Tags Subscribe
+// @Param from query int false "续传的起始区块高度"
+// @Success 101 {object} model.BlockEventResp
+// @Router /ws/blocks [get]
+func SubscribeBlocksWs(ctx *gin.Context) {
+	conn, err := wsUpgrader.Upgrade(ctx.Writer, ctx.Request, nil)
+	if err != nil {
+		logger.Ctx(ctx).Info("websocket upgrade failed", zap.Error(err))
+		return
+	}
+	defer conn.Close()
+
+	metrics.BlockStreamConnections.WithLabelValues("ws").Inc()
+	defer metrics.BlockStreamConnections.WithLabelValues("ws").Dec()
+
+	write := func(events []*model.BlockEventResp) error {
+		for _, event := range events {
+			conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := conn.WriteJSON(event); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	closeWith := func(reason string) {
+		write([]*model.BlockEventResp{blockStreamError(reason)})
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseNormalClosure, reason),
+			time.Now().Add(wsWriteTimeout))
+	}
+
+	sub, from, to, err := subscribeBlockStream(ctx)
+	if err != nil {
+		closeWith(err.Error())
+		return
+	}
+	defer sub.Close()
+
+	// 只推送，读取客户端消息用于处理pong及关闭
+	readErr := make(chan error, 1)
+	conn.SetReadLimit(wsMaxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				readErr <- err
+				return
+			}
+		}
+	}()
+
+	if err := backfillBlocks(ctx, from, to, write); err != nil {
+		return
+	}
+
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+	billing := time.NewTicker(subscribeBillingInterval)
+	defer billing.Stop()
+	for {
+		select {
+		case event, ok := <-sub.C:
+			if !ok {
+				closeWith(sub.Reason())
+				return
+			}
+			if err := write([]*model.BlockEventResp{event}); err != nil {
+				return
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout)); err != nil {
+				return
+			}
+		case <-billing.C:
+			if reason, ok := chargeBlockStream(ctx); !ok {
+				closeWith(reason)
+				return
+			}
+		case err := <-readErr:
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				logger.Ctx(ctx).Info("websocket read failed", zap.Error(err))
+			}
+			return
+		}
+	}
+}
+
+// SubscribeBlocksSse
+// @Summary 通过Server-Sent Events推送新区块及重组事件
+// @Description 事件名为事件类型，data为model.BlockEventResp，id为区块高度，重连时可由Last-Event-ID续传
+// @Tags Subscribe
+// @Produce text/event-stream
+// @Param from query int false "续传的起始区块高度"
+// @Success 200 {object} model.BlockEventResp
+// @Router /sse/blocks [get]
+func SubscribeBlocksSse(ctx *gin.Context) {
+	// 浏览器EventSource重连时带上最后收到的区块高度
+	if lastId := ctx.GetHeader("Last-Event-ID"); lastId != "" && ctx.Query("from") == "" {
+		if height, err := strconv.Atoi(lastId); err == nil {
+			query := ctx.Request.URL.Query()
+			query.Set("from", strconv.Itoa(height+1))
+			ctx.Request.URL.RawQuery = query.Encode()
+		}
+	}
+
+	sub, from, to, err := subscribeBlockStream(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: err.Error()})
+		return
+	}
+	defer sub.Close()
+
+	metrics.BlockStreamConnections.WithLabelValues("sse").Inc()
+	defer metrics.BlockStreamConnections.WithLabelValues("sse").Dec()
+
+	ctx.Header("Content-Type", "text/event-stream")
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("Connection", "keep-alive")
+	ctx.Header("X-Accel-Buffering", "no") // 关闭nginx缓冲
+	ctx.Status(http.StatusOK)
+
+	write := func(events []*model.BlockEventResp) error {
+		for _, event := range events {
+			data, _ := json.Marshal(event)
+			if event.Block != nil {
+				fmt.Fprintf(ctx.Writer, "id: %d\n", event.Block.Height)
+			}
+			fmt.Fprintf(ctx.Writer, "event: %s\ndata: %s\n\n", event.Type, data)
+		}
+		ctx.Writer.Flush()
+		return ctx.Request.Context().Err()
+	}
+	if err := backfillBlocks(ctx, from, to, write); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(sseHeartbeatInterval)
+	defer heartbeat.Stop()
+	billing := time.NewTicker(subscribeBillingInterval)
+	defer billing.Stop()
+	for {
+		select {
+		case event, ok := <-sub.C:
+			if !ok {
+				write([]*model.BlockEventResp{blockStreamError(sub.Reason())})
+				return
+			}
+			write([]*model.BlockEventResp{event})
+		case <-heartbeat.C:
+			fmt.Fprint(ctx.Writer, ": ping\n\n")
+			ctx.Writer.Flush()
+		case <-billing.C:
+			if reason, ok := chargeBlockStream(ctx); !ok {
+				write([]*model.BlockEventResp{blockStreamError(reason)})
+				return
+			}
+		case <-ctx.Request.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package controller
+
+import (
+	"context"
+	"sensiblequery/lib/worker"
+	"sensiblequery/logger"
+	"sensiblequery/service"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// 推送到woc成功后，再在后台推送到本地节点
+var broadcastGroup = worker.NewGroup()
+
+// 退出时保存未完成任务的超时，此时drain的ctx已经结束
+const savePendingTimeout = 5 * time.Second
+
+func localBroadcast(ctx context.Context, job *service.BroadcastJob) {
+	response, err := rpcBroadcast(ctx, "sendrawtransaction", []string{job.TxHex})
+	if err != nil {
+		logger.Ctx(ctx).Info("woc ok, but local call failed", zap.String("txid", job.TxId), zap.Error(err))
+		return
+	}
+	logger.Ctx(ctx).Info("Receive local rpc return", zap.String("txid", job.TxId), zap.Any("response", response))
+}
+
+// startLocalBroadcast 后台推送到本地节点，已开始退出时直接保存，由下次启动执行
+func startLocalBroadcast(ctx context.Context, job *service.BroadcastJob) {
+	if broadcastGroup.Go(ctx, job, func(ctx context.Context) { localBroadcast(ctx, job) }) {
+		return
+	}
+	if err := service.SavePendingBroadcasts(ctx, []*service.BroadcastJob{job}); err != nil {
+		logger.Ctx(ctx).Warn("save pending broadcast failed", zap.String("txid", job.TxId), zap.Error(err))
+	}
+}
+
+// DrainBroadcasts 等待后台广播完成，ctx结束时保存未完成的任务。
+// 保存的任务在下次启动时重新推送，本地节点会忽略已收到的交易
+func DrainBroadcasts(ctx context.Context) {
+	unfinished := broadcastGroup.Close(ctx)
+	if len(unfinished) == 0 {
+		return
+	}
+	jobs := make([]*service.BroadcastJob, len(unfinished))
+	for idx, job := range unfinished {
+		jobs[idx] = job.(*service.BroadcastJob)
+	}
+
+	sctx, cancel := context.WithTimeout(context.Background(), savePendingTimeout)
+	defer cancel()
+	if err := service.SavePendingBroadcasts(sctx, jobs); err != nil {
+		logger.Log.Error("save pending broadcast failed", zap.Int("n", len(jobs)), zap.Error(err))
+		for _, job := range jobs {
+			logger.Log.Error("pending broadcast lost", zap.String("txid", job.TxId), zap.String("rawtx", job.TxHex))
+		}
+		return
+	}
+	logger.Log.Info("pending broadcast saved", zap.Int("n", len(jobs)))
+}
+
+// ResumeBroadcasts 重新推送上次退出时保存的任务
+func ResumeBroadcasts(ctx context.Context) {
+	jobs, err := service.TakePendingBroadcasts(ctx)
+	if err != nil {
+		logger.Log.Warn("load pending broadcast failed", zap.Error(err))
+		return
+	}
+	if len(jobs) > 0 {
+		logger.Log.Info("resume pending broadcast", zap.Int("n", len(jobs)))
+	}
+	for _, job := range jobs {
+		startLocalBroadcast(ctx, job)
+	}
+}
@@ -0,0 +1,756 @@
+package controller
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"sensiblequery/lib/electrum"
+	"sensiblequery/lib/metrics"
+	"sensiblequery/lib/midware"
+	"sensiblequery/lib/utils"
+	"sensiblequery/logger"
+	"sensiblequery/model"
+	"sensiblequery/service"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/ybbus/jsonrpc/v2"
+	"go.uber.org/zap"
+)
+
+const (
+	electrumServerVersion = "sensiblequery 2.0"
+	electrumProtocolMin   = "1.4"
+	electrumProtocolMax   = "1.4.2"
+)
+
+var errElectrumParams = electrum.NewError(electrum.CodeInvalidParams, "invalid params")
+
+// wsElectrumConn websocket上的Electrum连接，每帧一条消息
+type wsElectrumConn struct {
+	conn *websocket.Conn
+}
+
+func (c *wsElectrumConn) ReadMessage() ([]byte, error) {
+	c.conn.SetReadDeadline(time.Now().Add(service.ElectrumConf.IdleTimeout))
+	_, data, err := c.conn.ReadMessage()
+	return data, err
+}
+
+func (c *wsElectrumConn) WriteMessage(data []byte) error {
+	c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	return c.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+func (c *wsElectrumConn) Close() error {
+	return c.conn.Close()
+}
+
+// electrumSession 一个Electrum连接的订阅状态
+type electrumSession struct {
+	*electrum.Session
+	transport string
+	// 按订阅数扣减配额，TCP连接为nil
+	charge func(n int64) (reason string, ok bool)
+	// 检查是否可以广播交易，为nil(TCP连接)时不能广播
+	canPush func() (ok bool, err error)
+
+	mu        sync.Mutex
+	statuses  map[string]interface{} // scripthash -> 最近推送的状态
+	digests   map[string][]byte      // scripthash -> 锁定脚本sha256
+	addresses map[string][]string    // 已索引为P2PKH的地址 -> scripthash
+	resolved  map[string]bool        // 已按地址订阅的scripthash，其余的定期重新计算
+	subs      []*service.Subscriber
+	headers   bool
+
+	events    chan *model.AddressEventResp
+	subClosed chan string
+	done      chan struct{}
+}
+
+func newElectrumSession(conn electrum.Conn, transport string) *electrumSession {
+	return &electrumSession{
+		Session:   electrum.NewSession(conn),
+		transport: transport,
+		statuses:  map[string]interface{}{},
+		digests:   map[string][]byte{},
+		addresses: map[string][]string{},
+		resolved:  map[string]bool{},
+		events:    make(chan *model.AddressEventResp, 256),
+		subClosed: make(chan string, 1),
+		done:      make(chan struct{}),
+	}
+}
+
+func electrumParam(params []json.RawMessage, i int, v interface{}) error {
+	if i >= len(params) || json.Unmarshal(params[i], v) != nil {
+		return errElectrumParams
+	}
+	return nil
+}
+
+// electrumOptionalParam 可选参数，缺少或为null时保留v的默认值
+func electrumOptionalParam(params []json.RawMessage, i int, v interface{}) error {
+	if i >= len(params) || string(params[i]) == "null" {
+		return nil
+	}
+	if json.Unmarshal(params[i], v) != nil {
+		return errElectrumParams
+	}
+	return nil
+}
+
+func electrumScriptHashParam(params []json.RawMessage) (scriptHash string, digest []byte, err error) {
+	if err := electrumParam(params, 0, &scriptHash); err != nil {
+		return "", nil, err
+	}
+	digest, err = electrum.ParseScriptHash(scriptHash)
+	if err != nil {
+		return "", nil, electrum.NewError(electrum.CodeBadRequest, err.Error())
+	}
+	return scriptHash, digest, nil
+}
+
+// electrumTxIdParam 显示字节序的txid，返回内部字节序的十六进制
+func electrumTxIdParam(params []json.RawMessage) (txidHex string, err error) {
+	var txHash string
+	if err := electrumParam(params, 0, &txHash); err != nil {
+		return "", err
+	}
+	txIdReverse, err := hex.DecodeString(txHash)
+	if err != nil || len(txIdReverse) != 32 {
+		return "", electrum.NewError(electrum.CodeBadRequest, "txid invalid")
+	}
+	return hex.EncodeToString(utils.ReverseBytes(txIdReverse)), nil
+}
+
+// electrumServiceError 查询失败，history too large原样返回，其余不暴露内部错误
+func electrumServiceError(err error) error {
+	if errors.Is(err, service.ErrHistoryTooLarge) {
+		return electrum.NewError(electrum.CodeBadRequest, err.Error())
+	}
+	return electrum.NewError(electrum.CodeDaemonError, "query failed")
+}
+
+// getElectrumHeaders 从节点读取[start, start+count)的区块头，高度超出时只返回已有的
+func getElectrumHeaders(ctx context.Context, start, count int) (headers []string, err error) {
+	blocks, err := service.GetBlockBriefs(ctx, start, start+count-1)
+	if err != nil {
+		return nil, err
+	}
+	if len(blocks) == 0 {
+		return nil, nil
+	}
+	requests := make(jsonrpc.RPCRequests, 0, len(blocks))
+	for _, blk := range blocks {
+		requests = append(requests, jsonrpc.NewRequest("getblockheader", blk.BlockIdHex, false))
+	}
+	responses, err := rpcCallBatch(ctx, "getblockheader", requests)
+	if err != nil {
+		return nil, err
+	}
+	for i := range blocks {
+		response := responses.GetByID(i)
+		if response == nil {
+			return nil, errors.New("getblockheader response missing")
+		}
+		if response.Error != nil {
+			return nil, response.Error
+		}
+		header, err := response.GetString()
+		if err != nil {
+			return nil, err
+		}
+		headers = append(headers, header)
+	}
+	return headers, nil
+}
+
+func getElectrumTipHeader(ctx context.Context) (*model.ElectrumHeaderResp, error) {
+	height, err := service.GetBestBlockHeight(ctx)
+	if err != nil {
+		return nil, err
+	}
+	headers, err := getElectrumHeaders(ctx, height, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(headers) == 0 {
+		return nil, errors.New("block not found")
+	}
+	return &model.ElectrumHeaderResp{Height: height, Hex: headers[0]}, nil
+}
+
+func (s *electrumSession) scriptHashStatus(ctx context.Context, digest []byte) (interface{}, error) {
+	history, err := service.GetScriptHashHistory(ctx, digest)
+	if err != nil {
+		return nil, err
+	}
+	return electrum.Status(history), nil
+}
+
+// subscribeAddressLocked 按地址订阅utxo变化，每个Subscriber最多service.MaxSubscribeAddresses个地址
+func (s *electrumSession) subscribeAddressLocked(addressPkh []byte) error {
+	for _, sub := range s.subs {
+		if sub.Count() < service.MaxSubscribeAddresses {
+			return sub.Subscribe(addressPkh)
+		}
+	}
+	sub := service.NewSubscriber()
+	if err := sub.Subscribe(addressPkh); err != nil {
+		sub.Close()
+		return err
+	}
+	s.subs = append(s.subs, sub)
+	go func() {
+		for event := range sub.C {
+			select {
+			case s.events <- event:
+			case <-s.done:
+				return
+			}
+		}
+		select {
+		case s.subClosed <- sub.Reason():
+		default:
+		}
+	}()
+	return nil
+}
+
+// resolveLocked 已索引为P2PKH的scripthash改为按地址订阅
+func (s *electrumSession) resolveLocked(ctx context.Context, scriptHash string) {
+	if s.resolved[scriptHash] {
+		return
+	}
+	addressPkh, err := service.GetScriptHashAddress(ctx, s.digests[scriptHash])
+	if err != nil || addressPkh == nil {
+		return
+	}
+	address := utils.EncodeAddress(addressPkh, utils.PubKeyHashAddrID)
+	if _, ok := s.addresses[address]; !ok {
+		if err := s.subscribeAddressLocked(addressPkh); err != nil {
+			logger.Ctx(ctx).Info("electrum subscribe address failed", zap.Error(err))
+			return
+		}
+	}
+	s.addresses[address] = append(s.addresses[address], scriptHash)
+	s.resolved[scriptHash] = true
+}
+
+func (s *electrumSession) subscribeScriptHash(ctx context.Context, params []json.RawMessage) (interface{}, error) {
+	scriptHash, digest, err := electrumScriptHashParam(params)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	_, subscribed := s.statuses[scriptHash]
+	count := len(s.statuses)
+	s.mu.Unlock()
+	if !subscribed {
+		if count >= service.ElectrumConf.MaxSubscriptions {
+			return nil, electrum.NewError(electrum.CodeBadRequest, "too many subscriptions")
+		}
+		if s.charge != nil {
+			if reason, ok := s.charge(1); !ok {
+				return nil, electrum.NewError(electrum.CodeBadRequest, reason)
+			}
+		}
+	}
+
+	status, err := s.scriptHashStatus(ctx, digest)
+	if err != nil {
+		return nil, electrumServiceError(err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.statuses[scriptHash] = status
+	s.digests[scriptHash] = digest
+	s.resolveLocked(ctx, scriptHash)
+	return status, nil
+}
+
+func (s *electrumSession) unsubscribeScriptHash(params []json.RawMessage) (interface{}, error) {
+	scriptHash, _, err := electrumScriptHashParam(params)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, subscribed := s.statuses[scriptHash]
+	delete(s.statuses, scriptHash)
+	delete(s.digests, scriptHash)
+	delete(s.resolved, scriptHash)
+	// 地址的其他scripthash均已取消时不再需要通知，保留Subscriber上的订阅直到连接关闭
+	for address, scriptHashes := range s.addresses {
+		for i, sh := range scriptHashes {
+			if sh == scriptHash {
+				s.addresses[address] = append(scriptHashes[:i], scriptHashes[i+1:]...)
+				break
+			}
+		}
+	}
+	return subscribed, nil
+}
+
+// notifyScriptHashes 重新计算scripthash的状态，变化时推送
+func (s *electrumSession) notifyScriptHashes(ctx context.Context, scriptHashes []string) error {
+	for _, scriptHash := range scriptHashes {
+		s.mu.Lock()
+		digest, ok := s.digests[scriptHash]
+		s.mu.Unlock()
+		if !ok {
+			continue
+		}
+		status, err := s.scriptHashStatus(ctx, digest)
+		if err != nil {
+			logger.Ctx(ctx).Info("electrum scripthash status failed", zap.Error(err))
+			continue
+		}
+		s.mu.Lock()
+		last, ok := s.statuses[scriptHash]
+		if ok {
+			s.statuses[scriptHash] = status
+		}
+		s.mu.Unlock()
+		if !ok || last == status {
+			continue
+		}
+		if err := s.Notify("blockchain.scripthash.subscribe", scriptHash, status); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unresolvedScriptHashes 未按地址订阅的scripthash，先尝试改为按地址订阅
+func (s *electrumSession) unresolvedScriptHashes(ctx context.Context) (scriptHashes []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for scriptHash := range s.statuses {
+		s.resolveLocked(ctx, scriptHash)
+		if !s.resolved[scriptHash] {
+			scriptHashes = append(scriptHashes, scriptHash)
+		}
+	}
+	return scriptHashes
+}
+
+func (s *electrumSession) close() {
+	close(s.done)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, sub := range s.subs {
+		sub.Close()
+	}
+}
+
+// notifyLoop 推送区块头及scripthash状态变化，订阅被关闭时关闭连接
+func (s *electrumSession) notifyLoop(ctx context.Context, blocks *service.BlockSubscriber) {
+	defer s.Close()
+	poll := time.NewTicker(service.ElectrumConf.Poll)
+	defer poll.Stop()
+	billing := time.NewTicker(subscribeBillingInterval)
+	defer billing.Stop()
+	for {
+		var err error
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-blocks.C:
+			if !ok {
+				logger.Ctx(ctx).Info("electrum session closed", zap.String("reason", blocks.Reason()))
+				return
+			}
+			s.mu.Lock()
+			headers := s.headers
+			s.mu.Unlock()
+			if event.Type != model.EventBlock || !headers {
+				continue
+			}
+			var header []string
+			header, err = getElectrumHeaders(ctx, event.Block.Height, 1)
+			if err != nil || len(header) == 0 {
+				logger.Ctx(ctx).Info("electrum get header failed", zap.Error(err))
+				err = nil
+				continue
+			}
+			err = s.Notify("blockchain.headers.subscribe",
+				&model.ElectrumHeaderResp{Height: event.Block.Height, Hex: header[0]})
+		case event := <-s.events:
+			// 同一交易的多个utxo变化合并为一次计算
+			changed := map[string]bool{event.Address: true}
+			for more := true; more; {
+				select {
+				case event := <-s.events:
+					changed[event.Address] = true
+				default:
+					more = false
+				}
+			}
+			var scriptHashes []string
+			s.mu.Lock()
+			for address := range changed {
+				scriptHashes = append(scriptHashes, s.addresses[address]...)
+			}
+			s.mu.Unlock()
+			err = s.notifyScriptHashes(ctx, scriptHashes)
+		case reason := <-s.subClosed:
+			logger.Ctx(ctx).Info("electrum session closed", zap.String("reason", reason))
+			return
+		case <-poll.C:
+			err = s.notifyScriptHashes(ctx, s.unresolvedScriptHashes(ctx))
+		case <-billing.C:
+			if s.charge == nil {
+				continue
+			}
+			s.mu.Lock()
+			n := len(s.statuses)
+			s.mu.Unlock()
+			if n == 0 {
+				continue
+			}
+			if reason, ok := s.charge(int64(n)); !ok {
+				logger.Ctx(ctx).Info("electrum session closed", zap.String("reason", reason))
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (s *electrumSession) handle(ctx context.Context, method string, params []json.RawMessage) (result interface{}, err error) {
+	label := method
+	defer func() {
+		outcome := "ok"
+		if err != nil {
+			outcome = "error"
+		}
+		metrics.ElectrumRequests.WithLabelValues(label, outcome).Inc()
+	}()
+
+	switch method {
+	case "server.version":
+		return []string{electrumServerVersion, electrumProtocolMin}, nil
+	case "server.banner":
+		return service.ElectrumConf.Banner, nil
+	case "server.donation_address":
+		return "", nil
+	case "server.peers.subscribe":
+		return []interface{}{}, nil
+	case "server.ping":
+		return nil, nil
+	case "server.features":
+		genesis, err := service.GetBlockByHeight(ctx, 0)
+		if err != nil {
+			return nil, electrumServiceError(err)
+		}
+		return &model.ElectrumFeaturesResp{
+			GenesisHash:   genesis.BlockIdHex,
+			Hosts:         map[string]string{},
+			ProtocolMax:   electrumProtocolMax,
+			ProtocolMin:   electrumProtocolMin,
+			ServerVersion: electrumServerVersion,
+			HashFunction:  "sha256",
+		}, nil
+
+	case "blockchain.scripthash.get_history":
+		_, digest, err := electrumScriptHashParam(params)
+		if err != nil {
+			return nil, err
+		}
+		history, err := service.GetScriptHashHistory(ctx, digest)
+		if err != nil {
+			return nil, electrumServiceError(err)
+		}
+		return history, nil
+	case "blockchain.scripthash.get_mempool":
+		_, digest, err := electrumScriptHashParam(params)
+		if err != nil {
+			return nil, err
+		}
+		history, err := service.GetScriptHashHistory(ctx, digest)
+		if err != nil {
+			return nil, electrumServiceError(err)
+		}
+		mempool := []*electrum.HistoryItem{}
+		for _, item := range history {
+			if item.Height <= 0 {
+				mempool = append(mempool, item)
+			}
+		}
+		return mempool, nil
+	case "blockchain.scripthash.get_balance":
+		_, digest, err := electrumScriptHashParam(params)
+		if err != nil {
+			return nil, err
+		}
+		balance, err := service.GetScriptHashBalance(ctx, digest)
+		if err != nil {
+			return nil, electrumServiceError(err)
+		}
+		return balance, nil
+	case "blockchain.scripthash.listunspent":
+		_, digest, err := electrumScriptHashParam(params)
+		if err != nil {
+			return nil, err
+		}
+		utxos, err := service.ListScriptHashUnspent(ctx, digest)
+		if err != nil {
+			return nil, electrumServiceError(err)
+		}
+		return utxos, nil
+	case "blockchain.scripthash.subscribe":
+		return s.subscribeScriptHash(ctx, params)
+	case "blockchain.scripthash.unsubscribe":
+		return s.unsubscribeScriptHash(params)
+
+	case "blockchain.transaction.get":
+		txidHex, err := electrumTxIdParam(params)
+		if err != nil {
+			return nil, err
+		}
+		verbose := false
+		if err := electrumOptionalParam(params, 1, &verbose); err != nil {
+			return nil, err
+		}
+		if verbose {
+			response, err := rpcCall(ctx, "getrawtransaction", params[0], 1)
+			if err != nil {
+				return nil, electrum.NewError(electrum.CodeDaemonError, "rpc failed")
+			}
+			if response.Error != nil {
+				return nil, electrum.NewError(electrum.CodeDaemonError, response.Error.Message)
+			}
+			return response.Result, nil
+		}
+		rawtx, err := service.GetRawTxById(ctx, txidHex)
+		if err != nil {
+			return nil, electrum.NewError(electrum.CodeBadRequest, "tx not found")
+		}
+		return hex.EncodeToString(rawtx), nil
+	case "blockchain.transaction.broadcast":
+		var txHex string
+		if err := electrumParam(params, 0, &txHex); err != nil {
+			return nil, err
+		}
+		if _, err := hex.DecodeString(txHex); err != nil {
+			return nil, electrum.NewError(electrum.CodeBadRequest, "tx invalid")
+		}
+		if s.canPush == nil {
+			return nil, electrum.NewError(electrum.CodeBadRequest, "broadcast not allowed on "+s.transport)
+		}
+		ok, err := s.canPush()
+		if err != nil {
+			logger.Ctx(ctx).Info("electrum check scope failed", zap.Error(err))
+			return nil, electrum.NewError(electrum.CodeDaemonError, "scope check unavailable")
+		}
+		if !ok {
+			return nil, electrum.NewError(electrum.CodeBadRequest, "insufficient scope")
+		}
+		if indexLagRejectPush && service.IndexDegraded() {
+			return nil, electrum.NewError(electrum.CodeDaemonError, "index lagging, try later")
+		}
+		response, err := rpcBroadcast(ctx, "sendrawtransaction", []string{txHex})
+		if err != nil {
+			logger.Ctx(ctx).Info("electrum broadcast failed", zap.Error(err))
+			return nil, electrum.NewError(electrum.CodeDaemonError, "rpc failed")
+		}
+		if response.Error != nil {
+			return nil, electrum.NewError(electrum.CodeDaemonError, response.Error.Message)
+		}
+		return response.Result, nil
+	case "blockchain.transaction.get_merkle":
+		txidHex, err := electrumTxIdParam(params)
+		if err != nil {
+			return nil, err
+		}
+		var height int
+		if err := electrumParam(params, 1, &height); err != nil {
+			return nil, err
+		}
+		txids, err := service.GetBlockTxIds(ctx, height)
+		if err != nil {
+			return nil, electrum.NewError(electrum.CodeBadRequest, "block not found")
+		}
+		for pos, txid := range txids {
+			if hex.EncodeToString(txid) == txidHex {
+				branch, _ := electrum.MerkleBranch(txids, pos)
+				return &model.ElectrumMerkleResp{BlockHeight: height, Merkle: branch, Pos: pos}, nil
+			}
+		}
+		return nil, electrum.NewError(electrum.CodeBadRequest, "tx not in block")
+
+	case "blockchain.headers.subscribe":
+		header, err := getElectrumTipHeader(ctx)
+		if err != nil {
+			logger.Ctx(ctx).Info("electrum get tip header failed", zap.Error(err))
+			return nil, electrum.NewError(electrum.CodeDaemonError, "get header failed")
+		}
+		s.mu.Lock()
+		s.headers = true
+		s.mu.Unlock()
+		return header, nil
+	case "blockchain.block.header", "blockchain.block.headers":
+		var start int
+		if err := electrumParam(params, 0, &start); err != nil || start < 0 {
+			return nil, errElectrumParams
+		}
+		count, cpHeight := 1, 0
+		cpIndex := 1
+		if method == "blockchain.block.headers" {
+			if err := electrumParam(params, 1, &count); err != nil || count < 0 {
+				return nil, errElectrumParams
+			}
+			cpIndex = 2
+		}
+		if err := electrumOptionalParam(params, cpIndex, &cpHeight); err != nil {
+			return nil, err
+		}
+		if cpHeight != 0 {
+			return nil, electrum.NewError(electrum.CodeBadRequest, "cp_height not supported")
+		}
+		if count > service.ElectrumConf.MaxHeaders {
+			count = service.ElectrumConf.MaxHeaders
+		}
+		var headers []string
+		if count > 0 {
+			headers, err = getElectrumHeaders(ctx, start, count)
+			if err != nil {
+				logger.Ctx(ctx).Info("electrum get headers failed", zap.Error(err))
+				return nil, electrum.NewError(electrum.CodeDaemonError, "get header failed")
+			}
+		}
+		if method == "blockchain.block.header" {
+			if len(headers) == 0 {
+				return nil, electrum.NewError(electrum.CodeBadRequest, "height out of range")
+			}
+			return headers[0], nil
+		}
+		return &model.ElectrumHeadersResp{
+			Count: len(headers),
+			Hex:   strings.Join(headers, ""),
+			Max:   service.ElectrumConf.MaxHeaders,
+		}, nil
+
+	case "blockchain.estimatefee", "blockchain.relayfee":
+		return service.ElectrumConf.RelayFee, nil
+	case "mempool.get_fee_histogram":
+		return []interface{}{}, nil
+	}
+	label = "unknown"
+	return nil, electrum.NewError(electrum.CodeMethodNotFound, "unknown method "+method)
+}
+
+// serveElectrum 处理一个连接直到断开、订阅关闭或服务退出
+func serveElectrum(ctx context.Context, s *electrumSession) {
+	metrics.ElectrumSessions.WithLabelValues(s.transport).Inc()
+	defer metrics.ElectrumSessions.WithLabelValues(s.transport).Dec()
+
+	blocks, _, err := service.SubscribeBlocks()
+	if err != nil {
+		s.Close()
+		return
+	}
+	defer blocks.Close()
+	defer s.close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go s.notifyLoop(ctx, blocks)
+	if err := s.Serve(ctx, s.handle); err != nil && ctx.Err() == nil {
+		logger.Ctx(ctx).Debug("electrum session ended", zap.String("transport", s.transport), zap.Error(err))
+	}
+}
+
+// ElectrumWs
+// @Summary ElectrumX兼容的scripthash协议，websocket传输
+// @Description 每帧一条JSON-RPC请求或批量请求，支持blockchain.scripthash.*、blockchain.transaction.*、blockchain.headers.subscribe、blockchain.block.header(s)等方法。scripthash按订阅数扣减配额，广播交易需要push scope
+// @Tags Electrum
+// @Success 101 {string} string
+// @Router /electrum [get]
+func ElectrumWs(ctx *gin.Context) {
+	conn, err := wsUpgrader.Upgrade(ctx.Writer, ctx.Request, nil)
+	if err != nil {
+		logger.Ctx(ctx).Info("websocket upgrade failed", zap.Error(err))
+		return
+	}
+	conn.SetReadLimit(int64(service.ElectrumConf.MaxMessage))
+
+	s := newElectrumSession(&wsElectrumConn{conn: conn}, "ws")
+	s.charge = func(n int64) (string, bool) {
+		ok, reason, err := midware.ChargeQuota(ctx, n)
+		if err != nil {
+			logger.Ctx(ctx).Warn("electrum charge quota failed", zap.Error(err))
+		}
+		return reason, ok
+	}
+	s.canPush = func() (bool, error) {
+		return midware.CheckScope(ctx, midware.ScopePush)
+	}
+	serveElectrum(ctx.Request.Context(), s)
+}
+
+// electrumTcpSessions TCP连接总数及每个IP的连接数
+var electrumTcpSessions = struct {
+	mu    sync.Mutex
+	total int
+	perIp map[string]int
+}{perIp: map[string]int{}}
+
+// acquireElectrumTcp 连接数未超过限制时占用一个名额
+func acquireElectrumTcp(ip string) bool {
+	electrumTcpSessions.mu.Lock()
+	defer electrumTcpSessions.mu.Unlock()
+	if electrumTcpSessions.total >= service.ElectrumConf.TcpMaxSessions ||
+		electrumTcpSessions.perIp[ip] >= service.ElectrumConf.TcpMaxPerIp {
+		return false
+	}
+	electrumTcpSessions.total++
+	electrumTcpSessions.perIp[ip]++
+	return true
+}
+
+func releaseElectrumTcp(ip string) {
+	electrumTcpSessions.mu.Lock()
+	defer electrumTcpSessions.mu.Unlock()
+	electrumTcpSessions.total--
+	if electrumTcpSessions.perIp[ip]--; electrumTcpSessions.perIp[ip] <= 0 {
+		delete(electrumTcpSessions.perIp, ip)
+	}
+}
+
+// ServeElectrumTcp 在ln上提供换行分隔的Electrum协议，直到ln关闭。
+// TCP连接没有token鉴权，不扣配额也不能广播交易，按总数及每个IP限制同时连接数
+func ServeElectrumTcp(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Temporary() {
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			return
+		}
+		ip, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+		if !acquireElectrumTcp(ip) {
+			logger.Log.Info("electrum tcp session limit", zap.String("ip", ip))
+			conn.Close()
+			continue
+		}
+		s := newElectrumSession(electrum.NewLineConn(conn,
+			service.ElectrumConf.MaxMessage, service.ElectrumConf.IdleTimeout, wsWriteTimeout), "tcp")
+		go func() {
+			defer releaseElectrumTcp(ip)
+			serveElectrum(context.Background(), s)
+		}()
+	}
+}
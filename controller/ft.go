@@ -22,11 +22,11 @@ import (
 // @Security BearerAuth
 // @Router /ft/codehash/all [get]
 func ListAllFTCodeHash(ctx *gin.Context) {
-	logger.Log.Info("ListAllFTCodeHash enter")
+	logger.Ctx(ctx).Info("ListAllFTCodeHash enter")
 
-	result, err := service.GetTokenCodeHash(scriptDecoder.CodeType_FT)
+	result, err := service.GetTokenCodeHash(ctx.Request.Context(), scriptDecoder.CodeType_FT)
 	if err != nil {
-		logger.Log.Info("get ft codehash failed", zap.Error(err))
+		logger.Ctx(ctx).Info("get ft codehash failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "get ft codehash failed"})
 		return
 	}
@@ -46,11 +46,11 @@ func ListAllFTCodeHash(ctx *gin.Context) {
 // @Security BearerAuth
 // @Router /ft/info/all [get]
 func ListAllFTInfo(ctx *gin.Context) {
-	logger.Log.Info("ListFTInfo enter")
+	logger.Ctx(ctx).Info("ListFTInfo enter")
 
-	result, err := service.GetFTInfo()
+	result, err := service.GetFTInfo(ctx.Request.Context())
 	if err != nil {
-		logger.Log.Info("get ft info failed", zap.Error(err))
+		logger.Ctx(ctx).Info("get ft info failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "get ft info failed"})
 		return
 	}
@@ -71,20 +71,20 @@ func ListAllFTInfo(ctx *gin.Context) {
 // @Security BearerAuth
 // @Router /ft/codehash-info/{codehash} [get]
 func ListFTSummary(ctx *gin.Context) {
-	logger.Log.Info("ListFTSummary enter")
+	logger.Ctx(ctx).Info("ListFTSummary enter")
 
 	codeHashHex := ctx.Param("codehash")
 	// check
 	_, err := hex.DecodeString(codeHashHex)
 	if err != nil {
-		logger.Log.Info("codeHash invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("codeHash invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "codeHash invalid"})
 		return
 	}
 
-	result, err := service.GetFTSummary(codeHashHex)
+	result, err := service.GetFTSummary(ctx.Request.Context(), codeHashHex)
 	if err != nil {
-		logger.Log.Info("get ft summary failed", zap.Error(err))
+		logger.Ctx(ctx).Info("get ft summary failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "get ft summary failed"})
 		return
 	}
@@ -106,13 +106,13 @@ func ListFTSummary(ctx *gin.Context) {
 // @Security BearerAuth
 // @Router /ft/genesis-info/{codehash}/{genesis} [get]
 func ListFTInfoByGenesis(ctx *gin.Context) {
-	logger.Log.Info("ListFTInfoByGenesis enter")
+	logger.Ctx(ctx).Info("ListFTInfoByGenesis enter")
 
 	codeHashHex := ctx.Param("codehash")
 	// check
 	_, err := hex.DecodeString(codeHashHex)
 	if err != nil {
-		logger.Log.Info("codeHash invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("codeHash invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "codeHash invalid"})
 		return
 	}
@@ -121,14 +121,14 @@ func ListFTInfoByGenesis(ctx *gin.Context) {
 	// check
 	_, err = hex.DecodeString(genesisIdHex)
 	if err != nil {
-		logger.Log.Info("genesisId invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("genesisId invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "genesisId invalid"})
 		return
 	}
 
-	result, err := service.ListFTInfoByGenesis(codeHashHex, genesisIdHex)
+	result, err := service.ListFTInfoByGenesis(ctx.Request.Context(), codeHashHex, genesisIdHex)
 	if err != nil {
-		logger.Log.Info("get ft summary failed", zap.Error(err))
+		logger.Ctx(ctx).Info("get ft summary failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "get ft summary failed"})
 		return
 	}
@@ -152,26 +152,26 @@ func ListFTInfoByGenesis(ctx *gin.Context) {
 // @Security BearerAuth
 // @Router /ft/transfer-times/{codehash}/{genesis} [get]
 func GetFTTransferVolumeInBlockRange(ctx *gin.Context) {
-	logger.Log.Info("GetFTTransferVolumeInBlockRange enter")
+	logger.Ctx(ctx).Info("GetFTTransferVolumeInBlockRange enter")
 
 	// check height
 	blkStartHeightString := ctx.DefaultQuery("start", "0")
 	blkStartHeight, err := strconv.Atoi(blkStartHeightString)
 	if err != nil || blkStartHeight < 0 {
-		logger.Log.Info("blk start height invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("blk start height invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "blk start height invalid"})
 		return
 	}
 	blkEndHeightString := ctx.DefaultQuery("end", "0")
 	blkEndHeight, err := strconv.Atoi(blkEndHeightString)
 	if err != nil || blkEndHeight < 0 {
-		logger.Log.Info("blk end height invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("blk end height invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "blk end height invalid"})
 		return
 	}
 
 	if blkEndHeight <= blkStartHeight || (blkEndHeight-blkStartHeight > 1000) {
-		logger.Log.Info("blk end height invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("blk end height invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "blk end height invalid"})
 		return
 	}
@@ -180,7 +180,7 @@ func GetFTTransferVolumeInBlockRange(ctx *gin.Context) {
 	// check
 	_, err = hex.DecodeString(codeHashHex)
 	if err != nil {
-		logger.Log.Info("codeHash invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("codeHash invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "codeHash invalid"})
 		return
 	}
@@ -189,14 +189,14 @@ func GetFTTransferVolumeInBlockRange(ctx *gin.Context) {
 	// check
 	_, err = hex.DecodeString(genesisIdHex)
 	if err != nil {
-		logger.Log.Info("genesisId invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("genesisId invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "genesisId invalid"})
 		return
 	}
 
-	result, err := service.GetTokenVolumesInBlocksByHeightRange(blkStartHeight, blkEndHeight, codeHashHex, genesisIdHex, scriptDecoder.CodeType_FT, 0)
+	result, err := service.GetTokenVolumesInBlocksByHeightRange(ctx.Request.Context(), blkStartHeight, blkEndHeight, codeHashHex, genesisIdHex, scriptDecoder.CodeType_FT, 0)
 	if err != nil {
-		logger.Log.Info("get token volumes failed", zap.Error(err))
+		logger.Ctx(ctx).Info("get token volumes failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "get token volumes failed"})
 		return
 	}
@@ -220,20 +220,20 @@ func GetFTTransferVolumeInBlockRange(ctx *gin.Context) {
 // @Security BearerAuth
 // @Router /ft/owners/{codehash}/{genesis} [get]
 func ListFTOwners(ctx *gin.Context) {
-	logger.Log.Info("ListFTOwners enter")
+	logger.Ctx(ctx).Info("ListFTOwners enter")
 
 	// get cursor/size
 	cursorString := ctx.DefaultQuery("cursor", "0")
 	cursor, err := strconv.Atoi(cursorString)
 	if err != nil || cursor < 0 {
-		logger.Log.Info("cursor invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("cursor invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "cursor invalid"})
 		return
 	}
 	sizeString := ctx.DefaultQuery("size", "16")
 	size, err := strconv.Atoi(sizeString)
 	if err != nil || size <= 0 {
-		logger.Log.Info("size invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("size invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "size invalid"})
 		return
 	}
@@ -242,7 +242,7 @@ func ListFTOwners(ctx *gin.Context) {
 	// check
 	codeHash, err := hex.DecodeString(codeHashHex)
 	if err != nil {
-		logger.Log.Info("codeHash invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("codeHash invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "codeHash invalid"})
 		return
 	}
@@ -251,14 +251,14 @@ func ListFTOwners(ctx *gin.Context) {
 	// check
 	genesisId, err := hex.DecodeString(genesisIdHex)
 	if err != nil {
-		logger.Log.Info("genesisId invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("genesisId invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "genesisId invalid"})
 		return
 	}
 
-	result, err := service.GetTokenOwnersByCodeHashGenesis(cursor, size, codeHash, genesisId)
+	result, err := service.GetTokenOwnersByCodeHashGenesis(ctx.Request.Context(), cursor, size, codeHash, genesisId)
 	if err != nil {
-		logger.Log.Info("get token owner failed", zap.Error(err))
+		logger.Ctx(ctx).Info("get token owner failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "get token owner failed"})
 		return
 	}
@@ -281,7 +281,7 @@ func ListFTOwners(ctx *gin.Context) {
 // @Security BearerAuth
 // @Router /ft/summary-data/{address} [get]
 func ListAllFTSummaryDataByOwner(ctx *gin.Context) {
-	logger.Log.Info("ListAllFTOwners enter")
+	logger.Ctx(ctx).Info("ListAllFTOwners enter")
 
 	ListAllFTSummaryByOwnerCommon(ctx, true)
 }
@@ -297,25 +297,25 @@ func ListAllFTSummaryDataByOwner(ctx *gin.Context) {
 // @Security BearerAuth
 // @Router /ft/summary/{address} [get]
 func ListAllFTSummaryByOwner(ctx *gin.Context) {
-	logger.Log.Info("ListAllFTOwners enter")
+	logger.Ctx(ctx).Info("ListAllFTOwners enter")
 
 	ListAllFTSummaryByOwnerCommon(ctx, false)
 }
 
 func ListAllFTSummaryByOwnerCommon(ctx *gin.Context, page bool) {
-	logger.Log.Info("ListAllFTOwners enter")
+	logger.Ctx(ctx).Info("ListAllFTOwners enter")
 	// get cursor/size
 	cursorString := ctx.DefaultQuery("cursor", "0")
 	cursor, err := strconv.Atoi(cursorString)
 	if err != nil || cursor < 0 {
-		logger.Log.Info("cursor invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("cursor invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "cursor invalid"})
 		return
 	}
 	sizeString := ctx.DefaultQuery("size", "16")
 	size, err := strconv.Atoi(sizeString)
 	if err != nil || size <= 0 {
-		logger.Log.Info("size invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("size invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "size invalid"})
 		return
 	}
@@ -324,14 +324,14 @@ func ListAllFTSummaryByOwnerCommon(ctx *gin.Context, page bool) {
 	// check
 	addressPkh, err := utils.DecodeAddress(address)
 	if err != nil {
-		logger.Log.Info("address invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("address invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "address invalid"})
 		return
 	}
 
-	result, total, err := service.GetAllTokenBalanceByAddress(cursor, size, addressPkh)
+	result, total, err := service.GetAllTokenBalanceByAddress(ctx.Request.Context(), cursor, size, addressPkh)
 	if err != nil {
-		logger.Log.Info("get token balance failed", zap.Error(err))
+		logger.Ctx(ctx).Info("get token balance failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "get token balance failed"})
 		return
 	}
@@ -367,12 +367,12 @@ func ListAllFTSummaryByOwnerCommon(ctx *gin.Context, page bool) {
 // @Security BearerAuth
 // @Router /ft/balance/{codehash}/{genesis}/{address} [get]
 func GetFTBalanceByOwner(ctx *gin.Context) {
-	logger.Log.Info("GetFTBalanceByOwner enter")
+	logger.Ctx(ctx).Info("GetFTBalanceByOwner enter")
 	codeHashHex := ctx.Param("codehash")
 	// check
 	codeHash, err := hex.DecodeString(codeHashHex)
 	if err != nil {
-		logger.Log.Info("codeHash invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("codeHash invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "codeHash invalid"})
 		return
 	}
@@ -381,7 +381,7 @@ func GetFTBalanceByOwner(ctx *gin.Context) {
 	// check
 	genesisId, err := hex.DecodeString(genesisIdHex)
 	if err != nil {
-		logger.Log.Info("genesisId invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("genesisId invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "genesisId invalid"})
 		return
 	}
@@ -390,14 +390,14 @@ func GetFTBalanceByOwner(ctx *gin.Context) {
 	// check
 	addressPkh, err := utils.DecodeAddress(address)
 	if err != nil {
-		logger.Log.Info("address invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("address invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "address invalid"})
 		return
 	}
 
-	result, err := service.GetTokenBalanceByCodeHashGenesisAddress(codeHash, genesisId, addressPkh)
+	result, err := service.GetTokenBalanceByCodeHashGenesisAddress(ctx.Request.Context(), codeHash, genesisId, addressPkh)
 	if err != nil {
-		logger.Log.Info("get ft balance failed", zap.Error(err))
+		logger.Ctx(ctx).Info("get ft balance failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "get ft balance failed"})
 		return
 	}
@@ -0,0 +1,131 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sensiblequery/logger"
+	"sensiblequery/model"
+	"sensiblequery/service"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const healthCheckTimeout = 2 * time.Second
+
+var startedAt = time.Now()
+
+// bitcoindChecker 通过getblockcount检查节点rpc，rpc客户端不支持ctx，超时后不再等待
+func bitcoindChecker(ctx context.Context) (string, error) {
+	type result struct {
+		detail string
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		response, err := rpcCall(ctx, "getblockcount")
+		if err != nil {
+			done <- result{err: err}
+			return
+		}
+		if response.Error != nil {
+			done <- result{err: errors.New(response.Error.Message)}
+			return
+		}
+		height, err := response.GetInt()
+		healthy, nodes := 0, rpcNodeStatus()
+		for _, st := range nodes {
+			if st.Healthy {
+				healthy++
+			}
+		}
+		done <- result{detail: fmt.Sprintf("height=%d nodes=%d/%d", height, healthy, len(nodes)), err: err}
+	}()
+
+	select {
+	case res := <-done:
+		return res.detail, res.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+func checkDependencies(ctx context.Context) (bool, []*model.HealthCheckResp) {
+	checkers := service.StorageCheckers()
+	checkers["bitcoind"] = bitcoindChecker
+	return service.CheckHealth(ctx, checkers, healthCheckTimeout)
+}
+
+// HealthLive
+// @Summary 存活检查，进程可以处理请求即返回200
+// @Tags Health
+// @Produce  json
+// @Success 200 {object} model.Response "{"code": 0, "msg": "ok"}"
+// @Router /health/live [get]
+func HealthLive(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, model.Response{Code: 0, Msg: "ok"})
+}
+
+// HealthReady
+// @Summary 就绪检查，ClickHouse、各redis实例和bitcoind均可用时返回200，否则返回503。收到退出信号后返回503
+// @Tags Health
+// @Produce  json
+// @Success 200 {object} model.Response "{"code": 0, "msg": "ok"}"
+// @Failure 503 {object} model.Response{data=[]model.HealthCheckResp} "{"code": -1, "data": [{}], "msg": "not ready"}"
+// @Router /health/ready [get]
+func HealthReady(ctx *gin.Context) {
+	// 收到退出信号后不再接收新流量
+	if service.Draining() {
+		ctx.JSON(http.StatusServiceUnavailable, model.Response{Code: -1, Msg: "shutting down"})
+		return
+	}
+	ok, checks := checkDependencies(ctx.Request.Context())
+	if !ok {
+		failed := []*model.HealthCheckResp{}
+		for _, check := range checks {
+			if check.Status != model.HealthOk {
+				failed = append(failed, check)
+			}
+		}
+		logger.Ctx(ctx).Warn("not ready", zap.Any("checks", failed))
+		ctx.JSON(http.StatusServiceUnavailable, model.Response{Code: -1, Msg: "not ready", Data: failed})
+		return
+	}
+	ctx.JSON(http.StatusOK, model.Response{Code: 0, Msg: "ok"})
+}
+
+// HealthStatus
+// @Summary 服务及各依赖的详细状态，包括检查耗时、错误信息和索引同步状态。有依赖不可用时返回503，索引落后时status为degraded
+// @Tags Health
+// @Produce  json
+// @Success 200 {object} model.Response{data=model.HealthStatusResp} "{"code": 0, "data": {}, "msg": "ok"}"
+// @Failure 503 {object} model.Response{data=model.HealthStatusResp} "{"code": -1, "data": {}, "msg": "not ready"}"
+// @Router /health/status [get]
+func HealthStatus(ctx *gin.Context) {
+	ok, checks := checkDependencies(ctx.Request.Context())
+	status := &model.HealthStatusResp{
+		Status:    model.HealthOk,
+		StartedAt: startedAt.Unix(),
+		Uptime:    int64(time.Since(startedAt).Seconds()),
+		Checks:    checks,
+		Index:     service.GetIndexStatus(),
+	}
+	if service.Draining() {
+		status.Status = model.HealthError
+		ctx.JSON(http.StatusServiceUnavailable, model.Response{Code: -1, Msg: "shutting down", Data: status})
+		return
+	}
+	if !ok {
+		status.Status = model.HealthError
+		ctx.JSON(http.StatusServiceUnavailable, model.Response{Code: -1, Msg: "not ready", Data: status})
+		return
+	}
+	// 索引落后仍可服务，所有实例共用同一索引，不影响就绪检查
+	if status.Index != nil && status.Index.Degraded {
+		status.Status = model.HealthDegraded
+	}
+	ctx.JSON(http.StatusOK, model.Response{Code: 0, Msg: "ok", Data: status})
+}
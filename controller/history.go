@@ -3,6 +3,7 @@ package controller
 import (
 	"encoding/hex"
 	"net/http"
+	"sensiblequery/lib/settings"
 	"sensiblequery/lib/utils"
 	"sensiblequery/logger"
 	"sensiblequery/model"
@@ -13,10 +14,6 @@ import (
 	"go.uber.org/zap"
 )
 
-const MAX_HISTORY_SIZE = 2048
-const MAX_HISTORY_LIMIT = 102400
-const MAX_HISTORY_BLOCK_RANGE = 100000
-
 // GetTxsHistoryInfoByAddress
 // @Summary 通过地址address获取相关tx历史记录信息，包括记录条数等
 // @Tags History
@@ -26,20 +23,20 @@ const MAX_HISTORY_BLOCK_RANGE = 100000
 // @Security BearerAuth
 // @Router /address/{address}/history/info [get]
 func GetTxsHistoryInfoByAddress(ctx *gin.Context) {
-	logger.Log.Info("GetTxsHistoryInfoByAddress enter")
+	logger.Ctx(ctx).Info("GetTxsHistoryInfoByAddress enter")
 
 	address := ctx.Param("address")
 	// check
 	addressPkh, err := utils.DecodeAddress(address)
 	if err != nil {
-		logger.Log.Info("address invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("address invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "address invalid"})
 		return
 	}
 
-	result, err := service.GetTxsHistoryInfoByAddress(addressPkh)
+	result, err := service.GetTxsHistoryInfoByAddress(ctx.Request.Context(), addressPkh)
 	if err != nil {
-		logger.Log.Info("get txs history info failed", zap.Error(err))
+		logger.Ctx(ctx).Info("get txs history info failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "get txs history info failed"})
 		return
 	}
@@ -55,14 +52,14 @@ func GetTxsHistoryInfoByAddress(ctx *gin.Context) {
 // @Summary 通过地址address获取相关tx历史列表，返回tx概要
 // @Tags History
 // @Produce  json
-// @Param cursor query int true "起始游标" default(0)
+// @Param cursor query string true "起始游标，可为offset或上一页返回的next/prev" default(0)
 // @Param size query int true "返回记录数量" default(16)
 // @Param address path string true "Address" default(17SkEw2md5avVNyYgj6RiXuQKNwkXaxFyQ)
 // @Success 200 {object} model.Response{data=[]model.TxInfoResp} "{"code": 0, "data": [{}], "msg": "ok"}"
 // @Security BearerAuth
 // @Router /address/{address}/history/tx [get]
 func GetTxsHistoryByAddress(ctx *gin.Context) {
-	logger.Log.Info("GetTxsHistoryByAddress enter")
+	logger.Ctx(ctx).Info("GetTxsHistoryByAddress enter")
 	GetTxsHistoryByAddressAndType(ctx, model.HISTORY_CONTRACT_P2PKH_BOTH)
 }
 
@@ -70,33 +67,23 @@ func GetTxsHistoryByAddress(ctx *gin.Context) {
 // @Summary 通过地址address获取合约相关tx历史列表，返回tx概要
 // @Tags History
 // @Produce  json
-// @Param cursor query int true "起始游标" default(0)
+// @Param cursor query string true "起始游标，可为offset或上一页返回的next/prev" default(0)
 // @Param size query int true "返回记录数量" default(16)
 // @Param address path string true "Address" default(17SkEw2md5avVNyYgj6RiXuQKNwkXaxFyQ)
 // @Success 200 {object} model.Response{data=[]model.TxInfoResp} "{"code": 0, "data": [{}], "msg": "ok"}"
 // @Security BearerAuth
 // @Router /address/{address}/contract-history/tx [get]
 func GetContractTxsHistoryByAddress(ctx *gin.Context) {
-	logger.Log.Info("GetContractTxsHistoryByAddress enter")
+	logger.Ctx(ctx).Info("GetContractTxsHistoryByAddress enter")
 	GetTxsHistoryByAddressAndType(ctx, model.HISTORY_CONTRACT_ONLY)
 }
 
 func GetTxsHistoryByAddressAndType(ctx *gin.Context, historyType model.HistoryType) {
-	logger.Log.Info("GetTxsHistoryByAddressAndType enter")
+	logger.Ctx(ctx).Info("GetTxsHistoryByAddressAndType enter")
 
 	// get cursor/size
-	cursorString := ctx.DefaultQuery("cursor", "0")
-	cursor, err := strconv.Atoi(cursorString)
-	if err != nil || cursor < 0 {
-		logger.Log.Info("cursor invalid", zap.Error(err))
-		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "cursor invalid"})
-		return
-	}
-	sizeString := ctx.DefaultQuery("size", "16")
-	size, err := strconv.Atoi(sizeString)
-	if err != nil || size <= 0 || size > MAX_HISTORY_SIZE {
-		logger.Log.Info("size invalid", zap.Error(err))
-		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "size invalid"})
+	page, ok := getPageParams(ctx, settings.Get().Limits.MaxHistorySize, 0)
+	if !ok {
 		return
 	}
 
@@ -104,14 +91,14 @@ func GetTxsHistoryByAddressAndType(ctx *gin.Context, historyType model.HistoryTy
 	// check
 	addressPkh, err := utils.DecodeAddress(address)
 	if err != nil {
-		logger.Log.Info("address invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("address invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "address invalid"})
 		return
 	}
 
-	result, err := service.GetTxsHistoryByAddressAndTypeByHeightRange(cursor, size, addressPkh, historyType)
+	result, next, prev, err := service.GetTxsHistoryByAddressAndTypeByHeightRange(ctx.Request.Context(), page, addressPkh, historyType)
 	if err != nil {
-		logger.Log.Info("get txs history failed", zap.Error(err))
+		logger.Ctx(ctx).Info("get txs history failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "get txs history failed"})
 		return
 	}
@@ -120,6 +107,8 @@ func GetTxsHistoryByAddressAndType(ctx *gin.Context, historyType model.HistoryTy
 		Code: 0,
 		Msg:  "ok",
 		Data: result,
+		Next: next,
+		Prev: prev,
 	})
 }
 
@@ -129,7 +118,7 @@ func GetTxsHistoryByAddressAndType(ctx *gin.Context, historyType model.HistoryTy
 // @Produce  json
 // @Param start query int true "Start Block Height" default(666666)
 // @Param end query int true "End Block Height, (0 to get mempool data)" default(0)
-// @Param cursor query int true "起始游标" default(0)
+// @Param cursor query string true "起始游标，可为offset或上一页返回的next/prev" default(0)
 // @Param size query int true "返回记录数量" default(16)
 // @Param codehash path string true "Code Hash160" default(844c56bb99afc374967a27ce3b46244e2e1fba60)
 // @Param genesis path string true "Genesis ID " default(74967a27ce3b46244e2e1fba60844c56bb99afc3)
@@ -138,43 +127,33 @@ func GetTxsHistoryByAddressAndType(ctx *gin.Context, historyType model.HistoryTy
 // @Security BearerAuth
 // @Router /contract/history/{codehash}/{genesis}/{address} [get]
 func GetHistoryByGenesis(ctx *gin.Context) {
-	logger.Log.Info("GetHistoryByGenesis enter")
+	logger.Ctx(ctx).Info("GetHistoryByGenesis enter")
 
 	// check height
 	blkStartHeightString := ctx.DefaultQuery("start", "666666")
 	blkStartHeight, err := strconv.Atoi(blkStartHeightString)
 	if err != nil || blkStartHeight < 0 {
-		logger.Log.Info("blk start height invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("blk start height invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "blk start height invalid"})
 		return
 	}
 	blkEndHeightString := ctx.DefaultQuery("end", "0")
 	blkEndHeight, err := strconv.Atoi(blkEndHeightString)
 	if err != nil || blkEndHeight < 0 {
-		logger.Log.Info("blk end height invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("blk end height invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "blk end height invalid"})
 		return
 	}
 
-	if blkEndHeight > 0 && (blkEndHeight <= blkStartHeight || (blkEndHeight-blkStartHeight > MAX_HISTORY_BLOCK_RANGE)) {
-		logger.Log.Info("blk end height invalid", zap.Error(err))
+	if blkEndHeight > 0 && (blkEndHeight <= blkStartHeight || (blkEndHeight-blkStartHeight > settings.Get().Limits.MaxHistoryBlockRange)) {
+		logger.Ctx(ctx).Info("blk end height invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "blk end height invalid"})
 		return
 	}
 
 	// get cursor/size
-	cursorString := ctx.DefaultQuery("cursor", "0")
-	cursor, err := strconv.Atoi(cursorString)
-	if err != nil || cursor < 0 {
-		logger.Log.Info("cursor invalid", zap.Error(err))
-		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "cursor invalid"})
-		return
-	}
-	sizeString := ctx.DefaultQuery("size", "16")
-	size, err := strconv.Atoi(sizeString)
-	if err != nil || size <= 0 || size > MAX_HISTORY_SIZE || cursor+size > MAX_HISTORY_LIMIT {
-		logger.Log.Info("size invalid", zap.Error(err))
-		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "size invalid"})
+	page, ok := getPageParams(ctx, settings.Get().Limits.MaxHistorySize, settings.Get().Limits.MaxHistoryLimit)
+	if !ok {
 		return
 	}
 
@@ -182,7 +161,7 @@ func GetHistoryByGenesis(ctx *gin.Context) {
 	// check
 	_, err = hex.DecodeString(codehashHex)
 	if err != nil {
-		logger.Log.Info("codeHash invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("codeHash invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "codeHash invalid"})
 		return
 	}
@@ -191,7 +170,7 @@ func GetHistoryByGenesis(ctx *gin.Context) {
 	// check
 	_, err = hex.DecodeString(genesisIdHex)
 	if err != nil {
-		logger.Log.Info("genesisId invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("genesisId invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "genesisId invalid"})
 		return
 	}
@@ -200,21 +179,24 @@ func GetHistoryByGenesis(ctx *gin.Context) {
 	// check
 	addressPkh, err := utils.DecodeAddress(address)
 	if err != nil {
-		logger.Log.Info("address invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("address invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "address invalid"})
 		return
 	}
-	result, err := service.GetHistoryByGenesisByHeightRange(cursor, size, blkStartHeight, blkEndHeight, codehashHex, genesisIdHex, hex.EncodeToString(addressPkh))
+	result, err := service.GetHistoryByGenesisByHeightRange(ctx.Request.Context(), page, blkStartHeight, blkEndHeight, codehashHex, genesisIdHex, hex.EncodeToString(addressPkh))
 	if err != nil {
-		logger.Log.Info("get history failed", zap.Error(err))
+		logger.Ctx(ctx).Info("get history failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "get histroy failed"})
 		return
 	}
 
+	next, prev := service.HistoryPageLinks(page, result)
 	ctx.JSON(http.StatusOK, model.Response{
 		Code: 0,
 		Msg:  "ok",
 		Data: result,
+		Next: next,
+		Prev: prev,
 	})
 }
 
@@ -224,7 +206,7 @@ func GetHistoryByGenesis(ctx *gin.Context) {
 // @Produce  json
 // @Param start query int true "Start Block Height" default(666666)
 // @Param end query int true "End Block Height, (0 to get mempool data)" default(0)
-// @Param cursor query int true "起始游标" default(0)
+// @Param cursor query string true "起始游标，可为offset或上一页返回的next/prev" default(0)
 // @Param size query int true "返回记录数量" default(10)
 // @Param codehash path string true "Code Hash160" default(844c56bb99afc374967a27ce3b46244e2e1fba60)
 // @Param genesis path string true "Genesis ID " default(74967a27ce3b46244e2e1fba60844c56bb99afc3)
@@ -233,7 +215,7 @@ func GetHistoryByGenesis(ctx *gin.Context) {
 // @Security BearerAuth
 // @Router /ft/history/{codehash}/{genesis}/{address} [get]
 func GetFTHistoryByGenesis(ctx *gin.Context) {
-	logger.Log.Info("GetFTHistoryByGenesis enter")
+	logger.Ctx(ctx).Info("GetFTHistoryByGenesis enter")
 	GetHistoryByGenesis(ctx)
 }
 
@@ -243,7 +225,7 @@ func GetFTHistoryByGenesis(ctx *gin.Context) {
 // @Produce  json
 // @Param start query int true "Start Block Height" default(666666)
 // @Param end query int true "End Block Height, (0 to get mempool data)" default(0)
-// @Param cursor query int true "起始游标" default(0)
+// @Param cursor query string true "起始游标，可为offset或上一页返回的next/prev" default(0)
 // @Param size query int true "返回记录数量" default(10)
 // @Param codehash path string true "Code Hash160" default(844c56bb99afc374967a27ce3b46244e2e1fba60)
 // @Param genesis path string true "Genesis ID " default(74967a27ce3b46244e2e1fba60844c56bb99afc3)
@@ -252,7 +234,7 @@ func GetFTHistoryByGenesis(ctx *gin.Context) {
 // @Security BearerAuth
 // @Router /nft/history/{codehash}/{genesis}/{address} [get]
 func GetNFTHistoryByGenesis(ctx *gin.Context) {
-	logger.Log.Info("GetNFTHistoryByGenesis enter")
+	logger.Ctx(ctx).Info("GetNFTHistoryByGenesis enter")
 	GetHistoryByGenesis(ctx)
 }
 
@@ -262,7 +244,7 @@ func GetNFTHistoryByGenesis(ctx *gin.Context) {
 // @Produce  json
 // @Param start query int true "Start Block Height" default(666666)
 // @Param end query int true "End Block Height, (0 to get mempool data)" default(0)
-// @Param cursor query int true "起始游标" default(0)
+// @Param cursor query string true "起始游标，可为offset或上一页返回的next/prev" default(0)
 // @Param size query int true "返回记录数量" default(16)
 // @Param desc query boolean true "逆序返回记录" default(true)
 // @Param codehash path string true "Code Hash160" default(844c56bb99afc374967a27ce3b46244e2e1fba60)
@@ -271,43 +253,33 @@ func GetNFTHistoryByGenesis(ctx *gin.Context) {
 // @Security BearerAuth
 // @Router /contract/history/{codehash}/{genesis} [get]
 func GetAllHistoryByGenesis(ctx *gin.Context) {
-	logger.Log.Info("GetAllHistoryByGenesis enter")
+	logger.Ctx(ctx).Info("GetAllHistoryByGenesis enter")
 
 	// check height
 	blkStartHeightString := ctx.DefaultQuery("start", "666666")
 	blkStartHeight, err := strconv.Atoi(blkStartHeightString)
 	if err != nil || blkStartHeight < 0 {
-		logger.Log.Info("blk start height invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("blk start height invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "blk start height invalid"})
 		return
 	}
 	blkEndHeightString := ctx.DefaultQuery("end", "0")
 	blkEndHeight, err := strconv.Atoi(blkEndHeightString)
 	if err != nil || blkEndHeight < 0 {
-		logger.Log.Info("blk end height invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("blk end height invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "blk end height invalid"})
 		return
 	}
 
-	if blkEndHeight > 0 && (blkEndHeight <= blkStartHeight || (blkEndHeight-blkStartHeight > MAX_HISTORY_BLOCK_RANGE)) {
-		logger.Log.Info("blk end height invalid", zap.Error(err))
+	if blkEndHeight > 0 && (blkEndHeight <= blkStartHeight || (blkEndHeight-blkStartHeight > settings.Get().Limits.MaxHistoryBlockRange)) {
+		logger.Ctx(ctx).Info("blk end height invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "blk end height invalid"})
 		return
 	}
 
 	// get cursor/size
-	cursorString := ctx.DefaultQuery("cursor", "0")
-	cursor, err := strconv.Atoi(cursorString)
-	if err != nil || cursor < 0 {
-		logger.Log.Info("cursor invalid", zap.Error(err))
-		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "cursor invalid"})
-		return
-	}
-	sizeString := ctx.DefaultQuery("size", "16")
-	size, err := strconv.Atoi(sizeString)
-	if err != nil || size <= 0 || size > MAX_HISTORY_SIZE || cursor+size > MAX_HISTORY_LIMIT {
-		logger.Log.Info("size invalid", zap.Error(err))
-		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "size invalid"})
+	page, ok := getPageParams(ctx, settings.Get().Limits.MaxHistorySize, settings.Get().Limits.MaxHistoryLimit)
+	if !ok {
 		return
 	}
 
@@ -315,7 +287,7 @@ func GetAllHistoryByGenesis(ctx *gin.Context) {
 	// check
 	_, err = hex.DecodeString(codehashHex)
 	if err != nil {
-		logger.Log.Info("codeHash invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("codeHash invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "codeHash invalid"})
 		return
 	}
@@ -324,24 +296,27 @@ func GetAllHistoryByGenesis(ctx *gin.Context) {
 	// check
 	_, err = hex.DecodeString(genesisIdHex)
 	if err != nil {
-		logger.Log.Info("genesisId invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("genesisId invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "genesisId invalid"})
 		return
 	}
 
 	isDesc := (ctx.DefaultQuery("desc", "true") == "true")
 
-	result, err := service.GetAllHistoryByGenesisByHeightRange(cursor, size, blkStartHeight, blkEndHeight, codehashHex, genesisIdHex, isDesc)
+	result, err := service.GetAllHistoryByGenesisByHeightRange(ctx.Request.Context(), page, blkStartHeight, blkEndHeight, codehashHex, genesisIdHex, isDesc)
 	if err != nil {
-		logger.Log.Info("get history failed", zap.Error(err))
+		logger.Ctx(ctx).Info("get history failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "get histroy failed"})
 		return
 	}
 
+	next, prev := service.HistoryPageLinks(page, result)
 	ctx.JSON(http.StatusOK, model.Response{
 		Code: 0,
 		Msg:  "ok",
 		Data: result,
+		Next: next,
+		Prev: prev,
 	})
 }
 
@@ -351,7 +326,7 @@ func GetAllHistoryByGenesis(ctx *gin.Context) {
 // @Produce  json
 // @Param start query int true "Start Block Height" default(666666)
 // @Param end query int true "End Block Height, (0 to get mempool data)" default(0)
-// @Param cursor query int true "起始游标" default(0)
+// @Param cursor query string true "起始游标，可为offset或上一页返回的next/prev" default(0)
 // @Param size query int true "返回记录数量" default(10)
 // @Param codehash path string true "Code Hash160" default(844c56bb99afc374967a27ce3b46244e2e1fba60)
 // @Param genesis path string true "Genesis ID " default(74967a27ce3b46244e2e1fba60844c56bb99afc3)
@@ -360,43 +335,33 @@ func GetAllHistoryByGenesis(ctx *gin.Context) {
 // @Security BearerAuth
 // @Router /ft/income-history/{codehash}/{genesis}/{address} [get]
 func GetFTIncomeHistoryByGenesis(ctx *gin.Context) {
-	logger.Log.Info("GetFTIncomeHistoryByGenesis enter")
+	logger.Ctx(ctx).Info("GetFTIncomeHistoryByGenesis enter")
 
 	// check height
 	blkStartHeightString := ctx.DefaultQuery("start", "666666")
 	blkStartHeight, err := strconv.Atoi(blkStartHeightString)
 	if err != nil || blkStartHeight < 0 {
-		logger.Log.Info("blk start height invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("blk start height invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "blk start height invalid"})
 		return
 	}
 	blkEndHeightString := ctx.DefaultQuery("end", "0")
 	blkEndHeight, err := strconv.Atoi(blkEndHeightString)
 	if err != nil || blkEndHeight < 0 {
-		logger.Log.Info("blk end height invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("blk end height invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "blk end height invalid"})
 		return
 	}
 
-	if blkEndHeight > 0 && (blkEndHeight <= blkStartHeight || (blkEndHeight-blkStartHeight > MAX_HISTORY_BLOCK_RANGE)) {
-		logger.Log.Info("blk end height invalid", zap.Error(err))
+	if blkEndHeight > 0 && (blkEndHeight <= blkStartHeight || (blkEndHeight-blkStartHeight > settings.Get().Limits.MaxHistoryBlockRange)) {
+		logger.Ctx(ctx).Info("blk end height invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "blk end height invalid"})
 		return
 	}
 
 	// get cursor/size
-	cursorString := ctx.DefaultQuery("cursor", "0")
-	cursor, err := strconv.Atoi(cursorString)
-	if err != nil || cursor < 0 {
-		logger.Log.Info("cursor invalid", zap.Error(err))
-		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "cursor invalid"})
-		return
-	}
-	sizeString := ctx.DefaultQuery("size", "16")
-	size, err := strconv.Atoi(sizeString)
-	if err != nil || size <= 0 || size > MAX_HISTORY_SIZE || cursor+size > MAX_HISTORY_LIMIT {
-		logger.Log.Info("size invalid", zap.Error(err))
-		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "size invalid"})
+	page, ok := getPageParams(ctx, settings.Get().Limits.MaxHistorySize, settings.Get().Limits.MaxHistoryLimit)
+	if !ok {
 		return
 	}
 
@@ -404,7 +369,7 @@ func GetFTIncomeHistoryByGenesis(ctx *gin.Context) {
 	// check
 	_, err = hex.DecodeString(codehashHex)
 	if err != nil {
-		logger.Log.Info("codeHash invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("codeHash invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "codeHash invalid"})
 		return
 	}
@@ -413,7 +378,7 @@ func GetFTIncomeHistoryByGenesis(ctx *gin.Context) {
 	// check
 	_, err = hex.DecodeString(genesisIdHex)
 	if err != nil {
-		logger.Log.Info("genesisId invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("genesisId invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "genesisId invalid"})
 		return
 	}
@@ -422,20 +387,23 @@ func GetFTIncomeHistoryByGenesis(ctx *gin.Context) {
 	// check
 	addressPkh, err := utils.DecodeAddress(address)
 	if err != nil {
-		logger.Log.Info("address invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("address invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "address invalid"})
 		return
 	}
-	result, err := service.GetIncomeHistoryByGenesisByHeightRange(cursor, size, blkStartHeight, blkEndHeight, codehashHex, genesisIdHex, hex.EncodeToString(addressPkh))
+	result, err := service.GetIncomeHistoryByGenesisByHeightRange(ctx.Request.Context(), page, blkStartHeight, blkEndHeight, codehashHex, genesisIdHex, hex.EncodeToString(addressPkh))
 	if err != nil {
-		logger.Log.Info("get income history failed", zap.Error(err))
+		logger.Ctx(ctx).Info("get income history failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "get income histroy failed"})
 		return
 	}
 
+	next, prev := service.HistoryPageLinks(page, result)
 	ctx.JSON(http.StatusOK, model.Response{
 		Code: 0,
 		Msg:  "ok",
 		Data: result,
+		Next: next,
+		Prev: prev,
 	})
 }
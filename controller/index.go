@@ -0,0 +1,76 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sensiblequery/logger"
+	"sensiblequery/model"
+	"sensiblequery/service"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// nodeBlockCount 节点getblockcount
+func nodeBlockCount(ctx context.Context) (int, error) {
+	response, err := rpcCall(ctx, "getblockcount")
+	if err != nil {
+		return 0, err
+	}
+	if response.Error != nil {
+		return 0, errors.New(response.Error.Message)
+	}
+	height, err := response.GetInt()
+	return int(height), err
+}
+
+// StartIndexMonitor 后台定期比较索引与节点高度，配置见chain.yaml的index_*，直到ctx结束
+func StartIndexMonitor(ctx context.Context) {
+	go service.RunIndexMonitor(ctx, indexLagConf, nodeBlockCount)
+}
+
+// nodeBlockHeader 节点getblockheader verbose中的区块头
+func nodeBlockHeader(ctx context.Context, blkIdHex string) (*model.NodeBlockResp, error) {
+	response, err := rpcCall(ctx, "getblockheader", blkIdHex, true)
+	if err != nil {
+		return nil, err
+	}
+	if response.Error != nil {
+		return nil, response.Error
+	}
+	header := &struct {
+		Hash              string `json:"hash"`
+		Height            int    `json:"height"`
+		PreviousBlockHash string `json:"previousblockhash"`
+		Time              int    `json:"time"`
+	}{}
+	if err := response.GetObject(header); err != nil {
+		return nil, err
+	}
+	return &model.NodeBlockResp{
+		Height:         header.Height,
+		BlockIdHex:     header.Hash,
+		PrevBlockIdHex: header.PreviousBlockHash,
+		BlockTime:      header.Time,
+	}, nil
+}
+
+// StartZmq 订阅bitcoind ZMQ通知，配置见conf/zmq.yaml，直到ctx结束
+func StartZmq(ctx context.Context) {
+	service.StartZmq(ctx, nodeBlockHeader)
+}
+
+// checkIndexForPush 配置index_lag_reject_push时，索引落后拒绝push，避免客户端基于过期的utxo构造交易
+func checkIndexForPush(ctx *gin.Context) bool {
+	if !indexLagRejectPush || !service.IndexDegraded() {
+		return true
+	}
+	status := service.GetIndexStatus()
+	logger.Ctx(ctx).Info("push rejected, index lagging",
+		zap.Int("indexHeight", status.IndexHeight),
+		zap.Int("nodeHeight", status.NodeHeight),
+	)
+	ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "index lagging, try later", Data: status})
+	return false
+}
@@ -22,11 +22,11 @@ import (
 // @Security BearerAuth
 // @Router /nft/codehash/all [get]
 func ListAllNFTCodeHash(ctx *gin.Context) {
-	logger.Log.Info("ListAllNFTCodeHash enter")
+	logger.Ctx(ctx).Info("ListAllNFTCodeHash enter")
 
-	result, err := service.GetTokenCodeHash(scriptDecoder.CodeType_NFT)
+	result, err := service.GetTokenCodeHash(ctx.Request.Context(), scriptDecoder.CodeType_NFT)
 	if err != nil {
-		logger.Log.Info("get nft failed", zap.Error(err))
+		logger.Ctx(ctx).Info("get nft failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "get nft failed"})
 		return
 	}
@@ -46,11 +46,11 @@ func ListAllNFTCodeHash(ctx *gin.Context) {
 // @Security BearerAuth
 // @Router /nft/info/all [get]
 func ListAllNFTInfo(ctx *gin.Context) {
-	logger.Log.Info("ListNFTInfo enter")
+	logger.Ctx(ctx).Info("ListNFTInfo enter")
 
-	result, err := service.GetNFTInfo()
+	result, err := service.GetNFTInfo(ctx.Request.Context())
 	if err != nil {
-		logger.Log.Info("get nft info failed", zap.Error(err))
+		logger.Ctx(ctx).Info("get nft info failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "get nft info failed"})
 		return
 	}
@@ -71,20 +71,20 @@ func ListAllNFTInfo(ctx *gin.Context) {
 // @Security BearerAuth
 // @Router /nft/codehash-info/{codehash} [get]
 func ListNFTSummary(ctx *gin.Context) {
-	logger.Log.Info("ListNFTSummary enter")
+	logger.Ctx(ctx).Info("ListNFTSummary enter")
 
 	codeHashHex := ctx.Param("codehash")
 	// check
 	_, err := hex.DecodeString(codeHashHex)
 	if err != nil {
-		logger.Log.Info("codeHash invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("codeHash invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "codeHash invalid"})
 		return
 	}
 
-	result, err := service.GetNFTSummary(codeHashHex)
+	result, err := service.GetNFTSummary(ctx.Request.Context(), codeHashHex)
 	if err != nil {
-		logger.Log.Info("get nft summary failed", zap.Error(err))
+		logger.Ctx(ctx).Info("get nft summary failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "get nft summary failed"})
 		return
 	}
@@ -106,13 +106,13 @@ func ListNFTSummary(ctx *gin.Context) {
 // @Security BearerAuth
 // @Router /nft/genesis-info/{codehash}/{genesis} [get]
 func ListNFTInfoByGenesis(ctx *gin.Context) {
-	logger.Log.Info("ListNFTInfoByGenesis enter")
+	logger.Ctx(ctx).Info("ListNFTInfoByGenesis enter")
 
 	codeHashHex := ctx.Param("codehash")
 	// check
 	_, err := hex.DecodeString(codeHashHex)
 	if err != nil {
-		logger.Log.Info("codeHash invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("codeHash invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "codeHash invalid"})
 		return
 	}
@@ -121,14 +121,14 @@ func ListNFTInfoByGenesis(ctx *gin.Context) {
 	// check
 	_, err = hex.DecodeString(genesisIdHex)
 	if err != nil {
-		logger.Log.Info("genesisId invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("genesisId invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "genesisId invalid"})
 		return
 	}
 
-	result, err := service.ListNFTInfoByGenesis(codeHashHex, genesisIdHex)
+	result, err := service.ListNFTInfoByGenesis(ctx.Request.Context(), codeHashHex, genesisIdHex)
 	if err != nil {
-		logger.Log.Info("get nft summary failed", zap.Error(err))
+		logger.Ctx(ctx).Info("get nft summary failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "get nft summary failed"})
 		return
 	}
@@ -153,13 +153,13 @@ func ListNFTInfoByGenesis(ctx *gin.Context) {
 // @Security BearerAuth
 // @Router /nft/transfer-times/{codehash}/{genesis}/{tokenid} [get]
 func GetNFTTransferTimesInBlockRange(ctx *gin.Context) {
-	logger.Log.Info("GetNFTTransferTimesInBlockRange enter")
+	logger.Ctx(ctx).Info("GetNFTTransferTimesInBlockRange enter")
 
 	// check height
 	blkStartHeightString := ctx.DefaultQuery("start", "0")
 	blkStartHeight, err := strconv.Atoi(blkStartHeightString)
 	if err != nil || blkStartHeight < 0 {
-		logger.Log.Info("blk start height invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("blk start height invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "blk start height invalid"})
 		return
 	}
@@ -167,13 +167,13 @@ func GetNFTTransferTimesInBlockRange(ctx *gin.Context) {
 	blkEndHeightString := ctx.DefaultQuery("end", "0")
 	blkEndHeight, err := strconv.Atoi(blkEndHeightString)
 	if err != nil || blkEndHeight < 0 {
-		logger.Log.Info("blk end height invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("blk end height invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "blk end height invalid"})
 		return
 	}
 
 	if blkEndHeight <= blkStartHeight || (blkEndHeight-blkStartHeight > 1000) {
-		logger.Log.Info("blk end height invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("blk end height invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "blk end height invalid"})
 		return
 	}
@@ -182,7 +182,7 @@ func GetNFTTransferTimesInBlockRange(ctx *gin.Context) {
 	// check
 	_, err = hex.DecodeString(codeHashHex)
 	if err != nil {
-		logger.Log.Info("codeHash invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("codeHash invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "codeHash invalid"})
 		return
 	}
@@ -191,7 +191,7 @@ func GetNFTTransferTimesInBlockRange(ctx *gin.Context) {
 	// check
 	_, err = hex.DecodeString(genesisIdHex)
 	if err != nil {
-		logger.Log.Info("genesisId invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("genesisId invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "genesisId invalid"})
 		return
 	}
@@ -199,14 +199,14 @@ func GetNFTTransferTimesInBlockRange(ctx *gin.Context) {
 	tokenIdxString := ctx.Param("tokenid")
 	tokenIdx, err := strconv.Atoi(tokenIdxString)
 	if err != nil || tokenIdx < 0 {
-		logger.Log.Info("tokenIdx invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("tokenIdx invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "tokenIdx invalid"})
 		return
 	}
 
-	result, err := service.GetTokenVolumesInBlocksByHeightRange(blkStartHeight, blkEndHeight, codeHashHex, genesisIdHex, scriptDecoder.CodeType_NFT, tokenIdx)
+	result, err := service.GetTokenVolumesInBlocksByHeightRange(ctx.Request.Context(), blkStartHeight, blkEndHeight, codeHashHex, genesisIdHex, scriptDecoder.CodeType_NFT, tokenIdx)
 	if err != nil {
-		logger.Log.Info("GetNFTTransferTimesInBlockRange failed", zap.Error(err))
+		logger.Ctx(ctx).Info("GetNFTTransferTimesInBlockRange failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "data failed"})
 		return
 	}
@@ -230,20 +230,20 @@ func GetNFTTransferTimesInBlockRange(ctx *gin.Context) {
 // @Security BearerAuth
 // @Router /nft/owners/{codehash}/{genesis} [get]
 func ListNFTOwners(ctx *gin.Context) {
-	logger.Log.Info("ListNFTOwners enter")
+	logger.Ctx(ctx).Info("ListNFTOwners enter")
 
 	// get cursor/size
 	cursorString := ctx.DefaultQuery("cursor", "0")
 	cursor, err := strconv.Atoi(cursorString)
 	if err != nil || cursor < 0 {
-		logger.Log.Info("cursor invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("cursor invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "cursor invalid"})
 		return
 	}
 	sizeString := ctx.DefaultQuery("size", "16")
 	size, err := strconv.Atoi(sizeString)
 	if err != nil || size <= 0 {
-		logger.Log.Info("size invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("size invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "size invalid"})
 		return
 	}
@@ -252,7 +252,7 @@ func ListNFTOwners(ctx *gin.Context) {
 	// check
 	codeHash, err := hex.DecodeString(codeHashHex)
 	if err != nil {
-		logger.Log.Info("codeHash invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("codeHash invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "codeHash invalid"})
 		return
 	}
@@ -261,14 +261,14 @@ func ListNFTOwners(ctx *gin.Context) {
 	// check
 	genesisId, err := hex.DecodeString(genesisIdHex)
 	if err != nil {
-		logger.Log.Info("genesisId invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("genesisId invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "genesisId invalid"})
 		return
 	}
 
-	result, err := service.GetNFTOwnersByCodeHashGenesis(cursor, size, codeHash, genesisId)
+	result, err := service.GetNFTOwnersByCodeHashGenesis(ctx.Request.Context(), cursor, size, codeHash, genesisId)
 	if err != nil {
-		logger.Log.Info("ListNFTOwners failed", zap.Error(err))
+		logger.Ctx(ctx).Info("ListNFTOwners failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "ListNFTOwners failed"})
 		return
 	}
@@ -292,20 +292,20 @@ func ListNFTOwners(ctx *gin.Context) {
 // @Security BearerAuth
 // @Router /nft/summary/{address} [get]
 func ListAllNFTByOwner(ctx *gin.Context) {
-	logger.Log.Info("ListAllNFTOwners enter")
+	logger.Ctx(ctx).Info("ListAllNFTOwners enter")
 
 	// get cursor/size
 	cursorString := ctx.DefaultQuery("cursor", "0")
 	cursor, err := strconv.Atoi(cursorString)
 	if err != nil || cursor < 0 {
-		logger.Log.Info("cursor invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("cursor invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "cursor invalid"})
 		return
 	}
 	sizeString := ctx.DefaultQuery("size", "16")
 	size, err := strconv.Atoi(sizeString)
 	if err != nil || size <= 0 {
-		logger.Log.Info("size invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("size invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "size invalid"})
 		return
 	}
@@ -314,14 +314,14 @@ func ListAllNFTByOwner(ctx *gin.Context) {
 	// check
 	addressPkh, err := utils.DecodeAddress(address)
 	if err != nil {
-		logger.Log.Info("address invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("address invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "address invalid"})
 		return
 	}
 
-	result, err := service.GetAllNFTBalanceByAddress(cursor, size, addressPkh)
+	result, err := service.GetAllNFTBalanceByAddress(ctx.Request.Context(), cursor, size, addressPkh)
 	if err != nil {
-		logger.Log.Info("ListAllNFTByOwner failed", zap.Error(err))
+		logger.Ctx(ctx).Info("ListAllNFTByOwner failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "ListAllNFTByOwner failed"})
 		return
 	}
@@ -346,13 +346,13 @@ func ListAllNFTByOwner(ctx *gin.Context) {
 // @Security BearerAuth
 // @Router /nft/detail/{codehash}/{genesis}/{address} [get]
 func ListNFTCountByOwner(ctx *gin.Context) {
-	logger.Log.Info("ListNFTCountByOwner enter")
+	logger.Ctx(ctx).Info("ListNFTCountByOwner enter")
 
 	codeHashHex := ctx.Param("codehash")
 	// check
 	codeHash, err := hex.DecodeString(codeHashHex)
 	if err != nil {
-		logger.Log.Info("codeHash invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("codeHash invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "codeHash invalid"})
 		return
 	}
@@ -361,7 +361,7 @@ func ListNFTCountByOwner(ctx *gin.Context) {
 	// check
 	genesisId, err := hex.DecodeString(genesisIdHex)
 	if err != nil {
-		logger.Log.Info("genesisId invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("genesisId invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "genesisId invalid"})
 		return
 	}
@@ -370,14 +370,14 @@ func ListNFTCountByOwner(ctx *gin.Context) {
 	// check
 	addressPkh, err := utils.DecodeAddress(address)
 	if err != nil {
-		logger.Log.Info("address invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("address invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "address invalid"})
 		return
 	}
 
-	result, err := service.GetNFTCountByCodeHashGenesisAddress(codeHash, genesisId, addressPkh)
+	result, err := service.GetNFTCountByCodeHashGenesisAddress(ctx.Request.Context(), codeHash, genesisId, addressPkh)
 	if err != nil {
-		logger.Log.Info("ListNFTCountByOwner failed", zap.Error(err))
+		logger.Ctx(ctx).Info("ListNFTCountByOwner failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "ListNFTCountByOwner failed"})
 		return
 	}
@@ -23,27 +23,27 @@ import (
 // @Security BearerAuth
 // @Router /nft/sell/utxo [get]
 func GetNFTSellUtxo(ctx *gin.Context) {
-	logger.Log.Info("GetNFTSellUtxo enter")
+	logger.Ctx(ctx).Info("GetNFTSellUtxo enter")
 
 	// get cursor/size
 	cursorString := ctx.DefaultQuery("cursor", "0")
 	cursor, err := strconv.Atoi(cursorString)
 	if err != nil || cursor < 0 {
-		logger.Log.Info("cursor invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("cursor invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "cursor invalid"})
 		return
 	}
 	sizeString := ctx.DefaultQuery("size", "16")
 	size, err := strconv.Atoi(sizeString)
 	if err != nil || size <= 0 {
-		logger.Log.Info("size invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("size invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "size invalid"})
 		return
 	}
 
-	result, err := service.GetNFTSellUtxo(cursor, size)
+	result, err := service.GetNFTSellUtxo(ctx.Request.Context(), cursor, size)
 	if err != nil {
-		logger.Log.Info("get block failed", zap.Error(err))
+		logger.Ctx(ctx).Info("get block failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "get txo failed"})
 		return
 	}
@@ -66,20 +66,20 @@ func GetNFTSellUtxo(ctx *gin.Context) {
 // @Security BearerAuth
 // @Router /nft/sell/utxo-by-address/{address} [get]
 func GetNFTSellUtxoByAddress(ctx *gin.Context) {
-	logger.Log.Info("GetNFTSellUtxoByAddress enter")
+	logger.Ctx(ctx).Info("GetNFTSellUtxoByAddress enter")
 
 	// get cursor/size
 	cursorString := ctx.DefaultQuery("cursor", "0")
 	cursor, err := strconv.Atoi(cursorString)
 	if err != nil || cursor < 0 {
-		logger.Log.Info("cursor invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("cursor invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "cursor invalid"})
 		return
 	}
 	sizeString := ctx.DefaultQuery("size", "16")
 	size, err := strconv.Atoi(sizeString)
 	if err != nil || size <= 0 {
-		logger.Log.Info("size invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("size invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "size invalid"})
 		return
 	}
@@ -88,14 +88,14 @@ func GetNFTSellUtxoByAddress(ctx *gin.Context) {
 	// check
 	addressPkh, err := utils.DecodeAddress(address)
 	if err != nil {
-		logger.Log.Info("address invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("address invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "address invalid"})
 		return
 	}
 
-	result, err := service.GetNFTSellUtxoByAddress(cursor, size, addressPkh)
+	result, err := service.GetNFTSellUtxoByAddress(ctx.Request.Context(), cursor, size, addressPkh)
 	if err != nil {
-		logger.Log.Info("get block failed", zap.Error(err))
+		logger.Ctx(ctx).Info("get block failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "get txo failed"})
 		return
 	}
@@ -120,20 +120,20 @@ func GetNFTSellUtxoByAddress(ctx *gin.Context) {
 // @Security BearerAuth
 // @Router /nft/sell/utxo/{codehash}/{genesis} [get]
 func GetNFTSellUtxoByGenesis(ctx *gin.Context) {
-	logger.Log.Info("GetNFTSellUtxoByGenesis enter")
+	logger.Ctx(ctx).Info("GetNFTSellUtxoByGenesis enter")
 
 	// get cursor/size
 	cursorString := ctx.DefaultQuery("cursor", "0")
 	cursor, err := strconv.Atoi(cursorString)
 	if err != nil || cursor < 0 {
-		logger.Log.Info("cursor invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("cursor invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "cursor invalid"})
 		return
 	}
 	sizeString := ctx.DefaultQuery("size", "16")
 	size, err := strconv.Atoi(sizeString)
 	if err != nil || size <= 0 {
-		logger.Log.Info("size invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("size invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "size invalid"})
 		return
 	}
@@ -142,7 +142,7 @@ func GetNFTSellUtxoByGenesis(ctx *gin.Context) {
 	// check
 	codeHash, err := hex.DecodeString(codeHashHex)
 	if err != nil {
-		logger.Log.Info("codeHash invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("codeHash invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "codeHash invalid"})
 		return
 	}
@@ -151,14 +151,14 @@ func GetNFTSellUtxoByGenesis(ctx *gin.Context) {
 	// check
 	genesisId, err := hex.DecodeString(genesisIdHex)
 	if err != nil {
-		logger.Log.Info("genesisId invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("genesisId invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "genesisId invalid"})
 		return
 	}
 
-	result, err := service.GetNFTSellUtxoByGenesis(cursor, size, codeHash, genesisId)
+	result, err := service.GetNFTSellUtxoByGenesis(ctx.Request.Context(), cursor, size, codeHash, genesisId)
 	if err != nil {
-		logger.Log.Info("get block failed", zap.Error(err))
+		logger.Ctx(ctx).Info("get block failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "get txo failed"})
 		return
 	}
@@ -183,13 +183,13 @@ func GetNFTSellUtxoByGenesis(ctx *gin.Context) {
 // @Security BearerAuth
 // @Router /nft/sell/utxo-detail/{codehash}/{genesis}/{token_index} [get]
 func GetNFTSellUtxoDetail(ctx *gin.Context) {
-	logger.Log.Info("GetNFTSellUtxoDetail enter")
+	logger.Ctx(ctx).Info("GetNFTSellUtxoDetail enter")
 
 	codeHashHex := ctx.Param("codehash")
 	// check
 	codeHash, err := hex.DecodeString(codeHashHex)
 	if err != nil {
-		logger.Log.Info("codeHash invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("codeHash invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "codeHash invalid"})
 		return
 	}
@@ -198,7 +198,7 @@ func GetNFTSellUtxoDetail(ctx *gin.Context) {
 	// check
 	genesisId, err := hex.DecodeString(genesisIdHex)
 	if err != nil {
-		logger.Log.Info("genesisId invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("genesisId invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "genesisId invalid"})
 		return
 	}
@@ -206,15 +206,15 @@ func GetNFTSellUtxoDetail(ctx *gin.Context) {
 	tokenIndexString := ctx.Param("token_index")
 	tokenIndex, err := strconv.Atoi(tokenIndexString)
 	if err != nil || tokenIndex < 0 {
-		logger.Log.Info("tokenIndex invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("tokenIndex invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "tokenIndex invalid"})
 		return
 	}
 
 	isReadyOnly := (ctx.DefaultQuery("ready", "true") == "true")
-	result, err := service.GetNFTSellUtxoByTokenIndexMerge(codeHash, genesisId, tokenIndexString, isReadyOnly)
+	result, err := service.GetNFTSellUtxoByTokenIndexMerge(ctx.Request.Context(), codeHash, genesisId, tokenIndexString, isReadyOnly)
 	if err != nil {
-		logger.Log.Info("GetNFTSellUtxoByTokenIndexMerge", zap.Error(err))
+		logger.Ctx(ctx).Info("GetNFTSellUtxoByTokenIndexMerge", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "get txo failed"})
 		return
 	}
@@ -237,13 +237,13 @@ func GetNFTSellUtxoDetail(ctx *gin.Context) {
 // @Security BearerAuth
 // @Router /nft/auction/utxo-detail/{codehash}/{nftid} [get]
 func GetNFTAuctionUtxoDetail(ctx *gin.Context) {
-	logger.Log.Info("GetNFTAuctionUtxoDetail enter")
+	logger.Ctx(ctx).Info("GetNFTAuctionUtxoDetail enter")
 
 	codeHashHex := ctx.Param("codehash")
 	// check
 	codeHash, err := hex.DecodeString(codeHashHex)
 	if err != nil {
-		logger.Log.Info("codeHash invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("codeHash invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "codeHash invalid"})
 		return
 	}
@@ -252,15 +252,15 @@ func GetNFTAuctionUtxoDetail(ctx *gin.Context) {
 	// check
 	nftId, err := hex.DecodeString(nftIdHex)
 	if err != nil {
-		logger.Log.Info("nftId invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("nftId invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "nftId invalid"})
 		return
 	}
 
 	isReadyOnly := (ctx.DefaultQuery("ready", "true") == "true")
-	result, err := service.GetNFTAuctionUtxoByNFTIDMerge(codeHash, nftId, isReadyOnly)
+	result, err := service.GetNFTAuctionUtxoByNFTIDMerge(ctx.Request.Context(), codeHash, nftId, isReadyOnly)
 	if err != nil {
-		logger.Log.Info("GetNFTAuctionUtxoByNFTIDMerge", zap.Error(err))
+		logger.Ctx(ctx).Info("GetNFTAuctionUtxoByNFTIDMerge", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "get txo failed"})
 		return
 	}
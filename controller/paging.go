@@ -0,0 +1,40 @@
+package controller
+
+import (
+	"net/http"
+	"sensiblequery/lib/paging"
+	"sensiblequery/logger"
+	"sensiblequery/model"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// getPageParams 解析cursor/size分页参数。cursor可为旧的数字offset，或上一页返回的next/prev游标。
+// maxLimit限制offset分页时的cursor+size，为0表示仅限制size
+func getPageParams(ctx *gin.Context, maxSize, maxLimit int) (page paging.Page, ok bool) {
+	cursorString := ctx.DefaultQuery("cursor", "0")
+	page, err := paging.Parse(cursorString, 0)
+	if err != nil {
+		logger.Ctx(ctx).Info("cursor invalid", zap.Error(err))
+		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "cursor invalid"})
+		return page, false
+	}
+
+	sizeString := ctx.DefaultQuery("size", "16")
+	size, err := strconv.Atoi(sizeString)
+	if err != nil || size <= 0 || size > maxSize {
+		logger.Ctx(ctx).Info("size invalid", zap.Error(err))
+		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "size invalid"})
+		return page, false
+	}
+	page.Size = size
+
+	if maxLimit > 0 && page.Token == nil && page.Offset+size > maxLimit {
+		logger.Ctx(ctx).Info("size invalid")
+		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "size invalid"})
+		return page, false
+	}
+	return page, true
+}
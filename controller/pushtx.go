@@ -2,23 +2,47 @@ package controller
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/hex"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"sensiblequery/lib/metrics"
+	"sensiblequery/lib/nodepool"
+	"sensiblequery/lib/settings"
+	"sensiblequery/lib/tracing"
 	"sensiblequery/logger"
 	"sensiblequery/model"
+	"sensiblequery/service"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/spf13/viper"
 	"github.com/ybbus/jsonrpc/v2"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
-var rpcClient jsonrpc.RPCClient
-var wocKey string
+// 广播目标，配置重新加载时整体替换
+type broadcastTarget struct {
+	nodes  *nodepool.Pool
+	wocKey string
+
+	probeInterval time.Duration
+	probeTimeout  time.Duration
+	maxLagBlocks  int
+}
+
+var target atomic.Value // *broadcastTarget
+
+var indexLagConf = &service.IndexLagConf{}
+var indexLagRejectPush bool
 
 func init() {
 	viper.SetConfigFile("conf/chain.yaml")
@@ -30,15 +54,161 @@ func init() {
 		}
 	}
 
-	wocKey = viper.GetString("woc_key")
-	rpcAddress := viper.GetString("rpc")
-	rpcAuth := viper.GetString("rpc_auth")
-	rpcClient = jsonrpc.NewClientWithOpts(rpcAddress, &jsonrpc.RPCClientOpts{
-		CustomHeaders: map[string]string{
-			"Authorization": "Basic " + base64.StdEncoding.EncodeToString([]byte(rpcAuth)),
-		},
+	viper.SetDefault("index_check_interval", 10*time.Second)
+	viper.SetDefault("index_max_lag_blocks", 3)
+	indexLagConf.Interval = viper.GetDuration("index_check_interval")
+	indexLagConf.MaxLagBlocks = viper.GetInt("index_max_lag_blocks")
+	indexLagConf.MaxTipAge = viper.GetDuration("index_max_tip_age")
+	indexLagRejectPush = viper.GetBool("index_lag_reject_push")
+
+	// woc_key/rpc*可重新加载，节点在下次探测前视为健康
+	settings.OnChange(func(s *settings.Settings) {
+		b := s.Broadcast
+		var nodes []*nodepool.Node
+		for _, node := range b.Nodes {
+			client := jsonrpc.NewClientWithOpts(node.Url, &jsonrpc.RPCClientOpts{
+				HTTPClient: &http.Client{Timeout: b.RpcTimeout},
+				CustomHeaders: map[string]string{
+					"Authorization": "Basic " + base64.StdEncoding.EncodeToString([]byte(node.Auth)),
+				},
+			})
+			nodes = append(nodes, nodepool.NewNode(redactUrl(node.Url), client))
+		}
+		probeTimeout := b.RpcProbeInterval
+		if probeTimeout > b.RpcTimeout {
+			probeTimeout = b.RpcTimeout
+		}
+		target.Store(&broadcastTarget{
+			nodes:         nodepool.New(nodes...),
+			wocKey:        b.WocKey,
+			probeInterval: b.RpcProbeInterval,
+			probeTimeout:  probeTimeout,
+			maxLagBlocks:  b.RpcMaxLagBlocks,
+		})
 	})
+}
 
+// redactUrl 隐藏url中的密码，用于日志、指标和状态
+func redactUrl(rawUrl string) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return rawUrl
+	}
+	return u.Redacted()
+}
+
+// StartNodeProbe 后台定期以getblockcount探测各rpc节点，直到ctx结束
+func StartNodeProbe(ctx context.Context) {
+	go func() {
+		healthy := map[string]bool{}
+		for {
+			t := getBroadcastTarget()
+			t.nodes.Probe(t.probeTimeout, t.maxLagBlocks)
+			metrics.BitcoindNodeUp.Reset()
+			metrics.BitcoindNodeHeight.Reset()
+			for _, st := range t.nodes.Status() {
+				// 只在状态变化时记录
+				if last, ok := healthy[st.Url]; (ok && last != st.Healthy) || (!ok && !st.Healthy) {
+					logger.Log.Warn("rpc node health changed",
+						zap.String("node", st.Url),
+						zap.Bool("healthy", st.Healthy),
+						zap.Int("height", st.Height),
+						zap.String("error", st.Error),
+					)
+				}
+				healthy[st.Url] = st.Healthy
+				up := 0.0
+				if st.Healthy {
+					up = 1
+				}
+				metrics.BitcoindNodeUp.WithLabelValues(st.Url).Set(up)
+				metrics.BitcoindNodeHeight.WithLabelValues(st.Url).Set(float64(st.Height))
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(t.probeInterval):
+			}
+		}
+	}()
+}
+
+// rpcNodeStatus 各rpc节点最近一次探测或调用的结果
+func rpcNodeStatus() []nodepool.NodeStatus {
+	return getBroadcastTarget().nodes.Status()
+}
+
+func getBroadcastTarget() *broadcastTarget {
+	return target.Load().(*broadcastTarget)
+}
+
+// rpcCall 调用bitcoind rpc并记录span，在健康节点间轮询，连接失败时换下一个节点
+func rpcCall(c context.Context, method string, params ...interface{}) (*jsonrpc.RPCResponse, error) {
+	_, span := tracing.Start(c, "rpc "+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("rpc.system", "jsonrpc"),
+			attribute.String("rpc.method", method),
+		))
+	response, err := getBroadcastTarget().nodes.Call(method, params...)
+	if err == nil && response.Error != nil {
+		span.SetAttributes(attribute.Int("rpc.jsonrpc.error_code", response.Error.Code))
+		span.SetStatus(codes.Error, response.Error.Message)
+	}
+	tracing.End(span, err)
+	return response, err
+}
+
+// rpcBroadcast 同时发往所有rpc节点，用于sendrawtransaction，任一节点接受即成功
+func rpcBroadcast(c context.Context, method string, params ...interface{}) (*jsonrpc.RPCResponse, error) {
+	_, span := tracing.Start(c, "rpc "+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("rpc.system", "jsonrpc"),
+			attribute.String("rpc.method", method),
+			attribute.Bool("rpc.broadcast", true),
+		))
+	response, err := getBroadcastTarget().nodes.Broadcast(method, params...)
+	if err == nil && response.Error != nil {
+		span.SetAttributes(attribute.Int("rpc.jsonrpc.error_code", response.Error.Code))
+		span.SetStatus(codes.Error, response.Error.Message)
+	}
+	tracing.End(span, err)
+	return response, err
+}
+
+// rpcCallBatch 批量调用bitcoind rpc，响应按请求序号取GetByID
+func rpcCallBatch(c context.Context, method string, requests jsonrpc.RPCRequests) (jsonrpc.RPCResponses, error) {
+	_, span := tracing.Start(c, "rpc "+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("rpc.system", "jsonrpc"),
+			attribute.String("rpc.method", method),
+			attribute.Int("rpc.batch_size", len(requests)),
+		))
+	responses, err := getBroadcastTarget().nodes.CallBatch(requests)
+	tracing.End(span, err)
+	return responses, err
+}
+
+// wocDo 请求WhatsOnChain并记录span
+func wocDo(c context.Context, req *http.Request) (*http.Response, error) {
+	_, span := tracing.Start(c, "woc "+req.Method+" "+req.URL.Path,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.method", req.Method),
+			attribute.String("http.url", req.URL.String()),
+		))
+	resp, err := http.DefaultClient.Do(req)
+	if err == nil {
+		span.SetAttributes(attribute.Int("http.status_code", resp.StatusCode))
+		if resp.StatusCode >= http.StatusBadRequest {
+			span.SetStatus(codes.Error, resp.Status)
+		}
+	}
+	tracing.End(span, err)
+	return resp, err
 }
 
 type TxRequest struct {
@@ -53,31 +223,35 @@ type TxRequest struct {
 // @Security BearerAuth
 // @Router /local_pushtx [post]
 func LocalPushTx(ctx *gin.Context) {
-	logger.Log.Info("LocalPushTx enter")
+	logger.Ctx(ctx).Info("LocalPushTx enter")
+
+	if !checkIndexForPush(ctx) {
+		return
+	}
 
 	// check body
 	req := TxRequest{}
 	if err := ctx.BindJSON(&req); err != nil {
-		logger.Log.Info("Bind json failed", zap.Error(err))
+		logger.Ctx(ctx).Info("Bind json failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "json error"})
 		return
 	}
 
 	_, err := hex.DecodeString(req.TxHex)
 	if err != nil {
-		logger.Log.Info("txRaw invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("txRaw invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "tx invalid"})
 		return
 	}
 
-	logger.Log.Info("send", zap.String("rawtx", req.TxHex))
-	response, err := rpcClient.Call("sendrawtransaction", []string{req.TxHex})
+	logger.Ctx(ctx).Info("send", zap.String("rawtx", req.TxHex))
+	response, err := rpcBroadcast(ctx.Request.Context(), "sendrawtransaction", []string{req.TxHex})
 	if err != nil {
-		logger.Log.Info("call failed", zap.Error(err))
+		logger.Ctx(ctx).Info("call failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "rpc failed"})
 		return
 	}
-	logger.Log.Info("Receive remote return", zap.Any("response", response))
+	logger.Ctx(ctx).Info("Receive remote return", zap.Any("response", response))
 
 	if response.Error != nil {
 		ctx.JSON(http.StatusOK, model.Response{
@@ -103,24 +277,28 @@ func LocalPushTx(ctx *gin.Context) {
 // @Security BearerAuth
 // @Router /pushtx [post]
 func WocPushTx(ctx *gin.Context) {
-	logger.Log.Info("WocPushTx enter")
+	logger.Ctx(ctx).Info("WocPushTx enter")
+
+	if !checkIndexForPush(ctx) {
+		return
+	}
 
 	// check body
 	req := TxRequest{}
 	if err := ctx.BindJSON(&req); err != nil {
-		logger.Log.Info("Bind json failed", zap.Error(err))
+		logger.Ctx(ctx).Info("Bind json failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "json error"})
 		return
 	}
 
 	_, err := hex.DecodeString(req.TxHex)
 	if err != nil {
-		logger.Log.Info("txRaw invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("txRaw invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "tx invalid"})
 		return
 	}
 
-	logger.Log.Info("send", zap.String("rawtx", req.TxHex))
+	logger.Ctx(ctx).Info("send", zap.String("rawtx", req.TxHex))
 
 	wocUrl := "https://api.whatsonchain.com/v1/bsv/main/tx/raw"
 	if is_testnet != "" {
@@ -130,15 +308,15 @@ func WocPushTx(ctx *gin.Context) {
 
 	wocReq, err := http.NewRequest("POST", wocUrl, bytes.NewBufferString(jsonData))
 	if err != nil {
-		logger.Log.Info("push tx failed", zap.Error(err))
+		logger.Ctx(ctx).Info("push tx failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "push tx failed"})
 		return
 	}
 	wocReq.Header.Set("Content-Type", "application/json")
-	wocReq.Header.Set("woc-api-key", wocKey)
-	resp, err := http.DefaultClient.Do(wocReq)
+	wocReq.Header.Set("woc-api-key", getBroadcastTarget().wocKey)
+	resp, err := wocDo(ctx.Request.Context(), wocReq)
 	if err != nil {
-		logger.Log.Info("push tx failed", zap.Error(err))
+		logger.Ctx(ctx).Info("push tx failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "push tx failed"})
 		return
 	}
@@ -146,7 +324,7 @@ func WocPushTx(ctx *gin.Context) {
 
 	body, _ := ioutil.ReadAll(resp.Body)
 	result := strings.Trim(string(body), "\"\n")
-	logger.Log.Info("Receive remote return", zap.String("response", result))
+	logger.Ctx(ctx).Info("Receive remote return", zap.String("response", result))
 
 	if _, err := hex.DecodeString(result); err != nil {
 		ctx.JSON(http.StatusOK, model.Response{
@@ -162,15 +340,8 @@ func WocPushTx(ctx *gin.Context) {
 		Data: result,
 	})
 
-	go func() {
-		// then call LocalPushTx
-		response, err := rpcClient.Call("sendrawtransaction", []string{req.TxHex})
-		if err != nil {
-			logger.Log.Info("woc ok, but local call failed", zap.String("txid", result), zap.Error(err))
-			return
-		}
-		logger.Log.Info("Receive local rpc return", zap.String("txid", result), zap.Any("response", response))
-	}()
+	// then call LocalPushTx
+	startLocalBroadcast(tracing.Detach(ctx.Request.Context()), &service.BroadcastJob{TxId: result, TxHex: req.TxHex})
 }
 
 type TxsRequest struct {
@@ -185,12 +356,16 @@ type TxsRequest struct {
 // @Security BearerAuth
 // @Router /local_pushtxs [post]
 func LocalPushTxs(ctx *gin.Context) {
-	logger.Log.Info("LocalPushTxs enter")
+	logger.Ctx(ctx).Info("LocalPushTxs enter")
+
+	if !checkIndexForPush(ctx) {
+		return
+	}
 
 	// check body
 	req := TxsRequest{}
 	if err := ctx.BindJSON(&req); err != nil {
-		logger.Log.Info("Bind json failed", zap.Error(err))
+		logger.Ctx(ctx).Info("Bind json failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "json error"})
 		return
 	}
@@ -201,7 +376,7 @@ func LocalPushTxs(ctx *gin.Context) {
 		}
 		_, err := hex.DecodeString(txHex)
 		if err != nil {
-			logger.Log.Info("txRaw invalid", zap.Error(err))
+			logger.Ctx(ctx).Info("txRaw invalid", zap.Error(err))
 			ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: fmt.Sprintf("tx[%d] invalid", idx)})
 			return
 		}
@@ -213,14 +388,14 @@ func LocalPushTxs(ctx *gin.Context) {
 			continue
 		}
 
-		logger.Log.Info("send", zap.String("rawtx", txHex))
-		response, err := rpcClient.Call("sendrawtransaction", []string{txHex})
+		logger.Ctx(ctx).Info("send", zap.String("rawtx", txHex))
+		response, err := rpcBroadcast(ctx.Request.Context(), "sendrawtransaction", []string{txHex})
 		if err != nil {
-			logger.Log.Info("call failed", zap.Error(err))
+			logger.Ctx(ctx).Info("call failed", zap.Error(err))
 			ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "rpc failed", Data: txIdResponse})
 			return
 		}
-		logger.Log.Info("Receive remote return", zap.Any("response", response))
+		logger.Ctx(ctx).Info("Receive remote return", zap.Any("response", response))
 
 		if response.Error != nil {
 			ctx.JSON(http.StatusOK, model.Response{
@@ -250,12 +425,16 @@ func LocalPushTxs(ctx *gin.Context) {
 // @Security BearerAuth
 // @Router /pushtxs [post]
 func WocPushTxs(ctx *gin.Context) {
-	logger.Log.Info("WocPushTxs enter")
+	logger.Ctx(ctx).Info("WocPushTxs enter")
+
+	if !checkIndexForPush(ctx) {
+		return
+	}
 
 	// check body
 	req := TxsRequest{}
 	if err := ctx.BindJSON(&req); err != nil {
-		logger.Log.Info("Bind json failed", zap.Error(err))
+		logger.Ctx(ctx).Info("Bind json failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "json error"})
 		return
 	}
@@ -266,7 +445,7 @@ func WocPushTxs(ctx *gin.Context) {
 		}
 		_, err := hex.DecodeString(txHex)
 		if err != nil {
-			logger.Log.Info("txRaw invalid", zap.Error(err))
+			logger.Ctx(ctx).Info("txRaw invalid", zap.Error(err))
 			ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: fmt.Sprintf("tx[%d] invalid", idx)})
 			return
 		}
@@ -278,7 +457,7 @@ func WocPushTxs(ctx *gin.Context) {
 			continue
 		}
 
-		logger.Log.Info("send", zap.String("rawtx", txHex))
+		logger.Ctx(ctx).Info("send", zap.String("rawtx", txHex))
 
 		wocUrl := "https://api.whatsonchain.com/v1/bsv/main/tx/raw"
 		if is_testnet != "" {
@@ -287,15 +466,15 @@ func WocPushTxs(ctx *gin.Context) {
 		jsonData := fmt.Sprintf(`{"txhex": "%s"}`, txHex)
 		req, err := http.NewRequest("POST", wocUrl, bytes.NewBufferString(jsonData))
 		if err != nil {
-			logger.Log.Info("push tx failed", zap.Error(err))
+			logger.Ctx(ctx).Info("push tx failed", zap.Error(err))
 			ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "push tx failed"})
 			return
 		}
 		req.Header.Set("Content-Type", "application/json")
-		req.Header.Set("woc-api-key", wocKey)
-		resp, err := http.DefaultClient.Do(req)
+		req.Header.Set("woc-api-key", getBroadcastTarget().wocKey)
+		resp, err := wocDo(ctx.Request.Context(), req)
 		if err != nil {
-			logger.Log.Info("push tx failed", zap.Error(err))
+			logger.Ctx(ctx).Info("push tx failed", zap.Error(err))
 			ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "push tx failed"})
 			return
 		}
@@ -303,7 +482,7 @@ func WocPushTxs(ctx *gin.Context) {
 
 		body, _ := ioutil.ReadAll(resp.Body)
 		result := strings.Trim(string(body), "\"\n")
-		logger.Log.Info("Receive remote return", zap.String("response", result))
+		logger.Ctx(ctx).Info("Receive remote return", zap.String("response", result))
 
 		if _, err := hex.DecodeString(result); err != nil {
 			ctx.JSON(http.StatusOK, model.Response{
@@ -315,14 +494,8 @@ func WocPushTxs(ctx *gin.Context) {
 		}
 		txIdResponse = append(txIdResponse, result)
 
-		go func(txid, txHex string) {
-			// then call localpush
-			response, err := rpcClient.Call("sendrawtransaction", []string{txHex})
-			if err != nil {
-				logger.Log.Info("call failed", zap.String("txid", txid), zap.Error(err))
-			}
-			logger.Log.Info("Receive local rpc return", zap.String("txid", txid), zap.Any("response", response))
-		}(result, txHex)
+		// then call localpush
+		startLocalBroadcast(tracing.Detach(ctx.Request.Context()), &service.BroadcastJob{TxId: result, TxHex: txHex})
 	}
 	ctx.JSON(http.StatusOK, model.Response{
 		Code: 0,
@@ -338,15 +511,15 @@ func WocPushTxs(ctx *gin.Context) {
 // @Security BearerAuth
 // @Router /getrawmempool [get]
 func GetRawMempool(ctx *gin.Context) {
-	logger.Log.Info("GetRawMempool enter")
+	logger.Ctx(ctx).Info("GetRawMempool enter")
 
-	response, err := rpcClient.Call("getrawmempool", []string{})
+	response, err := rpcCall(ctx.Request.Context(), "getrawmempool", []string{})
 	if err != nil {
-		logger.Log.Info("call failed", zap.Error(err))
+		logger.Ctx(ctx).Info("call failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "rpc failed"})
 		return
 	}
-	logger.Log.Info("Receive remote return", zap.Any("response", response))
+	logger.Ctx(ctx).Info("Receive remote return", zap.Any("response", response))
 
 	if response.Error != nil {
 		ctx.JSON(http.StatusOK, model.Response{
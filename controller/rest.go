@@ -0,0 +1,411 @@
+package controller
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sensiblequery/lib/blkparser"
+	"sensiblequery/lib/rest"
+	"sensiblequery/logger"
+	"sensiblequery/model"
+	"sensiblequery/service"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ybbus/jsonrpc/v2"
+	"go.uber.org/zap"
+)
+
+const restBlockBatch = 500 // 输出区块时每批读取的交易数
+
+var restContentTypes = map[string]string{
+	rest.FormatBin:  "application/octet-stream",
+	rest.FormatHex:  "text/plain",
+	rest.FormatJson: "application/json",
+}
+
+// restError 与bitcoind一致，错误时返回HTTP状态码和纯文本
+func restError(ctx *gin.Context, status int, msg string) {
+	ctx.Data(status, "text/plain", []byte(msg+"\r\n"))
+	ctx.Abort()
+}
+
+// restData bin直接输出字节，hex输出十六进制并换行
+func restData(ctx *gin.Context, format string, data []byte) {
+	if format == rest.FormatHex {
+		ctx.Data(http.StatusOK, restContentTypes[format], []byte(hex.EncodeToString(data)+"\n"))
+		return
+	}
+	ctx.Data(http.StatusOK, restContentTypes[format], data)
+}
+
+// restParseHash 解析<hash>.<format>，hash返回内部字节序
+func restParseHash(ctx *gin.Context, param string, formats ...string) (hash []byte, hashHex, format string, ok bool) {
+	hashHex, format, err := rest.ParseFormat(param, formats...)
+	if err != nil {
+		restError(ctx, http.StatusNotFound, err.Error())
+		return nil, "", "", false
+	}
+	hash, ok = rest.ParseHash(hashHex)
+	if !ok {
+		restError(ctx, http.StatusBadRequest, "Invalid hash: "+hashHex)
+		return nil, "", "", false
+	}
+	return hash, hashHex, format, true
+}
+
+// RestGetTx GET /rest/tx/<txid>.<bin|hex|json>
+func RestGetTx(ctx *gin.Context) {
+	logger.Ctx(ctx).Info("RestGetTx enter")
+
+	txId, txIdHex, format, ok := restParseHash(ctx, ctx.Param("txid"), rest.FormatBin, rest.FormatHex, rest.FormatJson)
+	if !ok {
+		return
+	}
+	if format == rest.FormatJson {
+		txRsp, err := getVerboseTx(ctx.Request.Context(), txId)
+		if err != nil {
+			logger.Ctx(ctx).Info("get tx failed", zap.Error(err))
+			restError(ctx, http.StatusNotFound, txIdHex+" not found")
+			return
+		}
+		ctx.JSON(http.StatusOK, txRsp)
+		return
+	}
+
+	rawtx, err := service.GetRawTxById(ctx.Request.Context(), hex.EncodeToString(txId))
+	if err != nil {
+		logger.Ctx(ctx).Info("get rawtx failed", zap.Error(err))
+		restError(ctx, http.StatusNotFound, txIdHex+" not found")
+		return
+	}
+	restData(ctx, format, rawtx)
+}
+
+// RestGetBlock GET /rest/block/<hash>.<bin|hex|json>
+func RestGetBlock(ctx *gin.Context) {
+	logger.Ctx(ctx).Info("RestGetBlock enter")
+	restBlock(ctx, true)
+}
+
+// RestGetBlockNoTxDetails GET /rest/block/notxdetails/<hash>.<bin|hex|json>，json中tx只有txid
+func RestGetBlockNoTxDetails(ctx *gin.Context) {
+	logger.Ctx(ctx).Info("RestGetBlockNoTxDetails enter")
+	restBlock(ctx, false)
+}
+
+// restBlock 区块头来自节点，交易按批从索引读取并流式输出，不在内存中拼接整个区块
+func restBlock(ctx *gin.Context, txDetails bool) {
+	blkId, blkIdHex, format, ok := restParseHash(ctx, ctx.Param("hash"), rest.FormatBin, rest.FormatHex, rest.FormatJson)
+	if !ok {
+		return
+	}
+	blk, err := service.GetBlockById(ctx.Request.Context(), hex.EncodeToString(blkId))
+	if err != nil {
+		logger.Ctx(ctx).Info("get block failed", zap.Error(err))
+		restError(ctx, http.StatusNotFound, blkIdHex+" not found")
+		return
+	}
+
+	if format == rest.FormatJson {
+		restBlockJson(ctx, blk, txDetails)
+		return
+	}
+
+	response, err := rpcCall(ctx.Request.Context(), "getblockheader", blk.BlockIdHex, false)
+	if err == nil && response.Error != nil {
+		err = response.Error
+	}
+	var header []byte
+	if err == nil {
+		var headerHex string
+		if headerHex, err = response.GetString(); err == nil {
+			header, err = hex.DecodeString(headerHex)
+		}
+	}
+	if err != nil {
+		logger.Ctx(ctx).Info("get block header failed", zap.Error(err))
+		restError(ctx, http.StatusInternalServerError, "rpc failed")
+		return
+	}
+
+	write := func(data []byte) {
+		if format == rest.FormatHex {
+			ctx.Writer.WriteString(hex.EncodeToString(data))
+			return
+		}
+		ctx.Writer.Write(data)
+	}
+	ctx.Header("Content-Type", restContentTypes[format])
+	ctx.Status(http.StatusOK)
+	write(header)
+	write(blkparser.EncodeVarInt(uint64(blk.TxCount)))
+	for start := 0; start < blk.TxCount; start += restBlockBatch {
+		rawtxs, err := service.GetBlockRawTxsRange(ctx.Request.Context(), blk.Height, start, restBlockBatch)
+		if err != nil {
+			logger.Ctx(ctx).Info("get block rawtxs failed", zap.Error(err))
+			return
+		}
+		for _, rawtx := range rawtxs {
+			write(rawtx)
+		}
+		ctx.Writer.Flush()
+	}
+	if format == rest.FormatHex {
+		ctx.Writer.WriteString("\n")
+	}
+}
+
+// restBlockJson 与getblock格式一致，txDetails时tx为decoderawtransaction的结果，否则为txid
+func restBlockJson(ctx *gin.Context, blk *model.BlockInfoResp, txDetails bool) {
+	response, err := rpcCall(ctx.Request.Context(), "getblockheader", blk.BlockIdHex, true)
+	if err == nil && response.Error != nil {
+		err = response.Error
+	}
+	header := map[string]interface{}{}
+	if err == nil {
+		err = response.GetObject(&header)
+	}
+	if err != nil {
+		logger.Ctx(ctx).Info("get block header failed", zap.Error(err))
+		restError(ctx, http.StatusInternalServerError, "rpc failed")
+		return
+	}
+	header["size"] = blk.BlockSize
+	header["num_tx"] = blk.TxCount
+	prefix, _ := json.Marshal(header)
+
+	ctx.Header("Content-Type", restContentTypes[rest.FormatJson])
+	ctx.Status(http.StatusOK)
+	ctx.Writer.Write(prefix[:len(prefix)-1])
+	ctx.Writer.WriteString(`,"tx":[`)
+	for start := 0; start < blk.TxCount; start += restBlockBatch {
+		txs, err := restBlockTxsJson(ctx.Request.Context(), blk.Height, start, txDetails)
+		if err != nil {
+			logger.Ctx(ctx).Info("get block txs failed", zap.Error(err))
+			return
+		}
+		for i, tx := range txs {
+			if start > 0 || i > 0 {
+				ctx.Writer.WriteString(",")
+			}
+			ctx.Writer.Write(tx)
+		}
+		ctx.Writer.Flush()
+	}
+	ctx.Writer.WriteString("]}")
+}
+
+func restBlockTxsJson(ctx context.Context, blkHeight, start int, txDetails bool) (txs [][]byte, err error) {
+	if !txDetails {
+		txids, err := service.GetBlockTxIdsRange(ctx, blkHeight, start, restBlockBatch)
+		if err != nil {
+			return nil, err
+		}
+		for _, txid := range txids {
+			txs = append(txs, []byte(`"`+blkparser.HashString(txid)+`"`))
+		}
+		return txs, nil
+	}
+
+	rawtxs, err := service.GetBlockRawTxsRange(ctx, blkHeight, start, restBlockBatch)
+	if err != nil || len(rawtxs) == 0 {
+		return nil, err
+	}
+	requests := make(jsonrpc.RPCRequests, 0, len(rawtxs))
+	for _, rawtx := range rawtxs {
+		requests = append(requests, jsonrpc.NewRequest("decoderawtransaction", hex.EncodeToString(rawtx)))
+	}
+	responses, err := rpcCallBatch(ctx, "decoderawtransaction", requests)
+	if err != nil {
+		return nil, err
+	}
+	for i := range rawtxs {
+		response := responses.GetByID(i)
+		if response == nil {
+			return nil, errors.New("decoderawtransaction response missing")
+		}
+		if response.Error != nil {
+			return nil, response.Error
+		}
+		tx, err := json.Marshal(response.Result)
+		if err != nil {
+			return nil, err
+		}
+		txs = append(txs, tx)
+	}
+	return txs, nil
+}
+
+// RestGetHeaders GET /rest/headers/<count>/<hash>.<bin|hex|json>，从hash开始向后最多count个区块头
+func RestGetHeaders(ctx *gin.Context) {
+	logger.Ctx(ctx).Info("RestGetHeaders enter")
+
+	count, err := strconv.Atoi(ctx.Param("count"))
+	if err != nil || count < 1 || count > rest.MaxHeaders {
+		restError(ctx, http.StatusBadRequest, "Header count out of range: "+ctx.Param("count"))
+		return
+	}
+	blkId, _, format, ok := restParseHash(ctx, ctx.Param("hash"), rest.FormatBin, rest.FormatHex, rest.FormatJson)
+	if !ok {
+		return
+	}
+
+	// 与bitcoind一致，hash不存在时返回空
+	var blocks []*model.BlockBriefResp
+	if blk, err := service.GetBlockById(ctx.Request.Context(), hex.EncodeToString(blkId)); err == nil {
+		blocks, err = service.GetBlockBriefs(ctx.Request.Context(), blk.Height, blk.Height+count-1)
+		if err != nil {
+			logger.Ctx(ctx).Info("get blocks failed", zap.Error(err))
+			restError(ctx, http.StatusInternalServerError, "query failed")
+			return
+		}
+	}
+
+	verbose := format == rest.FormatJson
+	headers := make([]interface{}, 0, len(blocks))
+	if len(blocks) > 0 {
+		requests := make(jsonrpc.RPCRequests, 0, len(blocks))
+		for _, blk := range blocks {
+			requests = append(requests, jsonrpc.NewRequest("getblockheader", blk.BlockIdHex, verbose))
+		}
+		responses, err := rpcCallBatch(ctx.Request.Context(), "getblockheader", requests)
+		if err != nil {
+			logger.Ctx(ctx).Info("get block headers failed", zap.Error(err))
+			restError(ctx, http.StatusInternalServerError, "rpc failed")
+			return
+		}
+		for i := range blocks {
+			response := responses.GetByID(i)
+			if response == nil || response.Error != nil {
+				logger.Ctx(ctx).Info("get block header failed", zap.Int("height", blocks[i].Height))
+				restError(ctx, http.StatusInternalServerError, "rpc failed")
+				return
+			}
+			headers = append(headers, response.Result)
+		}
+	}
+
+	if verbose {
+		ctx.JSON(http.StatusOK, headers)
+		return
+	}
+	var data []byte
+	for _, header := range headers {
+		headerHex, _ := header.(string)
+		headerBytes, err := hex.DecodeString(headerHex)
+		if err != nil {
+			restError(ctx, http.StatusInternalServerError, "rpc failed")
+			return
+		}
+		data = append(data, headerBytes...)
+	}
+	restData(ctx, format, data)
+}
+
+// RestGetUtxos GET /rest/getutxos[/checkmempool]/<txid>-<n>/...<bin|hex|json>
+func RestGetUtxos(ctx *gin.Context) {
+	logger.Ctx(ctx).Info("RestGetUtxos enter")
+
+	checkMempool, outpoints, format, err := rest.ParseGetUtxos(ctx.Param("outpoints"))
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, rest.ErrFormat) {
+			status = http.StatusNotFound
+		}
+		restError(ctx, status, err.Error())
+		return
+	}
+
+	bestHeight, err := service.GetBestBlockHeight(ctx.Request.Context())
+	if err != nil {
+		logger.Ctx(ctx).Info("best block failed", zap.Error(err))
+		restError(ctx, http.StatusInternalServerError, "get best block failed")
+		return
+	}
+	blk, err := service.GetBestBlockByHeight(ctx.Request.Context(), bestHeight)
+	if err != nil {
+		logger.Ctx(ctx).Info("best block failed", zap.Error(err))
+		restError(ctx, http.StatusInternalServerError, "get best block failed")
+		return
+	}
+	coins, err := service.GetUnspentCoins(ctx.Request.Context(), outpoints, checkMempool)
+	if err != nil {
+		logger.Ctx(ctx).Info("get utxos failed", zap.Error(err))
+		restError(ctx, http.StatusInternalServerError, "query failed")
+		return
+	}
+
+	if format != rest.FormatJson {
+		tip, _ := rest.ParseHash(blk.BlockIdHex)
+		restData(ctx, format, rest.EncodeUtxos(bestHeight, tip, coins))
+		return
+	}
+
+	_, bitmap := rest.Bitmap(coins)
+	utxosRsp := &model.RestUtxosResp{
+		ChainHeight:  bestHeight,
+		ChaintipHash: blk.BlockIdHex,
+		Bitmap:       bitmap,
+		Utxos:        []*model.RestUtxoResp{},
+	}
+	var requests jsonrpc.RPCRequests
+	for _, coin := range coins {
+		if coin == nil {
+			continue
+		}
+		utxosRsp.Utxos = append(utxosRsp.Utxos, &model.RestUtxoResp{
+			Height:       int(coin.Height),
+			Value:        float64(coin.Value) / 1e8,
+			ScriptPubKey: &model.RestScriptPubKeyResp{Hex: hex.EncodeToString(coin.Script)},
+		})
+		requests = append(requests, jsonrpc.NewRequest("decodescript", hex.EncodeToString(coin.Script)))
+	}
+	if len(requests) > 0 {
+		if err := restDecodeScripts(ctx.Request.Context(), requests, utxosRsp.Utxos); err != nil {
+			logger.Ctx(ctx).Info("decode scripts failed", zap.Error(err))
+			restError(ctx, http.StatusInternalServerError, "rpc failed")
+			return
+		}
+	}
+	ctx.JSON(http.StatusOK, utxosRsp)
+}
+
+// restDecodeScripts 节点decodescript补充scriptPubKey的asm、type和addresses
+func restDecodeScripts(ctx context.Context, requests jsonrpc.RPCRequests, utxos []*model.RestUtxoResp) error {
+	responses, err := rpcCallBatch(ctx, "decodescript", requests)
+	if err != nil {
+		return err
+	}
+	for i, utxo := range utxos {
+		response := responses.GetByID(i)
+		if response == nil {
+			return fmt.Errorf("decodescript response %d missing", i)
+		}
+		if response.Error != nil {
+			return response.Error
+		}
+		scriptHex := utxo.ScriptPubKey.Hex
+		if err := response.GetObject(utxo.ScriptPubKey); err != nil {
+			return err
+		}
+		utxo.ScriptPubKey.Hex = scriptHex
+	}
+	return nil
+}
+
+// RestGetChainInfo GET /rest/chaininfo.json
+func RestGetChainInfo(ctx *gin.Context) {
+	logger.Ctx(ctx).Info("RestGetChainInfo enter")
+
+	info, err := getChainInfo(ctx.Request.Context())
+	if err != nil {
+		logger.Ctx(ctx).Info("get chain info failed", zap.Error(err))
+		restError(ctx, http.StatusInternalServerError, "get chain info failed")
+		return
+	}
+	ctx.JSON(http.StatusOK, info)
+}
@@ -0,0 +1,207 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sensiblequery/lib/metrics"
+	"sensiblequery/lib/midware"
+	"sensiblequery/lib/rpcproxy"
+	"sensiblequery/logger"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"github.com/ybbus/jsonrpc/v2"
+	"go.uber.org/zap"
+)
+
+// RpcProxyConf /rpc转发配置，见conf/rpc.yaml
+var RpcProxyConf = struct {
+	Enabled  bool
+	MaxBatch int              // 批量请求最多包含的调用数
+	MaxBody  int64            // 请求体最大字节数
+	Methods  map[string]int64 // 开放的方法及每个token每分钟的调用上限，0为不限制
+}{
+	MaxBatch: 20,
+	MaxBody:  10 * 1024 * 1024,
+	Methods:  map[string]int64{},
+}
+
+func init() {
+	initRpcProxy("conf/rpc.yaml")
+}
+
+// initRpcProxy 读取可选的rpc转发配置，不在内置只读方法中的方法视为配置错误
+func initRpcProxy(filename string) {
+	if _, err := os.Stat(filename); err != nil {
+		return
+	}
+	v := viper.New()
+	v.SetConfigFile(filename)
+	if err := v.ReadInConfig(); err != nil {
+		panic(fmt.Errorf("Fatal error config file: %s \n", err))
+	}
+	v.SetDefault("max_batch", RpcProxyConf.MaxBatch)
+	v.SetDefault("max_body", RpcProxyConf.MaxBody)
+	RpcProxyConf.Enabled = v.GetBool("enabled")
+	RpcProxyConf.MaxBatch = v.GetInt("max_batch")
+	RpcProxyConf.MaxBody = v.GetInt64("max_body")
+	if RpcProxyConf.MaxBatch < 1 || RpcProxyConf.MaxBody < 1 {
+		panic(fmt.Errorf("Fatal error config file: %s: values must be positive \n", filename))
+	}
+	for method, limit := range v.GetStringMap("methods") {
+		if !rpcproxy.Supported(method) {
+			panic(fmt.Errorf("Fatal error config file: %s: method %s not supported \n", filename, method))
+		}
+		n, err := strconv.ParseInt(fmt.Sprint(limit), 10, 64)
+		if err != nil || n < 0 {
+			panic(fmt.Errorf("Fatal error config file: %s: invalid limit for %s \n", filename, method))
+		}
+		RpcProxyConf.Methods[method] = n
+	}
+}
+
+// checkRpcProxyCall 白名单、参数、scope及按方法限流检查，通过时返回nil
+func checkRpcProxyCall(ctx *gin.Context, req *rpcproxy.Request) *rpcproxy.Error {
+	limit, ok := RpcProxyConf.Methods[req.Method]
+	if !ok {
+		metrics.RpcProxyRequests.WithLabelValues("other", "denied").Inc()
+		return rpcproxy.NewError(rpcproxy.CodeMethodNotFound, "Method not found")
+	}
+	if rpcErr := rpcproxy.Validate(req.Method, req.Params); rpcErr != nil {
+		metrics.RpcProxyRequests.WithLabelValues(req.Method, "invalid").Inc()
+		return rpcErr
+	}
+	if rpcproxy.NeedsPush(req.Method) {
+		ok, err := midware.CheckScope(ctx, midware.ScopePush)
+		if err != nil {
+			logger.Ctx(ctx).Info("check scope failed", zap.Error(err))
+			return rpcproxy.NewError(rpcproxy.CodeInternalError, "scope check unavailable")
+		}
+		if !ok {
+			metrics.RpcProxyRequests.WithLabelValues(req.Method, "denied").Inc()
+			return rpcproxy.NewError(rpcproxy.CodeForbidden, "insufficient scope for "+req.Method)
+		}
+	}
+	ok, err := midware.CheckMethodRate(ctx, "rpc:"+req.Method, limit)
+	if err != nil {
+		logger.Ctx(ctx).Info("method rate limit failed", zap.Error(err))
+		return rpcproxy.NewError(rpcproxy.CodeInternalError, "rate limit unavailable")
+	}
+	if !ok {
+		metrics.RpcProxyRequests.WithLabelValues(req.Method, "limited").Inc()
+		return rpcproxy.NewError(rpcproxy.CodeRateLimited, "rate limit exceeded for "+req.Method)
+	}
+	return nil
+}
+
+// RpcProxy
+// @Summary 转发bitcoind JSON-RPC调用，只开放conf/rpc.yaml中配置的只读方法，支持批量
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Router /rpc [post]
+func RpcProxy(ctx *gin.Context) {
+	logger.Ctx(ctx).Info("RpcProxy enter")
+
+	body, err := ioutil.ReadAll(io.LimitReader(ctx.Request.Body, RpcProxyConf.MaxBody+1))
+	if err != nil {
+		logger.Ctx(ctx).Info("read body failed", zap.Error(err))
+		ctx.JSON(http.StatusBadRequest, &rpcproxy.Response{Error: rpcproxy.NewError(rpcproxy.CodeParseError, "Parse error")})
+		return
+	}
+	if int64(len(body)) > RpcProxyConf.MaxBody {
+		ctx.JSON(http.StatusRequestEntityTooLarge, &rpcproxy.Response{Error: rpcproxy.NewError(rpcproxy.CodeInvalidRequest, "request too large")})
+		return
+	}
+	reqs, batch, rpcErr := rpcproxy.Parse(body)
+	if rpcErr != nil {
+		ctx.JSON(http.StatusInternalServerError, &rpcproxy.Response{Error: rpcErr})
+		return
+	}
+	if len(reqs) > RpcProxyConf.MaxBatch {
+		ctx.JSON(http.StatusBadRequest, &rpcproxy.Response{Error: rpcproxy.NewError(rpcproxy.CodeInvalidRequest,
+			fmt.Sprintf("batch too large, at most %d calls", RpcProxyConf.MaxBatch))})
+		return
+	}
+	// 路由本身已扣1次，批量中其余调用各扣1次
+	if len(reqs) > 1 {
+		ok, reason, err := midware.ChargeQuota(ctx, int64(len(reqs)-1))
+		if err != nil {
+			logger.Ctx(ctx).Info("charge quota failed", zap.Error(err))
+		}
+		if !ok {
+			ctx.JSON(http.StatusTooManyRequests, &rpcproxy.Response{Error: rpcproxy.NewError(rpcproxy.CodeRateLimited, reason)})
+			return
+		}
+	}
+
+	resps := make([]*rpcproxy.Response, len(reqs))
+	var forward []int
+	var requests jsonrpc.RPCRequests
+	for i, req := range reqs {
+		resps[i] = &rpcproxy.Response{Id: req.Id}
+		if rpcErr := checkRpcProxyCall(ctx, req); rpcErr != nil {
+			resps[i].Error = rpcErr
+			continue
+		}
+		params := req.Params
+		if params == nil {
+			params = []json.RawMessage{}
+		}
+		forward = append(forward, i)
+		requests = append(requests, &jsonrpc.RPCRequest{Method: req.Method, Params: params})
+	}
+
+	if len(requests) > 0 {
+		method := "batch"
+		if len(requests) == 1 {
+			method = requests[0].Method
+		}
+		responses, err := rpcCallBatch(ctx.Request.Context(), method, requests)
+		if err != nil {
+			logger.Ctx(ctx).Info("call failed", zap.Error(err))
+		}
+		for j, i := range forward {
+			var response *jsonrpc.RPCResponse
+			if err == nil {
+				response = responses.GetByID(j)
+			}
+			switch {
+			case response == nil:
+				resps[i].Error = rpcproxy.NewError(rpcproxy.CodeInternalError, "rpc failed")
+				metrics.RpcProxyRequests.WithLabelValues(reqs[i].Method, "failed").Inc()
+			case response.Error != nil:
+				resps[i].Error = rpcproxy.NewError(response.Error.Code, response.Error.Message)
+				metrics.RpcProxyRequests.WithLabelValues(reqs[i].Method, "error").Inc()
+			default:
+				resps[i].Result = response.Result
+				metrics.RpcProxyRequests.WithLabelValues(reqs[i].Method, "ok").Inc()
+			}
+		}
+	}
+
+	if batch {
+		ctx.JSON(http.StatusOK, resps)
+		return
+	}
+	// 与bitcoind一致，单个请求出错时返回非200状态码
+	status := http.StatusOK
+	if resps[0].Error != nil {
+		switch resps[0].Error.Code {
+		case rpcproxy.CodeMethodNotFound:
+			status = http.StatusNotFound
+		case rpcproxy.CodeRateLimited:
+			status = http.StatusTooManyRequests
+		case rpcproxy.CodeForbidden:
+			status = http.StatusForbidden
+		default:
+			status = http.StatusInternalServerError
+		}
+	}
+	ctx.JSON(status, resps[0])
+}
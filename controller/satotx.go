@@ -16,7 +16,7 @@ import (
 // @Success 200 {object} model.Response{data=model.Welcome} "{"code": 0, "data": {}, "msg": "ok"}"
 // @Router / [get]
 func Satotx(ctx *gin.Context) {
-	logger.Log.Info("Satotx enter")
+	logger.Ctx(ctx).Info("Satotx enter")
 
 	ctx.JSON(http.StatusOK, model.Response{
 		Code: 0,
@@ -36,23 +36,23 @@ func Satotx(ctx *gin.Context) {
 // @Security BearerAuth
 // @Router /blockchain/info [get]
 func GetBlockchainInfo(ctx *gin.Context) {
-	logger.Log.Info("GetBlockchainInfo enter")
+	logger.Ctx(ctx).Info("GetBlockchainInfo enter")
 
-	bestHeight, err := service.GetBestBlockHeight()
+	bestHeight, err := service.GetBestBlockHeight(ctx.Request.Context())
 	if err != nil {
-		logger.Log.Info("best block failed", zap.Error(err))
+		logger.Ctx(ctx).Info("best block failed", zap.Error(err))
 	}
 
-	blk, err := service.GetBestBlockByHeight(bestHeight)
+	blk, err := service.GetBestBlockByHeight(ctx.Request.Context(), bestHeight)
 	if err != nil {
-		logger.Log.Info("best block failed", zap.Error(err))
+		logger.Ctx(ctx).Info("best block failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "get best block failed"})
 		return
 	}
 
-	mtp, err := service.GetBlockMedianTimePast(bestHeight)
+	mtp, err := service.GetBlockMedianTimePast(ctx.Request.Context(), bestHeight)
 	if err != nil {
-		logger.Log.Info("block mtp failed", zap.Error(err))
+		logger.Ctx(ctx).Info("block mtp failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "get block mtp failed"})
 		return
 	}
@@ -71,6 +71,7 @@ func GetBlockchainInfo(ctx *gin.Context) {
 			Difficulty:    "",
 			MedianTime:    mtp,
 			Chainwork:     "",
+			Index:         service.GetIndexStatus(),
 		},
 	})
 }
@@ -82,11 +83,11 @@ func GetBlockchainInfo(ctx *gin.Context) {
 // @Security BearerAuth
 // @Router /mempool/info [get]
 func GetMempoolInfo(ctx *gin.Context) {
-	logger.Log.Info("GetMempoolInfo enter")
+	logger.Ctx(ctx).Info("GetMempoolInfo enter")
 
-	count, err := service.GetMempoolTxCount()
+	count, err := service.GetMempoolTxCount(ctx.Request.Context())
 	if err != nil {
-		logger.Log.Info("get mempool failed", zap.Error(err))
+		logger.Ctx(ctx).Info("get mempool failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "get mempool failed"})
 		return
 	}
@@ -0,0 +1,308 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sensiblequery/lib/metrics"
+	"sensiblequery/lib/midware"
+	"sensiblequery/lib/utils"
+	"sensiblequery/logger"
+	"sensiblequery/model"
+	"sensiblequery/service"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+const (
+	// 订阅按地址数计费的周期，连接建立时先扣一个周期
+	subscribeBillingInterval = 10 * time.Minute
+	wsPingInterval           = 30 * time.Second
+	wsPongWait               = 2 * wsPingInterval
+	wsWriteTimeout           = 10 * time.Second
+	wsMaxMessageSize         = 64 * 1024
+	sseHeartbeatInterval     = 15 * time.Second
+)
+
+// 接口已由token鉴权，不限制来源
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+	CheckOrigin:     func(r *http.Request) bool { return true },
+}
+
+// SubscribeReq websocket客户端消息
+type SubscribeReq struct {
+	Op        string   `json:"op"` // subscribe/unsubscribe
+	Addresses []string `json:"addresses"`
+}
+
+func subscribeError(address, msg string) *model.AddressEventResp {
+	return &model.AddressEventResp{Type: model.EventError, Address: address, Msg: msg}
+}
+
+// subscribeAddresses 订阅地址并按新增地址数扣减配额，返回推送给客户端的事件
+func subscribeAddresses(ctx *gin.Context, sub *service.Subscriber, addresses []string) (events []*model.AddressEventResp) {
+	var valid []string
+	var pkhs [][]byte
+	for _, address := range addresses {
+		addressPkh, err := utils.DecodeAddress(address)
+		if err != nil {
+			events = append(events, subscribeError(address, "address invalid"))
+			continue
+		}
+		valid = append(valid, address)
+		pkhs = append(pkhs, addressPkh)
+	}
+	if len(pkhs) == 0 {
+		return events
+	}
+	if sub.Count()+len(pkhs) > service.MaxSubscribeAddresses {
+		return append(events, subscribeError("", service.ErrTooManyAddresses.Error()))
+	}
+
+	ok, reason, err := midware.ChargeQuota(ctx, int64(len(pkhs)))
+	if err != nil {
+		logger.Ctx(ctx).Warn("subscribe charge quota failed", zap.Error(err))
+	}
+	if !ok {
+		return append(events, subscribeError("", reason))
+	}
+
+	for i, addressPkh := range pkhs {
+		if err := sub.Subscribe(addressPkh); err != nil {
+			events = append(events, subscribeError(valid[i], err.Error()))
+			continue
+		}
+		balance, _, err := service.GetBalanceByAddress(ctx.Request.Context(), addressPkh)
+		if err != nil {
+			logger.Ctx(ctx).Info("subscribe get balance failed", zap.Error(err))
+		}
+		events = append(events, &model.AddressEventResp{
+			Type:    model.EventSubscribed,
+			Address: valid[i],
+			Balance: balance,
+		})
+	}
+	return events
+}
+
+func unsubscribeAddresses(sub *service.Subscriber, addresses []string) (events []*model.AddressEventResp) {
+	for _, address := range addresses {
+		addressPkh, err := utils.DecodeAddress(address)
+		if err != nil {
+			events = append(events, subscribeError(address, "address invalid"))
+			continue
+		}
+		sub.Unsubscribe(addressPkh)
+		events = append(events, &model.AddressEventResp{Type: model.EventUnsubscribed, Address: address})
+	}
+	return events
+}
+
+// chargeSubscriptions 每个计费周期按当前订阅地址数扣减配额，配额不足返回原因
+func chargeSubscriptions(ctx *gin.Context, sub *service.Subscriber) (reason string, ok bool) {
+	n := sub.Count()
+	if n == 0 {
+		return "", true
+	}
+	ok, reason, err := midware.ChargeQuota(ctx, int64(n))
+	if err != nil {
+		logger.Ctx(ctx).Warn("subscription charge quota failed", zap.Error(err))
+	}
+	return reason, ok
+}
+
+func queryAddresses(ctx *gin.Context) (addresses []string) {
+	for _, address := range strings.Split(ctx.Query("address"), ",") {
+		if address = strings.TrimSpace(address); address != "" {
+			addresses = append(addresses, address)
+		}
+	}
+	return addresses
+}
+
+// SubscribeWs
+// @Summary 通过websocket订阅地址utxo及余额变化
+// @Description 连接后发送{"op":"subscribe","addresses":["..."]}订阅，{"op":"unsubscribe",...}取消。也可在连接时以address参数指定初始地址
+// @Tags Subscribe
+// @Param address query string false "初始订阅地址，逗号分隔"
+// @Success 101 {object} model.AddressEventResp
+// @Router /ws [get]
+func SubscribeWs(ctx *gin.Context) {
+	conn, err := wsUpgrader.Upgrade(ctx.Writer, ctx.Request, nil)
+	if err != nil {
+		// Upgrade已返回错误响应
+		logger.Ctx(ctx).Info("websocket upgrade failed", zap.Error(err))
+		return
+	}
+	defer conn.Close()
+
+	metrics.SubscriptionConnections.WithLabelValues("ws").Inc()
+	defer metrics.SubscriptionConnections.WithLabelValues("ws").Dec()
+
+	sub := service.NewSubscriber()
+	defer sub.Close()
+
+	// 读取客户端消息，写操作只在下方循环中进行
+	done := make(chan struct{})
+	defer close(done)
+	requests := make(chan *SubscribeReq)
+	readErr := make(chan error, 1)
+	conn.SetReadLimit(wsMaxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+	go func() {
+		for {
+			req := &SubscribeReq{}
+			if err := conn.ReadJSON(req); err != nil {
+				readErr <- err
+				return
+			}
+			select {
+			case requests <- req:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	write := func(events []*model.AddressEventResp) error {
+		for _, event := range events {
+			conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+			if err := conn.WriteJSON(event); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	closeWith := func(reason string) {
+		write([]*model.AddressEventResp{subscribeError("", reason)})
+		conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseNormalClosure, reason),
+			time.Now().Add(wsWriteTimeout))
+	}
+
+	if addresses := queryAddresses(ctx); len(addresses) > 0 {
+		if err := write(subscribeAddresses(ctx, sub, addresses)); err != nil {
+			return
+		}
+	}
+
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+	billing := time.NewTicker(subscribeBillingInterval)
+	defer billing.Stop()
+	for {
+		var events []*model.AddressEventResp
+		select {
+		case req := <-requests:
+			switch req.Op {
+			case "subscribe":
+				events = subscribeAddresses(ctx, sub, req.Addresses)
+			case "unsubscribe":
+				events = unsubscribeAddresses(sub, req.Addresses)
+			default:
+				events = []*model.AddressEventResp{subscribeError("", "unknown op")}
+			}
+		case event, ok := <-sub.C:
+			if !ok {
+				closeWith(sub.Reason())
+				return
+			}
+			events = []*model.AddressEventResp{event}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout)); err != nil {
+				return
+			}
+		case <-billing.C:
+			if reason, ok := chargeSubscriptions(ctx, sub); !ok {
+				closeWith(reason)
+				return
+			}
+		case err := <-readErr:
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				logger.Ctx(ctx).Info("websocket read failed", zap.Error(err))
+			}
+			return
+		}
+		if err := write(events); err != nil {
+			return
+		}
+	}
+}
+
+// SubscribeSse
+// @Summary 通过Server-Sent Events订阅地址utxo及余额变化
+// @Description 事件名为事件类型，data为model.AddressEventResp。订阅地址在连接时指定，变更需重新连接
+// @Tags Subscribe
+// @Produce text/event-stream
+// @Param address query string true "订阅地址，逗号分隔"
+// @Success 200 {object} model.AddressEventResp
+// @Router /sse [get]
+func SubscribeSse(ctx *gin.Context) {
+	addresses := queryAddresses(ctx)
+	if len(addresses) == 0 {
+		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "address required"})
+		return
+	}
+	if len(addresses) > service.MaxSubscribeAddresses {
+		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: service.ErrTooManyAddresses.Error()})
+		return
+	}
+
+	metrics.SubscriptionConnections.WithLabelValues("sse").Inc()
+	defer metrics.SubscriptionConnections.WithLabelValues("sse").Dec()
+
+	sub := service.NewSubscriber()
+	defer sub.Close()
+
+	ctx.Header("Content-Type", "text/event-stream")
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("Connection", "keep-alive")
+	ctx.Header("X-Accel-Buffering", "no") // 关闭nginx缓冲
+	ctx.Status(http.StatusOK)
+
+	write := func(events []*model.AddressEventResp) {
+		for _, event := range events {
+			data, _ := json.Marshal(event)
+			fmt.Fprintf(ctx.Writer, "event: %s\ndata: %s\n\n", event.Type, data)
+		}
+		ctx.Writer.Flush()
+	}
+	write(subscribeAddresses(ctx, sub, addresses))
+	if sub.Count() == 0 {
+		return
+	}
+
+	heartbeat := time.NewTicker(sseHeartbeatInterval)
+	defer heartbeat.Stop()
+	billing := time.NewTicker(subscribeBillingInterval)
+	defer billing.Stop()
+	for {
+		select {
+		case event, ok := <-sub.C:
+			if !ok {
+				write([]*model.AddressEventResp{subscribeError("", sub.Reason())})
+				return
+			}
+			write([]*model.AddressEventResp{event})
+		case <-heartbeat.C:
+			fmt.Fprint(ctx.Writer, ": ping\n\n")
+			ctx.Writer.Flush()
+		case <-billing.C:
+			if reason, ok := chargeSubscriptions(ctx, sub); !ok {
+				write([]*model.AddressEventResp{subscribeError("", reason)})
+				return
+			}
+		case <-ctx.Request.Context().Done():
+			return
+		}
+	}
+}
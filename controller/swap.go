@@ -27,26 +27,26 @@ import (
 // @Security BearerAuth
 // @Router /contract/swap-data/{codehash}/{genesis} [get]
 func GetContractSwapDataInBlockRange(ctx *gin.Context) {
-	logger.Log.Info("GetContractSwapDataInBlockRange enter")
+	logger.Ctx(ctx).Info("GetContractSwapDataInBlockRange enter")
 
 	// check height
 	blkStartHeightString := ctx.DefaultQuery("start", "0")
 	blkStartHeight, err := strconv.Atoi(blkStartHeightString)
 	if err != nil || blkStartHeight < 0 {
-		logger.Log.Info("blk start height invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("blk start height invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "blk start height invalid"})
 		return
 	}
 	blkEndHeightString := ctx.DefaultQuery("end", "0")
 	blkEndHeight, err := strconv.Atoi(blkEndHeightString)
 	if err != nil || blkEndHeight < 0 {
-		logger.Log.Info("blk end height invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("blk end height invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "blk end height invalid"})
 		return
 	}
 
 	if blkEndHeight > 0 && (blkEndHeight <= blkStartHeight || (blkEndHeight-blkStartHeight > 10000)) {
-		logger.Log.Info("blk end height invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("blk end height invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "blk end height invalid"})
 		return
 	}
@@ -55,14 +55,14 @@ func GetContractSwapDataInBlockRange(ctx *gin.Context) {
 	cursorString := ctx.DefaultQuery("cursor", "0")
 	cursor, err := strconv.Atoi(cursorString)
 	if err != nil || cursor < 0 {
-		logger.Log.Info("cursor invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("cursor invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "cursor invalid"})
 		return
 	}
 	sizeString := ctx.DefaultQuery("size", "16")
 	size, err := strconv.Atoi(sizeString)
 	if err != nil || size <= 0 {
-		logger.Log.Info("size invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("size invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "size invalid"})
 		return
 	}
@@ -71,7 +71,7 @@ func GetContractSwapDataInBlockRange(ctx *gin.Context) {
 	// check
 	_, err = hex.DecodeString(codeHashHex)
 	if err != nil {
-		logger.Log.Info("codeHash invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("codeHash invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "codeHash invalid"})
 		return
 	}
@@ -80,14 +80,14 @@ func GetContractSwapDataInBlockRange(ctx *gin.Context) {
 	// check
 	_, err = hex.DecodeString(genesisIdHex)
 	if err != nil {
-		logger.Log.Info("genesisId invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("genesisId invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "genesisId invalid"})
 		return
 	}
 
-	result, err := service.GetContractSwapDataInBlocksByHeightRange(cursor, size, blkStartHeight, blkEndHeight, codeHashHex, genesisIdHex, scriptDecoder.CodeType_UNIQUE)
+	result, err := service.GetContractSwapDataInBlocksByHeightRange(ctx.Request.Context(), cursor, size, blkStartHeight, blkEndHeight, codeHashHex, genesisIdHex, scriptDecoder.CodeType_UNIQUE)
 	if err != nil {
-		logger.Log.Info("get swap failed", zap.Error(err))
+		logger.Ctx(ctx).Info("get swap failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "get swap failed"})
 		return
 	}
@@ -112,26 +112,26 @@ func GetContractSwapDataInBlockRange(ctx *gin.Context) {
 // @Security BearerAuth
 // @Router /contract/swap-aggregate/{codehash}/{genesis} [get]
 func GetContractSwapAggregateInBlockRange(ctx *gin.Context) {
-	logger.Log.Info("GetContractSwapAggregateInBlockRange enter")
+	logger.Ctx(ctx).Info("GetContractSwapAggregateInBlockRange enter")
 
 	// check height
 	blkStartHeightString := ctx.DefaultQuery("start", "0")
 	blkStartHeight, err := strconv.Atoi(blkStartHeightString)
 	if err != nil || blkStartHeight < 0 {
-		logger.Log.Info("blk start height invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("blk start height invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "blk start height invalid"})
 		return
 	}
 	blkEndHeightString := ctx.DefaultQuery("end", "0")
 	blkEndHeight, err := strconv.Atoi(blkEndHeightString)
 	if err != nil || blkEndHeight < 0 {
-		logger.Log.Info("blk end height invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("blk end height invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "blk end height invalid"})
 		return
 	}
 
 	if blkEndHeight > 0 && (blkEndHeight <= blkStartHeight || (blkEndHeight-blkStartHeight > 100000)) {
-		logger.Log.Info("blk end height invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("blk end height invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "blk end height invalid"})
 		return
 	}
@@ -139,7 +139,7 @@ func GetContractSwapAggregateInBlockRange(ctx *gin.Context) {
 	intervalString := ctx.DefaultQuery("interval", "6")
 	interval, err := strconv.Atoi(intervalString)
 	if err != nil || interval < 0 {
-		logger.Log.Info("interval invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("interval invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "interval invalid"})
 		return
 	}
@@ -148,7 +148,7 @@ func GetContractSwapAggregateInBlockRange(ctx *gin.Context) {
 	// check
 	_, err = hex.DecodeString(codeHashHex)
 	if err != nil {
-		logger.Log.Info("codeHash invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("codeHash invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "codeHash invalid"})
 		return
 	}
@@ -157,14 +157,14 @@ func GetContractSwapAggregateInBlockRange(ctx *gin.Context) {
 	// check
 	_, err = hex.DecodeString(genesisIdHex)
 	if err != nil {
-		logger.Log.Info("genesisId invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("genesisId invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "genesisId invalid"})
 		return
 	}
 
-	result, err := service.GetContractSwapAggregateInBlocksByHeightRange(interval, blkStartHeight, blkEndHeight, codeHashHex, genesisIdHex, scriptDecoder.CodeType_UNIQUE)
+	result, err := service.GetContractSwapAggregateInBlocksByHeightRange(ctx.Request.Context(), interval, blkStartHeight, blkEndHeight, codeHashHex, genesisIdHex, scriptDecoder.CodeType_UNIQUE)
 	if err != nil {
-		logger.Log.Info("get swap failed", zap.Error(err))
+		logger.Ctx(ctx).Info("get swap failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "get swap failed"})
 		return
 	}
@@ -189,26 +189,26 @@ func GetContractSwapAggregateInBlockRange(ctx *gin.Context) {
 // @Security BearerAuth
 // @Router /contract/swap-aggregate-amount/{codehash}/{genesis} [get]
 func GetContractSwapAggregateAmountInBlockRange(ctx *gin.Context) {
-	logger.Log.Info("GetContractSwapAggregateAmountInBlockRange enter")
+	logger.Ctx(ctx).Info("GetContractSwapAggregateAmountInBlockRange enter")
 
 	// check height
 	blkStartHeightString := ctx.DefaultQuery("start", "0")
 	blkStartHeight, err := strconv.Atoi(blkStartHeightString)
 	if err != nil || blkStartHeight < 0 {
-		logger.Log.Info("blk start height invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("blk start height invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "blk start height invalid"})
 		return
 	}
 	blkEndHeightString := ctx.DefaultQuery("end", "0")
 	blkEndHeight, err := strconv.Atoi(blkEndHeightString)
 	if err != nil || blkEndHeight < 0 {
-		logger.Log.Info("blk end height invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("blk end height invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "blk end height invalid"})
 		return
 	}
 
 	if blkEndHeight > 0 && (blkEndHeight <= blkStartHeight || (blkEndHeight-blkStartHeight > 100000)) {
-		logger.Log.Info("blk end height invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("blk end height invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "blk end height invalid"})
 		return
 	}
@@ -216,7 +216,7 @@ func GetContractSwapAggregateAmountInBlockRange(ctx *gin.Context) {
 	intervalString := ctx.DefaultQuery("interval", "6")
 	interval, err := strconv.Atoi(intervalString)
 	if err != nil || interval < 0 {
-		logger.Log.Info("interval invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("interval invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "interval invalid"})
 		return
 	}
@@ -225,7 +225,7 @@ func GetContractSwapAggregateAmountInBlockRange(ctx *gin.Context) {
 	// check
 	_, err = hex.DecodeString(codeHashHex)
 	if err != nil {
-		logger.Log.Info("codeHash invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("codeHash invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "codeHash invalid"})
 		return
 	}
@@ -234,14 +234,14 @@ func GetContractSwapAggregateAmountInBlockRange(ctx *gin.Context) {
 	// check
 	_, err = hex.DecodeString(genesisIdHex)
 	if err != nil {
-		logger.Log.Info("genesisId invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("genesisId invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "genesisId invalid"})
 		return
 	}
 
-	result, err := service.GetContractSwapAggregateAmountInBlocksByHeightRange(interval, blkStartHeight, blkEndHeight, codeHashHex, genesisIdHex, scriptDecoder.CodeType_UNIQUE)
+	result, err := service.GetContractSwapAggregateAmountInBlocksByHeightRange(ctx.Request.Context(), interval, blkStartHeight, blkEndHeight, codeHashHex, genesisIdHex, scriptDecoder.CodeType_UNIQUE)
 	if err != nil {
-		logger.Log.Info("get swap failed", zap.Error(err))
+		logger.Ctx(ctx).Info("get swap failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "get swap failed"})
 		return
 	}
@@ -18,11 +18,11 @@ import (
 // @Security BearerAuth
 // @Router /token/info [get]
 func ListAllTokenInfo(ctx *gin.Context) {
-	logger.Log.Info("ListAllTokenInfo enter")
+	logger.Ctx(ctx).Info("ListAllTokenInfo enter")
 
-	result, err := service.GetTokenInfo()
+	result, err := service.GetTokenInfo(ctx.Request.Context())
 	if err != nil {
-		logger.Log.Info("get token info failed", zap.Error(err))
+		logger.Ctx(ctx).Info("get token info failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "get token info failed"})
 		return
 	}
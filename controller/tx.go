@@ -32,20 +32,20 @@ var (
 // @Security BearerAuth
 // @Router /height/{height}/block/txs [get]
 func GetBlockTxsByBlockHeight(ctx *gin.Context) {
-	logger.Log.Info("GetBlockTxsByBlockHeight enter")
+	logger.Ctx(ctx).Info("GetBlockTxsByBlockHeight enter")
 
 	// get cursor/size
 	cursorString := ctx.DefaultQuery("cursor", "0")
 	cursor, err := strconv.Atoi(cursorString)
 	if err != nil || cursor < 0 {
-		logger.Log.Info("cursor invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("cursor invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "cursor invalid"})
 		return
 	}
 	sizeString := ctx.DefaultQuery("size", "16")
 	size, err := strconv.Atoi(sizeString)
 	if err != nil || size <= 0 {
-		logger.Log.Info("size invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("size invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "size invalid"})
 		return
 	}
@@ -54,14 +54,14 @@ func GetBlockTxsByBlockHeight(ctx *gin.Context) {
 	blkHeightString := ctx.Param("height")
 	blkHeight, err := strconv.Atoi(blkHeightString)
 	if err != nil || blkHeight < 0 {
-		logger.Log.Info("blk height invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("blk height invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "blk height invalid"})
 		return
 	}
 
-	blkTxs, err := service.GetBlockTxsByBlockHeight(cursor, size, blkHeight)
+	blkTxs, err := service.GetBlockTxsByBlockHeight(ctx.Request.Context(), cursor, size, blkHeight)
 	if err != nil {
-		logger.Log.Info("get block txs failed", zap.Error(err))
+		logger.Ctx(ctx).Info("get block txs failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "get block txs failed"})
 		return
 	}
@@ -84,20 +84,20 @@ func GetBlockTxsByBlockHeight(ctx *gin.Context) {
 // @Security BearerAuth
 // @Router /block/txs/{blkid} [get]
 func GetBlockTxsByBlockId(ctx *gin.Context) {
-	logger.Log.Info("GetBlockTxsByBlockId enter")
+	logger.Ctx(ctx).Info("GetBlockTxsByBlockId enter")
 
 	// get cursor/size
 	cursorString := ctx.DefaultQuery("cursor", "0")
 	cursor, err := strconv.Atoi(cursorString)
 	if err != nil || cursor < 0 {
-		logger.Log.Info("cursor invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("cursor invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "cursor invalid"})
 		return
 	}
 	sizeString := ctx.DefaultQuery("size", "16")
 	size, err := strconv.Atoi(sizeString)
 	if err != nil || size <= 0 {
-		logger.Log.Info("size invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("size invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "size invalid"})
 		return
 	}
@@ -106,15 +106,15 @@ func GetBlockTxsByBlockId(ctx *gin.Context) {
 	// check
 	blkIdReverse, err := hex.DecodeString(blkIdHex)
 	if err != nil {
-		logger.Log.Info("blkid invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("blkid invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "blkid invalid"})
 		return
 	}
 	blkId := utils.ReverseBytes(blkIdReverse)
 
-	blkTxs, err := service.GetBlockTxsByBlockId(cursor, size, hex.EncodeToString(blkId))
+	blkTxs, err := service.GetBlockTxsByBlockId(ctx.Request.Context(), cursor, size, hex.EncodeToString(blkId))
 	if err != nil {
-		logger.Log.Info("get block txs failed", zap.Error(err))
+		logger.Ctx(ctx).Info("get block txs failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "get block txs failed"})
 		return
 	}
@@ -135,21 +135,21 @@ func GetBlockTxsByBlockId(ctx *gin.Context) {
 // @Security BearerAuth
 // @Router /tx/{txid} [get]
 func GetTxById(ctx *gin.Context) {
-	logger.Log.Info("GetTxById enter")
+	logger.Ctx(ctx).Info("GetTxById enter")
 
 	txIdHex := ctx.Param("txid")
 	// check
 	txIdReverse, err := hex.DecodeString(txIdHex)
 	if err != nil {
-		logger.Log.Info("txid invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("txid invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "txid invalid"})
 		return
 	}
 	txId := utils.ReverseBytes(txIdReverse)
 
-	tx, err := service.GetTxById(hex.EncodeToString(txId))
+	tx, err := service.GetTxById(ctx.Request.Context(), hex.EncodeToString(txId))
 	if err != nil {
-		logger.Log.Info("get tx failed", zap.Error(err))
+		logger.Ctx(ctx).Info("get tx failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "get tx failed"})
 		return
 	}
@@ -171,12 +171,12 @@ func GetTxById(ctx *gin.Context) {
 // @Security BearerAuth
 // @Router /height/{height}/tx/{txid} [get]
 func GetTxByIdInsideHeight(ctx *gin.Context) {
-	logger.Log.Info("GetTxByIdInsideHeight enter")
+	logger.Ctx(ctx).Info("GetTxByIdInsideHeight enter")
 
 	blkHeightString := ctx.Param("height")
 	blkHeight, err := strconv.Atoi(blkHeightString)
 	if err != nil {
-		logger.Log.Info("height invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("height invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "height invalid"})
 		return
 	}
@@ -185,15 +185,15 @@ func GetTxByIdInsideHeight(ctx *gin.Context) {
 	// check
 	txIdReverse, err := hex.DecodeString(txIdHex)
 	if err != nil {
-		logger.Log.Info("txid invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("txid invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "txid invalid"})
 		return
 	}
 	txId := utils.ReverseBytes(txIdReverse)
 
-	tx, err := service.GetTxByIdInsideHeight(blkHeight, hex.EncodeToString(txId))
+	tx, err := service.GetTxByIdInsideHeight(ctx.Request.Context(), blkHeight, hex.EncodeToString(txId))
 	if err != nil {
-		logger.Log.Info("get tx failed", zap.Error(err))
+		logger.Ctx(ctx).Info("get tx failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "get tx failed"})
 		return
 	}
@@ -215,21 +215,21 @@ func GetTxByIdInsideHeight(ctx *gin.Context) {
 // @Security BearerAuth
 // @Router /rawtx/{txid} [get]
 func GetRawTxById(ctx *gin.Context) {
-	logger.Log.Info("GetRawTxById enter")
+	logger.Ctx(ctx).Info("GetRawTxById enter")
 
 	txIdHex := ctx.Param("txid")
 	// check
 	txIdReverse, err := hex.DecodeString(txIdHex)
 	if err != nil {
-		logger.Log.Info("txid invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("txid invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "txid invalid"})
 		return
 	}
 	txId := utils.ReverseBytes(txIdReverse)
 
-	tx, err := service.GetRawTxById(hex.EncodeToString(txId))
+	tx, err := service.GetRawTxById(ctx.Request.Context(), hex.EncodeToString(txId))
 	if err != nil {
-		logger.Log.Info("get tx failed", zap.Error(err))
+		logger.Ctx(ctx).Info("get tx failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "get tx failed"})
 		return
 	}
@@ -251,21 +251,21 @@ func GetRawTxById(ctx *gin.Context) {
 // @Security BearerAuth
 // @Router /relay/{txid} [get]
 func RelayTxById(ctx *gin.Context) {
-	logger.Log.Info("RelayTxById enter")
+	logger.Ctx(ctx).Info("RelayTxById enter")
 
 	txIdHex := ctx.Param("txid")
 	// check
 	txIdReverse, err := hex.DecodeString(txIdHex)
 	if err != nil {
-		logger.Log.Info("txid invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("txid invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "txid invalid"})
 		return
 	}
 	txId := utils.ReverseBytes(txIdReverse)
 
-	tx, err := service.GetRawTxById(hex.EncodeToString(txId))
+	tx, err := service.GetRawTxById(ctx.Request.Context(), hex.EncodeToString(txId))
 	if err != nil {
-		logger.Log.Info("get tx failed", zap.Error(err))
+		logger.Ctx(ctx).Info("get tx failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "get tx failed"})
 		return
 	}
@@ -275,9 +275,16 @@ func RelayTxById(ctx *gin.Context) {
 		woc = "https://api.whatsonchain.com/v1/bsv/test/tx/raw"
 	}
 	jsonData := fmt.Sprintf(`{"txhex": "%s"}`, hex.EncodeToString(tx))
-	resp, err := http.Post(woc, "application/json", bytes.NewBufferString(jsonData))
+	wocReq, err := http.NewRequest("POST", woc, bytes.NewBufferString(jsonData))
 	if err != nil {
-		logger.Log.Info("relay tx failed", zap.Error(err))
+		logger.Ctx(ctx).Info("relay tx failed", zap.Error(err))
+		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "relay tx failed"})
+		return
+	}
+	wocReq.Header.Set("Content-Type", "application/json")
+	resp, err := wocDo(ctx.Request.Context(), wocReq)
+	if err != nil {
+		logger.Ctx(ctx).Info("relay tx failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "relay tx failed"})
 		return
 	}
@@ -302,12 +309,12 @@ func RelayTxById(ctx *gin.Context) {
 // @Security BearerAuth
 // @Router /height/{height}/rawtx/{txid} [get]
 func GetRawTxByIdInsideHeight(ctx *gin.Context) {
-	logger.Log.Info("GetRawTxByIdInsideHeight enter")
+	logger.Ctx(ctx).Info("GetRawTxByIdInsideHeight enter")
 
 	blkHeightString := ctx.Param("height")
 	blkHeight, err := strconv.Atoi(blkHeightString)
 	if err != nil {
-		logger.Log.Info("height invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("height invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "height invalid"})
 		return
 	}
@@ -316,15 +323,15 @@ func GetRawTxByIdInsideHeight(ctx *gin.Context) {
 	// check
 	txIdReverse, err := hex.DecodeString(txIdHex)
 	if err != nil {
-		logger.Log.Info("txid invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("txid invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "txid invalid"})
 		return
 	}
 	txId := utils.ReverseBytes(txIdReverse)
 
-	tx, err := service.GetRawTxByIdInsideHeight(blkHeight, hex.EncodeToString(txId))
+	tx, err := service.GetRawTxByIdInsideHeight(ctx.Request.Context(), blkHeight, hex.EncodeToString(txId))
 	if err != nil {
-		logger.Log.Info("get tx failed", zap.Error(err))
+		logger.Ctx(ctx).Info("get tx failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "get tx failed"})
 		return
 	}
@@ -24,20 +24,20 @@ import (
 // @Security BearerAuth
 // @Router /tx/{txid}/ins [get]
 func GetTxInputsByTxId(ctx *gin.Context) {
-	logger.Log.Info("GetTxInputsByTxId enter")
+	logger.Ctx(ctx).Info("GetTxInputsByTxId enter")
 
 	// get cursor/size
 	cursorString := ctx.DefaultQuery("cursor", "0")
 	cursor, err := strconv.Atoi(cursorString)
 	if err != nil || cursor < 0 {
-		logger.Log.Info("cursor invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("cursor invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "cursor invalid"})
 		return
 	}
 	sizeString := ctx.DefaultQuery("size", "16")
 	size, err := strconv.Atoi(sizeString)
 	if err != nil || size <= 0 {
-		logger.Log.Info("size invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("size invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "size invalid"})
 		return
 	}
@@ -46,15 +46,15 @@ func GetTxInputsByTxId(ctx *gin.Context) {
 	// check
 	txIdReverse, err := hex.DecodeString(txIdHex)
 	if err != nil {
-		logger.Log.Info("txid invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("txid invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "txid invalid"})
 		return
 	}
 	txId := utils.ReverseBytes(txIdReverse)
 
-	result, err := service.GetTxInputsByTxId(cursor, size, hex.EncodeToString(txId))
+	result, err := service.GetTxInputsByTxId(ctx.Request.Context(), cursor, size, hex.EncodeToString(txId))
 	if err != nil {
-		logger.Log.Info("get block failed", zap.Error(err))
+		logger.Ctx(ctx).Info("get block failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "get txin failed"})
 		return
 	}
@@ -78,20 +78,20 @@ func GetTxInputsByTxId(ctx *gin.Context) {
 // @Security BearerAuth
 // @Router /height/{height}/tx/{txid}/ins [get]
 func GetTxInputsByTxIdInsideHeight(ctx *gin.Context) {
-	logger.Log.Info("GetTxInputsByTxIdInsideHeight enter")
+	logger.Ctx(ctx).Info("GetTxInputsByTxIdInsideHeight enter")
 
 	// get cursor/size
 	cursorString := ctx.DefaultQuery("cursor", "0")
 	cursor, err := strconv.Atoi(cursorString)
 	if err != nil || cursor < 0 {
-		logger.Log.Info("cursor invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("cursor invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "cursor invalid"})
 		return
 	}
 	sizeString := ctx.DefaultQuery("size", "16")
 	size, err := strconv.Atoi(sizeString)
 	if err != nil || size <= 0 {
-		logger.Log.Info("size invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("size invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "size invalid"})
 		return
 	}
@@ -99,7 +99,7 @@ func GetTxInputsByTxIdInsideHeight(ctx *gin.Context) {
 	blkHeightString := ctx.Param("height")
 	blkHeight, err := strconv.Atoi(blkHeightString)
 	if err != nil {
-		logger.Log.Info("height invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("height invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "height invalid"})
 		return
 	}
@@ -108,15 +108,15 @@ func GetTxInputsByTxIdInsideHeight(ctx *gin.Context) {
 	// check
 	txIdReverse, err := hex.DecodeString(txIdHex)
 	if err != nil {
-		logger.Log.Info("txid invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("txid invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "txid invalid"})
 		return
 	}
 	txId := utils.ReverseBytes(txIdReverse)
 
-	result, err := service.GetTxInputsByTxIdInsideHeight(cursor, size, blkHeight, hex.EncodeToString(txId))
+	result, err := service.GetTxInputsByTxIdInsideHeight(ctx.Request.Context(), cursor, size, blkHeight, hex.EncodeToString(txId))
 	if err != nil {
-		logger.Log.Info("get block failed", zap.Error(err))
+		logger.Ctx(ctx).Info("get block failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "get txin failed"})
 		return
 	}
@@ -138,13 +138,13 @@ func GetTxInputsByTxIdInsideHeight(ctx *gin.Context) {
 // @Security BearerAuth
 // @Router /tx/{txid}/in/{index} [get]
 func GetTxInputByTxIdAndIdx(ctx *gin.Context) {
-	logger.Log.Info("GetTxInputByTxIdAndIdx enter")
+	logger.Ctx(ctx).Info("GetTxInputByTxIdAndIdx enter")
 
 	// check tx
 	txIdHex := ctx.Param("txid")
 	txIdReverse, err := hex.DecodeString(txIdHex)
 	if err != nil {
-		logger.Log.Info("txid invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("txid invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "txid invalid"})
 		return
 	}
@@ -154,14 +154,14 @@ func GetTxInputByTxIdAndIdx(ctx *gin.Context) {
 	txIndexString := ctx.Param("index")
 	txIndex, err := strconv.Atoi(txIndexString)
 	if err != nil || txIndex < 0 {
-		logger.Log.Info("txindex invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("txindex invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "txindex invalid"})
 		return
 	}
 
-	result, err := service.GetTxInputByTxIdAndIdx(hex.EncodeToString(txId), txIndex)
+	result, err := service.GetTxInputByTxIdAndIdx(ctx.Request.Context(), hex.EncodeToString(txId), txIndex)
 	if err != nil {
-		logger.Log.Info("get block failed", zap.Error(err))
+		logger.Ctx(ctx).Info("get block failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "get txin failed"})
 		return
 	}
@@ -184,12 +184,12 @@ func GetTxInputByTxIdAndIdx(ctx *gin.Context) {
 // @Security BearerAuth
 // @Router /height/{height}/tx/{txid}/in/{index} [get]
 func GetTxInputByTxIdAndIdxInsideHeight(ctx *gin.Context) {
-	logger.Log.Info("GetTxInputByTxIdAndIdxInsideHeight enter")
+	logger.Ctx(ctx).Info("GetTxInputByTxIdAndIdxInsideHeight enter")
 
 	blkHeightString := ctx.Param("height")
 	blkHeight, err := strconv.Atoi(blkHeightString)
 	if err != nil {
-		logger.Log.Info("height invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("height invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "height invalid"})
 		return
 	}
@@ -198,7 +198,7 @@ func GetTxInputByTxIdAndIdxInsideHeight(ctx *gin.Context) {
 	txIdHex := ctx.Param("txid")
 	txIdReverse, err := hex.DecodeString(txIdHex)
 	if err != nil {
-		logger.Log.Info("txid invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("txid invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "txid invalid"})
 		return
 	}
@@ -208,14 +208,14 @@ func GetTxInputByTxIdAndIdxInsideHeight(ctx *gin.Context) {
 	txIndexString := ctx.Param("index")
 	txIndex, err := strconv.Atoi(txIndexString)
 	if err != nil || txIndex < 0 {
-		logger.Log.Info("txindex invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("txindex invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "txindex invalid"})
 		return
 	}
 
-	result, err := service.GetTxInputByTxIdAndIdxInsideHeight(blkHeight, hex.EncodeToString(txId), txIndex)
+	result, err := service.GetTxInputByTxIdAndIdxInsideHeight(ctx.Request.Context(), blkHeight, hex.EncodeToString(txId), txIndex)
 	if err != nil {
-		logger.Log.Info("get block failed", zap.Error(err))
+		logger.Ctx(ctx).Info("get block failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "get txin failed"})
 		return
 	}
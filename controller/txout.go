@@ -24,20 +24,20 @@ import (
 // @Security BearerAuth
 // @Router /tx/{txid}/outs [get]
 func GetTxOutputsByTxId(ctx *gin.Context) {
-	logger.Log.Info("GetTxOutputsByTxId enter")
+	logger.Ctx(ctx).Info("GetTxOutputsByTxId enter")
 
 	// get cursor/size
 	cursorString := ctx.DefaultQuery("cursor", "0")
 	cursor, err := strconv.Atoi(cursorString)
 	if err != nil || cursor < 0 {
-		logger.Log.Info("cursor invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("cursor invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "cursor invalid"})
 		return
 	}
 	sizeString := ctx.DefaultQuery("size", "16")
 	size, err := strconv.Atoi(sizeString)
 	if err != nil || size <= 0 {
-		logger.Log.Info("size invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("size invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "size invalid"})
 		return
 	}
@@ -46,15 +46,15 @@ func GetTxOutputsByTxId(ctx *gin.Context) {
 	// check
 	txIdReverse, err := hex.DecodeString(txIdHex)
 	if err != nil {
-		logger.Log.Info("txid invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("txid invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "txid invalid"})
 		return
 	}
 	txId := utils.ReverseBytes(txIdReverse)
 
-	result, err := service.GetTxOutputsByTxId(cursor, size, hex.EncodeToString(txId))
+	result, err := service.GetTxOutputsByTxId(ctx.Request.Context(), cursor, size, hex.EncodeToString(txId))
 	if err != nil {
-		logger.Log.Info("get txouts failed", zap.Error(err))
+		logger.Ctx(ctx).Info("get txouts failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "get txo failed"})
 		return
 	}
@@ -78,20 +78,20 @@ func GetTxOutputsByTxId(ctx *gin.Context) {
 // @Security BearerAuth
 // @Router /height/{height}/tx/{txid}/outs [get]
 func GetTxOutputsByTxIdInsideHeight(ctx *gin.Context) {
-	logger.Log.Info("GetTxOutputsByTxId enter")
+	logger.Ctx(ctx).Info("GetTxOutputsByTxId enter")
 
 	// get cursor/size
 	cursorString := ctx.DefaultQuery("cursor", "0")
 	cursor, err := strconv.Atoi(cursorString)
 	if err != nil || cursor < 0 {
-		logger.Log.Info("cursor invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("cursor invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "cursor invalid"})
 		return
 	}
 	sizeString := ctx.DefaultQuery("size", "16")
 	size, err := strconv.Atoi(sizeString)
 	if err != nil || size <= 0 {
-		logger.Log.Info("size invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("size invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "size invalid"})
 		return
 	}
@@ -99,7 +99,7 @@ func GetTxOutputsByTxIdInsideHeight(ctx *gin.Context) {
 	blkHeightString := ctx.Param("height")
 	blkHeight, err := strconv.Atoi(blkHeightString)
 	if err != nil {
-		logger.Log.Info("height invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("height invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "height invalid"})
 		return
 	}
@@ -108,15 +108,15 @@ func GetTxOutputsByTxIdInsideHeight(ctx *gin.Context) {
 	// check
 	txIdReverse, err := hex.DecodeString(txIdHex)
 	if err != nil {
-		logger.Log.Info("txid invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("txid invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "txid invalid"})
 		return
 	}
 	txId := utils.ReverseBytes(txIdReverse)
 
-	result, err := service.GetTxOutputsByTxIdInsideHeight(cursor, size, blkHeight, hex.EncodeToString(txId))
+	result, err := service.GetTxOutputsByTxIdInsideHeight(ctx.Request.Context(), cursor, size, blkHeight, hex.EncodeToString(txId))
 	if err != nil {
-		logger.Log.Info("get txout with height failed", zap.Error(err))
+		logger.Ctx(ctx).Info("get txout with height failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "get txo failed"})
 		return
 	}
@@ -138,13 +138,13 @@ func GetTxOutputsByTxIdInsideHeight(ctx *gin.Context) {
 // @Security BearerAuth
 // @Router /tx/{txid}/out/{index} [get]
 func GetTxOutputByTxIdAndIdx(ctx *gin.Context) {
-	logger.Log.Info("GetTxOutputByTxIdAndIdx enter")
+	logger.Ctx(ctx).Info("GetTxOutputByTxIdAndIdx enter")
 
 	// check tx
 	txIdHex := ctx.Param("txid")
 	txIdReverse, err := hex.DecodeString(txIdHex)
 	if err != nil {
-		logger.Log.Info("txid invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("txid invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "txid invalid"})
 		return
 	}
@@ -154,14 +154,14 @@ func GetTxOutputByTxIdAndIdx(ctx *gin.Context) {
 	txIndexString := ctx.Param("index")
 	txIndex, err := strconv.Atoi(txIndexString)
 	if err != nil || txIndex < 0 {
-		logger.Log.Info("txindex invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("txindex invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "txindex invalid"})
 		return
 	}
 
-	result, err := service.GetTxOutputByTxIdAndIdx(hex.EncodeToString(txId), txIndex)
+	result, err := service.GetTxOutputByTxIdAndIdx(ctx.Request.Context(), hex.EncodeToString(txId), txIndex)
 	if err != nil {
-		logger.Log.Info("get txout failed", zap.Error(err))
+		logger.Ctx(ctx).Info("get txout failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "get txo failed"})
 		return
 	}
@@ -184,12 +184,12 @@ func GetTxOutputByTxIdAndIdx(ctx *gin.Context) {
 // @Security BearerAuth
 // @Router /height/{height}/tx/{txid}/out/{index} [get]
 func GetTxOutputByTxIdAndIdxInsideHeight(ctx *gin.Context) {
-	logger.Log.Info("GetTxOutputByTxIdAndIdxInsideHeight enter")
+	logger.Ctx(ctx).Info("GetTxOutputByTxIdAndIdxInsideHeight enter")
 
 	blkHeightString := ctx.Param("height")
 	blkHeight, err := strconv.Atoi(blkHeightString)
 	if err != nil {
-		logger.Log.Info("height invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("height invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "height invalid"})
 		return
 	}
@@ -198,7 +198,7 @@ func GetTxOutputByTxIdAndIdxInsideHeight(ctx *gin.Context) {
 	txIdHex := ctx.Param("txid")
 	txIdReverse, err := hex.DecodeString(txIdHex)
 	if err != nil {
-		logger.Log.Info("txid invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("txid invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "txid invalid"})
 		return
 	}
@@ -208,14 +208,14 @@ func GetTxOutputByTxIdAndIdxInsideHeight(ctx *gin.Context) {
 	txIndexString := ctx.Param("index")
 	txIndex, err := strconv.Atoi(txIndexString)
 	if err != nil || txIndex < 0 {
-		logger.Log.Info("txindex invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("txindex invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "txindex invalid"})
 		return
 	}
 
-	result, err := service.GetTxOutputByTxIdAndIdxInsideHeight(blkHeight, hex.EncodeToString(txId), txIndex)
+	result, err := service.GetTxOutputByTxIdAndIdxInsideHeight(ctx.Request.Context(), blkHeight, hex.EncodeToString(txId), txIndex)
 	if err != nil {
-		logger.Log.Info("get txout with height failed", zap.Error(err))
+		logger.Ctx(ctx).Info("get txout with height failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "get txo failed"})
 		return
 	}
@@ -237,13 +237,13 @@ func GetTxOutputByTxIdAndIdxInsideHeight(ctx *gin.Context) {
 // @Security BearerAuth
 // @Router /tx/{txid}/out/{index}/spent [get]
 func GetTxOutputSpentStatusByTxIdAndIdx(ctx *gin.Context) {
-	logger.Log.Info("GetTxOutputSpentStatusByTxIdAndIdx enter")
+	logger.Ctx(ctx).Info("GetTxOutputSpentStatusByTxIdAndIdx enter")
 
 	// check tx
 	txIdHex := ctx.Param("txid")
 	txIdReverse, err := hex.DecodeString(txIdHex)
 	if err != nil {
-		logger.Log.Info("txid invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("txid invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "txid invalid"})
 		return
 	}
@@ -253,14 +253,14 @@ func GetTxOutputSpentStatusByTxIdAndIdx(ctx *gin.Context) {
 	txIndexString := ctx.Param("index")
 	txIndex, err := strconv.Atoi(txIndexString)
 	if err != nil || txIndex < 0 {
-		logger.Log.Info("txindex invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("txindex invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "txindex invalid"})
 		return
 	}
 
-	result, err := service.GetTxOutputSpentStatusByTxIdAndIdx(hex.EncodeToString(txId), txIndex)
+	result, err := service.GetTxOutputSpentStatusByTxIdAndIdx(ctx.Request.Context(), hex.EncodeToString(txId), txIndex)
 	if err != nil {
-		logger.Log.Info("get txout spent status failed", zap.Error(err))
+		logger.Ctx(ctx).Info("get txout spent status failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "get vout failed"})
 		return
 	}
@@ -3,6 +3,7 @@ package controller
 import (
 	"encoding/hex"
 	"net/http"
+	"sensiblequery/lib/settings"
 	"sensiblequery/lib/utils"
 	"sensiblequery/logger"
 	"sensiblequery/model"
@@ -13,8 +14,6 @@ import (
 	"go.uber.org/zap"
 )
 
-const MAX_UTXO_LIMIT = 5120
-
 // GetBalanceByAddress
 // @Summary 通过地址address获取balance
 // @Tags UTXO
@@ -24,28 +23,29 @@ const MAX_UTXO_LIMIT = 5120
 // @Security BearerAuth
 // @Router /address/{address}/balance [get]
 func GetBalanceByAddress(ctx *gin.Context) {
-	logger.Log.Info("GetBalanceByAddress enter")
+	logger.Ctx(ctx).Info("GetBalanceByAddress enter")
 
 	address := ctx.Param("address")
 	// check
 	addressPkh, err := utils.DecodeAddress(address)
 	if err != nil {
-		logger.Log.Info("address invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("address invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "address invalid"})
 		return
 	}
-	logger.Log.Info("GetBalance", zap.String("address", hex.EncodeToString(addressPkh)))
-	result, err := service.GetBalanceByAddress(addressPkh)
+	logger.Ctx(ctx).Info("GetBalance", zap.String("address", hex.EncodeToString(addressPkh)))
+	result, source, err := service.GetBalanceByAddress(ctx.Request.Context(), addressPkh)
 	if err != nil {
-		logger.Log.Info("get balance failed", zap.Error(err))
+		logger.Ctx(ctx).Info("get balance failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "get txo failed"})
 		return
 	}
 
 	ctx.JSON(http.StatusOK, model.Response{
-		Code: 0,
-		Msg:  "ok",
-		Data: result,
+		Code:   0,
+		Msg:    "ok",
+		Data:   result,
+		Source: source,
 	})
 }
 
@@ -53,14 +53,14 @@ func GetBalanceByAddress(ctx *gin.Context) {
 // @Summary 通过地址address获取相关常规utxo列表，和数量信息
 // @Tags UTXO
 // @Produce  json
-// @Param cursor query int true "起始游标" default(0)
+// @Param cursor query string true "起始游标，可为offset或上一页返回的next/prev" default(0)
 // @Param size query int true "返回记录数量" default(16)
 // @Param address path string true "Address" default(17SkEw2md5avVNyYgj6RiXuQKNwkXaxFyQ)
 // @Success 200 {object} model.Response{data=model.AddressUTXOResp} "{"code": 0, "data": {}, "msg": "ok"}"
 // @Security BearerAuth
 // @Router /address/{address}/utxo-data [get]
 func GetUtxoDataByAddress(ctx *gin.Context) {
-	logger.Log.Info("GetUtxoDataByAddress enter")
+	logger.Ctx(ctx).Info("GetUtxoDataByAddress enter")
 	GetUtxoDataByAddressCommon(ctx, true)
 }
 
@@ -68,34 +68,22 @@ func GetUtxoDataByAddress(ctx *gin.Context) {
 // @Summary 通过地址address获取相关常规utxo列表
 // @Tags UTXO
 // @Produce  json
-// @Param cursor query int true "起始游标" default(0)
+// @Param cursor query string true "起始游标，可为offset或上一页返回的next/prev" default(0)
 // @Param size query int true "返回记录数量" default(16)
 // @Param address path string true "Address" default(17SkEw2md5avVNyYgj6RiXuQKNwkXaxFyQ)
 // @Success 200 {object} model.Response{data=[]model.TxStandardOutResp} "{"code": 0, "data": [{}], "msg": "ok"}"
 // @Security BearerAuth
 // @Router /address/{address}/utxo [get]
 func GetUtxoByAddress(ctx *gin.Context) {
-	logger.Log.Info("GetUtxoByAddress enter")
+	logger.Ctx(ctx).Info("GetUtxoByAddress enter")
 	GetUtxoDataByAddressCommon(ctx, false)
 }
 
 func GetUtxoDataByAddressCommon(ctx *gin.Context, detail bool) {
-	logger.Log.Info("GetUtxoDataByAddressCommon enter")
-	// get cursor
-	cursorString := ctx.DefaultQuery("cursor", "0")
-	cursor, err := strconv.Atoi(cursorString)
-	if err != nil || cursor < 0 {
-		logger.Log.Info("cursor invalid", zap.Error(err))
-		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "cursor invalid"})
-		return
-	}
-
-	// get size
-	sizeString := ctx.DefaultQuery("size", "16")
-	size, err := strconv.Atoi(sizeString)
-	if err != nil || size <= 0 || cursor+size > MAX_UTXO_LIMIT {
-		logger.Log.Info("size invalid", zap.Error(err))
-		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "size invalid"})
+	logger.Ctx(ctx).Info("GetUtxoDataByAddressCommon enter")
+	// get cursor/size
+	page, ok := getPageParams(ctx, settings.Get().Limits.MaxUtxoSize, settings.Get().Limits.MaxUtxoSize)
+	if !ok {
 		return
 	}
 
@@ -103,14 +91,14 @@ func GetUtxoDataByAddressCommon(ctx *gin.Context, detail bool) {
 	// check
 	addressPkh, err := utils.DecodeAddress(address)
 	if err != nil {
-		logger.Log.Info("address invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("address invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "address invalid"})
 		return
 	}
 
-	result, total, totalConf, totalUnconf, totalUnconfSpend, err := service.GetUtxoByAddress(cursor, size, addressPkh)
+	result, next, prev, total, totalConf, totalUnconf, totalUnconfSpend, source, err := service.GetUtxoByAddress(ctx.Request.Context(), page, addressPkh)
 	if err != nil {
-		logger.Log.Info("get utxo failed", zap.Error(err))
+		logger.Ctx(ctx).Info("get utxo failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "get txo failed"})
 		return
 	}
@@ -120,19 +108,25 @@ func GetUtxoDataByAddressCommon(ctx *gin.Context, detail bool) {
 			Code: 0,
 			Msg:  "ok",
 			Data: &model.AddressUTXOResp{
-				Cursor:                cursor,
+				Cursor:                page.Offset,
 				Total:                 total,
 				TotalConfirmed:        totalConf,
 				TotalUnconfirmedNew:   totalUnconf,
 				TotalUnconfirmedSpend: totalUnconfSpend,
 				UTXO:                  result,
 			},
+			Next:   next,
+			Prev:   prev,
+			Source: source,
 		})
 	} else {
 		ctx.JSON(http.StatusOK, model.Response{
-			Code: 0,
-			Msg:  "ok",
-			Data: result,
+			Code:   0,
+			Msg:    "ok",
+			Data:   result,
+			Next:   next,
+			Prev:   prev,
+			Source: source,
 		})
 	}
 }
@@ -149,20 +143,20 @@ func GetUtxoDataByAddressCommon(ctx *gin.Context, detail bool) {
 // @Security BearerAuth
 // @Router /nft/utxo-list/{codehash}/{genesis} [get]
 func GetNFTUtxoList(ctx *gin.Context) {
-	logger.Log.Info("GetNFTUtxoList enter")
+	logger.Ctx(ctx).Info("GetNFTUtxoList enter")
 
 	// get cursor/size
 	cursorString := ctx.DefaultQuery("cursor", "0")
 	cursor, err := strconv.Atoi(cursorString)
 	if err != nil || cursor < 0 {
-		logger.Log.Info("cursor invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("cursor invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "cursor invalid"})
 		return
 	}
 	sizeString := ctx.DefaultQuery("size", "16")
 	size, err := strconv.Atoi(sizeString)
-	if err != nil || size <= 0 || size > MAX_UTXO_LIMIT {
-		logger.Log.Info("size invalid", zap.Error(err))
+	if err != nil || size <= 0 || size > settings.Get().Limits.MaxUtxoSize {
+		logger.Ctx(ctx).Info("size invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "size invalid"})
 		return
 	}
@@ -171,7 +165,7 @@ func GetNFTUtxoList(ctx *gin.Context) {
 	// check
 	codeHash, err := hex.DecodeString(codeHashHex)
 	if err != nil {
-		logger.Log.Info("codeHash invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("codeHash invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "codeHash invalid"})
 		return
 	}
@@ -180,14 +174,14 @@ func GetNFTUtxoList(ctx *gin.Context) {
 	// check
 	genesisId, err := hex.DecodeString(genesisIdHex)
 	if err != nil {
-		logger.Log.Info("genesisId invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("genesisId invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "genesisId invalid"})
 		return
 	}
 
-	result, total, totalConf, totalUnconf, err := service.GetNFTUtxoByTokenIndexRange(cursor, size, codeHash, genesisId)
+	result, total, totalConf, totalUnconf, err := service.GetNFTUtxoByTokenIndexRange(ctx.Request.Context(), cursor, size, codeHash, genesisId)
 	if err != nil {
-		logger.Log.Info("get nft utxo failed", zap.Error(err))
+		logger.Ctx(ctx).Info("get nft utxo failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "get nft utxo failed"})
 		return
 	}
@@ -217,13 +211,13 @@ func GetNFTUtxoList(ctx *gin.Context) {
 // @Security BearerAuth
 // @Router /nft/utxo-detail/{codehash}/{genesis}/{token_index} [get]
 func GetNFTUtxoDetailByTokenIndex(ctx *gin.Context) {
-	logger.Log.Info("GetNFTUtxoDetailByTokenIndex enter")
+	logger.Ctx(ctx).Info("GetNFTUtxoDetailByTokenIndex enter")
 
 	codeHashHex := ctx.Param("codehash")
 	// check
 	codeHash, err := hex.DecodeString(codeHashHex)
 	if err != nil {
-		logger.Log.Info("codeHash invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("codeHash invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "codeHash invalid"})
 		return
 	}
@@ -232,7 +226,7 @@ func GetNFTUtxoDetailByTokenIndex(ctx *gin.Context) {
 	// check
 	genesisId, err := hex.DecodeString(genesisIdHex)
 	if err != nil {
-		logger.Log.Info("genesisId invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("genesisId invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "genesisId invalid"})
 		return
 	}
@@ -240,14 +234,14 @@ func GetNFTUtxoDetailByTokenIndex(ctx *gin.Context) {
 	tokenIndexString := ctx.Param("token_index")
 	tokenIndex, err := strconv.Atoi(tokenIndexString)
 	if err != nil || tokenIndex < 0 {
-		logger.Log.Info("tokenIndex invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("tokenIndex invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "tokenIndex invalid"})
 		return
 	}
 
-	result, err := service.GetUtxoByTokenIndex(codeHash, genesisId, tokenIndexString)
+	result, err := service.GetUtxoByTokenIndex(ctx.Request.Context(), codeHash, genesisId, tokenIndexString)
 	if err != nil {
-		logger.Log.Info("get nft utxo detail failed", zap.Error(err))
+		logger.Ctx(ctx).Info("get nft utxo detail failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "get txo failed"})
 		return
 	}
@@ -263,7 +257,7 @@ func GetNFTUtxoDetailByTokenIndex(ctx *gin.Context) {
 // @Summary 通过FT合约CodeHash+溯源genesis获取某地址的utxo列表，和数量信息
 // @Tags UTXO, token FT
 // @Produce  json
-// @Param cursor query int true "起始游标" default(0)
+// @Param cursor query string true "起始游标，可为offset或上一页返回的next/prev" default(0)
 // @Param size query int true "返回记录数量" default(10)
 // @Param codehash path string true "Code Hash160" default(844c56bb99afc374967a27ce3b46244e2e1fba60)
 // @Param genesis path string true "Genesis ID" default(74967a27ce3b46244e2e1fba60844c56bb99afc3)
@@ -272,7 +266,7 @@ func GetNFTUtxoDetailByTokenIndex(ctx *gin.Context) {
 // @Security BearerAuth
 // @Router /ft/utxo-data/{codehash}/{genesis}/{address} [get]
 func GetFTUtxoData(ctx *gin.Context) {
-	logger.Log.Info("GetFTUtxoData enter")
+	logger.Ctx(ctx).Info("GetFTUtxoData enter")
 	GetUtxoByCodeHashGenesisAddress(ctx, "fu", true)
 }
 
@@ -280,7 +274,7 @@ func GetFTUtxoData(ctx *gin.Context) {
 // @Summary 通过NFT合约CodeHash+溯源genesis获取某地址的utxo列表，和数量信息
 // @Tags UTXO, token NFT
 // @Produce  json
-// @Param cursor query int true "起始游标" default(0)
+// @Param cursor query string true "起始游标，可为offset或上一页返回的next/prev" default(0)
 // @Param size query int true "返回记录数量" default(10)
 // @Param codehash path string true "Code Hash160" default(844c56bb99afc374967a27ce3b46244e2e1fba60)
 // @Param genesis path string true "Genesis ID" default(74967a27ce3b46244e2e1fba60844c56bb99afc3)
@@ -289,7 +283,7 @@ func GetFTUtxoData(ctx *gin.Context) {
 // @Security BearerAuth
 // @Router /nft/utxo-data/{codehash}/{genesis}/{address} [get]
 func GetNFTUtxoData(ctx *gin.Context) {
-	logger.Log.Info("GetNFTUtxoData enter")
+	logger.Ctx(ctx).Info("GetNFTUtxoData enter")
 	GetUtxoByCodeHashGenesisAddress(ctx, "nu", true)
 }
 
@@ -297,7 +291,7 @@ func GetNFTUtxoData(ctx *gin.Context) {
 // @Summary 通过FT合约CodeHash+溯源genesis获取某地址的utxo列表
 // @Tags UTXO, token FT
 // @Produce  json
-// @Param cursor query int true "起始游标" default(0)
+// @Param cursor query string true "起始游标，可为offset或上一页返回的next/prev" default(0)
 // @Param size query int true "返回记录数量" default(10)
 // @Param codehash path string true "Code Hash160" default(844c56bb99afc374967a27ce3b46244e2e1fba60)
 // @Param genesis path string true "Genesis ID" default(74967a27ce3b46244e2e1fba60844c56bb99afc3)
@@ -306,7 +300,7 @@ func GetNFTUtxoData(ctx *gin.Context) {
 // @Security BearerAuth
 // @Router /ft/utxo/{codehash}/{genesis}/{address} [get]
 func GetFTUtxo(ctx *gin.Context) {
-	logger.Log.Info("GetFTUtxo enter")
+	logger.Ctx(ctx).Info("GetFTUtxo enter")
 	GetUtxoByCodeHashGenesisAddress(ctx, "fu", false)
 }
 
@@ -314,7 +308,7 @@ func GetFTUtxo(ctx *gin.Context) {
 // @Summary 通过NFT合约CodeHash+溯源genesis获取某地址的utxo列表
 // @Tags UTXO, token NFT
 // @Produce  json
-// @Param cursor query int true "起始游标" default(0)
+// @Param cursor query string true "起始游标，可为offset或上一页返回的next/prev" default(0)
 // @Param size query int true "返回记录数量" default(10)
 // @Param codehash path string true "Code Hash160" default(844c56bb99afc374967a27ce3b46244e2e1fba60)
 // @Param genesis path string true "Genesis ID" default(74967a27ce3b46244e2e1fba60844c56bb99afc3)
@@ -323,26 +317,16 @@ func GetFTUtxo(ctx *gin.Context) {
 // @Security BearerAuth
 // @Router /nft/utxo/{codehash}/{genesis}/{address} [get]
 func GetNFTUtxo(ctx *gin.Context) {
-	logger.Log.Info("GetNFTUtxo enter")
+	logger.Ctx(ctx).Info("GetNFTUtxo enter")
 	GetUtxoByCodeHashGenesisAddress(ctx, "nu", false)
 }
 
 func GetUtxoByCodeHashGenesisAddress(ctx *gin.Context, key string, detail bool) {
-	logger.Log.Info("GetUtxoByCodeHashGenesisAddress enter")
+	logger.Ctx(ctx).Info("GetUtxoByCodeHashGenesisAddress enter")
 
 	// get cursor/size
-	cursorString := ctx.DefaultQuery("cursor", "0")
-	cursor, err := strconv.Atoi(cursorString)
-	if err != nil || cursor < 0 {
-		logger.Log.Info("cursor invalid", zap.Error(err))
-		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "cursor invalid"})
-		return
-	}
-	sizeString := ctx.DefaultQuery("size", "16")
-	size, err := strconv.Atoi(sizeString)
-	if err != nil || size <= 0 || cursor+size > MAX_UTXO_LIMIT {
-		logger.Log.Info("size invalid", zap.Error(err))
-		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "size invalid"})
+	page, ok := getPageParams(ctx, settings.Get().Limits.MaxUtxoSize, settings.Get().Limits.MaxUtxoSize)
+	if !ok {
 		return
 	}
 
@@ -350,7 +334,7 @@ func GetUtxoByCodeHashGenesisAddress(ctx *gin.Context, key string, detail bool)
 	// check
 	codeHash, err := hex.DecodeString(codeHashHex)
 	if err != nil {
-		logger.Log.Info("codeHash invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("codeHash invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "codeHash invalid"})
 		return
 	}
@@ -359,7 +343,7 @@ func GetUtxoByCodeHashGenesisAddress(ctx *gin.Context, key string, detail bool)
 	// check
 	genesisId, err := hex.DecodeString(genesisIdHex)
 	if err != nil {
-		logger.Log.Info("genesisId invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("genesisId invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "genesisId invalid"})
 		return
 	}
@@ -368,14 +352,14 @@ func GetUtxoByCodeHashGenesisAddress(ctx *gin.Context, key string, detail bool)
 	// check
 	addressPkh, err := utils.DecodeAddress(address)
 	if err != nil {
-		logger.Log.Info("address invalid", zap.Error(err))
+		logger.Ctx(ctx).Info("address invalid", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "address invalid"})
 		return
 	}
 
-	result, total, totalConf, totalUnconf, totalUnconfSpend, err := service.GetUtxoByCodeHashGenesisAddress(cursor, size, codeHash, genesisId, addressPkh, key)
+	result, next, prev, total, totalConf, totalUnconf, totalUnconfSpend, source, err := service.GetUtxoByCodeHashGenesisAddress(ctx.Request.Context(), page, codeHash, genesisId, addressPkh, key)
 	if err != nil {
-		logger.Log.Info("get token utxo failed", zap.Error(err))
+		logger.Ctx(ctx).Info("get token utxo failed", zap.Error(err))
 		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "get txo failed"})
 		return
 	}
@@ -385,20 +369,26 @@ func GetUtxoByCodeHashGenesisAddress(ctx *gin.Context, key string, detail bool)
 			Code: 0,
 			Msg:  "ok",
 			Data: &model.AddressTokenUTXOResp{
-				Cursor:                cursor,
+				Cursor:                page.Offset,
 				Total:                 total,
 				TotalConfirmed:        totalConf,
 				TotalUnconfirmedNew:   totalUnconf,
 				TotalUnconfirmedSpend: totalUnconfSpend,
 				UTXO:                  result,
 			},
+			Next:   next,
+			Prev:   prev,
+			Source: source,
 		})
 
 	} else {
 		ctx.JSON(http.StatusOK, model.Response{
-			Code: 0,
-			Msg:  "ok",
-			Data: result,
+			Code:   0,
+			Msg:    "ok",
+			Data:   result,
+			Next:   next,
+			Prev:   prev,
+			Source: source,
 		})
 	}
 }
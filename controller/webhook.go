@@ -0,0 +1,189 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"sensiblequery/logger"
+	"sensiblequery/model"
+	"sensiblequery/service"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+func adminWebhookResponse(ctx *gin.Context, result *model.WebhookResp, err error) {
+	if err == service.ErrWebhookNotExist {
+		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "webhook not exist"})
+		return
+	} else if err != nil {
+		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: err.Error()})
+		return
+	}
+	ctx.JSON(http.StatusOK, model.Response{
+		Code: 0,
+		Msg:  "ok",
+		Data: result,
+	})
+}
+
+// AdminCreateWebhook
+// @Summary 注册webhook，签名密钥仅返回一次
+// @Tags Admin
+// @Produce json
+// @Param body body model.WebhookReq true "webhook info"
+// @Success 200 {object} model.Response{data=model.WebhookResp} "{"code": 0, "data": {}, "msg": "ok"}"
+// @Security BearerAuth
+// @Router /admin/webhooks [post]
+func AdminCreateWebhook(ctx *gin.Context) {
+	logger.Ctx(ctx).Info("AdminCreateWebhook enter")
+
+	req := model.WebhookReq{}
+	if err := ctx.BindJSON(&req); err != nil {
+		logger.Ctx(ctx).Info("Bind json failed", zap.Error(err))
+		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "json error"})
+		return
+	}
+
+	result, err := service.CreateWebhook(ctx.Request.Context(), &req)
+	if err == nil {
+		service.AddAdminAudit(ctx.Request.Context(), "webhook_create", result.Id,
+			fmt.Sprintf("type=%s url=%s label=%s", req.Type, req.Url, req.Label), ctx.ClientIP())
+	}
+	adminWebhookResponse(ctx, result, err)
+}
+
+// AdminGetWebhook
+// @Summary 查询webhook
+// @Tags Admin
+// @Produce json
+// @Param id path string true "webhook id"
+// @Success 200 {object} model.Response{data=model.WebhookResp} "{"code": 0, "data": {}, "msg": "ok"}"
+// @Security BearerAuth
+// @Router /admin/webhooks/{id} [get]
+func AdminGetWebhook(ctx *gin.Context) {
+	logger.Ctx(ctx).Info("AdminGetWebhook enter")
+
+	result, err := service.GetWebhook(ctx.Request.Context(), ctx.Param("id"))
+	adminWebhookResponse(ctx, result, err)
+}
+
+// AdminListWebhooks
+// @Summary 按注册时间倒序列出webhook
+// @Tags Admin
+// @Produce json
+// @Param cursor query int false "起始游标" default(0)
+// @Param size query int false "返回记录数量" default(100)
+// @Success 200 {object} model.Response{data=[]model.WebhookResp} "{"code": 0, "data": [{}], "msg": "ok"}"
+// @Security BearerAuth
+// @Router /admin/webhooks [get]
+func AdminListWebhooks(ctx *gin.Context) {
+	logger.Ctx(ctx).Info("AdminListWebhooks enter")
+
+	cursor, size, ok := getAdminListParams(ctx)
+	if !ok {
+		return
+	}
+
+	result, total, err := service.ListWebhooks(ctx.Request.Context(), cursor, size)
+	if err != nil {
+		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "list webhooks failed"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, model.Response{
+		Code: 0,
+		Msg:  "ok",
+		Data: map[string]interface{}{
+			"cursor":   cursor,
+			"total":    total,
+			"webhooks": result,
+		},
+	})
+}
+
+// AdminDeleteWebhook
+// @Summary 删除webhook，停止检测，未投递的事件不再投递
+// @Tags Admin
+// @Produce json
+// @Param id path string true "webhook id"
+// @Success 200 {object} model.Response "{"code": 0, "msg": "ok"}"
+// @Security BearerAuth
+// @Router /admin/webhooks/{id}/delete [post]
+func AdminDeleteWebhook(ctx *gin.Context) {
+	logger.Ctx(ctx).Info("AdminDeleteWebhook enter")
+
+	id := ctx.Param("id")
+	err := service.DeleteWebhook(ctx.Request.Context(), id)
+	if err == service.ErrWebhookNotExist {
+		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "webhook not exist"})
+		return
+	} else if err != nil {
+		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "delete webhook failed"})
+		return
+	}
+	service.AddAdminAudit(ctx.Request.Context(), "webhook_delete", id, "", ctx.ClientIP())
+
+	ctx.JSON(http.StatusOK, model.Response{
+		Code: 0,
+		Msg:  "ok",
+	})
+}
+
+// AdminListWebhookDead
+// @Summary 按失败时间倒序列出重试次数用尽的投递
+// @Tags Admin
+// @Produce json
+// @Param cursor query int false "起始游标" default(0)
+// @Param size query int false "返回记录数量" default(100)
+// @Param webhook query string false "只返回该webhook的投递"
+// @Success 200 {object} model.Response{data=[]model.WebhookDeliveryResp} "{"code": 0, "data": [{}], "msg": "ok"}"
+// @Security BearerAuth
+// @Router /admin/webhook-dead [get]
+func AdminListWebhookDead(ctx *gin.Context) {
+	logger.Ctx(ctx).Info("AdminListWebhookDead enter")
+
+	cursor, size, ok := getAdminListParams(ctx)
+	if !ok {
+		return
+	}
+
+	result, total, err := service.ListWebhookDead(ctx.Request.Context(), cursor, size, ctx.Query("webhook"))
+	if err != nil {
+		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: "list deliveries failed"})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, model.Response{
+		Code: 0,
+		Msg:  "ok",
+		Data: map[string]interface{}{
+			"cursor":     cursor,
+			"total":      total,
+			"deliveries": result,
+		},
+	})
+}
+
+// AdminReplayWebhookDead
+// @Summary 重新投递重试次数用尽的投递，重试次数清零
+// @Tags Admin
+// @Produce json
+// @Param delivery path string true "delivery id"
+// @Success 200 {object} model.Response "{"code": 0, "msg": "ok"}"
+// @Security BearerAuth
+// @Router /admin/webhook-dead/{delivery}/replay [post]
+func AdminReplayWebhookDead(ctx *gin.Context) {
+	logger.Ctx(ctx).Info("AdminReplayWebhookDead enter")
+
+	deliveryId := ctx.Param("delivery")
+	if err := service.ReplayWebhookDead(ctx.Request.Context(), deliveryId); err != nil {
+		ctx.JSON(http.StatusOK, model.Response{Code: -1, Msg: err.Error()})
+		return
+	}
+	service.AddAdminAudit(ctx.Request.Context(), "webhook_replay", deliveryId, "", ctx.ClientIP())
+
+	ctx.JSON(http.StatusOK, model.Response{
+		Code: 0,
+		Msg:  "ok",
+	})
+}
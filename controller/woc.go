@@ -0,0 +1,563 @@
+package controller
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"sensiblequery/lib/electrum"
+	"sensiblequery/lib/utils"
+	"sensiblequery/logger"
+	"sensiblequery/model"
+	"sensiblequery/service"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	wocBlockTxLimit = 1000  // 区块详情中最多返回的txid数
+	wocBlockPage    = 50000 // 区块txid分页大小
+	wocBulkTxLimit  = 20    // 批量查询交易的最大数量
+)
+
+// wocBlockHeader 节点getblockheader verbose的返回
+type wocBlockHeader struct {
+	Confirmations int     `json:"confirmations"`
+	Version       int     `json:"version"`
+	VersionHex    string  `json:"versionHex"`
+	MedianTime    int     `json:"mediantime"`
+	Nonce         int64   `json:"nonce"`
+	Bits          string  `json:"bits"`
+	Difficulty    float64 `json:"difficulty"`
+	Chainwork     string  `json:"chainwork"`
+}
+
+// wocError 与WhatsOnChain一致，错误时返回HTTP状态码和纯文本
+func wocError(ctx *gin.Context, status int, msg string) {
+	ctx.String(status, msg)
+	ctx.Abort()
+}
+
+func wocServiceError(ctx *gin.Context, err error) {
+	if errors.Is(err, service.ErrHistoryTooLarge) {
+		wocError(ctx, http.StatusBadRequest, err.Error())
+		return
+	}
+	wocError(ctx, http.StatusInternalServerError, "query failed")
+}
+
+// WocCheckNetwork 只服务当前节点所在的网络，main或test
+func WocCheckNetwork(ctx *gin.Context) {
+	network := "main"
+	if is_testnet != "" {
+		network = "test"
+	}
+	if ctx.Param("network") != network {
+		wocError(ctx, http.StatusNotFound, "network not supported")
+		return
+	}
+	ctx.Next()
+}
+
+// wocTxId 解析txid参数，返回内部字节序
+func wocTxId(txIdHex string) ([]byte, bool) {
+	txIdReverse, err := hex.DecodeString(txIdHex)
+	if err != nil || len(txIdReverse) != 32 {
+		return nil, false
+	}
+	return utils.ReverseBytes(txIdReverse), true
+}
+
+func getWocBlockHeader(ctx context.Context, blkIdHex string) (*wocBlockHeader, error) {
+	response, err := rpcCall(ctx, "getblockheader", blkIdHex, true)
+	if err != nil {
+		return nil, err
+	}
+	if response.Error != nil {
+		return nil, response.Error
+	}
+	header := &wocBlockHeader{}
+	if err := response.GetObject(header); err != nil {
+		return nil, err
+	}
+	return header, nil
+}
+
+// WocStatus GET /woc
+func WocStatus(ctx *gin.Context) {
+	ctx.String(http.StatusOK, "Whats On Chain")
+}
+
+// getChainInfo 区块高度以索引为准，难度和chainwork来自节点
+func getChainInfo(ctx context.Context) (*model.ChainInfoResp, error) {
+	bestHeight, err := service.GetBestBlockHeight(ctx)
+	if err != nil {
+		return nil, err
+	}
+	blk, err := service.GetBestBlockByHeight(ctx, bestHeight)
+	if err != nil {
+		return nil, err
+	}
+	header, err := getWocBlockHeader(ctx, blk.BlockIdHex)
+	if err != nil {
+		return nil, err
+	}
+
+	chain := "main"
+	if is_testnet != "" {
+		chain = "test"
+	}
+	return &model.ChainInfoResp{
+		Chain:                chain,
+		Blocks:               bestHeight,
+		Headers:              bestHeight,
+		BestBlockHash:        blk.BlockIdHex,
+		Difficulty:           header.Difficulty,
+		MedianTime:           header.MedianTime,
+		VerificationProgress: 1,
+		Chainwork:            header.Chainwork,
+	}, nil
+}
+
+// WocGetChainInfo GET /chain/info
+func WocGetChainInfo(ctx *gin.Context) {
+	logger.Ctx(ctx).Info("WocGetChainInfo enter")
+
+	info, err := getChainInfo(ctx.Request.Context())
+	if err != nil {
+		logger.Ctx(ctx).Info("get chain info failed", zap.Error(err))
+		wocError(ctx, http.StatusInternalServerError, "get chain info failed")
+		return
+	}
+	ctx.JSON(http.StatusOK, info)
+}
+
+func wocBlock(ctx *gin.Context, blk *model.BlockInfoResp) {
+	header, err := getWocBlockHeader(ctx.Request.Context(), blk.BlockIdHex)
+	if err != nil {
+		logger.Ctx(ctx).Info("get block header failed", zap.Error(err))
+		wocError(ctx, http.StatusInternalServerError, "rpc failed")
+		return
+	}
+	txids, err := service.GetBlockTxIdsRange(ctx.Request.Context(), blk.Height, 0, wocBlockTxLimit)
+	if err != nil {
+		logger.Ctx(ctx).Info("get block txs failed", zap.Error(err))
+		wocError(ctx, http.StatusInternalServerError, "query failed")
+		return
+	}
+
+	blkRsp := &model.WocBlockResp{
+		Hash:              blk.BlockIdHex,
+		Confirmations:     header.Confirmations,
+		Size:              blk.BlockSize,
+		Height:            blk.Height,
+		Version:           header.Version,
+		VersionHex:        header.VersionHex,
+		MerkleRoot:        blk.MerkleRootHex,
+		TxCount:           blk.TxCount,
+		Tx:                make([]string, 0, len(txids)),
+		Time:              blk.BlockTime,
+		MedianTime:        header.MedianTime,
+		Nonce:             header.Nonce,
+		Bits:              header.Bits,
+		Difficulty:        header.Difficulty,
+		Chainwork:         header.Chainwork,
+		PreviousBlockHash: blk.PrevBlockIdHex,
+		NextBlockHash:     blk.NextBlockIdHex,
+	}
+	if blk.Height == 0 {
+		blkRsp.PreviousBlockHash = ""
+	}
+	if blk.NextBlockIdHex == hex.EncodeToString(make([]byte, 32)) {
+		blkRsp.NextBlockHash = ""
+	}
+	for _, txid := range txids {
+		blkRsp.Tx = append(blkRsp.Tx, hex.EncodeToString(utils.ReverseBytes(txid)))
+	}
+	if blk.TxCount > wocBlockTxLimit {
+		blkRsp.Pages = &model.WocBlockPagesResp{Size: wocBlockPage}
+		for page := 1; (page-1)*wocBlockPage < blk.TxCount; page++ {
+			blkRsp.Pages.Uri = append(blkRsp.Pages.Uri, fmt.Sprintf("/block/hash/%s/page/%d", blk.BlockIdHex, page))
+		}
+	}
+	ctx.JSON(http.StatusOK, blkRsp)
+}
+
+func wocGetBlockByHash(ctx *gin.Context) (*model.BlockInfoResp, bool) {
+	blkId, ok := wocTxId(ctx.Param("hash"))
+	if !ok {
+		wocError(ctx, http.StatusBadRequest, "hash invalid")
+		return nil, false
+	}
+	blk, err := service.GetBlockById(ctx.Request.Context(), hex.EncodeToString(blkId))
+	if err != nil {
+		logger.Ctx(ctx).Info("get block failed", zap.Error(err))
+		wocError(ctx, http.StatusNotFound, "block not found")
+		return nil, false
+	}
+	return blk, true
+}
+
+// WocGetBlockByHash GET /block/hash/{hash}
+func WocGetBlockByHash(ctx *gin.Context) {
+	logger.Ctx(ctx).Info("WocGetBlockByHash enter")
+
+	blk, ok := wocGetBlockByHash(ctx)
+	if !ok {
+		return
+	}
+	wocBlock(ctx, blk)
+}
+
+// WocGetBlockByHeight GET /block/height/{height}
+func WocGetBlockByHeight(ctx *gin.Context) {
+	logger.Ctx(ctx).Info("WocGetBlockByHeight enter")
+
+	blkHeight, err := strconv.Atoi(ctx.Param("height"))
+	if err != nil || blkHeight < 0 {
+		wocError(ctx, http.StatusBadRequest, "height invalid")
+		return
+	}
+	blk, err := service.GetBlockByHeight(ctx.Request.Context(), blkHeight)
+	if err != nil {
+		logger.Ctx(ctx).Info("get block failed", zap.Error(err))
+		wocError(ctx, http.StatusNotFound, "block not found")
+		return
+	}
+	wocBlock(ctx, blk)
+}
+
+// WocGetBlockPage GET /block/hash/{hash}/page/{page}，页码从1开始
+func WocGetBlockPage(ctx *gin.Context) {
+	logger.Ctx(ctx).Info("WocGetBlockPage enter")
+
+	page, err := strconv.Atoi(ctx.Param("page"))
+	if err != nil || page < 1 {
+		wocError(ctx, http.StatusBadRequest, "page invalid")
+		return
+	}
+	blk, ok := wocGetBlockByHash(ctx)
+	if !ok {
+		return
+	}
+	if (page-1)*wocBlockPage >= blk.TxCount {
+		wocError(ctx, http.StatusNotFound, "page not found")
+		return
+	}
+	txids, err := service.GetBlockTxIdsRange(ctx.Request.Context(), blk.Height, (page-1)*wocBlockPage, wocBlockPage)
+	if err != nil {
+		logger.Ctx(ctx).Info("get block txs failed", zap.Error(err))
+		wocError(ctx, http.StatusInternalServerError, "query failed")
+		return
+	}
+	txidsRsp := make([]string, 0, len(txids))
+	for _, txid := range txids {
+		txidsRsp = append(txidsRsp, hex.EncodeToString(utils.ReverseBytes(txid)))
+	}
+	ctx.JSON(http.StatusOK, txidsRsp)
+}
+
+// getWocTx 节点decoderawtransaction解析索引中的原始交易，并补充区块信息
+func getVerboseTx(ctx context.Context, txId []byte) (map[string]interface{}, error) {
+	txIdHex := hex.EncodeToString(txId)
+	tx, err := service.GetTxById(ctx, txIdHex)
+	if err != nil {
+		return nil, err
+	}
+	rawtx, err := service.GetRawTxById(ctx, txIdHex)
+	if err != nil {
+		return nil, err
+	}
+	rawtxHex := hex.EncodeToString(rawtx)
+	response, err := rpcCall(ctx, "decoderawtransaction", rawtxHex)
+	if err != nil {
+		return nil, err
+	}
+	if response.Error != nil {
+		return nil, response.Error
+	}
+	txRsp := map[string]interface{}{}
+	if err := response.GetObject(&txRsp); err != nil {
+		return nil, err
+	}
+	txRsp["hex"] = rawtxHex
+	if tx.Height != 4294967295 {
+		txRsp["blockhash"] = tx.BlockIdHex
+		txRsp["blockheight"] = tx.Height
+		txRsp["blocktime"] = tx.BlockTime
+		txRsp["time"] = tx.BlockTime
+		txRsp["confirmations"] = tx.Confirmations
+	}
+	return txRsp, nil
+}
+
+// WocGetTxByHash GET /tx/hash/{txid}
+func WocGetTxByHash(ctx *gin.Context) {
+	logger.Ctx(ctx).Info("WocGetTxByHash enter")
+
+	txId, ok := wocTxId(ctx.Param("txid"))
+	if !ok {
+		wocError(ctx, http.StatusBadRequest, "txid invalid")
+		return
+	}
+	txRsp, err := getVerboseTx(ctx.Request.Context(), txId)
+	if err != nil {
+		logger.Ctx(ctx).Info("get tx failed", zap.Error(err))
+		wocError(ctx, http.StatusNotFound, "tx not found")
+		return
+	}
+	ctx.JSON(http.StatusOK, txRsp)
+}
+
+type WocTxsRequest struct {
+	TxIds []string `json:"txids"`
+}
+
+// WocGetTxs POST /txs，最多20个，查不到的返回{"txid": ..., "error": "unknown"}
+func WocGetTxs(ctx *gin.Context) {
+	logger.Ctx(ctx).Info("WocGetTxs enter")
+
+	req := WocTxsRequest{}
+	if err := ctx.BindJSON(&req); err != nil {
+		logger.Ctx(ctx).Info("Bind json failed", zap.Error(err))
+		wocError(ctx, http.StatusBadRequest, "json error")
+		return
+	}
+	if len(req.TxIds) > wocBulkTxLimit {
+		wocError(ctx, http.StatusBadRequest, fmt.Sprintf("at most %d txids", wocBulkTxLimit))
+		return
+	}
+
+	txsRsp := make([]map[string]interface{}, 0, len(req.TxIds))
+	for _, txIdHex := range req.TxIds {
+		txId, ok := wocTxId(txIdHex)
+		if !ok {
+			txsRsp = append(txsRsp, map[string]interface{}{"txid": txIdHex, "error": "unknown"})
+			continue
+		}
+		txRsp, err := getVerboseTx(ctx.Request.Context(), txId)
+		if err != nil {
+			logger.Ctx(ctx).Info("get tx failed", zap.String("txid", txIdHex), zap.Error(err))
+			txsRsp = append(txsRsp, map[string]interface{}{"txid": txIdHex, "error": "unknown"})
+			continue
+		}
+		txsRsp = append(txsRsp, txRsp)
+	}
+	ctx.JSON(http.StatusOK, txsRsp)
+}
+
+// WocGetRawTx GET /tx/{txid}/hex
+func WocGetRawTx(ctx *gin.Context) {
+	logger.Ctx(ctx).Info("WocGetRawTx enter")
+
+	txId, ok := wocTxId(ctx.Param("txid"))
+	if !ok {
+		wocError(ctx, http.StatusBadRequest, "txid invalid")
+		return
+	}
+	rawtx, err := service.GetRawTxById(ctx.Request.Context(), hex.EncodeToString(txId))
+	if err != nil {
+		logger.Ctx(ctx).Info("get rawtx failed", zap.Error(err))
+		wocError(ctx, http.StatusNotFound, "tx not found")
+		return
+	}
+	ctx.String(http.StatusOK, hex.EncodeToString(rawtx))
+}
+
+type WocTxRequest struct {
+	TxHex string `json:"txhex"`
+}
+
+// WocPushRawTx POST /tx/raw，通过本地节点广播，返回txid
+func WocPushRawTx(ctx *gin.Context) {
+	logger.Ctx(ctx).Info("WocPushRawTx enter")
+
+	if indexLagRejectPush && service.IndexDegraded() {
+		wocError(ctx, http.StatusServiceUnavailable, "index lagging, try later")
+		return
+	}
+
+	req := WocTxRequest{}
+	if err := ctx.BindJSON(&req); err != nil {
+		logger.Ctx(ctx).Info("Bind json failed", zap.Error(err))
+		wocError(ctx, http.StatusBadRequest, "json error")
+		return
+	}
+	if _, err := hex.DecodeString(req.TxHex); err != nil || req.TxHex == "" {
+		wocError(ctx, http.StatusBadRequest, "tx invalid")
+		return
+	}
+
+	logger.Ctx(ctx).Info("send", zap.String("rawtx", req.TxHex))
+	response, err := rpcBroadcast(ctx.Request.Context(), "sendrawtransaction", req.TxHex)
+	if err != nil {
+		logger.Ctx(ctx).Info("call failed", zap.Error(err))
+		wocError(ctx, http.StatusInternalServerError, "rpc failed")
+		return
+	}
+	if response.Error != nil {
+		wocError(ctx, http.StatusBadRequest, fmt.Sprintf("%d: %s", response.Error.Code, response.Error.Message))
+		return
+	}
+	ctx.JSON(http.StatusOK, response.Result)
+}
+
+// WocGetAddressInfo GET /address/{address}/info
+func WocGetAddressInfo(ctx *gin.Context) {
+	logger.Ctx(ctx).Info("WocGetAddressInfo enter")
+
+	address := ctx.Param("address")
+	addressPkh, err := utils.DecodeAddress(address)
+	if err != nil {
+		ctx.JSON(http.StatusOK, &model.WocAddressInfoResp{})
+		return
+	}
+	ctx.JSON(http.StatusOK, &model.WocAddressInfoResp{
+		IsValid:      true,
+		Address:      address,
+		ScriptPubKey: hex.EncodeToString(electrum.P2PKHScript(addressPkh)),
+	})
+}
+
+func wocAddress(ctx *gin.Context) ([]byte, bool) {
+	addressPkh, err := utils.DecodeAddress(ctx.Param("address"))
+	if err != nil {
+		logger.Ctx(ctx).Info("address invalid", zap.Error(err))
+		wocError(ctx, http.StatusBadRequest, "address invalid")
+		return nil, false
+	}
+	return addressPkh, true
+}
+
+// WocGetAddressBalance GET /address/{address}/balance
+func WocGetAddressBalance(ctx *gin.Context) {
+	logger.Ctx(ctx).Info("WocGetAddressBalance enter")
+
+	addressPkh, ok := wocAddress(ctx)
+	if !ok {
+		return
+	}
+	balance, _, err := service.GetBalanceByAddress(ctx.Request.Context(), addressPkh)
+	if err != nil {
+		logger.Ctx(ctx).Info("get balance failed", zap.Error(err))
+		wocServiceError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, &model.ElectrumBalanceResp{Confirmed: balance.Satoshi, Unconfirmed: balance.PendingSatoshi})
+}
+
+// WocGetAddressHistory GET /address/{address}/history，mempool中的交易height为0或-1
+func WocGetAddressHistory(ctx *gin.Context) {
+	logger.Ctx(ctx).Info("WocGetAddressHistory enter")
+
+	addressPkh, ok := wocAddress(ctx)
+	if !ok {
+		return
+	}
+	history, err := service.GetAddressElectrumHistory(ctx.Request.Context(), addressPkh)
+	if err != nil {
+		logger.Ctx(ctx).Info("get history failed", zap.Error(err))
+		wocServiceError(ctx, err)
+		return
+	}
+	if history == nil {
+		history = []*electrum.HistoryItem{}
+	}
+	ctx.JSON(http.StatusOK, history)
+}
+
+// WocGetAddressUnspent GET /address/{address}/unspent
+func WocGetAddressUnspent(ctx *gin.Context) {
+	logger.Ctx(ctx).Info("WocGetAddressUnspent enter")
+
+	addressPkh, ok := wocAddress(ctx)
+	if !ok {
+		return
+	}
+	utxos, err := service.ListAddressElectrumUnspent(ctx.Request.Context(), addressPkh)
+	if err != nil {
+		logger.Ctx(ctx).Info("get utxo failed", zap.Error(err))
+		wocServiceError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, utxos)
+}
+
+func wocScriptHash(ctx *gin.Context) ([]byte, bool) {
+	if !service.ElectrumConf.Enabled {
+		wocError(ctx, http.StatusNotFound, "scripthash index disabled")
+		return nil, false
+	}
+	digest, err := electrum.ParseScriptHash(ctx.Param("scripthash"))
+	if err != nil {
+		wocError(ctx, http.StatusBadRequest, "scripthash invalid")
+		return nil, false
+	}
+	return digest, true
+}
+
+// WocGetScriptHistory GET /script/{scripthash}/history，需要electrum.yaml启用scripthash索引
+func WocGetScriptHistory(ctx *gin.Context) {
+	logger.Ctx(ctx).Info("WocGetScriptHistory enter")
+
+	digest, ok := wocScriptHash(ctx)
+	if !ok {
+		return
+	}
+	history, err := service.GetScriptHashHistory(ctx.Request.Context(), digest)
+	if err != nil {
+		logger.Ctx(ctx).Info("get history failed", zap.Error(err))
+		wocServiceError(ctx, err)
+		return
+	}
+	if history == nil {
+		history = []*electrum.HistoryItem{}
+	}
+	ctx.JSON(http.StatusOK, history)
+}
+
+// WocGetScriptUnspent GET /script/{scripthash}/unspent
+func WocGetScriptUnspent(ctx *gin.Context) {
+	logger.Ctx(ctx).Info("WocGetScriptUnspent enter")
+
+	digest, ok := wocScriptHash(ctx)
+	if !ok {
+		return
+	}
+	utxos, err := service.ListScriptHashUnspent(ctx.Request.Context(), digest)
+	if err != nil {
+		logger.Ctx(ctx).Info("get utxo failed", zap.Error(err))
+		wocServiceError(ctx, err)
+		return
+	}
+	ctx.JSON(http.StatusOK, utxos)
+}
+
+func wocRpcPassthrough(ctx *gin.Context, method string) {
+	response, err := rpcCall(ctx.Request.Context(), method)
+	if err != nil {
+		logger.Ctx(ctx).Info("call failed", zap.Error(err))
+		wocError(ctx, http.StatusInternalServerError, "rpc failed")
+		return
+	}
+	if response.Error != nil {
+		wocError(ctx, http.StatusInternalServerError, response.Error.Message)
+		return
+	}
+	ctx.JSON(http.StatusOK, response.Result)
+}
+
+// WocGetMempoolInfo GET /mempool/info
+func WocGetMempoolInfo(ctx *gin.Context) {
+	logger.Ctx(ctx).Info("WocGetMempoolInfo enter")
+	wocRpcPassthrough(ctx, "getmempoolinfo")
+}
+
+// WocGetMempoolRaw GET /mempool/raw
+func WocGetMempoolRaw(ctx *gin.Context) {
+	logger.Ctx(ctx).Info("WocGetMempoolRaw enter")
+	wocRpcPassthrough(ctx, "getrawmempool")
+}
@@ -1,7 +1,14 @@
 package clickhouse
 
 import (
+	"context"
 	"database/sql"
+	"sensiblequery/lib/metrics"
+	"sensiblequery/lib/tracing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const InitialCapacity = 256
@@ -11,51 +18,150 @@ type ScanRowsFunc func(rows *sql.Rows) (interface{}, error)
 
 type Operation interface {
 	// 用户自定义解析过程
-	Scan(psql string, srf ScanRowsFunc, args ...interface{}) (ret interface{}, err error)
+	Scan(ctx context.Context, psql string, srf ScanRowsFunc, args ...interface{}) (ret interface{}, err error)
 	// 根据第一条数据反射结果, 要求首条数据结果不能为nil.
-	ScanAll(psql string, srf ScanRowFunc, args ...interface{}) (ret interface{}, err error)
-	ScanOne2(psql string, ret interface{}, args ...interface{}) (ok bool, err error)
-	ScanOne(psql string, srf ScanRowFunc, args ...interface{}) (ret interface{}, err error)
-	ScanRange(psql string, srf ScanRowFunc, offset int, limit int, args ...interface{}) (ret interface{}, err error)
-	ScanPage(psql string, srf ScanRowFunc, offset int, limit int, sort string, desc bool, args ...interface{}) (tot int, ret interface{}, err error)
-	scanPageTotal(psql string, meta *SqlMeta, args ...interface{}) (ret int, err error)
+	ScanAll(ctx context.Context, psql string, srf ScanRowFunc, args ...interface{}) (ret interface{}, err error)
+	ScanOne2(ctx context.Context, psql string, ret interface{}, args ...interface{}) (ok bool, err error)
+	ScanOne(ctx context.Context, psql string, srf ScanRowFunc, args ...interface{}) (ret interface{}, err error)
+	ScanRange(ctx context.Context, psql string, srf ScanRowFunc, offset int, limit int, args ...interface{}) (ret interface{}, err error)
+	ScanPage(ctx context.Context, psql string, srf ScanRowFunc, offset int, limit int, sort string, desc bool, args ...interface{}) (tot int, ret interface{}, err error)
+	scanPageTotal(ctx context.Context, psql string, meta *SqlMeta, args ...interface{}) (ret int, err error)
 
-	Exec(psql string, args ...interface{}) (ret sql.Result, err error)
-	ExecBatch(psql string, argsList ...interface{}) (retList []sql.Result, err error)
+	Exec(ctx context.Context, psql string, args ...interface{}) (ret sql.Result, err error)
+	ExecBatch(ctx context.Context, psql string, argsList ...interface{}) (retList []sql.Result, err error)
 }
 
 type Clickhouse interface {
 	Operation
 }
 
-func Scan(psql string, srf ScanRowsFunc, args ...interface{}) (ret interface{}, err error) {
-	return CK.Scan(psql, srf, args...)
+// startSpan 请求已有span时创建查询子span，db.statement为SQL指纹
+func startSpan(ctx context.Context, op, psql string) (context.Context, trace.Span) {
+	if !trace.SpanFromContext(ctx).IsRecording() {
+		return ctx, trace.SpanFromContext(ctx)
+	}
+	return tracing.Start(ctx, "clickhouse."+op,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "clickhouse"),
+			attribute.String("db.operation", op),
+			attribute.String("db.sql.table", SqlTable(psql)),
+			attribute.String("db.statement", SqlFingerprint(psql)),
+		))
+}
+
+func observe(span trace.Span, op, psql string, start time.Time, err error) {
+	metrics.ObserveClickhouse(op, SqlTable(psql), start, err)
+	tracing.End(span, err)
+}
+
+func observeQuery(ctx context.Context, span trace.Span, r *Replica, op, psql string, start time.Time, ret interface{}, err error) {
+	if r != nil {
+		span.SetAttributes(attribute.String("net.peer.name", r.Address), attribute.String("db.replica_group", r.Group))
+	}
+	observe(span, op, psql, start, err)
+	checkSlow(ctx, r, op, psql, start, ret, err)
+}
+
+func Scan(ctx context.Context, psql string, srf ScanRowsFunc, args ...interface{}) (ret interface{}, err error) {
+	ctx, span := startSpan(ctx, "Scan", psql)
+	var r *Replica
+	defer func(start time.Time) { observeQuery(ctx, span, r, "Scan", psql, start, ret, err) }(time.Now())
+	r, err = pool.read(ctx, func(ck *clickhImpl) (err error) {
+		ret, err = ck.Scan(ctx, psql, srf, args...)
+		return err
+	})
+	return
+}
+
+func ScanAll(ctx context.Context, psql string, srf ScanRowFunc, args ...interface{}) (ret interface{}, err error) {
+	ctx, span := startSpan(ctx, "ScanAll", psql)
+	var r *Replica
+	defer func(start time.Time) { observeQuery(ctx, span, r, "ScanAll", psql, start, ret, err) }(time.Now())
+	r, err = pool.read(ctx, func(ck *clickhImpl) (err error) {
+		ret, err = ck.ScanAll(ctx, psql, srf, args...)
+		return err
+	})
+	return
 }
 
-func ScanAll(psql string, srf ScanRowFunc, args ...interface{}) (ret interface{}, err error) {
-	return CK.ScanAll(psql, srf, args...)
+func ScanOne2(ctx context.Context, psql string, ret interface{}, args ...interface{}) (ok bool, err error) {
+	ctx, span := startSpan(ctx, "ScanOne2", psql)
+	var r *Replica
+	defer func(start time.Time) { observeQuery(ctx, span, r, "ScanOne2", psql, start, nil, err) }(time.Now())
+	r, err = pool.read(ctx, func(ck *clickhImpl) (err error) {
+		ok, err = ck.ScanOne2(ctx, psql, ret, args...)
+		return err
+	})
+	return
 }
 
-func ScanOne2(psql string, ret interface{}, args ...interface{}) (ok bool, err error) {
-	return CK.ScanOne2(psql, ret, args...)
+func ScanOne(ctx context.Context, psql string, srf ScanRowFunc, args ...interface{}) (ret interface{}, err error) {
+	ctx, span := startSpan(ctx, "ScanOne", psql)
+	var r *Replica
+	defer func(start time.Time) { observeQuery(ctx, span, r, "ScanOne", psql, start, ret, err) }(time.Now())
+	r, err = pool.read(ctx, func(ck *clickhImpl) (err error) {
+		ret, err = ck.ScanOne(ctx, psql, srf, args...)
+		return err
+	})
+	return
 }
 
-func ScanOne(psql string, srf ScanRowFunc, args ...interface{}) (ret interface{}, err error) {
-	return CK.ScanOne(psql, srf, args...)
+func ScanRange(ctx context.Context, psql string, srf ScanRowFunc, offset int, limit int, args ...interface{}) (ret interface{}, err error) {
+	ctx, span := startSpan(ctx, "ScanRange", psql)
+	var r *Replica
+	defer func(start time.Time) { observeQuery(ctx, span, r, "ScanRange", psql, start, ret, err) }(time.Now())
+	r, err = pool.read(ctx, func(ck *clickhImpl) (err error) {
+		ret, err = ck.ScanRange(ctx, psql, srf, offset, limit, args...)
+		return err
+	})
+	return
 }
 
-func ScanRange(psql string, srf ScanRowFunc, offset int, limit int, args ...interface{}) (ret interface{}, err error) {
-	return CK.ScanRange(psql, srf, offset, limit, args...)
+func ScanPage(ctx context.Context, psql string, srf ScanRowFunc, offset int, limit int, sort string, desc bool, args ...interface{}) (tot int, ret interface{}, err error) {
+	ctx, span := startSpan(ctx, "ScanPage", psql)
+	var r *Replica
+	defer func(start time.Time) { observeQuery(ctx, span, r, "ScanPage", psql, start, ret, err) }(time.Now())
+	r, err = pool.read(ctx, func(ck *clickhImpl) (err error) {
+		tot, ret, err = ck.ScanPage(ctx, psql, srf, offset, limit, sort, desc, args...)
+		return err
+	})
+	return
 }
 
-func ScanPage(psql string, srf ScanRowFunc, offset int, limit int, sort string, desc bool, args ...interface{}) (tot int, ret interface{}, err error) {
-	return CK.ScanPage(psql, srf, offset, limit, sort, desc, args...)
+func Exec(ctx context.Context, psql string, args ...interface{}) (ret sql.Result, err error) {
+	ctx, span := startSpan(ctx, "Exec", psql)
+	defer func(start time.Time) { observe(span, "Exec", psql, start, err) }(time.Now())
+	_, err = pool.write(ctx, func(ck *clickhImpl) (err error) {
+		ret, err = ck.Exec(ctx, psql, args...)
+		return err
+	})
+	return
 }
 
-func Exec(psql string, args ...interface{}) (ret sql.Result, err error) {
-	return CK.Exec(psql, args...)
+func ExecBatch(ctx context.Context, psql string, argsList ...interface{}) (retList []sql.Result, err error) {
+	ctx, span := startSpan(ctx, "ExecBatch", psql)
+	defer func(start time.Time) { observe(span, "ExecBatch", psql, start, err) }(time.Now())
+	_, err = pool.write(ctx, func(ck *clickhImpl) (err error) {
+		retList, err = ck.ExecBatch(ctx, psql, argsList...)
+		return err
+	})
+	return
 }
 
-func ExecBatch(psql string, argsList ...interface{}) (retList []sql.Result, err error) {
-	return CK.ExecBatch(psql, argsList...)
+// Ping 检查所有副本的连接，至少一个副本可用时返回可用副本数
+func Ping(ctx context.Context) (healthy int, err error) {
+	ctx, span := startSpan(ctx, "Ping", "")
+	defer func() { tracing.End(span, err) }()
+	for _, r := range pool.replicas {
+		if e := r.ck.PingContext(ctx); e != nil {
+			err = e
+			continue
+		}
+		healthy++
+	}
+	if healthy > 0 {
+		return healthy, nil
+	}
+	return 0, err
 }
@@ -0,0 +1,197 @@
+package clickhouse
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Settings 查询限制，附加在SELECT的SETTINGS子句中，0为不限制
+type Settings struct {
+	MaxExecutionTime int64 `mapstructure:"max_execution_time"` // 秒
+	MaxRowsToRead    int64 `mapstructure:"max_rows_to_read"`
+	MaxMemoryUsage   int64 `mapstructure:"max_memory_usage"` // 字节
+
+	Group string `mapstructure:"group"` // 读查询使用的副本分组，空为default
+}
+
+func (s *Settings) clause() string {
+	if s == nil {
+		return ""
+	}
+	var items []string
+	if s.MaxExecutionTime > 0 {
+		items = append(items, fmt.Sprintf("max_execution_time=%d", s.MaxExecutionTime))
+	}
+	if s.MaxRowsToRead > 0 {
+		items = append(items, fmt.Sprintf("max_rows_to_read=%d", s.MaxRowsToRead))
+	}
+	if s.MaxMemoryUsage > 0 {
+		items = append(items, fmt.Sprintf("max_memory_usage=%d", s.MaxMemoryUsage))
+	}
+	if len(items) == 0 {
+		return ""
+	}
+	return "\nSETTINGS " + strings.Join(items, ", ")
+}
+
+// SlowQuery 一次慢查询
+type SlowQuery struct {
+	Op       string
+	Sql      string // TWS规范化后的SQL
+	Sent     string // 实际发送的SQL，含SETTINGS子句，用于查询system.query_log
+	Route    string // 调用的接口路由模式
+	Replica  string // 执行查询的副本地址
+	Start    time.Time
+	Duration time.Duration
+	Rows     int // 返回行数
+	Err      error
+}
+
+const defaultProfile = "default"
+
+var (
+	profiles      = map[string]*Settings{}
+	routeProfiles = map[string]string{}
+
+	slowQueryThreshold time.Duration
+	// QueryLogEnabled 是否从system.query_log补充慢查询的read_rows等统计
+	QueryLogEnabled bool
+	// OnSlowQuery 慢查询回调，由service注册
+	OnSlowQuery func(ctx context.Context, q *SlowQuery)
+)
+
+type routeKey struct{}
+
+// initGuard 读取可选的conf/query.yaml
+func initGuard(filename string) {
+	if _, err := os.Stat(filename); err != nil {
+		return
+	}
+	v := viper.New()
+	v.SetConfigFile(filename)
+	if err := v.ReadInConfig(); err != nil {
+		panic(fmt.Errorf("Fatal error config file: %s \n", err))
+	}
+	if err := v.UnmarshalKey("profiles", &profiles); err != nil {
+		panic(fmt.Errorf("Fatal error config file: %s \n", err))
+	}
+	routeProfiles = v.GetStringMapString("routes")
+	for route, name := range routeProfiles {
+		if _, ok := profiles[name]; !ok {
+			panic(fmt.Errorf("Fatal error config file: %s: route %s uses unknown profile %s \n", filename, route, name))
+		}
+	}
+	slowQueryThreshold = v.GetDuration("slowQuery")
+	QueryLogEnabled = v.GetBool("queryLog")
+}
+
+// WithRoute 在ctx中记录调用的路由模式，用于选择查询限制和记录慢查询
+func WithRoute(ctx context.Context, route string) context.Context {
+	return context.WithValue(ctx, routeKey{}, route)
+}
+
+// RouteFromContext ctx中记录的路由模式，没有时返回空
+func RouteFromContext(ctx context.Context) string {
+	route, _ := ctx.Value(routeKey{}).(string)
+	return route
+}
+
+func settingsFor(ctx context.Context) *Settings {
+	if name, ok := routeProfiles[RouteFromContext(ctx)]; ok {
+		return profiles[name]
+	}
+	return profiles[defaultProfile]
+}
+
+// groupFor 路由对应的副本分组
+func groupFor(ctx context.Context) string {
+	if s := settingsFor(ctx); s != nil && s.Group != "" {
+		return s.Group
+	}
+	return GroupDefault
+}
+
+// withSettings 给查询附加路由对应的SETTINGS子句
+func withSettings(ctx context.Context, psql string) string {
+	return psql + settingsFor(ctx).clause()
+}
+
+// rowsOf ScanAll等返回的切片长度
+func rowsOf(ret interface{}) int {
+	if ret == nil {
+		return 0
+	}
+	v := reflect.ValueOf(ret)
+	if v.Kind() == reflect.Slice {
+		return v.Len()
+	}
+	return 1
+}
+
+func checkSlow(ctx context.Context, r *Replica, op, psql string, start time.Time, ret interface{}, err error) {
+	if slowQueryThreshold <= 0 || OnSlowQuery == nil {
+		return
+	}
+	duration := time.Since(start)
+	if duration < slowQueryThreshold {
+		return
+	}
+	replica := ""
+	if r != nil {
+		replica = r.Address
+	}
+	OnSlowQuery(ctx, &SlowQuery{
+		Op:       op,
+		Sql:      TWS(psql),
+		Sent:     withSettings(ctx, psql),
+		Route:    RouteFromContext(ctx),
+		Replica:  replica,
+		Start:    start,
+		Duration: duration,
+		Rows:     rowsOf(ret),
+		Err:      err,
+	})
+}
+
+// QueryLogStat system.query_log中的查询统计
+type QueryLogStat struct {
+	ReadRows    int64
+	ReadBytes   int64
+	MemoryUsage int64
+}
+
+// GetQueryLogStat 按normalized_query_hash在执行查询的副本上查找start之后最近一次完成的同类查询，副本未知时返回错误。
+// query_log默认每7.5秒刷新，应在查询结束一段时间后调用
+func GetQueryLogStat(ctx context.Context, replica, sent string, start time.Time) (stat *QueryLogStat, err error) {
+	psql := `
+SELECT read_rows, read_bytes, memory_usage FROM system.query_log
+WHERE type = 'QueryFinish' AND event_date >= toDate(?) AND event_time >= ? AND normalized_query_hash = normalizedQueryHash(?)
+ORDER BY event_time DESC
+LIMIT 1`
+	stat = &QueryLogStat{}
+	since := start.Add(-time.Second)
+	var ck *clickhImpl
+	for _, r := range pool.replicas {
+		if r.Address == replica {
+			ck = r.ck
+		}
+	}
+	if ck == nil {
+		// 其他副本的query_log中没有这次查询
+		return nil, fmt.Errorf("clickhouse replica unknown: %q", replica)
+	}
+	ok, err := ck.ScanOne2(ctx, psql, []interface{}{&stat.ReadRows, &stat.ReadBytes, &stat.MemoryUsage}, since, since, sent)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, nil
+	}
+	return stat, nil
+}
@@ -1,6 +1,7 @@
 package clickhouse
 
 import (
+	"context"
 	"database/sql"
 	"math"
 	"reflect"
@@ -16,12 +17,17 @@ func newMysql(db *sql.DB) *clickhImpl {
 	}
 }
 
-func (m *clickhImpl) Scan(psql string, srf ScanRowsFunc, args ...interface{}) (ret interface{}, err error) {
-	pstmt, err := m.DB.Prepare(psql)
+// prepareQuery 按ctx中的路由附加查询限制
+func (m *clickhImpl) prepareQuery(ctx context.Context, psql string) (*sql.Stmt, error) {
+	return m.DB.PrepareContext(ctx, withSettings(ctx, psql))
+}
+
+func (m *clickhImpl) Scan(ctx context.Context, psql string, srf ScanRowsFunc, args ...interface{}) (ret interface{}, err error) {
+	pstmt, err := m.prepareQuery(ctx, psql)
 	if err != nil {
 		return
 	}
-	rows, err := pstmt.Query(args...)
+	rows, err := pstmt.QueryContext(ctx, args...)
 	if err != nil {
 		return
 	}
@@ -30,12 +36,12 @@ func (m *clickhImpl) Scan(psql string, srf ScanRowsFunc, args ...interface{}) (r
 	return srf(rows)
 }
 
-func (m *clickhImpl) ScanAll(psql string, srf ScanRowFunc, args ...interface{}) (ret interface{}, err error) {
-	pstmt, err := m.DB.Prepare(psql)
+func (m *clickhImpl) ScanAll(ctx context.Context, psql string, srf ScanRowFunc, args ...interface{}) (ret interface{}, err error) {
+	pstmt, err := m.prepareQuery(ctx, psql)
 	if err != nil {
 		return
 	}
-	rows, err := pstmt.Query(args...)
+	rows, err := pstmt.QueryContext(ctx, args...)
 	if err != nil {
 		return
 	}
@@ -64,12 +70,12 @@ func (m *clickhImpl) ScanAll(psql string, srf ScanRowFunc, args ...interface{})
 	return
 }
 
-func (m *clickhImpl) ScanOne2(psql string, to interface{}, args ...interface{}) (ok bool, err error) {
-	pstmt, err := m.DB.Prepare(psql)
+func (m *clickhImpl) ScanOne2(ctx context.Context, psql string, to interface{}, args ...interface{}) (ok bool, err error) {
+	pstmt, err := m.prepareQuery(ctx, psql)
 	if err != nil {
 		return
 	}
-	rows, err := pstmt.Query(args...)
+	rows, err := pstmt.QueryContext(ctx, args...)
 	if err != nil {
 		return
 	}
@@ -90,12 +96,12 @@ func (m *clickhImpl) ScanOne2(psql string, to interface{}, args ...interface{})
 	return
 }
 
-func (m *clickhImpl) ScanOne(psql string, srf ScanRowFunc, args ...interface{}) (ret interface{}, err error) {
-	pstmt, err := m.DB.Prepare(psql)
+func (m *clickhImpl) ScanOne(ctx context.Context, psql string, srf ScanRowFunc, args ...interface{}) (ret interface{}, err error) {
+	pstmt, err := m.prepareQuery(ctx, psql)
 	if err != nil {
 		return
 	}
-	rows, err := pstmt.Query(args...)
+	rows, err := pstmt.QueryContext(ctx, args...)
 	if err != nil {
 		return
 	}
@@ -112,18 +118,18 @@ func (m *clickhImpl) ScanOne(psql string, srf ScanRowFunc, args ...interface{})
 }
 
 /*如果源SQL没有limit子句,则直接拼到最后即可*/
-func (m *clickhImpl) ScanRange(psql string, srf ScanRowFunc, offset int, limit int, args ...interface{}) (ret interface{}, err error) {
+func (m *clickhImpl) ScanRange(ctx context.Context, psql string, srf ScanRowFunc, offset int, limit int, args ...interface{}) (ret interface{}, err error) {
 	meta := GetSqlMeta(psql)
 	if meta.LimitPsql == "" {
 		GenLimitSql(psql, meta)
 	}
 	args = append(args, offset, limit)
 
-	pstmt, err := m.DB.Prepare(psql)
+	pstmt, err := m.prepareQuery(ctx, psql)
 	if err != nil {
 		return
 	}
-	rows, err := pstmt.Query(args...)
+	rows, err := pstmt.QueryContext(ctx, args...)
 	if err != nil {
 		return
 	}
@@ -152,7 +158,7 @@ func (m *clickhImpl) ScanRange(psql string, srf ScanRowFunc, offset int, limit i
 	return
 }
 
-func (m *clickhImpl) ScanPage(psql string, srf ScanRowFunc, offset int, limit int, sort string, desc bool, args ...interface{}) (tot int, ret interface{}, err error) {
+func (m *clickhImpl) ScanPage(ctx context.Context, psql string, srf ScanRowFunc, offset int, limit int, sort string, desc bool, args ...interface{}) (tot int, ret interface{}, err error) {
 
 	aln := len(args)
 
@@ -165,11 +171,11 @@ func (m *clickhImpl) ScanPage(psql string, srf ScanRowFunc, offset int, limit in
 	}
 	args = append(args, offset, limit)
 
-	pstmt, err := m.DB.Prepare(dataPsql)
+	pstmt, err := m.prepareQuery(ctx, dataPsql)
 	if err != nil {
 		return
 	}
-	rows, err := pstmt.Query(args...)
+	rows, err := pstmt.QueryContext(ctx, args...)
 	if err != nil {
 		return
 	}
@@ -202,23 +208,23 @@ func (m *clickhImpl) ScanPage(psql string, srf ScanRowFunc, offset int, limit in
 	} else if dlen > 0 && dlen < limit {
 		tot = offset + dlen
 	} else {
-		tot, err = m.scanPageTotal(psql, meta, args[0:aln]...)
+		tot, err = m.scanPageTotal(ctx, psql, meta, args[0:aln]...)
 	}
 
 	return
 }
 
-func (m *clickhImpl) scanPageTotal(psql string, meta *SqlMeta, args ...interface{}) (ret int, err error) {
+func (m *clickhImpl) scanPageTotal(ctx context.Context, psql string, meta *SqlMeta, args ...interface{}) (ret int, err error) {
 	// 查询总数
 	if meta.TotalPsql == "" {
 		GenTotalSql(psql, meta)
 	}
 
-	pstmt, err := m.DB.Prepare(meta.TotalPsql)
+	pstmt, err := m.prepareQuery(ctx, meta.TotalPsql)
 	if err != nil {
 		return
 	}
-	rows, err := pstmt.Query(args...)
+	rows, err := pstmt.QueryContext(ctx, args...)
 	if err != nil {
 		return
 	}
@@ -231,22 +237,22 @@ func (m *clickhImpl) scanPageTotal(psql string, meta *SqlMeta, args ...interface
 	return
 }
 
-func (m *clickhImpl) Exec(psql string, args ...interface{}) (ret sql.Result, err error) {
-	pstmt, err := m.DB.Prepare(psql)
+func (m *clickhImpl) Exec(ctx context.Context, psql string, args ...interface{}) (ret sql.Result, err error) {
+	pstmt, err := m.DB.PrepareContext(ctx, psql)
 	if err != nil {
 		return
 	}
 	defer pstmt.Close()
-	ret, err = pstmt.Exec(args...)
+	ret, err = pstmt.ExecContext(ctx, args...)
 	return
 }
 
-func (m *clickhImpl) ExecBatch(psql string, argsList ...interface{}) (retList []sql.Result, err error) {
-	tx, err := m.DB.Begin()
+func (m *clickhImpl) ExecBatch(ctx context.Context, psql string, argsList ...interface{}) (retList []sql.Result, err error) {
+	tx, err := m.DB.BeginTx(ctx, nil)
 	if err != nil {
 		return
 	}
-	pstmt, err := tx.Prepare(psql)
+	pstmt, err := tx.PrepareContext(ctx, psql)
 	if err != nil {
 		return
 	}
@@ -257,9 +263,9 @@ func (m *clickhImpl) ExecBatch(psql string, argsList ...interface{}) (retList []
 	for i, args := range argsList {
 		switch args := args.(type) {
 		case []interface{}:
-			ret, err = pstmt.Exec(args...)
+			ret, err = pstmt.ExecContext(ctx, args...)
 		default:
-			ret, err = pstmt.Exec(args)
+			ret, err = pstmt.ExecContext(ctx, args)
 		}
 		if err != nil {
 			tx.Rollback()
@@ -4,16 +4,19 @@ import (
 	"database/sql"
 	"fmt"
 	"net/url"
+	"sensiblequery/lib/metrics"
 	"strconv"
 	"strings"
+	"time"
 
 	_ "github.com/ClickHouse/clickhouse-go"
 	"github.com/spf13/viper"
 )
 
-var (
-	CK *clickhImpl
-)
+type replicaConf struct {
+	Address string `mapstructure:"address"`
+	Group   string `mapstructure:"group"`
+}
 
 func init() {
 	viper.SetConfigFile("conf/db.yaml")
@@ -25,8 +28,6 @@ func init() {
 		}
 	}
 
-	address := viper.GetString("address")
-
 	config := map[string]string{
 		"username":                 viper.GetString("username"),
 		"password":                 viper.GetString("password"),
@@ -47,21 +48,54 @@ func init() {
 	for key, value := range config {
 		addit(sb, key, value)
 	}
-	db, err := sql.Open("clickhouse", "tcp://"+address+sb.String())
-	if err != nil {
-		panic(err)
+
+	// 未配置replicas时，address中的每个地址作为default分组的一个副本
+	var replicas []*replicaConf
+	if err := viper.UnmarshalKey("replicas", &replicas); err != nil {
+		panic(fmt.Errorf("Fatal error config file: %s \n", err))
 	}
-	if maxIdleConns > 0 {
-		db.SetMaxIdleConns(maxIdleConns)
+	if len(replicas) == 0 {
+		for _, address := range strings.Split(viper.GetString("address"), ",") {
+			if address = strings.TrimSpace(address); address != "" {
+				replicas = append(replicas, &replicaConf{Address: address})
+			}
+		}
+	}
+	if len(replicas) == 0 {
+		panic(fmt.Errorf("Fatal error config file: %s: no clickhouse address \n", "conf/db.yaml"))
 	}
-	if maxOpenConns > 0 {
-		db.SetMaxOpenConns(maxOpenConns)
+
+	viper.SetDefault("healthCheckInterval", 5*time.Second)
+	viper.SetDefault("maxLagBlocks", 2)
+	viper.SetDefault("maxReadTries", 2)
+	pool = &replicaPool{
+		interval:     viper.GetDuration("healthCheckInterval"),
+		maxLagBlocks: viper.GetInt("maxLagBlocks"),
+		maxTries:     viper.GetInt("maxReadTries"),
 	}
-	if connMaxLifetime > 0 {
-		db.SetConnMaxLifetime(connMaxLifetime)
+
+	for _, conf := range replicas {
+		db, err := sql.Open("clickhouse", "tcp://"+conf.Address+sb.String())
+		if err != nil {
+			panic(err)
+		}
+		if maxIdleConns > 0 {
+			db.SetMaxIdleConns(maxIdleConns)
+		}
+		if maxOpenConns > 0 {
+			db.SetMaxOpenConns(maxOpenConns)
+		}
+		if connMaxLifetime > 0 {
+			db.SetConnMaxLifetime(connMaxLifetime)
+		}
+		if conf.Group == "" {
+			conf.Group = GroupDefault
+		}
+		pool.replicas = append(pool.replicas, newReplica(conf.Address, conf.Group, &clickhImpl{DB: db}))
+		metrics.RegisterDBPool("clickhouse:"+conf.Address, db)
 	}
 
-	CK = &clickhImpl{DB: db}
+	initGuard("conf/query.yaml")
 }
 
 func addit(sb *strings.Builder, key, val string) {
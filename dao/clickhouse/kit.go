@@ -3,6 +3,7 @@ package clickhouse
 import (
 	"bytes"
 	"fmt"
+	"regexp"
 	"sync"
 	"unicode"
 )
@@ -439,3 +440,35 @@ func append2(args []interface{}, offset interface{}, limit interface{}) []interf
 	nargs[ln+1] = limit
 	return nargs
 }
+
+var sqlTableRe = regexp.MustCompile(`(?i)\bFROM\s+([A-Za-z_][\w.]*)`)
+
+/*
+SQL中第一个FROM后的表名，用于监控分类
+*/
+func SqlTable(psql string) string {
+	m := sqlTableRe.FindStringSubmatch(psql)
+	if m == nil {
+		return "-"
+	}
+	return m[1]
+}
+
+var (
+	sqlStringRe = regexp.MustCompile(`'(?:[^'\\]|\\.)*'`)
+	sqlNumberRe = regexp.MustCompile(`\b(?:0[xX][0-9a-fA-F]+|\d+(?:\.\d+)?)\b`)
+	sqlListRe   = regexp.MustCompile(`\(\s*\?(?:\s*,\s*\?)+\s*\)`)
+	sqlTupleRe  = regexp.MustCompile(`\(\s*\(\.\.\.\)(?:\s*,\s*\(\.\.\.\))+\s*\)`)
+)
+
+/*
+SQL指纹，去除空白并将字符串、数字常量替换为?，常量列表合并为(...)，用于链路追踪
+*/
+func SqlFingerprint(psql string) string {
+	fp := TWS(psql)
+	fp = sqlStringRe.ReplaceAllString(fp, "?")
+	fp = sqlNumberRe.ReplaceAllString(fp, "?")
+	fp = sqlListRe.ReplaceAllString(fp, "(...)")
+	fp = sqlTupleRe.ReplaceAllString(fp, "(...)")
+	return fp
+}
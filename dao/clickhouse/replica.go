@@ -0,0 +1,282 @@
+package clickhouse
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"sensiblequery/lib/metrics"
+	"sensiblequery/logger"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	ckdriver "github.com/ClickHouse/clickhouse-go"
+	"go.uber.org/zap"
+)
+
+const (
+	GroupDefault = "default"
+
+	ReplicaUp      = "up"
+	ReplicaDown    = "down"
+	ReplicaLagging = "lagging"
+)
+
+// Replica 一个ClickHouse副本及最近一次健康检查结果
+type Replica struct {
+	Address string
+	Group   string
+	ck      *clickhImpl
+
+	mu        sync.RWMutex
+	state     string
+	height    int
+	latency   time.Duration
+	lastErr   string
+	checkedAt time.Time
+}
+
+// ReplicaStatus 副本状态
+type ReplicaStatus struct {
+	Address   string
+	Group     string
+	State     string // up/down/lagging
+	Height    int    // blk_height最大高度
+	Latency   time.Duration
+	Error     string
+	CheckedAt time.Time
+}
+
+func newReplica(address, group string, ck *clickhImpl) *Replica {
+	// 首次检查前视为可用
+	return &Replica{Address: address, Group: group, ck: ck, state: ReplicaUp}
+}
+
+func (r *Replica) usable() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.state == ReplicaUp
+}
+
+func (r *Replica) Status() *ReplicaStatus {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return &ReplicaStatus{
+		Address:   r.Address,
+		Group:     r.Group,
+		State:     r.state,
+		Height:    r.height,
+		Latency:   r.latency,
+		Error:     r.lastErr,
+		CheckedAt: r.checkedAt,
+	}
+}
+
+func (r *Replica) setState(state string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.state = state
+	if err != nil {
+		r.lastErr = err.Error()
+	} else {
+		r.lastErr = ""
+	}
+	up := 0.0
+	if state == ReplicaUp {
+		up = 1
+	}
+	metrics.ClickhouseReplicaUp.WithLabelValues(r.Address, r.Group).Set(up)
+}
+
+// check ping并查询blk_height的最大高度
+func (r *Replica) check(ctx context.Context) (height int, err error) {
+	start := time.Now()
+	defer func() {
+		r.mu.Lock()
+		r.latency = time.Since(start)
+		r.checkedAt = time.Now()
+		r.mu.Unlock()
+	}()
+	if err = r.ck.PingContext(ctx); err != nil {
+		return 0, err
+	}
+	if _, err = r.ck.ScanOne2(ctx, "SELECT max(height) FROM blk_height", &height); err != nil {
+		return 0, err
+	}
+	r.mu.Lock()
+	r.height = height
+	r.mu.Unlock()
+	metrics.ClickhouseReplicaHeight.WithLabelValues(r.Address, r.Group).Set(float64(height))
+	return height, nil
+}
+
+type replicaPool struct {
+	replicas     []*Replica
+	next         uint32
+	interval     time.Duration
+	maxLagBlocks int // 比最高的副本落后超过该区块数时不再使用，0为不检查
+	maxTries     int // 读查询最多尝试的副本数
+}
+
+var pool *replicaPool
+
+// candidates 分组内可用的副本，从轮询位置开始排列。
+// 分组内没有可用副本时依次退回default分组、所有可用副本、所有副本
+func (p *replicaPool) candidates(group string) []*Replica {
+	offset := int(atomic.AddUint32(&p.next, 1))
+	pick := func(match func(r *Replica) bool) (ret []*Replica) {
+		n := len(p.replicas)
+		for i := 0; i < n; i++ {
+			r := p.replicas[(offset+i)%n]
+			if match(r) {
+				ret = append(ret, r)
+			}
+		}
+		return ret
+	}
+	if ret := pick(func(r *Replica) bool { return r.Group == group && r.usable() }); len(ret) > 0 {
+		return ret
+	}
+	if ret := pick(func(r *Replica) bool { return r.Group == GroupDefault && r.usable() }); len(ret) > 0 {
+		return ret
+	}
+	if ret := pick((*Replica).usable); len(ret) > 0 {
+		return ret
+	}
+	return pick(func(r *Replica) bool { return true })
+}
+
+// connError 连接或网络错误，副本可能已不可用
+func connError(err error) bool {
+	var ex *ckdriver.Exception
+	if errors.As(err, &ex) {
+		return ex.Code == 209 || ex.Code == 210 // SOCKET_TIMEOUT, NETWORK_ERROR
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// retryable 连接错误及节点查询数已满可以换副本重试。
+// 查询本身的错误(语法、超出内存等查询限制)以及扫描结果的错误换副本也会失败，不重试
+func retryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var ex *ckdriver.Exception
+	if errors.As(err, &ex) && ex.Code == 202 { // TOO_MANY_SIMULTANEOUS_QUERIES
+		return true
+	}
+	return connError(err)
+}
+
+// read 在ctx路由对应分组的副本上执行读查询，失败时换副本重试，返回最后使用的副本
+func (p *replicaPool) read(ctx context.Context, query func(ck *clickhImpl) error) (r *Replica, err error) {
+	for idx, replica := range p.candidates(groupFor(ctx)) {
+		if idx > 0 && idx >= p.maxTries {
+			break
+		}
+		r = replica
+		if err = query(r.ck); err == nil || !retryable(ctx, err) {
+			return r, err
+		}
+		logger.Ctx(ctx).Info("clickhouse replica failed",
+			zap.String("address", r.Address),
+			zap.Error(err),
+		)
+		metrics.ClickhouseReplicaRetries.WithLabelValues(r.Address, r.Group).Inc()
+		if connError(err) {
+			// 等下一次健康检查恢复
+			r.setState(ReplicaDown, err)
+		}
+	}
+	return r, err
+}
+
+// write 写入只在第一个可用副本上执行，不重试
+func (p *replicaPool) write(ctx context.Context, exec func(ck *clickhImpl) error) (r *Replica, err error) {
+	r = p.candidates(GroupDefault)[0]
+	return r, exec(r.ck)
+}
+
+// checkAll 检查所有副本，落后于最高副本超过maxLagBlocks的标记为lagging
+func (p *replicaPool) checkAll(ctx context.Context) {
+	heights := make([]int, len(p.replicas))
+	errs := make([]error, len(p.replicas))
+	var wg sync.WaitGroup
+	for idx, r := range p.replicas {
+		wg.Add(1)
+		go func(idx int, r *Replica) {
+			defer wg.Done()
+			heights[idx], errs[idx] = r.check(ctx)
+		}(idx, r)
+	}
+	wg.Wait()
+
+	maxHeight := 0
+	for idx := range p.replicas {
+		if errs[idx] == nil && heights[idx] > maxHeight {
+			maxHeight = heights[idx]
+		}
+	}
+	for idx, r := range p.replicas {
+		last := r.Status().State
+		state := ReplicaUp
+		if errs[idx] != nil {
+			state = ReplicaDown
+		} else if p.maxLagBlocks > 0 && maxHeight-heights[idx] > p.maxLagBlocks {
+			state = ReplicaLagging
+		}
+		r.setState(state, errs[idx])
+		if state != last {
+			logger.Log.Info("clickhouse replica state",
+				zap.String("address", r.Address),
+				zap.String("group", r.Group),
+				zap.String("state", state),
+				zap.Int("height", heights[idx]),
+				zap.Int("maxHeight", maxHeight),
+				zap.Error(errs[idx]),
+			)
+		}
+	}
+}
+
+// StartReplicaCheck 定期检查所有副本，直到ctx结束
+func StartReplicaCheck(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(pool.interval)
+		defer ticker.Stop()
+		for {
+			cctx, cancel := context.WithTimeout(ctx, pool.interval)
+			pool.checkAll(cctx)
+			cancel()
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Replicas 所有副本的状态
+func Replicas() []*ReplicaStatus {
+	ret := make([]*ReplicaStatus, len(pool.replicas))
+	for idx, r := range pool.replicas {
+		ret[idx] = r.Status()
+	}
+	return ret
+}
+
+// Close 关闭所有副本的连接池
+func Close() (err error) {
+	for _, r := range pool.replicas {
+		if e := r.ck.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
@@ -0,0 +1,95 @@
+package clickhouse
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+
+	ckdriver "github.com/ClickHouse/clickhouse-go"
+)
+
+func TestRetryable(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, c := range []struct {
+		name      string
+		ctx       context.Context
+		err       error
+		retryable bool
+		connError bool
+	}{
+		{"net", context.Background(), &net.OpError{Op: "dial", Err: errors.New("connection refused")}, true, true},
+		{"bad conn", context.Background(), driver.ErrBadConn, true, true},
+		{"eof", context.Background(), fmt.Errorf("read: %w", io.EOF), true, true},
+		{"socket timeout", context.Background(), &ckdriver.Exception{Code: 209}, true, true},
+		{"network error", context.Background(), &ckdriver.Exception{Code: 210}, true, true},
+		{"too many queries", context.Background(), &ckdriver.Exception{Code: 202}, true, false},
+		{"memory limit", context.Background(), &ckdriver.Exception{Code: 241}, false, false},
+		{"syntax", context.Background(), &ckdriver.Exception{Code: 62}, false, false},
+		{"scan", context.Background(), errors.New("sql: Scan error on column index 0"), false, false},
+		{"canceled", canceled, io.EOF, false, true},
+	} {
+		if got := retryable(c.ctx, c.err); got != c.retryable {
+			t.Errorf("%s: retryable %v", c.name, got)
+		}
+		if got := connError(c.err); got != c.connError {
+			t.Errorf("%s: connError %v", c.name, got)
+		}
+	}
+}
+
+func TestReadFailover(t *testing.T) {
+	for _, c := range []struct {
+		name  string
+		err   error // 第一次查询的错误，之后的查询成功
+		calls int
+		down  bool // 第一个副本是否被标记为down
+	}{
+		{"eof", io.EOF, 2, true},
+		{"too many queries", &ckdriver.Exception{Code: 202}, 2, false},
+		{"memory limit", &ckdriver.Exception{Code: 241}, 1, false},
+		{"scan", errors.New("sql: Scan error on column index 0"), 1, false},
+	} {
+		p := &replicaPool{maxTries: 2}
+		for _, address := range []string{"a", "b", "c"} {
+			p.replicas = append(p.replicas, newReplica(address, GroupDefault, &clickhImpl{}))
+		}
+		var tried []*clickhImpl
+		r, err := p.read(context.Background(), func(ck *clickhImpl) error {
+			tried = append(tried, ck)
+			if len(tried) == 1 {
+				return c.err
+			}
+			return nil
+		})
+		if len(tried) != c.calls || r.ck != tried[len(tried)-1] {
+			t.Fatalf("%s: calls %d", c.name, len(tried))
+		}
+		if c.calls == 1 && err != c.err || c.calls > 1 && err != nil {
+			t.Fatalf("%s: err %v", c.name, err)
+		}
+		for _, replica := range p.replicas {
+			if replica.ck == tried[0] && replica.usable() == c.down {
+				t.Fatalf("%s: state %s", c.name, replica.Status().State)
+			}
+		}
+	}
+
+	// 所有尝试都失败时最多尝试maxTries个副本
+	p := &replicaPool{maxTries: 2}
+	for _, address := range []string{"a", "b", "c"} {
+		p.replicas = append(p.replicas, newReplica(address, GroupDefault, &clickhImpl{}))
+	}
+	calls := 0
+	_, err := p.read(context.Background(), func(ck *clickhImpl) error {
+		calls++
+		return driver.ErrBadConn
+	})
+	if calls != 2 || err != driver.ErrBadConn {
+		t.Fatalf("calls %d err %v", calls, err)
+	}
+}
@@ -3,6 +3,8 @@ package rdb
 import (
 	"context"
 	"fmt"
+	"sensiblequery/lib/metrics"
+	"sensiblequery/lib/tracing"
 
 	redis "github.com/go-redis/redis/v8"
 	"github.com/spf13/viper"
@@ -25,6 +27,29 @@ func init() {
 	RdbUtxoClient = Init("conf/rdb_utxo.yaml")
 	RdbAddressClient = Init("conf/rdb_address.yaml")
 	UserClient = Init("conf/user.yaml")
+
+	instrument("cache", CacheClient)
+	instrument("biz", BizClient)
+	instrument("utxo", RdbUtxoClient)
+	instrument("address", RdbAddressClient)
+	instrument("user", UserClient)
+}
+
+// instrument 上报命令延迟、错误与连接池状态，并记录链路追踪
+func instrument(name string, rds redis.UniversalClient) {
+	rds.AddHook(metrics.RedisHook{Client: name})
+	rds.AddHook(tracing.RedisHook{Client: name})
+	metrics.RegisterRedisPool(name, rds)
+}
+
+// Close 关闭所有redis连接池
+func Close() (err error) {
+	for _, rds := range []redis.UniversalClient{CacheClient, BizClient, RdbUtxoClient, RdbAddressClient, UserClient} {
+		if e := rds.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
 }
 
 func InitClient(filename string) (rds *redis.Client) {
@@ -55,6 +55,26 @@ func DecodeVarIntForTx(raw []byte) (cnt uint, cnt_size uint) {
 	return uint(binary.LittleEndian.Uint64(raw[1:9])), 9
 }
 
+// EncodeVarInt 交易序列化中的变长整数
+func EncodeVarInt(n uint64) []byte {
+	switch {
+	case n < 0xfd:
+		return []byte{byte(n)}
+	case n <= 0xffff:
+		buf := []byte{0xfd, 0, 0}
+		binary.LittleEndian.PutUint16(buf[1:], uint16(n))
+		return buf
+	case n <= 0xffffffff:
+		buf := []byte{0xfe, 0, 0, 0, 0}
+		binary.LittleEndian.PutUint32(buf[1:], uint32(n))
+		return buf
+	}
+	buf := make([]byte, 9)
+	buf[0] = 0xff
+	binary.LittleEndian.PutUint64(buf[1:], n)
+	return buf
+}
+
 func HashString(data []byte) (res string) {
 	n := len(data) // 32
 	reverseData := make([]byte, n)
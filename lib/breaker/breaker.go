@@ -0,0 +1,108 @@
+// Package breaker 熔断器，连续失败达到阈值后打开，冷却后放行一次试探请求
+package breaker
+
+import (
+	"sync"
+	"time"
+)
+
+type State int
+
+const (
+	Closed   State = iota // 正常
+	Open                  // 熔断，不放行
+	HalfOpen              // 冷却结束，放行一次试探
+)
+
+func (s State) String() string {
+	switch s {
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+type Breaker struct {
+	failures int           // 连续失败次数阈值
+	cooldown time.Duration // 打开后多久允许试探
+
+	mu       sync.Mutex
+	state    State
+	count    int
+	openedAt time.Time
+	now      func() time.Time
+
+	// OnChange 状态变化回调，在锁内调用
+	OnChange func(from, to State)
+}
+
+func New(failures int, cooldown time.Duration) *Breaker {
+	if failures < 1 {
+		failures = 1
+	}
+	return &Breaker{failures: failures, cooldown: cooldown, now: time.Now}
+}
+
+func (b *Breaker) setState(state State) {
+	if b.state == state {
+		return
+	}
+	from := b.state
+	b.state = state
+	if b.OnChange != nil {
+		b.OnChange(from, state)
+	}
+}
+
+// Allow 是否放行请求。冷却结束后只放行一次试探，结果未上报前其他请求不放行
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case Closed:
+		return true
+	case Open:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.setState(HalfOpen)
+		return true
+	}
+	return false
+}
+
+// Success 上报成功，关闭熔断
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.count = 0
+	b.setState(Closed)
+}
+
+// Failure 上报失败，连续失败达到阈值或试探失败时打开熔断
+func (b *Breaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.count++
+	if b.state == HalfOpen || b.count >= b.failures {
+		b.openedAt = b.now()
+		b.setState(Open)
+	}
+}
+
+// Cancel 上报请求被取消，没有结果。试探请求取消时回到打开，下次Allow重新放行试探
+func (b *Breaker) Cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == HalfOpen {
+		b.setState(Open)
+	}
+}
+
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
@@ -0,0 +1,66 @@
+package breaker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	b := New(3, 10*time.Second)
+	b.now = func() time.Time { return now }
+	var changes []State
+	b.OnChange = func(from, to State) { changes = append(changes, to) }
+
+	// 成功会清零连续失败次数
+	b.Failure()
+	b.Failure()
+	b.Success()
+	b.Failure()
+	b.Failure()
+	if !b.Allow() || b.State() != Closed {
+		t.Fatalf("should stay closed, got %s", b.State())
+	}
+
+	b.Failure()
+	if b.Allow() || b.State() != Open {
+		t.Fatalf("should open after 3 failures, got %s", b.State())
+	}
+
+	// 冷却结束只放行一次试探
+	now = now.Add(10 * time.Second)
+	if !b.Allow() || b.State() != HalfOpen {
+		t.Fatalf("should allow a probe, got %s", b.State())
+	}
+	if b.Allow() {
+		t.Fatal("should allow only one probe")
+	}
+
+	// 试探失败重新打开
+	b.Failure()
+	if b.Allow() || b.State() != Open {
+		t.Fatalf("failed probe should reopen, got %s", b.State())
+	}
+
+	// 试探取消时不关闭熔断，冷却已过，可以重新试探
+	now = now.Add(10 * time.Second)
+	b.Allow()
+	b.Cancel()
+	if b.State() != Open || !b.Allow() || b.State() != HalfOpen {
+		t.Fatalf("canceled probe should allow another probe, got %s", b.State())
+	}
+	b.Success()
+	if !b.Allow() || b.State() != Closed {
+		t.Fatalf("successful probe should close, got %s", b.State())
+	}
+
+	want := []State{Open, HalfOpen, Open, HalfOpen, Open, HalfOpen, Closed}
+	if len(changes) != len(want) {
+		t.Fatalf("changes %v, want %v", changes, want)
+	}
+	for idx := range want {
+		if changes[idx] != want[idx] {
+			t.Fatalf("changes %v, want %v", changes, want)
+		}
+	}
+}
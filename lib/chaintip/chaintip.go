@@ -0,0 +1,136 @@
+// Package chaintip 跟踪最近的区块链，根据previd连续性识别新区块及重组
+package chaintip
+
+import (
+	"errors"
+)
+
+var (
+	// ErrNotContinuous 区块之间previd不连续，索引可能正在写入
+	ErrNotContinuous = errors.New("blocks not continuous")
+	// ErrForkTooDeep 区块与已知的链没有共同区块，需要从更低的高度读取
+	ErrForkTooDeep = errors.New("fork point not found")
+)
+
+type Block struct {
+	Height int
+	Id     string
+	PrevId string
+}
+
+// Tracker 保留最近max个连续区块，非并发安全
+type Tracker struct {
+	blocks []*Block // 按高度升序且连续
+	max    int
+}
+
+func New(max int) *Tracker {
+	if max < 1 {
+		max = 1
+	}
+	return &Tracker{max: max}
+}
+
+// Tip 最高区块，尚未更新时返回nil
+func (t *Tracker) Tip() *Block {
+	if len(t.blocks) == 0 {
+		return nil
+	}
+	return t.blocks[len(t.blocks)-1]
+}
+
+// Lowest 保留的最低区块，尚未更新时返回nil
+func (t *Tracker) Lowest() *Block {
+	if len(t.blocks) == 0 {
+		return nil
+	}
+	return t.blocks[0]
+}
+
+func (t *Tracker) get(height int) *Block {
+	if len(t.blocks) == 0 {
+		return nil
+	}
+	idx := height - t.blocks[0].Height
+	if idx < 0 || idx >= len(t.blocks) {
+		return nil
+	}
+	return t.blocks[idx]
+}
+
+// Reset 丢弃已知的链，以window为准
+func (t *Tracker) Reset(window []*Block) error {
+	if err := checkContinuous(window); err != nil {
+		return err
+	}
+	t.blocks = nil
+	t.append(window)
+	return nil
+}
+
+func (t *Tracker) append(blocks []*Block) {
+	t.blocks = append(t.blocks, blocks...)
+	if n := len(t.blocks) - t.max; n > 0 {
+		t.blocks = append([]*Block(nil), t.blocks[n:]...)
+	}
+}
+
+func checkContinuous(window []*Block) error {
+	for i := 1; i < len(window); i++ {
+		if window[i].Height != window[i-1].Height+1 || window[i].PrevId != window[i-1].Id {
+			return ErrNotContinuous
+		}
+	}
+	return nil
+}
+
+// Update 用索引中按高度升序的一段区块更新链。
+// 返回被断开的区块(重组时)与新连接的区块，均按高度升序。
+// window需要包含或紧接一个已知区块，否则返回ErrForkTooDeep。
+// 索引回退但还没有新区块时暂不处理，等新区块写入后作为重组返回
+func (t *Tracker) Update(window []*Block) (disconnected, connected []*Block, err error) {
+	if len(window) == 0 {
+		return nil, nil, nil
+	}
+	if err := checkContinuous(window); err != nil {
+		return nil, nil, err
+	}
+	if len(t.blocks) == 0 {
+		t.append(window)
+		return nil, nil, nil
+	}
+
+	// 自高向低找共同区块
+	fork := -1
+	for i := len(window) - 1; i >= 0; i-- {
+		if known := t.get(window[i].Height); known != nil && known.Id == window[i].Id {
+			fork = window[i].Height
+			break
+		}
+	}
+	if fork < 0 {
+		known := t.get(window[0].Height - 1)
+		if known == nil || known.Id != window[0].PrevId {
+			return nil, nil, ErrForkTooDeep
+		}
+		fork = known.Height
+	}
+
+	for _, blk := range window {
+		if blk.Height > fork {
+			connected = append(connected, blk)
+		}
+	}
+	if len(connected) == 0 {
+		return nil, nil, nil
+	}
+	for _, blk := range t.blocks {
+		if blk.Height > fork {
+			disconnected = append(disconnected, blk)
+		}
+	}
+
+	t.blocks = t.blocks[:fork-t.blocks[0].Height+1]
+	t.append(connected)
+	return disconnected, connected, nil
+}
@@ -0,0 +1,113 @@
+package chaintip
+
+import (
+	"fmt"
+	"testing"
+)
+
+// chain 生成从height开始的连续区块，id以branch区分分叉
+func chain(prev *Block, height, n int, branch string) (blocks []*Block) {
+	prevId := ""
+	if prev != nil {
+		prevId = prev.Id
+	}
+	for i := 0; i < n; i++ {
+		blk := &Block{Height: height + i, Id: fmt.Sprintf("%s%d", branch, height+i), PrevId: prevId}
+		blocks = append(blocks, blk)
+		prevId = blk.Id
+	}
+	return blocks
+}
+
+func heights(blocks []*Block) (ret []int) {
+	for _, blk := range blocks {
+		ret = append(ret, blk.Height)
+	}
+	return ret
+}
+
+func TestUpdateNewBlocks(t *testing.T) {
+	tr := New(5)
+	base := chain(nil, 100, 3, "a")
+	if _, _, err := tr.Update(base); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重叠读取，只返回新区块
+	next := append(base[1:], chain(base[2], 103, 4, "a")...)
+	disconnected, connected, err := tr.Update(next)
+	if err != nil || len(disconnected) != 0 || fmt.Sprint(heights(connected)) != "[103 104 105 106]" {
+		t.Fatalf("got %v %v %v", heights(disconnected), heights(connected), err)
+	}
+	if tr.Tip().Id != "a106" || tr.Lowest().Height != 102 {
+		t.Fatalf("tip %v lowest %v", tr.Tip(), tr.Lowest())
+	}
+
+	// 不重叠但紧接最高区块
+	_, connected, err = tr.Update(chain(tr.Tip(), 107, 1, "a"))
+	if err != nil || fmt.Sprint(heights(connected)) != "[107]" {
+		t.Fatalf("got %v %v", heights(connected), err)
+	}
+
+	// 没有变化
+	if d, c, err := tr.Update(chain(nil, 107, 1, "a")); len(d)+len(c) != 0 || err != nil {
+		t.Fatalf("got %v %v %v", d, c, err)
+	}
+}
+
+func TestUpdateReorg(t *testing.T) {
+	tr := New(10)
+	a := chain(nil, 100, 5, "a")
+	tr.Update(a)
+
+	// 101之后分叉，新链更长
+	b := append(a[:2:2], chain(a[1], 102, 4, "b")...)
+	disconnected, connected, err := tr.Update(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(heights(disconnected)) != "[102 103 104]" || disconnected[0].Id != "a102" {
+		t.Fatalf("disconnected %v", heights(disconnected))
+	}
+	if fmt.Sprint(heights(connected)) != "[102 103 104 105]" || connected[0].Id != "b102" {
+		t.Fatalf("connected %v", heights(connected))
+	}
+	if tr.Tip().Id != "b105" {
+		t.Fatalf("tip %v", tr.Tip())
+	}
+
+	// 同高度替换最高区块
+	c := chain(tr.get(104), 105, 1, "c")
+	disconnected, connected, _ = tr.Update(c)
+	if len(disconnected) != 1 || disconnected[0].Id != "b105" || connected[0].Id != "c105" {
+		t.Fatalf("got %v %v", disconnected, connected)
+	}
+
+	// 索引回退尚无新区块，暂不处理
+	if d, c, err := tr.Update(b[:3]); len(d)+len(c) != 0 || err != nil || tr.Tip().Id != "c105" {
+		t.Fatalf("got %v %v %v tip %v", d, c, err, tr.Tip())
+	}
+}
+
+func TestUpdateErrors(t *testing.T) {
+	tr := New(3)
+	tr.Update(chain(nil, 100, 5, "a"))
+	if tr.Lowest().Height != 102 {
+		t.Fatalf("lowest %v", tr.Lowest())
+	}
+
+	broken := chain(nil, 103, 3, "a")
+	broken[2].PrevId = "x"
+	if _, _, err := tr.Update(broken); err != ErrNotContinuous {
+		t.Fatalf("want ErrNotContinuous, got %v", err)
+	}
+
+	// 分叉点低于保留的区块
+	if _, _, err := tr.Update(chain(&Block{Id: "z99"}, 100, 6, "z")); err != ErrForkTooDeep {
+		t.Fatalf("want ErrForkTooDeep, got %v", err)
+	}
+	// 与已知的链有间隔
+	if _, _, err := tr.Update(chain(&Block{Id: "a106"}, 107, 1, "a")); err != ErrForkTooDeep {
+		t.Fatalf("want ErrForkTooDeep, got %v", err)
+	}
+}
@@ -0,0 +1,151 @@
+package electrum
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScriptHash(t *testing.T) {
+	// 地址1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2
+	pkh, _ := hex.DecodeString("77bff20c60e522dfaa3350c39b030a5d004e839a")
+	script := P2PKHScript(pkh)
+	if hex.EncodeToString(script) != "76a91477bff20c60e522dfaa3350c39b030a5d004e839a88ac" {
+		t.Fatalf("script %x", script)
+	}
+	sh := ScriptHash(script)
+	if sh != "eafd9bc024177ba93572c1cc3a83f555dadbb81ca94cd9761ef5211ce794cea9" {
+		t.Fatalf("scripthash %s", sh)
+	}
+	digest, err := ParseScriptHash(sh)
+	if err != nil || hex.EncodeToString(reverse(digest)) != sh {
+		t.Fatalf("parse %x %v", digest, err)
+	}
+	for _, s := range []string{"", "zz", sh[:62]} {
+		if _, err := ParseScriptHash(s); err != ErrScriptHashInvalid {
+			t.Fatalf("%q: %v", s, err)
+		}
+	}
+}
+
+func TestStatus(t *testing.T) {
+	if Status(nil) != nil {
+		t.Fatal("empty status not nil")
+	}
+	s1 := Status([]*HistoryItem{{TxHash: "aa", Height: 10}})
+	s2 := Status([]*HistoryItem{{TxHash: "aa", Height: 10}, {TxHash: "bb", Height: 0}})
+	if s1 == nil || s2 == nil || s1 == s2 || len(s1.(string)) != 64 {
+		t.Fatalf("status %v %v", s1, s2)
+	}
+}
+
+func displayHex(hexString string) []byte {
+	data, _ := hex.DecodeString(hexString)
+	return reverse(data)
+}
+
+func TestMerkleBranch(t *testing.T) {
+	// 区块170
+	txids := [][]byte{
+		displayHex("b1fea52486ce0c62bb442b530a3f0132b826c74e473d1f2c220bfa78111c5082"),
+		displayHex("f4184fc596403b9d638783cf57adfe4c75c605f6356fbc91338530e9831e9e16"),
+	}
+	branch, root := MerkleBranch(txids, 1)
+	if hex.EncodeToString(reverse(root)) != "7dac2c5666815c17a3b36427de37bb9d2e2c5ccec3f8633eb91a4205cb4c10ff" {
+		t.Fatalf("root %x", reverse(root))
+	}
+	if len(branch) != 1 || branch[0] != "b1fea52486ce0c62bb442b530a3f0132b826c74e473d1f2c220bfa78111c5082" {
+		t.Fatalf("branch %v", branch)
+	}
+
+	// 奇数个交易时每个位置的分支都能算回同一个root
+	txids = nil
+	for i := 0; i < 7; i++ {
+		txids = append(txids, doubleSha256([]byte{byte(i)}))
+	}
+	_, want := MerkleBranch(txids, 0)
+	for pos := range txids {
+		branch, root := MerkleBranch(txids, pos)
+		h, idx := txids[pos], pos
+		for _, b := range branch {
+			sibling := displayHex(b)
+			if idx%2 == 0 {
+				h = doubleSha256(append(append([]byte{}, h...), sibling...))
+			} else {
+				h = doubleSha256(append(append([]byte{}, sibling...), h...))
+			}
+			idx /= 2
+		}
+		if !bytes.Equal(h, want) || !bytes.Equal(root, want) {
+			t.Fatalf("pos %d root mismatch", pos)
+		}
+	}
+	if branch, _ := MerkleBranch(txids[:1], 0); len(branch) != 0 {
+		t.Fatalf("single tx branch %v", branch)
+	}
+}
+
+func testHandler(ctx context.Context, method string, params []json.RawMessage) (interface{}, error) {
+	switch method {
+	case "echo":
+		if len(params) != 1 {
+			return nil, NewError(CodeInvalidParams, "invalid params")
+		}
+		return params[0], nil
+	case "null":
+		return nil, nil
+	case "fail":
+		return nil, errors.New("failed")
+	}
+	return nil, NewError(CodeMethodNotFound, "unknown method "+method)
+}
+
+func TestHandle(t *testing.T) {
+	for req, want := range map[string]string{
+		`{"jsonrpc":"2.0","id":1,"method":"echo","params":["x"]}`: `{"jsonrpc":"2.0","id":1,"result":"x"}`,
+		`{"id":"a","method":"null","params":[]}`:                  `{"jsonrpc":"2.0","id":"a","result":null}`,
+		`{"id":2,"method":"fail"}`:                                `{"jsonrpc":"2.0","id":2,"error":{"code":1,"message":"failed"}}`,
+		`{"id":3,"method":"nope"}`:                                `{"jsonrpc":"2.0","id":3,"error":{"code":-32601,"message":"unknown method nope"}}`,
+		`{"id":4,"method":"echo","params":[]}`:                    `{"jsonrpc":"2.0","id":4,"error":{"code":-32602,"message":"invalid params"}}`,
+		`{bad`:                                                    `{"jsonrpc":"2.0","id":null,"error":{"code":-32700,"message":"parse error"}}`,
+		`[{"id":1,"method":"echo","params":[1]},{"method":"null"},{"id":2,"method":"fail"}]`: `[{"jsonrpc":"2.0","id":1,"result":1},{"jsonrpc":"2.0","id":2,"error":{"code":1,"message":"failed"}}]`,
+	} {
+		if got := string(Handle(context.Background(), []byte(req), testHandler)); got != want {
+			t.Fatalf("%s: got %s want %s", req, got, want)
+		}
+	}
+	if got := Handle(context.Background(), []byte(`{"method":"null"}`), testHandler); got != nil {
+		t.Fatalf("notification got %s", got)
+	}
+}
+
+func TestSession(t *testing.T) {
+	server, client := net.Pipe()
+	sess := NewSession(NewLineConn(server, 64, time.Second, time.Second))
+	done := make(chan error, 1)
+	go func() { done <- sess.Serve(context.Background(), testHandler) }()
+
+	r := NewLineConn(client, 1024, time.Second, time.Second)
+	if err := r.WriteMessage([]byte(`{"id":1,"method":"echo","params":["hi"]}`)); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := r.ReadMessage(); err != nil || string(got) != `{"jsonrpc":"2.0","id":1,"result":"hi"}` {
+		t.Fatalf("got %s %v", got, err)
+	}
+
+	go sess.Notify("blockchain.headers.subscribe", map[string]int{"height": 1})
+	if got, err := r.ReadMessage(); err != nil || string(got) != `{"jsonrpc":"2.0","method":"blockchain.headers.subscribe","params":[{"height":1}]}` {
+		t.Fatalf("got %s %v", got, err)
+	}
+
+	r.WriteMessage([]byte(`{"id":2,"method":"echo","params":["` + strings.Repeat("x", 100) + `"]}`))
+	if err := <-done; err != ErrMessageTooLarge {
+		t.Fatalf("serve %v", err)
+	}
+}
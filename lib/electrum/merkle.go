@@ -0,0 +1,36 @@
+package electrum
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+func doubleSha256(data []byte) []byte {
+	first := sha256.Sum256(data)
+	second := sha256.Sum256(first[:])
+	return second[:]
+}
+
+// MerkleBranch 区块内第pos个交易的merkle分支及merkle root，txids为区块内按顺序排列的内部字节序txid。
+// 分支为显示字节序的十六进制，与blockchain.transaction.get_merkle一致
+func MerkleBranch(txids [][]byte, pos int) (branch []string, root []byte) {
+	if pos < 0 || pos >= len(txids) {
+		return nil, nil
+	}
+	level := make([][]byte, len(txids))
+	copy(level, txids)
+	branch = []string{}
+	for len(level) > 1 {
+		if len(level)%2 == 1 {
+			level = append(level, level[len(level)-1])
+		}
+		branch = append(branch, hex.EncodeToString(reverse(level[pos^1])))
+		next := make([][]byte, 0, len(level)/2)
+		for i := 0; i < len(level); i += 2 {
+			next = append(next, doubleSha256(append(append([]byte{}, level[i]...), level[i+1]...)))
+		}
+		level = next
+		pos /= 2
+	}
+	return branch, level[0]
+}
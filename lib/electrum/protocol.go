@@ -0,0 +1,254 @@
+// Package electrum ElectrumX兼容协议的JSON-RPC编解码、scripthash及merkle分支计算。
+//
+// 协议为JSON-RPC 2.0，TCP上每条消息以换行结尾，websocket上每帧一条消息，支持批量请求。
+// 服务端主动推送的订阅通知为不带id的请求。
+package electrum
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// 错误码，前四个为JSON-RPC定义，后两个与ElectrumX一致
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeBadRequest     = 1
+	CodeDaemonError    = 2
+)
+
+var ErrMessageTooLarge = errors.New("message too large")
+
+// Error 返回给客户端的错误
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func NewError(code int, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// Request 客户端请求，Params为位置参数数组
+type Request struct {
+	JsonRpc string            `json:"jsonrpc"`
+	Id      json.RawMessage   `json:"id"`
+	Method  string            `json:"method"`
+	Params  []json.RawMessage `json:"params"`
+}
+
+// Response 请求的响应，Error为空时为成功
+type Response struct {
+	Id     json.RawMessage
+	Result interface{}
+	Error  *Error
+}
+
+// MarshalJSON 成功时result可以为null，失败时不带result
+func (r *Response) MarshalJSON() ([]byte, error) {
+	id := r.Id
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+	if r.Error != nil {
+		return json.Marshal(struct {
+			JsonRpc string          `json:"jsonrpc"`
+			Id      json.RawMessage `json:"id"`
+			Error   *Error          `json:"error"`
+		}{"2.0", id, r.Error})
+	}
+	return json.Marshal(struct {
+		JsonRpc string          `json:"jsonrpc"`
+		Id      json.RawMessage `json:"id"`
+		Result  interface{}     `json:"result"`
+	}{"2.0", id, r.Result})
+}
+
+// Notification 订阅通知
+type Notification struct {
+	JsonRpc string        `json:"jsonrpc"`
+	Method  string        `json:"method"`
+	Params  []interface{} `json:"params"`
+}
+
+// Handler 处理一个方法调用。返回的error不是*Error时按CodeBadRequest返回其内容
+type Handler func(ctx context.Context, method string, params []json.RawMessage) (interface{}, error)
+
+func call(ctx context.Context, req *Request, h Handler) *Response {
+	resp := &Response{Id: req.Id}
+	if req.Method == "" {
+		resp.Error = NewError(CodeInvalidRequest, "invalid request")
+		return resp
+	}
+	result, err := h(ctx, req.Method, req.Params)
+	if err != nil {
+		var rpcErr *Error
+		if !errors.As(err, &rpcErr) {
+			rpcErr = NewError(CodeBadRequest, err.Error())
+		}
+		resp.Error = rpcErr
+		return resp
+	}
+	resp.Result = result
+	return resp
+}
+
+// Handle 处理一条消息，单个或批量请求，返回应发送的响应，全部为通知时返回nil
+func Handle(ctx context.Context, data []byte, h Handler) []byte {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		var raws []json.RawMessage
+		if err := json.Unmarshal(data, &raws); err != nil {
+			return marshal(&Response{Error: NewError(CodeParseError, "parse error")})
+		}
+		if len(raws) == 0 {
+			return marshal(&Response{Error: NewError(CodeInvalidRequest, "empty batch")})
+		}
+		var resps []*Response
+		for _, raw := range raws {
+			req := &Request{}
+			if err := json.Unmarshal(raw, req); err != nil {
+				resps = append(resps, &Response{Error: NewError(CodeInvalidRequest, "invalid request")})
+				continue
+			}
+			resp := call(ctx, req, h)
+			if len(req.Id) > 0 {
+				resps = append(resps, resp)
+			}
+		}
+		if len(resps) == 0 {
+			return nil
+		}
+		return marshal(resps)
+	}
+
+	req := &Request{}
+	if err := json.Unmarshal(data, req); err != nil {
+		return marshal(&Response{Error: NewError(CodeParseError, "parse error")})
+	}
+	resp := call(ctx, req, h)
+	if len(req.Id) == 0 {
+		return nil
+	}
+	return marshal(resp)
+}
+
+func marshal(v interface{}) []byte {
+	data, _ := json.Marshal(v)
+	return data
+}
+
+// Conn 一条连接上的消息收发，TCP为换行分隔，websocket为每帧一条
+type Conn interface {
+	ReadMessage() ([]byte, error)
+	WriteMessage(data []byte) error
+	Close() error
+}
+
+type lineConn struct {
+	conn         net.Conn
+	r            *bufio.Reader
+	maxSize      int
+	idleTimeout  time.Duration
+	writeTimeout time.Duration
+}
+
+// NewLineConn 换行分隔的TCP连接，单条消息超过maxSize时ReadMessage返回ErrMessageTooLarge，
+// idleTimeout内没有收到消息时返回超时错误
+func NewLineConn(conn net.Conn, maxSize int, idleTimeout, writeTimeout time.Duration) Conn {
+	return &lineConn{conn: conn, r: bufio.NewReader(conn), maxSize: maxSize,
+		idleTimeout: idleTimeout, writeTimeout: writeTimeout}
+}
+
+func (c *lineConn) ReadMessage() ([]byte, error) {
+	c.conn.SetReadDeadline(time.Now().Add(c.idleTimeout))
+	var line []byte
+	for {
+		part, isPrefix, err := c.r.ReadLine()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, part...)
+		if len(line) > c.maxSize {
+			return nil, ErrMessageTooLarge
+		}
+		if !isPrefix {
+			return line, nil
+		}
+	}
+}
+
+func (c *lineConn) WriteMessage(data []byte) error {
+	c.conn.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+	_, err := c.conn.Write(append(data, '\n'))
+	return err
+}
+
+func (c *lineConn) Close() error {
+	return c.conn.Close()
+}
+
+// Session 一个客户端连接，响应与通知的写入互斥
+type Session struct {
+	conn Conn
+	mu   sync.Mutex
+}
+
+func NewSession(conn Conn) *Session {
+	return &Session{conn: conn}
+}
+
+func (s *Session) write(data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conn.WriteMessage(data)
+}
+
+// Notify 推送订阅通知
+func (s *Session) Notify(method string, params ...interface{}) error {
+	return s.write(marshal(&Notification{JsonRpc: "2.0", Method: method, Params: params}))
+}
+
+// Close 关闭连接，Serve随之返回
+func (s *Session) Close() error {
+	return s.conn.Close()
+}
+
+// Serve 依次处理连接上的请求，直到读取失败或ctx结束，返回时连接已关闭
+func (s *Session) Serve(ctx context.Context, h Handler) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		s.conn.Close()
+	}()
+	for {
+		data, err := s.conn.ReadMessage()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		if len(bytes.TrimSpace(data)) == 0 {
+			continue
+		}
+		if resp := Handle(ctx, data, h); resp != nil {
+			if err := s.write(resp); err != nil {
+				return err
+			}
+		}
+	}
+}
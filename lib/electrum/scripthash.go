@@ -0,0 +1,59 @@
+package electrum
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+var ErrScriptHashInvalid = errors.New("scripthash invalid")
+
+// ScriptHash 锁定脚本的scripthash，为sha256按字节反序后的十六进制
+func ScriptHash(script []byte) string {
+	digest := sha256.Sum256(script)
+	return hex.EncodeToString(reverse(digest[:]))
+}
+
+// ParseScriptHash 解析scripthash，返回锁定脚本的sha256
+func ParseScriptHash(scriptHash string) ([]byte, error) {
+	digest, err := hex.DecodeString(scriptHash)
+	if err != nil || len(digest) != sha256.Size {
+		return nil, ErrScriptHashInvalid
+	}
+	return reverse(digest), nil
+}
+
+// P2PKHScript 地址的P2PKH锁定脚本
+func P2PKHScript(addressPkh []byte) []byte {
+	script := make([]byte, 0, 25)
+	script = append(script, 0x76, 0xa9, 0x14)
+	script = append(script, addressPkh...)
+	return append(script, 0x88, 0xac)
+}
+
+// HistoryItem scripthash的一条历史，Height为0表示在mempool中
+type HistoryItem struct {
+	TxHash string `json:"tx_hash"`
+	Height int    `json:"height"`
+}
+
+// Status scripthash的状态，history需按区块内顺序排列、mempool在后，没有历史时为nil
+func Status(history []*HistoryItem) interface{} {
+	if len(history) == 0 {
+		return nil
+	}
+	h := sha256.New()
+	for _, item := range history {
+		fmt.Fprintf(h, "%s:%d:", item.TxHash, item.Height)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func reverse(data []byte) []byte {
+	out := make([]byte, len(data))
+	for i, b := range data {
+		out[len(data)-1-i] = b
+	}
+	return out
+}
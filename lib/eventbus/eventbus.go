@@ -0,0 +1,112 @@
+// Package eventbus 链上事件的发布格式及输出。
+//
+// 事件按(height, txidx)排序，同一交易的多个事件共用一个offset，以seq区分。
+// 投递为at-least-once：发布方在输出成功后才记录offset，重启后从已记录的offset之后重新发布，
+// 消费方可按事件id去重。
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var ErrOffsetInvalid = errors.New("offset invalid")
+
+// Offset 事件在链上的位置，区块事件的TxIdx为区块交易数，排在区块内所有交易之后
+type Offset struct {
+	Height int
+	TxIdx  int
+}
+
+func (o Offset) String() string {
+	return strconv.Itoa(o.Height) + ":" + strconv.Itoa(o.TxIdx)
+}
+
+// Less o是否在p之前
+func (o Offset) Less(p Offset) bool {
+	if o.Height != p.Height {
+		return o.Height < p.Height
+	}
+	return o.TxIdx < p.TxIdx
+}
+
+// ParseOffset 解析height:txidx
+func ParseOffset(s string) (o Offset, err error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return o, ErrOffsetInvalid
+	}
+	if o.Height, err = strconv.Atoi(parts[0]); err != nil || o.Height < 0 {
+		return o, ErrOffsetInvalid
+	}
+	if o.TxIdx, err = strconv.Atoi(parts[1]); err != nil || o.TxIdx < -1 {
+		return o, ErrOffsetInvalid
+	}
+	return o, nil
+}
+
+// Event 发布的事件
+type Event struct {
+	Id        string      `json:"id"`             // offset:seq，重复发布时不变
+	Offset    string      `json:"offset"`         // height:txidx
+	Seq       int         `json:"seq"`            // 同一offset内的序号
+	Type      string      `json:"type"`           // 事件类型
+	Height    int         `json:"height"`         // 区块高度
+	TxIdx     int         `json:"txidx"`          // 区块内交易序号，区块事件为区块交易数
+	TxId      string      `json:"txid,omitempty"` // 交易id，区块事件为空
+	Timestamp int         `json:"timestamp"`      // 区块时间戳
+	Data      interface{} `json:"data"`
+}
+
+// Pos 事件的offset
+func (e *Event) Pos() Offset {
+	return Offset{Height: e.Height, TxIdx: e.TxIdx}
+}
+
+// Number 按顺序为事件设置offset、seq及id，events需已按offset排序
+func Number(events []*Event) {
+	seq := 0
+	for i, e := range events {
+		if i > 0 && events[i-1].Pos() == e.Pos() {
+			seq++
+		} else {
+			seq = 0
+		}
+		e.Offset = e.Pos().String()
+		e.Seq = seq
+		e.Id = fmt.Sprintf("%s:%d", e.Offset, seq)
+	}
+}
+
+// Chunks 按交易边界切分事件，每段不少于1个交易，除单个交易的事件超过size外不超过size个事件
+func Chunks(events []*Event, size int) (chunks [][]*Event) {
+	for len(events) > 0 {
+		n := size
+		if n >= len(events) {
+			n = len(events)
+		} else {
+			for n > 0 && events[n-1].Pos() == events[n].Pos() {
+				n--
+			}
+			if n == 0 {
+				// 单个交易的事件超过size，整体发布
+				n = size
+				for n < len(events) && events[n-1].Pos() == events[n].Pos() {
+					n++
+				}
+			}
+		}
+		chunks = append(chunks, events[:n])
+		events = events[n:]
+	}
+	return chunks
+}
+
+// Sink 事件输出，Publish返回nil表示所有事件已被接收
+type Sink interface {
+	Publish(ctx context.Context, events []*Event) error
+	Close() error
+}
@@ -0,0 +1,69 @@
+package eventbus
+
+import "testing"
+
+func TestParseOffset(t *testing.T) {
+	o, err := ParseOffset("700000:12")
+	if err != nil || o != (Offset{Height: 700000, TxIdx: 12}) {
+		t.Fatalf("got %v %v", o, err)
+	}
+	if o.String() != "700000:12" {
+		t.Fatalf("string %s", o.String())
+	}
+	if o, err := ParseOffset("700001:-1"); err != nil || !(Offset{700000, 12}).Less(o) {
+		t.Fatalf("got %v %v", o, err)
+	}
+	for _, s := range []string{"", "1", "a:1", "1:b", "-1:0", "1:-2", "1:2:3"} {
+		if _, err := ParseOffset(s); err != ErrOffsetInvalid {
+			t.Fatalf("%q: %v", s, err)
+		}
+	}
+}
+
+func newEvents(pos ...Offset) (events []*Event) {
+	for _, p := range pos {
+		events = append(events, &Event{Height: p.Height, TxIdx: p.TxIdx})
+	}
+	Number(events)
+	return events
+}
+
+func TestNumber(t *testing.T) {
+	events := newEvents(Offset{1, 0}, Offset{1, 3}, Offset{1, 3}, Offset{1, 5}, Offset{2, 0})
+	want := []string{"1:0:0", "1:3:0", "1:3:1", "1:5:0", "2:0:0"}
+	for i, e := range events {
+		if e.Id != want[i] {
+			t.Fatalf("event %d id %s want %s", i, e.Id, want[i])
+		}
+	}
+	if events[2].Offset != "1:3" || events[2].Seq != 1 {
+		t.Fatalf("event 2 %+v", events[2])
+	}
+}
+
+func TestChunks(t *testing.T) {
+	events := newEvents(Offset{1, 0}, Offset{1, 1}, Offset{1, 1}, Offset{1, 1}, Offset{1, 2}, Offset{1, 3})
+	sizes := func(chunks [][]*Event) (n []int) {
+		for _, c := range chunks {
+			n = append(n, len(c))
+		}
+		return n
+	}
+	for size, want := range map[int][]int{
+		1:  {1, 3, 1, 1},
+		2:  {1, 3, 2},
+		3:  {1, 3, 2},
+		4:  {4, 2},
+		10: {6},
+	} {
+		got := sizes(Chunks(events, size))
+		if len(got) != len(want) {
+			t.Fatalf("size %d: got %v want %v", size, got, want)
+		}
+		for i := range got {
+			if got[i] != want[i] {
+				t.Fatalf("size %d: got %v want %v", size, got, want)
+			}
+		}
+	}
+}
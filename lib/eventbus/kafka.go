@@ -0,0 +1,89 @@
+package eventbus
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// KafkaRestSink 通过Kafka REST Proxy(v2 API)发布到topic，以事件类型为key，同一类型的事件进入同一分区保持顺序
+type KafkaRestSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewKafkaRestSink baseUrl如http://kafka-rest:8082
+func NewKafkaRestSink(baseUrl, topic string, timeout time.Duration) (*KafkaRestSink, error) {
+	if baseUrl == "" || topic == "" {
+		return nil, errors.New("kafka url or topic empty")
+	}
+	return &KafkaRestSink{
+		url:    strings.TrimRight(baseUrl, "/") + "/topics/" + topic,
+		client: &http.Client{Timeout: timeout},
+	}, nil
+}
+
+type kafkaRecord struct {
+	Key   string `json:"key"`
+	Value *Event `json:"value"`
+}
+
+type kafkaProduceResp struct {
+	Offsets []struct {
+		Partition *int   `json:"partition"`
+		ErrorCode *int   `json:"error_code"`
+		Error     string `json:"error"`
+	} `json:"offsets"`
+}
+
+func (s *KafkaRestSink) Publish(ctx context.Context, events []*Event) error {
+	records := make([]*kafkaRecord, 0, len(events))
+	for _, e := range events {
+		records = append(records, &kafkaRecord{Key: e.Type, Value: e})
+	}
+	body, err := json.Marshal(map[string]interface{}{"records": records})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+	req.Header.Set("Accept", "application/vnd.kafka.v2+json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("kafka rest: status %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+
+	var produced kafkaProduceResp
+	if err := json.Unmarshal(data, &produced); err != nil {
+		return fmt.Errorf("kafka rest: %v", err)
+	}
+	if len(produced.Offsets) != len(events) {
+		return fmt.Errorf("kafka rest: %d offsets for %d records", len(produced.Offsets), len(events))
+	}
+	for i, o := range produced.Offsets {
+		if o.ErrorCode != nil || o.Error != "" {
+			return fmt.Errorf("kafka rest: event %s: %s", events[i].Id, o.Error)
+		}
+	}
+	return nil
+}
+
+func (s *KafkaRestSink) Close() error {
+	return nil
+}
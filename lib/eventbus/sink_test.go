@@ -0,0 +1,229 @@
+package eventbus
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+func testEvents() []*Event {
+	events := []*Event{
+		{Type: "token_transfer", Height: 10, TxIdx: 1, TxId: "aa", Data: map[string]int{"n": 1}},
+		{Type: "block", Height: 10, TxIdx: 2, Data: map[string]int{"n": 2}},
+	}
+	Number(events)
+	return events
+}
+
+func TestFileSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "eventbus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "events.jsonl")
+
+	for i := 0; i < 2; i++ {
+		sink, err := NewFileSink(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := sink.Publish(context.Background(), testEvents()); err != nil {
+			t.Fatal(err)
+		}
+		sink.Close()
+	}
+
+	data, _ := ioutil.ReadFile(path)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("got %d lines", len(lines))
+	}
+	var e Event
+	if err := json.Unmarshal([]byte(lines[3]), &e); err != nil || e.Id != "10:2:0" || e.Type != "block" {
+		t.Fatalf("line %s: %v", lines[3], err)
+	}
+}
+
+// fakeNats 最小的NATS服务端，记录收到的PUB/HPUB。
+// 带reply的发布按JetStream回复ack，subject含fail时回复错误
+func fakeNats(t *testing.T, token string, pubs chan<- string) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				fmt.Fprintf(conn, "INFO {\"server_id\":\"test\",\"proto\":1,\"headers\":true,\"max_payload\":1048576}\r\n")
+				r := bufio.NewReader(conn)
+				inboxSid := ""
+				seq := 0
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					fields := strings.Fields(line)
+					if len(fields) == 0 {
+						continue
+					}
+					switch fields[0] {
+					case "CONNECT":
+						if !strings.Contains(line, `"auth_token":"`+token+`"`) {
+							fmt.Fprintf(conn, "-ERR 'Authorization Violation'\r\n")
+							return
+						}
+					case "PING":
+						fmt.Fprintf(conn, "PONG\r\n")
+					case "SUB":
+						inboxSid = fields[len(fields)-1]
+					case "PUB", "HPUB":
+						// PUB <subject> [reply] <size>，HPUB <subject> [reply] <header size> <total size>
+						n, _ := strconv.Atoi(fields[len(fields)-1])
+						hdrLen, args := 0, fields[1:len(fields)-1]
+						if fields[0] == "HPUB" {
+							hdrLen, _ = strconv.Atoi(args[len(args)-1])
+							args = args[:len(args)-1]
+						}
+						data := make([]byte, n+2)
+						if _, err := io.ReadFull(r, data); err != nil {
+							return
+						}
+						header, payload := string(data[:hdrLen]), string(data[hdrLen:n])
+						msgId := ""
+						if idx := strings.Index(header, "Nats-Msg-Id: "); idx >= 0 {
+							msgId = strings.TrimSpace(strings.SplitN(header[idx+13:], "\r\n", 2)[0])
+						}
+						pubs <- args[0] + " " + msgId + " " + payload
+						if len(args) == 2 {
+							seq++
+							ack := fmt.Sprintf(`{"stream":"EVENTS","seq":%d}`, seq)
+							if strings.Contains(args[0], "fail") {
+								ack = `{"error":{"code":503,"err_code":10077,"description":"stream full"}}`
+							}
+							fmt.Fprintf(conn, "MSG %s %s %d\r\n%s\r\n", args[1], inboxSid, len(ack), ack)
+						}
+					}
+				}
+			}(conn)
+		}
+	}()
+	t.Cleanup(func() { ln.Close() })
+	return ln.Addr().String()
+}
+
+func TestNatsSink(t *testing.T) {
+	pubs := make(chan string, 10)
+	addr := fakeNats(t, "secret", pubs)
+
+	if _, err := NewNatsSink("http://"+addr, "sensible", "", false, time.Second); err == nil {
+		t.Fatal("http url should be rejected")
+	}
+
+	sink, err := NewNatsSink("nats://"+addr, "sensible", "secret", false, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	if err := sink.Publish(context.Background(), testEvents()); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-pubs; !strings.HasPrefix(got, `sensible.token_transfer  {"id":"10:1:0"`) {
+		t.Fatalf("got %s", got)
+	}
+	if got := <-pubs; !strings.HasPrefix(got, `sensible.block  {"id":"10:2:0"`) {
+		t.Fatalf("got %s", got)
+	}
+
+	bad, _ := NewNatsSink("nats://"+addr, "sensible", "wrong", false, time.Second)
+	if err := bad.Publish(context.Background(), testEvents()); !errors.Is(err, nats.ErrAuthorization) {
+		t.Fatalf("auth error %v", err)
+	}
+}
+
+func TestNatsSinkJetStream(t *testing.T) {
+	pubs := make(chan string, 10)
+	addr := fakeNats(t, "secret", pubs)
+
+	sink, err := NewNatsSink("nats://"+addr, "sensible", "secret", true, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	if err := sink.Publish(context.Background(), testEvents()); err != nil {
+		t.Fatal(err)
+	}
+	// 事件id作为Nats-Msg-Id
+	if got := <-pubs; !strings.HasPrefix(got, `sensible.token_transfer 10:1:0 {"id":"10:1:0"`) {
+		t.Fatalf("got %s", got)
+	}
+	if got := <-pubs; !strings.HasPrefix(got, `sensible.block 10:2:0 {"id":"10:2:0"`) {
+		t.Fatalf("got %s", got)
+	}
+
+	failing, _ := NewNatsSink("nats://"+addr, "fail", "secret", true, time.Second)
+	defer failing.Close()
+	if err := failing.Publish(context.Background(), testEvents()); err == nil || !strings.Contains(err.Error(), "10:1:0") {
+		t.Fatalf("nack error %v", err)
+	}
+}
+
+func TestKafkaRestSink(t *testing.T) {
+	var got struct {
+		Records []struct {
+			Key   string `json:"key"`
+			Value *Event `json:"value"`
+		} `json:"records"`
+	}
+	fail := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/topics/events" || r.Header.Get("Content-Type") != "application/vnd.kafka.json.v2+json" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		if fail {
+			fmt.Fprint(w, `{"offsets":[{"partition":0,"offset":1},{"partition":null,"offset":null,"error_code":50003,"error":"timeout"}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"offsets":[{"partition":0,"offset":1},{"partition":0,"offset":2}]}`)
+	}))
+	defer srv.Close()
+
+	sink, err := NewKafkaRestSink(srv.URL+"/", "events", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Publish(context.Background(), testEvents()); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Records) != 2 || got.Records[1].Key != "block" || got.Records[1].Value.Id != "10:2:0" {
+		t.Fatalf("records %+v", got.Records)
+	}
+
+	fail = true
+	if err := sink.Publish(context.Background(), testEvents()); err == nil || !strings.Contains(err.Error(), "10:2:0") {
+		t.Fatalf("partial failure %v", err)
+	}
+}
@@ -0,0 +1,264 @@
+// Package jwtauth 校验使用非对称密钥签名的JWT，密钥来自PEM公钥或JWKS文件
+package jwtauth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/golang-jwt/jwt"
+)
+
+var (
+	ErrNoKey         = errors.New("no key for token")
+	ErrMissingExpiry = errors.New("token has no exp")
+	ErrIssuer        = errors.New("token issuer not match")
+	ErrAudience      = errors.New("token audience not match")
+	ErrSubject       = errors.New("token has no sub")
+)
+
+var validMethods = []string{
+	"RS256", "RS384", "RS512",
+	"PS256", "PS384", "PS512",
+	"ES256", "ES384", "ES512",
+	"EdDSA",
+}
+
+// Claims 校验通过的token内容
+type Claims struct {
+	Subject   string
+	Scopes    []string
+	ExpiresAt int64
+	Raw       jwt.MapClaims
+}
+
+// HasScope 是否包含scope
+func (c *Claims) HasScope(scope string) bool {
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type Verifier struct {
+	Issuer     string // 不为空时校验iss
+	Audience   string // 不为空时校验aud
+	ScopeClaim string // scope所在的claim，默认为scope，值可为空格分隔的字符串或数组
+
+	keys    map[string]interface{}
+	keyList []interface{}
+}
+
+func NewVerifier(issuer, audience, scopeClaim string) *Verifier {
+	if scopeClaim == "" {
+		scopeClaim = "scope"
+	}
+	return &Verifier{
+		Issuer:     issuer,
+		Audience:   audience,
+		ScopeClaim: scopeClaim,
+		keys:       make(map[string]interface{}),
+	}
+}
+
+// Len 已加载的公钥数量
+func (v *Verifier) Len() int {
+	return len(v.keyList)
+}
+
+// AddKey 添加公钥，kid为空时只能用于header中没有kid的token
+func (v *Verifier) AddKey(kid string, key interface{}) {
+	if kid != "" {
+		v.keys[kid] = key
+	}
+	v.keyList = append(v.keyList, key)
+}
+
+// AddPEM 添加PEM格式的公钥或证书
+func (v *Verifier) AddPEM(kid string, data []byte) error {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return errors.New("invalid pem")
+	}
+	switch block.Type {
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return err
+		}
+		v.AddKey(kid, cert.PublicKey)
+	case "RSA PUBLIC KEY":
+		key, err := x509.ParsePKCS1PublicKey(block.Bytes)
+		if err != nil {
+			return err
+		}
+		v.AddKey(kid, key)
+	default:
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return err
+		}
+		v.AddKey(kid, key)
+	}
+	return nil
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(data), nil
+}
+
+func (k *jwk) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(k.X, "="))
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported kty %s", k.Kty)
+}
+
+// AddJWKS 添加JWKS中用于签名的公钥，返回添加的数量
+func (v *Verifier) AddJWKS(data []byte) (n int, err error) {
+	var set struct {
+		Keys []*jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return 0, err
+	}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return n, fmt.Errorf("jwk %s: %v", k.Kid, err)
+		}
+		v.AddKey(k.Kid, key)
+		n++
+	}
+	return n, nil
+}
+
+func (v *Verifier) keyFunc(token *jwt.Token) (interface{}, error) {
+	if kid, ok := token.Header["kid"].(string); ok && kid != "" {
+		if key, ok := v.keys[kid]; ok {
+			return key, nil
+		}
+		return nil, ErrNoKey
+	}
+	if len(v.keyList) == 1 {
+		return v.keyList[0], nil
+	}
+	return nil, ErrNoKey
+}
+
+// Verify 校验签名、有效期、iss/aud，并解析scope
+func (v *Verifier) Verify(tokenString string) (*Claims, error) {
+	parser := &jwt.Parser{ValidMethods: validMethods}
+	mapClaims := jwt.MapClaims{}
+	if _, err := parser.ParseWithClaims(tokenString, mapClaims, v.keyFunc); err != nil {
+		return nil, err
+	}
+
+	exp, ok := mapClaims["exp"].(float64)
+	if !ok {
+		return nil, ErrMissingExpiry
+	}
+	if v.Issuer != "" && !mapClaims.VerifyIssuer(v.Issuer, true) {
+		return nil, ErrIssuer
+	}
+	if v.Audience != "" && !mapClaims.VerifyAudience(v.Audience, true) {
+		return nil, ErrAudience
+	}
+	sub, _ := mapClaims["sub"].(string)
+	if sub == "" {
+		return nil, ErrSubject
+	}
+
+	claims := &Claims{
+		Subject:   sub,
+		ExpiresAt: int64(exp),
+		Raw:       mapClaims,
+	}
+	switch scopes := mapClaims[v.ScopeClaim].(type) {
+	case string:
+		claims.Scopes = strings.Fields(scopes)
+	case []interface{}:
+		for _, s := range scopes {
+			if str, ok := s.(string); ok {
+				claims.Scopes = append(claims.Scopes, str)
+			}
+		}
+	}
+	return claims, nil
+}
+
+// LooksLikeJWT 是否为JWT格式的token，用于与普通API token区分
+func LooksLikeJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
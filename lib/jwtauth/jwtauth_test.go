@@ -0,0 +1,100 @@
+package jwtauth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+)
+
+func signES256(t *testing.T, key *ecdsa.PrivateKey, kid string, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	s, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestVerifyJWKS(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	jwks := fmt.Sprintf(`{"keys":[{"kty":"EC","kid":"k1","use":"sig","crv":"P-256","x":"%s","y":"%s"}]}`,
+		base64.RawURLEncoding.EncodeToString(key.X.Bytes()),
+		base64.RawURLEncoding.EncodeToString(key.Y.Bytes()))
+
+	v := NewVerifier("issuer", "sensiblequery", "")
+	if n, err := v.AddJWKS([]byte(jwks)); err != nil || n != 1 {
+		t.Fatalf("add jwks: %d, %v", n, err)
+	}
+
+	exp := time.Now().Add(time.Hour).Unix()
+	claims, err := v.Verify(signES256(t, key, "k1", jwt.MapClaims{
+		"sub": "user1", "iss": "issuer", "aud": "sensiblequery", "exp": exp, "scope": "read push",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "user1" || !claims.HasScope("push") || claims.HasScope("admin") {
+		t.Fatalf("claims: %+v", claims)
+	}
+
+	cases := map[string]jwt.MapClaims{
+		"expired":  {"sub": "user1", "iss": "issuer", "aud": "sensiblequery", "exp": time.Now().Add(-time.Hour).Unix()},
+		"no exp":   {"sub": "user1", "iss": "issuer", "aud": "sensiblequery"},
+		"issuer":   {"sub": "user1", "iss": "other", "aud": "sensiblequery", "exp": exp},
+		"audience": {"sub": "user1", "iss": "issuer", "aud": "other", "exp": exp},
+		"no sub":   {"iss": "issuer", "aud": "sensiblequery", "exp": exp},
+	}
+	for name, c := range cases {
+		if _, err := v.Verify(signES256(t, key, "k1", c)); err == nil {
+			t.Fatalf("%s: should fail", name)
+		}
+	}
+
+	// 未知kid
+	if _, err := v.Verify(signES256(t, key, "k2", jwt.MapClaims{"sub": "user1", "iss": "issuer", "aud": "sensiblequery", "exp": exp})); err == nil {
+		t.Fatal("unknown kid should fail")
+	}
+}
+
+func TestVerifyPEM(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	data := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+
+	v := NewVerifier("", "", "scp")
+	if err := v.AddPEM("", data); err != nil {
+		t.Fatal(err)
+	}
+	claims, err := v.Verify(signES256(t, key, "", jwt.MapClaims{
+		"sub": "user2", "exp": time.Now().Add(time.Hour).Unix(), "scp": []string{"admin"},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !claims.HasScope("admin") {
+		t.Fatalf("claims: %+v", claims)
+	}
+
+	// 其他密钥签名
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if _, err := v.Verify(signES256(t, other, "", jwt.MapClaims{"sub": "user2", "exp": time.Now().Add(time.Hour).Unix()})); err == nil {
+		t.Fatal("wrong key should fail")
+	}
+}
+
+func TestLooksLikeJWT(t *testing.T) {
+	if LooksLikeJWT("9a48a35a8dadd8b54d3859865b292aa6") || !LooksLikeJWT("a.b.c") {
+		t.Fatal("LooksLikeJWT")
+	}
+}
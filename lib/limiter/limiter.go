@@ -0,0 +1,146 @@
+// Package limiter 带有限等待队列的并发限制。排队的请求按优先级先后执行，
+// 队列满时新请求可挤出优先级更低的排队请求
+package limiter
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"sync"
+)
+
+var (
+	ErrQueueFull = errors.New("queue full")
+	ErrEvicted   = errors.New("evicted by higher priority request")
+)
+
+type waiter struct {
+	priority int
+	seq      uint64
+	index    int        // 在队列中的位置，-1为已出队
+	ready    chan error // 出队时写入结果，nil为获得执行许可
+}
+
+// waitQueue 按priority降序、seq升序
+type waitQueue []*waiter
+
+func (q waitQueue) Len() int { return len(q) }
+func (q waitQueue) Less(i, j int) bool {
+	if q[i].priority != q[j].priority {
+		return q[i].priority > q[j].priority
+	}
+	return q[i].seq < q[j].seq
+}
+func (q waitQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+func (q *waitQueue) Push(x interface{}) {
+	w := x.(*waiter)
+	w.index = len(*q)
+	*q = append(*q, w)
+}
+func (q *waitQueue) Pop() interface{} {
+	old := *q
+	w := old[len(old)-1]
+	old[len(old)-1] = nil
+	w.index = -1
+	*q = old[:len(old)-1]
+	return w
+}
+
+type Limiter struct {
+	concurrency int
+	maxQueue    int
+
+	mu      sync.Mutex
+	running int
+	seq     uint64
+	queue   waitQueue
+}
+
+// New 最多concurrency个请求同时执行，最多maxQueue个请求排队
+func New(concurrency, maxQueue int) *Limiter {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	if maxQueue < 0 {
+		maxQueue = 0
+	}
+	return &Limiter{concurrency: concurrency, maxQueue: maxQueue}
+}
+
+// lowest 优先级最低、最晚入队的排队请求
+func (l *Limiter) lowest() *waiter {
+	var ret *waiter
+	for _, w := range l.queue {
+		if ret == nil || w.priority < ret.priority || w.priority == ret.priority && w.seq > ret.seq {
+			ret = w
+		}
+	}
+	return ret
+}
+
+// Acquire 获取执行许可，成功后须调用Release。
+// 队列已满返回ErrQueueFull，被挤出返回ErrEvicted，ctx结束返回ctx.Err()
+func (l *Limiter) Acquire(ctx context.Context, priority int) error {
+	l.mu.Lock()
+	if l.running < l.concurrency && len(l.queue) == 0 {
+		l.running++
+		l.mu.Unlock()
+		return nil
+	}
+	if len(l.queue) >= l.maxQueue {
+		low := l.lowest()
+		if low == nil || low.priority >= priority {
+			l.mu.Unlock()
+			return ErrQueueFull
+		}
+		heap.Remove(&l.queue, low.index)
+		low.ready <- ErrEvicted
+	}
+	l.seq++
+	w := &waiter{priority: priority, seq: l.seq, ready: make(chan error, 1)}
+	heap.Push(&l.queue, w)
+	l.mu.Unlock()
+
+	select {
+	case err := <-w.ready:
+		return err
+	case <-ctx.Done():
+	}
+
+	l.mu.Lock()
+	if w.index >= 0 {
+		heap.Remove(&l.queue, w.index)
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+	l.mu.Unlock()
+	// 已出队，许可已分配时归还
+	if err := <-w.ready; err != nil {
+		return err
+	}
+	l.Release()
+	return ctx.Err()
+}
+
+// Release 归还许可，交给优先级最高的排队请求
+func (l *Limiter) Release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.queue) > 0 {
+		w := heap.Pop(&l.queue).(*waiter)
+		w.ready <- nil
+		return
+	}
+	l.running--
+}
+
+// Stats 正在执行及排队的请求数
+func (l *Limiter) Stats() (running, queued int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.running, len(l.queue)
+}
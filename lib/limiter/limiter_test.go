@@ -0,0 +1,85 @@
+package limiter
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// acquireAsync 在后台排队，等到进入队列后返回结果通道
+func acquireAsync(t *testing.T, l *Limiter, ctx context.Context, priority, queued int) chan error {
+	ret := make(chan error, 1)
+	go func() { ret <- l.Acquire(ctx, priority) }()
+	for i := 0; i < 1000; i++ {
+		if _, n := l.Stats(); n >= queued {
+			return ret
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("request not queued")
+	return nil
+}
+
+func TestPriorityOrder(t *testing.T) {
+	ctx := context.Background()
+	l := New(1, 3)
+	if err := l.Acquire(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	low := acquireAsync(t, l, ctx, 0, 1)
+	high := acquireAsync(t, l, ctx, 2, 2)
+	mid := acquireAsync(t, l, ctx, 1, 3)
+
+	for _, next := range []chan error{high, mid, low} {
+		l.Release()
+		if err := <-next; err != nil {
+			t.Fatal(err)
+		}
+	}
+	l.Release()
+	if running, queued := l.Stats(); running != 0 || queued != 0 {
+		t.Fatalf("running %d queued %d", running, queued)
+	}
+}
+
+func TestQueueFullAndEvict(t *testing.T) {
+	ctx := context.Background()
+	l := New(1, 1)
+	l.Acquire(ctx, 0)
+
+	low := acquireAsync(t, l, ctx, 0, 1)
+	if err := l.Acquire(ctx, 0); err != ErrQueueFull {
+		t.Fatalf("want ErrQueueFull, got %v", err)
+	}
+
+	// 高优先级挤出排队的低优先级请求
+	high := acquireAsync(t, l, ctx, 1, 1)
+	if err := <-low; err != ErrEvicted {
+		t.Fatalf("want ErrEvicted, got %v", err)
+	}
+	l.Release()
+	if err := <-high; err != nil {
+		t.Fatal(err)
+	}
+	l.Release()
+}
+
+func TestWaitTimeout(t *testing.T) {
+	l := New(1, 2)
+	l.Acquire(context.Background(), 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.Acquire(ctx, 0); err != context.DeadlineExceeded {
+		t.Fatalf("want deadline exceeded, got %v", err)
+	}
+	if _, queued := l.Stats(); queued != 0 {
+		t.Fatalf("timed out request still queued: %d", queued)
+	}
+
+	l.Release()
+	if running, _ := l.Stats(); running != 0 {
+		t.Fatalf("running %d", running)
+	}
+}
@@ -0,0 +1,443 @@
+// Package metrics 定义服务的Prometheus指标，由midware、dao等各层上报
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"time"
+
+	redis "github.com/go-redis/redis/v8"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "sensiblequery"
+
+var (
+	// http
+	HttpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route pattern, status code and biz code.",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"route", "method", "status", "code"})
+
+	HttpRequestsInFlight = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "http_requests_in_flight",
+		Help:      "HTTP requests being served.",
+	})
+
+	// clickhouse
+	ClickhouseQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "clickhouse_query_duration_seconds",
+		Help:      "ClickHouse query latency by operation and main table.",
+		Buckets:   []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"op", "table"})
+
+	ClickhouseQueryErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "clickhouse_query_errors_total",
+		Help:      "ClickHouse query errors by operation and main table.",
+	}, []string{"op", "table"})
+
+	ClickhouseReplicaUp = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "clickhouse_replica_up",
+		Help:      "1 if the ClickHouse replica is reachable and not lagging.",
+	}, []string{"address", "group"})
+
+	ClickhouseReplicaHeight = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "clickhouse_replica_height",
+		Help:      "Max blk_height height on the ClickHouse replica.",
+	}, []string{"address", "group"})
+
+	ClickhouseReplicaRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "clickhouse_replica_retries_total",
+		Help:      "Read queries retried on another replica after failing on this one.",
+	}, []string{"address", "group"})
+
+	// redis
+	RedisCommandDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "redis_command_duration_seconds",
+		Help:      "Redis command and pipeline latency by client. Pipelines use cmd=\"pipeline\".",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"client", "cmd"})
+
+	RedisPipelineSize = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "redis_pipeline_commands",
+		Help:      "Number of commands per Redis pipeline.",
+		Buckets:   prometheus.ExponentialBuckets(1, 4, 8),
+	}, []string{"client"})
+
+	RedisErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "redis_errors_total",
+		Help:      "Redis command errors by client, excluding redis.Nil.",
+	}, []string{"client"})
+
+	// indexer
+	IndexHeight = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "index_height",
+		Help:      "Best block height in the index.",
+	})
+
+	NodeHeight = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "node_height",
+		Help:      "Block count reported by bitcoind.",
+	})
+
+	IndexLagBlocks = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "index_lag_blocks",
+		Help:      "Blocks the index is behind bitcoind.",
+	})
+
+	IndexTipAge = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "index_tip_age_seconds",
+		Help:      "Seconds since the blocktime of the best indexed block.",
+	})
+
+	IndexDegraded = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "index_degraded",
+		Help:      "1 if the index lag is past the configured limit.",
+	})
+
+	IndexCheckErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "index_check_errors_total",
+		Help:      "Failed index lag checks.",
+	})
+
+	// utxo fallback
+	UtxoBreakerState = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "utxo_breaker_state",
+		Help:      "UTXO redis circuit breaker state: 0 closed, 1 open, 2 half-open.",
+	})
+
+	UtxoFallbacks = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "utxo_fallback_total",
+		Help:      "Address UTXO requests served from ClickHouse.",
+	})
+
+	// concurrency limit
+	ConcurrencyRunning = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "concurrency_running",
+		Help:      "Requests running in each concurrency group.",
+	}, []string{"group"})
+
+	ConcurrencyQueued = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "concurrency_queued",
+		Help:      "Requests waiting in each concurrency group queue.",
+	}, []string{"group"})
+
+	ConcurrencyWait = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "concurrency_wait_seconds",
+		Help:      "Time requests waited in the concurrency group queue before running.",
+		Buckets:   []float64{.001, .005, .01, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"group"})
+
+	ConcurrencyRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "concurrency_rejected_total",
+		Help:      "Requests shed by concurrency group, reason queue_full, timeout or evicted.",
+	}, []string{"group", "reason"})
+
+	// address subscriptions
+	SubscriptionConnections = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "subscription_connections",
+		Help:      "Open address subscription connections by transport.",
+	}, []string{"transport"})
+
+	SubscribedAddresses = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "subscribed_addresses",
+		Help:      "Distinct addresses watched for subscriptions.",
+	})
+
+	SubscriptionEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "subscription_events_total",
+		Help:      "Events pushed to subscribers by type.",
+	}, []string{"type"})
+
+	BlockStreamConnections = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "block_stream_connections",
+		Help:      "Open block event stream connections by transport.",
+	}, []string{"transport"})
+
+	BlockStreamEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "block_stream_events_total",
+		Help:      "Block and reorg events published to block streams.",
+	}, []string{"type"})
+
+	BlockReorgDepth = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "block_reorg_depth",
+		Help:      "Blocks disconnected by each detected reorg.",
+		Buckets:   []float64{1, 2, 3, 5, 10, 20, 50, 100},
+	})
+
+	WebhookEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_events_total",
+		Help:      "Webhook events queued for delivery by trigger type.",
+	}, []string{"type"})
+
+	WebhookDeliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_deliveries_total",
+		Help:      "Webhook delivery attempts by result: ok, retry or dead.",
+	}, []string{"result"})
+
+	WebhookDeliveryDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "webhook_delivery_seconds",
+		Help:      "Webhook delivery request latency.",
+		Buckets:   []float64{.01, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	})
+
+	WebhookWatchers = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "webhook_watchers",
+		Help:      "Registered webhooks being watched by this instance.",
+	})
+
+	SubscriptionPoll = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "subscription_poll_seconds",
+		Help:      "Time to snapshot and diff all watched addresses.",
+		Buckets:   []float64{.001, .005, .01, .05, .1, .25, .5, 1, 2.5, 5},
+	})
+
+	// response cache
+	CacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_requests_total",
+		Help:      "Requests to routes with response cache.",
+	}, []string{"route"})
+
+	CacheHits = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_hits_total",
+		Help:      "Requests served from response cache.",
+	}, []string{"route"})
+
+	EventBusEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "eventbus_events_total",
+		Help:      "Events published to event bus sinks.",
+	}, []string{"sink", "type"})
+
+	EventBusHeight = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "eventbus_height",
+		Help:      "Highest block fully published to each event bus sink.",
+	}, []string{"sink"})
+
+	EventBusErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "eventbus_errors_total",
+		Help:      "Failed event bus publish attempts.",
+	}, []string{"sink"})
+
+	ElectrumSessions = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "electrum_sessions",
+		Help:      "Open Electrum protocol sessions by transport.",
+	}, []string{"transport"})
+
+	ElectrumRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "electrum_requests_total",
+		Help:      "Electrum protocol requests by method and result.",
+	}, []string{"method", "result"})
+
+	ElectrumIndexHeight = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "electrum_index_height",
+		Help:      "Highest block included in the scripthash index.",
+	})
+
+	ElectrumIndexErrors = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "electrum_index_errors_total",
+		Help:      "Failed scripthash index updates.",
+	})
+
+	RpcProxyRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rpc_proxy_requests_total",
+		Help:      "JSON-RPC calls through /rpc by method and result.",
+	}, []string{"method", "result"})
+
+	// zmq
+	ZmqMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "zmq_messages_total",
+		Help:      "bitcoind ZMQ notifications received by topic.",
+	}, []string{"topic"})
+
+	ZmqMissed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "zmq_missed_total",
+		Help:      "bitcoind ZMQ notifications missed by topic, from sequence gaps.",
+	}, []string{"topic"})
+
+	ZmqReconnects = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "zmq_reconnects_total",
+		Help:      "bitcoind ZMQ subscriber reconnects by address.",
+	}, []string{"address"})
+
+	// bitcoind
+	BitcoindNodeUp = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "bitcoind_node_up",
+		Help:      "1 if the bitcoind rpc node answered the last probe and is not lagging.",
+	}, []string{"node"})
+
+	BitcoindNodeHeight = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "bitcoind_node_height",
+		Help:      "getblockcount of the bitcoind rpc node at the last probe.",
+	}, []string{"node"})
+)
+
+// Handler /metrics
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// ObserveClickhouse 记录一次ClickHouse查询
+func ObserveClickhouse(op, table string, start time.Time, err error) {
+	ClickhouseQueryDuration.WithLabelValues(op, table).Observe(time.Since(start).Seconds())
+	if err != nil {
+		ClickhouseQueryErrors.WithLabelValues(op, table).Inc()
+	}
+}
+
+// RegisterDBPool 导出sql.DB连接池状态
+func RegisterDBPool(name string, db *sql.DB) {
+	labels := prometheus.Labels{"db": name}
+	gauges := map[string]func(s sql.DBStats) float64{
+		"open":   func(s sql.DBStats) float64 { return float64(s.OpenConnections) },
+		"in_use": func(s sql.DBStats) float64 { return float64(s.InUse) },
+		"idle":   func(s sql.DBStats) float64 { return float64(s.Idle) },
+	}
+	for state, f := range gauges {
+		f := f
+		promauto.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Name:        "db_pool_connections_" + state,
+			Help:        "sql.DB connections in state " + state + ".",
+			ConstLabels: labels,
+		}, func() float64 { return f(db.Stats()) })
+	}
+	promauto.NewCounterFunc(prometheus.CounterOpts{
+		Namespace:   namespace,
+		Name:        "db_pool_wait_total",
+		Help:        "Total number of connections waited for.",
+		ConstLabels: labels,
+	}, func() float64 { return float64(db.Stats().WaitCount) })
+	promauto.NewCounterFunc(prometheus.CounterOpts{
+		Namespace:   namespace,
+		Name:        "db_pool_wait_seconds_total",
+		Help:        "Total time blocked waiting for a new connection.",
+		ConstLabels: labels,
+	}, func() float64 { return db.Stats().WaitDuration.Seconds() })
+}
+
+type poolStater interface {
+	PoolStats() *redis.PoolStats
+}
+
+// RegisterRedisPool 导出redis连接池状态
+func RegisterRedisPool(name string, client poolStater) {
+	labels := prometheus.Labels{"client": name}
+	gauges := map[string]func(s *redis.PoolStats) float64{
+		"total": func(s *redis.PoolStats) float64 { return float64(s.TotalConns) },
+		"idle":  func(s *redis.PoolStats) float64 { return float64(s.IdleConns) },
+	}
+	for state, f := range gauges {
+		f := f
+		promauto.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Name:        "redis_pool_connections_" + state,
+			Help:        "Redis pool connections in state " + state + ".",
+			ConstLabels: labels,
+		}, func() float64 { return f(client.PoolStats()) })
+	}
+	counters := map[string]func(s *redis.PoolStats) float64{
+		"hits":     func(s *redis.PoolStats) float64 { return float64(s.Hits) },
+		"misses":   func(s *redis.PoolStats) float64 { return float64(s.Misses) },
+		"timeouts": func(s *redis.PoolStats) float64 { return float64(s.Timeouts) },
+	}
+	for kind, f := range counters {
+		f := f
+		promauto.NewCounterFunc(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Name:        "redis_pool_" + kind + "_total",
+			Help:        "Redis pool " + kind + ".",
+			ConstLabels: labels,
+		}, func() float64 { return f(client.PoolStats()) })
+	}
+}
+
+type redisStartKey struct{}
+
+// RedisHook 统计redis命令与pipeline的延迟和错误
+type RedisHook struct {
+	Client string
+}
+
+func (h RedisHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, redisStartKey{}, time.Now()), nil
+}
+
+func (h RedisHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	if start, ok := ctx.Value(redisStartKey{}).(time.Time); ok {
+		RedisCommandDuration.WithLabelValues(h.Client, cmd.Name()).Observe(time.Since(start).Seconds())
+	}
+	if err := cmd.Err(); err != nil && err != redis.Nil {
+		RedisErrors.WithLabelValues(h.Client).Inc()
+	}
+	return nil
+}
+
+func (h RedisHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, redisStartKey{}, time.Now()), nil
+}
+
+func (h RedisHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	if start, ok := ctx.Value(redisStartKey{}).(time.Time); ok {
+		RedisCommandDuration.WithLabelValues(h.Client, "pipeline").Observe(time.Since(start).Seconds())
+	}
+	RedisPipelineSize.WithLabelValues(h.Client).Observe(float64(len(cmds)))
+	for _, cmd := range cmds {
+		if err := cmd.Err(); err != nil && err != redis.Nil {
+			RedisErrors.WithLabelValues(h.Client).Inc()
+			break
+		}
+	}
+	return nil
+}
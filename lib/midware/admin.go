@@ -0,0 +1,37 @@
+package midware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"sensiblequery/lib/jwtauth"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// VerifyAdminToken 管理接口鉴权，与普通API token相互独立。启用JWT时也可使用带admin scope的JWT
+func VerifyAdminToken(adminToken string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		auth := c.GetHeader("Authorization")
+		if !strings.HasPrefix(auth, "Bearer ") {
+			c.JSON(http.StatusUnauthorized, &Response{Code: -1, Msg: "Must provide Authorization header with format `Bearer {token}`"})
+			c.Abort()
+			return
+		}
+
+		token := strings.TrimPrefix(auth, "Bearer ")
+		if jwtVerifier != nil && jwtauth.LooksLikeJWT(token) {
+			if _, ok := verifyJWT(c, token, ScopeAdmin); !ok {
+				return
+			}
+			c.Next()
+			return
+		}
+		if adminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+			c.JSON(http.StatusForbidden, &Response{Code: -1, Msg: "invalid admin token"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,147 @@
+package midware
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"sensiblequery/lib/limiter"
+	"sensiblequery/lib/metrics"
+	"sensiblequery/logger"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// 未列入其他分组的路由使用该分组，未配置时不限制
+const defaultConcurrencyGroup = "default"
+
+// ConcurrencyGroup 一组路由共享的并发预算
+type ConcurrencyGroup struct {
+	Name        string        `mapstructure:"name"`
+	Concurrency int           `mapstructure:"concurrency"` // 同时执行的请求数
+	Queue       int           `mapstructure:"queue"`       // 排队请求数上限
+	Wait        time.Duration `mapstructure:"wait"`        // 最长排队时间，默认1s
+	Routes      []string      `mapstructure:"routes"`      // 路由模式
+
+	limiter *limiter.Limiter
+}
+
+var (
+	concurrencyGroups = map[string]*ConcurrencyGroup{} // 路由模式 => 分组
+	defaultGroup      *ConcurrencyGroup
+	// 按套餐的排队优先级，数值大的先执行，未配置的套餐为0
+	planPriority = map[string]int{}
+)
+
+func init() {
+	initConcurrency("conf/concurrency.yaml")
+}
+
+// initConcurrency 读取可选的并发限制配置
+func initConcurrency(filename string) {
+	if _, err := os.Stat(filename); err != nil {
+		return
+	}
+	v := viper.New()
+	v.SetConfigFile(filename)
+	if err := v.ReadInConfig(); err != nil {
+		panic(fmt.Errorf("Fatal error config file: %s \n", err))
+	}
+
+	var groups []*ConcurrencyGroup
+	if err := v.UnmarshalKey("groups", &groups); err != nil {
+		panic(fmt.Errorf("Fatal error config file: %s \n", err))
+	}
+	for _, group := range groups {
+		if group.Concurrency <= 0 {
+			panic(fmt.Errorf("Fatal error config file: %s: group %s: concurrency must be positive \n", filename, group.Name))
+		}
+		if group.Wait <= 0 {
+			group.Wait = time.Second
+		}
+		group.limiter = limiter.New(group.Concurrency, group.Queue)
+		if group.Name == defaultConcurrencyGroup {
+			defaultGroup = group
+		}
+		for _, route := range group.Routes {
+			concurrencyGroups[route] = group
+		}
+	}
+	for plan, priority := range v.GetStringMap("priority") {
+		if n, err := strconv.Atoi(fmt.Sprint(priority)); err == nil {
+			planPriority[plan] = n
+		}
+	}
+}
+
+func getConcurrencyGroup(route string) *ConcurrencyGroup {
+	if group, ok := concurrencyGroups[route]; ok {
+		return group
+	}
+	return defaultGroup
+}
+
+func (g *ConcurrencyGroup) observe() {
+	running, queued := g.limiter.Stats()
+	metrics.ConcurrencyRunning.WithLabelValues(g.Name).Set(float64(running))
+	metrics.ConcurrencyQueued.WithLabelValues(g.Name).Set(float64(queued))
+}
+
+// ConcurrencyLimit 按路由分组限制并发，超出预算时排队，排不上或等待超时直接返回503。
+// 需要在鉴权之后，按token套餐确定排队优先级
+func ConcurrencyLimit() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		group := getConcurrencyGroup(c.FullPath())
+		if group == nil {
+			c.Next()
+			return
+		}
+		priority := planPriority[c.GetString(PlanKey)]
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), group.Wait)
+		defer cancel()
+
+		start := time.Now()
+		err := group.limiter.Acquire(ctx, priority)
+		group.observe()
+		if err != nil {
+			// 客户端已断开不计为拒绝
+			if c.Request.Context().Err() != nil {
+				c.Abort()
+				return
+			}
+			reason := "timeout"
+			if err == limiter.ErrQueueFull {
+				reason = "queue_full"
+			} else if err == limiter.ErrEvicted {
+				reason = "evicted"
+			}
+			metrics.ConcurrencyRejected.WithLabelValues(group.Name, reason).Inc()
+			logger.Ctx(c).Info("request shed",
+				zap.String("group", group.Name),
+				zap.String("reason", reason),
+				zap.Int("priority", priority),
+			)
+			retryAfter := int64(math.Ceil(group.Wait.Seconds()))
+			if retryAfter < 1 {
+				retryAfter = 1
+			}
+			c.Header("Retry-After", strconv.FormatInt(retryAfter, 10))
+			c.JSON(http.StatusServiceUnavailable, &Response{Code: -1, Msg: "server busy"})
+			c.Abort()
+			return
+		}
+		metrics.ConcurrencyWait.WithLabelValues(group.Name).Observe(time.Since(start).Seconds())
+
+		defer func() {
+			group.limiter.Release()
+			group.observe()
+		}()
+		c.Next()
+	}
+}
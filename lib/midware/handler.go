@@ -2,12 +2,18 @@ package midware
 
 import (
 	"bytes"
-	"net/http"
 	"encoding/json"
+	"sensiblequery/dao/clickhouse"
+	"sensiblequery/lib/metrics"
+	"sensiblequery/lib/settings"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	cache "github.com/chenyahui/gin-cache"
+	"github.com/chenyahui/gin-cache/persist"
 	"github.com/gin-gonic/gin"
 )
 
@@ -48,11 +54,14 @@ func getUrlPattern(urlPattern string, params gin.Params) string {
 	return urlPattern
 }
 
+// StreamPaths 推送长连接接口，不统计、不缓存响应内容
+var StreamPaths = map[string]bool{"/ws": true, "/sse": true, "/ws/blocks": true, "/sse/blocks": true, "/electrum": true}
+
 func Metrics() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		path := c.Request.URL.Path
-		if strings.HasPrefix(path, "/health/") || strings.HasPrefix(path, "/metrics") {
-			// 不记录统计数据
+		if strings.HasPrefix(path, "/health/") || strings.HasPrefix(path, "/metrics") || StreamPaths[path] {
+			// 不记录统计数据，推送长连接不缓存响应内容
 			c.Next() // Process request
 			return
 		}
@@ -61,8 +70,8 @@ func Metrics() gin.HandlerFunc {
 		wrapWriter := &responseBodyWriter{body: &bytes.Buffer{}, ResponseWriter: c.Writer}
 		c.Writer = wrapWriter // duplicate response body
 
-		ServiceMetrics.Inc("flight", "in") // 统计正在运行的接口
-		defer ServiceMetrics.Dec("flight", "in")
+		metrics.HttpRequestsInFlight.Inc() // 统计正在运行的接口
+		defer metrics.HttpRequestsInFlight.Dec()
 
 		c.Next() // Process request
 
@@ -79,38 +88,86 @@ func Metrics() gin.HandlerFunc {
 
 		// 跟新监控
 		if isMetricsOn {
-			ServiceMetrics.Observe("all", "visit", latency)                          // 对所有进来的请求统计计数
-			ServiceMetrics.Observe(strconv.Itoa(statusCode), "httpcode", latency)  // 对所有进来的请求按 Http Code 进行统计计数
-			ServiceMetrics.Observe(strconv.Itoa(bizCode), "bizcode", latency) // 对所有进来的请求按 Biz Code 进行统计计数
-			if statusCode != 404 {
-				urlPattern := getUrlPattern(path, c.Params)
-				ServiceMetrics.Observe(urlPattern, "url", latency)                    // 对所有进来的请求按 Http URL 进行统计计数
-				ServiceMetrics.Observe(strconv.Itoa(bizCode)+urlPattern, "bizcode-url", latency)
+			route := c.FullPath() // 路由模式，如/address/:address/utxo
+			if route == "" {
+				route = "unmatched"
 			}
+			metrics.HttpRequestDuration.WithLabelValues(
+				route, c.Request.Method, strconv.Itoa(statusCode), strconv.Itoa(bizCode),
+			).Observe(latency.Seconds())
 		}
 	}
 }
 
+var (
+	cacheTip    atomic.Value // string
+	cacheTipped = map[string]bool{}
+)
 
-func CreateMetricsEndpoint(adminGinWeb gin.IRouter) {
-	adminGinWeb.GET("/metrics", fetchMetricsSummary)
-	adminGinWeb.GET("/metrics/:time/:type/:stage", fetchMetrics)
+// SetRouteCacheByTip 路由的响应随索引的最高区块变化，缓存key带上最高区块ID，pattern为gin的路由模式
+func SetRouteCacheByTip(pattern string) {
+	cacheTipped[pattern] = true
+}
+
+// SetCacheTip 索引的最高区块变化时调用，SetRouteCacheByTip的路由之前缓存的响应不再命中。
+// 多个实例索引到同一区块时共用缓存
+func SetCacheTip(blkIdHex string) {
+	if len(blkIdHex) > 16 {
+		// 区块ID开头为0，取末尾
+		blkIdHex = blkIdHex[len(blkIdHex)-16:]
+	}
+	cacheTip.Store(blkIdHex)
+}
+
+func cacheKey(c *gin.Context) string {
+	if tip, _ := cacheTip.Load().(string); tip != "" && cacheTipped[c.FullPath()] {
+		return tip + ":" + c.Request.RequestURI
+	}
+	return c.Request.RequestURI
 }
 
-func fetchMetricsSummary(c *gin.Context) {
-	timeFilter := "minute"
-	typeFilter := "url"
-	stageFilter := "past"
+// CacheByRequestURI 带命中率统计的接口缓存。expire为默认缓存时长，
+// 可由runtime.yaml中按路由配置的时长覆盖，重新加载后生效，0为不缓存
+func CacheByRequestURI(store persist.CacheStore, expire time.Duration) gin.HandlerFunc {
+	var (
+		mu       sync.Mutex
+		handlers = map[time.Duration]gin.HandlerFunc{}
+	)
+	handlerFor := func(ttl time.Duration) gin.HandlerFunc {
+		mu.Lock()
+		defer mu.Unlock()
+		handler, ok := handlers[ttl]
+		if !ok {
+			handler = cache.Cache(store, ttl, cache.WithCacheStrategyByRequest(func(c *gin.Context) (bool, cache.Strategy) {
+				return true, cache.Strategy{CacheKey: cacheKey(c)}
+			}), cache.WithOnHitCache(func(c *gin.Context) {
+				metrics.CacheHits.WithLabelValues(c.FullPath()).Inc()
+			}))
+			handlers[ttl] = handler
+		}
+		return handler
+	}
 
-	metrics := ServiceMetrics.Dump(timeFilter, typeFilter, stageFilter)
-	c.String(http.StatusOK, metrics)
+	return func(c *gin.Context) {
+		ttl := settings.CacheTTL(c.FullPath(), expire)
+		if ttl <= 0 {
+			c.Next()
+			return
+		}
+		metrics.CacheRequests.WithLabelValues(c.FullPath()).Inc()
+		handlerFor(ttl)(c)
+	}
 }
 
-func fetchMetrics(c *gin.Context) {
-	timeFilter := c.Param("time")
-	typeFilter := c.Param("type")
-	stageFilter := c.Param("stage")
+// CreateMetricsEndpoint Prometheus指标，应注册在内部管理端口上
+func CreateMetricsEndpoint(adminGinWeb gin.IRouter) {
+	adminGinWeb.GET("/metrics", gin.WrapH(metrics.Handler()))
+}
 
-	metrics := ServiceMetrics.Dump(timeFilter, typeFilter, stageFilter)
-	c.String(http.StatusOK, metrics)
+// QueryRoute 在请求ctx中记录路由模式，ClickHouse查询据此选择查询限制并记录慢查询来源
+func QueryRoute() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request = c.Request.WithContext(clickhouse.WithRoute(c.Request.Context(), c.FullPath()))
+		c.Next()
+	}
 }
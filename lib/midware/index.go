@@ -0,0 +1,25 @@
+package midware
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	IndexHeightHeader = "X-Index-Height"
+	IndexStaleHeader  = "X-Index-Stale"
+)
+
+// IndexHeader 在响应头X-Index-Height中返回当前索引高度，索引落后超过阈值时返回X-Index-Stale: 1
+func IndexHeader(height func() int, degraded func() bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if h := height(); h >= 0 {
+			c.Header(IndexHeightHeader, strconv.Itoa(h))
+			if degraded() {
+				c.Header(IndexStaleHeader, "1")
+			}
+		}
+		c.Next()
+	}
+}
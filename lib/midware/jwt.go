@@ -0,0 +1,144 @@
+package midware
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sensiblequery/lib/jwtauth"
+	"sensiblequery/logger"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+const (
+	AuthSchemeJwt = "jwt"
+
+	ScopeRead  = "read"
+	ScopePush  = "push"
+	ScopeAdmin = "admin"
+
+	// ClaimsKey gin.Context中保存JWT claims的key
+	ClaimsKey = "jwtClaims"
+)
+
+var (
+	jwtVerifier *jwtauth.Verifier
+	jwtQuota    bool // 是否对JWT的sub执行配额与限流检查
+
+	routeScopes = map[string]string{}
+)
+
+type jwtKeyConf struct {
+	Kid  string `mapstructure:"kid"`
+	File string `mapstructure:"file"`
+}
+
+func init() {
+	filename := "conf/jwt.yaml"
+	if _, err := os.Stat(filename); err != nil {
+		return
+	}
+	v := viper.New()
+	v.SetConfigFile(filename)
+	if err := v.ReadInConfig(); err != nil {
+		panic(fmt.Errorf("Fatal error config file: %s \n", err))
+	}
+
+	verifier := jwtauth.NewVerifier(v.GetString("issuer"), v.GetString("audience"), v.GetString("scopeClaim"))
+	var keys []*jwtKeyConf
+	if err := v.UnmarshalKey("keys", &keys); err != nil {
+		panic(fmt.Errorf("Fatal error config file: %s \n", err))
+	}
+	for _, key := range keys {
+		data, err := ioutil.ReadFile(key.File)
+		if err != nil {
+			panic(fmt.Errorf("Fatal error jwt key file: %s \n", err))
+		}
+		if err := verifier.AddPEM(key.Kid, data); err != nil {
+			panic(fmt.Errorf("Fatal error jwt key file %s: %s \n", key.File, err))
+		}
+	}
+	for _, file := range v.GetStringSlice("jwks") {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			panic(fmt.Errorf("Fatal error jwks file: %s \n", err))
+		}
+		if _, err := verifier.AddJWKS(data); err != nil {
+			panic(fmt.Errorf("Fatal error jwks file %s: %s \n", file, err))
+		}
+	}
+	if verifier.Len() == 0 {
+		panic(fmt.Errorf("Fatal error config file: %s: no jwt keys \n", filename))
+	}
+
+	jwtVerifier = verifier
+	jwtQuota = v.GetBool("quota")
+}
+
+// JwtEnabled 是否已配置JWT鉴权
+func JwtEnabled() bool {
+	return jwtVerifier != nil
+}
+
+// SetRouteScope 设置路由需要的scope，pattern为gin的路由模式，未设置的路由需要read
+func SetRouteScope(pattern, scope string) {
+	routeScopes[pattern] = scope
+}
+
+func getRouteScope(c *gin.Context) string {
+	if scope, ok := routeScopes[c.FullPath()]; ok {
+		return scope
+	}
+	return ScopeRead
+}
+
+// GetClaims 获取JWT鉴权通过后的claims，非JWT鉴权时返回nil
+func GetClaims(c *gin.Context) *jwtauth.Claims {
+	if claims, ok := c.Get(ClaimsKey); ok {
+		return claims.(*jwtauth.Claims)
+	}
+	return nil
+}
+
+// verifyJWT 校验JWT及路由scope，通过后将claims保存到context中
+func verifyJWT(c *gin.Context, token, scope string) (claims *jwtauth.Claims, ok bool) {
+	claims, err := jwtVerifier.Verify(token)
+	if err != nil {
+		logger.Log.Info("jwt invalid", zap.Error(err))
+		c.JSON(http.StatusUnauthorized, &Response{Code: -1, Msg: "invalid token"})
+		c.Abort()
+		return nil, false
+	}
+	if !claims.HasScope(scope) {
+		logger.Log.Info("jwt insufficient scope",
+			zap.String("sub", claims.Subject),
+			zap.String("scope", scope),
+		)
+		c.JSON(http.StatusForbidden, &Response{Code: -1, Msg: "insufficient scope"})
+		c.Abort()
+		return nil, false
+	}
+	c.Set(ClaimsKey, claims)
+	logger.Log.Info("jwt auth",
+		zap.String("sub", claims.Subject),
+		zap.Strings("scopes", claims.Scopes),
+		zap.String("path", c.FullPath()),
+	)
+	return claims, true
+}
+
+// checkJWT 校验JWT，并按配置对sub执行配额检查或只统计使用量
+func checkJWT(c *gin.Context, token string) bool {
+	claims, ok := verifyJWT(c, token, getRouteScope(c))
+	if !ok {
+		return false
+	}
+	if jwtQuota {
+		return checkRateLimit(c, claims.Subject, AuthSchemeJwt)
+	}
+	recordUsage(c.Request.Context(), c, claims.Subject, getRouteCost(c))
+	return true
+}
@@ -0,0 +1,330 @@
+package midware
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"sensiblequery/dao/rdb"
+	"sensiblequery/lib/ratelimit"
+	"sensiblequery/logger"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	redis "github.com/go-redis/redis/v8"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+const (
+	limitOK               = ratelimit.OK
+	limitBurst            = ratelimit.Burst
+	limitDaily            = ratelimit.Daily
+	limitMonthly          = ratelimit.Monthly
+	limitQuotaExhausted   = ratelimit.QuotaExhausted
+	limitQuotaUnavailable = ratelimit.QuotaUnavailable
+	limitTokenSuspended   = iota
+	limitTokenRevoked
+	limitAuthScheme
+	limitScope
+)
+
+const usageKeepDays = 93
+
+const (
+	// PlanKey gin.Context中保存token套餐名的key
+	PlanKey = "plan"
+	// 已通过鉴权的token及鉴权方式，用于长连接后续扣减配额
+	tokenKey      = "apiToken"
+	authSchemeKey = "authScheme"
+)
+
+var (
+	plans      = map[string]*ratelimit.Plan{}
+	routeCosts = map[string]int64{}
+)
+
+func init() {
+	filename := "conf/ratelimit.yaml"
+	if _, err := os.Stat(filename); err != nil {
+		return
+	}
+	v := viper.New()
+	v.SetConfigFile(filename)
+	if err := v.ReadInConfig(); err != nil {
+		panic(fmt.Errorf("Fatal error config file: %s \n", err))
+	}
+
+	var planList []*ratelimit.Plan
+	if err := v.UnmarshalKey("plans", &planList); err != nil {
+		panic(fmt.Errorf("Fatal error config file: %s \n", err))
+	}
+	for _, plan := range planList {
+		plans[plan.Name] = plan
+	}
+	for pattern, cost := range v.GetStringMap("costs") {
+		if n, err := strconv.ParseInt(fmt.Sprint(cost), 10, 64); err == nil {
+			routeCosts[pattern] = n
+		}
+	}
+}
+
+// PlanExists 是否配置了名为name的限流套餐
+func PlanExists(name string) bool {
+	_, ok := plans[name]
+	return ok
+}
+
+// SetRouteCost 设置路由每次请求消耗的配额，pattern为gin的路由模式，如/pushtx。配置文件中的设置优先
+func SetRouteCost(pattern string, cost int64) {
+	if _, ok := routeCosts[pattern]; ok {
+		return
+	}
+	routeCosts[pattern] = cost
+}
+
+func hasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func getRouteCost(c *gin.Context) int64 {
+	if cost, ok := routeCosts[c.FullPath()]; ok && cost > 0 {
+		return cost
+	}
+	return 1
+}
+
+type limitResult struct {
+	Code       int
+	Plan       string // token绑定的套餐，未绑定时为空
+	Limit      int64
+	Remaining  int64
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// rateLimit 对token扣减cost个单位。token未绑定套餐时使用旧的quota计数。
+// 暂停、吊销、不允许以scheme方式鉴权或没有scope权限的token直接拒绝。
+// 旧appid即token，会出现在签名请求的URL中，仍有签名密钥的旧appid不允许作为Bearer token
+func rateLimit(ctx context.Context, token, scheme, scope string, cost int64) (res *limitResult, err error) {
+	pipe := rdb.UserClient.Pipeline()
+	planCmd := pipe.Get(ctx, "plan:"+token)
+	infoCmd := pipe.HMGet(ctx, "apitoken:"+token, "status", "auth", "scopes")
+	var secretCmd *redis.IntCmd
+	if scheme == AuthSchemeBearer {
+		secretCmd = pipe.Exists(ctx, "secretkey:"+token, "secretkey:prev:"+token)
+	}
+	if _, err = pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+	info := infoCmd.Val()
+	switch info[0] {
+	case "suspended":
+		return &limitResult{Code: limitTokenSuspended}, nil
+	case "revoked":
+		return &limitResult{Code: limitTokenRevoked}, nil
+	}
+	if auth, ok := info[1].(string); ok && auth != "" && auth != scheme {
+		return &limitResult{Code: limitAuthScheme}, nil
+	}
+	if secretCmd != nil && secretCmd.Val() > 0 {
+		return &limitResult{Code: limitAuthScheme}, nil
+	}
+	// JWT的scope已在校验时检查
+	if scopes, ok := info[2].(string); ok && scopes != "" && scheme != AuthSchemeJwt {
+		if !hasScope(strings.Fields(scopes), scope) {
+			return &limitResult{Code: limitScope}, nil
+		}
+	}
+
+	planName, err := planCmd.Result()
+	if err == redis.Nil {
+		return quotaLimit(ctx, token, cost)
+	} else if err != nil {
+		return nil, err
+	}
+	plan, ok := plans[planName]
+	if !ok {
+		logger.Log.Info("rate limit plan not found", zap.String("plan", planName))
+		return &limitResult{Code: limitQuotaUnavailable}, nil
+	}
+
+	r, err := ratelimit.Take(ctx, rdb.UserClient, token, plan, cost, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	res = &limitResult{Code: r.Code, Plan: planName, Limit: r.Limit, Remaining: r.Remaining, Reset: r.Reset, RetryAfter: r.RetryAfter}
+	return res, nil
+}
+
+func quotaLimit(ctx context.Context, token string, cost int64) (res *limitResult, err error) {
+	r, err := ratelimit.TakeQuota(ctx, rdb.UserClient, token, cost)
+	if err != nil {
+		return nil, err
+	}
+	return &limitResult{Code: r.Code, Limit: r.Limit, Remaining: r.Remaining}, nil
+}
+
+// checkRateLimit 扣减配额并设置X-RateLimit-*头，失败时写入响应并返回false
+func checkRateLimit(c *gin.Context, token, scheme string) bool {
+	ctx := c.Request.Context()
+	cost := getRouteCost(c)
+	res, err := rateLimit(ctx, token, scheme, getRouteScope(c), cost)
+	if err != nil {
+		logger.Log.Info("rate limit failed", zap.Error(err))
+		c.JSON(http.StatusServiceUnavailable, &Response{Code: -1, Msg: "rate limit unavailable"})
+		c.Abort()
+		return false
+	}
+
+	header := c.Writer.Header()
+	switch res.Code {
+	case limitTokenSuspended:
+		c.JSON(http.StatusForbidden, &Response{Code: -1, Msg: "token suspended"})
+		c.Abort()
+		return false
+	case limitTokenRevoked:
+		c.JSON(http.StatusForbidden, &Response{Code: -1, Msg: "token revoked"})
+		c.Abort()
+		return false
+	case limitAuthScheme:
+		c.JSON(http.StatusForbidden, &Response{Code: -1, Msg: "auth scheme not allowed for token"})
+		c.Abort()
+		return false
+	case limitScope:
+		c.JSON(http.StatusForbidden, &Response{Code: -1, Msg: "insufficient scope"})
+		c.Abort()
+		return false
+	}
+	if res.Limit >= 0 {
+		header.Set("X-RateLimit-Limit", strconv.FormatInt(res.Limit, 10))
+		header.Set("X-RateLimit-Reset", strconv.FormatInt(int64(math.Ceil(res.Reset.Seconds())), 10))
+	}
+	if res.Remaining >= 0 {
+		header.Set("X-RateLimit-Remaining", strconv.FormatInt(res.Remaining, 10))
+	}
+
+	switch res.Code {
+	case limitOK:
+		c.Set(PlanKey, res.Plan)
+		c.Set(tokenKey, token)
+		c.Set(authSchemeKey, scheme)
+		recordUsage(ctx, c, token, cost)
+		return true
+	case limitQuotaUnavailable:
+		c.JSON(http.StatusForbidden, &Response{Code: -1, Msg: "quota unavilable"})
+	case limitQuotaExhausted:
+		c.JSON(http.StatusTooManyRequests, &Response{Code: -1, Msg: "quota exhausted"})
+	default:
+		if res.RetryAfter > 0 {
+			header.Set("Retry-After", strconv.FormatInt(int64(math.Ceil(res.RetryAfter.Seconds())), 10))
+		}
+		msg := "rate limit exceeded"
+		if res.Code == limitDaily {
+			msg = "daily quota exhausted"
+		} else if res.Code == limitMonthly {
+			msg = "monthly quota exhausted"
+		}
+		c.JSON(http.StatusTooManyRequests, &Response{Code: -1, Msg: msg})
+	}
+	c.Abort()
+	return false
+}
+
+// ChargeQuota 对已鉴权请求的token再扣减cost个单位，用于订阅等长连接按订阅数量及时长计费。
+// 未鉴权(关闭token校验)时不扣减。配额不足时返回false及原因
+func ChargeQuota(c *gin.Context, cost int64) (ok bool, reason string, err error) {
+	token := c.GetString(tokenKey)
+	if token == "" {
+		return true, "", nil
+	}
+	ctx := c.Request.Context()
+	res, err := rateLimit(ctx, token, c.GetString(authSchemeKey), getRouteScope(c), cost)
+	if err != nil {
+		return false, "rate limit unavailable", err
+	}
+	switch res.Code {
+	case limitOK:
+		recordUsage(ctx, c, token, cost)
+		return true, "", nil
+	case limitTokenSuspended:
+		return false, "token suspended", nil
+	case limitTokenRevoked:
+		return false, "token revoked", nil
+	case limitQuotaUnavailable:
+		return false, "quota unavilable", nil
+	case limitQuotaExhausted:
+		return false, "quota exhausted", nil
+	case limitDaily:
+		return false, "daily quota exhausted", nil
+	case limitMonthly:
+		return false, "monthly quota exhausted", nil
+	case limitBurst:
+		return false, "rate limit exceeded", nil
+	}
+	return false, "forbidden", nil
+}
+
+// CheckScope 检查已鉴权请求的token是否有scope，用于同一路由内按方法区分scope，如/rpc及/electrum中的广播。
+// 未鉴权(关闭token校验)或token未限定scopes时通过
+func CheckScope(c *gin.Context, scope string) (ok bool, err error) {
+	if claims := GetClaims(c); claims != nil {
+		return claims.HasScope(scope), nil
+	}
+	token := c.GetString(tokenKey)
+	if token == "" {
+		return true, nil
+	}
+	scopes, err := rdb.UserClient.HGet(c.Request.Context(), "apitoken:"+token, "scopes").Result()
+	if err == redis.Nil {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+	return scopes == "" || hasScope(strings.Fields(scopes), scope), nil
+}
+
+// recordUsage 累计请求次数，并按日、按接口路由模式统计使用量
+func recordUsage(ctx context.Context, c *gin.Context, token string, cost int64) {
+	usageKey := "usage:" + token + ":" + time.Now().UTC().Format("20060102")
+	pattern := getUrlPattern(c.Request.URL.Path, c.Params)
+
+	pipe := rdb.UserClient.Pipeline()
+	pipe.Incr(ctx, "visit:"+token)
+	pipe.HIncrBy(ctx, usageKey, pattern, 1)
+	pipe.HIncrBy(ctx, usageKey, "_total", 1)
+	pipe.HIncrBy(ctx, usageKey, "_units", cost)
+	pipe.Expire(ctx, usageKey, usageKeepDays*24*time.Hour)
+	if _, err := pipe.Exec(ctx); err != nil {
+		logger.Log.Info("record usage failed", zap.Error(err))
+	}
+}
+
+// CheckMethodRate 同一接口内按方法限流，每个token(关闭token校验时为客户端IP)每分钟最多perMinute次，0为不限制
+func CheckMethodRate(c *gin.Context, method string, perMinute int64) (ok bool, err error) {
+	if perMinute <= 0 {
+		return true, nil
+	}
+	client := c.GetString(tokenKey)
+	if client == "" {
+		client = c.ClientIP()
+	}
+	ctx := c.Request.Context()
+	key := "rl:{" + client + "}:method:" + method + ":" + time.Now().UTC().Format("200601021504")
+
+	pipe := rdb.UserClient.Pipeline()
+	incrCmd := pipe.Incr(ctx, key)
+	pipe.Expire(ctx, key, 2*time.Minute)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, err
+	}
+	return incrCmd.Val() <= perMinute, nil
+}
@@ -1,17 +1,31 @@
 package midware
 
 import (
-	"context"
+	"bytes"
 	"crypto/hmac"
 	"crypto/sha256"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"sensiblequery/dao/rdb"
+	"sensiblequery/lib/jwtauth"
+	"sensiblequery/lib/signer"
+	"sensiblequery/logger"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	redis "github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+const (
+	AuthSchemeBearer = "bearer"
+	AuthSchemeHmac   = "hmac"
+
+	signExpired = time.Minute * 5
+	maxSignBody = 8 * 1024 * 1024
 )
 
 func SignSha256(input, key string) string {
@@ -34,90 +48,158 @@ func VerifyTsWithTs(ts string, expired time.Duration) bool {
 	return true
 }
 
-func VerifySignatureForHttpGet() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		ctx := context.Background()
-		params := c.Request.URL.Query()
+// verifySignature 校验appid/ts/nonce/sign签名，返回appid对应的token。
+// 当前密钥secretkey:<appid>和轮换后保留的旧密钥secretkey:prev:<appid>均可通过校验。
+// 没有appid:<appid>记录的旧appid即token本身。
+// nonce在有效期内只能使用一次，未提供nonce时以sign作为nonce
+func verifySignature(c *gin.Context) (token string, ok bool) {
+	ctx := c.Request.Context()
+	params := c.Request.URL.Query()
+
+	ts := params.Get(signer.ParamTs)
+	if ok := VerifyTsWithTs(ts, signExpired); !ok {
+		c.JSON(http.StatusForbidden, &Response{Code: -1, Msg: "request expired"})
+		c.Abort()
+		return "", false
+	}
 
-		ts := params.Get("ts")
-		if ok := VerifyTsWithTs(ts, time.Minute*5); !ok {
-			c.JSON(http.StatusForbidden, &Response{Code: -1, Msg: "request expired"})
-			c.Abort()
-			return
-		}
+	appid := params.Get(signer.ParamAppId)
+	if len(appid) > 64 || len(appid) == 0 {
+		c.JSON(http.StatusForbidden, &Response{Code: -1, Msg: "appid not valid"})
+		c.Abort()
+		return "", false
+	}
+	pipe := rdb.UserClient.Pipeline()
+	tokenCmd := pipe.Get(ctx, "appid:"+appid)
+	secretCmd := pipe.Get(ctx, "secretkey:"+appid)
+	prevSecretCmd := pipe.Get(ctx, "secretkey:prev:"+appid)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		logger.Log.Info("get secretkey failed", zap.Error(err))
+	}
+	secretKey := secretCmd.Val()
+	prevSecretKey := prevSecretCmd.Val()
+	if secretKey == "" && prevSecretKey == "" {
+		c.JSON(http.StatusForbidden, &Response{Code: -1, Msg: "appid not valid"})
+		c.Abort()
+		return "", false
+	}
 
-		appid := params.Get("appid")
-		secretKey, err := rdb.UserClient.Get(ctx, "secretkey:"+appid).Result()
+	var body []byte
+	if c.Request.Body != nil {
+		data, err := ioutil.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxSignBody))
 		if err != nil {
-			c.JSON(http.StatusForbidden, &Response{Code: -1, Msg: "appid not valid"})
+			c.JSON(http.StatusRequestEntityTooLarge, &Response{Code: -1, Msg: "body too large"})
 			c.Abort()
-			return
+			return "", false
 		}
+		body = data
+		c.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
 
-		sign := params.Get("sign")
-		params.Del("sign")
-		paramsStrIgnoreSign := params.Encode()
+	sign := params.Get(signer.ParamSign)
+	input := signer.StringToSign(c.Request.Method, c.Request.URL.Path, params, body)
+	if (secretKey == "" || !signer.Verify(input, secretKey, sign)) && (prevSecretKey == "" || !signer.Verify(input, prevSecretKey, sign)) {
+		c.JSON(http.StatusForbidden, &Response{Code: -1, Msg: "signature not match"})
+		c.Abort()
+		return "", false
+	}
 
-		path := c.Request.URL.Path
-		signCorrect := SignSha256(path+"?"+paramsStrIgnoreSign, secretKey)
-		if signCorrect != sign {
-			c.JSON(http.StatusForbidden, &Response{Code: -1, Msg: "signature not match"})
-			c.Abort()
-			return
-		}
+	// 防重放，nonce保留时间覆盖ts的整个有效窗口
+	nonce := params.Get(signer.ParamNonce)
+	if nonce == "" {
+		nonce = sign
+	}
+	if len(nonce) > 64 {
+		c.JSON(http.StatusForbidden, &Response{Code: -1, Msg: "nonce not valid"})
+		c.Abort()
+		return "", false
+	}
+	fresh, err := rdb.UserClient.SetNX(ctx, "nonce:"+appid+":"+nonce, 1, 2*signExpired).Result()
+	if err != nil {
+		logger.Log.Info("set nonce failed", zap.Error(err))
+		c.JSON(http.StatusServiceUnavailable, &Response{Code: -1, Msg: "nonce unavailable"})
+		c.Abort()
+		return "", false
+	}
+	if !fresh {
+		c.JSON(http.StatusForbidden, &Response{Code: -1, Msg: "request replayed"})
+		c.Abort()
+		return "", false
+	}
 
-		quota, err := rdb.UserClient.Get(ctx, "quota:"+appid).Int()
-		if err != nil {
-			c.JSON(http.StatusForbidden, &Response{Code: -1, Msg: "quota unavilable"})
-			c.Abort()
+	token = tokenCmd.Val()
+	if token == "" {
+		token = appid
+	}
+	return token, true
+}
+
+// VerifySignature 仅支持HMAC签名鉴权
+func VerifySignature() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, ok := verifySignature(c)
+		if !ok {
 			return
 		}
-
-		if quota <= 0 {
-			c.JSON(http.StatusForbidden, &Response{Code: -1, Msg: "quota exhausted"})
-			c.Abort()
+		if !checkRateLimit(c, token, AuthSchemeHmac) {
 			return
 		}
-
-		rdb.UserClient.Decr(ctx, "quota:"+appid)
-		rdb.UserClient.Incr(ctx, "visit:"+appid)
 		c.Next()
 	}
 }
 
+// bearerAuth 校验Bearer token，启用JWT时JWT格式的token按JWT校验，失败时写入响应
+func bearerAuth(c *gin.Context) bool {
+	auth := c.GetHeader("Authorization")
+	idTokenHeader := strings.Split(auth, "Bearer ")
+	if len(idTokenHeader) < 2 {
+		c.JSON(http.StatusUnauthorized, &Response{Code: -1, Msg: "Must provide Authorization header with format `Bearer {token}`"})
+		c.Abort()
+		return false
+	}
+
+	authToken := idTokenHeader[1]
+	if jwtVerifier != nil && jwtauth.LooksLikeJWT(authToken) {
+		return checkJWT(c, authToken)
+	}
+
+	if len(authToken) > 64 || len(authToken) == 0 {
+		c.JSON(http.StatusForbidden, &Response{Code: -1, Msg: "invalid token"})
+		c.Abort()
+		return false
+	}
+	return checkRateLimit(c, authToken, AuthSchemeBearer)
+}
+
 func VerifyToken() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		ctx := context.Background()
-		auth := c.GetHeader("Authorization")
-		idTokenHeader := strings.Split(auth, "Bearer ")
-		if len(idTokenHeader) < 2 {
-			c.JSON(http.StatusUnauthorized, &Response{Code: -1, Msg: "Must provide Authorization header with format `Bearer {token}`"})
-			c.Abort()
-			return
-		}
-
-		authToken := idTokenHeader[1]
-		if len(authToken) > 64 || len(authToken) == 0 {
-			c.JSON(http.StatusForbidden, &Response{Code: -1, Msg: "invalid token"})
-			c.Abort()
+		if !bearerAuth(c) {
 			return
 		}
+		c.Next()
+	}
+}
 
-		quota, err := rdb.UserClient.Get(ctx, "quota:"+authToken).Int()
-		if err != nil {
-			c.JSON(http.StatusForbidden, &Response{Code: -1, Msg: "quota unavilable"})
-			c.Abort()
+// VerifyAuth 支持Bearer token(或JWT)与HMAC签名两种鉴权方式。
+// 带appid参数且没有Authorization头的请求按签名校验，token可通过apitoken:<token>的auth字段限定只允许其中一种。
+// 旧appid即token，已配置secretkey:<token>的token不允许Bearer鉴权
+func VerifyAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetHeader("Authorization") == "" && c.Query(signer.ParamAppId) != "" {
+			token, ok := verifySignature(c)
+			if !ok {
+				return
+			}
+			if !checkRateLimit(c, token, AuthSchemeHmac) {
+				return
+			}
+			c.Next()
 			return
 		}
 
-		if quota <= 0 {
-			c.JSON(http.StatusForbidden, &Response{Code: -1, Msg: "quota exhausted"})
-			c.Abort()
+		if !bearerAuth(c) {
 			return
 		}
-
-		rdb.UserClient.Decr(ctx, "quota:"+authToken)
-		rdb.UserClient.Incr(ctx, "visit:"+authToken)
 		c.Next()
 	}
 }
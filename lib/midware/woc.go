@@ -0,0 +1,23 @@
+package midware
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WocApiKey 兼容WhatsOnChain客户端的鉴权头，
+// woc-api-key头或不带Bearer前缀的Authorization头转为Bearer token后再交给VerifyAuth
+func WocApiKey() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		auth := c.GetHeader("Authorization")
+		if auth == "" {
+			if key := c.GetHeader("woc-api-key"); key != "" {
+				c.Request.Header.Set("Authorization", "Bearer "+key)
+			}
+		} else if !strings.HasPrefix(auth, "Bearer ") {
+			c.Request.Header.Set("Authorization", "Bearer "+auth)
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,232 @@
+// Package nodepool 多个bitcoind rpc节点。定期以getblockcount探测健康状态，
+// 读请求在健康节点间轮询并在连接失败时切换节点，广播请求同时发往所有节点
+package nodepool
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ybbus/jsonrpc/v2"
+)
+
+var ErrNoNode = errors.New("no rpc node")
+
+type Node struct {
+	Url    string
+	client jsonrpc.RPCClient
+
+	mu      sync.Mutex
+	healthy bool
+	height  int
+	err     string
+	checked time.Time
+}
+
+// NodeStatus 节点最近一次探测或调用的结果
+type NodeStatus struct {
+	Url     string    `json:"url"`
+	Healthy bool      `json:"healthy"`
+	Height  int       `json:"height"`
+	Error   string    `json:"error,omitempty"`
+	Checked time.Time `json:"checked"`
+}
+
+// NewNode 新节点在第一次探测前视为健康
+func NewNode(url string, client jsonrpc.RPCClient) *Node {
+	return &Node{Url: url, client: client, healthy: true}
+}
+
+func (n *Node) setHealth(healthy bool, height int, err error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.healthy = healthy
+	if height > 0 {
+		n.height = height
+	}
+	n.err = ""
+	if err != nil {
+		n.err = err.Error()
+	}
+	n.checked = time.Now()
+}
+
+func (n *Node) isHealthy() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.healthy
+}
+
+func (n *Node) Status() NodeStatus {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return NodeStatus{Url: n.Url, Healthy: n.healthy, Height: n.height, Error: n.err, Checked: n.checked}
+}
+
+type Pool struct {
+	nodes []*Node
+	next  uint32
+}
+
+func New(nodes ...*Node) *Pool {
+	return &Pool{nodes: nodes}
+}
+
+// candidates 从轮询位置开始的健康节点，其后为不健康节点作为最后的尝试
+func (p *Pool) candidates() []*Node {
+	if len(p.nodes) == 0 {
+		return nil
+	}
+	start := int(atomic.AddUint32(&p.next, 1)-1) % len(p.nodes)
+	healthy := make([]*Node, 0, len(p.nodes))
+	var unhealthy []*Node
+	for i := range p.nodes {
+		node := p.nodes[(start+i)%len(p.nodes)]
+		if node.isHealthy() {
+			healthy = append(healthy, node)
+		} else {
+			unhealthy = append(unhealthy, node)
+		}
+	}
+	return append(healthy, unhealthy...)
+}
+
+// Call 读请求，连接失败时标记节点不健康并换下一个节点，节点返回的rpc错误直接返回
+func (p *Pool) Call(method string, params ...interface{}) (response *jsonrpc.RPCResponse, err error) {
+	err = ErrNoNode
+	for _, node := range p.candidates() {
+		response, err = node.client.Call(method, params...)
+		if err == nil {
+			return response, nil
+		}
+		node.setHealth(false, 0, err)
+	}
+	return nil, err
+}
+
+// CallBatch 批量读请求，失败切换同Call
+func (p *Pool) CallBatch(requests jsonrpc.RPCRequests) (responses jsonrpc.RPCResponses, err error) {
+	err = ErrNoNode
+	for _, node := range p.candidates() {
+		responses, err = node.client.CallBatch(requests)
+		if err == nil {
+			return responses, nil
+		}
+		node.setHealth(false, 0, err)
+	}
+	return nil, err
+}
+
+// Broadcast 同时发往所有节点，任一节点接受即返回其结果；
+// 都不接受时返回第一个节点的rpc错误，都连接失败时返回连接错误
+func (p *Pool) Broadcast(method string, params ...interface{}) (*jsonrpc.RPCResponse, error) {
+	if len(p.nodes) == 0 {
+		return nil, ErrNoNode
+	}
+	type result struct {
+		response *jsonrpc.RPCResponse
+		err      error
+	}
+	results := make([]result, len(p.nodes))
+	var wg sync.WaitGroup
+	for i, node := range p.nodes {
+		wg.Add(1)
+		go func(i int, node *Node) {
+			defer wg.Done()
+			response, err := node.client.Call(method, params...)
+			if err != nil {
+				node.setHealth(false, 0, err)
+			}
+			results[i] = result{response, err}
+		}(i, node)
+	}
+	wg.Wait()
+
+	var rejected *jsonrpc.RPCResponse
+	var err error
+	for _, res := range results {
+		switch {
+		case res.err != nil:
+			if err == nil {
+				err = res.err
+			}
+		case res.response.Error == nil:
+			return res.response, nil
+		case rejected == nil:
+			rejected = res.response
+		}
+	}
+	if rejected != nil {
+		return rejected, nil
+	}
+	return nil, err
+}
+
+// Probe 对所有节点getblockcount，连接失败、返回错误或落后最高节点超过maxLag个区块的为不健康
+func (p *Pool) Probe(timeout time.Duration, maxLag int) {
+	heights := make([]int, len(p.nodes))
+	errs := make([]error, len(p.nodes))
+	var wg sync.WaitGroup
+	for i, node := range p.nodes {
+		wg.Add(1)
+		go func(i int, node *Node) {
+			defer wg.Done()
+			heights[i], errs[i] = blockCount(node.client, timeout)
+		}(i, node)
+	}
+	wg.Wait()
+
+	best := 0
+	for i := range p.nodes {
+		if errs[i] == nil && heights[i] > best {
+			best = heights[i]
+		}
+	}
+	for i, node := range p.nodes {
+		switch {
+		case errs[i] != nil:
+			node.setHealth(false, 0, errs[i])
+		case best-heights[i] > maxLag:
+			node.setHealth(false, heights[i], errors.New("lagging behind best node"))
+		default:
+			node.setHealth(true, heights[i], nil)
+		}
+	}
+}
+
+// blockCount rpc客户端不支持ctx，超时后不再等待
+func blockCount(client jsonrpc.RPCClient, timeout time.Duration) (int, error) {
+	type result struct {
+		height int
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		response, err := client.Call("getblockcount")
+		if err == nil && response.Error != nil {
+			err = response.Error
+		}
+		var height int64
+		if err == nil {
+			height, err = response.GetInt()
+		}
+		done <- result{int(height), err}
+	}()
+	select {
+	case res := <-done:
+		return res.height, res.err
+	case <-time.After(timeout):
+		return 0, context.DeadlineExceeded
+	}
+}
+
+// Status 各节点状态，按配置顺序
+func (p *Pool) Status() []NodeStatus {
+	status := make([]NodeStatus, 0, len(p.nodes))
+	for _, node := range p.nodes {
+		status = append(status, node.Status())
+	}
+	return status
+}
@@ -0,0 +1,148 @@
+package nodepool
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ybbus/jsonrpc/v2"
+)
+
+// fakeClient 只实现Call/CallBatch，down时返回连接错误
+type fakeClient struct {
+	jsonrpc.RPCClient
+
+	mu     sync.Mutex
+	down   bool
+	reject bool
+	height int
+	calls  []string
+}
+
+var errDown = errors.New("connection refused")
+
+func (f *fakeClient) Call(method string, params ...interface{}) (*jsonrpc.RPCResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, method)
+	if f.down {
+		return nil, errDown
+	}
+	if f.reject {
+		return &jsonrpc.RPCResponse{Error: &jsonrpc.RPCError{Code: -26, Message: "rejected"}}, nil
+	}
+	if method == "getblockcount" {
+		return &jsonrpc.RPCResponse{Result: json.Number(strconv.Itoa(f.height))}, nil
+	}
+	return &jsonrpc.RPCResponse{Result: method}, nil
+}
+
+func (f *fakeClient) CallBatch(requests jsonrpc.RPCRequests) (jsonrpc.RPCResponses, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, "batch")
+	if f.down {
+		return nil, errDown
+	}
+	return jsonrpc.RPCResponses{{ID: 0, Result: "ok"}}, nil
+}
+
+func (f *fakeClient) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.calls)
+}
+
+func newPool(clients ...*fakeClient) *Pool {
+	var nodes []*Node
+	for i, c := range clients {
+		nodes = append(nodes, NewNode(string(rune('a'+i)), c))
+	}
+	return New(nodes...)
+}
+
+func TestCallRoundRobin(t *testing.T) {
+	a, b := &fakeClient{}, &fakeClient{}
+	p := newPool(a, b)
+	for i := 0; i < 4; i++ {
+		if _, err := p.Call("getbestblockhash"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if a.count() != 2 || b.count() != 2 {
+		t.Fatalf("calls a=%d b=%d", a.count(), b.count())
+	}
+}
+
+func TestCallFailover(t *testing.T) {
+	a, b := &fakeClient{down: true}, &fakeClient{}
+	p := newPool(a, b)
+	for i := 0; i < 3; i++ {
+		response, err := p.Call("getbestblockhash")
+		if err != nil || response.Result != "getbestblockhash" {
+			t.Fatalf("%v %v", response, err)
+		}
+	}
+	// a失败一次后不健康，之后只作为最后的尝试
+	if a.count() != 1 || b.count() != 3 {
+		t.Fatalf("calls a=%d b=%d", a.count(), b.count())
+	}
+	if st := p.Status(); st[0].Healthy || st[0].Error == "" || !st[1].Healthy {
+		t.Fatalf("status %+v", st)
+	}
+
+	if _, err := p.CallBatch(jsonrpc.RPCRequests{{Method: "getblockcount"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	b.down = true
+	if _, err := p.Call("getbestblockhash"); err != errDown {
+		t.Fatalf("err %v", err)
+	}
+	if _, err := New().Call("getbestblockhash"); err != ErrNoNode {
+		t.Fatalf("err %v", err)
+	}
+}
+
+func TestBroadcast(t *testing.T) {
+	a, b, c := &fakeClient{down: true}, &fakeClient{reject: true}, &fakeClient{}
+	response, err := newPool(a, b, c).Broadcast("sendrawtransaction", "00")
+	if err != nil || response.Error != nil {
+		t.Fatalf("%v %v", response, err)
+	}
+	if a.count() != 1 || b.count() != 1 || c.count() != 1 {
+		t.Fatal("not sent to all nodes")
+	}
+
+	// 都拒绝时返回rpc错误
+	response, err = newPool(a, b).Broadcast("sendrawtransaction", "00")
+	if err != nil || response.Error == nil || response.Error.Code != -26 {
+		t.Fatalf("%v %v", response, err)
+	}
+
+	if _, err = newPool(a).Broadcast("sendrawtransaction", "00"); err != errDown {
+		t.Fatalf("err %v", err)
+	}
+}
+
+func TestProbe(t *testing.T) {
+	a, b, c := &fakeClient{height: 100}, &fakeClient{height: 95}, &fakeClient{down: true}
+	p := newPool(a, b, c)
+	p.Probe(time.Second, 3)
+	st := p.Status()
+	if !st[0].Healthy || st[0].Height != 100 || st[1].Healthy || st[1].Height != 95 || st[2].Healthy {
+		t.Fatalf("status %+v", st)
+	}
+
+	// 恢复后重新健康
+	b.height, c.down, c.height = 99, false, 100
+	p.Probe(time.Second, 3)
+	for _, s := range p.Status() {
+		if !s.Healthy || s.Error != "" {
+			t.Fatalf("status %+v", s)
+		}
+	}
+}
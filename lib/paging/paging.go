@@ -0,0 +1,124 @@
+package paging
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// Token 不透明游标，记录上一页边界记录的位置
+type Token struct {
+	Prev bool `json:"p,omitempty"` // 向前翻页
+
+	// history: (height, txidx, io_type, idx)
+	Height int `json:"h,omitempty"`
+	TxIdx  int `json:"t,omitempty"`
+	IOType int `json:"o,omitempty"`
+	Idx    int `json:"i,omitempty"`
+
+	// redis sorted set: (phase, score, member)
+	Phase  int     `json:"s,omitempty"`
+	Score  float64 `json:"c,omitempty"`
+	Member string  `json:"m,omitempty"`
+}
+
+// Page 分页请求，Token为nil时兼容旧的offset分页
+type Page struct {
+	Offset int
+	Size   int
+	Token  *Token
+}
+
+// Encode 编码为url安全的游标字符串
+func (t *Token) Encode() string {
+	if t == nil {
+		return ""
+	}
+	data, _ := json.Marshal(t)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Reverse 返回同一位置、相反方向的游标
+func (t *Token) Reverse() *Token {
+	r := *t
+	r.Prev = !t.Prev
+	return &r
+}
+
+func Decode(s string) (*Token, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	t := &Token{}
+	if err := json.Unmarshal(data, t); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return t, nil
+}
+
+// Parse 解析cursor参数，数字为旧的offset，否则为不透明游标
+func Parse(cursor string, size int) (page Page, err error) {
+	page.Size = size
+	if cursor == "" {
+		return page, nil
+	}
+	if offset, err := strconv.Atoi(cursor); err == nil {
+		if offset < 0 {
+			return page, ErrInvalidCursor
+		}
+		page.Offset = offset
+		return page, nil
+	}
+	page.Token, err = Decode(cursor)
+	return page, err
+}
+
+// IsFirst 是否为第一页
+func (p *Page) IsFirst() bool {
+	return p.Token == nil && p.Offset == 0
+}
+
+// IsPrev 是否向前翻页
+func (p *Page) IsPrev() bool {
+	return p.Token != nil && p.Token.Prev
+}
+
+// Links 根据本页首尾记录位置生成前后页游标。
+// first/last为按展示顺序的首尾记录位置，n为本页记录数
+func (p *Page) Links(first, last *Token, n int) (next, prev string) {
+	if n == 0 {
+		if p.Token != nil {
+			// 越过边界后，允许沿原位置反向返回
+			return "", p.Token.Reverse().Encode()
+		}
+		return "", ""
+	}
+	full := n >= p.Size
+	if p.IsPrev() {
+		// 向前翻页时，后面一定还有数据
+		next = withDir(last, false).Encode()
+		if full {
+			prev = withDir(first, true).Encode()
+		}
+		return next, prev
+	}
+	if full {
+		next = withDir(last, false).Encode()
+	}
+	if !p.IsFirst() {
+		prev = withDir(first, true).Encode()
+	}
+	return next, prev
+}
+
+func withDir(t *Token, prev bool) *Token {
+	r := *t
+	r.Prev = prev
+	return &r
+}
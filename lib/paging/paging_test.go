@@ -0,0 +1,66 @@
+package paging
+
+import (
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	page, err := Parse("32", 16)
+	if err != nil || page.Token != nil || page.Offset != 32 || page.Size != 16 {
+		t.Fatalf("parse offset failed: %+v, %v", page, err)
+	}
+
+	if _, err := Parse("-1", 16); err != ErrInvalidCursor {
+		t.Fatalf("negative offset should be invalid, got %v", err)
+	}
+
+	if _, err := Parse("not a cursor!", 16); err != ErrInvalidCursor {
+		t.Fatalf("garbage should be invalid, got %v", err)
+	}
+
+	tok := &Token{Height: 700000, TxIdx: 12, IOType: 1, Idx: 3}
+	page, err = Parse(tok.Encode(), 16)
+	if err != nil || page.Token == nil || *page.Token != *tok {
+		t.Fatalf("parse token failed: %+v, %v", page.Token, err)
+	}
+}
+
+func TestLinks(t *testing.T) {
+	first := &Token{Phase: 1, Score: 10, Member: "a"}
+	last := &Token{Phase: 1, Score: 5, Member: "b"}
+
+	// first page, full
+	page := Page{Size: 2}
+	next, prev := page.Links(first, last, 2)
+	if next == "" || prev != "" {
+		t.Fatalf("first page links: next=%q prev=%q", next, prev)
+	}
+	nextTok, _ := Decode(next)
+	if nextTok.Prev || nextTok.Score != 5 || nextTok.Member != "b" {
+		t.Fatalf("next token: %+v", nextTok)
+	}
+
+	// last page, short
+	page = Page{Size: 2, Token: nextTok}
+	next, prev = page.Links(first, nil, 1)
+	if next != "" || prev == "" {
+		t.Fatalf("last page links: next=%q prev=%q", next, prev)
+	}
+	prevTok, _ := Decode(prev)
+	if !prevTok.Prev || prevTok.Score != 10 || prevTok.Member != "a" {
+		t.Fatalf("prev token: %+v", prevTok)
+	}
+
+	// empty page after token
+	next, prev = page.Links(nil, nil, 0)
+	if next != "" || prev == "" {
+		t.Fatalf("empty page links: next=%q prev=%q", next, prev)
+	}
+
+	// legacy offset page
+	page = Page{Size: 2, Offset: 4}
+	next, prev = page.Links(first, last, 2)
+	if next == "" || prev == "" {
+		t.Fatalf("offset page links: next=%q prev=%q", next, prev)
+	}
+}
@@ -0,0 +1,171 @@
+package paging
+
+import (
+	"context"
+	"strconv"
+
+	redis "github.com/go-redis/redis/v8"
+)
+
+//////////////// redis sorted set keyset
+type ZFilterFunc func(zs []redis.Z) ([]redis.Z, error)
+
+// ZRangeAfter 从有序集合中取出位于pos之后的至多size条记录。
+// desc为true时按分数从大到小遍历(同分数按member逆序)，pos为nil时从头开始
+func ZRangeAfter(ctx context.Context, client redis.UniversalClient, key string, pos *redis.Z, desc bool, size int, filter ZFilterFunc) (result []redis.Z, err error) {
+	bound := "+inf"
+	if !desc {
+		bound = "-inf"
+	}
+	posMember := ""
+	if pos != nil {
+		bound = strconv.FormatFloat(pos.Score, 'f', -1, 64)
+		posMember, _ = pos.Member.(string)
+	}
+
+	offset := int64(0)
+	for len(result) < size {
+		opt := &redis.ZRangeBy{
+			Offset: offset,
+			Count:  int64(size-len(result)) + 16,
+		}
+		var zs []redis.Z
+		if desc {
+			opt.Max, opt.Min = bound, "-inf"
+			zs, err = client.ZRevRangeByScoreWithScores(ctx, key, opt).Result()
+		} else {
+			opt.Min, opt.Max = bound, "+inf"
+			zs, err = client.ZRangeByScoreWithScores(ctx, key, opt).Result()
+		}
+		if err == redis.Nil {
+			return result, nil
+		} else if err != nil {
+			return nil, err
+		}
+		fetched := int64(len(zs))
+
+		// 跳过同分数下已返回过的member
+		if pos != nil {
+			kept := zs[:0]
+			for _, z := range zs {
+				member, _ := z.Member.(string)
+				if z.Score == pos.Score && ((desc && member >= posMember) || (!desc && member <= posMember)) {
+					continue
+				}
+				kept = append(kept, z)
+			}
+			zs = kept
+		}
+		if filter != nil && len(zs) > 0 {
+			if zs, err = filter(zs); err != nil {
+				return nil, err
+			}
+		}
+		for _, z := range zs {
+			if len(result) >= size {
+				break
+			}
+			result = append(result, z)
+		}
+
+		if fetched < opt.Count {
+			break
+		}
+		offset += fetched
+	}
+	return result, nil
+}
+
+// ZExcludeMembers 过滤掉在key集合中存在的member
+func ZExcludeMembers(ctx context.Context, client redis.UniversalClient, key string) ZFilterFunc {
+	return func(zs []redis.Z) ([]redis.Z, error) {
+		pipe := client.Pipeline()
+		cmds := make([]*redis.FloatCmd, len(zs))
+		for idx, z := range zs {
+			cmds[idx] = pipe.ZScore(ctx, key, z.Member.(string))
+		}
+		if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+			return nil, err
+		}
+		kept := make([]redis.Z, 0, len(zs))
+		for idx, cmd := range cmds {
+			if err := cmd.Err(); err == redis.Nil {
+				kept = append(kept, zs[idx])
+			} else if err != nil {
+				return nil, err
+			}
+		}
+		return kept, nil
+	}
+}
+
+// ZRangeFunc 与ZRangeAfter相同语义的取数函数，用于不在redis中的有序集合
+type ZRangeFunc func(pos *redis.Z, desc bool, size int) ([]redis.Z, error)
+
+// ZSegment 按顺序拼接的有序集合分段，如先mempool后confirmed。设置Range时不读取redis
+type ZSegment struct {
+	Key    string
+	Filter ZFilterFunc
+	Range  ZRangeFunc
+}
+
+type ZPosition struct {
+	Phase int
+	redis.Z
+}
+
+// ZSegmentsPage 在多个分段上按游标翻页，返回按展示顺序(分段内分数从大到小)排列的结果
+func ZSegmentsPage(ctx context.Context, client redis.UniversalClient, segments []ZSegment, page Page) (result []ZPosition, err error) {
+	phase := 0
+	var pos *redis.Z
+	if page.Token != nil {
+		phase = page.Token.Phase
+		if phase < 0 || phase >= len(segments) {
+			return nil, ErrInvalidCursor
+		}
+		pos = &redis.Z{Score: page.Token.Score, Member: page.Token.Member}
+	}
+
+	prev := page.IsPrev()
+	for phase >= 0 && phase < len(segments) && len(result) < page.Size {
+		seg := segments[phase]
+		var zs []redis.Z
+		if seg.Range != nil {
+			zs, err = seg.Range(pos, !prev, page.Size-len(result))
+		} else {
+			zs, err = ZRangeAfter(ctx, client, seg.Key, pos, !prev, page.Size-len(result), seg.Filter)
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, z := range zs {
+			result = append(result, ZPosition{Phase: phase, Z: z})
+		}
+		pos = nil
+		if prev {
+			phase--
+		} else {
+			phase++
+		}
+	}
+
+	if prev {
+		for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+			result[i], result[j] = result[j], result[i]
+		}
+	}
+	return result, nil
+}
+
+func ZPositionToken(p ZPosition) *Token {
+	member, _ := p.Member.(string)
+	return &Token{Phase: p.Phase, Score: p.Score, Member: member}
+}
+
+// ZPageLinks 生成前后页游标
+func ZPageLinks(page Page, result []ZPosition) (next, prev string) {
+	if len(result) == 0 {
+		return page.Links(nil, nil, 0)
+	}
+	return page.Links(ZPositionToken(result[0]), ZPositionToken(result[len(result)-1]), len(result))
+}
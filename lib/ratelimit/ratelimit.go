@@ -0,0 +1,174 @@
+// Package ratelimit 基于redis的token限流：套餐的令牌桶与每日/每月配额一起原子扣减，
+// 以及未绑定套餐的token使用的不刷新的quota总配额
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"time"
+
+	redis "github.com/go-redis/redis/v8"
+)
+
+// 扣减结果，与脚本返回的code一致
+const (
+	OK = iota
+	Burst
+	Daily
+	Monthly
+	QuotaExhausted
+	QuotaUnavailable
+)
+
+// Plan 限流套餐。Rate/Burst为令牌桶(每秒补充/桶容量)，Daily/Monthly为周期配额，0表示不限制
+type Plan struct {
+	Name    string  `mapstructure:"name"`
+	Rate    float64 `mapstructure:"rate"`
+	Burst   int64   `mapstructure:"burst"`
+	Daily   int64   `mapstructure:"daily"`
+	Monthly int64   `mapstructure:"monthly"`
+}
+
+// 令牌桶与周期配额一起原子扣减，任一不足则都不扣
+// KEYS: bucket, day, month
+// ARGV: now_ms, rate, burst, daily, monthly, cost, day_ttl, month_ttl
+// 返回: code, tokens, wait_ms, used_day, used_month
+var planLimitScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local burst = tonumber(ARGV[3])
+local daily = tonumber(ARGV[4])
+local monthly = tonumber(ARGV[5])
+local cost = tonumber(ARGV[6])
+
+local tokens = burst
+if rate > 0 then
+	local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+	if bucket[1] then
+		local elapsed = math.max(0, now - tonumber(bucket[2]))
+		tokens = math.min(burst, tonumber(bucket[1]) + elapsed * rate / 1000)
+	end
+end
+
+local used_day = tonumber(redis.call('GET', KEYS[2]) or '0')
+local used_month = tonumber(redis.call('GET', KEYS[3]) or '0')
+if rate > 0 and tokens < math.min(cost, burst) then
+	return {1, tostring(tokens), math.ceil((math.min(cost, burst) - tokens) * 1000 / rate), used_day, used_month}
+end
+if daily > 0 and used_day + cost > daily then
+	return {2, tostring(tokens), 0, used_day, used_month}
+end
+if monthly > 0 and used_month + cost > monthly then
+	return {3, tostring(tokens), 0, used_day, used_month}
+end
+
+if rate > 0 then
+	tokens = math.max(0, tokens - cost)
+	redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+	redis.call('PEXPIRE', KEYS[1], math.ceil(burst * 1000 / rate) + 1000)
+end
+if daily > 0 then
+	used_day = redis.call('INCRBY', KEYS[2], cost)
+	redis.call('EXPIRE', KEYS[2], ARGV[7])
+end
+if monthly > 0 then
+	used_month = redis.call('INCRBY', KEYS[3], cost)
+	redis.call('EXPIRE', KEYS[3], ARGV[8])
+end
+return {0, tostring(tokens), 0, used_day, used_month}
+`)
+
+// 兼容旧的不刷新的总配额quota:<token>
+// KEYS: quota
+// ARGV: cost
+var quotaLimitScript = redis.NewScript(`
+local quota = redis.call('GET', KEYS[1])
+if not quota then
+	return {5, 0}
+end
+quota = tonumber(quota)
+local cost = tonumber(ARGV[1])
+if quota < cost then
+	return {4, quota}
+end
+return {0, redis.call('DECRBY', KEYS[1], cost)}
+`)
+
+// Result 扣减结果。Limit/Remaining为-1时表示不限制
+type Result struct {
+	Code       int
+	Limit      int64
+	Remaining  int64
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// Take 按套餐对token扣减cost个单位，now决定令牌桶补充量及日、月周期(UTC)
+func Take(ctx context.Context, rds redis.Scripter, token string, plan *Plan, cost int64, now time.Time) (res *Result, err error) {
+	now = now.UTC()
+	dayEnd := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	monthEnd := time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+
+	// 使用hash tag保证集群模式下同一token的key在同一slot
+	prefix := "rl:{" + token + "}:"
+	keys := []string{
+		prefix + "b",
+		prefix + "d:" + now.Format("20060102"),
+		prefix + "m:" + now.Format("200601"),
+	}
+	ret, err := planLimitScript.Run(ctx, rds, keys,
+		now.UnixNano()/int64(time.Millisecond), plan.Rate, plan.Burst, plan.Daily, plan.Monthly, cost,
+		int64(dayEnd.Sub(now)/time.Second)+3600, int64(monthEnd.Sub(now)/time.Second)+3600,
+	).Slice()
+	if err != nil {
+		return nil, err
+	}
+
+	code := int(ret[0].(int64))
+	tokens, _ := strconv.ParseFloat(ret[1].(string), 64)
+	wait := time.Duration(ret[2].(int64)) * time.Millisecond
+	usedDay := ret[3].(int64)
+	usedMonth := ret[4].(int64)
+
+	// 优先报告周期配额，没有周期配额时报告令牌桶
+	res = &Result{Code: code}
+	switch {
+	case plan.Daily > 0 && (plan.Monthly == 0 || plan.Daily-usedDay <= plan.Monthly-usedMonth):
+		res.Limit, res.Remaining, res.Reset = plan.Daily, plan.Daily-usedDay, dayEnd.Sub(now)
+	case plan.Monthly > 0:
+		res.Limit, res.Remaining, res.Reset = plan.Monthly, plan.Monthly-usedMonth, monthEnd.Sub(now)
+	case plan.Rate > 0:
+		res.Limit, res.Remaining = plan.Burst, int64(math.Floor(tokens))
+		res.Reset = time.Duration((float64(plan.Burst) - tokens) / plan.Rate * float64(time.Second))
+	default:
+		res.Limit, res.Remaining = -1, -1
+	}
+	if res.Remaining < 0 && res.Limit >= 0 {
+		res.Remaining = 0
+	}
+
+	switch code {
+	case Burst:
+		res.RetryAfter = wait
+	case Daily:
+		res.RetryAfter = dayEnd.Sub(now)
+	case Monthly:
+		res.RetryAfter = monthEnd.Sub(now)
+	}
+	return res, nil
+}
+
+// TakeQuota 对token的quota:<token>总配额扣减cost个单位，没有配额时返回QuotaUnavailable
+func TakeQuota(ctx context.Context, rds redis.Scripter, token string, cost int64) (res *Result, err error) {
+	ret, err := quotaLimitScript.Run(ctx, rds, []string{"quota:" + token}, cost).Slice()
+	if err != nil {
+		return nil, err
+	}
+	res = &Result{
+		Code:      int(ret[0].(int64)),
+		Limit:     -1,
+		Remaining: ret[1].(int64),
+	}
+	return res, nil
+}
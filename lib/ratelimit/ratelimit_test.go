@@ -0,0 +1,143 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	redis "github.com/go-redis/redis/v8"
+)
+
+func newClient(t *testing.T) (*miniredis.Miniredis, redis.UniversalClient) {
+	s := miniredis.RunT(t)
+	return s, redis.NewUniversalClient(&redis.UniversalOptions{Addrs: []string{s.Addr()}})
+}
+
+// take 扣减并检查结果code，返回结果
+func take(t *testing.T, rds redis.Scripter, plan *Plan, cost int64, now time.Time, code int) *Result {
+	t.Helper()
+	res, err := Take(context.Background(), rds, "tok", plan, cost, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Code != code {
+		t.Fatalf("cost %d at %s: code %d, want %d", cost, now.Format(time.StampMilli), res.Code, code)
+	}
+	return res
+}
+
+var testNow = time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+func TestTakeRefill(t *testing.T) {
+	_, client := newClient(t)
+	plan := &Plan{Rate: 2, Burst: 4}
+
+	for i := 0; i < 4; i++ {
+		take(t, client, plan, 1, testNow, OK)
+	}
+	res := take(t, client, plan, 1, testNow, Burst)
+	if res.RetryAfter != 500*time.Millisecond || res.Remaining != 0 || res.Limit != 4 {
+		t.Fatalf("burst %+v", res)
+	}
+
+	// 每秒补充2个
+	take(t, client, plan, 1, testNow.Add(500*time.Millisecond), OK)
+	take(t, client, plan, 1, testNow.Add(500*time.Millisecond), Burst)
+
+	// 补充不超过桶容量
+	later := testNow.Add(time.Minute)
+	res = take(t, client, plan, 1, later, OK)
+	if res.Remaining != 3 || res.Reset != 500*time.Millisecond {
+		t.Fatalf("refill %+v", res)
+	}
+	for i := 0; i < 3; i++ {
+		take(t, client, plan, 1, later, OK)
+	}
+	take(t, client, plan, 1, later, Burst)
+}
+
+func TestTakeCost(t *testing.T) {
+	_, client := newClient(t)
+	plan := &Plan{Rate: 2, Burst: 4}
+
+	res := take(t, client, plan, 3, testNow, OK)
+	if res.Remaining != 1 {
+		t.Fatalf("remaining %d", res.Remaining)
+	}
+	// 不足时不扣减，等待补足cost所需的令牌
+	res = take(t, client, plan, 3, testNow, Burst)
+	if res.RetryAfter != time.Second || res.Remaining != 1 {
+		t.Fatalf("burst %+v", res)
+	}
+	take(t, client, plan, 1, testNow, OK)
+
+	// cost超过桶容量时桶满即可通过，扣空整个桶
+	full := testNow.Add(time.Minute)
+	res = take(t, client, plan, 10, full, OK)
+	if res.Remaining != 0 {
+		t.Fatalf("remaining %d", res.Remaining)
+	}
+	take(t, client, plan, 1, full, Burst)
+}
+
+func TestTakePeriodQuota(t *testing.T) {
+	s, client := newClient(t)
+	plan := &Plan{Daily: 5, Monthly: 6}
+
+	take(t, client, plan, 2, testNow, OK)
+	res := take(t, client, plan, 2, testNow, OK)
+	if res.Limit != 5 || res.Remaining != 1 || res.Reset != 12*time.Hour {
+		t.Fatalf("daily %+v", res)
+	}
+	res = take(t, client, plan, 2, testNow, Daily)
+	if res.RetryAfter != 12*time.Hour || res.Remaining != 1 {
+		t.Fatalf("daily exhausted %+v", res)
+	}
+	if got, _ := s.Get("rl:{tok}:d:20261019"); got != "4" {
+		t.Fatalf("used day %s", got)
+	}
+
+	// 次日的日配额重新计算，月配额剩余更少时报告月配额
+	nextDay := testNow.Add(24 * time.Hour)
+	res = take(t, client, plan, 1, nextDay, OK)
+	if res.Limit != 6 || res.Remaining != 1 {
+		t.Fatalf("monthly %+v", res)
+	}
+	res = take(t, client, plan, 2, nextDay, Monthly)
+	if res.RetryAfter != 11*24*time.Hour+12*time.Hour {
+		t.Fatalf("monthly exhausted %+v", res)
+	}
+
+	res = take(t, client, &Plan{}, 100, testNow, OK)
+	if res.Limit != -1 || res.Remaining != -1 {
+		t.Fatalf("unlimited %+v", res)
+	}
+}
+
+func TestTakeQuota(t *testing.T) {
+	s, client := newClient(t)
+	ctx := context.Background()
+
+	res, err := TakeQuota(ctx, client, "tok", 1)
+	if err != nil || res.Code != QuotaUnavailable {
+		t.Fatalf("%+v %v", res, err)
+	}
+
+	s.Set("quota:tok", "5")
+	for _, c := range []struct {
+		cost      int64
+		code      int
+		remaining int64
+	}{
+		{3, OK, 2},
+		{3, QuotaExhausted, 2},
+		{2, OK, 0},
+		{1, QuotaExhausted, 0},
+	} {
+		res, err := TakeQuota(ctx, client, "tok", c.cost)
+		if err != nil || res.Code != c.code || res.Remaining != c.remaining || res.Limit != -1 {
+			t.Fatalf("cost %d: %+v %v", c.cost, res, err)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+// Package rest bitcoind REST接口的路径解析与getutxos二进制编码
+package rest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sensiblequery/lib/blkparser"
+	"strconv"
+	"strings"
+)
+
+const (
+	FormatBin  = "bin"
+	FormatHex  = "hex"
+	FormatJson = "json"
+
+	MaxGetUtxosOutpoints = 15         // 单次getutxos最多查询的outpoint数
+	MaxHeaders           = 2000       // 单次headers最多返回的区块头数
+	MempoolHeight        = 0x7FFFFFFF // getutxos中mempool内utxo的高度
+)
+
+var (
+	ErrFormat     = errors.New("output format not found (available: .bin, .hex, .json)")
+	ErrParse      = errors.New("Parse error")
+	ErrEmptyQuery = errors.New("Error: empty request")
+)
+
+// ParseFormat 拆分<name>.<format>，format须在allowed之内
+func ParseFormat(param string, allowed ...string) (name, format string, err error) {
+	dot := strings.LastIndex(param, ".")
+	if dot < 0 {
+		return "", "", ErrFormat
+	}
+	name, format = param[:dot], param[dot+1:]
+	for _, f := range allowed {
+		if f == format {
+			return name, format, nil
+		}
+	}
+	return "", "", ErrFormat
+}
+
+// ParseHash 解析显示字节序的hash，返回内部字节序
+func ParseHash(hashHex string) ([]byte, bool) {
+	hash, err := hex.DecodeString(hashHex)
+	if err != nil || len(hash) != 32 {
+		return nil, false
+	}
+	return reverse(hash), true
+}
+
+type OutPoint struct {
+	TxId []byte // 内部字节序
+	Vout uint32
+}
+
+// ParseGetUtxos 解析/getutxos之后的路径，形如[/checkmempool]/<txid>-<n>/<txid>-<n>.<format>
+func ParseGetUtxos(path string) (checkMempool bool, outpoints []*OutPoint, format string, err error) {
+	path, format, err = ParseFormat(path, FormatBin, FormatHex, FormatJson)
+	if err != nil {
+		return false, nil, "", err
+	}
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) > 0 && parts[0] == "checkmempool" {
+		checkMempool = true
+		parts = parts[1:]
+	}
+	for _, part := range parts {
+		if part == "" {
+			continue
+		}
+		sep := strings.Index(part, "-")
+		if sep < 0 {
+			return false, nil, "", ErrParse
+		}
+		txid, ok := ParseHash(part[:sep])
+		if !ok {
+			return false, nil, "", ErrParse
+		}
+		vout, err := strconv.ParseUint(part[sep+1:], 10, 32)
+		if err != nil {
+			return false, nil, "", ErrParse
+		}
+		outpoints = append(outpoints, &OutPoint{TxId: txid, Vout: uint32(vout)})
+	}
+	if len(outpoints) == 0 {
+		return false, nil, "", ErrEmptyQuery
+	}
+	if len(outpoints) > MaxGetUtxosOutpoints {
+		return false, nil, "", fmt.Errorf("Error: max outpoints exceeded (max: %d, tried: %d)", MaxGetUtxosOutpoints, len(outpoints))
+	}
+	return checkMempool, outpoints, format, nil
+}
+
+type Coin struct {
+	Height uint32 // mempool中为MempoolHeight
+	Value  uint64
+	Script []byte
+}
+
+const (
+	// SpentTxIdPrefix 索引txin_spent的utxid只保存txid的前12字节
+	SpentTxIdPrefix = 12
+	// 索引中mempool交易的高度
+	indexMempoolHeight = 0xFFFFFFFF
+)
+
+// Txo 索引txout中的输出
+type Txo struct {
+	TxId   []byte
+	Vout   uint32
+	Value  uint64
+	Script []byte
+	Height uint32
+}
+
+// Spend 索引txin_spent中的花费，TxIdPrefix为被花费输出txid的前SpentTxIdPrefix字节
+type Spend struct {
+	TxIdPrefix []byte
+	Vout       uint32
+	Height     uint32
+}
+
+// spendKey txout与txin_spent按txid前缀及vout对应
+func spendKey(txid []byte, vout uint32) string {
+	if len(txid) > SpentTxIdPrefix {
+		txid = txid[:SpentTxIdPrefix]
+	}
+	return fmt.Sprintf("%x:%d", txid, vout)
+}
+
+// UnspentCoins 由txout及txin_spent的查询结果得到与outpoints一一对应的utxo，不是utxo的为nil。
+// 不检查mempool时只看已确认的输出和花费，检查时mempool中的输出算作utxo、被mempool花费的不算
+func UnspentCoins(outpoints []*OutPoint, txos []*Txo, spends []*Spend, checkMempool bool) []*Coin {
+	unspent := make(map[string]*Txo, len(txos))
+	for _, txo := range txos {
+		if txo.Height == indexMempoolHeight && !checkMempool {
+			continue
+		}
+		unspent[spendKey(txo.TxId, txo.Vout)] = txo
+	}
+	for _, spend := range spends {
+		if spend.Height == indexMempoolHeight && !checkMempool {
+			continue
+		}
+		delete(unspent, spendKey(spend.TxIdPrefix, spend.Vout))
+	}
+
+	coins := make([]*Coin, len(outpoints))
+	for i, outpoint := range outpoints {
+		txo, ok := unspent[spendKey(outpoint.TxId, outpoint.Vout)]
+		if !ok || !bytes.Equal(txo.TxId, outpoint.TxId) {
+			continue
+		}
+		height := txo.Height
+		if height == indexMempoolHeight {
+			height = MempoolHeight
+		}
+		coins[i] = &Coin{Height: height, Value: txo.Value, Script: txo.Script}
+	}
+	return coins
+}
+
+// Bitmap 每个outpoint是否为utxo，按位打包及"0101"形式
+func Bitmap(coins []*Coin) (bitmap []byte, bitmapString string) {
+	bitmap = make([]byte, (len(coins)+7)/8)
+	var sb strings.Builder
+	for i, coin := range coins {
+		if coin == nil {
+			sb.WriteByte('0')
+			continue
+		}
+		bitmap[i/8] |= 1 << uint(i%8)
+		sb.WriteByte('1')
+	}
+	return bitmap, sb.String()
+}
+
+// EncodeUtxos getutxos的二进制返回，coins中为nil的outpoint不输出
+func EncodeUtxos(chainHeight int, chainTip []byte, coins []*Coin) []byte {
+	bitmap, _ := Bitmap(coins)
+	buf := make([]byte, 4, 4+32+9+len(bitmap)+9)
+	binary.LittleEndian.PutUint32(buf, uint32(chainHeight))
+	buf = append(buf, chainTip...)
+	buf = append(buf, blkparser.EncodeVarInt(uint64(len(bitmap)))...)
+	buf = append(buf, bitmap...)
+
+	var hits []*Coin
+	for _, coin := range coins {
+		if coin != nil {
+			hits = append(hits, coin)
+		}
+	}
+	buf = append(buf, blkparser.EncodeVarInt(uint64(len(hits)))...)
+	for _, coin := range hits {
+		var num [16]byte
+		// nTxVerDummy固定为0
+		binary.LittleEndian.PutUint32(num[4:8], coin.Height)
+		binary.LittleEndian.PutUint64(num[8:16], coin.Value)
+		buf = append(buf, num[:]...)
+		buf = append(buf, blkparser.EncodeVarInt(uint64(len(coin.Script)))...)
+		buf = append(buf, coin.Script...)
+	}
+	return buf
+}
+
+func reverse(data []byte) []byte {
+	ret := make([]byte, len(data))
+	for i := range data {
+		ret[i] = data[len(data)-1-i]
+	}
+	return ret
+}
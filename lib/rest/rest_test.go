@@ -0,0 +1,104 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+const testTxId = "f4184fc596403b9d638783cf57adfe4c75c605f6356fbc91338530e9831e9e16"
+
+func TestParseFormat(t *testing.T) {
+	name, format, err := ParseFormat(testTxId+".hex", FormatBin, FormatHex)
+	if err != nil || name != testTxId || format != FormatHex {
+		t.Fatalf("%s %s %v", name, format, err)
+	}
+	for _, param := range []string{testTxId, testTxId + ".json", testTxId + "."} {
+		if _, _, err := ParseFormat(param, FormatBin, FormatHex); err != ErrFormat {
+			t.Fatalf("%q: %v", param, err)
+		}
+	}
+}
+
+func TestParseGetUtxos(t *testing.T) {
+	checkMempool, outpoints, format, err := ParseGetUtxos("/checkmempool/" + testTxId + "-0/" + testTxId + "-12.json")
+	if err != nil || !checkMempool || format != FormatJson || len(outpoints) != 2 {
+		t.Fatalf("%v %v %s %v", checkMempool, outpoints, format, err)
+	}
+	if hex.EncodeToString(reverse(outpoints[0].TxId)) != testTxId || outpoints[1].Vout != 12 {
+		t.Fatalf("outpoint %x %d", outpoints[0].TxId, outpoints[1].Vout)
+	}
+
+	checkMempool, outpoints, _, err = ParseGetUtxos("/" + testTxId + "-1.bin")
+	if err != nil || checkMempool || len(outpoints) != 1 {
+		t.Fatalf("%v %v %v", checkMempool, outpoints, err)
+	}
+
+	for path, want := range map[string]string{
+		"/checkmempool.json":                           ErrEmptyQuery.Error(),
+		"/" + testTxId + ".json":                       ErrParse.Error(),
+		"/zz-1.json":                                   ErrParse.Error(),
+		"/" + testTxId + "-x.json":                     ErrParse.Error(),
+		"/" + testTxId + "-1":                          ErrFormat.Error(),
+		strings.Repeat("/"+testTxId+"-1", 16) + ".hex": "Error: max outpoints exceeded (max: 15, tried: 16)",
+	} {
+		if _, _, _, err := ParseGetUtxos(path); err == nil || err.Error() != want {
+			t.Fatalf("%s: %v", path, err)
+		}
+	}
+}
+
+func TestEncodeUtxos(t *testing.T) {
+	coins := make([]*Coin, 9)
+	coins[0] = &Coin{Height: 100, Value: 5000000000, Script: []byte{0x51}}
+	coins[8] = &Coin{Height: MempoolHeight, Value: 1, Script: []byte{0x6a, 0x00}}
+	bitmap, bitmapString := Bitmap(coins)
+	if !bytes.Equal(bitmap, []byte{0x01, 0x01}) || bitmapString != "100000001" {
+		t.Fatalf("bitmap %x %s", bitmap, bitmapString)
+	}
+
+	tip := bytes.Repeat([]byte{0xab}, 32)
+	got := hex.EncodeToString(EncodeUtxos(200, tip, coins))
+	want := "c8000000" + hex.EncodeToString(tip) + "02" + "0101" + "02" +
+		"00000000" + "64000000" + "00f2052a01000000" + "01" + "51" +
+		"00000000" + "ffffff7f" + "0100000000000000" + "02" + "6a00"
+	if got != want {
+		t.Fatalf("got %s\nwant %s", got, want)
+	}
+}
+
+func TestUnspentCoins(t *testing.T) {
+	txid, _ := hex.DecodeString(testTxId)
+	other := bytes.Repeat([]byte{0x01}, 32)
+	outpoints := []*OutPoint{
+		{TxId: txid, Vout: 0},  // 已确认未花费
+		{TxId: txid, Vout: 1},  // 已确认花费
+		{TxId: txid, Vout: 2},  // mempool中花费
+		{TxId: other, Vout: 0}, // mempool中的输出
+		{TxId: other, Vout: 1}, // 不存在
+	}
+	txos := []*Txo{
+		{TxId: txid, Vout: 0, Value: 1, Script: []byte{0x51}, Height: 100},
+		{TxId: txid, Vout: 1, Value: 2, Height: 100},
+		{TxId: txid, Vout: 2, Value: 3, Height: 100},
+		{TxId: other, Vout: 0, Value: 4, Height: indexMempoolHeight},
+	}
+	// txin_spent中只有txid前缀
+	spends := []*Spend{
+		{TxIdPrefix: txid[:SpentTxIdPrefix], Vout: 1, Height: 101},
+		{TxIdPrefix: txid[:SpentTxIdPrefix], Vout: 2, Height: indexMempoolHeight},
+	}
+
+	_, got := Bitmap(UnspentCoins(outpoints, txos, spends, false))
+	if got != "10100" {
+		t.Fatalf("confirmed bitmap %s", got)
+	}
+	coins := UnspentCoins(outpoints, txos, spends, true)
+	if _, got = Bitmap(coins); got != "10010" {
+		t.Fatalf("mempool bitmap %s", got)
+	}
+	if coins[0].Height != 100 || coins[0].Value != 1 || coins[3].Height != MempoolHeight {
+		t.Fatalf("coins %+v %+v", coins[0], coins[3])
+	}
+}
@@ -0,0 +1,208 @@
+// Package rpcproxy bitcoind JSON-RPC转发的请求解析、方法白名单与参数校验。
+// 只有内置的只读方法可以转发，配置只能从中再挑选，钱包及节点管理类方法无法开放
+package rpcproxy
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// bitcoind的错误码
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInternalError  = -32603
+	CodeMiscError      = -1
+	CodeTypeError      = -3
+	CodeInvalidParams  = -8
+	CodeRateLimited    = -32001 // 方法调用频率超出限制
+	CodeForbidden      = -32002 // token没有方法需要的scope
+)
+
+const maxHexArray = 100 // testmempoolaccept一次最多检查的交易数
+
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func NewError(code int, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+type Request struct {
+	JsonRpc string            `json:"jsonrpc,omitempty"`
+	Id      json.RawMessage   `json:"id"`
+	Method  string            `json:"method"`
+	Params  []json.RawMessage `json:"params"`
+}
+
+// Response 与bitcoind一致，result和error总是输出
+type Response struct {
+	Result interface{}     `json:"result"`
+	Error  *Error          `json:"error"`
+	Id     json.RawMessage `json:"id"`
+}
+
+// Parse 解析单个请求或批量请求
+func Parse(data []byte) (reqs []*Request, batch bool, err *Error) {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		var raws []json.RawMessage
+		if json.Unmarshal(data, &raws) != nil {
+			return nil, true, NewError(CodeParseError, "Parse error")
+		}
+		if len(raws) == 0 {
+			return nil, true, NewError(CodeInvalidRequest, "Invalid Request object")
+		}
+		for _, raw := range raws {
+			req := &Request{}
+			if json.Unmarshal(raw, req) != nil {
+				// 单条请求格式错误时仍保留位置，由调用方返回错误
+				req = &Request{}
+			}
+			reqs = append(reqs, req)
+		}
+		return reqs, true, nil
+	}
+
+	req := &Request{}
+	if json.Unmarshal(data, req) != nil {
+		return nil, false, NewError(CodeParseError, "Parse error")
+	}
+	return []*Request{req}, false, nil
+}
+
+type argCheck struct {
+	name  string
+	check func(json.RawMessage) bool
+}
+
+type methodSpec struct {
+	required int
+	args     []argCheck
+}
+
+var (
+	argTxId      = argCheck{"txid", isHash}
+	argBlockHash = argCheck{"blockhash", isHash}
+	argVerbose   = argCheck{"verbose", isBool}
+	argHexString = argCheck{"hexstring", isHex}
+)
+
+// methods 可以转发的只读方法及参数
+var methods = map[string]*methodSpec{
+	"getbestblockhash":      {},
+	"getblockchaininfo":     {},
+	"getblockcount":         {},
+	"getchaintips":          {},
+	"getdifficulty":         {},
+	"getmempoolinfo":        {},
+	"getblockhash":          {1, []argCheck{{"height", isUint}}},
+	"getblockheader":        {1, []argCheck{argBlockHash, argVerbose}},
+	"getrawtransaction":     {1, []argCheck{argTxId, argVerbose}},
+	"getrawmempool":         {0, []argCheck{argVerbose}},
+	"getmempoolentry":       {1, []argCheck{argTxId}},
+	"getmempoolancestors":   {1, []argCheck{argTxId, argVerbose}},
+	"getmempooldescendants": {1, []argCheck{argTxId, argVerbose}},
+	"gettxout":              {2, []argCheck{argTxId, {"n", isUint}, {"include_mempool", isBool}}},
+	"testmempoolaccept":     {1, []argCheck{{"rawtxs", isHexArray}}},
+	"decoderawtransaction":  {1, []argCheck{argHexString}},
+	"decodescript":          {1, []argCheck{argHexString}},
+}
+
+// Supported 方法是否在内置的只读方法中
+func Supported(method string) bool {
+	_, ok := methods[method]
+	return ok
+}
+
+// pushMethods 会把交易交给节点检查的方法，与广播一样需要push scope
+var pushMethods = map[string]bool{
+	"testmempoolaccept": true,
+}
+
+// NeedsPush 方法是否需要push scope
+func NeedsPush(method string) bool {
+	return pushMethods[method]
+}
+
+// Methods 内置的只读方法，按名称排序
+func Methods() []string {
+	names := make([]string, 0, len(methods))
+	for name := range methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Validate 检查方法及参数个数、类型，method须已在白名单中
+func Validate(method string, params []json.RawMessage) *Error {
+	spec, ok := methods[method]
+	if !ok {
+		return NewError(CodeMethodNotFound, "Method not found")
+	}
+	if len(params) < spec.required || len(params) > len(spec.args) {
+		return NewError(CodeInvalidParams, fmt.Sprintf("%s takes %d to %d parameters", method, spec.required, len(spec.args)))
+	}
+	for i, param := range params {
+		if !spec.args[i].check(param) {
+			return NewError(CodeTypeError, fmt.Sprintf("invalid parameter %s", spec.args[i].name))
+		}
+	}
+	return nil
+}
+
+func isHexString(param json.RawMessage, size int) bool {
+	var s string
+	if json.Unmarshal(param, &s) != nil || s == "" {
+		return false
+	}
+	data, err := hex.DecodeString(s)
+	return err == nil && (size == 0 || len(data) == size)
+}
+
+func isHash(param json.RawMessage) bool {
+	return isHexString(param, 32)
+}
+
+func isHex(param json.RawMessage) bool {
+	return isHexString(param, 0)
+}
+
+// isBool bitcoind的verbose参数也接受0/1
+func isBool(param json.RawMessage) bool {
+	var b bool
+	if json.Unmarshal(param, &b) == nil {
+		return true
+	}
+	var n int
+	return json.Unmarshal(param, &n) == nil && (n == 0 || n == 1)
+}
+
+func isUint(param json.RawMessage) bool {
+	var n int64
+	return json.Unmarshal(param, &n) == nil && n >= 0
+}
+
+func isHexArray(param json.RawMessage) bool {
+	var items []json.RawMessage
+	if json.Unmarshal(param, &items) != nil || len(items) == 0 || len(items) > maxHexArray {
+		return false
+	}
+	for _, item := range items {
+		if !isHex(item) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,88 @@
+package rpcproxy
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+const testTxId = `"f4184fc596403b9d638783cf57adfe4c75c605f6356fbc91338530e9831e9e16"`
+
+func params(raw ...string) (ret []json.RawMessage) {
+	for _, r := range raw {
+		ret = append(ret, json.RawMessage(r))
+	}
+	return ret
+}
+
+func TestParse(t *testing.T) {
+	reqs, batch, err := Parse([]byte(`{"jsonrpc":"1.0","id":"x","method":"getblockcount","params":[]}`))
+	if err != nil || batch || len(reqs) != 1 || reqs[0].Method != "getblockcount" || string(reqs[0].Id) != `"x"` {
+		t.Fatalf("%v %v %v", reqs, batch, err)
+	}
+
+	reqs, batch, err = Parse([]byte(` [{"id":1,"method":"getblockhash","params":[0]}, 5]`))
+	if err != nil || !batch || len(reqs) != 2 || reqs[0].Method != "getblockhash" || reqs[1].Method != "" {
+		t.Fatalf("%v %v %v", reqs, batch, err)
+	}
+
+	for data, code := range map[string]int{
+		`{bad`: CodeParseError,
+		`[bad`: CodeParseError,
+		`[]`:   CodeInvalidRequest,
+	} {
+		if _, _, err := Parse([]byte(data)); err == nil || err.Code != code {
+			t.Fatalf("%s: %v", data, err)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, c := range []struct {
+		method string
+		params []json.RawMessage
+		code   int
+	}{
+		{"getblockcount", nil, 0},
+		{"getrawtransaction", params(testTxId), 0},
+		{"getrawtransaction", params(testTxId, "true"), 0},
+		{"getrawtransaction", params(testTxId, "1"), 0},
+		{"getrawtransaction", params(testTxId, "2"), CodeTypeError},
+		{"getrawtransaction", params(`"abcd"`), CodeTypeError},
+		{"getrawtransaction", nil, CodeInvalidParams},
+		{"getrawtransaction", params(testTxId, "true", "1"), CodeInvalidParams},
+		{"getblockhash", params("100"), 0},
+		{"getblockhash", params("-1"), CodeTypeError},
+		{"gettxout", params(testTxId, "0", "false"), 0},
+		{"testmempoolaccept", params(`["00","0102"]`), 0},
+		{"testmempoolaccept", params(`[]`), CodeTypeError},
+		{"testmempoolaccept", params(`["zz"]`), CodeTypeError},
+		{"decoderawtransaction", params(`"0100"`), 0},
+		{"decoderawtransaction", params(`""`), CodeTypeError},
+		{"getblockcount", params("1"), CodeInvalidParams},
+		{"sendrawtransaction", params(`"00"`), CodeMethodNotFound},
+		{"dumpprivkey", params(`"1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2"`), CodeMethodNotFound},
+		{"stop", nil, CodeMethodNotFound},
+	} {
+		err := Validate(c.method, c.params)
+		if (c.code == 0 && err != nil) || (c.code != 0 && (err == nil || err.Code != c.code)) {
+			t.Fatalf("%s %s: %v", c.method, c.params, err)
+		}
+	}
+}
+
+func TestMethods(t *testing.T) {
+	names := Methods()
+	for i, name := range names {
+		if !Supported(name) || (i > 0 && names[i-1] >= name) {
+			t.Fatalf("methods %v", names)
+		}
+	}
+	for _, name := range []string{"sendrawtransaction", "getwalletinfo", "stop", "setban", "getpeerinfo"} {
+		if Supported(name) {
+			t.Fatalf("%s supported", name)
+		}
+	}
+	if !NeedsPush("testmempoolaccept") || NeedsPush("getrawtransaction") || NeedsPush("sendrawtransaction") {
+		t.Fatal("push methods")
+	}
+}
@@ -0,0 +1,296 @@
+// Package settings 运行时可重新加载的配置：查询限制、接口缓存时长、广播目标和日志级别。
+// 由SIGHUP或管理接口触发重新加载，新配置校验通过后整体替换，失败时保留原配置
+package settings
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"sensiblequery/logger"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	DefaultMaxHistorySize       = 2048
+	DefaultMaxHistoryLimit      = 102400
+	DefaultMaxHistoryBlockRange = 100000
+	DefaultMaxUtxoSize          = 5120
+
+	DefaultRpcTimeout       = 30 * time.Second
+	DefaultRpcProbeInterval = 5 * time.Second
+	DefaultRpcMaxLagBlocks  = 2
+)
+
+// Limits 接口参数限制
+type Limits struct {
+	MaxHistorySize       int `mapstructure:"max_history_size"`        // 历史记录每页数量
+	MaxHistoryLimit      int `mapstructure:"max_history_limit"`       // 历史记录offset分页时cursor+size
+	MaxHistoryBlockRange int `mapstructure:"max_history_block_range"` // 历史记录查询的区块范围
+	MaxUtxoSize          int `mapstructure:"max_utxo_size"`           // utxo每页数量
+}
+
+// RpcNode bitcoind rpc节点，Auth为解析后的user:password
+type RpcNode struct {
+	Url  string
+	Auth string
+}
+
+// Broadcast 交易广播目标，来自chain.yaml
+type Broadcast struct {
+	WocKey  string
+	Rpc     string // 单节点配置，配置了rpc_nodes时可以为空
+	RpcAuth string // 节点未单独配置认证时使用
+	Nodes   []RpcNode
+
+	RpcTimeout       time.Duration // 单次rpc调用超时
+	RpcProbeInterval time.Duration // getblockcount探测间隔
+	RpcMaxLagBlocks  int           // 落后最高节点超过该区块数的节点不参与读请求
+}
+
+type Settings struct {
+	LogLevel  string
+	Limits    Limits
+	Cache     map[string]time.Duration // 路由模式 => 缓存时长，覆盖代码中的默认值，0为不缓存
+	Broadcast Broadcast
+
+	level zapcore.Level
+}
+
+var (
+	runtimeFile = "conf/runtime.yaml"
+	chainFile   = "conf/chain.yaml"
+
+	current  atomic.Value // *Settings
+	reloadMu sync.Mutex
+	hooksMu  sync.Mutex
+	hooks    []func(s *Settings)
+)
+
+func init() {
+	// 没有配置文件时(如单元测试)使用默认值
+	if _, err := os.Stat(chainFile); err != nil {
+		current.Store(defaults())
+		return
+	}
+	s, err := Load(runtimeFile, chainFile)
+	if err != nil {
+		panic(fmt.Errorf("Fatal error config file: %s \n", err))
+	}
+	apply(s)
+}
+
+func defaults() *Settings {
+	return &Settings{
+		LogLevel: "debug",
+		Limits: Limits{
+			MaxHistorySize:       DefaultMaxHistorySize,
+			MaxHistoryLimit:      DefaultMaxHistoryLimit,
+			MaxHistoryBlockRange: DefaultMaxHistoryBlockRange,
+			MaxUtxoSize:          DefaultMaxUtxoSize,
+		},
+		Cache: map[string]time.Duration{},
+	}
+}
+
+// Load 读取并校验配置。runtimeFile可以不存在，此时使用默认值
+func Load(runtimeFile, chainFile string) (*Settings, error) {
+	s := defaults()
+
+	if _, err := os.Stat(runtimeFile); err == nil {
+		v := viper.New()
+		v.SetConfigFile(runtimeFile)
+		if err := v.ReadInConfig(); err != nil {
+			return nil, err
+		}
+		if v.IsSet("log_level") {
+			s.LogLevel = v.GetString("log_level")
+		}
+		if err := v.UnmarshalKey("limits", &s.Limits); err != nil {
+			return nil, fmt.Errorf("%s limits: %w", runtimeFile, err)
+		}
+		if err := v.UnmarshalKey("cache", &s.Cache); err != nil {
+			return nil, fmt.Errorf("%s cache: %w", runtimeFile, err)
+		}
+	}
+
+	v := viper.New()
+	v.SetConfigFile(chainFile)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, err
+	}
+	if err := loadBroadcast(v, &s.Broadcast); err != nil {
+		return nil, fmt.Errorf("%s: %w", chainFile, err)
+	}
+
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// secret 密钥配置，可以由<key>_env指定环境变量或<key>_file指定文件，避免明文写在配置文件中
+func secret(key, value, env, file string) (string, error) {
+	switch {
+	case env != "":
+		value = os.Getenv(env)
+		if value == "" {
+			return "", fmt.Errorf("%s_env: %s not set", key, env)
+		}
+	case file != "":
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("%s_file: %w", key, err)
+		}
+		value = strings.TrimSpace(string(data))
+	}
+	return value, nil
+}
+
+func loadBroadcast(v *viper.Viper, b *Broadcast) (err error) {
+	v.SetDefault("rpc_timeout", DefaultRpcTimeout)
+	v.SetDefault("rpc_probe_interval", DefaultRpcProbeInterval)
+	v.SetDefault("rpc_max_lag_blocks", DefaultRpcMaxLagBlocks)
+
+	b.Rpc = v.GetString("rpc")
+	b.RpcTimeout = v.GetDuration("rpc_timeout")
+	b.RpcProbeInterval = v.GetDuration("rpc_probe_interval")
+	b.RpcMaxLagBlocks = v.GetInt("rpc_max_lag_blocks")
+	if b.WocKey, err = secret("woc_key", v.GetString("woc_key"), v.GetString("woc_key_env"), v.GetString("woc_key_file")); err != nil {
+		return err
+	}
+	if b.RpcAuth, err = secret("rpc_auth", v.GetString("rpc_auth"), v.GetString("rpc_auth_env"), v.GetString("rpc_auth_file")); err != nil {
+		return err
+	}
+
+	var nodes []struct {
+		Url      string `mapstructure:"url"`
+		Auth     string `mapstructure:"auth"`
+		AuthEnv  string `mapstructure:"auth_env"`
+		AuthFile string `mapstructure:"auth_file"`
+	}
+	if err := v.UnmarshalKey("rpc_nodes", &nodes); err != nil {
+		return fmt.Errorf("rpc_nodes: %w", err)
+	}
+	if len(nodes) == 0 {
+		b.Nodes = []RpcNode{{Url: b.Rpc, Auth: b.RpcAuth}}
+		return nil
+	}
+	for idx, node := range nodes {
+		auth, err := secret(fmt.Sprintf("rpc_nodes[%d].auth", idx), node.Auth, node.AuthEnv, node.AuthFile)
+		if err != nil {
+			return err
+		}
+		if auth == "" {
+			auth = b.RpcAuth
+		}
+		b.Nodes = append(b.Nodes, RpcNode{Url: node.Url, Auth: auth})
+	}
+	return nil
+}
+
+func (s *Settings) validate() error {
+	if err := s.level.Set(s.LogLevel); err != nil {
+		return fmt.Errorf("log_level: %w", err)
+	}
+
+	limits := []struct {
+		name  string
+		value int
+	}{
+		{"max_history_size", s.Limits.MaxHistorySize},
+		{"max_history_limit", s.Limits.MaxHistoryLimit},
+		{"max_history_block_range", s.Limits.MaxHistoryBlockRange},
+		{"max_utxo_size", s.Limits.MaxUtxoSize},
+	}
+	for _, limit := range limits {
+		if limit.value <= 0 {
+			return fmt.Errorf("limits.%s: must be positive, got %d", limit.name, limit.value)
+		}
+	}
+	if s.Limits.MaxHistoryLimit < s.Limits.MaxHistorySize {
+		return fmt.Errorf("limits.max_history_limit: less than max_history_size")
+	}
+
+	for route, ttl := range s.Cache {
+		if !strings.HasPrefix(route, "/") {
+			return fmt.Errorf("cache: invalid route %q", route)
+		}
+		if ttl < 0 {
+			return fmt.Errorf("cache %s: negative ttl", route)
+		}
+	}
+
+	for idx, node := range s.Broadcast.Nodes {
+		u, err := url.Parse(node.Url)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("rpc node %d: invalid url %q", idx, node.Url)
+		}
+	}
+	if s.Broadcast.RpcTimeout <= 0 || s.Broadcast.RpcProbeInterval <= 0 {
+		return fmt.Errorf("rpc_timeout, rpc_probe_interval: must be positive")
+	}
+	if s.Broadcast.RpcMaxLagBlocks < 0 {
+		return fmt.Errorf("rpc_max_lag_blocks: negative")
+	}
+	return nil
+}
+
+// Get 当前配置，不可修改
+func Get() *Settings {
+	return current.Load().(*Settings)
+}
+
+// CacheTTL 路由的缓存时长，未配置时为def
+func CacheTTL(route string, def time.Duration) time.Duration {
+	if ttl, ok := Get().Cache[route]; ok {
+		return ttl
+	}
+	return def
+}
+
+// OnChange 注册配置变化回调，注册时以当前配置调用一次
+func OnChange(fn func(s *Settings)) {
+	hooksMu.Lock()
+	hooks = append(hooks, fn)
+	hooksMu.Unlock()
+	fn(Get())
+}
+
+func apply(s *Settings) {
+	current.Store(s)
+	logger.Level.SetLevel(s.level)
+
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	for _, fn := range hooks {
+		fn(s)
+	}
+}
+
+// Reload 重新读取配置文件，校验失败时返回错误并保留原配置
+func Reload() (*Settings, error) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	s, err := Load(runtimeFile, chainFile)
+	if err != nil {
+		logger.Log.Warn("reload settings failed, keep current", zap.Error(err))
+		return nil, err
+	}
+	apply(s)
+	logger.Log.Info("settings reloaded",
+		zap.String("logLevel", s.LogLevel),
+		zap.Any("limits", s.Limits),
+		zap.Int("cacheRoutes", len(s.Cache)),
+		zap.Int("rpcNodes", len(s.Broadcast.Nodes)),
+	)
+	return s, nil
+}
@@ -0,0 +1,152 @@
+package settings
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeConf(t *testing.T, dir, name, content string) string {
+	filename := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+const testChain = `
+rpc: "http://127.0.0.1:8332"
+rpc_auth: "user:pass"
+woc_key: "key"
+`
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	chain := writeConf(t, dir, "chain.yaml", testChain)
+
+	// 没有runtime.yaml时使用默认值
+	s, err := Load(filepath.Join(dir, "runtime.yaml"), chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Limits.MaxHistorySize != DefaultMaxHistorySize || s.Broadcast.RpcAuth != "user:pass" {
+		t.Fatalf("unexpected settings %+v", s)
+	}
+
+	runtime := writeConf(t, dir, "runtime.yaml", `
+log_level: warn
+limits:
+  max_history_size: 100
+cache:
+  "/address/:address/utxo": 5s
+  "/ft/info/all": 0
+`)
+	s, err = Load(runtime, chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Limits.MaxHistorySize != 100 || s.Limits.MaxHistoryLimit != DefaultMaxHistoryLimit {
+		t.Fatalf("unexpected limits %+v", s.Limits)
+	}
+	if s.Cache["/address/:address/utxo"] != 5*time.Second || s.Cache["/ft/info/all"] != 0 {
+		t.Fatalf("unexpected cache %v", s.Cache)
+	}
+	if s.level.String() != "warn" {
+		t.Fatalf("unexpected level %s", s.level)
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	dir := t.TempDir()
+	chain := writeConf(t, dir, "chain.yaml", testChain)
+	for _, content := range []string{
+		"log_level: loud",
+		"limits:\n  max_history_size: 0",
+		"limits:\n  max_history_size: 200000",
+		"cache:\n  \"/tx/:txid\": -1s",
+		"cache:\n  \"/tx/:txid\": soon",
+	} {
+		runtime := writeConf(t, dir, "runtime.yaml", content)
+		if _, err := Load(runtime, chain); err == nil {
+			t.Fatalf("%q should be invalid", content)
+		}
+	}
+
+	badChain := writeConf(t, dir, "bad_chain.yaml", `rpc: "127.0.0.1:8332"`)
+	if _, err := Load(filepath.Join(dir, "none.yaml"), badChain); err == nil {
+		t.Fatal("rpc without scheme should be invalid")
+	}
+}
+
+func TestLoadRpcNodes(t *testing.T) {
+	dir := t.TempDir()
+	authFile := writeConf(t, dir, "node2.auth", "u2:p2\n")
+	os.Setenv("TEST_RPC_AUTH_1", "u1:p1")
+	defer os.Unsetenv("TEST_RPC_AUTH_1")
+	chain := writeConf(t, dir, "chain.yaml", `
+rpc_auth: "default:pass"
+rpc_probe_interval: 2s
+rpc_nodes:
+  - url: "http://10.0.0.1:8332"
+    auth_env: TEST_RPC_AUTH_1
+  - url: "http://10.0.0.2:8332"
+    auth_file: "`+authFile+`"
+  - url: "https://10.0.0.3:8332"
+`)
+	s, err := Load(filepath.Join(dir, "none.yaml"), chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := s.Broadcast
+	if len(b.Nodes) != 3 || b.Nodes[0].Auth != "u1:p1" || b.Nodes[1].Auth != "u2:p2" || b.Nodes[2].Auth != "default:pass" {
+		t.Fatalf("unexpected nodes %+v", b.Nodes)
+	}
+	if b.RpcProbeInterval != 2*time.Second || b.RpcTimeout != DefaultRpcTimeout || b.RpcMaxLagBlocks != DefaultRpcMaxLagBlocks {
+		t.Fatalf("unexpected broadcast %+v", b)
+	}
+
+	// 旧配置为单节点
+	s, err = Load(filepath.Join(dir, "none.yaml"), writeConf(t, dir, "single.yaml", testChain))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Broadcast.Nodes) != 1 || s.Broadcast.Nodes[0].Url != "http://127.0.0.1:8332" || s.Broadcast.Nodes[0].Auth != "user:pass" {
+		t.Fatalf("unexpected nodes %+v", s.Broadcast.Nodes)
+	}
+
+	for _, content := range []string{
+		"rpc_nodes:\n  - url: \"http://10.0.0.1:8332\"\n    auth_env: TEST_RPC_AUTH_UNSET",
+		"rpc_nodes:\n  - url: \"http://10.0.0.1:8332\"\n    auth_file: \"" + filepath.Join(dir, "none.auth") + "\"",
+		"rpc_nodes:\n  - url: \"10.0.0.1:8332\"",
+		"rpc: \"http://127.0.0.1:8332\"\nrpc_probe_interval: 0s",
+	} {
+		if _, err := Load(filepath.Join(dir, "none.yaml"), writeConf(t, dir, "bad.yaml", content)); err == nil {
+			t.Fatalf("%q should be invalid", content)
+		}
+	}
+}
+
+func TestReloadKeepsCurrentOnError(t *testing.T) {
+	dir := t.TempDir()
+	runtimeFile = writeConf(t, dir, "runtime.yaml", "limits:\n  max_utxo_size: 10")
+	chainFile = writeConf(t, dir, "chain.yaml", testChain)
+
+	var changes []int
+	OnChange(func(s *Settings) { changes = append(changes, s.Limits.MaxUtxoSize) })
+
+	if _, err := Reload(); err != nil {
+		t.Fatal(err)
+	}
+	writeConf(t, dir, "runtime.yaml", "limits:\n  max_utxo_size: -1")
+	if _, err := Reload(); err == nil {
+		t.Fatal("reload should fail")
+	}
+	if Get().Limits.MaxUtxoSize != 10 {
+		t.Fatalf("current settings replaced: %+v", Get().Limits)
+	}
+	if len(changes) != 2 || changes[0] != DefaultMaxUtxoSize || changes[1] != 10 {
+		t.Fatalf("changes %v", changes)
+	}
+}
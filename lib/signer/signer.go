@@ -0,0 +1,92 @@
+// Package signer 为请求生成appid/ts/nonce/sign签名参数，服务端使用同样的规则校验。
+//
+// 签名原文为: 接口路由 + "?" + 按参数名排序的query字符串(不含sign)。
+// 带body的请求(POST等)在其后追加 "\n" + 请求方法 + "\n" + hex(sha256(body))。
+// 签名为对原文以secret做HMAC-SHA256后的十六进制编码。
+package signer
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	ParamAppId = "appid"
+	ParamTs    = "ts"
+	ParamNonce = "nonce"
+	ParamSign  = "sign"
+)
+
+// StringToSign 生成签名原文，query中的sign参数会被忽略
+func StringToSign(method, path string, query url.Values, body []byte) string {
+	params := url.Values{}
+	for k, v := range query {
+		if k != ParamSign {
+			params[k] = v
+		}
+	}
+	input := path + "?" + params.Encode()
+	if method != "" && method != http.MethodGet && method != http.MethodHead {
+		bodyHash := sha256.Sum256(body)
+		input += "\n" + method + "\n" + hex.EncodeToString(bodyHash[:])
+	}
+	return input
+}
+
+// Sign 对签名原文做HMAC-SHA256
+func Sign(input, secret string) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(input))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Verify 常数时间比较签名
+func Verify(input, secret, sign string) bool {
+	return hmac.Equal([]byte(Sign(input, secret)), []byte(sign))
+}
+
+func NewNonce() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+type Signer struct {
+	AppId  string
+	Secret string
+}
+
+func New(appId, secret string) *Signer {
+	return &Signer{AppId: appId, Secret: secret}
+}
+
+// SignRequest 为请求添加appid/ts/nonce/sign参数，会读取并恢复req.Body
+func (s *Signer) SignRequest(req *http.Request) error {
+	var body []byte
+	if req.Body != nil {
+		data, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return err
+		}
+		req.Body.Close()
+		body = data
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	query := req.URL.Query()
+	query.Set(ParamAppId, s.AppId)
+	query.Set(ParamTs, strconv.FormatInt(time.Now().Unix(), 10))
+	query.Set(ParamNonce, NewNonce())
+	query.Del(ParamSign)
+	query.Set(ParamSign, Sign(StringToSign(req.Method, req.URL.Path, query, body), s.Secret))
+	req.URL.RawQuery = query.Encode()
+	return nil
+}
@@ -0,0 +1,49 @@
+package signer
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestSignGet(t *testing.T) {
+	// Authorization.md中的示例
+	query, _ := url.ParseQuery("start=0&end=0&cursor=0&size=5&appid=9Hs3kifu8uHuJkmS9ktk&ts=1661648098&sign=xx")
+	input := StringToSign(http.MethodGet, "/address/17PcYSCLs7rx5BWC1rmA35ZLPNrN5u85dW/history/tx", query, nil)
+	sign := Sign(input, "oiwzUTJ9nSqevJW0VYE7QyikOEh2rRgAXlmFed2w")
+	if sign != "63edca714f5c4e6ca5421b2ce4530a4d5472e8d3cf8a7b93082522b32117b5ba" {
+		t.Fatalf("sign mismatch: %s", sign)
+	}
+}
+
+func TestSignRequest(t *testing.T) {
+	body := []byte(`{"txHex":"00"}`)
+	req, _ := http.NewRequest(http.MethodPost, "http://localhost/pushtx?x=1", bytes.NewReader(body))
+	s := New("app", "secret")
+	if err := s.SignRequest(req); err != nil {
+		t.Fatal(err)
+	}
+
+	// body仍可读取
+	data, _ := ioutil.ReadAll(req.Body)
+	if !bytes.Equal(data, body) {
+		t.Fatalf("body not restored: %s", data)
+	}
+
+	query := req.URL.Query()
+	if query.Get(ParamAppId) != "app" || query.Get(ParamTs) == "" || query.Get(ParamNonce) == "" {
+		t.Fatalf("params missing: %s", req.URL.RawQuery)
+	}
+	input := StringToSign(req.Method, req.URL.Path, query, data)
+	if !Verify(input, "secret", query.Get(ParamSign)) {
+		t.Fatal("verify failed")
+	}
+
+	// 修改body后签名失效
+	input = StringToSign(req.Method, req.URL.Path, query, []byte(`{"txHex":"01"}`))
+	if Verify(input, "secret", query.Get(ParamSign)) {
+		t.Fatal("verify should fail with tampered body")
+	}
+}
@@ -0,0 +1,71 @@
+package tracing
+
+import (
+	"context"
+	"strings"
+
+	redis "github.com/go-redis/redis/v8"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const maxPipelineCmdNames = 16
+
+type redisSpanKey struct{}
+
+// RedisHook 为redis命令和pipeline创建子span，只在请求已有span时记录
+type RedisHook struct {
+	Client string
+}
+
+func (h RedisHook) start(ctx context.Context, name string, attrs ...attribute.KeyValue) context.Context {
+	if !trace.SpanFromContext(ctx).IsRecording() {
+		return ctx
+	}
+	attrs = append(attrs, attribute.String("db.system", "redis"), attribute.String("db.redis.client", h.Client))
+	_, span := tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+	return context.WithValue(ctx, redisSpanKey{}, span)
+}
+
+func (h RedisHook) end(ctx context.Context, cmds []redis.Cmder) {
+	span, ok := ctx.Value(redisSpanKey{}).(trace.Span)
+	if !ok {
+		return
+	}
+	for _, cmd := range cmds {
+		if err := cmd.Err(); err != nil && err != redis.Nil {
+			End(span, err)
+			return
+		}
+	}
+	span.End()
+}
+
+func (h RedisHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return h.start(ctx, "redis "+cmd.Name(), attribute.String("db.operation", cmd.Name())), nil
+}
+
+func (h RedisHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	h.end(ctx, []redis.Cmder{cmd})
+	return nil
+}
+
+func (h RedisHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	names := make([]string, 0, len(cmds))
+	for i, cmd := range cmds {
+		if i == maxPipelineCmdNames {
+			names = append(names, "...")
+			break
+		}
+		names = append(names, cmd.Name())
+	}
+	return h.start(ctx, "redis pipeline",
+		attribute.Int("db.redis.pipeline_length", len(cmds)),
+		attribute.String("db.operation", strings.Join(names, " ")),
+	), nil
+}
+
+func (h RedisHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	h.end(ctx, cmds)
+	return nil
+}
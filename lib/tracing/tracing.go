@@ -0,0 +1,153 @@
+// Package tracing 基于OpenTelemetry的链路追踪。
+// 配置conf/trace.yaml后启用，未配置时所有span均为no-op
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	ExporterStdout = "stdout"
+	ExporterOtlp   = "otlp"
+	ExporterNone   = "none"
+
+	instrumentationName = "sensiblequery"
+)
+
+var (
+	provider *sdktrace.TracerProvider
+	tracer   = otel.Tracer(instrumentationName)
+)
+
+func init() {
+	filename := "conf/trace.yaml"
+	if _, err := os.Stat(filename); err != nil {
+		return
+	}
+	v := viper.New()
+	v.SetConfigFile(filename)
+	if err := v.ReadInConfig(); err != nil {
+		panic(fmt.Errorf("Fatal error config file: %s \n", err))
+	}
+	v.SetDefault("exporter", ExporterStdout)
+	v.SetDefault("serviceName", instrumentationName)
+	v.SetDefault("sampleRatio", 1.0)
+	v.SetDefault("timeout", 10*time.Second)
+
+	var exporter sdktrace.SpanExporter
+	switch v.GetString("exporter") {
+	case ExporterNone:
+		return
+	case ExporterStdout:
+		exp, err := stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+		if err != nil {
+			panic(fmt.Errorf("Fatal error trace exporter: %s \n", err))
+		}
+		exporter = exp
+	case ExporterOtlp:
+		endpoint := v.GetString("endpoint")
+		if endpoint == "" {
+			panic(fmt.Errorf("Fatal error config file: %s: otlp endpoint required \n", filename))
+		}
+		exp, err := newOtlpExporter(endpoint, v.GetStringMapString("headers"), v.GetDuration("timeout"))
+		if err != nil {
+			panic(fmt.Errorf("Fatal error trace exporter: %s \n", err))
+		}
+		exporter = exp
+	default:
+		panic(fmt.Errorf("Fatal error config file: %s: unknown exporter %s \n", filename, v.GetString("exporter")))
+	}
+
+	res := resource.NewSchemaless(attribute.String("service.name", v.GetString("serviceName")))
+	provider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(v.GetFloat64("sampleRatio")))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+}
+
+// newOtlpExporter 以OTLP/HTTP(protobuf)导出span，endpoint如http://collector:4318/v1/traces
+func newOtlpExporter(endpoint string, headers map[string]string, timeout time.Duration) (sdktrace.SpanExporter, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("otlp endpoint invalid: %s", endpoint)
+	}
+	opts := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(u.Host),
+		otlptracehttp.WithHeaders(headers),
+		otlptracehttp.WithTimeout(timeout),
+	}
+	if u.Path != "" {
+		opts = append(opts, otlptracehttp.WithURLPath(u.Path))
+	}
+	if u.Scheme == "http" {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	return otlptracehttp.New(context.Background(), opts...)
+}
+
+// Enabled 是否已配置链路追踪
+func Enabled() bool {
+	return provider != nil
+}
+
+// Shutdown 导出剩余的span，进程退出前调用
+func Shutdown(ctx context.Context) error {
+	if provider == nil {
+		return nil
+	}
+	return provider.Shutdown(ctx)
+}
+
+// Start 创建span
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, opts...)
+}
+
+// StartChild 仅在ctx中已有记录中的span时创建子span，避免后台任务产生孤立的根span
+func StartChild(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	if !trace.SpanFromContext(ctx).IsRecording() {
+		return ctx, trace.SpanFromContext(ctx)
+	}
+	return tracer.Start(ctx, name, opts...)
+}
+
+// End 结束span，err不为nil时标记为失败
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// TraceId ctx中的trace id，没有有效trace时返回空
+func TraceId(ctx context.Context) string {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return ""
+	}
+	return sc.TraceID().String()
+}
+
+// Detach 返回不随请求取消、但仍属于同一trace的ctx，用于请求返回后继续执行的后台任务
+func Detach(ctx context.Context) context.Context {
+	return trace.ContextWithSpanContext(context.Background(), trace.SpanContextFromContext(ctx))
+}
@@ -0,0 +1,46 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestNewOtlpExporter(t *testing.T) {
+	for _, endpoint := range []string{"", "collector:4318", "grpc://collector:4317/v1/traces", "http:///v1/traces"} {
+		if _, err := newOtlpExporter(endpoint, nil, time.Second); err == nil {
+			t.Fatalf("endpoint %q should be rejected", endpoint)
+		}
+	}
+
+	type request struct{ path, auth, contentType string }
+	received := make(chan request, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- request{r.URL.Path, r.Header.Get("Authorization"), r.Header.Get("Content-Type")}
+	}))
+	defer srv.Close()
+
+	exp, err := newOtlpExporter(srv.URL+"/custom/traces", map[string]string{"Authorization": "Bearer abc"}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp))
+	_, span := provider.Tracer("test").Start(context.Background(), "op")
+	span.End()
+	if err := provider.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case req := <-received:
+		if req.path != "/custom/traces" || req.auth != "Bearer abc" || req.contentType != "application/x-protobuf" {
+			t.Fatalf("request %+v", req)
+		}
+	default:
+		t.Fatal("no span exported")
+	}
+}
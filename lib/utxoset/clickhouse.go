@@ -0,0 +1,69 @@
+package utxoset
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+)
+
+// ClickhouseQuery 由txout及txin_spent计算地址utxo集合的查询，每行由ScanClickhouseTxo读取。
+// codeHash为空时为地址的普通utxo
+func ClickhouseQuery(codeHash, genesisId, addressPkh []byte) string {
+	addressHex := hex.EncodeToString(addressPkh)
+	codehashMatch := "codehash = '' AND genesis = ''"
+	if len(codeHash) > 0 {
+		codehashMatch = fmt.Sprintf("codehash = unhex('%s') AND genesis = unhex('%s')",
+			hex.EncodeToString(codeHash), hex.EncodeToString(genesisId))
+	}
+
+	// 已确认的输出经txout_genesis_height按地址定位，mempool中的直接查txout，
+	// 两部分分别查询后UNION ALL，使已确认部分可以使用主键及分区裁剪。
+	// 同一输出可能同时有mempool和已确认的花费记录，取已确认的
+	return fmt.Sprintf(`
+SELECT utxid, vout, height, utxidx, satoshi, script_pk, spent_height FROM
+(
+    SELECT utxid, substring(utxid, 1, 12) AS utxid12, vout, height, utxidx, satoshi, script_pk FROM txout
+    WHERE (substring(utxid, 1, 12), vout, height) IN (
+        SELECT utxid, vout, height FROM txout_genesis_height
+        WHERE address = unhex('%s') AND %s
+      ) AND
+       address = unhex('%s') AND %s
+
+    UNION ALL
+
+    SELECT utxid, substring(utxid, 1, 12) AS utxid12, vout, height, utxidx, satoshi, script_pk FROM txout
+    WHERE height >= 4294967295 AND address = unhex('%s') AND %s
+) AS o
+LEFT JOIN
+(
+    SELECT utxid12, vout, min(height) AS spent_height FROM
+    (
+        SELECT utxid AS utxid12, vout, height FROM txin_spent
+        WHERE (utxid, vout) IN (
+            SELECT utxid, vout FROM txout_genesis_height
+            WHERE address = unhex('%s') AND %s
+          )
+
+        UNION ALL
+
+        SELECT utxid AS utxid12, vout, height FROM txin_spent
+        WHERE (utxid, vout) IN (
+            SELECT substring(utxid, 1, 12), vout FROM txout
+            WHERE height >= 4294967295 AND address = unhex('%s') AND %s
+          )
+    )
+    GROUP BY utxid12, vout
+) AS s USING (utxid12, vout)
+`, addressHex, codehashMatch, addressHex, codehashMatch, addressHex, codehashMatch,
+		addressHex, codehashMatch, addressHex, codehashMatch)
+}
+
+// ScanClickhouseTxo 读取ClickhouseQuery的一行，没有花费记录时LEFT JOIN的spent_height为0
+func ScanClickhouseTxo(rows *sql.Rows) (interface{}, error) {
+	var ret Txo
+	err := rows.Scan(&ret.TxId, &ret.Vout, &ret.Height, &ret.TxIdx, &ret.Satoshi, &ret.ScriptPk, &ret.SpentHeight)
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
@@ -0,0 +1,122 @@
+package utxoset
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// fakeDriver 返回固定行的database/sql驱动，记录执行的查询
+type fakeDriver struct {
+	rows  [][]driver.Value
+	query string
+}
+
+func (d *fakeDriver) Connect(ctx context.Context) (driver.Conn, error) { return &fakeConn{d}, nil }
+func (d *fakeDriver) Driver() driver.Driver                            { return nil }
+
+type fakeConn struct{ d *fakeDriver }
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	c.d.query = query
+	return &fakeStmt{c.d}, nil
+}
+func (c *fakeConn) Close() error              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error) { return nil, errors.New("not supported") }
+
+type fakeStmt struct{ d *fakeDriver }
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return 0 }
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, errors.New("not supported")
+}
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return &fakeRows{rows: s.d.rows}, nil
+}
+
+type fakeRows struct {
+	rows [][]driver.Value
+	idx  int
+}
+
+func (r *fakeRows) Columns() []string {
+	return []string{"utxid", "vout", "height", "utxidx", "satoshi", "script_pk", "spent_height"}
+}
+func (r *fakeRows) Close() error { return nil }
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.idx >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.idx])
+	r.idx++
+	return nil
+}
+
+func TestClickhouseQuery(t *testing.T) {
+	addressHex := hex.EncodeToString(testAddress)
+	psql := ClickhouseQuery(nil, nil, testAddress)
+	if strings.Count(psql, "unhex('"+addressHex+"')") != 5 || strings.Count(psql, "codehash = '' AND genesis = ''") != 5 {
+		t.Fatalf("query %s", psql)
+	}
+	// 已确认与mempool分别查询，不用OR合并
+	if strings.Count(psql, "UNION ALL") != 2 || strings.Contains(psql, " OR ") {
+		t.Fatalf("query %s", psql)
+	}
+	psql = ClickhouseQuery([]byte{0xc0}, []byte{0x9e}, testAddress)
+	if strings.Count(psql, "codehash = unhex('c0') AND genesis = unhex('9e')") != 5 {
+		t.Fatalf("query %s", psql)
+	}
+}
+
+func TestScanClickhouseTxo(t *testing.T) {
+	row := func(n byte, height, spentHeight uint32, satoshi int64) []driver.Value {
+		return []driver.Value{testTxid(n), int64(n % 3), int64(height), int64(n), satoshi, testScript, int64(spentHeight)}
+	}
+	d := &fakeDriver{rows: [][]driver.Value{
+		row(1, 700000, 0, 1000),                    // 未花费，LEFT JOIN没有花费记录
+		row(2, 700000, 700001, 2000),               // 已确认花费
+		row(3, 700001, MempoolHeight, 3000),        // 被未确认交易花费
+		row(4, MempoolHeight, 0, 4000),             // 未确认新增
+		row(5, MempoolHeight, MempoolHeight, 5000), // 未确认新增后又被花费
+	}}
+	db := sql.OpenDB(d)
+	defer db.Close()
+
+	ctx := context.Background()
+	rows, err := db.QueryContext(ctx, ClickhouseQuery(nil, nil, testAddress))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var txos []*Txo
+	for rows.Next() {
+		txo, err := ScanClickhouseTxo(rows)
+		if err != nil {
+			t.Fatal(err)
+		}
+		txos = append(txos, txo.(*Txo))
+	}
+	if len(txos) != 5 || txos[2].SpentHeight != MempoolHeight || txos[3].Height != MempoolHeight ||
+		txos[0].TxIdx != 1 || txos[0].Vout != 1 || string(txos[0].ScriptPk) != string(testScript) {
+		t.Fatalf("txos %+v", txos)
+	}
+	if !strings.Contains(d.query, hex.EncodeToString(testAddress)) {
+		t.Fatalf("query %s", d.query)
+	}
+
+	mem := NewMem(txos)
+	total, totalConf, totalUnconf, totalUnconfSpend, _ := mem.Count(ctx)
+	if total != 2 || totalConf != 2 || totalUnconf != 1 || totalUnconfSpend != 1 {
+		t.Fatalf("count %d %d %d %d", total, totalConf, totalUnconf, totalUnconfSpend)
+	}
+	satoshi, pending, _ := mem.Balance(ctx)
+	if satoshi != 4000 || pending != 1000 {
+		t.Fatalf("balance %d %d", satoshi, pending)
+	}
+}
@@ -0,0 +1,185 @@
+package utxoset
+
+import (
+	"context"
+	"sensiblequery/lib/paging"
+	"sensiblequery/model"
+	"sort"
+
+	redis "github.com/go-redis/redis/v8"
+	scriptDecoder "github.com/sensible-contract/sensible-script-decoder"
+)
+
+// Txo 地址的一个输出及其花费高度，来自ClickHouse txout/txin_spent
+type Txo struct {
+	TxId        []byte
+	Vout        uint32
+	Height      uint32
+	TxIdx       uint64
+	Satoshi     uint64
+	ScriptPk    []byte
+	SpentHeight uint32 // 0为未花费，MempoolHeight为被未确认交易花费
+}
+
+// Mem 由地址的全部输出计算出的utxo集合，与Redis中的集合内容、顺序一致
+type Mem struct {
+	// 按(score, member)升序
+	unconfirmed      []redis.Z
+	confirmed        []redis.Z
+	spentUnconfirmed []redis.Z
+	spent            map[string]bool
+
+	txos             map[string]*model.TxoData
+	scores           map[string]float64
+	satoshi, pending int
+}
+
+func NewMem(txos []*Txo) *Mem {
+	m := &Mem{
+		spent:  make(map[string]bool),
+		txos:   make(map[string]*model.TxoData),
+		scores: make(map[string]float64),
+	}
+	for _, txo := range txos {
+		outpoint := Outpoint(txo.TxId, txo.Vout)
+		z := redis.Z{Score: Score(txo.Height, txo.TxIdx), Member: outpoint}
+		switch {
+		case txo.Height == MempoolHeight && txo.SpentHeight == 0:
+			m.unconfirmed = append(m.unconfirmed, z)
+			m.pending += int(txo.Satoshi)
+		case txo.Height == MempoolHeight:
+			// 未确认新增后又被未确认交易花费，不在集合中
+			continue
+		case txo.SpentHeight == 0:
+			m.confirmed = append(m.confirmed, z)
+			m.satoshi += int(txo.Satoshi)
+		case txo.SpentHeight == MempoolHeight:
+			m.confirmed = append(m.confirmed, z)
+			m.spentUnconfirmed = append(m.spentUnconfirmed, z)
+			m.spent[outpoint] = true
+			m.satoshi += int(txo.Satoshi)
+			m.pending -= int(txo.Satoshi)
+		default:
+			// 已确认花费
+			continue
+		}
+		m.scores[outpoint] = z.Score
+		m.txos[outpoint] = &model.TxoData{
+			UTxid: txo.TxId,
+			Vout:  txo.Vout,
+			// redis中高度的最高字节用作压缩标记，读出的mempool高度为0x00ffffff，保持一致
+			BlockHeight: txo.Height & 0x00ffffff,
+			TxIdx:       txo.TxIdx,
+			Satoshi:     txo.Satoshi,
+			ScriptType:  scriptDecoder.GetLockingScriptType(txo.ScriptPk),
+			PkScript:    txo.ScriptPk,
+		}
+	}
+	sortZ(m.unconfirmed)
+	sortZ(m.confirmed)
+	sortZ(m.spentUnconfirmed)
+	return m
+}
+
+func sortZ(zs []redis.Z) {
+	sort.Slice(zs, func(i, j int) bool { return zLess(zs[i], zs[j]) })
+}
+
+func zLess(a, b redis.Z) bool {
+	if a.Score != b.Score {
+		return a.Score < b.Score
+	}
+	return a.Member.(string) < b.Member.(string)
+}
+
+// zRevRange 同redis ZREVRANGE，start/stop非负
+func zRevRange(zs []redis.Z, start, stop int) (members []string) {
+	members = []string{}
+	for idx := start; idx <= stop && idx < len(zs); idx++ {
+		members = append(members, zs[len(zs)-1-idx].Member.(string))
+	}
+	return members
+}
+
+// rangeAfter 同paging.ZRangeAfter，跳过exclude中的member
+func rangeAfter(zs []redis.Z, exclude map[string]bool) paging.ZRangeFunc {
+	return func(pos *redis.Z, desc bool, size int) (result []redis.Z, err error) {
+		for idx := range zs {
+			z := zs[idx]
+			if desc {
+				z = zs[len(zs)-1-idx]
+			}
+			if pos != nil && (desc && !zLess(z, *pos) || !desc && !zLess(*pos, z)) {
+				continue
+			}
+			if exclude[z.Member.(string)] {
+				continue
+			}
+			if len(result) >= size {
+				break
+			}
+			result = append(result, z)
+		}
+		return result, nil
+	}
+}
+
+func (m *Mem) Count(ctx context.Context) (total, totalConf, totalUnconf, totalUnconfSpend int, err error) {
+	totalConf = len(m.confirmed)
+	totalUnconf = len(m.unconfirmed)
+	totalUnconfSpend = len(m.spentUnconfirmed)
+	total = totalConf + totalUnconf - totalUnconfSpend
+	return total, totalConf, totalUnconf, totalUnconfSpend, nil
+}
+
+func (m *Mem) Outpoints(ctx context.Context, page paging.Page) (
+	outpoints []string, next, prev string, total, totalConf, totalUnconf, totalUnconfSpend int, err error) {
+	total, totalConf, totalUnconf, totalUnconfSpend, _ = m.Count(ctx)
+
+	if page.Token != nil || page.Offset == 0 {
+		segments := []paging.ZSegment{
+			{Range: rangeAfter(m.unconfirmed, nil)},
+			{Range: rangeAfter(m.confirmed, m.spent)},
+		}
+		positions, err := paging.ZSegmentsPage(ctx, nil, segments, page)
+		if err != nil {
+			return nil, "", "", 0, 0, 0, 0, err
+		}
+		for _, pos := range positions {
+			outpoints = append(outpoints, pos.Member.(string))
+		}
+		next, prev = paging.ZPageLinks(page, positions)
+		return outpoints, next, prev, total, totalConf, totalUnconf, totalUnconfSpend, nil
+	}
+
+	// offset分页，与Redis.Outpoints的取法一致
+	cursor, size := page.Offset, page.Size
+	outpoints = zRevRange(m.unconfirmed, cursor, cursor+size-1)
+	if cursor+size <= totalUnconf || totalConf == totalUnconfSpend {
+		return outpoints, "", "", total, totalConf, totalUnconf, totalUnconfSpend, nil
+	}
+
+	var confirmedRange []redis.Z
+	for _, member := range zRevRange(m.confirmed, 0, cursor+size-totalUnconf+totalUnconfSpend) {
+		if !m.spent[member] {
+			confirmedRange = append(confirmedRange, redis.Z{Score: m.scores[member], Member: member})
+		}
+	}
+	sortZ(confirmedRange)
+	outpoints = append(outpoints, zRevRange(confirmedRange, cursor, cursor+size-totalUnconf-1)...)
+	return outpoints, "", "", total, totalConf, totalUnconf, totalUnconfSpend, nil
+}
+
+func (m *Mem) Txos(ctx context.Context, outpoints []string) (txos []*model.TxoData, err error) {
+	txos = make([]*model.TxoData, 0, len(outpoints))
+	for _, outpoint := range outpoints {
+		if txo, ok := m.txos[outpoint]; ok {
+			txos = append(txos, txo)
+		}
+	}
+	return txos, nil
+}
+
+func (m *Mem) Balance(ctx context.Context) (satoshi, pending int, err error) {
+	return m.satoshi, m.pending, nil
+}
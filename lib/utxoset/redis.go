@@ -0,0 +1,203 @@
+package utxoset
+
+import (
+	"context"
+	"encoding/hex"
+	"sensiblequery/lib/paging"
+	"sensiblequery/logger"
+	"sensiblequery/model"
+
+	redis "github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+// Redis 索引写入redis的地址utxo集合:
+//
+//	{<key><address>}          已确认utxo
+//	mp:{<key><address>}       未确认新增utxo
+//	mp:s:{<key><address>}     被未确认交易花费的已确认utxo
+//	u<outpoint>               utxo数据，在utxo实例中
+//
+// key: au普通utxo, fu为FT, nu为NFT
+type Redis struct {
+	Biz  redis.UniversalClient
+	Utxo redis.UniversalClient
+
+	addressPkh []byte
+
+	newUtxoKey                  string
+	addressUtxoConfirmed        string
+	addressUtxoSpentUnconfirmed string
+	addressUtxoConfirmedRange   string
+	tmpUtxoKey                  string
+}
+
+func NewRedis(biz, utxo redis.UniversalClient, codeHash, genesisId, addressPkh []byte, key string) *Redis {
+	addressKey := AddressKey(codeHash, genesisId, addressPkh)
+	return &Redis{
+		Biz:        biz,
+		Utxo:       utxo,
+		addressPkh: addressPkh,
+
+		newUtxoKey:                  "mp:{" + key + addressKey,
+		addressUtxoConfirmed:        "{" + key + addressKey,
+		addressUtxoSpentUnconfirmed: "mp:s:{" + key + addressKey,
+		addressUtxoConfirmedRange:   "mp:r:{" + key + addressKey,
+		tmpUtxoKey:                  "mp:t:{" + key + addressKey,
+	}
+}
+
+func (r *Redis) Count(ctx context.Context) (total, totalConf, totalUnconf, totalUnconfSpend int, err error) {
+	// unconfirmed count
+	newUtxoNum, err := r.Biz.ZCard(ctx, r.newUtxoKey).Result()
+	if err != nil {
+		logger.Ctx(ctx).Info("get newUtxoNum from redis failed", zap.Error(err))
+		return
+	}
+	logger.Ctx(ctx).Info("newUtxoNum", zap.Int64("n", newUtxoNum))
+	// confirmed count
+	addressUtxoConfirmedNum, err := r.Biz.ZCard(ctx, r.addressUtxoConfirmed).Result()
+	if err != nil {
+		logger.Ctx(ctx).Info("get addressUtxoConfirmedNum from redis failed", zap.Error(err))
+		return
+	}
+	logger.Ctx(ctx).Info("addressUtxoConfirmedNum", zap.Int64("n", addressUtxoConfirmedNum))
+	// confirmed spending count(spend still unconfirmed)
+	addressUtxoSpentUnconfirmedNum, err := r.Biz.ZCard(ctx, r.addressUtxoSpentUnconfirmed).Result()
+	if err != nil {
+		logger.Ctx(ctx).Info("get addressUtxoSpentUnconfirmedNum from redis failed", zap.Error(err))
+		return
+	}
+	logger.Ctx(ctx).Info("addressUtxoSpentUnconfirmedNum", zap.Int64("n", addressUtxoSpentUnconfirmedNum))
+
+	totalConf = int(addressUtxoConfirmedNum)
+	totalUnconf = int(newUtxoNum)
+	totalUnconfSpend = int(addressUtxoSpentUnconfirmedNum)
+	total = totalConf + totalUnconf - totalUnconfSpend
+
+	return total, totalConf, totalUnconf, totalUnconfSpend, nil
+}
+
+func (r *Redis) Outpoints(ctx context.Context, page paging.Page) (
+	outpoints []string, next, prev string, total, totalConf, totalUnconf, totalUnconfSpend int, err error) {
+	// 注意这里查询需要原子化，可使用pipeline
+	total, totalConf, totalUnconf, totalUnconfSpend, err = r.Count(ctx)
+	if err != nil {
+		logger.Ctx(ctx).Info("get utxo count from redis failed", zap.Error(err))
+		return
+	}
+
+	if page.Token != nil || page.Offset == 0 {
+		// 游标分页: 先mempool新增utxo，再已确认且未被mempool花费的utxo
+		segments := []paging.ZSegment{
+			{Key: r.newUtxoKey},
+			{Key: r.addressUtxoConfirmed, Filter: paging.ZExcludeMembers(ctx, r.Biz, r.addressUtxoSpentUnconfirmed)},
+		}
+		positions, err := paging.ZSegmentsPage(ctx, r.Biz, segments, page)
+		if err != nil {
+			logger.Ctx(ctx).Info("GetUtxoOutpointsByAddress redis failed", zap.Error(err))
+			return nil, "", "", 0, 0, 0, 0, err
+		}
+		for _, pos := range positions {
+			outpoints = append(outpoints, pos.Member.(string))
+		}
+		next, prev = paging.ZPageLinks(page, positions)
+		return outpoints, next, prev, total, totalConf, totalUnconf, totalUnconfSpend, nil
+	}
+
+	// offset分页
+	cursor, size := page.Offset, page.Size
+	newUtxoOutpoints, err := r.Biz.ZRevRange(ctx, r.newUtxoKey, int64(cursor), int64(cursor+size)-1).Result()
+	if err == redis.Nil {
+		newUtxoOutpoints = nil
+	} else if err != nil {
+		logger.Ctx(ctx).Info("GetUtxoOutpointsByAddress redis failed", zap.Error(err))
+		return
+	}
+	// 未超过未确认的utxo数量，或者已确认数量减去已花费数量为0，则直接返回
+	if cursor+size <= totalUnconf || totalConf == totalUnconfSpend {
+		return newUtxoOutpoints, "", "", total, totalConf, totalUnconf, totalUnconfSpend, nil
+	}
+
+	// 否则需要先提取
+	zargs := redis.ZRangeArgs{
+		Key:   r.addressUtxoConfirmed,
+		Start: 0,
+		Stop:  cursor + size - totalUnconf + totalUnconfSpend,
+		Rev:   true,
+	}
+	logger.Ctx(ctx).Info("ZRangeStore", zap.Any("zargs", zargs))
+	nRange, err := r.Biz.ZRangeStore(ctx, r.addressUtxoConfirmedRange, zargs).Result()
+	if err != nil {
+		logger.Ctx(ctx).Info("ZRangeStore redis failed", zap.Error(err))
+		return
+	}
+	logger.Ctx(ctx).Info("ZRangeStore", zap.Int64("result", nRange))
+
+	// 再去掉已花费的utxo
+	nDiff, err := r.Biz.ZDiffStore(ctx, r.tmpUtxoKey, r.addressUtxoConfirmedRange, r.addressUtxoSpentUnconfirmed).Result()
+	if err != nil {
+		logger.Ctx(ctx).Info("ZDiffStore redis failed", zap.Error(err))
+		return
+	}
+	logger.Ctx(ctx).Info("ZDiffStore", zap.Int64("n", nDiff))
+
+	// 再提取结果
+	utxoOutpoints, err := r.Biz.ZRevRange(ctx, r.tmpUtxoKey, int64(cursor), int64(cursor+size-totalUnconf)-1).Result()
+	if err == redis.Nil {
+		utxoOutpoints = nil
+	} else if err != nil {
+		logger.Ctx(ctx).Info("GetUtxoOutpointsByAddress redis failed", zap.Error(err))
+		return
+	}
+
+	for _, utxo := range utxoOutpoints {
+		newUtxoOutpoints = append(newUtxoOutpoints, utxo)
+	}
+
+	return newUtxoOutpoints, "", "", total, totalConf, totalUnconf, totalUnconfSpend, nil
+}
+
+func (r *Redis) Txos(ctx context.Context, outpoints []string) (txos []*model.TxoData, err error) {
+	txos = make([]*model.TxoData, 0, len(outpoints))
+	pipe := r.Utxo.Pipeline()
+
+	outpointsCmd := make([]*redis.StringCmd, 0, len(outpoints))
+	for _, outpoint := range outpoints {
+		outpointsCmd = append(outpointsCmd, pipe.Get(ctx, "u"+outpoint))
+	}
+	if _, err = pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	for outpointIdx, data := range outpointsCmd {
+		outpoint := outpoints[outpointIdx]
+		res, err := data.Result()
+		if err == redis.Nil {
+			logger.Ctx(ctx).Info("redis not found", zap.String("outpoint", hex.EncodeToString([]byte(outpoint))))
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		txos = append(txos, model.NewTxoData([]byte(outpoint), []byte(res)))
+	}
+	return txos, nil
+}
+
+func (r *Redis) Balance(ctx context.Context) (satoshi, pending int, err error) {
+	satoshi, err = r.Biz.Get(ctx, "bl"+string(r.addressPkh)).Int()
+	if err == redis.Nil {
+		satoshi = 0
+	} else if err != nil {
+		return 0, 0, err
+	}
+
+	// 待确认余额
+	pending, err = r.Biz.Get(ctx, "mp:bl"+string(r.addressPkh)).Int()
+	if err == redis.Nil {
+		pending = 0
+	} else if err != nil {
+		return 0, 0, err
+	}
+	return satoshi, pending, nil
+}
@@ -0,0 +1,47 @@
+package utxoset
+
+import (
+	"context"
+	"encoding/binary"
+	"sensiblequery/lib/paging"
+	"sensiblequery/model"
+)
+
+// MempoolHeight 未确认交易的高度
+const MempoolHeight = 4294967295
+
+// Source 地址utxo集合。Redis为主，Redis不可用时由ClickHouse数据计算
+type Source interface {
+	// Count utxo数量，total = totalConf + totalUnconf - totalUnconfSpend
+	Count(ctx context.Context) (total, totalConf, totalUnconf, totalUnconfSpend int, err error)
+	// Outpoints 按页返回utxo的outpoint(txid+vout)，先未确认新增，再已确认且未被未确认交易花费的
+	Outpoints(ctx context.Context, page paging.Page) (outpoints []string, next, prev string, total, totalConf, totalUnconf, totalUnconfSpend int, err error)
+	// Txos outpoint对应的utxo数据，不存在的跳过
+	Txos(ctx context.Context, outpoints []string) ([]*model.TxoData, error)
+	// Balance 已确认余额及待确认余额变化
+	Balance(ctx context.Context) (satoshi, pending int, err error)
+}
+
+// AddressKey 集合key中的地址部分，codeHash为空时为地址的普通utxo
+func AddressKey(codeHash, genesisId, addressPkh []byte) string {
+	if len(codeHash) == 0 {
+		return string(addressPkh) + "}"
+	}
+	return string(addressPkh) + "}" + string(codeHash) + string(genesisId)
+}
+
+// Outpoint txid+vout(4字节小端)
+func Outpoint(txid []byte, vout uint32) string {
+	buf := make([]byte, len(txid)+4)
+	copy(buf, txid)
+	binary.LittleEndian.PutUint32(buf[len(txid):], vout)
+	return string(buf)
+}
+
+// Score 集合中utxo的分数，与索引写入redis时一致：已确认为height*1e9+txidx，未确认为mempool内序号
+func Score(height uint32, txidx uint64) float64 {
+	if height == MempoolHeight {
+		return float64(txidx)
+	}
+	return float64(height)*1000000000 + float64(txidx)
+}
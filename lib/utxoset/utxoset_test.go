@@ -0,0 +1,260 @@
+package utxoset
+
+import (
+	"context"
+	"encoding/binary"
+	"reflect"
+	"sensiblequery/lib/paging"
+	"sensiblequery/model"
+	"strconv"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/alicebob/miniredis/v2/server"
+	redis "github.com/go-redis/redis/v8"
+)
+
+var (
+	testAddress = []byte("01234567890123456789")
+	testScript  = []byte{0x76, 0xa9, 0x14, 0x01, 0x02, 0x03, 0x88, 0xac}
+)
+
+func testTxid(n byte) []byte {
+	txid := make([]byte, 32)
+	txid[0], txid[31] = n, n
+	return txid
+}
+
+// fixtureTxos 地址的全部输出，覆盖各种花费状态，并有同一交易的多个输出(同分数)
+func fixtureTxos() (txos []*Txo) {
+	for n := byte(1); n <= 20; n++ {
+		txo := &Txo{
+			TxId:     testTxid(n),
+			Vout:     uint32(n % 3),
+			Height:   700000 + uint32(n/2),
+			TxIdx:    uint64(n % 4),
+			Satoshi:  uint64(n) * 1000,
+			ScriptPk: testScript,
+		}
+		switch n % 5 {
+		case 1:
+			txo.SpentHeight = 700100
+		case 2:
+			txo.SpentHeight = MempoolHeight
+		}
+		txos = append(txos, txo)
+	}
+	// 同一交易的多个输出
+	for vout := uint32(0); vout < 3; vout++ {
+		txos = append(txos, &Txo{TxId: testTxid(30), Vout: vout, Height: 700050, TxIdx: 7, Satoshi: 546, ScriptPk: testScript})
+	}
+	for n := byte(40); n < 47; n++ {
+		txo := &Txo{TxId: testTxid(n), Vout: 1, Height: MempoolHeight, TxIdx: uint64(n), Satoshi: 2000, ScriptPk: testScript}
+		if n == 43 {
+			txo.SpentHeight = MempoolHeight
+		}
+		txos = append(txos, txo)
+	}
+	return txos
+}
+
+// loadRedis 按索引写入redis的方式保存txos
+func loadRedis(t *testing.T, client redis.UniversalClient, txos []*Txo) {
+	ctx := context.Background()
+	addressKey := AddressKey(nil, nil, testAddress)
+	satoshi, pending := 0, 0
+	for _, txo := range txos {
+		outpoint := Outpoint(txo.TxId, txo.Vout)
+		z := &redis.Z{Score: Score(txo.Height, txo.TxIdx), Member: outpoint}
+		switch {
+		case txo.Height == MempoolHeight && txo.SpentHeight == 0:
+			client.ZAdd(ctx, "mp:{au"+addressKey, z)
+			pending += int(txo.Satoshi)
+		case txo.Height == MempoolHeight:
+			continue
+		case txo.SpentHeight == 0:
+			client.ZAdd(ctx, "{au"+addressKey, z)
+			satoshi += int(txo.Satoshi)
+		case txo.SpentHeight == MempoolHeight:
+			client.ZAdd(ctx, "{au"+addressKey, z)
+			client.ZAdd(ctx, "mp:s:{au"+addressKey, z)
+			satoshi += int(txo.Satoshi)
+			pending -= int(txo.Satoshi)
+		default:
+			continue
+		}
+
+		buf := make([]byte, 20+len(txo.ScriptPk))
+		binary.LittleEndian.PutUint32(buf, txo.Height)
+		binary.LittleEndian.PutUint64(buf[4:], txo.TxIdx)
+		binary.LittleEndian.PutUint64(buf[12:], txo.Satoshi)
+		copy(buf[20:], txo.ScriptPk)
+		// 最高字节为0时为未压缩格式
+		buf[3] = 0
+		if err := client.Set(ctx, "u"+outpoint, buf, 0).Err(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	client.Set(ctx, "bl"+string(testAddress), satoshi, 0)
+	client.Set(ctx, "mp:bl"+string(testAddress), pending, 0)
+}
+
+// registerZStore miniredis不支持ZRANGESTORE/ZDIFFSTORE，按offset分页用到的参数形式实现
+func registerZStore(s *miniredis.Miniredis) {
+	store := func(c *server.Peer, dst, src string, members []string) {
+		s.Del(dst)
+		for _, member := range members {
+			score, _ := s.ZScore(src, member)
+			s.ZAdd(dst, score, member)
+		}
+		c.WriteInt(len(members))
+	}
+	// ZRANGESTORE dst src start stop REV
+	s.Server().Register("ZRANGESTORE", func(c *server.Peer, cmd string, args []string) {
+		members, _ := s.ZMembers(args[1])
+		start, _ := strconv.Atoi(args[2])
+		stop, _ := strconv.Atoi(args[3])
+		var picked []string
+		for idx := start; idx <= stop && idx < len(members); idx++ {
+			picked = append(picked, members[len(members)-1-idx])
+		}
+		store(c, args[0], args[1], picked)
+	})
+	// ZDIFFSTORE dst 2 key1 key2
+	s.Server().Register("ZDIFFSTORE", func(c *server.Peer, cmd string, args []string) {
+		members, _ := s.ZMembers(args[2])
+		excluded, _ := s.ZMembers(args[3])
+		skip := make(map[string]bool)
+		for _, member := range excluded {
+			skip[member] = true
+		}
+		var picked []string
+		for _, member := range members {
+			if !skip[member] {
+				picked = append(picked, member)
+			}
+		}
+		store(c, args[0], args[2], picked)
+	})
+}
+
+func newSources(t *testing.T) (*Redis, *Mem) {
+	s := miniredis.RunT(t)
+	registerZStore(s)
+	client := redis.NewUniversalClient(&redis.UniversalOptions{Addrs: []string{s.Addr()}})
+	txos := fixtureTxos()
+	loadRedis(t, client, txos)
+	return NewRedis(client, client, nil, nil, testAddress, "au"), NewMem(txos)
+}
+
+type outpointsPage struct {
+	Outpoints                                  []string
+	Next, Prev                                 string
+	Total, TotalConf, TotalUnconf, UnconfSpend int
+}
+
+func getPage(t *testing.T, src Source, page paging.Page) (ret outpointsPage) {
+	var err error
+	ret.Outpoints, ret.Next, ret.Prev, ret.Total, ret.TotalConf, ret.TotalUnconf, ret.UnconfSpend, err = src.Outpoints(context.Background(), page)
+	if err != nil {
+		t.Fatalf("%T outpoints %+v: %v", src, page, err)
+	}
+	return ret
+}
+
+func TestCountAndBalance(t *testing.T) {
+	rds, mem := newSources(t)
+	ctx := context.Background()
+
+	var counts [2][4]int
+	for idx, src := range []Source{rds, mem} {
+		total, conf, unconf, spend, err := src.Count(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts[idx] = [4]int{total, conf, unconf, spend}
+	}
+	if counts[0] != counts[1] {
+		t.Fatalf("count redis %v, clickhouse %v", counts[0], counts[1])
+	}
+	if counts[1] != [4]int{23 - 4 + 6 - 4, 23 - 4, 6, 4} {
+		t.Fatalf("unexpected count %v", counts[1])
+	}
+
+	satoshi, pending, _ := rds.Balance(ctx)
+	memSatoshi, memPending, _ := mem.Balance(ctx)
+	if satoshi != memSatoshi || pending != memPending {
+		t.Fatalf("balance redis %d/%d, clickhouse %d/%d", satoshi, pending, memSatoshi, memPending)
+	}
+}
+
+func TestCursorPages(t *testing.T) {
+	rds, mem := newSources(t)
+
+	for _, size := range []int{1, 4, 7, 100} {
+		// 向后翻到底，再向前翻回
+		page := paging.Page{Size: size}
+		var all []string
+		for n := 0; ; n++ {
+			want, got := getPage(t, rds, page), getPage(t, mem, page)
+			if !reflect.DeepEqual(want, got) {
+				t.Fatalf("size %d page %d: redis %+v, clickhouse %+v", size, n, want, got)
+			}
+			all = append(all, got.Outpoints...)
+			if got.Next == "" {
+				if got.Prev != "" {
+					tok, _ := paging.Decode(got.Prev)
+					prevPage := paging.Page{Size: size, Token: tok}
+					if want, got := getPage(t, rds, prevPage), getPage(t, mem, prevPage); !reflect.DeepEqual(want, got) {
+						t.Fatalf("size %d prev page: redis %+v, clickhouse %+v", size, want, got)
+					}
+				}
+				break
+			}
+			tok, _ := paging.Decode(got.Next)
+			page = paging.Page{Size: size, Token: tok}
+		}
+		if len(all) != 23-4+6-4 {
+			t.Fatalf("size %d: got %d utxos", size, len(all))
+		}
+	}
+}
+
+func TestOffsetPages(t *testing.T) {
+	rds, mem := newSources(t)
+	for _, size := range []int{1, 3, 10} {
+		for offset := 1; offset < 25; offset++ {
+			page := paging.Page{Offset: offset, Size: size}
+			want, got := getPage(t, rds, page), getPage(t, mem, page)
+			if !reflect.DeepEqual(want, got) {
+				t.Fatalf("offset %d size %d: redis %+v, clickhouse %+v", offset, size, want, got)
+			}
+		}
+	}
+}
+
+func TestTxos(t *testing.T) {
+	rds, mem := newSources(t)
+	ctx := context.Background()
+
+	page := getPage(t, mem, paging.Page{Size: 100})
+	outpoints := append(page.Outpoints, Outpoint(testTxid(99), 0))
+	want, err := rds.Txos(ctx, outpoints)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := mem.Txos(ctx, outpoints)
+	if len(want) != len(page.Outpoints) || len(got) != len(want) {
+		t.Fatalf("txos redis %d, clickhouse %d", len(want), len(got))
+	}
+	for idx := range want {
+		w, g := want[idx], got[idx]
+		if !reflect.DeepEqual(txoFields(w), txoFields(g)) {
+			t.Fatalf("txo %d: redis %+v, clickhouse %+v", idx, w, g)
+		}
+	}
+}
+
+func txoFields(txo *model.TxoData) []interface{} {
+	return []interface{}{string(txo.UTxid), txo.Vout, txo.BlockHeight, txo.TxIdx, txo.Satoshi, string(txo.ScriptType), string(txo.PkScript)}
+}
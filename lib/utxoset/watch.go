@@ -0,0 +1,172 @@
+package utxoset
+
+import (
+	"context"
+	"sort"
+	"strconv"
+
+	redis "github.com/go-redis/redis/v8"
+)
+
+// 地址utxo集合的变化
+const (
+	ChangeMempool        = "mempool"         // 未确认交易新增utxo
+	ChangeMempoolSpent   = "mempool_spent"   // utxo被未确认交易花费
+	ChangeMempoolRemoved = "mempool_removed" // 未确认新增的utxo未经确认离开集合，被未确认交易花费或从mempool中移除
+	ChangeSpendRemoved   = "spend_removed"   // 花费utxo的未确认交易未经确认被移除
+	ChangeConfirmed      = "confirmed"       // utxo已确认
+	ChangeSpent          = "spent"           // utxo的花费已确认
+)
+
+var changeOrder = map[string]int{
+	ChangeConfirmed:      0,
+	ChangeSpent:          1,
+	ChangeMempool:        2,
+	ChangeMempoolSpent:   3,
+	ChangeMempoolRemoved: 4,
+	ChangeSpendRemoved:   5,
+}
+
+// Snapshot 地址utxo集合某一时刻的状态
+type Snapshot struct {
+	Height           int // 取快照时的索引高度
+	Unconfirmed      map[string]bool
+	SpentUnconfirmed map[string]bool
+	Confirmed        map[string]bool // 已确认utxo数量超过上限时为nil，只比较数量
+	ConfirmedCount   int64
+	Satoshi, Pending int
+}
+
+// Change 一个outpoint的变化
+type Change struct {
+	Type     string
+	Outpoint string
+}
+
+func memberSet(members []string) map[string]bool {
+	set := make(map[string]bool, len(members))
+	for _, member := range members {
+		set[member] = true
+	}
+	return set
+}
+
+func getInt(cmd *redis.StringCmd) (int, error) {
+	value, err := cmd.Result()
+	if err == redis.Nil {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(value)
+}
+
+// Snapshot 读取集合状态。已确认集合较大，只在数量、余额或索引高度变化时重新读取，
+// 超过maxConfirmed个时不读取成员
+func (r *Redis) Snapshot(ctx context.Context, prev *Snapshot, height int, maxConfirmed int64) (*Snapshot, error) {
+	pipe := r.Biz.Pipeline()
+	unconfCmd := pipe.ZRange(ctx, r.newUtxoKey, 0, -1)
+	spentCmd := pipe.ZRange(ctx, r.addressUtxoSpentUnconfirmed, 0, -1)
+	confCountCmd := pipe.ZCard(ctx, r.addressUtxoConfirmed)
+	balanceCmd := pipe.Get(ctx, "bl"+string(r.addressPkh))
+	pendingCmd := pipe.Get(ctx, "mp:bl"+string(r.addressPkh))
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	s := &Snapshot{
+		Height:           height,
+		Unconfirmed:      memberSet(unconfCmd.Val()),
+		SpentUnconfirmed: memberSet(spentCmd.Val()),
+		ConfirmedCount:   confCountCmd.Val(),
+	}
+	var err error
+	if s.Satoshi, err = getInt(balanceCmd); err != nil {
+		return nil, err
+	}
+	if s.Pending, err = getInt(pendingCmd); err != nil {
+		return nil, err
+	}
+
+	if s.ConfirmedCount > maxConfirmed {
+		return s, nil
+	}
+	if prev != nil && prev.Confirmed != nil && prev.ConfirmedCount == s.ConfirmedCount &&
+		prev.Satoshi == s.Satoshi && prev.Height == s.Height {
+		s.Confirmed = prev.Confirmed
+		return s, nil
+	}
+	members, err := r.Biz.ZRange(ctx, r.addressUtxoConfirmed, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	s.Confirmed = memberSet(members)
+	return s, nil
+}
+
+// Diff 两次快照之间的变化，按类型、outpoint排序。
+// 已确认集合未读取时，离开未确认集合的utxo在索引高度增加时视为已确认
+func Diff(prev, cur *Snapshot) (changes []*Change) {
+	seen := map[Change]bool{}
+	add := func(typ, outpoint string) {
+		change := Change{Type: typ, Outpoint: outpoint}
+		if !seen[change] {
+			seen[change] = true
+			changes = append(changes, &change)
+		}
+	}
+	confirmedKnown := prev.Confirmed != nil && cur.Confirmed != nil
+	newBlock := cur.Height > prev.Height
+
+	for outpoint := range cur.Unconfirmed {
+		if !prev.Unconfirmed[outpoint] {
+			add(ChangeMempool, outpoint)
+		}
+	}
+	for outpoint := range cur.SpentUnconfirmed {
+		if !prev.SpentUnconfirmed[outpoint] {
+			add(ChangeMempoolSpent, outpoint)
+		}
+	}
+	for outpoint := range prev.Unconfirmed {
+		if cur.Unconfirmed[outpoint] {
+			continue
+		}
+		if cur.Confirmed != nil && cur.Confirmed[outpoint] || cur.Confirmed == nil && newBlock {
+			add(ChangeConfirmed, outpoint)
+		} else {
+			add(ChangeMempoolRemoved, outpoint)
+		}
+	}
+	for outpoint := range prev.SpentUnconfirmed {
+		if cur.SpentUnconfirmed[outpoint] {
+			continue
+		}
+		if cur.Confirmed != nil && !cur.Confirmed[outpoint] || cur.Confirmed == nil && newBlock {
+			add(ChangeSpent, outpoint)
+		} else {
+			add(ChangeSpendRemoved, outpoint)
+		}
+	}
+	if confirmedKnown {
+		// 未经过mempool直接在区块中出现或花费
+		for outpoint := range cur.Confirmed {
+			if !prev.Confirmed[outpoint] {
+				add(ChangeConfirmed, outpoint)
+			}
+		}
+		for outpoint := range prev.Confirmed {
+			if !cur.Confirmed[outpoint] {
+				add(ChangeSpent, outpoint)
+			}
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Type != changes[j].Type {
+			return changeOrder[changes[i].Type] < changeOrder[changes[j].Type]
+		}
+		return changes[i].Outpoint < changes[j].Outpoint
+	})
+	return changes
+}
@@ -0,0 +1,65 @@
+package utxoset
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	redis "github.com/go-redis/redis/v8"
+)
+
+func TestSnapshotDiff(t *testing.T) {
+	ctx := context.Background()
+	s := miniredis.RunT(t)
+	client := redis.NewUniversalClient(&redis.UniversalOptions{Addrs: []string{s.Addr()}})
+	loadRedis(t, client, fixtureTxos())
+	rds := NewRedis(client, client, nil, nil, testAddress, "au")
+
+	addressKey := AddressKey(nil, nil, testAddress)
+	confirmedKey, mempoolKey, spentKey := "{au"+addressKey, "mp:{au"+addressKey, "mp:s:{au"+addressKey
+
+	for _, maxConfirmed := range []int64{1000, 1} {
+		s.FlushAll()
+		loadRedis(t, client, fixtureTxos())
+		prev, err := rds.Snapshot(ctx, nil, 700100, maxConfirmed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (prev.Confirmed == nil) != (maxConfirmed == 1) {
+			t.Fatalf("max %d: confirmed set %v", maxConfirmed, prev.Confirmed)
+		}
+
+		// 新的未确认utxo，及已确认utxo被未确认交易花费
+		newOutpoint := Outpoint(testTxid(50), 0)
+		spendOutpoint := Outpoint(testTxid(4), 1)
+		s.ZAdd(mempoolKey, 50, newOutpoint)
+		s.ZAdd(spentKey, Score(700002, 0), spendOutpoint)
+		cur, _ := rds.Snapshot(ctx, prev, 700100, maxConfirmed)
+		want := []*Change{{ChangeMempool, newOutpoint}, {ChangeMempoolSpent, spendOutpoint}}
+		if got := Diff(prev, cur); !reflect.DeepEqual(got, want) {
+			t.Fatalf("max %d: mempool changes %+v", maxConfirmed, got)
+		}
+
+		// 新区块确认了这两笔交易，另有一个未确认utxo被移除
+		prev = cur
+		removedOutpoint := Outpoint(testTxid(40), 1)
+		s.ZRem(mempoolKey, newOutpoint)
+		s.ZRem(mempoolKey, removedOutpoint)
+		s.ZAdd(confirmedKey, Score(700101, 3), newOutpoint)
+		s.ZRem(spentKey, spendOutpoint)
+		s.ZRem(confirmedKey, spendOutpoint)
+		cur, _ = rds.Snapshot(ctx, prev, 700101, maxConfirmed)
+		want = []*Change{{ChangeConfirmed, newOutpoint}, {ChangeSpent, spendOutpoint}, {ChangeMempoolRemoved, removedOutpoint}}
+		if maxConfirmed == 1 {
+			// 不读取已确认集合时，新区块后离开mempool的都视为已确认
+			want = []*Change{{ChangeConfirmed, removedOutpoint}, {ChangeConfirmed, newOutpoint}, {ChangeSpent, spendOutpoint}}
+		}
+		if got := Diff(prev, cur); !reflect.DeepEqual(got, want) {
+			t.Fatalf("max %d: block changes %+v", maxConfirmed, got)
+		}
+		if len(Diff(cur, cur)) != 0 {
+			t.Fatal("no change expected")
+		}
+	}
+}
@@ -0,0 +1,62 @@
+// Package webhook webhook投递的签名与重试间隔。
+//
+// 签名原文为: 时间戳 + "." + 请求body，签名为以webhook密钥做HMAC-SHA256后的十六进制编码，
+// 与midware.SignSha256相同。接收方应校验时间戳在有效期内，并以同样规则计算签名比较。
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	HeaderWebhookId = "X-Webhook-Id"        // webhook id
+	HeaderDelivery  = "X-Webhook-Delivery"  // 投递id，重试及重放时不变，可用于去重
+	HeaderTimestamp = "X-Webhook-Timestamp" // 签名时间戳，秒
+	HeaderSignature = "X-Webhook-Signature" // 签名
+)
+
+// Sign 对时间戳及body签名
+func Sign(secret string, ts int64, body []byte) string {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(strconv.FormatInt(ts, 10) + "."))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Verify 校验签名，供接收方参考
+func Verify(secret string, ts int64, body []byte, sign string) bool {
+	return hmac.Equal([]byte(Sign(secret, ts, body)), []byte(sign))
+}
+
+// SetHeaders 为投递请求设置签名头
+func SetHeaders(req *http.Request, webhookId, deliveryId, secret string, now time.Time, body []byte) {
+	ts := now.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderWebhookId, webhookId)
+	req.Header.Set(HeaderDelivery, deliveryId)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(ts, 10))
+	req.Header.Set(HeaderSignature, Sign(secret, ts, body))
+}
+
+// Backoff 第attempt次失败后的重试间隔，从base开始每次翻倍，不超过max
+func Backoff(attempt int, base, max time.Duration) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	d := base
+	for i := 1; i < attempt; i++ {
+		d *= 2
+		if d >= max || d <= 0 {
+			return max
+		}
+	}
+	if d > max {
+		return max
+	}
+	return d
+}
@@ -0,0 +1,48 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"type":"swap"}`)
+	h := hmac.New(sha256.New, []byte("secret"))
+	h.Write([]byte("1661648098." + string(body)))
+	want := hex.EncodeToString(h.Sum(nil))
+
+	if got := Sign("secret", 1661648098, body); got != want {
+		t.Fatalf("sign mismatch: %s", got)
+	}
+	if !Verify("secret", 1661648098, body, want) || Verify("secret", 1661648099, body, want) {
+		t.Fatal("verify failed")
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, "http://localhost/hook", bytes.NewReader(body))
+	SetHeaders(req, "wh1", "d1", "secret", time.Unix(1661648098, 0), body)
+	if req.Header.Get(HeaderSignature) != want || req.Header.Get(HeaderTimestamp) != "1661648098" {
+		t.Fatalf("headers %v", req.Header)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	base, max := 10*time.Second, time.Hour
+	for attempt, want := range map[int]time.Duration{
+		0:  10 * time.Second,
+		1:  10 * time.Second,
+		2:  20 * time.Second,
+		5:  160 * time.Second,
+		9:  2560 * time.Second,
+		10: time.Hour,
+		80: time.Hour,
+	} {
+		if got := Backoff(attempt, base, max); got != want {
+			t.Fatalf("attempt %d: got %v want %v", attempt, got, want)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+// Package worker 跟踪请求返回后仍在执行的后台任务，退出时等待完成并取回未完成的任务
+package worker
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// Group 后台任务组。每个任务带有描述自身的job，用于退出时保存未完成的任务
+type Group struct {
+	mu      sync.Mutex
+	seq     uint64
+	running map[uint64]interface{}
+	closed  bool
+	wg      sync.WaitGroup
+}
+
+func NewGroup() *Group {
+	return &Group{running: make(map[uint64]interface{})}
+}
+
+// Go 在后台执行fn。Close之后不再执行，返回false，调用方需自行保存job
+func (g *Group) Go(ctx context.Context, job interface{}, fn func(ctx context.Context)) bool {
+	g.mu.Lock()
+	if g.closed {
+		g.mu.Unlock()
+		return false
+	}
+	g.seq++
+	id := g.seq
+	g.running[id] = job
+	g.wg.Add(1)
+	g.mu.Unlock()
+
+	go func() {
+		defer func() {
+			g.mu.Lock()
+			delete(g.running, id)
+			g.mu.Unlock()
+			g.wg.Done()
+		}()
+		fn(ctx)
+	}()
+	return true
+}
+
+// Running 正在执行的任务数
+func (g *Group) Running() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.running)
+}
+
+// Close 不再接受新任务，等待已有任务完成。
+// ctx结束时按提交顺序返回仍未完成的任务，这些任务不再被跟踪
+func (g *Group) Close(ctx context.Context) (unfinished []interface{}) {
+	g.mu.Lock()
+	g.closed = true
+	g.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	ids := make([]uint64, 0, len(g.running))
+	for id := range g.running {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		unfinished = append(unfinished, g.running[id])
+		delete(g.running, id)
+	}
+	return unfinished
+}
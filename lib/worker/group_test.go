@@ -0,0 +1,59 @@
+package worker
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGroupClose(t *testing.T) {
+	g := NewGroup()
+	release := make(chan struct{})
+	done := make(chan string, 3)
+	for _, job := range []string{"a", "b", "c"} {
+		job := job
+		g.Go(context.Background(), job, func(ctx context.Context) {
+			if job != "a" {
+				<-release
+			}
+			done <- job
+		})
+	}
+	if <-done != "a" {
+		t.Fatal("job a should finish first")
+	}
+	if n := g.Running(); n != 2 {
+		t.Fatalf("running %d, want 2", n)
+	}
+
+	// 超时返回未完成的任务
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	unfinished := g.Close(ctx)
+	if !reflect.DeepEqual(unfinished, []interface{}{"b", "c"}) {
+		t.Fatalf("unfinished %v", unfinished)
+	}
+
+	if g.Go(context.Background(), "d", func(ctx context.Context) {}) {
+		t.Fatal("closed group should reject jobs")
+	}
+	close(release)
+}
+
+func TestGroupDrain(t *testing.T) {
+	g := NewGroup()
+	for idx := 0; idx < 10; idx++ {
+		g.Go(context.Background(), idx, func(ctx context.Context) {
+			time.Sleep(5 * time.Millisecond)
+		})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if unfinished := g.Close(ctx); len(unfinished) != 0 {
+		t.Fatalf("unfinished %v", unfinished)
+	}
+	if g.Running() != 0 {
+		t.Fatal("all jobs should be done")
+	}
+}
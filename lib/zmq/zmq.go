@@ -0,0 +1,431 @@
+// Package zmq 订阅bitcoind ZMQ通知所需的最小ZMTP 3.0实现：NULL认证的SUB客户端，
+// 以及按bitcoind格式发布消息的PUB端，用于测试时代替节点。
+//
+// 没有使用github.com/go-zeromq/zmq4：支持Go 1.19的最后版本v0.15.0按对端声明的长度分配帧(最大到MaxInt64)，
+// 无法限制单帧大小，之后的版本需要Go 1.20以上；libzmq的绑定需要cgo。
+// 这里只需要SUB一种socket及NULL认证，自行实现可以在分配前检查帧大小，见Dial的maxFrameSize
+package zmq
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// bitcoind发布的主题
+const (
+	TopicHashBlock = "hashblock"
+	TopicHashTx    = "hashtx"
+	TopicRawBlock  = "rawblock"
+	TopicRawTx     = "rawtx"
+)
+
+const (
+	greetingSize = 64
+
+	flagMore    = 0x01
+	flagLong    = 0x02
+	flagCommand = 0x04
+
+	// DefaultMaxFrameSize Dial未指定时单个帧的最大字节数，覆盖节点默认策略下最大的rawtx(10MB)
+	DefaultMaxFrameSize = 32 * 1024 * 1024
+	// 握手及订阅帧的最大字节数
+	maxCommandSize = 64 * 1024
+)
+
+var (
+	ErrProtocol = errors.New("zmq protocol error")
+	ErrClosed   = errors.New("zmq closed")
+)
+
+// Message bitcoind的通知：主题、内容及该主题的消息序号
+type Message struct {
+	Topic string
+	Body  []byte
+	Seq   uint32
+}
+
+// address 去掉tcp://前缀
+func address(addr string) string {
+	return strings.TrimPrefix(addr, "tcp://")
+}
+
+func greeting(asServer bool) []byte {
+	g := make([]byte, greetingSize)
+	g[0] = 0xff
+	g[9] = 0x7f
+	g[10] = 3 // 3.0，订阅以消息而非SUBSCRIBE命令发送
+	copy(g[12:32], "NULL")
+	if asServer {
+		g[32] = 1
+	}
+	return g
+}
+
+func readGreeting(r io.Reader) error {
+	g := make([]byte, greetingSize)
+	if _, err := io.ReadFull(r, g); err != nil {
+		return err
+	}
+	if g[0] != 0xff || g[9]&0x01 != 0x01 || g[10] < 3 {
+		return fmt.Errorf("%w: bad greeting", ErrProtocol)
+	}
+	if mechanism := strings.TrimRight(string(g[12:32]), "\x00"); mechanism != "NULL" {
+		return fmt.Errorf("%w: mechanism %s not supported", ErrProtocol, mechanism)
+	}
+	return nil
+}
+
+func writeFrame(w io.Writer, flags byte, body []byte) error {
+	var head []byte
+	if len(body) > 255 {
+		head = make([]byte, 9)
+		head[0] = flags | flagLong
+		binary.BigEndian.PutUint64(head[1:], uint64(len(body)))
+	} else {
+		head = []byte{flags, byte(len(body))}
+	}
+	if _, err := w.Write(head); err != nil {
+		return err
+	}
+	_, err := w.Write(body)
+	return err
+}
+
+// readFrame 读取一帧，长度超过maxSize时不分配内存直接返回错误
+func readFrame(r *bufio.Reader, maxSize uint64) (flags byte, body []byte, err error) {
+	if flags, err = r.ReadByte(); err != nil {
+		return 0, nil, err
+	}
+	var size uint64
+	if flags&flagLong != 0 {
+		head := make([]byte, 8)
+		if _, err = io.ReadFull(r, head); err != nil {
+			return 0, nil, err
+		}
+		size = binary.BigEndian.Uint64(head)
+	} else {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		size = uint64(b)
+	}
+	if size > maxSize {
+		return 0, nil, fmt.Errorf("%w: frame size %d exceeds %d", ErrProtocol, size, maxSize)
+	}
+	body = make([]byte, size)
+	if _, err = io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return flags, body, nil
+}
+
+// command 命令帧的名称及数据
+func command(body []byte) (name string, data []byte, err error) {
+	if len(body) < 1 || len(body) < 1+int(body[0]) {
+		return "", nil, fmt.Errorf("%w: bad command", ErrProtocol)
+	}
+	return string(body[1 : 1+body[0]]), body[1+body[0]:], nil
+}
+
+func readyCommand(socketType string) []byte {
+	body := []byte{5}
+	body = append(body, "READY"...)
+	body = append(body, byte(len("Socket-Type")))
+	body = append(body, "Socket-Type"...)
+	size := make([]byte, 4)
+	binary.BigEndian.PutUint32(size, uint32(len(socketType)))
+	body = append(body, size...)
+	return append(body, socketType...)
+}
+
+// readyProperty READY命令中的属性
+func readyProperty(data []byte, property string) string {
+	for len(data) > 0 {
+		n := int(data[0])
+		if len(data) < 1+n+4 {
+			return ""
+		}
+		name := string(data[1 : 1+n])
+		data = data[1+n:]
+		size := int(binary.BigEndian.Uint32(data[:4]))
+		if len(data) < 4+size {
+			return ""
+		}
+		if strings.EqualFold(name, property) {
+			return string(data[4 : 4+size])
+		}
+		data = data[4+size:]
+	}
+	return ""
+}
+
+// handshake 交换greeting及READY，检查对端的socket类型
+func handshake(conn net.Conn, r *bufio.Reader, asServer bool, socketType, peerType string) error {
+	if _, err := conn.Write(greeting(asServer)); err != nil {
+		return err
+	}
+	if err := readGreeting(r); err != nil {
+		return err
+	}
+	if err := writeFrame(conn, flagCommand, readyCommand(socketType)); err != nil {
+		return err
+	}
+	flags, body, err := readFrame(r, maxCommandSize)
+	if err != nil {
+		return err
+	}
+	if flags&flagCommand == 0 {
+		return fmt.Errorf("%w: expect READY", ErrProtocol)
+	}
+	name, data, err := command(body)
+	if err != nil {
+		return err
+	}
+	if name == "ERROR" {
+		return fmt.Errorf("%w: peer error %q", ErrProtocol, data)
+	}
+	if name != "READY" {
+		return fmt.Errorf("%w: expect READY, got %s", ErrProtocol, name)
+	}
+	if t := readyProperty(data, "Socket-Type"); t != peerType {
+		return fmt.Errorf("%w: peer socket type %q", ErrProtocol, t)
+	}
+	return nil
+}
+
+// Sub 一个到bitcoind ZMQ地址的订阅连接，非并发安全
+type Sub struct {
+	conn     net.Conn
+	r        *bufio.Reader
+	maxFrame uint64
+}
+
+// Dial 连接addr(tcp://host:port)并订阅topics，ctx只用于连接及握手。
+// maxFrameSize为单个帧的最大字节数，0使用DefaultMaxFrameSize，收到更大的帧时Recv返回错误
+func Dial(ctx context.Context, addr string, maxFrameSize int, topics ...string) (*Sub, error) {
+	if maxFrameSize <= 0 {
+		maxFrameSize = DefaultMaxFrameSize
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", address(addr))
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	s := &Sub{conn: conn, r: bufio.NewReader(conn), maxFrame: uint64(maxFrameSize)}
+	if err := s.subscribe(topics); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return s, nil
+}
+
+func (s *Sub) subscribe(topics []string) error {
+	if err := handshake(s.conn, s.r, false, "SUB", "PUB"); err != nil {
+		return err
+	}
+	for _, topic := range topics {
+		if err := writeFrame(s.conn, 0, append([]byte{1}, topic...)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Recv 读取下一条消息，阻塞直到收到消息或连接关闭
+func (s *Sub) Recv() (*Message, error) {
+	var parts [][]byte
+	for {
+		flags, body, err := readFrame(s.r, s.maxFrame)
+		if err != nil {
+			return nil, err
+		}
+		if flags&flagCommand != 0 {
+			name, data, err := command(body)
+			if err != nil {
+				return nil, err
+			}
+			if name == "ERROR" {
+				return nil, fmt.Errorf("%w: peer error %q", ErrProtocol, data)
+			}
+			// 忽略PING等其他命令
+			continue
+		}
+		parts = append(parts, body)
+		if flags&flagMore == 0 {
+			break
+		}
+	}
+	msg := &Message{Topic: string(parts[0])}
+	if len(parts) > 1 {
+		msg.Body = parts[1]
+	}
+	if len(parts) > 2 && len(parts[2]) == 4 {
+		msg.Seq = binary.LittleEndian.Uint32(parts[2])
+	}
+	return msg, nil
+}
+
+// Close 关闭连接，阻塞中的Recv返回错误
+func (s *Sub) Close() error {
+	return s.conn.Close()
+}
+
+// Publisher 按bitcoind格式发布消息的PUB端，订阅按主题前缀匹配
+type Publisher struct {
+	ln net.Listener
+
+	mu     sync.Mutex
+	peers  map[*pubPeer]bool
+	seq    map[string]uint32
+	closed bool
+}
+
+type pubPeer struct {
+	conn   net.Conn
+	topics map[string]bool
+}
+
+// Listen 在addr(tcp://host:port)上监听，端口为0时由系统分配，见Addr
+func Listen(addr string) (*Publisher, error) {
+	ln, err := net.Listen("tcp", address(addr))
+	if err != nil {
+		return nil, err
+	}
+	p := &Publisher{ln: ln, peers: map[*pubPeer]bool{}, seq: map[string]uint32{}}
+	go p.accept()
+	return p, nil
+}
+
+// Addr 实际监听的地址，tcp://host:port
+func (p *Publisher) Addr() string {
+	return "tcp://" + p.ln.Addr().String()
+}
+
+func (p *Publisher) accept() {
+	for {
+		conn, err := p.ln.Accept()
+		if err != nil {
+			return
+		}
+		go p.serve(conn)
+	}
+}
+
+func (p *Publisher) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	if err := handshake(conn, r, true, "PUB", "SUB"); err != nil {
+		return
+	}
+	peer := &pubPeer{conn: conn, topics: map[string]bool{}}
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.peers[peer] = true
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		delete(p.peers, peer)
+		p.mu.Unlock()
+	}()
+
+	for {
+		flags, body, err := readFrame(r, maxCommandSize)
+		if err != nil {
+			return
+		}
+		var topic string
+		var subscribe bool
+		switch {
+		case flags&flagCommand != 0:
+			// 3.1的SUBSCRIBE/CANCEL命令
+			name, data, err := command(body)
+			if err != nil || (name != "SUBSCRIBE" && name != "CANCEL") {
+				continue
+			}
+			topic, subscribe = string(data), name == "SUBSCRIBE"
+		case len(body) > 0 && (body[0] == 0 || body[0] == 1):
+			topic, subscribe = string(body[1:]), body[0] == 1
+		default:
+			continue
+		}
+		p.mu.Lock()
+		if subscribe {
+			peer.topics[topic] = true
+		} else {
+			delete(peer.topics, topic)
+		}
+		p.mu.Unlock()
+	}
+}
+
+func (peer *pubPeer) match(topic string) bool {
+	for prefix := range peer.topics {
+		if strings.HasPrefix(topic, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Subscribers 订阅了topic的连接数
+func (p *Publisher) Subscribers(topic string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n := 0
+	for peer := range p.peers {
+		if peer.match(topic) {
+			n++
+		}
+	}
+	return n
+}
+
+// Publish 向订阅了topic的连接发送[topic, body, seq]，seq按主题从0递增
+func (p *Publisher) Publish(topic string, body []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return ErrClosed
+	}
+	seq := make([]byte, 4)
+	binary.LittleEndian.PutUint32(seq, p.seq[topic])
+	p.seq[topic]++
+	for peer := range p.peers {
+		if !peer.match(topic) {
+			continue
+		}
+		// 写失败时由serve的读取错误移除连接
+		if writeFrame(peer.conn, flagMore, []byte(topic)) == nil &&
+			writeFrame(peer.conn, flagMore, body) == nil {
+			writeFrame(peer.conn, 0, seq)
+		}
+	}
+	return nil
+}
+
+// Close 停止监听并断开所有连接
+func (p *Publisher) Close() error {
+	p.mu.Lock()
+	p.closed = true
+	for peer := range p.peers {
+		peer.conn.Close()
+	}
+	p.mu.Unlock()
+	return p.ln.Close()
+}
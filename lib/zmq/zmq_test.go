@@ -0,0 +1,125 @@
+package zmq
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func waitSubscribers(t *testing.T, p *Publisher, topic string, n int) {
+	deadline := time.Now().Add(2 * time.Second)
+	for p.Subscribers(topic) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s subscribers %d, want %d", topic, p.Subscribers(topic), n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestPubSub(t *testing.T) {
+	p, err := Listen("tcp://127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	s, err := Dial(ctx, p.Addr(), 0, TopicHashBlock, TopicRawTx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	waitSubscribers(t, p, TopicHashBlock, 1)
+	waitSubscribers(t, p, TopicRawTx, 1)
+
+	hash := bytes.Repeat([]byte{0xab}, 32)
+	rawtx := bytes.Repeat([]byte{0x01}, 300) // 长帧
+	p.Publish(TopicHashTx, hash)             // 未订阅
+	p.Publish(TopicHashBlock, hash)
+	p.Publish(TopicRawTx, rawtx)
+	p.Publish(TopicHashBlock, hash)
+
+	for _, want := range []Message{
+		{TopicHashBlock, hash, 0},
+		{TopicRawTx, rawtx, 0},
+		{TopicHashBlock, hash, 1},
+	} {
+		msg, err := s.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.Topic != want.Topic || !bytes.Equal(msg.Body, want.Body) || msg.Seq != want.Seq {
+			t.Fatalf("got %s %d, want %s %d", msg.Topic, msg.Seq, want.Topic, want.Seq)
+		}
+	}
+
+	p.Close()
+	if _, err := s.Recv(); err == nil {
+		t.Fatal("recv after publisher closed")
+	}
+}
+
+func TestRecvFrameTooLarge(t *testing.T) {
+	p, err := Listen("tcp://127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	s, err := Dial(ctx, p.Addr(), 256, TopicRawTx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	waitSubscribers(t, p, TopicRawTx, 1)
+
+	p.Publish(TopicRawTx, bytes.Repeat([]byte{0x01}, 256))
+	if msg, err := s.Recv(); err != nil || len(msg.Body) != 256 {
+		t.Fatalf("recv %v", err)
+	}
+	p.Publish(TopicRawTx, bytes.Repeat([]byte{0x01}, 257))
+	if _, err := s.Recv(); !errors.Is(err, ErrProtocol) {
+		t.Fatalf("recv %v, want ErrProtocol", err)
+	}
+}
+
+func TestHandshakeChecksSocketType(t *testing.T) {
+	p, err := Listen("tcp://127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	// 以PUB身份连接PUB端，本端要求对端为SUB时握手失败
+	conn, err := net.Dial("tcp", address(p.Addr()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+	if err := handshake(conn, bufio.NewReader(conn), false, "PUB", "SUB"); err == nil {
+		t.Fatal("handshake with PUB should fail")
+	}
+
+	// 对端不接受PUB，握手后关闭连接
+	conn2, err := net.Dial("tcp", address(p.Addr()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn2.Close()
+	conn2.SetDeadline(time.Now().Add(2 * time.Second))
+	r := bufio.NewReader(conn2)
+	if err := handshake(conn2, r, false, "PUB", "PUB"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.ReadByte(); err == nil {
+		t.Fatal("publisher should close connection from PUB")
+	}
+}
@@ -1,12 +1,17 @@
 package logger
 
 import (
+	"context"
+
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
 
 var (
 	Log *zap.Logger
+	// Level 日志级别，可在运行时修改
+	Level = zap.NewAtomicLevelAt(zapcore.DebugLevel)
 )
 
 func init() {
@@ -15,7 +20,7 @@ func init() {
 
 	Log, _ = zap.Config{
 		Encoding:          "json",
-		Level:             zap.NewAtomicLevelAt(zapcore.DebugLevel),
+		Level:             Level,
 		EncoderConfig:     enc,
 		DisableCaller:     true,
 		DisableStacktrace: true,
@@ -23,6 +28,18 @@ func init() {
 	}.Build()
 }
 
+// Ctx 带trace_id、span_id字段的logger，ctx中没有有效trace时返回Log
+func Ctx(ctx context.Context) *zap.Logger {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return Log
+	}
+	return Log.With(
+		zap.String("trace_id", sc.TraceID().String()),
+		zap.String("span_id", sc.SpanID().String()),
+	)
+}
+
 func SyncLog() {
 	Log.Sync()
 }
@@ -3,20 +3,24 @@ package main
 import (
 	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"runtime"
 	"runtime/debug"
 	"sensiblequery/controller"
+	"sensiblequery/dao/clickhouse"
 	"sensiblequery/dao/rdb"
 	_ "sensiblequery/docs"
 	"sensiblequery/lib/midware"
+	"sensiblequery/lib/settings"
+	"sensiblequery/lib/tracing"
 	"sensiblequery/logger"
+	"sensiblequery/service"
 	"syscall"
 	"time"
 
-	cache "github.com/chenyahui/gin-cache"
 	"github.com/chenyahui/gin-cache/persist"
 
 	"github.com/gin-contrib/gzip"
@@ -32,8 +36,29 @@ var (
 	listen_address     = os.Getenv("LISTEN")
 	basePath           = os.Getenv("BASE_PATH")
 	disableVerifyToken = os.Getenv("DISABLE_VERIFY_TOKEN")
+	adminToken         = os.Getenv("ADMIN_TOKEN")
+	// 内部管理端口，提供/metrics，如127.0.0.1:9100
+	adminListenAddress = os.Getenv("ADMIN_LISTEN")
+	// Electrum协议TCP端口，如0.0.0.0:50001，需在conf/electrum.yaml中启用
+	electrumListenAddress = os.Getenv("ELECTRUM_LISTEN")
+	// 退出时等待进行中请求及后台广播完成的时长，默认30s
+	shutdownTimeout = envDuration("SHUTDOWN_TIMEOUT", 30*time.Second)
+	// 就绪检查失败后，等待负载均衡摘除实例再停止接收连接，默认0
+	shutdownDelay = envDuration("SHUTDOWN_DELAY", 0)
 )
 
+func envDuration(key string, def time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		panic(fmt.Errorf("invalid %s: %s", key, err))
+	}
+	return d
+}
+
 func KeepJsonContentType() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Writer.Header().Set("Content-Type", "application/json; charset=utf-8")
@@ -63,11 +88,17 @@ func SetSwagTitle(title string) func(*ginSwagger.Config) {
 // @name Authorization
 func main() {
 	router := gin.New()
-	router.Use(ginzap.Ginzap(logger.Log, time.RFC3339, true))
+	// gin.Context作为context.Context时可取到请求中的trace
+	router.ContextWithFallback = true
+	router.Use(midware.Tracing())
+	router.Use(midware.AccessLog(logger.Log, time.RFC3339, true))
 	router.Use(ginzap.RecoveryWithZap(logger.Log, true))
 	router.Use(midware.Metrics())
+	router.Use(midware.IndexHeader(service.IndexHeight, service.IndexDegraded))
+	router.Use(midware.QueryRoute())
 
-	router.Use(gzip.Gzip(gzip.DefaultCompression, gzip.WithDecompressFn(gzip.DefaultDecompressHandle)))
+	router.Use(gzip.Gzip(gzip.DefaultCompression, gzip.WithDecompressFn(gzip.DefaultDecompressHandle),
+		gzip.WithExcludedPaths([]string{"/ws", "/sse", "/electrum"})))
 
 	// go get -u github.com/swaggo/swag/cmd/swag@v1.6.7
 
@@ -78,13 +109,67 @@ func main() {
 		ginSwagger.URL(basePath+"/swagger/doc.json"),
 		SetSwagTitle("Sensible")))
 
-	midware.CreateMetricsEndpoint(router)
-
 	router.GET("/", controller.Satotx)
 
-	mainAPI := router.Group("/", midware.VerifyToken())
+	// 健康检查，不需要鉴权
+	router.GET("/health/live", controller.HealthLive)
+	router.GET("/health/ready", controller.HealthReady)
+	router.GET("/health/status", controller.HealthStatus)
+
+	// 每次请求消耗的配额单位，默认为1
+	midware.SetRouteCost("/pushtx", 5)
+	midware.SetRouteCost("/pushtxs", 10)
+	midware.SetRouteCost("/local_pushtx", 5)
+	midware.SetRouteCost("/local_pushtxs", 10)
+	midware.SetRouteCost("/address/:address/history/tx", 3)
+	midware.SetRouteCost("/contract/history/:codehash/:genesis/:address", 3)
+	midware.SetRouteCost("/contract/history/:codehash/:genesis", 5)
+	midware.SetRouteCost("/ft/history/:codehash/:genesis/:address", 3)
+	midware.SetRouteCost("/ft/income-history/:codehash/:genesis/:address", 3)
+	midware.SetRouteCost("/nft/history/:codehash/:genesis/:address", 3)
+	midware.SetRouteCost("/ws", 5)
+	midware.SetRouteCost("/sse", 5)
+	midware.SetRouteCost("/ws/blocks", 5)
+	midware.SetRouteCost("/sse/blocks", 5)
+	midware.SetRouteCost("/electrum", 5)
+	midware.SetRouteCost("/woc/v1/bsv/:network/tx/raw", 5)
+	midware.SetRouteCost("/woc/v1/bsv/:network/txs", 5)
+	midware.SetRouteCost("/woc/v1/bsv/:network/block/hash/:hash/page/:page", 5)
+	midware.SetRouteCost("/woc/v1/bsv/:network/address/:address/history", 3)
+	midware.SetRouteCost("/rest/block/:hash", 10)
+	midware.SetRouteCost("/rest/block/notxdetails/:hash", 5)
+	midware.SetRouteCost("/rest/headers/:count/:hash", 3)
+	midware.SetRouteCost("/rest/getutxos/*outpoints", 3)
+
+	// 路由需要的scope，默认为read
+	midware.SetRouteScope("/pushtx", midware.ScopePush)
+	midware.SetRouteScope("/pushtxs", midware.ScopePush)
+	midware.SetRouteScope("/local_pushtx", midware.ScopePush)
+	midware.SetRouteScope("/local_pushtxs", midware.ScopePush)
+	midware.SetRouteScope("/woc/v1/bsv/:network/tx/raw", midware.ScopePush)
+	midware.SetRouteScope("/relay/:txid", midware.ScopePush)
+	// /rpc的testmempoolaccept及/electrum的广播在处理时另外检查push
+
+	// 随最高区块变化的缓存接口，索引到新区块后不再使用之前的缓存
+	midware.SetRouteCacheByTip("/address/:address/utxo")
+	midware.SetRouteCacheByTip("/address/:address/utxo-data")
+	midware.SetRouteCacheByTip("/nft/utxo-list/:codehash/:genesis")
+	midware.SetRouteCacheByTip("/ft/owners/:codehash/:genesis")
+	midware.SetRouteCacheByTip("/ft/summary/:address")
+	midware.SetRouteCacheByTip("/ft/summary-data/:address")
+	midware.SetRouteCacheByTip("/nft/owners/:codehash/:genesis")
+	midware.SetRouteCacheByTip("/nft/summary/:address")
+	midware.SetRouteCacheByTip("/ft/history/:codehash/:genesis/:address")
+	midware.SetRouteCacheByTip("/ft/income-history/:codehash/:genesis/:address")
+	midware.SetRouteCacheByTip("/nft/history/:codehash/:genesis/:address")
+	midware.SetRouteCacheByTip("/address/:address/history/tx")
+	midware.SetRouteCacheByTip("/address/:address/history/info")
+	midware.SetRouteCacheByTip("/contract/history/:codehash/:genesis/:address")
+	midware.SetRouteCacheByTip("/contract/history/:codehash/:genesis")
+
+	mainAPI := router.Group("/", midware.VerifyAuth(), midware.ConcurrencyLimit())
 	if disableVerifyToken != "" {
-		mainAPI = router.Group("/")
+		mainAPI = router.Group("/", midware.ConcurrencyLimit())
 	}
 
 	mainAPI.POST("/local_pushtx", controller.LocalPushTx)
@@ -95,6 +180,9 @@ func main() {
 
 	// sensible irrelevant
 	mainAPI.GET("/getrawmempool", controller.GetRawMempool)
+	if controller.RpcProxyConf.Enabled {
+		mainAPI.POST("/rpc", controller.RpcProxy)
+	}
 	mainAPI.GET("/blockchain/info", controller.GetBlockchainInfo)
 	mainAPI.GET("/mempool/info", controller.GetMempoolInfo)
 	mainAPI.GET("/blocks", controller.GetBlocksByHeightRange)
@@ -106,9 +194,9 @@ func main() {
 	mainAPI.GET("/tx/:txid/out/:index/spent", controller.GetTxOutputSpentStatusByTxIdAndIdx)
 
 	mainAPI.GET("/address/:address/utxo",
-		cache.CacheByRequestURI(store, 1*time.Second), controller.GetUtxoByAddress)
+		midware.CacheByRequestURI(store, 1*time.Second), controller.GetUtxoByAddress)
 	mainAPI.GET("/address/:address/utxo-data",
-		cache.CacheByRequestURI(store, 1*time.Second), controller.GetUtxoDataByAddress)
+		midware.CacheByRequestURI(store, 1*time.Second), controller.GetUtxoDataByAddress)
 
 	mainAPI.GET("/address/:address/balance", controller.GetBalanceByAddress)
 
@@ -132,81 +220,133 @@ func main() {
 	mainAPI.GET("/nft/utxo/:codehash/:genesis/:address", controller.GetNFTUtxo)
 	mainAPI.GET("/nft/utxo-detail/:codehash/:genesis/:token_index", controller.GetNFTUtxoDetailByTokenIndex)
 	mainAPI.GET("/nft/utxo-list/:codehash/:genesis",
-		cache.CacheByRequestURI(store, 1*time.Second), controller.GetNFTUtxoList)
+		midware.CacheByRequestURI(store, 1*time.Second), controller.GetNFTUtxoList)
 
 	mainAPI.GET("/contract/swap-data/:codehash/:genesis",
-		cache.CacheByRequestURI(store, 10*time.Second), controller.GetContractSwapDataInBlockRange)
+		midware.CacheByRequestURI(store, 10*time.Second), controller.GetContractSwapDataInBlockRange)
 	mainAPI.GET("/contract/swap-aggregate/:codehash/:genesis",
-		cache.CacheByRequestURI(store, 60*time.Second), controller.GetContractSwapAggregateInBlockRange)
+		midware.CacheByRequestURI(store, 60*time.Second), controller.GetContractSwapAggregateInBlockRange)
 	mainAPI.GET("/contract/swap-aggregate-amount/:codehash/:genesis",
-		cache.CacheByRequestURI(store, 60*time.Second), controller.GetContractSwapAggregateAmountInBlockRange)
+		midware.CacheByRequestURI(store, 60*time.Second), controller.GetContractSwapAggregateAmountInBlockRange)
 
 	mainAPI.GET("/ft/info/all",
-		cache.CacheByRequestURI(store, 10*time.Second), controller.ListAllFTInfo)
+		midware.CacheByRequestURI(store, 10*time.Second), controller.ListAllFTInfo)
 	mainAPI.GET("/ft/codehash/all",
-		cache.CacheByRequestURI(store, 10*time.Second), controller.ListAllFTCodeHash)
+		midware.CacheByRequestURI(store, 10*time.Second), controller.ListAllFTCodeHash)
 	mainAPI.GET("/ft/codehash-info/:codehash",
-		cache.CacheByRequestURI(store, 10*time.Second), controller.ListFTSummary)
+		midware.CacheByRequestURI(store, 10*time.Second), controller.ListFTSummary)
 	mainAPI.GET("/ft/genesis-info/:codehash/:genesis",
-		cache.CacheByRequestURI(store, 60*time.Second), controller.ListFTInfoByGenesis)
+		midware.CacheByRequestURI(store, 60*time.Second), controller.ListFTInfoByGenesis)
 
 	mainAPI.GET("/ft/transfer-times/:codehash/:genesis",
-		cache.CacheByRequestURI(store, 10*time.Second), controller.GetFTTransferVolumeInBlockRange)
+		midware.CacheByRequestURI(store, 10*time.Second), controller.GetFTTransferVolumeInBlockRange)
 	mainAPI.GET("/ft/owners/:codehash/:genesis",
-		cache.CacheByRequestURI(store, 1*time.Second), controller.ListFTOwners)
+		midware.CacheByRequestURI(store, 1*time.Second), controller.ListFTOwners)
 	mainAPI.GET("/ft/summary/:address",
-		cache.CacheByRequestURI(store, 2*time.Second), controller.ListAllFTSummaryByOwner)
+		midware.CacheByRequestURI(store, 2*time.Second), controller.ListAllFTSummaryByOwner)
 
 	mainAPI.GET("/ft/summary-data/:address",
-		cache.CacheByRequestURI(store, 2*time.Second), controller.ListAllFTSummaryDataByOwner)
+		midware.CacheByRequestURI(store, 2*time.Second), controller.ListAllFTSummaryDataByOwner)
 
 	mainAPI.GET("/ft/balance/:codehash/:genesis/:address", controller.GetFTBalanceByOwner) // without cache
 
 	mainAPI.GET("/ft/history/:codehash/:genesis/:address",
-		cache.CacheByRequestURI(store, 10*time.Second), controller.GetFTHistoryByGenesis)
+		midware.CacheByRequestURI(store, 10*time.Second), controller.GetFTHistoryByGenesis)
 
 	mainAPI.GET("/ft/income-history/:codehash/:genesis/:address",
-		cache.CacheByRequestURI(store, 10*time.Second), controller.GetFTIncomeHistoryByGenesis)
+		midware.CacheByRequestURI(store, 10*time.Second), controller.GetFTIncomeHistoryByGenesis)
 
 	mainAPI.GET("/nft/info/all",
-		cache.CacheByRequestURI(store, 10*time.Second), controller.ListAllNFTInfo)
+		midware.CacheByRequestURI(store, 10*time.Second), controller.ListAllNFTInfo)
 	mainAPI.GET("/nft/codehash/all",
-		cache.CacheByRequestURI(store, 10*time.Second), controller.ListAllNFTCodeHash)
+		midware.CacheByRequestURI(store, 10*time.Second), controller.ListAllNFTCodeHash)
 	mainAPI.GET("/nft/codehash-info/:codehash",
-		cache.CacheByRequestURI(store, 10*time.Second), controller.ListNFTSummary)
+		midware.CacheByRequestURI(store, 10*time.Second), controller.ListNFTSummary)
 	mainAPI.GET("/nft/genesis-info/:codehash/:genesis",
-		cache.CacheByRequestURI(store, 60*time.Second), controller.ListNFTInfoByGenesis)
+		midware.CacheByRequestURI(store, 60*time.Second), controller.ListNFTInfoByGenesis)
 
 	mainAPI.GET("/nft/transfer-times/:codehash/:genesis/:tokenid",
-		cache.CacheByRequestURI(store, 10*time.Second), controller.GetNFTTransferTimesInBlockRange)
+		midware.CacheByRequestURI(store, 10*time.Second), controller.GetNFTTransferTimesInBlockRange)
 	mainAPI.GET("/nft/owners/:codehash/:genesis",
-		cache.CacheByRequestURI(store, 2*time.Second), controller.ListNFTOwners)
+		midware.CacheByRequestURI(store, 2*time.Second), controller.ListNFTOwners)
 	mainAPI.GET("/nft/summary/:address",
-		cache.CacheByRequestURI(store, 2*time.Second), controller.ListAllNFTByOwner)
+		midware.CacheByRequestURI(store, 2*time.Second), controller.ListAllNFTByOwner)
 
 	mainAPI.GET("/nft/detail/:codehash/:genesis/:address", controller.ListNFTCountByOwner) // without cache
 
 	mainAPI.GET("/nft/history/:codehash/:genesis/:address",
-		cache.CacheByRequestURI(store, 10*time.Second), controller.GetNFTHistoryByGenesis)
+		midware.CacheByRequestURI(store, 10*time.Second), controller.GetNFTHistoryByGenesis)
 
 	mainAPI.GET("/address/:address/history/tx",
-		cache.CacheByRequestURI(store, 10*time.Second), controller.GetTxsHistoryByAddress) // include sensible tx, with brief tx info
+		midware.CacheByRequestURI(store, 10*time.Second), controller.GetTxsHistoryByAddress) // include sensible tx, with brief tx info
 
 	mainAPI.GET("/address/:address/history/info",
-		cache.CacheByRequestURI(store, 5*time.Second), controller.GetTxsHistoryInfoByAddress)
+		midware.CacheByRequestURI(store, 5*time.Second), controller.GetTxsHistoryInfoByAddress)
 
 	mainAPI.GET("/contract/history/:codehash/:genesis/:address",
-		cache.CacheByRequestURI(store, 10*time.Second), controller.GetHistoryByGenesis)
+		midware.CacheByRequestURI(store, 10*time.Second), controller.GetHistoryByGenesis)
 
 	mainAPI.GET("/contract/history/:codehash/:genesis",
-		cache.CacheByRequestURI(store, 10*time.Second), controller.GetAllHistoryByGenesis)
+		midware.CacheByRequestURI(store, 10*time.Second), controller.GetAllHistoryByGenesis)
 
 	mainAPI.GET("/token/info",
-		cache.CacheByRequestURI(store, 10*time.Second), controller.ListAllTokenInfo)
+		midware.CacheByRequestURI(store, 10*time.Second), controller.ListAllTokenInfo)
 
-	heightAPI := router.Group("/height/:height", midware.VerifyToken())
+	// WhatsOnChain兼容接口，客户端只需替换base url
+	wocAPI := router.Group("/woc/v1/bsv/:network", midware.WocApiKey(), midware.VerifyAuth(), midware.ConcurrencyLimit(), controller.WocCheckNetwork)
 	if disableVerifyToken != "" {
-		heightAPI = router.Group("/height/:height")
+		wocAPI = router.Group("/woc/v1/bsv/:network", midware.ConcurrencyLimit(), controller.WocCheckNetwork)
+	}
+	{
+		wocAPI.GET("/woc", controller.WocStatus)
+		wocAPI.GET("/chain/info", controller.WocGetChainInfo)
+		wocAPI.GET("/block/hash/:hash", controller.WocGetBlockByHash)
+		wocAPI.GET("/block/hash/:hash/page/:page", controller.WocGetBlockPage)
+		wocAPI.GET("/block/height/:height", controller.WocGetBlockByHeight)
+		wocAPI.GET("/tx/hash/:txid", controller.WocGetTxByHash)
+		wocAPI.GET("/tx/:txid/hex", controller.WocGetRawTx)
+		wocAPI.POST("/tx/raw", controller.WocPushRawTx)
+		wocAPI.POST("/txs", controller.WocGetTxs)
+		wocAPI.GET("/address/:address/info", controller.WocGetAddressInfo)
+		wocAPI.GET("/address/:address/balance", controller.WocGetAddressBalance)
+		wocAPI.GET("/address/:address/history", controller.WocGetAddressHistory)
+		wocAPI.GET("/address/:address/unspent", controller.WocGetAddressUnspent)
+		wocAPI.GET("/script/:scripthash/history", controller.WocGetScriptHistory)
+		wocAPI.GET("/script/:scripthash/unspent", controller.WocGetScriptUnspent)
+		wocAPI.GET("/mempool/info", controller.WocGetMempoolInfo)
+		wocAPI.GET("/mempool/raw", controller.WocGetMempoolRaw)
+	}
+
+	// bitcoind REST兼容接口，由索引提供，不暴露节点
+	restAPI := router.Group("/rest", midware.VerifyAuth(), midware.ConcurrencyLimit())
+	if disableVerifyToken != "" {
+		restAPI = router.Group("/rest", midware.ConcurrencyLimit())
+	}
+	{
+		restAPI.GET("/tx/:txid", controller.RestGetTx)
+		restAPI.GET("/block/:hash", controller.RestGetBlock)
+		restAPI.GET("/block/notxdetails/:hash", controller.RestGetBlockNoTxDetails)
+		restAPI.GET("/headers/:count/:hash", controller.RestGetHeaders)
+		restAPI.GET("/getutxos/*outpoints", controller.RestGetUtxos)
+		restAPI.GET("/chaininfo.json", controller.RestGetChainInfo)
+	}
+
+	// 地址订阅推送，长连接不占用并发预算
+	streamAPI := router.Group("/", midware.VerifyAuth())
+	if disableVerifyToken != "" {
+		streamAPI = router.Group("/")
+	}
+	streamAPI.GET("/ws", controller.SubscribeWs)
+	streamAPI.GET("/sse", controller.SubscribeSse)
+	streamAPI.GET("/ws/blocks", controller.SubscribeBlocksWs)
+	streamAPI.GET("/sse/blocks", controller.SubscribeBlocksSse)
+	if service.ElectrumConf.Enabled {
+		streamAPI.GET("/electrum", controller.ElectrumWs)
+	}
+
+	heightAPI := router.Group("/height/:height", midware.VerifyAuth(), midware.ConcurrencyLimit())
+	if disableVerifyToken != "" {
+		heightAPI = router.Group("/height/:height", midware.ConcurrencyLimit())
 	}
 	{
 		// sensible irrelevant
@@ -222,6 +362,31 @@ func main() {
 		heightAPI.GET("/tx/:txid/out/:index", controller.GetTxOutputByTxIdAndIdxInsideHeight)
 	}
 
+	// 未设置ADMIN_TOKEN且未启用JWT时不开放管理接口
+	if adminToken != "" || midware.JwtEnabled() {
+		adminAPI := router.Group("/admin", midware.VerifyAdminToken(adminToken))
+		adminAPI.POST("/tokens", controller.AdminCreateToken)
+		adminAPI.GET("/tokens", controller.AdminListTokens)
+		adminAPI.GET("/tokens/:token", controller.AdminGetToken)
+		adminAPI.POST("/tokens/:token", controller.AdminUpdateToken)
+		adminAPI.POST("/tokens/:token/quota", controller.AdminSetTokenQuota)
+		adminAPI.POST("/tokens/:token/suspend", controller.AdminSuspendToken)
+		adminAPI.POST("/tokens/:token/resume", controller.AdminResumeToken)
+		adminAPI.POST("/tokens/:token/revoke", controller.AdminRevokeToken)
+		adminAPI.POST("/tokens/:token/secret", controller.AdminRotateTokenSecret)
+		adminAPI.GET("/tokens/:token/usage", controller.AdminGetTokenUsage)
+		adminAPI.GET("/audit", controller.AdminListAudit)
+		adminAPI.GET("/slow-queries", controller.AdminListSlowQueries)
+		adminAPI.GET("/config", controller.AdminGetConfig)
+		adminAPI.POST("/config/reload", controller.AdminReloadConfig)
+		adminAPI.POST("/webhooks", controller.AdminCreateWebhook)
+		adminAPI.GET("/webhooks", controller.AdminListWebhooks)
+		adminAPI.GET("/webhooks/:id", controller.AdminGetWebhook)
+		adminAPI.POST("/webhooks/:id/delete", controller.AdminDeleteWebhook)
+		adminAPI.GET("/webhook-dead", controller.AdminListWebhookDead)
+		adminAPI.POST("/webhook-dead/:delivery/replay", controller.AdminReplayWebhookDead)
+	}
+
 	logger.Log.Info("LISTEN:",
 		zap.String("address", listen_address),
 	)
@@ -239,6 +404,58 @@ func main() {
 		}
 	}()
 
+	var adminSvr *http.Server
+	if adminListenAddress != "" {
+		adminRouter := gin.New()
+		adminRouter.Use(ginzap.RecoveryWithZap(logger.Log, true))
+		midware.CreateMetricsEndpoint(adminRouter)
+
+		logger.Log.Info("ADMIN_LISTEN:",
+			zap.String("address", adminListenAddress),
+		)
+		adminSvr = &http.Server{
+			Addr:    adminListenAddress,
+			Handler: adminRouter,
+		}
+		go func() {
+			err := adminSvr.ListenAndServe()
+			if err != nil && err != http.ErrServerClosed {
+				logger.Log.Fatal("Admin ListenAndServe:",
+					zap.Error(err),
+				)
+			}
+		}()
+	}
+
+	var electrumListener net.Listener
+	if electrumListenAddress != "" && service.ElectrumConf.Enabled {
+		logger.Log.Info("ELECTRUM_LISTEN:",
+			zap.String("address", electrumListenAddress),
+		)
+		ln, err := net.Listen("tcp", electrumListenAddress)
+		if err != nil {
+			logger.Log.Fatal("Electrum Listen:",
+				zap.Error(err),
+			)
+		}
+		electrumListener = ln
+		go controller.ServeElectrumTcp(ln)
+	}
+
+	monitorCtx, stopMonitor := context.WithCancel(context.Background())
+	defer stopMonitor()
+	controller.StartNodeProbe(monitorCtx)
+	controller.StartIndexMonitor(monitorCtx)
+	controller.StartZmq(monitorCtx)
+	clickhouse.StartReplicaCheck(monitorCtx)
+	controller.ResumeBroadcasts(monitorCtx)
+	service.StartSubscriptions(monitorCtx)
+	// 索引的最高区块变化时，依赖最高区块的接口缓存不再命中
+	service.StartBlockStream(monitorCtx, midware.SetCacheTip)
+	service.StartWebhooks(monitorCtx)
+	service.StartEventBus(monitorCtx)
+	service.StartScriptHashIndex(monitorCtx)
+
 	// GC
 	go func() {
 		for {
@@ -257,20 +474,62 @@ func main() {
 		}
 	}()
 
-	quit := make(chan os.Signal)
+	// SIGHUP重新加载运行时配置
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			settings.Reload()
+		}
+	}()
+
+	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
-	timeout := time.Duration(1) * time.Second
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
+	logger.Log.Info("shutting down",
+		zap.Duration("timeout", shutdownTimeout),
+		zap.Duration("delay", shutdownDelay),
+	)
+	service.SetDraining()
+	// 推送长连接不会自行结束，先关闭
+	if electrumListener != nil {
+		electrumListener.Close()
+	}
+	service.CloseSubscriptions()
+	if shutdownDelay > 0 {
+		svr.SetKeepAlivesEnabled(false)
+		time.Sleep(shutdownDelay)
+	}
 
+	// 等待进行中的请求，再等待请求留下的后台广播
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
 	if err := svr.Shutdown(ctx); err != nil {
-		logger.Log.Fatal("Shutdown:",
+		logger.Log.Warn("Shutdown:",
 			zap.Error(err),
 		)
-
 	}
+	controller.DrainBroadcasts(ctx)
+	stopMonitor()
+
+	// drain超时后仍留出时间上报剩余的trace
+	closeCtx, closeCancel := context.WithTimeout(context.Background(), time.Second)
+	defer closeCancel()
+	if adminSvr != nil {
+		adminSvr.Shutdown(closeCtx)
+	}
+	if err := tracing.Shutdown(closeCtx); err != nil {
+		logger.Log.Info("trace shutdown failed", zap.Error(err))
+	}
+	if err := rdb.Close(); err != nil {
+		logger.Log.Info("redis close failed", zap.Error(err))
+	}
+	if err := clickhouse.Close(); err != nil {
+		logger.Log.Info("clickhouse close failed", zap.Error(err))
+	}
+	logger.Log.Info("shutdown done")
+	logger.Log.Sync()
 }
 
 func byteCountBinary(b uint64) string {
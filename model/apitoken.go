@@ -0,0 +1,66 @@
+package model
+
+const (
+	ApiTokenActive    = "active"
+	ApiTokenSuspended = "suspended"
+	ApiTokenRevoked   = "revoked"
+)
+
+// ApiTokenReq 创建/修改API token
+type ApiTokenReq struct {
+	Label  string `json:"label"`           // 备注
+	Owner  string `json:"owner"`           // 所有者
+	Plan   string `json:"plan"`            // 限流套餐名称，见conf/ratelimit.yaml，为空使用quota总配额，修改时"-"表示取消套餐
+	Quota  *int64 `json:"quota,omitempty"` // 初始quota总配额
+	Auth   string `json:"auth"`            // 允许的鉴权方式，bearer/hmac/jwt，为空都允许，修改时"-"表示清除
+	Scopes string `json:"scopes"`          // 允许的scope，空格分隔，如"read push"，为空不限制，修改时"-"表示清除
+}
+
+// ApiTokenSecretReq 轮换HMAC签名密钥
+type ApiTokenSecretReq struct {
+	Grace *int64 `json:"grace"` // 旧密钥继续有效的秒数，默认86400，0表示立即失效
+}
+
+type ApiTokenSecretResp struct {
+	AppId  string `json:"appid"`  // 签名请求的appid，与token不同
+	Secret string `json:"secret"` // 仅在生成时返回一次
+}
+
+// ApiTokenQuotaReq 修改quota总配额
+type ApiTokenQuotaReq struct {
+	Op     string `json:"op"`     // add: 充值, set: 设置
+	Amount int64  `json:"amount"` // 数量
+}
+
+type ApiTokenResp struct {
+	Token     string `json:"token"`
+	Label     string `json:"label"`
+	Owner     string `json:"owner"`
+	Plan      string `json:"plan"`
+	Status    string `json:"status"`    // active/suspended/revoked
+	Auth      string `json:"auth"`      // 允许的鉴权方式，bearer/hmac/jwt，为空都允许
+	Scopes    string `json:"scopes"`    // 允许的scope，空格分隔，为空不限制
+	AppId     string `json:"appid"`     // 签名请求的appid，生成密钥前为空
+	HasSecret bool   `json:"hasSecret"` // 是否已生成HMAC签名密钥
+	Quota     int64  `json:"quota"`     // 剩余quota总配额
+	Visit     int64  `json:"visit"`     // 累计请求次数
+	CreatedAt int64  `json:"createdAt"` // 创建时间戳
+	UpdatedAt int64  `json:"updatedAt"` // 最后修改时间戳
+}
+
+// ApiTokenUsageResp 某日的使用量
+type ApiTokenUsageResp struct {
+	Date     string           `json:"date"`     // 日期，如20221019(UTC)
+	Total    int64            `json:"total"`    // 当日请求次数
+	Units    int64            `json:"units"`    // 当日消耗配额单位
+	Patterns map[string]int64 `json:"patterns"` // 按接口路由模式统计的请求次数
+}
+
+// AdminAuditResp 管理操作记录
+type AdminAuditResp struct {
+	Timestamp int64  `json:"timestamp"`
+	Action    string `json:"action"`
+	Token     string `json:"token,omitempty"`
+	Detail    string `json:"detail,omitempty"`
+	RemoteIP  string `json:"remoteIP"`
+}
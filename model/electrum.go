@@ -0,0 +1,46 @@
+package model
+
+// ElectrumBalanceResp blockchain.scripthash.get_balance
+type ElectrumBalanceResp struct {
+	Confirmed   int `json:"confirmed"`   // 已确认余额
+	Unconfirmed int `json:"unconfirmed"` // mempool中的余额变化
+}
+
+// ElectrumUtxoResp blockchain.scripthash.listunspent
+type ElectrumUtxoResp struct {
+	TxHash string `json:"tx_hash"`
+	TxPos  int    `json:"tx_pos"`
+	Height int    `json:"height"` // mempool中为0
+	Value  int    `json:"value"`
+}
+
+// ElectrumHeaderResp blockchain.headers.subscribe
+type ElectrumHeaderResp struct {
+	Height int    `json:"height"`
+	Hex    string `json:"hex"` // 80字节区块头
+}
+
+// ElectrumHeadersResp blockchain.block.headers
+type ElectrumHeadersResp struct {
+	Count int    `json:"count"`
+	Hex   string `json:"hex"` // 连续的区块头
+	Max   int    `json:"max"` // 单次最多返回的区块头数
+}
+
+// ElectrumMerkleResp blockchain.transaction.get_merkle
+type ElectrumMerkleResp struct {
+	BlockHeight int      `json:"block_height"`
+	Merkle      []string `json:"merkle"`
+	Pos         int      `json:"pos"`
+}
+
+// ElectrumFeaturesResp server.features
+type ElectrumFeaturesResp struct {
+	GenesisHash   string            `json:"genesis_hash"`
+	Hosts         map[string]string `json:"hosts"`
+	ProtocolMax   string            `json:"protocol_max"`
+	ProtocolMin   string            `json:"protocol_min"`
+	Pruning       *int              `json:"pruning"`
+	ServerVersion string            `json:"server_version"`
+	HashFunction  string            `json:"hash_function"`
+}
@@ -0,0 +1,67 @@
+package model
+
+// 地址订阅推送的事件类型，utxo变化见utxoset.Change*
+const (
+	EventSubscribed   = "subscribed"   // 订阅成功，附当前余额
+	EventUnsubscribed = "unsubscribed" // 取消订阅
+	EventBalance      = "balance"      // 余额变化
+	EventError        = "error"        // 请求错误，或连接将被关闭的原因
+	EventNodeTx       = "node_tx"      // 节点mempool收到向该地址P2PKH输出的交易，尚未索引
+)
+
+// AddressEventResp 地址订阅推送的事件
+type AddressEventResp struct {
+	Type    string       `json:"type"`              // subscribed/unsubscribed/balance/error/node_tx，或utxo变化: mempool/mempool_spent/mempool_removed/spend_removed/confirmed/spent
+	Address string       `json:"address,omitempty"` // address
+	TxId    string       `json:"txid,omitempty"`    // utxo变化或node_tx的txid
+	Vout    *int         `json:"vout,omitempty"`    // utxo变化或node_tx的vout
+	Balance *BalanceResp `json:"balance,omitempty"` // subscribed/balance事件的余额
+	Msg     string       `json:"msg,omitempty"`     // error事件的原因
+}
+
+// 区块推送的事件类型
+const (
+	EventBlock = "block" // 新的最高区块
+	EventReorg = "reorg" // 重组，随后按高度推送新连接区块的block事件
+
+	EventNodeBlock = "node_block" // 节点收到的新区块，尚未索引，续传时不补发
+)
+
+// BlockEventResp 区块推送的事件
+type BlockEventResp struct {
+	Type      string          `json:"type"`                // block/reorg/node_block/error
+	Block     *BlockBriefResp `json:"block,omitempty"`     // block事件的区块
+	Reorg     *ReorgResp      `json:"reorg,omitempty"`     // reorg事件的区块范围
+	NodeBlock *NodeBlockResp  `json:"nodeBlock,omitempty"` // node_block事件的区块头
+	Msg       string          `json:"msg,omitempty"`       // error事件的原因
+}
+
+// NodeBlockResp 节点getblockheader的区块头
+type NodeBlockResp struct {
+	Height         int    `json:"height"`    // 区块高度
+	BlockIdHex     string `json:"id"`        // 区块ID
+	PrevBlockIdHex string `json:"prev"`      // 前一个区块ID
+	BlockTime      int    `json:"timestamp"` // 区块时间戳
+}
+
+type BlockBriefResp struct {
+	Height          int    `json:"height"`     // 区块高度
+	BlockIdHex      string `json:"id"`         // 区块ID
+	PrevBlockIdHex  string `json:"prev"`       // 前一个区块ID
+	TxCount         int    `json:"ntx"`        // 区块内包含的Tx数量
+	SensibleTxCount int    `json:"sensibleTx"` // 区块内输入或输出包含sensible合约的Tx数量
+	BlockTime       int    `json:"timestamp"`  // 区块时间戳
+}
+
+type ReorgResp struct {
+	ForkHeight   int             `json:"forkHeight"`   // 新旧链共同的最高区块
+	Disconnected *BlockRangeResp `json:"disconnected"` // 被断开的区块
+	Connected    *BlockRangeResp `json:"connected"`    // 新连接的区块
+}
+
+// BlockRangeResp 区块高度范围，含start、end
+type BlockRangeResp struct {
+	Start       int      `json:"start"`
+	End         int      `json:"end"`
+	BlockIdsHex []string `json:"ids"` // 按高度升序的区块ID
+}
@@ -0,0 +1,65 @@
+package model
+
+// 事件总线发布的事件类型
+const (
+	BusBlock         = "block"           // 区块，排在区块内所有交易事件之后
+	BusTokenTransfer = "token_transfer"  // 一个交易内某个FT或NFT的转移
+	BusNFTSellList   = "nft_sell_list"   // NFT挂单
+	BusNFTSellCancel = "nft_sell_cancel" // NFT撤单，NFT回到卖家
+	BusNFTSellBuy    = "nft_sell_buy"    // NFT挂单被购买
+	BusNFTAuctionBid = "nft_auction_bid" // NFT拍卖出价
+	BusSwap          = "swap"            // swap合约操作
+)
+
+// BusTokenIOResp 转移的一个输入或输出
+type BusTokenIOResp struct {
+	TxIdHex    string `json:"txid"` // 输出所在txid，输入为被花费输出的txid
+	Vout       int    `json:"vout"` // 输出序号，输入为被花费输出的序号
+	Address    string `json:"address"`
+	Amount     string `json:"amount,omitempty"`     // ft数量
+	TokenIndex string `json:"tokenIndex,omitempty"` // nft tokenIndex
+}
+
+// BusTokenTransferResp token_transfer事件
+type BusTokenTransferResp struct {
+	CodeType    int               `json:"codeType"` // 1: FT, 3: NFT
+	CodeHashHex string            `json:"codehash"`
+	GenesisHex  string            `json:"genesis"`
+	SensibleId  string            `json:"sensibleId"`
+	Inputs      []*BusTokenIOResp `json:"inputs"`
+	Outputs     []*BusTokenIOResp `json:"outputs"`
+}
+
+// BusNFTSellResp nft_sell_list/nft_sell_cancel/nft_sell_buy事件
+type BusNFTSellResp struct {
+	CodeHashHex string `json:"codehash"` // nft codehash
+	GenesisHex  string `json:"genesis"`  // nft genesis
+	TokenIndex  string `json:"tokenIndex"`
+	Price       int    `json:"price"`           // 卖价satoshi
+	Seller      string `json:"seller"`          // 卖家地址
+	Buyer       string `json:"buyer,omitempty"` // nft_sell_buy的买家地址
+	SellTxIdHex string `json:"sellTxid"`        // 挂单输出的txid
+	SellVout    int    `json:"sellVout"`        // 挂单输出的序号
+}
+
+// BusNFTAuctionBidResp nft_auction_bid事件
+type BusNFTAuctionBidResp struct {
+	CodeHashHex    string `json:"codehash"`   // 拍卖合约codehash
+	SensibleIdHex  string `json:"sensibleId"` // 拍卖的sensibleId
+	NFTCodeHashHex string `json:"nftCodehash"`
+	NFTIDHex       string `json:"nftId"`
+	Sender         string `json:"sender"` // 发起拍卖的地址
+	Bidder         string `json:"bidder"`
+	BidBsvPrice    int    `json:"bidPrice"`
+	BidTimestamp   int    `json:"bidTimestamp"`
+	StartBsvPrice  int    `json:"startPrice"`
+	EndTimestamp   int    `json:"endTimestamp"`
+	Vout           int    `json:"vout"` // 拍卖状态输出的序号
+}
+
+// BusSwapResp swap事件
+type BusSwapResp struct {
+	CodeHashHex string `json:"codehash"`
+	GenesisHex  string `json:"genesis"`
+	*ContractSwapDataResp
+}
@@ -0,0 +1,38 @@
+package model
+
+const (
+	HealthOk       = "ok"
+	HealthError    = "error"
+	HealthDegraded = "degraded" // 可以服务但数据落后
+)
+
+// HealthCheckResp 单个依赖的检查结果
+type HealthCheckResp struct {
+	Name      string  `json:"name"`            // clickhouse/redis.biz/redis.utxo/redis.address/redis.user/redis.cache/bitcoind
+	Status    string  `json:"status"`          // ok/error/degraded
+	LatencyMs float64 `json:"latencyMs"`       // 检查耗时(毫秒)
+	Error     string  `json:"error,omitempty"` // 失败原因
+	Detail    string  `json:"detail,omitempty"`
+}
+
+// HealthStatusResp 服务及各依赖状态
+type HealthStatusResp struct {
+	Status    string             `json:"status"`    // 所有依赖正常时为ok，索引落后时为degraded
+	StartedAt int64              `json:"startedAt"` // 进程启动时间(秒)
+	Uptime    int64              `json:"uptime"`    // 运行时长(秒)
+	Checks    []*HealthCheckResp `json:"checks"`
+	Index     *IndexStatusResp   `json:"index,omitempty"`
+}
+
+// RuntimeConfigResp 当前生效的运行时配置，不含密钥
+type RuntimeConfigResp struct {
+	LogLevel             string            `json:"logLevel"`
+	MaxHistorySize       int               `json:"maxHistorySize"`
+	MaxHistoryLimit      int               `json:"maxHistoryLimit"`
+	MaxHistoryBlockRange int               `json:"maxHistoryBlockRange"`
+	MaxUtxoSize          int               `json:"maxUtxoSize"`
+	Cache                map[string]string `json:"cache"` // 路由模式 => 缓存时长，覆盖代码中的默认值
+	Rpc                  string            `json:"rpc"`
+	RpcNodes             []string          `json:"rpcNodes"` // 节点url，隐藏密码
+	WocKeySet            bool              `json:"wocKeySet"`
+}
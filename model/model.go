@@ -25,8 +25,15 @@ type Response struct {
 	Code int         `json:"code"`
 	Msg  string      `json:"msg"`
 	Data interface{} `json:"data"`
+	Next string      `json:"next,omitempty"` // 下一页游标
+	Prev string      `json:"prev,omitempty"` // 上一页游标
+
+	Source string `json:"source,omitempty"` // 数据来源，redis不可用降级查询ClickHouse时为clickhouse
 }
 
+// SourceClickhouse Response.Source，redis不可用时由ClickHouse计算
+const SourceClickhouse = "clickhouse"
+
 func (t *Response) MarshalJSON() ([]byte, error) {
 	return json.Marshal(*t)
 }
@@ -80,7 +80,7 @@ type NFTAuctionResp struct {
 	FeeAddress    string `json:"feeAddress"`    // 当前拍卖手续费的地址
 	StartBsvPrice int    `json:"startBsvPrice"` // 当前拍卖NFT的起拍价格(satoshi)
 	SenderAddress string `json:"senderAddress"` // 当前拍卖发起人的地址
-	EndTimestamp  int    `json:"bidTimestamp"`  // 当前拍卖结束的时间戳
+	EndTimestamp  int    `json:"-"`             // 当前拍卖结束的时间戳，暂不返回
 	BidTimestamp  int    `json:"bidTimestamp"`  // 当前拍卖出价的时间戳
 	BidBsvPrice   int    `json:"bidBsvPrice"`   // 当前拍卖NFT的出价价格(satoshi)
 	BidderAddress string `json:"bidderAddress"` // 当前拍卖出价人的地址
@@ -0,0 +1,25 @@
+package model
+
+// RestScriptPubKeyResp 节点decodescript的返回
+type RestScriptPubKeyResp struct {
+	Asm       string   `json:"asm"`
+	Hex       string   `json:"hex"`
+	ReqSigs   int      `json:"reqSigs,omitempty"`
+	Type      string   `json:"type"`
+	Addresses []string `json:"addresses,omitempty"`
+}
+
+// RestUtxoResp /rest/getutxos中的一个utxo
+type RestUtxoResp struct {
+	Height       int                   `json:"height"` // mempool中为2147483647
+	Value        float64               `json:"value"`  // BSV
+	ScriptPubKey *RestScriptPubKeyResp `json:"scriptPubKey"`
+}
+
+// RestUtxosResp /rest/getutxos
+type RestUtxosResp struct {
+	ChainHeight  int             `json:"chainHeight"`
+	ChaintipHash string          `json:"chaintipHash"`
+	Bitmap       string          `json:"bitmap"` // 每个outpoint是否为utxo，如"101"
+	Utxos        []*RestUtxoResp `json:"utxos"`
+}
@@ -0,0 +1,20 @@
+package model
+
+// SlowQueryResp 慢查询指纹统计
+type SlowQueryResp struct {
+	Hash        string `json:"hash"`
+	Fingerprint string `json:"fingerprint"` // 常量替换为?后的SQL
+	Sql         string `json:"sql"`         // 最近一次的SQL，已去除多余空白
+	Op          string `json:"op"`
+	Route       string `json:"route"` // 最近一次调用的路由
+	Count       int64  `json:"count"`
+	Errors      int64  `json:"errors"`
+	TotalMs     int64  `json:"totalMs"`
+	MaxMs       int64  `json:"maxMs"`
+	MaxRows     int64  `json:"maxRows"`     // 最多返回行数
+	ReadRows    int64  `json:"readRows"`    // 最近一次读取行数，来自system.query_log
+	ReadBytes   int64  `json:"readBytes"`   // 最近一次读取字节数，来自system.query_log
+	MemoryUsage int64  `json:"memoryUsage"` // 最近一次内存占用，来自system.query_log
+	LastError   string `json:"lastError,omitempty"`
+	LastAt      int64  `json:"lastAt"`
+}
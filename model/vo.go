@@ -21,6 +21,20 @@ type BlockchainInfoResp struct {
 	Difficulty    string `json:"difficulty"`
 	MedianTime    int    `json:"medianTime"`
 	Chainwork     string `json:"chainwork"`
+
+	Index *IndexStatusResp `json:"index,omitempty"` // 索引同步状态
+}
+
+// IndexStatusResp 索引与节点的同步状态，由后台定期检查
+type IndexStatusResp struct {
+	IndexHeight int    `json:"indexHeight"`     // 已索引的最新区块高度
+	NodeHeight  int    `json:"nodeHeight"`      // 节点getblockcount
+	LagBlocks   int    `json:"lagBlocks"`       // 落后区块数
+	TipTime     int    `json:"tipTime"`         // 已索引最新区块的时间
+	TipAge      int64  `json:"tipAge"`          // 已索引最新区块距今秒数
+	Degraded    bool   `json:"degraded"`        // 落后超过阈值
+	CheckedAt   int64  `json:"checkedAt"`       // 检查时间(秒)
+	Error       string `json:"error,omitempty"` // 最近一次检查失败原因
 }
 
 type BlockTokenVolumeResp struct {
@@ -0,0 +1,96 @@
+package model
+
+import "encoding/json"
+
+// webhook触发类型
+const (
+	WebhookAddressPayment = "address_payment" // 地址收到utxo，未确认及确认时各通知一次
+	WebhookFTBalance      = "ft_balance"      // 地址的某个FT余额变化
+	WebhookNFTTransfer    = "nft_transfer"    // 某个NFT转移
+	WebhookSwap           = "swap"            // 交易池新的swap操作
+)
+
+// WebhookReq 注册webhook
+type WebhookReq struct {
+	Url        string `json:"url"`        // 接收通知的http(s)地址
+	Type       string `json:"type"`       // address_payment/ft_balance/nft_transfer/swap
+	Label      string `json:"label"`      // 备注
+	Address    string `json:"address"`    // address_payment、ft_balance的地址
+	CodeHash   string `json:"codehash"`   // ft_balance、nft_transfer、swap的合约codehash
+	Genesis    string `json:"genesis"`    // ft_balance、nft_transfer、swap的合约genesis
+	TokenIndex string `json:"tokenIndex"` // nft_transfer的tokenIndex
+}
+
+type WebhookResp struct {
+	Id         string `json:"id"`
+	Url        string `json:"url"`
+	Type       string `json:"type"`
+	Label      string `json:"label"`
+	Address    string `json:"address,omitempty"`
+	CodeHash   string `json:"codehash,omitempty"`
+	Genesis    string `json:"genesis,omitempty"`
+	TokenIndex string `json:"tokenIndex,omitempty"`
+	Secret     string `json:"secret,omitempty"` // 签名密钥，仅在注册时返回一次
+	CreatedAt  int64  `json:"createdAt"`
+}
+
+// WebhookEventResp 投递给webhook的请求body
+type WebhookEventResp struct {
+	Id        string      `json:"id"`        // 事件id，同一事件只投递一次
+	Webhook   string      `json:"webhook"`   // webhook id
+	Type      string      `json:"type"`      // 触发类型
+	Timestamp int64       `json:"timestamp"` // 事件产生时间
+	Data      interface{} `json:"data"`
+}
+
+// WebhookPaymentResp address_payment事件
+type WebhookPaymentResp struct {
+	Address   string `json:"address"`
+	TxId      string `json:"txid"`
+	Vout      int    `json:"vout"`
+	Satoshi   int    `json:"satoshi"`
+	Confirmed bool   `json:"confirmed"`
+}
+
+// WebhookFTBalanceResp ft_balance事件
+type WebhookFTBalanceResp struct {
+	Address            string `json:"address"`
+	CodeHashHex        string `json:"codehash"`
+	GenesisHex         string `json:"genesis"`
+	Balance            int    `json:"balance"`
+	PendingBalance     int    `json:"pendingBalance"`
+	PrevBalance        int    `json:"prevBalance"`
+	PrevPendingBalance int    `json:"prevPendingBalance"`
+	Decimal            int    `json:"decimal"`
+}
+
+// WebhookNFTTransferResp nft_transfer事件
+type WebhookNFTTransferResp struct {
+	CodeHashHex string `json:"codehash"`
+	GenesisHex  string `json:"genesis"`
+	TokenIndex  string `json:"tokenIndex"`
+	TxId        string `json:"txid"`
+	Vout        int    `json:"vout"`
+	Address     string `json:"address"`     // 新的持有人
+	PrevAddress string `json:"prevAddress"` // 之前的持有人
+	Confirmed   bool   `json:"confirmed"`
+}
+
+// WebhookDeliveryResp 一次投递及其重试状态
+type WebhookDeliveryResp struct {
+	Id        string          `json:"id"`
+	Webhook   string          `json:"webhook"`
+	Payload   json.RawMessage `json:"payload"`   // 请求body，即WebhookEventResp
+	Attempts  int             `json:"attempts"`  // 已尝试次数
+	LastError string          `json:"lastError"` // 最后一次失败原因
+	CreatedAt int64           `json:"createdAt"`
+	FailedAt  int64           `json:"failedAt,omitempty"` // 进入死信列表的时间
+}
+
+// WebhookSwapResp swap事件
+type WebhookSwapResp struct {
+	CodeHashHex string `json:"codehash"`
+	GenesisHex  string `json:"genesis"`
+	Confirmed   bool   `json:"confirmed"`
+	*ContractSwapDataResp
+}
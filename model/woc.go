@@ -0,0 +1,52 @@
+package model
+
+// ChainInfoResp 与bitcoind getblockchaininfo格式一致，WhatsOnChain /chain/info和/rest/chaininfo.json共用
+type ChainInfoResp struct {
+	Chain                string  `json:"chain"` // main/test
+	Blocks               int     `json:"blocks"`
+	Headers              int     `json:"headers"`
+	BestBlockHash        string  `json:"bestblockhash"`
+	Difficulty           float64 `json:"difficulty"`
+	MedianTime           int     `json:"mediantime"`
+	VerificationProgress float64 `json:"verificationprogress"`
+	Pruned               bool    `json:"pruned"`
+	Chainwork            string  `json:"chainwork"`
+}
+
+// WocBlockPagesResp 区块内交易超过一页时的分页地址
+type WocBlockPagesResp struct {
+	Uri  []string `json:"uri"`
+	Size int      `json:"size"` // 每页txid数
+}
+
+// WocBlockResp WhatsOnChain /block/hash/{hash}、/block/height/{height}
+type WocBlockResp struct {
+	Hash              string             `json:"hash"`
+	Confirmations     int                `json:"confirmations"`
+	Size              int                `json:"size"`
+	Height            int                `json:"height"`
+	Version           int                `json:"version"`
+	VersionHex        string             `json:"versionHex"`
+	MerkleRoot        string             `json:"merkleroot"`
+	TxCount           int                `json:"txcount"`
+	Tx                []string           `json:"tx"` // 最多前1000个txid，其余通过pages获取
+	Time              int                `json:"time"`
+	MedianTime        int                `json:"mediantime"`
+	Nonce             int64              `json:"nonce"`
+	Bits              string             `json:"bits"`
+	Difficulty        float64            `json:"difficulty"`
+	Chainwork         string             `json:"chainwork"`
+	PreviousBlockHash string             `json:"previousblockhash,omitempty"`
+	NextBlockHash     string             `json:"nextblockhash,omitempty"`
+	Pages             *WocBlockPagesResp `json:"pages,omitempty"`
+}
+
+// WocAddressInfoResp WhatsOnChain /address/{address}/info
+type WocAddressInfoResp struct {
+	IsValid      bool   `json:"isvalid"`
+	Address      string `json:"address"`
+	ScriptPubKey string `json:"scriptPubKey"`
+	IsMine       bool   `json:"ismine"`
+	IsWatchOnly  bool   `json:"iswatchonly"`
+	IsScript     bool   `json:"isscript"`
+}
@@ -0,0 +1,431 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sensiblequery/dao/rdb"
+	"sensiblequery/logger"
+	"sensiblequery/model"
+	"strconv"
+	"time"
+
+	redis "github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+// API token 在user redis中的key:
+//
+//	apitoken:<token>       hash，label/owner/status/auth/scopes/appid/created/updated
+//	apitokens              zset，所有token，分数为创建时间
+//	plan:<token>           限流套餐
+//	appid:<appid>          签名请求的appid对应的token，首次生成密钥时分配，appid不是token
+//	secretkey:<appid>      HMAC签名密钥。手工配置的旧appid即token本身
+//	secretkey:prev:<appid> 轮换后旧密钥，过期前仍可用
+//	quota:<token>          quota总配额
+//	visit:<token>          累计请求次数
+//	usage:<token>:<date>   hash，当日按路由模式统计的请求次数，_total/_units为合计，由midware写入
+//	audit:admin            list，管理操作记录
+//	audit:admin:<token>    list，该token相关的管理操作记录
+const (
+	adminAuditKey         = "audit:admin"
+	adminAuditMaxLen      = 100000
+	adminAuditTokenMaxLen = 10000
+)
+
+var (
+	ErrApiTokenNotExist = errors.New("token not exist")
+	ErrApiTokenNoQuota  = errors.New("plan or positive quota required")
+)
+
+func newApiToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func checkApiTokenAuth(auth string) error {
+	switch auth {
+	case "", "-", "bearer", "hmac", "jwt":
+		return nil
+	}
+	return errors.New("auth invalid")
+}
+
+// CreateApiToken 创建token，需要套餐或大于0的quota总配额，套餐名由调用方检查
+func CreateApiToken(ctx context.Context, req *model.ApiTokenReq) (tokenRsp *model.ApiTokenResp, err error) {
+	if err := checkApiTokenAuth(req.Auth); err != nil {
+		return nil, err
+	}
+	if req.Plan == "" && (req.Quota == nil || *req.Quota <= 0) {
+		return nil, ErrApiTokenNoQuota
+	}
+	if req.Auth == "-" {
+		req.Auth = ""
+	}
+	if req.Scopes == "-" {
+		req.Scopes = ""
+	}
+	token, err := newApiToken()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().Unix()
+
+	pipe := rdb.UserClient.Pipeline()
+	pipe.HSet(ctx, "apitoken:"+token,
+		"label", req.Label,
+		"owner", req.Owner,
+		"status", model.ApiTokenActive,
+		"auth", req.Auth,
+		"scopes", req.Scopes,
+		"created", now,
+		"updated", now,
+	)
+	pipe.ZAdd(ctx, "apitokens", &redis.Z{Score: float64(now), Member: token})
+	if req.Plan != "" {
+		pipe.Set(ctx, "plan:"+token, req.Plan, 0)
+	}
+	if req.Quota != nil {
+		pipe.Set(ctx, "quota:"+token, *req.Quota, 0)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		logger.Ctx(ctx).Info("create token failed", zap.Error(err))
+		return nil, err
+	}
+	return GetApiToken(ctx, token)
+}
+
+func UpdateApiToken(ctx context.Context, token string, req *model.ApiTokenReq) (tokenRsp *model.ApiTokenResp, err error) {
+	if err := checkApiTokenAuth(req.Auth); err != nil {
+		return nil, err
+	}
+	if _, err := GetApiToken(ctx, token); err != nil {
+		return nil, err
+	}
+
+	pipe := rdb.UserClient.Pipeline()
+	fields := []interface{}{"updated", time.Now().Unix()}
+	if req.Label != "" {
+		fields = append(fields, "label", req.Label)
+	}
+	if req.Owner != "" {
+		fields = append(fields, "owner", req.Owner)
+	}
+	if req.Auth == "-" {
+		fields = append(fields, "auth", "")
+	} else if req.Auth != "" {
+		fields = append(fields, "auth", req.Auth)
+	}
+	if req.Scopes == "-" {
+		fields = append(fields, "scopes", "")
+	} else if req.Scopes != "" {
+		fields = append(fields, "scopes", req.Scopes)
+	}
+	pipe.HSet(ctx, "apitoken:"+token, fields...)
+	if req.Plan == "-" {
+		pipe.Del(ctx, "plan:"+token)
+	} else if req.Plan != "" {
+		pipe.Set(ctx, "plan:"+token, req.Plan, 0)
+	}
+	if req.Quota != nil {
+		pipe.Set(ctx, "quota:"+token, *req.Quota, 0)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		logger.Ctx(ctx).Info("update token failed", zap.Error(err))
+		return nil, err
+	}
+	return GetApiToken(ctx, token)
+}
+
+// SetApiTokenQuota 充值或设置quota总配额，返回修改后的配额
+func SetApiTokenQuota(ctx context.Context, token, op string, amount int64) (quota int64, err error) {
+	if _, err := GetApiToken(ctx, token); err != nil {
+		return 0, err
+	}
+	switch op {
+	case "add":
+		quota, err = rdb.UserClient.IncrBy(ctx, "quota:"+token, amount).Result()
+	case "set":
+		err = rdb.UserClient.Set(ctx, "quota:"+token, amount, 0).Err()
+		quota = amount
+	default:
+		return 0, errors.New("op invalid")
+	}
+	if err != nil {
+		logger.Ctx(ctx).Info("set token quota failed", zap.Error(err))
+		return 0, err
+	}
+	rdb.UserClient.HSet(ctx, "apitoken:"+token, "updated", time.Now().Unix())
+	return quota, nil
+}
+
+// SetApiTokenStatus 暂停/恢复/吊销token，吊销后不可恢复
+func SetApiTokenStatus(ctx context.Context, token, status string) (tokenRsp *model.ApiTokenResp, err error) {
+	tokenRsp, err = GetApiToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if tokenRsp.Status == model.ApiTokenRevoked {
+		return nil, errors.New("token revoked")
+	}
+
+	pipe := rdb.UserClient.Pipeline()
+	pipe.HSet(ctx, "apitoken:"+token, "status", status, "updated", time.Now().Unix())
+	// 旧token可能没有记录，补充到列表中
+	pipe.ZAddNX(ctx, "apitokens", &redis.Z{Score: float64(time.Now().Unix()), Member: token})
+	if status == model.ApiTokenRevoked {
+		pipe.Del(ctx, "quota:"+token, "plan:"+token, "secretkey:"+token, "secretkey:prev:"+token)
+		if appid := tokenRsp.AppId; appid != "" {
+			pipe.Del(ctx, "appid:"+appid, "secretkey:"+appid, "secretkey:prev:"+appid)
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		logger.Ctx(ctx).Info("set token status failed", zap.Error(err))
+		return nil, err
+	}
+	return GetApiToken(ctx, token)
+}
+
+func GetApiToken(ctx context.Context, token string) (tokenRsp *model.ApiTokenResp, err error) {
+	tokens, err := getApiTokens(ctx, []string{token})
+	if err != nil {
+		return nil, err
+	}
+	if tokens[0] == nil {
+		return nil, ErrApiTokenNotExist
+	}
+	return tokens[0], nil
+}
+
+func getApiTokens(ctx context.Context, tokens []string) (tokensRsp []*model.ApiTokenResp, err error) {
+	pipe := rdb.UserClient.Pipeline()
+	infoCmds := make([]*redis.StringStringMapCmd, len(tokens))
+	planCmds := make([]*redis.StringCmd, len(tokens))
+	quotaCmds := make([]*redis.StringCmd, len(tokens))
+	visitCmds := make([]*redis.StringCmd, len(tokens))
+	secretCmds := make([]*redis.IntCmd, len(tokens))
+	for idx, token := range tokens {
+		infoCmds[idx] = pipe.HGetAll(ctx, "apitoken:"+token)
+		planCmds[idx] = pipe.Get(ctx, "plan:"+token)
+		quotaCmds[idx] = pipe.Get(ctx, "quota:"+token)
+		visitCmds[idx] = pipe.Get(ctx, "visit:"+token)
+		secretCmds[idx] = pipe.Exists(ctx, "secretkey:"+token)
+	}
+	if _, err = pipe.Exec(ctx); err != nil && err != redis.Nil {
+		logger.Ctx(ctx).Info("get tokens failed", zap.Error(err))
+		return nil, err
+	}
+
+	tokensRsp = make([]*model.ApiTokenResp, len(tokens))
+	for idx, token := range tokens {
+		info := infoCmds[idx].Val()
+		quota, quotaErr := quotaCmds[idx].Int64()
+		if len(info) == 0 && quotaErr == redis.Nil {
+			continue
+		}
+		tokenRsp := &model.ApiTokenResp{
+			Token:     token,
+			Label:     info["label"],
+			Owner:     info["owner"],
+			Plan:      planCmds[idx].Val(),
+			Status:    info["status"],
+			Auth:      info["auth"],
+			Scopes:    info["scopes"],
+			AppId:     info["appid"],
+			HasSecret: info["appid"] != "" || secretCmds[idx].Val() > 0,
+			Quota:     quota,
+		}
+		if tokenRsp.Status == "" {
+			// 手工创建的旧token
+			tokenRsp.Status = model.ApiTokenActive
+		}
+		tokenRsp.Visit, _ = visitCmds[idx].Int64()
+		tokenRsp.CreatedAt, _ = strconv.ParseInt(info["created"], 10, 64)
+		tokenRsp.UpdatedAt, _ = strconv.ParseInt(info["updated"], 10, 64)
+		tokensRsp[idx] = tokenRsp
+	}
+	return tokensRsp, nil
+}
+
+// ListApiTokens 按创建时间倒序列出token
+func ListApiTokens(ctx context.Context, cursor, size int) (tokensRsp []*model.ApiTokenResp, total int, err error) {
+	n, err := rdb.UserClient.ZCard(ctx, "apitokens").Result()
+	if err != nil {
+		logger.Ctx(ctx).Info("list tokens failed", zap.Error(err))
+		return nil, 0, err
+	}
+	tokens, err := rdb.UserClient.ZRevRange(ctx, "apitokens", int64(cursor), int64(cursor+size-1)).Result()
+	if err != nil {
+		logger.Ctx(ctx).Info("list tokens failed", zap.Error(err))
+		return nil, 0, err
+	}
+
+	result, err := getApiTokens(ctx, tokens)
+	if err != nil {
+		return nil, 0, err
+	}
+	tokensRsp = make([]*model.ApiTokenResp, 0, len(result))
+	for _, tokenRsp := range result {
+		if tokenRsp != nil {
+			tokensRsp = append(tokensRsp, tokenRsp)
+		}
+	}
+	return tokensRsp, int(n), nil
+}
+
+// RotateApiTokenSecret 生成新的HMAC签名密钥，旧密钥在grace时间内仍可用。
+// 首次生成时为token分配单独的appid，签名请求的URL、访问日志和trace中只出现appid。
+// 手工配置的旧密钥secretkey:<token>转为旧密钥，grace后失效
+func RotateApiTokenSecret(ctx context.Context, token string, grace time.Duration) (secretRsp *model.ApiTokenSecretResp, err error) {
+	tokenRsp, err := GetApiToken(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if tokenRsp.Status == model.ApiTokenRevoked {
+		return nil, errors.New("token revoked")
+	}
+
+	buf := make([]byte, 20)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	secret := hex.EncodeToString(buf)
+
+	appid := tokenRsp.AppId
+	if appid == "" {
+		if _, err := rand.Read(buf[:10]); err != nil {
+			return nil, err
+		}
+		appid = hex.EncodeToString(buf[:10])
+	}
+
+	pipe := rdb.UserClient.Pipeline()
+	oldSecretCmd := pipe.Get(ctx, "secretkey:"+appid)
+	legacySecretCmd := pipe.Get(ctx, "secretkey:"+token)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		logger.Ctx(ctx).Info("get secretkey failed", zap.Error(err))
+		return nil, err
+	}
+
+	pipe = rdb.UserClient.Pipeline()
+	if tokenRsp.AppId == "" {
+		pipe.Set(ctx, "appid:"+appid, token, 0)
+		pipe.HSet(ctx, "apitoken:"+token, "appid", appid)
+	}
+	if oldSecret := oldSecretCmd.Val(); oldSecret != "" && grace > 0 {
+		pipe.Set(ctx, "secretkey:prev:"+appid, oldSecret, grace)
+	} else {
+		pipe.Del(ctx, "secretkey:prev:"+appid)
+	}
+	if legacySecret := legacySecretCmd.Val(); legacySecret != "" {
+		pipe.Del(ctx, "secretkey:"+token)
+		if grace > 0 {
+			pipe.Set(ctx, "secretkey:prev:"+token, legacySecret, grace)
+		} else {
+			pipe.Del(ctx, "secretkey:prev:"+token)
+		}
+	}
+	pipe.Set(ctx, "secretkey:"+appid, secret, 0)
+	pipe.HSet(ctx, "apitoken:"+token, "updated", time.Now().Unix())
+	if _, err := pipe.Exec(ctx); err != nil {
+		logger.Ctx(ctx).Info("rotate secretkey failed", zap.Error(err))
+		return nil, err
+	}
+	return &model.ApiTokenSecretResp{AppId: appid, Secret: secret}, nil
+}
+
+// GetApiTokenUsage 按日统计token在[start, end]内的使用量
+func GetApiTokenUsage(ctx context.Context, token string, start, end time.Time) (usageRsp []*model.ApiTokenUsageResp, err error) {
+	var dates []string
+	for day := start.UTC(); !day.After(end); day = day.AddDate(0, 0, 1) {
+		dates = append(dates, day.Format("20060102"))
+	}
+
+	pipe := rdb.UserClient.Pipeline()
+	cmds := make([]*redis.StringStringMapCmd, len(dates))
+	for idx, date := range dates {
+		cmds[idx] = pipe.HGetAll(ctx, "usage:"+token+":"+date)
+	}
+	if _, err = pipe.Exec(ctx); err != nil && err != redis.Nil {
+		logger.Ctx(ctx).Info("get token usage failed", zap.Error(err))
+		return nil, err
+	}
+
+	usageRsp = make([]*model.ApiTokenUsageResp, 0, len(dates))
+	for idx, date := range dates {
+		usage := &model.ApiTokenUsageResp{
+			Date:     date,
+			Patterns: make(map[string]int64),
+		}
+		for field, value := range cmds[idx].Val() {
+			n, _ := strconv.ParseInt(value, 10, 64)
+			switch field {
+			case "_total":
+				usage.Total = n
+			case "_units":
+				usage.Units = n
+			default:
+				usage.Patterns[field] = n
+			}
+		}
+		usageRsp = append(usageRsp, usage)
+	}
+	return usageRsp, nil
+}
+
+//////////////// audit
+// AddAdminAudit 记录管理操作，同时写入日志
+func AddAdminAudit(ctx context.Context, action, token, detail, remoteIP string) {
+	audit := &model.AdminAuditResp{
+		Timestamp: time.Now().Unix(),
+		Action:    action,
+		Token:     token,
+		Detail:    detail,
+		RemoteIP:  remoteIP,
+	}
+	logger.Ctx(ctx).Info("admin audit",
+		zap.String("action", action),
+		zap.String("token", token),
+		zap.String("detail", detail),
+		zap.String("ip", remoteIP),
+	)
+
+	data, _ := json.Marshal(audit)
+	pipe := rdb.UserClient.Pipeline()
+	pipe.LPush(ctx, adminAuditKey, data)
+	pipe.LTrim(ctx, adminAuditKey, 0, adminAuditMaxLen-1)
+	if token != "" {
+		pipe.LPush(ctx, adminAuditKey+":"+token, data)
+		pipe.LTrim(ctx, adminAuditKey+":"+token, 0, adminAuditTokenMaxLen-1)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		logger.Ctx(ctx).Info("add admin audit failed", zap.Error(err))
+	}
+}
+
+// ListAdminAudit 按时间倒序列出管理操作记录，token不为空时从该token的列表中读取
+func ListAdminAudit(ctx context.Context, cursor, size int, token string) (auditsRsp []*model.AdminAuditResp, err error) {
+	key := adminAuditKey
+	if token != "" {
+		key = adminAuditKey + ":" + token
+	}
+	items, err := rdb.UserClient.LRange(ctx, key, int64(cursor), int64(cursor+size-1)).Result()
+	if err != nil {
+		logger.Ctx(ctx).Info("list admin audit failed", zap.Error(err))
+		return nil, err
+	}
+	auditsRsp = make([]*model.AdminAuditResp, 0, len(items))
+	for _, item := range items {
+		audit := &model.AdminAuditResp{}
+		if err := json.Unmarshal([]byte(item), audit); err != nil {
+			continue
+		}
+		auditsRsp = append(auditsRsp, audit)
+	}
+	return auditsRsp, nil
+}
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"database/sql"
 	"encoding/hex"
 	"errors"
@@ -39,7 +40,7 @@ func blockResultSRF(rows *sql.Rows) (interface{}, error) {
 	return &ret, nil
 }
 
-func GetTokenVolumesInBlocksByHeightRange(blkStartHeight, blkEndHeight int, codeHashHex, genesisHex string, codeType uint32, nftIdx int) (blksRsp []*model.BlockTokenVolumeResp, err error) {
+func GetTokenVolumesInBlocksByHeightRange(ctx context.Context, blkStartHeight, blkEndHeight int, codeHashHex, genesisHex string, codeType uint32, nftIdx int) (blksRsp []*model.BlockTokenVolumeResp, err error) {
 	psql := fmt.Sprintf(`
 SELECT %s FROM blk_codehash_height
 WHERE height >= %d AND height < %d AND
@@ -51,9 +52,9 @@ ORDER BY height ASC
 LIMIT %d`,
 		SQL_FIELEDS_BLOCK_VOLUME, blkStartHeight, blkEndHeight, codeHashHex, genesisHex, codeType, nftIdx, blkEndHeight-blkStartHeight)
 
-	blksRet, err := clickhouse.ScanAll(psql, blockTokenVolumeResultSRF)
+	blksRet, err := clickhouse.ScanAll(ctx, psql, blockTokenVolumeResultSRF)
 	if err != nil {
-		logger.Log.Info("query blk failed", zap.Error(err))
+		logger.Ctx(ctx).Info("query blk failed", zap.Error(err))
 		return nil, err
 	}
 	if blksRet == nil {
@@ -79,7 +80,7 @@ LIMIT %d`,
 }
 
 ////////////////////////////////////////////////////////////////
-func GetBlocksByHeightRange(blkStartHeight, blkEndHeight int) (blksRsp []*model.BlockInfoResp, err error) {
+func GetBlocksByHeightRange(ctx context.Context, blkStartHeight, blkEndHeight int) (blksRsp []*model.BlockInfoResp, err error) {
 	psql := fmt.Sprintf(`
 SELECT %s FROM blk_height
 LEFT JOIN (
@@ -94,9 +95,9 @@ LIMIT %d
 		SQL_FIELEDS_BLOCK, blkStartHeight, blkEndHeight, blkEndHeight-blkStartHeight,
 		blkStartHeight, blkEndHeight, blkEndHeight-blkStartHeight)
 
-	blksRet, err := clickhouse.ScanAll(psql, blockResultSRF)
+	blksRet, err := clickhouse.ScanAll(ctx, psql, blockResultSRF)
 	if err != nil {
-		logger.Log.Info("query blk failed", zap.Error(err))
+		logger.Ctx(ctx).Info("query blk failed", zap.Error(err))
 		return nil, err
 	}
 	if blksRet == nil {
@@ -124,7 +125,7 @@ LIMIT %d
 
 }
 
-func GetBlockByHeight(blkHeight int) (blk *model.BlockInfoResp, err error) {
+func GetBlockByHeight(ctx context.Context, blkHeight int) (blk *model.BlockInfoResp, err error) {
 	psql := fmt.Sprintf(`
 SELECT %s FROM blk_height
 LEFT JOIN (
@@ -135,10 +136,10 @@ LEFT JOIN (
 ON blk_height.blkid = next_blk.previd
 WHERE height = %d ORDER BY height ASC
 LIMIT 1`, SQL_FIELEDS_BLOCK, blkHeight, blkHeight)
-	return GetBlockBySql(psql)
+	return GetBlockBySql(ctx, psql)
 }
 
-func GetBlockById(blkidHex string) (blk *model.BlockInfoResp, err error) {
+func GetBlockById(ctx context.Context, blkidHex string) (blk *model.BlockInfoResp, err error) {
 	psql := fmt.Sprintf(`SELECT %s FROM blk
 LEFT JOIN (
     SELECT blkid, previd FROM blk_height
@@ -151,18 +152,18 @@ LEFT JOIN (
 ON blk.blkid = next_blk.previd
 WHERE blkid = unhex('%s')
 LIMIT 1`, SQL_FIELEDS_BLOCK, blkidHex, blkidHex)
-	return GetBlockBySql(psql)
+	return GetBlockBySql(ctx, psql)
 }
 
-func GetBestBlockByHeight(blkHeight int) (blk *model.BlockInfoResp, err error) {
+func GetBestBlockByHeight(ctx context.Context, blkHeight int) (blk *model.BlockInfoResp, err error) {
 	psql := fmt.Sprintf("SELECT %s FROM blk_height WHERE height = %d LIMIT 1", SQL_FIELEDS_BEST_BLOCK, blkHeight)
-	return GetBlockBySql(psql)
+	return GetBlockBySql(ctx, psql)
 }
 
-func GetBlockBySql(psql string) (blk *model.BlockInfoResp, err error) {
-	blkRet, err := clickhouse.ScanOne(psql, blockResultSRF)
+func GetBlockBySql(ctx context.Context, psql string) (blk *model.BlockInfoResp, err error) {
+	blkRet, err := clickhouse.ScanOne(ctx, psql, blockResultSRF)
 	if err != nil {
-		logger.Log.Info("query blk failed", zap.Error(err))
+		logger.Ctx(ctx).Info("query blk failed", zap.Error(err))
 		return nil, err
 	}
 	if blkRet == nil {
@@ -196,12 +197,12 @@ func mempoolResultSRF(rows *sql.Rows) (interface{}, error) {
 	return ret, nil
 }
 
-func GetMempoolTxCount() (count int, err error) {
+func GetMempoolTxCount(ctx context.Context) (count int, err error) {
 	psql := "SELECT count(1) FROM blktx_height WHERE height >= 4294967295"
 
-	blkRet, err := clickhouse.ScanOne(psql, mempoolResultSRF)
+	blkRet, err := clickhouse.ScanOne(ctx, psql, mempoolResultSRF)
 	if err != nil {
-		logger.Log.Info("query blk failed", zap.Error(err))
+		logger.Ctx(ctx).Info("query blk failed", zap.Error(err))
 		return 0, err
 	}
 	if blkRet == nil {
@@ -212,16 +213,16 @@ func GetMempoolTxCount() (count int, err error) {
 	return mempoolTxCount, nil
 }
 
-func GetBlockMedianTimePast(height int) (mtp int, err error) {
+func GetBlockMedianTimePast(ctx context.Context, height int) (mtp int, err error) {
 	psql := fmt.Sprintf(`
 SELECT toUInt32(quantileExact(blocktime)) FROM (
     SELECT blocktime FROM blk_height WHERE height > %d AND height <= %d
 )
 `, height-11, height)
 
-	blkRet, err := clickhouse.ScanOne(psql, mempoolResultSRF)
+	blkRet, err := clickhouse.ScanOne(ctx, psql, mempoolResultSRF)
 	if err != nil {
-		logger.Log.Info("query mtp failed", zap.Error(err))
+		logger.Ctx(ctx).Info("query mtp failed", zap.Error(err))
 		return 0, err
 	}
 	if blkRet == nil {
@@ -233,14 +234,14 @@ SELECT toUInt32(quantileExact(blocktime)) FROM (
 }
 
 ////////////////
-func GetBestBlockHeight() (height int, err error) {
+func GetBestBlockHeight(ctx context.Context) (height int, err error) {
 	// get decimal from f info
 	height, err = rdb.BizClient.HGet(ctx, "info", "blocks_total").Int()
 	if err == redis.Nil {
 		height = 0
-		logger.Log.Info("GetBestBlockHeight, but info missing")
+		logger.Ctx(ctx).Info("GetBestBlockHeight, but info missing")
 	} else if err != nil {
-		logger.Log.Info("GetBestBlockHeight, but redis failed", zap.Error(err))
+		logger.Ctx(ctx).Info("GetBestBlockHeight, but redis failed", zap.Error(err))
 		return
 	}
 
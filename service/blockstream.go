@@ -0,0 +1,374 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sensiblequery/dao/clickhouse"
+	"sensiblequery/lib/blkparser"
+	"sensiblequery/lib/chaintip"
+	"sensiblequery/lib/metrics"
+	"sensiblequery/logger"
+	"sensiblequery/model"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// 检查新区块的间隔
+	blockStreamPollInterval = time.Second
+	// 每次重新读取的最高区块数，用于发现最近的重组
+	blockStreamCheckDepth = 6
+	// 保留用于查找分叉点的区块数
+	blockStreamKeep = 100
+	// 每次最多连接的新区块数，索引追赶时分批推送
+	blockStreamBatch = 100
+	// 每个连接待发送的事件数，超过时关闭连接
+	blockSubscriberBuffer = 256
+	// MaxBlockBackfill 续传时最多补发的区块数
+	MaxBlockBackfill = 1000
+)
+
+// BlockSubscriber 一个连接的区块订阅。C在推送过慢或服务退出时关闭，原因见Reason
+type BlockSubscriber struct {
+	C chan *model.BlockEventResp
+
+	closed bool
+	reason string
+}
+
+// 所有区块订阅，BlockSubscriber的状态也由mu保护
+var blockHub = struct {
+	mu     sync.Mutex
+	subs   map[*BlockSubscriber]bool
+	tip    int // 已推送的最高区块，尚未检查时为-1
+	closed bool
+}{subs: map[*BlockSubscriber]bool{}, tip: -1}
+
+// indexTipId 区块推送最近检测到的已索引最高区块id
+var indexTipId atomic.Value // string
+
+// IndexTipId 已索引最高区块的id，尚未检测到时为空
+func IndexTipId() string {
+	tipId, _ := indexTipId.Load().(string)
+	return tipId
+}
+
+// SubscribeBlocks 订阅区块事件，返回订阅时已推送的最高区块高度，续传时补发到该高度
+func SubscribeBlocks() (*BlockSubscriber, int, error) {
+	blockHub.mu.Lock()
+	defer blockHub.mu.Unlock()
+	if blockHub.closed {
+		return nil, -1, ErrSubscriberClosed
+	}
+	s := &BlockSubscriber{C: make(chan *model.BlockEventResp, blockSubscriberBuffer)}
+	blockHub.subs[s] = true
+	return s, blockHub.tip, nil
+}
+
+// Reason C关闭的原因
+func (s *BlockSubscriber) Reason() string {
+	blockHub.mu.Lock()
+	defer blockHub.mu.Unlock()
+	return s.reason
+}
+
+// Close 取消订阅并关闭C
+func (s *BlockSubscriber) Close() {
+	blockHub.mu.Lock()
+	defer blockHub.mu.Unlock()
+	s.closeLocked("closed")
+}
+
+func (s *BlockSubscriber) closeLocked(reason string) {
+	if s.closed {
+		return
+	}
+	delete(blockHub.subs, s)
+	s.closed = true
+	s.reason = reason
+	close(s.C)
+}
+
+func (s *BlockSubscriber) sendLocked(event *model.BlockEventResp) {
+	if s.closed {
+		return
+	}
+	select {
+	case s.C <- event:
+	default:
+		logger.Log.Info("block subscriber too slow, closed")
+		s.closeLocked("too slow")
+	}
+}
+
+func closeBlockSubscribers() {
+	blockHub.mu.Lock()
+	defer blockHub.mu.Unlock()
+	blockHub.closed = true
+	for s := range blockHub.subs {
+		s.closeLocked("shutting down")
+	}
+}
+
+func blockBriefResultSRF(rows *sql.Rows) (interface{}, error) {
+	var ret model.BlockDO
+	err := rows.Scan(&ret.Height, &ret.BlockId, &ret.PrevBlockId, &ret.TxCount, &ret.BlockTime)
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+type blockSensibleTxDO struct {
+	Height uint32
+	Count  uint64
+}
+
+func blockSensibleTxResultSRF(rows *sql.Rows) (interface{}, error) {
+	var ret blockSensibleTxDO
+	err := rows.Scan(&ret.Height, &ret.Count)
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// getChainBlocks 读取[start, end]高度的区块，不含sensible交易数
+func getChainBlocks(ctx context.Context, start, end int) (blksRsp []*model.BlockBriefResp, err error) {
+	if start < 0 {
+		start = 0
+	}
+	if end < start {
+		return nil, nil
+	}
+	psql := fmt.Sprintf(`
+SELECT height, blkid, previd, ntx, blocktime FROM blk_height
+WHERE height >= %d AND height <= %d
+ORDER BY height ASC
+LIMIT %d`, start, end, end-start+1)
+
+	blksRet, err := clickhouse.ScanAll(ctx, psql, blockBriefResultSRF)
+	if err != nil {
+		logger.Ctx(ctx).Info("query blk failed", zap.Error(err))
+		return nil, err
+	}
+	if blksRet == nil {
+		return nil, nil
+	}
+	for _, block := range blksRet.([]*model.BlockDO) {
+		blksRsp = append(blksRsp, &model.BlockBriefResp{
+			Height:         int(block.Height),
+			BlockIdHex:     blkparser.HashString(block.BlockId),
+			PrevBlockIdHex: blkparser.HashString(block.PrevBlockId),
+			TxCount:        int(block.TxCount),
+			BlockTime:      int(block.BlockTime),
+		})
+	}
+	return blksRsp, nil
+}
+
+// fillSensibleTxCount 统计区块内输入或输出包含合约的交易数
+func fillSensibleTxCount(ctx context.Context, blocks []*model.BlockBriefResp) error {
+	if len(blocks) == 0 {
+		return nil
+	}
+	start, end := blocks[0].Height, blocks[len(blocks)-1].Height
+	psql := fmt.Sprintf(`
+SELECT height, uniqExact(txidx) FROM (
+    SELECT height, utxidx AS txidx FROM txout_genesis_height
+    WHERE height >= %d AND height <= %d AND codehash != ''
+    UNION ALL
+    SELECT height, txidx FROM txin_genesis_height
+    WHERE height >= %d AND height <= %d AND codehash != ''
+)
+GROUP BY height`, start, end, start, end)
+
+	countsRet, err := clickhouse.ScanAll(ctx, psql, blockSensibleTxResultSRF)
+	if err != nil {
+		logger.Ctx(ctx).Info("query blk sensible tx failed", zap.Error(err))
+		return err
+	}
+	if countsRet == nil {
+		return nil
+	}
+	counts := map[int]int{}
+	for _, count := range countsRet.([]*blockSensibleTxDO) {
+		counts[int(count.Height)] = int(count.Count)
+	}
+	for _, blk := range blocks {
+		blk.SensibleTxCount = counts[blk.Height]
+	}
+	return nil
+}
+
+// GetBlockBriefs 读取[start, end]高度的区块及sensible交易数，用于续传
+func GetBlockBriefs(ctx context.Context, start, end int) ([]*model.BlockBriefResp, error) {
+	blocks, err := getChainBlocks(ctx, start, end)
+	if err != nil {
+		return nil, err
+	}
+	if err := fillSensibleTxCount(ctx, blocks); err != nil {
+		return nil, err
+	}
+	return blocks, nil
+}
+
+func toChain(blocks []*model.BlockBriefResp) (window []*chaintip.Block) {
+	for _, blk := range blocks {
+		window = append(window, &chaintip.Block{Height: blk.Height, Id: blk.BlockIdHex, PrevId: blk.PrevBlockIdHex})
+	}
+	return window
+}
+
+func blockRange(blocks []*chaintip.Block) *model.BlockRangeResp {
+	r := &model.BlockRangeResp{Start: blocks[0].Height, End: blocks[len(blocks)-1].Height}
+	for _, blk := range blocks {
+		r.BlockIdsHex = append(r.BlockIdsHex, blk.Id)
+	}
+	return r
+}
+
+// 节点通知新区块时不等待下次轮询
+var blockStreamWake = make(chan struct{}, 1)
+
+func wakeBlockStream() {
+	select {
+	case blockStreamWake <- struct{}{}:
+	default:
+	}
+}
+
+// publishNodeBlock 推送节点收到的新区块，不改变已推送的最高区块
+func publishNodeBlock(blk *model.NodeBlockResp) {
+	event := &model.BlockEventResp{Type: model.EventNodeBlock, NodeBlock: blk}
+	blockHub.mu.Lock()
+	defer blockHub.mu.Unlock()
+	metrics.BlockStreamEvents.WithLabelValues(event.Type).Inc()
+	for s := range blockHub.subs {
+		s.sendLocked(event)
+	}
+}
+
+// StartBlockStream 定期检查新区块及重组并推送，直到ctx结束
+func StartBlockStream(ctx context.Context, onTip func(blkIdHex string)) {
+	go func() {
+		tracker := chaintip.New(blockStreamKeep)
+		ticker := time.NewTicker(blockStreamPollInterval)
+		defer ticker.Stop()
+		var tipId string
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-blockStreamWake:
+			}
+			if err := pollBlocks(ctx, tracker); err != nil {
+				logger.Ctx(ctx).Info("block stream poll failed", zap.Error(err))
+			}
+			if tip := tracker.Tip(); tip != nil && tip.Id != tipId {
+				tipId = tip.Id
+				indexTipId.Store(tipId)
+				if onTip != nil {
+					onTip(tipId)
+				}
+			}
+		}
+	}()
+}
+
+func pollBlocks(ctx context.Context, tracker *chaintip.Tracker) error {
+	best, err := GetBestBlockHeight(ctx)
+	if err != nil {
+		return err
+	}
+	base, end := best, best
+	if tip := tracker.Tip(); tip != nil {
+		if tip.Height < base {
+			base = tip.Height
+		}
+		if end > tip.Height+blockStreamBatch {
+			end = tip.Height + blockStreamBatch
+		}
+	}
+	blocks, err := getChainBlocks(ctx, base-blockStreamCheckDepth+1, end)
+	if err != nil {
+		return err
+	}
+	disconnected, connected, err := tracker.Update(toChain(blocks))
+	if err == chaintip.ErrForkTooDeep {
+		// 从保留的最低区块重新读取查找分叉点
+		blocks, err = getChainBlocks(ctx, tracker.Lowest().Height, end)
+		if err != nil {
+			return err
+		}
+		disconnected, connected, err = tracker.Update(toChain(blocks))
+		if err == chaintip.ErrForkTooDeep {
+			logger.Ctx(ctx).Warn("block stream fork deeper than kept blocks, reset",
+				zap.Int("lowest", tracker.Lowest().Height),
+				zap.Int("best", best),
+			)
+			err = tracker.Reset(toChain(blocks))
+		}
+	}
+	if err != nil {
+		// 索引写入中previd暂不连续，下次再检查
+		return err
+	}
+
+	if len(connected) == 0 {
+		// 首次检查或重置后记录最高区块，不推送
+		if tip := tracker.Tip(); tip != nil {
+			blockHub.mu.Lock()
+			blockHub.tip = tip.Height
+			blockHub.mu.Unlock()
+		}
+		return nil
+	}
+
+	var newBlocks []*model.BlockBriefResp
+	for _, blk := range blocks {
+		if blk.Height >= connected[0].Height {
+			newBlocks = append(newBlocks, blk)
+		}
+	}
+	if err := fillSensibleTxCount(ctx, newBlocks); err != nil {
+		logger.Ctx(ctx).Info("block stream sensible tx count failed", zap.Error(err))
+	}
+
+	var events []*model.BlockEventResp
+	if len(disconnected) > 0 {
+		logger.Ctx(ctx).Warn("block reorg",
+			zap.Int("fork", connected[0].Height-1),
+			zap.Int("disconnected", len(disconnected)),
+			zap.Int("connected", len(connected)),
+		)
+		metrics.BlockReorgDepth.Observe(float64(len(disconnected)))
+		events = append(events, &model.BlockEventResp{
+			Type: model.EventReorg,
+			Reorg: &model.ReorgResp{
+				ForkHeight:   connected[0].Height - 1,
+				Disconnected: blockRange(disconnected),
+				Connected:    blockRange(connected),
+			},
+		})
+	}
+	for _, blk := range newBlocks {
+		events = append(events, &model.BlockEventResp{Type: model.EventBlock, Block: blk})
+	}
+
+	blockHub.mu.Lock()
+	defer blockHub.mu.Unlock()
+	blockHub.tip = tracker.Tip().Height
+	for _, event := range events {
+		metrics.BlockStreamEvents.WithLabelValues(event.Type).Inc()
+		for s := range blockHub.subs {
+			s.sendLocked(event)
+		}
+	}
+	return nil
+}
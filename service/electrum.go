@@ -0,0 +1,753 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"sensiblequery/dao/clickhouse"
+	"sensiblequery/dao/rdb"
+	"sensiblequery/lib/blkparser"
+	"sensiblequery/lib/electrum"
+	"sensiblequery/lib/metrics"
+	"sensiblequery/lib/paging"
+	"sensiblequery/lib/utxoset"
+	"sensiblequery/logger"
+	"sensiblequery/model"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	redis "github.com/go-redis/redis/v8"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// Electrum协议的scripthash是锁定脚本的sha256，无法反推地址，由后台任务按区块建立索引，
+// 写入地址历史所在的pika:
+//
+//	{sh<sha256>}   P2PKH脚本对应的地址pkh，查询时使用地址的utxo集合及{ah}历史
+//	{sho<sha256>}  其他非合约脚本的输出outpoint集合，分数为输出所在高度，查询时由txout/txin_spent计算
+//
+// user redis中:
+//
+//	electrum:index:height  下一个待索引的区块高度
+//	electrum:index:lock    索引锁，多个实例中只有持有者建立索引
+const (
+	electrumIndexHeightKey = "electrum:index:height"
+	electrumIndexLockKey   = "electrum:index:lock"
+	electrumIndexLockTTL   = 30 * time.Second
+	// 每次写入pika的命令数
+	electrumIndexPipeline = 1000
+	// 每次按(height, txidx)或outpoint查询ClickHouse的数量
+	electrumQueryBatch = 500
+	// mempool中已索引的脚本超过该数量时清空重新记录
+	electrumMempoolSeenMax = 1000000
+	p2pkhScriptTypeHex     = "76a91488ac"
+)
+
+var ErrHistoryTooLarge = errors.New("history too large")
+
+// ElectrumConf Electrum协议服务配置，见conf/electrum.yaml
+var ElectrumConf = struct {
+	Enabled          bool
+	IndexStart       int           // 没有索引记录时的起始高度
+	IndexBlocks      int           // 每次索引的区块数
+	Poll             time.Duration // 索引新区块、mempool及检查未知scripthash的间隔
+	MaxHistory       int           // 单个scripthash最多返回的历史及utxo数
+	MaxSubscriptions int           // 每个连接最多订阅的scripthash数
+	MaxHeaders       int           // blockchain.block.headers单次最多返回的区块头数
+	MaxMessage       int           // 单条请求的最大字节数
+	IdleTimeout      time.Duration // 连接无请求时的超时
+	TcpMaxSessions   int           // TCP端口最多同时连接数
+	TcpMaxPerIp      int           // TCP端口每个IP最多同时连接数
+	RelayFee         float64       // blockchain.relayfee及estimatefee返回的费率，BSV/kB
+	Banner           string
+}{
+	IndexBlocks:      100,
+	Poll:             5 * time.Second,
+	MaxHistory:       10000,
+	MaxSubscriptions: 1000,
+	MaxHeaders:       2016,
+	MaxMessage:       1024 * 1024,
+	IdleTimeout:      10 * time.Minute,
+	TcpMaxSessions:   256,
+	TcpMaxPerIp:      4,
+	RelayFee:         0.0000005,
+	Banner:           "sensiblequery electrum server",
+}
+
+func init() {
+	initElectrum("conf/electrum.yaml")
+}
+
+// initElectrum 读取可选的Electrum协议服务配置
+func initElectrum(filename string) {
+	if _, err := os.Stat(filename); err != nil {
+		return
+	}
+	v := viper.New()
+	v.SetConfigFile(filename)
+	if err := v.ReadInConfig(); err != nil {
+		panic(fmt.Errorf("Fatal error config file: %s \n", err))
+	}
+	v.SetDefault("index_start", ElectrumConf.IndexStart)
+	v.SetDefault("index_blocks", ElectrumConf.IndexBlocks)
+	v.SetDefault("poll", ElectrumConf.Poll)
+	v.SetDefault("max_history", ElectrumConf.MaxHistory)
+	v.SetDefault("max_subscriptions", ElectrumConf.MaxSubscriptions)
+	v.SetDefault("max_headers", ElectrumConf.MaxHeaders)
+	v.SetDefault("max_message", ElectrumConf.MaxMessage)
+	v.SetDefault("idle_timeout", ElectrumConf.IdleTimeout)
+	v.SetDefault("tcp_max_sessions", ElectrumConf.TcpMaxSessions)
+	v.SetDefault("tcp_max_per_ip", ElectrumConf.TcpMaxPerIp)
+	v.SetDefault("relay_fee", ElectrumConf.RelayFee)
+	v.SetDefault("banner", ElectrumConf.Banner)
+	ElectrumConf.Enabled = v.GetBool("enabled")
+	ElectrumConf.IndexStart = v.GetInt("index_start")
+	ElectrumConf.IndexBlocks = v.GetInt("index_blocks")
+	ElectrumConf.Poll = v.GetDuration("poll")
+	ElectrumConf.MaxHistory = v.GetInt("max_history")
+	ElectrumConf.MaxSubscriptions = v.GetInt("max_subscriptions")
+	ElectrumConf.MaxHeaders = v.GetInt("max_headers")
+	ElectrumConf.MaxMessage = v.GetInt("max_message")
+	ElectrumConf.IdleTimeout = v.GetDuration("idle_timeout")
+	ElectrumConf.TcpMaxSessions = v.GetInt("tcp_max_sessions")
+	ElectrumConf.TcpMaxPerIp = v.GetInt("tcp_max_per_ip")
+	ElectrumConf.RelayFee = v.GetFloat64("relay_fee")
+	ElectrumConf.Banner = v.GetString("banner")
+	if ElectrumConf.IndexStart < 0 || ElectrumConf.IndexBlocks < 1 || ElectrumConf.Poll <= 0 ||
+		ElectrumConf.MaxHistory < 1 || ElectrumConf.MaxSubscriptions < 1 || ElectrumConf.MaxHeaders < 1 ||
+		ElectrumConf.MaxMessage < 1 || ElectrumConf.IdleTimeout <= 0 || ElectrumConf.RelayFee < 0 ||
+		ElectrumConf.TcpMaxSessions < 1 || ElectrumConf.TcpMaxPerIp < 1 {
+		panic(fmt.Errorf("Fatal error config file: %s: values must be positive \n", filename))
+	}
+}
+
+func scriptDigest(script []byte) string {
+	digest := sha256.Sum256(script)
+	return string(digest[:])
+}
+
+func electrumAddressResultSRF(rows *sql.Rows) (interface{}, error) {
+	var ret []byte
+	err := rows.Scan(&ret)
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+type electrumScriptOutDO struct {
+	UTxId    []byte
+	Vout     uint32
+	Height   uint32
+	ScriptPk []byte
+}
+
+func electrumScriptOutResultSRF(rows *sql.Rows) (interface{}, error) {
+	var ret electrumScriptOutDO
+	err := rows.Scan(&ret.UTxId, &ret.Vout, &ret.Height, &ret.ScriptPk)
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// indexScriptHashes 索引heightMatch范围内输出的脚本。seen不为空时跳过已写入的，用于重复索引mempool
+func indexScriptHashes(ctx context.Context, heightMatch string, seen map[string]bool) (err error) {
+	psql := fmt.Sprintf(`
+SELECT DISTINCT address FROM txout
+WHERE %s AND script_type = unhex('%s')`, heightMatch, p2pkhScriptTypeHex)
+	addressesRet, err := clickhouse.ScanAll(ctx, psql, electrumAddressResultSRF)
+	if err != nil {
+		logger.Ctx(ctx).Info("query electrum index addresses failed", zap.Error(err))
+		return err
+	}
+
+	psql = fmt.Sprintf(`
+SELECT utxid, vout, height, script_pk FROM txout
+WHERE %s AND codehash = '' AND script_type != unhex('%s') AND satoshi > 0`, heightMatch, p2pkhScriptTypeHex)
+	outsRet, err := clickhouse.ScanAll(ctx, psql, electrumScriptOutResultSRF)
+	if err != nil {
+		logger.Ctx(ctx).Info("query electrum index outputs failed", zap.Error(err))
+		return err
+	}
+
+	pipe := rdb.RdbAddressClient.Pipeline()
+	var written []string
+	queued := 0
+	flush := func(force bool) error {
+		if queued == 0 || (!force && queued < electrumIndexPipeline) {
+			return nil
+		}
+		queued = 0
+		if _, err := pipe.Exec(ctx); err != nil {
+			return err
+		}
+		for _, key := range written {
+			seen[key] = true
+		}
+		written = written[:0]
+		return nil
+	}
+
+	if addressesRet != nil {
+		for _, addressPkh := range addressesRet.([][]byte) {
+			key := "{sh" + scriptDigest(electrum.P2PKHScript(addressPkh)) + "}"
+			if seen[key] {
+				continue
+			}
+			pipe.Set(ctx, key, addressPkh, 0)
+			queued++
+			if seen != nil {
+				written = append(written, key)
+			}
+			if err := flush(false); err != nil {
+				return err
+			}
+		}
+	}
+	if outsRet != nil {
+		for _, out := range outsRet.([]*electrumScriptOutDO) {
+			key := "{sho" + scriptDigest(out.ScriptPk) + "}"
+			outpoint := utxoset.Outpoint(out.UTxId, out.Vout)
+			if seen[key+outpoint] {
+				continue
+			}
+			pipe.ZAdd(ctx, key, &redis.Z{Score: float64(out.Height), Member: outpoint})
+			queued++
+			if seen != nil {
+				written = append(written, key+outpoint)
+			}
+			if err := flush(false); err != nil {
+				return err
+			}
+		}
+	}
+	return flush(true)
+}
+
+// indexScriptHashesOnce 索引一批新区块，已追上最高区块时索引mempool，返回是否还有未索引的区块
+func indexScriptHashesOnce(ctx context.Context, mempoolSeen map[string]bool) (more bool, err error) {
+	best, err := GetBestBlockHeight(ctx)
+	if err != nil {
+		return false, err
+	}
+	next, err := rdb.UserClient.Get(ctx, electrumIndexHeightKey).Int()
+	if err == redis.Nil {
+		next = ElectrumConf.IndexStart
+	} else if err != nil {
+		return false, err
+	}
+
+	if next <= best {
+		end := next + ElectrumConf.IndexBlocks
+		if end > best+1 {
+			end = best + 1
+		}
+		if err := indexScriptHashes(ctx, fmt.Sprintf("height >= %d AND height < %d", next, end), nil); err != nil {
+			return false, err
+		}
+		if err := rdb.UserClient.Set(ctx, electrumIndexHeightKey, end, 0).Err(); err != nil {
+			return false, err
+		}
+		metrics.ElectrumIndexHeight.Set(float64(end - 1))
+		// 新区块确认后mempool重新记录
+		for key := range mempoolSeen {
+			delete(mempoolSeen, key)
+		}
+		if end <= best {
+			return true, nil
+		}
+	}
+
+	if len(mempoolSeen) > electrumMempoolSeenMax {
+		for key := range mempoolSeen {
+			delete(mempoolSeen, key)
+		}
+	}
+	return false, indexScriptHashes(ctx, fmt.Sprintf("height = %d", utxoset.MempoolHeight), mempoolSeen)
+}
+
+// StartScriptHashIndex 启用Electrum协议服务时，持续为新区块及mempool建立scripthash索引，直到ctx结束
+func StartScriptHashIndex(ctx context.Context) {
+	if !ElectrumConf.Enabled {
+		return
+	}
+	go func() {
+		owner := lockOwner()
+		defer releaseLock(electrumIndexLockKey, owner)
+		mempoolSeen := map[string]bool{}
+		for {
+			more := false
+			held, err := holdLock(ctx, electrumIndexLockKey, owner, electrumIndexLockTTL)
+			if err == nil && held {
+				more, err = indexScriptHashesOnce(ctx, mempoolSeen)
+			}
+			if err != nil && ctx.Err() == nil {
+				metrics.ElectrumIndexErrors.Inc()
+				logger.Log.Info("electrum index failed", zap.Error(err))
+			}
+			if more && err == nil {
+				if ctx.Err() != nil {
+					return
+				}
+				continue
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(ElectrumConf.Poll):
+			}
+		}
+	}()
+}
+
+// GetScriptHashAddress P2PKH脚本的scripthash对应的地址，未索引或不是P2PKH时返回nil
+func GetScriptHashAddress(ctx context.Context, digest []byte) (addressPkh []byte, err error) {
+	addressPkh, err = rdb.RdbAddressClient.Get(ctx, "{sh"+string(digest)+"}").Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	} else if err != nil {
+		logger.Ctx(ctx).Info("get scripthash address failed", zap.Error(err))
+		return nil, err
+	}
+	return addressPkh, nil
+}
+
+type electrumTxDO struct {
+	Height uint32
+	TxIdx  uint64
+	TxId   []byte
+}
+
+func electrumTxResultSRF(rows *sql.Rows) (interface{}, error) {
+	var ret electrumTxDO
+	err := rows.Scan(&ret.Height, &ret.TxIdx, &ret.TxId)
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+func queryElectrumTxs(ctx context.Context, psql string) ([]*electrumTxDO, error) {
+	txsRet, err := clickhouse.ScanAll(ctx, psql, electrumTxResultSRF)
+	if err != nil {
+		logger.Ctx(ctx).Info("query electrum txs failed", zap.Error(err))
+		return nil, err
+	}
+	if txsRet == nil {
+		return nil, nil
+	}
+	return txsRet.([]*electrumTxDO), nil
+}
+
+// electrumHistory 按区块内顺序排列、去重，mempool在后，mempool的高度为0
+func electrumHistory(txs []*electrumTxDO) (history []*electrum.HistoryItem) {
+	sort.Slice(txs, func(i, j int) bool {
+		if txs[i].Height != txs[j].Height {
+			return txs[i].Height < txs[j].Height
+		}
+		return txs[i].TxIdx < txs[j].TxIdx
+	})
+	history = []*electrum.HistoryItem{}
+	seen := map[string]bool{}
+	for _, tx := range txs {
+		if seen[string(tx.TxId)] {
+			continue
+		}
+		seen[string(tx.TxId)] = true
+		height := int(tx.Height)
+		if tx.Height == utxoset.MempoolHeight {
+			height = 0
+		}
+		history = append(history, &electrum.HistoryItem{TxHash: blkparser.HashString(tx.TxId), Height: height})
+	}
+	return history
+}
+
+// GetAddressElectrumHistory P2PKH地址的历史，已确认的来自{ah}，mempool中的来自txout/txin
+func GetAddressElectrumHistory(ctx context.Context, addressPkh []byte) ([]*electrum.HistoryItem, error) {
+	key := "{ah" + string(addressPkh) + "}"
+	total, err := rdb.RdbAddressClient.ZCard(ctx, key).Result()
+	if err != nil {
+		logger.Ctx(ctx).Info("get address history count failed", zap.Error(err))
+		return nil, err
+	}
+	if int(total) > ElectrumConf.MaxHistory {
+		return nil, ErrHistoryTooLarge
+	}
+	positions, err := rdb.RdbAddressClient.ZRange(ctx, key, 0, -1).Result()
+	if err != nil {
+		logger.Ctx(ctx).Info("get address history failed", zap.Error(err))
+		return nil, err
+	}
+
+	var txs []*electrumTxDO
+	for start := 0; start < len(positions); start += electrumQueryBatch {
+		end := start + electrumQueryBatch
+		if end > len(positions) {
+			end = len(positions)
+		}
+		blkStartHeight, blkEndHeight := -1, 0
+		var pairs []string
+		for _, position := range positions[start:end] {
+			sep := strings.Index(position, ":")
+			if sep < 0 {
+				continue
+			}
+			height, _ := strconv.Atoi(position[:sep])
+			txidx, _ := strconv.Atoi(position[sep+1:])
+			if height >= utxoset.MempoolHeight {
+				continue
+			}
+			if blkStartHeight < 0 || height < blkStartHeight {
+				blkStartHeight = height
+			}
+			if height > blkEndHeight {
+				blkEndHeight = height
+			}
+			pairs = append(pairs, fmt.Sprintf("(%d,%d)", height, txidx))
+		}
+		if len(pairs) == 0 {
+			continue
+		}
+		psql := fmt.Sprintf(`
+SELECT height, txidx, txid FROM blktx_height
+WHERE height >= %d AND height <= %d AND (height, txidx) IN (%s)`,
+			blkStartHeight, blkEndHeight, strings.Join(pairs, ","))
+		batch, err := queryElectrumTxs(ctx, psql)
+		if err != nil {
+			return nil, err
+		}
+		txs = append(txs, batch...)
+	}
+
+	addressHex := hex.EncodeToString(addressPkh)
+	psql := fmt.Sprintf(`
+SELECT height, txidx, txid FROM
+(
+    SELECT height, utxidx AS txidx, utxid AS txid FROM txout
+    WHERE height = 4294967295 AND address = unhex('%s') AND script_type = unhex('%s')
+
+    UNION ALL
+
+    SELECT height, txidx, txid FROM txin
+    WHERE height = 4294967295 AND address = unhex('%s') AND script_type = unhex('%s')
+)
+LIMIT %d`, addressHex, p2pkhScriptTypeHex, addressHex, p2pkhScriptTypeHex, ElectrumConf.MaxHistory+1)
+	mempoolTxs, err := queryElectrumTxs(ctx, psql)
+	if err != nil {
+		return nil, err
+	}
+	txs = append(txs, mempoolTxs...)
+
+	history := electrumHistory(txs)
+	if len(history) > ElectrumConf.MaxHistory {
+		return nil, ErrHistoryTooLarge
+	}
+	return history, nil
+}
+
+type electrumTxoDO struct {
+	UTxId   []byte
+	Vout    uint32
+	Height  uint32
+	TxIdx   uint64
+	Satoshi uint64
+}
+
+func electrumTxoResultSRF(rows *sql.Rows) (interface{}, error) {
+	var ret electrumTxoDO
+	err := rows.Scan(&ret.UTxId, &ret.Vout, &ret.Height, &ret.TxIdx, &ret.Satoshi)
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+type electrumSpentDO struct {
+	UTxId  []byte // 前12字节
+	Vout   uint32
+	TxId   []byte
+	Height uint32
+	TxIdx  uint64
+}
+
+func electrumSpentResultSRF(rows *sql.Rows) (interface{}, error) {
+	var ret electrumSpentDO
+	err := rows.Scan(&ret.UTxId, &ret.Vout, &ret.TxId, &ret.Height, &ret.TxIdx)
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// electrumScriptTxo 非P2PKH脚本的一个输出及其花费
+type electrumScriptTxo struct {
+	*electrumTxoDO
+	Spent *electrumSpentDO
+}
+
+// getScriptTxos 非P2PKH脚本的所有输出，同一输出已确认时忽略mempool中的记录，花费同样优先取已确认的
+func getScriptTxos(ctx context.Context, digest []byte) (txos []*electrumScriptTxo, err error) {
+	key := "{sho" + string(digest) + "}"
+	total, err := rdb.RdbAddressClient.ZCard(ctx, key).Result()
+	if err != nil {
+		logger.Ctx(ctx).Info("get script outputs count failed", zap.Error(err))
+		return nil, err
+	}
+	if int(total) > ElectrumConf.MaxHistory {
+		return nil, ErrHistoryTooLarge
+	}
+	outpoints, err := rdb.RdbAddressClient.ZRange(ctx, key, 0, -1).Result()
+	if err != nil {
+		logger.Ctx(ctx).Info("get script outputs failed", zap.Error(err))
+		return nil, err
+	}
+
+	for start := 0; start < len(outpoints); start += electrumQueryBatch {
+		end := start + electrumQueryBatch
+		if end > len(outpoints) {
+			end = len(outpoints)
+		}
+		var outs, outs12 []string
+		for _, outpoint := range outpoints[start:end] {
+			if len(outpoint) != 36 {
+				continue
+			}
+			txid := []byte(outpoint[:32])
+			vout := uint32(outpoint[32]) | uint32(outpoint[33])<<8 | uint32(outpoint[34])<<16 | uint32(outpoint[35])<<24
+			outs = append(outs, fmt.Sprintf("(unhex('%s'),%d)", hex.EncodeToString(txid), vout))
+			outs12 = append(outs12, fmt.Sprintf("(unhex('%s'),%d)", hex.EncodeToString(txid[:12]), vout))
+		}
+		if len(outs) == 0 {
+			continue
+		}
+
+		psql := fmt.Sprintf(`
+SELECT utxid, vout, min(height), argMin(utxidx, height), any(satoshi) FROM txout
+WHERE (utxid, vout) IN (%s)
+GROUP BY utxid, vout`, strings.Join(outs, ","))
+		txosRet, err := clickhouse.ScanAll(ctx, psql, electrumTxoResultSRF)
+		if err != nil {
+			logger.Ctx(ctx).Info("query script outputs failed", zap.Error(err))
+			return nil, err
+		}
+		if txosRet == nil {
+			continue
+		}
+
+		psql = fmt.Sprintf(`
+SELECT s.utxid, s.vout, s.txid, s.height, t.txidx FROM
+(
+    SELECT utxid, vout, argMin(txid, height) AS txid, min(height) AS height FROM txin_spent
+    WHERE (utxid, vout) IN (%s)
+    GROUP BY utxid, vout
+) AS s
+LEFT JOIN
+(
+    SELECT txid, height, txidx FROM blktx_height
+    WHERE (txid, height) IN (
+        SELECT txid, height FROM txin_spent
+        WHERE (utxid, vout) IN (%s)
+    )
+) AS t
+ON s.txid = t.txid AND s.height = t.height`, strings.Join(outs12, ","), strings.Join(outs12, ","))
+		spentRet, err := clickhouse.ScanAll(ctx, psql, electrumSpentResultSRF)
+		if err != nil {
+			logger.Ctx(ctx).Info("query script outputs spent failed", zap.Error(err))
+			return nil, err
+		}
+		spent := map[string]*electrumSpentDO{}
+		if spentRet != nil {
+			for _, s := range spentRet.([]*electrumSpentDO) {
+				spent[utxoset.Outpoint(s.UTxId, s.Vout)] = s
+			}
+		}
+		for _, txo := range txosRet.([]*electrumTxoDO) {
+			txos = append(txos, &electrumScriptTxo{
+				electrumTxoDO: txo,
+				Spent:         spent[utxoset.Outpoint(txo.UTxId[:12], txo.Vout)],
+			})
+		}
+	}
+	return txos, nil
+}
+
+// GetScriptHashHistory blockchain.scripthash.get_history，未索引的scripthash没有历史
+func GetScriptHashHistory(ctx context.Context, digest []byte) ([]*electrum.HistoryItem, error) {
+	addressPkh, err := GetScriptHashAddress(ctx, digest)
+	if err != nil {
+		return nil, err
+	}
+	if addressPkh != nil {
+		return GetAddressElectrumHistory(ctx, addressPkh)
+	}
+
+	txos, err := getScriptTxos(ctx, digest)
+	if err != nil {
+		return nil, err
+	}
+	var txs []*electrumTxDO
+	for _, txo := range txos {
+		txs = append(txs, &electrumTxDO{Height: txo.Height, TxIdx: txo.TxIdx, TxId: txo.UTxId})
+		if txo.Spent != nil {
+			txs = append(txs, &electrumTxDO{Height: txo.Spent.Height, TxIdx: txo.Spent.TxIdx, TxId: txo.Spent.TxId})
+		}
+	}
+	return electrumHistory(txs), nil
+}
+
+// GetScriptHashBalance blockchain.scripthash.get_balance
+func GetScriptHashBalance(ctx context.Context, digest []byte) (*model.ElectrumBalanceResp, error) {
+	addressPkh, err := GetScriptHashAddress(ctx, digest)
+	if err != nil {
+		return nil, err
+	}
+	if addressPkh != nil {
+		balance, _, err := GetBalanceByAddress(ctx, addressPkh)
+		if err != nil {
+			return nil, err
+		}
+		return &model.ElectrumBalanceResp{Confirmed: balance.Satoshi, Unconfirmed: balance.PendingSatoshi}, nil
+	}
+
+	txos, err := getScriptTxos(ctx, digest)
+	if err != nil {
+		return nil, err
+	}
+	balance := &model.ElectrumBalanceResp{}
+	for _, txo := range txos {
+		value := int(txo.Satoshi)
+		if txo.Height == utxoset.MempoolHeight {
+			if txo.Spent == nil {
+				balance.Unconfirmed += value
+			}
+			continue
+		}
+		if txo.Spent == nil {
+			balance.Confirmed += value
+		} else if txo.Spent.Height == utxoset.MempoolHeight {
+			balance.Confirmed += value
+			balance.Unconfirmed -= value
+		}
+	}
+	return balance, nil
+}
+
+// ListAddressElectrumUnspent P2PKH地址的utxo，mempool中的height为0
+func ListAddressElectrumUnspent(ctx context.Context, addressPkh []byte) (utxosRsp []*model.ElectrumUtxoResp, err error) {
+	utxosRsp = []*model.ElectrumUtxoResp{}
+	_, err = withUtxoSource(ctx, nil, nil, addressPkh, "au", func(src utxoset.Source) error {
+		outpoints, _, _, total, _, _, _, err := src.Outpoints(ctx, paging.Page{Size: ElectrumConf.MaxHistory})
+		if err != nil {
+			return err
+		}
+		if total > ElectrumConf.MaxHistory {
+			return ErrHistoryTooLarge
+		}
+		txos, err := src.Txos(ctx, outpoints)
+		if err != nil {
+			return err
+		}
+		for _, txo := range txos {
+			height := int(txo.BlockHeight)
+			if txo.BlockHeight == utxoset.MempoolHeight {
+				height = 0
+			}
+			utxosRsp = append(utxosRsp, &model.ElectrumUtxoResp{
+				TxHash: blkparser.HashString(txo.UTxid),
+				TxPos:  int(txo.Vout),
+				Height: height,
+				Value:  int(txo.Satoshi),
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return utxosRsp, nil
+}
+
+// ListScriptHashUnspent blockchain.scripthash.listunspent，不含已被mempool中交易花费的
+func ListScriptHashUnspent(ctx context.Context, digest []byte) (utxosRsp []*model.ElectrumUtxoResp, err error) {
+	utxosRsp = []*model.ElectrumUtxoResp{}
+	addressPkh, err := GetScriptHashAddress(ctx, digest)
+	if err != nil {
+		return nil, err
+	}
+	if addressPkh != nil {
+		return ListAddressElectrumUnspent(ctx, addressPkh)
+	}
+
+	txos, err := getScriptTxos(ctx, digest)
+	if err != nil {
+		return nil, err
+	}
+	for _, txo := range txos {
+		if txo.Spent != nil {
+			continue
+		}
+		height := int(txo.Height)
+		if txo.Height == utxoset.MempoolHeight {
+			height = 0
+		}
+		utxosRsp = append(utxosRsp, &model.ElectrumUtxoResp{
+			TxHash: blkparser.HashString(txo.UTxId),
+			TxPos:  int(txo.Vout),
+			Height: height,
+			Value:  int(txo.Satoshi),
+		})
+	}
+	return utxosRsp, nil
+}
+
+func electrumTxIdResultSRF(rows *sql.Rows) (interface{}, error) {
+	var ret []byte
+	err := rows.Scan(&ret)
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// GetBlockTxIds 区块内按顺序排列的txid，内部字节序
+func GetBlockTxIds(ctx context.Context, blkHeight int) (txids [][]byte, err error) {
+	psql := fmt.Sprintf(`
+SELECT txid FROM blktx_height
+WHERE height = %d
+ORDER BY txidx`, blkHeight)
+	txidsRet, err := clickhouse.ScanAll(ctx, psql, electrumTxIdResultSRF)
+	if err != nil {
+		logger.Ctx(ctx).Info("query block txids failed", zap.Error(err))
+		return nil, err
+	}
+	if txidsRet == nil {
+		return nil, errors.New("not exist")
+	}
+	return txidsRet.([][]byte), nil
+}
+
+// GetBlockTxIdsRange 区块内txidx在[start, start+count)之间的txid，内部字节序
+func GetBlockTxIdsRange(ctx context.Context, blkHeight, start, count int) (txids [][]byte, err error) {
+	psql := fmt.Sprintf(`
+SELECT txid FROM blktx_height
+WHERE height = %d AND txidx >= %d AND txidx < %d
+ORDER BY txidx`, blkHeight, start, start+count)
+	txidsRet, err := clickhouse.ScanAll(ctx, psql, electrumTxIdResultSRF)
+	if err != nil {
+		logger.Ctx(ctx).Info("query block txids failed", zap.Error(err))
+		return nil, err
+	}
+	if txidsRet == nil {
+		return [][]byte{}, nil
+	}
+	return txidsRet.([][]byte), nil
+}
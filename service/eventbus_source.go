@@ -0,0 +1,324 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"sensiblequery/dao/clickhouse"
+	"sensiblequery/lib/blkparser"
+	"sensiblequery/lib/eventbus"
+	"sensiblequery/lib/utils"
+	"sensiblequery/logger"
+	"sensiblequery/model"
+	"sort"
+	"strconv"
+
+	scriptDecoder "github.com/sensible-contract/sensible-script-decoder"
+	"go.uber.org/zap"
+)
+
+// busTxoDO 合约相关的输入或输出，输入的utxid/vout为被花费的输出
+type busTxoDO struct {
+	Height     uint32
+	Idx        uint32
+	IOType     uint8 // 0: input; 1: output
+	TxId       []byte
+	UTxId      []byte
+	Vout       uint32
+	ScriptType []byte
+	ScriptPk   []byte
+}
+
+func busTxoResultSRF(rows *sql.Rows) (interface{}, error) {
+	var ret busTxoDO
+	err := rows.Scan(&ret.Height, &ret.Idx, &ret.IOType, &ret.TxId, &ret.UTxId, &ret.Vout, &ret.ScriptType, &ret.ScriptPk)
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// getBusTxos 读取[start, end)高度内包含合约的输入及输出，按交易排序
+func getBusTxos(ctx context.Context, start, end int) ([]*busTxoDO, error) {
+	psql := fmt.Sprintf(`
+SELECT height, txidx, io_type, txid, utxid, vout, script_type, script_pk FROM
+(
+    SELECT height, utxidx AS txidx, 1 AS io_type, utxid AS txid, utxid, vout, script_type, script_pk FROM txout
+    WHERE height >= %d AND height < %d AND (substring(utxid, 1, 12), vout, height) in (
+        SELECT utxid, vout, height FROM txout_genesis_height
+        WHERE height >= %d AND height < %d AND codehash != ''
+      )
+
+    UNION ALL
+
+    SELECT height, txidx, 0 AS io_type, txid, utxid, vout, script_type, script_pk FROM txin
+    WHERE height >= %d AND height < %d AND (substring(txid, 1, 12), idx, height) in (
+        SELECT txid, idx, height FROM txin_genesis_height
+        WHERE height >= %d AND height < %d AND codehash != ''
+      )
+)
+ORDER BY height, txidx, io_type, utxid, vout`,
+		start, end, start, end,
+		start, end, start, end)
+
+	txosRet, err := clickhouse.ScanAll(ctx, psql, busTxoResultSRF)
+	if err != nil {
+		logger.Ctx(ctx).Info("query event bus txo failed", zap.Error(err))
+		return nil, err
+	}
+	if txosRet == nil {
+		return nil, nil
+	}
+	return txosRet.([]*busTxoDO), nil
+}
+
+type busSwapDO struct {
+	model.ContractSwapDataDo
+	CodeHash []byte
+	Genesis  []byte
+}
+
+func busSwapResultSRF(rows *sql.Rows) (interface{}, error) {
+	var ret busSwapDO
+	err := rows.Scan(&ret.Height, &ret.BlockTime, &ret.CodeType, &ret.Operation, &ret.InToken1Amount, &ret.InToken2Amount, &ret.InLpAmount, &ret.OutToken1Amount, &ret.OutToken2Amount, &ret.OutLpAmount, &ret.Idx, &ret.TxId, &ret.CodeHash, &ret.Genesis)
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// getBusSwaps 读取[start, end)高度内所有swap合约的操作
+func getBusSwaps(ctx context.Context, start, end int) ([]*busSwapDO, error) {
+	psql := fmt.Sprintf(`
+SELECT height, blocktime, code_type, operation, in_value1, in_value2, in_value3, out_value1, out_value2, out_value3, txidx, txid, codehash, genesis FROM blktx_contract_height
+WHERE height >= %d AND height < %d AND
+    code_type = %d
+ORDER BY height, txidx`, start, end, scriptDecoder.CodeType_UNIQUE)
+
+	swapsRet, err := clickhouse.ScanAll(ctx, psql, busSwapResultSRF)
+	if err != nil {
+		logger.Ctx(ctx).Info("query event bus swap failed", zap.Error(err))
+		return nil, err
+	}
+	if swapsRet == nil {
+		return nil, nil
+	}
+	return swapsRet.([]*busSwapDO), nil
+}
+
+type busTxo struct {
+	*busTxoDO
+	txo *scriptDecoder.TxoData
+}
+
+func (t *busTxo) address() string {
+	if !t.txo.HasAddress {
+		return ""
+	}
+	return utils.EncodeAddress(t.txo.AddressPkh[:], utils.PubKeyHashAddrID)
+}
+
+func (t *busTxo) genesisKey() string {
+	return string(t.txo.CodeHash[:]) + string(t.txo.GenesisId[:t.txo.GenesisIdLen])
+}
+
+// busTxEvents 一个交易的token转移、NFT挂单及拍卖事件
+func busTxEvents(rows []*busTxoDO) (events []*eventbus.Event) {
+	txos := make([]*busTxo, 0, len(rows))
+	for _, row := range rows {
+		txos = append(txos, &busTxo{busTxoDO: row, txo: scriptDecoder.ExtractPkScriptForTxo(row.ScriptPk, row.ScriptType)})
+	}
+	first := rows[0]
+	newEvent := func(typ string, data interface{}) {
+		events = append(events, &eventbus.Event{
+			Type:   typ,
+			Height: int(first.Height),
+			TxIdx:  int(first.Idx),
+			TxId:   blkparser.HashString(first.TxId),
+			Data:   data,
+		})
+	}
+
+	// 按codehash+genesis汇总FT、NFT转移
+	transfers := map[string]*model.BusTokenTransferResp{}
+	var keys []string
+	for _, t := range txos {
+		if t.txo.CodeType != scriptDecoder.CodeType_FT && t.txo.CodeType != scriptDecoder.CodeType_NFT {
+			continue
+		}
+		key := t.genesisKey()
+		transfer, ok := transfers[key]
+		if !ok {
+			transfer = &model.BusTokenTransferResp{
+				CodeType:    int(t.txo.CodeType),
+				CodeHashHex: hex.EncodeToString(t.txo.CodeHash[:]),
+				GenesisHex:  hex.EncodeToString(t.txo.GenesisId[:t.txo.GenesisIdLen]),
+				Inputs:      make([]*model.BusTokenIOResp, 0),
+				Outputs:     make([]*model.BusTokenIOResp, 0),
+			}
+			transfers[key] = transfer
+			keys = append(keys, key)
+		}
+		io := &model.BusTokenIOResp{
+			TxIdHex: blkparser.HashString(t.UTxId),
+			Vout:    int(t.Vout),
+			Address: t.address(),
+		}
+		if t.txo.CodeType == scriptDecoder.CodeType_FT {
+			io.Amount = strconv.FormatUint(t.txo.FT.Amount, 10)
+			transfer.SensibleId = hex.EncodeToString(t.txo.FT.SensibleId)
+		} else {
+			io.TokenIndex = strconv.FormatUint(t.txo.NFT.TokenIndex, 10)
+			transfer.SensibleId = hex.EncodeToString(t.txo.NFT.SensibleId)
+		}
+		if t.IOType == 0 {
+			transfer.Inputs = append(transfer.Inputs, io)
+		} else {
+			transfer.Outputs = append(transfer.Outputs, io)
+		}
+	}
+	for _, key := range keys {
+		newEvent(model.BusTokenTransfer, transfers[key])
+	}
+
+	for _, t := range txos {
+		switch t.txo.CodeType {
+		case scriptDecoder.CodeType_NFT_SELL:
+			sell := &model.BusNFTSellResp{
+				CodeHashHex: hex.EncodeToString(t.txo.CodeHash[:]),
+				GenesisHex:  hex.EncodeToString(t.txo.GenesisId[:t.txo.GenesisIdLen]),
+				TokenIndex:  strconv.FormatUint(t.txo.NFTSell.TokenIndex, 10),
+				Price:       int(t.txo.NFTSell.Price),
+				Seller:      t.address(),
+				SellTxIdHex: blkparser.HashString(t.UTxId),
+				SellVout:    int(t.Vout),
+			}
+			if t.IOType == 1 {
+				newEvent(model.BusNFTSellList, sell)
+				continue
+			}
+			// 挂单被花费，NFT转给卖家以外的地址为购买，否则为撤单
+			typ := model.BusNFTSellCancel
+			for _, out := range txos {
+				if out.IOType == 1 && out.txo.CodeType == scriptDecoder.CodeType_NFT &&
+					out.genesisKey() == t.genesisKey() && out.txo.NFT.TokenIndex == t.txo.NFTSell.TokenIndex {
+					if buyer := out.address(); buyer != sell.Seller {
+						typ = model.BusNFTSellBuy
+						sell.Buyer = buyer
+					}
+					break
+				}
+			}
+			newEvent(typ, sell)
+
+		case scriptDecoder.CodeType_NFT_AUCTION:
+			auction := t.txo.NFTAuction
+			if t.IOType != 1 || auction.BidBsvPrice == 0 {
+				continue
+			}
+			// 状态输出的出价与花费的状态相同则不是新的出价
+			repeated := false
+			for _, in := range txos {
+				if in.IOType == 0 && in.txo.CodeType == scriptDecoder.CodeType_NFT_AUCTION &&
+					in.txo.NFTAuction.BidBsvPrice == auction.BidBsvPrice &&
+					in.txo.NFTAuction.BidTimestamp == auction.BidTimestamp &&
+					bytes.Equal(in.txo.NFTAuction.BidderAddressPkh[:], auction.BidderAddressPkh[:]) {
+					repeated = true
+					break
+				}
+			}
+			if repeated {
+				continue
+			}
+			newEvent(model.BusNFTAuctionBid, &model.BusNFTAuctionBidResp{
+				CodeHashHex:    hex.EncodeToString(t.txo.CodeHash[:]),
+				SensibleIdHex:  hex.EncodeToString(auction.SensibleId[:]),
+				NFTCodeHashHex: hex.EncodeToString(auction.NFTCodeHash[:]),
+				NFTIDHex:       hex.EncodeToString(auction.NFTID[:]),
+				Sender:         utils.EncodeAddress(auction.SenderAddressPkh[:], utils.PubKeyHashAddrID),
+				Bidder:         utils.EncodeAddress(auction.BidderAddressPkh[:], utils.PubKeyHashAddrID),
+				BidBsvPrice:    int(auction.BidBsvPrice),
+				BidTimestamp:   int(auction.BidTimestamp),
+				StartBsvPrice:  int(auction.StartBsvPrice),
+				EndTimestamp:   int(auction.EndTimestamp),
+				Vout:           int(t.Vout),
+			})
+		}
+	}
+	return events
+}
+
+// GetBusEvents 读取[start, end)高度内的所有事件，按offset排序并编号
+func GetBusEvents(ctx context.Context, start, end int) ([]*eventbus.Event, error) {
+	blocks, err := GetBlockBriefs(ctx, start, end-1)
+	if err != nil {
+		return nil, err
+	}
+	txos, err := getBusTxos(ctx, start, end)
+	if err != nil {
+		return nil, err
+	}
+	swaps, err := getBusSwaps(ctx, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []*eventbus.Event
+	for i := 0; i < len(txos); {
+		j := i + 1
+		for j < len(txos) && txos[j].Height == txos[i].Height && txos[j].Idx == txos[i].Idx {
+			j++
+		}
+		events = append(events, busTxEvents(txos[i:j])...)
+		i = j
+	}
+	for _, swap := range swaps {
+		events = append(events, &eventbus.Event{
+			Type:   model.BusSwap,
+			Height: int(swap.Height),
+			TxIdx:  int(swap.Idx),
+			TxId:   blkparser.HashString(swap.TxId),
+			Data: &model.BusSwapResp{
+				CodeHashHex: hex.EncodeToString(swap.CodeHash),
+				GenesisHex:  hex.EncodeToString(swap.Genesis),
+				ContractSwapDataResp: &model.ContractSwapDataResp{
+					Height:          int(swap.Height),
+					BlockTime:       int(swap.BlockTime),
+					CodeType:        int(swap.CodeType),
+					Operation:       int(swap.Operation),
+					InToken1Amount:  int(swap.InToken1Amount),
+					InToken2Amount:  int(swap.InToken2Amount),
+					InLpAmount:      int(swap.InLpAmount),
+					OutToken1Amount: int(swap.OutToken1Amount),
+					OutToken2Amount: int(swap.OutToken2Amount),
+					OutLpAmount:     int(swap.OutLpAmount),
+					Idx:             int(swap.Idx),
+					TxIdHex:         blkparser.HashString(swap.TxId),
+				},
+			},
+		})
+	}
+
+	blockTime := map[int]int{}
+	for _, blk := range blocks {
+		blockTime[blk.Height] = blk.BlockTime
+		events = append(events, &eventbus.Event{
+			Type:      model.BusBlock,
+			Height:    blk.Height,
+			TxIdx:     blk.TxCount,
+			Timestamp: blk.BlockTime,
+			Data:      blk,
+		})
+	}
+	for _, e := range events {
+		e.Timestamp = blockTime[e.Height]
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Pos().Less(events[j].Pos())
+	})
+	eventbus.Number(events)
+	return events, nil
+}
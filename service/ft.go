@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"database/sql"
 	"encoding/hex"
 	"errors"
@@ -28,7 +29,7 @@ func ftInfoResultSRF(rows *sql.Rows) (interface{}, error) {
 	return &ret, nil
 }
 
-func getFTDecimal(ftsRsp []*model.FTInfoResp) {
+func getFTDecimal(ctx context.Context, ftsRsp []*model.FTInfoResp) {
 	pipe := rdb.BizClient.Pipeline()
 	ftinfoCmds := make([]*redis.StringStringMapCmd, 0)
 	for _, ft := range ftsRsp {
@@ -51,7 +52,7 @@ func getFTDecimal(ftsRsp []*model.FTInfoResp) {
 			}
 			continue
 		} else if err != nil {
-			logger.Log.Info("getFTDecimal redis failed", zap.Error(err))
+			logger.Ctx(ctx).Info("getFTDecimal redis failed", zap.Error(err))
 		}
 		decimal, _ := strconv.Atoi(ftinfo["decimal"])
 		ft.Decimal = decimal
@@ -61,7 +62,7 @@ func getFTDecimal(ftsRsp []*model.FTInfoResp) {
 	}
 }
 
-func ListFTInfoByGenesis(codeHashHex, genesisHex string) (ftRsp *model.FTInfoResp, err error) {
+func ListFTInfoByGenesis(ctx context.Context, codeHashHex, genesisHex string) (ftRsp *model.FTInfoResp, err error) {
 	psql := fmt.Sprintf(`
 SELECT codehash, genesis, count(1),
        sum(in_data_value) AS in_volume , sum(out_data_value) AS out_volume,
@@ -70,18 +71,18 @@ WHERE code_type = 1 AND codehash = unhex('%s') AND genesis = unhex('%s')
 GROUP BY codehash, genesis
 ORDER BY count(1) DESC
 `, codeHashHex, genesisHex)
-	ftsRsp, err := GetFTInfoBySQL(psql)
+	ftsRsp, err := GetFTInfoBySQL(ctx, psql)
 	if err != nil {
 		return
 	}
 	if len(ftsRsp) > 0 {
-		getFTDecimal(ftsRsp)
+		getFTDecimal(ctx, ftsRsp)
 		return ftsRsp[0], nil
 	}
 	return nil, errors.New("not exist")
 }
 
-func GetFTSummary(codeHashHex string) (ftsRsp []*model.FTInfoResp, err error) {
+func GetFTSummary(ctx context.Context, codeHashHex string) (ftsRsp []*model.FTInfoResp, err error) {
 	psql := fmt.Sprintf(`
 SELECT codehash, genesis, count(1),
        sum(in_data_value) AS in_volume , sum(out_data_value) AS out_volume,
@@ -90,15 +91,15 @@ WHERE code_type = 1 AND codehash = unhex('%s')
 GROUP BY codehash, genesis
 ORDER BY count(1) DESC
 `, codeHashHex)
-	ftsRsp, err = GetFTInfoBySQL(psql)
+	ftsRsp, err = GetFTInfoBySQL(ctx, psql)
 	if err != nil {
 		return
 	}
-	getFTDecimal(ftsRsp)
+	getFTDecimal(ctx, ftsRsp)
 	return
 }
 
-func GetFTInfo() (ftsRsp []*model.FTInfoResp, err error) {
+func GetFTInfo(ctx context.Context) (ftsRsp []*model.FTInfoResp, err error) {
 	psql := `
 SELECT codehash, genesis, count(1),
        sum(in_data_value) AS in_volume , sum(out_data_value) AS out_volume,
@@ -107,18 +108,18 @@ WHERE code_type = 1
 GROUP BY codehash, genesis
 ORDER BY count(1) DESC
 `
-	ftsRsp, err = GetFTInfoBySQL(psql)
+	ftsRsp, err = GetFTInfoBySQL(ctx, psql)
 	if err != nil {
 		return
 	}
-	getFTDecimal(ftsRsp)
+	getFTDecimal(ctx, ftsRsp)
 	return
 }
 
-func GetFTInfoBySQL(psql string) (blksRsp []*model.FTInfoResp, err error) {
-	blksRet, err := clickhouse.ScanAll(psql, ftInfoResultSRF)
+func GetFTInfoBySQL(ctx context.Context, psql string) (blksRsp []*model.FTInfoResp, err error) {
+	blksRet, err := clickhouse.ScanAll(ctx, psql, ftInfoResultSRF)
 	if err != nil {
-		logger.Log.Info("query blk failed", zap.Error(err))
+		logger.Ctx(ctx).Info("query blk failed", zap.Error(err))
 		return nil, err
 	}
 	if blksRet == nil {
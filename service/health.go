@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sensiblequery/dao/clickhouse"
+	"sensiblequery/dao/rdb"
+	"sensiblequery/model"
+	"sort"
+	"sync"
+	"time"
+
+	redis "github.com/go-redis/redis/v8"
+)
+
+// HealthChecker 依赖检查，返回可选的附加信息
+type HealthChecker func(ctx context.Context) (detail string, err error)
+
+func redisChecker(client redis.UniversalClient) HealthChecker {
+	return func(ctx context.Context) (string, error) {
+		return "", client.Ping(ctx).Err()
+	}
+}
+
+// StorageCheckers ClickHouse及各redis实例的检查
+func StorageCheckers() map[string]HealthChecker {
+	return map[string]HealthChecker{
+		"clickhouse": func(ctx context.Context) (string, error) {
+			healthy, err := clickhouse.Ping(ctx)
+			return fmt.Sprintf("healthy=%d/%d", healthy, len(clickhouse.Replicas())), err
+		},
+		"redis.cache":   redisChecker(rdb.CacheClient),
+		"redis.biz":     redisChecker(rdb.BizClient),
+		"redis.utxo":    redisChecker(rdb.RdbUtxoClient),
+		"redis.address": redisChecker(rdb.RdbAddressClient),
+		"redis.user":    redisChecker(rdb.UserClient),
+	}
+}
+
+// CheckHealth 并发执行所有检查，每项检查超时为timeout，结果按名称顺序返回
+func CheckHealth(ctx context.Context, checkers map[string]HealthChecker, timeout time.Duration) (ok bool, checks []*model.HealthCheckResp) {
+	names := make([]string, 0, len(checkers))
+	for name := range checkers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	checks = make([]*model.HealthCheckResp, len(names))
+	var wg sync.WaitGroup
+	for idx, name := range names {
+		wg.Add(1)
+		go func(idx int, name string, check HealthChecker) {
+			defer wg.Done()
+			cctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			start := time.Now()
+			detail, err := check(cctx)
+			res := &model.HealthCheckResp{
+				Name:      name,
+				Status:    model.HealthOk,
+				LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+				Detail:    detail,
+			}
+			if err != nil {
+				res.Status = model.HealthError
+				res.Error = err.Error()
+			}
+			checks[idx] = res
+		}(idx, name, checkers[name])
+	}
+	wg.Wait()
+
+	ok = true
+	for _, res := range checks {
+		if res.Status != model.HealthOk {
+			ok = false
+		}
+	}
+	return ok, checks
+}
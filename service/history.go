@@ -1,9 +1,11 @@
 package service
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"sensiblequery/dao/clickhouse"
+	"sensiblequery/lib/paging"
 	"sensiblequery/logger"
 	"sensiblequery/model"
 
@@ -20,10 +22,9 @@ func txOutHistoryResultSRF(rows *sql.Rows) (interface{}, error) {
 	return &ret, nil
 }
 
-
 //////////////// genesis
-func GetHistoryByGenesisByHeightRange(cursor, size, blkStartHeight, blkEndHeight int, codehashHex, genesisHex, addressHex string) (txOutsRsp []*model.TxOutHistoryResp, err error) {
-	logger.Log.Info("query tx history by codehash/genesis for", zap.String("address", addressHex))
+func GetHistoryByGenesisByHeightRange(ctx context.Context, page paging.Page, blkStartHeight, blkEndHeight int, codehashHex, genesisHex, addressHex string) (txOutsRsp []*model.TxOutHistoryResp, err error) {
+	logger.Ctx(ctx).Info("query tx history by codehash/genesis for", zap.String("address", addressHex))
 
 	if blkEndHeight == 0 {
 		blkEndHeight = 4294967295 + 1 // enable mempool
@@ -40,7 +41,10 @@ func GetHistoryByGenesisByHeightRange(cursor, size, blkStartHeight, blkEndHeight
 		codehashMatch = fmt.Sprintf("codehash = unhex('%s') AND", codehashHex)
 		genesisMatch = fmt.Sprintf("genesis = unhex('%s') AND", genesisHex)
 	}
-	maxOffset := cursor + size
+	desc := !page.IsPrev()
+	order := historyOrder(desc)
+	ks := newHistoryKeyset(page.Token, desc)
+	maxOffset, offset := historyLimits(page)
 	// script_pk -> ''
 	psql := fmt.Sprintf(`
 SELECT txid, idx, address, codehash, genesis, satoshi, script_type, script_pk, height, txidx, io_type, blk.blocktime FROM
@@ -48,18 +52,18 @@ SELECT txid, idx, address, codehash, genesis, satoshi, script_type, script_pk, h
     SELECT utxid AS txid, vout AS idx, address, codehash, genesis, satoshi, script_type, script_pk, height, utxidx AS txidx, 1 AS io_type FROM txout
     WHERE (substring(utxid, 1, 12), vout, height) in (
         SELECT utxid, vout, height FROM txout_genesis_height
-        WHERE height >= %d AND height < %d AND %s %s (address = unhex('%s') %s)
-        ORDER BY height DESC, utxidx DESC, codehash DESC, genesis DESC
+        WHERE height >= %d AND height < %d AND %s %s %s (address = unhex('%s') %s)
+        ORDER BY height %s, utxidx %s, vout %s, codehash %s, genesis %s
         LIMIT %d
-      )
-    ORDER BY height DESC, utxidx DESC
+      ) AND %s 1
+    ORDER BY height %s, utxidx %s, vout %s
     LIMIT %d
 
     UNION ALL
 
     SELECT utxid AS txid, vout AS idx, address, codehash, genesis, satoshi, script_type, script_pk, height, utxidx AS txidx, 1 AS io_type FROM txout
-    WHERE height >= 4294967295 AND height < %d AND %s %s (address = unhex('%s') %s)
-    ORDER BY height DESC, utxidx DESC, codehash DESC, genesis DESC
+    WHERE height >= 4294967295 AND height < %d AND %s %s %s (address = unhex('%s') %s)
+    ORDER BY height %s, utxidx %s, vout %s, codehash %s, genesis %s
     LIMIT %d
 
     UNION ALL
@@ -67,18 +71,18 @@ SELECT txid, idx, address, codehash, genesis, satoshi, script_type, script_pk, h
     SELECT txid, idx, address, codehash, genesis, satoshi, script_type, script_pk, height, txidx, 0 AS io_type FROM txin
     WHERE (substring(txid, 1, 12), idx, height) in (
         SELECT txid, idx, height FROM txin_genesis_height
-        WHERE height >= %d AND height < %d AND %s %s (address = unhex('%s') %s)
-        ORDER BY height DESC, txidx DESC, codehash DESC, genesis DESC
+        WHERE height >= %d AND height < %d AND %s %s %s (address = unhex('%s') %s)
+        ORDER BY height %s, txidx %s, idx %s, codehash %s, genesis %s
         LIMIT %d
-      )
-    ORDER BY height DESC, txidx DESC
+      ) AND %s 1
+    ORDER BY height %s, txidx %s, idx %s
     LIMIT %d
 
     UNION ALL
 
     SELECT txid, idx, address, codehash, genesis, satoshi, script_type, script_pk, height, txidx, 0 AS io_type FROM txin
-    WHERE height >= 4294967295 AND height < %d AND %s %s (address = unhex('%s') %s)
-    ORDER BY height DESC, txidx DESC, codehash DESC, genesis DESC
+    WHERE height >= 4294967295 AND height < %d AND %s %s %s (address = unhex('%s') %s)
+    ORDER BY height %s, txidx %s, idx %s, codehash %s, genesis %s
     LIMIT %d
 
 ) AS history
@@ -87,41 +91,51 @@ LEFT JOIN (
     WHERE height >= %d AND height < %d
 ) AS blk
 USING height
-ORDER BY height DESC, txidx DESC
+ORDER BY height %s, txidx %s, io_type %s, idx %s
 LIMIT %d, %d`,
 		blkStartHeight, blkEndHeight,
-		codehashMatch, genesisMatch, addressHex, addressMatch, maxOffset, maxOffset,
+		codehashMatch, genesisMatch, ks.TxOut, addressHex, addressMatch, order, order, order, order, order, maxOffset,
+		ks.TxOut, order, order, order, maxOffset,
 		blkEndHeight,
-		codehashMatch, genesisMatch, addressHex, addressMatch, maxOffset,
+		codehashMatch, genesisMatch, ks.TxOut, addressHex, addressMatch, order, order, order, order, order, maxOffset,
 
 		blkStartHeight, blkEndHeight,
-		codehashMatch, genesisMatch, addressHex, addressMatch, maxOffset, maxOffset,
+		codehashMatch, genesisMatch, ks.TxIn, addressHex, addressMatch, order, order, order, order, order, maxOffset,
+		ks.TxIn, order, order, order, maxOffset,
 		blkEndHeight,
-		codehashMatch, genesisMatch, addressHex, addressMatch, maxOffset,
+		codehashMatch, genesisMatch, ks.TxIn, addressHex, addressMatch, order, order, order, order, order, maxOffset,
 
 		blkStartHeight, blkEndHeight,
-		cursor, size)
-	return GetHistoryBySql(psql)
+		order, order, order, order,
+		offset, page.Size)
+	txOutsRsp, err = GetHistoryBySql(ctx, psql)
+	if page.IsPrev() {
+		reverseHistory(txOutsRsp)
+	}
+	return txOutsRsp, err
 }
 
 //////////////// genesis with out address
-func GetAllHistoryByGenesisByHeightRange(cursor, size, blkStartHeight, blkEndHeight int, codehashHex, genesisHex string, isDesc bool) (txOutsRsp []*model.TxOutHistoryResp, err error) {
-	logger.Log.Info("query tx history by codehash/genesis on all address ")
+func GetAllHistoryByGenesisByHeightRange(ctx context.Context, page paging.Page, blkStartHeight, blkEndHeight int, codehashHex, genesisHex string, isDesc bool) (txOutsRsp []*model.TxOutHistoryResp, err error) {
+	logger.Ctx(ctx).Info("query tx history by codehash/genesis on all address ")
 
 	if blkEndHeight == 0 {
 		blkEndHeight = 4294967295 + 1 // enable mempool
 	}
-	order := ""
-	if isDesc {
-		order = "DESC"
+	desc := isDesc
+	if page.IsPrev() {
+		desc = !desc
 	}
+	order := historyOrder(desc)
+	ks := newHistoryKeyset(page.Token, desc)
+	maxOffset, offset := historyLimits(page)
+
 	codehashMatch := ""
 	genesisMatch := ""
 	if codehashHex != "0000000000000000000000000000000000000000" {
 		codehashMatch = fmt.Sprintf("codehash = unhex('%s') AND", codehashHex)
-		genesisMatch = fmt.Sprintf("genesis = unhex('%s')", genesisHex)
+		genesisMatch = fmt.Sprintf("genesis = unhex('%s') AND", genesisHex)
 	}
-	maxOffset := cursor + size
 	// script_pk -> ''
 	psql := fmt.Sprintf(`
 SELECT txid, idx, address, codehash, genesis, satoshi, script_type, script_pk, height, txidx, io_type, blk.blocktime FROM
@@ -129,18 +143,18 @@ SELECT txid, idx, address, codehash, genesis, satoshi, script_type, script_pk, h
     SELECT utxid AS txid, vout AS idx, address, codehash, genesis, satoshi, script_type, script_pk, height, utxidx AS txidx, 1 AS io_type FROM txout
     WHERE (substring(utxid, 1, 12), vout, height) in (
         SELECT utxid, vout, height FROM txout_genesis_height
-        WHERE height >= %d AND height < %d AND %s %s
-        ORDER BY height %s, utxidx %s, codehash %s, genesis %s
+        WHERE height >= %d AND height < %d AND %s %s %s 1
+        ORDER BY height %s, utxidx %s, vout %s, codehash %s, genesis %s
         LIMIT %d
-      )
-    ORDER BY height %s, utxidx %s
+      ) AND %s 1
+    ORDER BY height %s, utxidx %s, vout %s
     LIMIT %d
 
     UNION ALL
 
     SELECT utxid AS txid, vout AS idx, address, codehash, genesis, satoshi, script_type, script_pk, height, utxidx AS txidx, 1 AS io_type FROM txout
-    WHERE height >= 4294967295 AND height < %d AND %s %s
-    ORDER BY height %s, utxidx %s, codehash %s, genesis %s
+    WHERE height >= 4294967295 AND height < %d AND %s %s %s 1
+    ORDER BY height %s, utxidx %s, vout %s, codehash %s, genesis %s
     LIMIT %d
 
     UNION ALL
@@ -148,18 +162,18 @@ SELECT txid, idx, address, codehash, genesis, satoshi, script_type, script_pk, h
     SELECT txid, idx, address, codehash, genesis, satoshi, script_type, script_pk, height, txidx, 0 AS io_type FROM txin
     WHERE (substring(txid, 1, 12), idx, height) in (
         SELECT txid, idx, height FROM txin_genesis_height
-        WHERE height >= %d AND height < %d AND %s %s
-        ORDER BY height %s, txidx %s, codehash %s, genesis %s
+        WHERE height >= %d AND height < %d AND %s %s %s 1
+        ORDER BY height %s, txidx %s, idx %s, codehash %s, genesis %s
         LIMIT %d
-      )
-    ORDER BY height %s, txidx %s
+      ) AND %s 1
+    ORDER BY height %s, txidx %s, idx %s
     LIMIT %d
 
     UNION ALL
 
     SELECT txid, idx, address, codehash, genesis, satoshi, script_type, script_pk, height, txidx, 0 AS io_type FROM txin
-    WHERE height >= 4294967295 AND height < %d AND %s %s
-    ORDER BY height %s, txidx %s, codehash %s, genesis %s
+    WHERE height >= 4294967295 AND height < %d AND %s %s %s 1
+    ORDER BY height %s, txidx %s, idx %s, codehash %s, genesis %s
     LIMIT %d
 
 ) AS history
@@ -168,26 +182,33 @@ LEFT JOIN (
     WHERE height >= %d AND height < %d
 ) AS blk
 USING height
-ORDER BY height %s, txidx %s
+ORDER BY height %s, txidx %s, io_type %s, idx %s
 LIMIT %d, %d`,
 		blkStartHeight, blkEndHeight,
-		codehashMatch, genesisMatch, order, order, order, order, maxOffset, order, order, maxOffset,
+		codehashMatch, genesisMatch, ks.TxOut, order, order, order, order, order, maxOffset,
+		ks.TxOut, order, order, order, maxOffset,
 		blkEndHeight,
-		codehashMatch, genesisMatch, order, order, order, order, maxOffset,
+		codehashMatch, genesisMatch, ks.TxOut, order, order, order, order, order, maxOffset,
 
 		blkStartHeight, blkEndHeight,
-		codehashMatch, genesisMatch, order, order, order, order, maxOffset, order, order, maxOffset,
+		codehashMatch, genesisMatch, ks.TxIn, order, order, order, order, order, maxOffset,
+		ks.TxIn, order, order, order, maxOffset,
 		blkEndHeight,
-		codehashMatch, genesisMatch, order, order, order, order, maxOffset,
+		codehashMatch, genesisMatch, ks.TxIn, order, order, order, order, order, maxOffset,
 
-		blkStartHeight, blkEndHeight, order, order,
-		cursor, size)
-	return GetHistoryBySql(psql)
+		blkStartHeight, blkEndHeight,
+		order, order, order, order,
+		offset, page.Size)
+	txOutsRsp, err = GetHistoryBySql(ctx, psql)
+	if page.IsPrev() {
+		reverseHistory(txOutsRsp)
+	}
+	return txOutsRsp, err
 }
 
 //////////////// genesis
-func GetIncomeHistoryByGenesisByHeightRange(cursor, size, blkStartHeight, blkEndHeight int, codehashHex, genesisHex, addressHex string) (txOutsRsp []*model.TxOutHistoryResp, err error) {
-	logger.Log.Info("query tx income history by codehash/genesis for", zap.String("address", addressHex))
+func GetIncomeHistoryByGenesisByHeightRange(ctx context.Context, page paging.Page, blkStartHeight, blkEndHeight int, codehashHex, genesisHex, addressHex string) (txOutsRsp []*model.TxOutHistoryResp, err error) {
+	logger.Ctx(ctx).Info("query tx income history by codehash/genesis for", zap.String("address", addressHex))
 
 	if blkEndHeight == 0 {
 		blkEndHeight = 4294967295 + 1 // enable mempool
@@ -204,7 +225,10 @@ func GetIncomeHistoryByGenesisByHeightRange(cursor, size, blkStartHeight, blkEnd
 		codehashMatch = fmt.Sprintf("codehash = unhex('%s') AND", codehashHex)
 		genesisMatch = fmt.Sprintf("genesis = unhex('%s') AND", genesisHex)
 	}
-	maxOffset := cursor + size
+	desc := !page.IsPrev()
+	order := historyOrder(desc)
+	ks := newHistoryKeyset(page.Token, desc)
+	maxOffset, offset := historyLimits(page)
 	// script_pk -> ''
 	psql := fmt.Sprintf(`
 SELECT txid, idx, address, codehash, genesis, satoshi, script_type, script_pk, height, txidx, io_type, blk.blocktime FROM
@@ -212,18 +236,18 @@ SELECT txid, idx, address, codehash, genesis, satoshi, script_type, script_pk, h
     SELECT utxid AS txid, vout AS idx, address, codehash, genesis, satoshi, script_type, script_pk, height, utxidx AS txidx, 1 AS io_type FROM txout
     WHERE (substring(utxid, 1, 12), vout, height) in (
         SELECT utxid, vout, height FROM txout_genesis_height
-        WHERE height >= %d AND height < %d AND %s %s (address = unhex('%s') %s)
-        ORDER BY height DESC, utxidx DESC, codehash DESC, genesis DESC
+        WHERE height >= %d AND height < %d AND %s %s %s (address = unhex('%s') %s)
+        ORDER BY height %s, utxidx %s, vout %s, codehash %s, genesis %s
         LIMIT %d
-      )
-    ORDER BY height DESC, utxidx DESC
+      ) AND %s 1
+    ORDER BY height %s, utxidx %s, vout %s
     LIMIT %d
 
     UNION ALL
 
     SELECT utxid AS txid, vout AS idx, address, codehash, genesis, satoshi, script_type, script_pk, height, utxidx AS txidx, 1 AS io_type FROM txout
-    WHERE height >= 4294967295 AND height < %d AND %s %s (address = unhex('%s') %s)
-    ORDER BY height DESC, utxidx DESC, codehash DESC, genesis DESC
+    WHERE height >= 4294967295 AND height < %d AND %s %s %s (address = unhex('%s') %s)
+    ORDER BY height %s, utxidx %s, vout %s, codehash %s, genesis %s
     LIMIT %d
 
     UNION ALL
@@ -231,11 +255,11 @@ SELECT txid, idx, address, codehash, genesis, satoshi, script_type, script_pk, h
     SELECT txid, idx, address, codehash, genesis, satoshi, script_type, script_pk, height, txidx, 0 AS io_type FROM txin
     WHERE (substring(txid, 1, 12), height, codehash, genesis) in (
         SELECT utxid, height, codehash, genesis FROM txout_genesis_height
-        WHERE height >= %d AND height < %d AND %s %s (address = unhex('%s') %s)
-        ORDER BY height DESC, utxidx DESC, codehash DESC, genesis DESC
+        WHERE height >= %d AND height < %d AND %s %s %s (address = unhex('%s') %s)
+        ORDER BY height %s, utxidx %s, codehash %s, genesis %s
         LIMIT %d
-      )
-    ORDER BY height DESC, txidx DESC
+      ) AND %s 1
+    ORDER BY height %s, txidx %s, idx %s
     LIMIT %d
 
     UNION ALL
@@ -243,11 +267,11 @@ SELECT txid, idx, address, codehash, genesis, satoshi, script_type, script_pk, h
     SELECT txid, idx, address, codehash, genesis, satoshi, script_type, script_pk, height, txidx, 0 AS io_type FROM txin
     WHERE (txid, height, codehash, genesis) in (
         SELECT utxid, height, codehash, genesis FROM txout
-        WHERE height >= 4294967295 AND height < %d AND %s %s (address = unhex('%s') %s)
-        ORDER BY height DESC, utxidx DESC, codehash DESC, genesis DESC
+        WHERE height >= 4294967295 AND height < %d AND %s %s %s (address = unhex('%s') %s)
+        ORDER BY height %s, utxidx %s, codehash %s, genesis %s
         LIMIT %d
-      )
-    ORDER BY height DESC, txidx DESC
+      ) AND %s 1
+    ORDER BY height %s, txidx %s, idx %s
     LIMIT %d
 
 ) AS history
@@ -256,27 +280,35 @@ LEFT JOIN (
     WHERE height >= %d AND height < %d
 ) AS blk
 USING height
-ORDER BY height DESC, txidx DESC
+ORDER BY height %s, txidx %s, io_type %s, idx %s
 LIMIT %d, %d`,
 		blkStartHeight, blkEndHeight,
-		codehashMatch, genesisMatch, addressHex, addressMatch, maxOffset, maxOffset,
+		codehashMatch, genesisMatch, ks.TxOut, addressHex, addressMatch, order, order, order, order, order, maxOffset,
+		ks.TxOut, order, order, order, maxOffset,
 		blkEndHeight,
-		codehashMatch, genesisMatch, addressHex, addressMatch, maxOffset,
+		codehashMatch, genesisMatch, ks.TxOut, addressHex, addressMatch, order, order, order, order, order, maxOffset,
 
 		blkStartHeight, blkEndHeight,
-		codehashMatch, genesisMatch, addressHex, addressMatch, maxOffset, maxOffset,
+		codehashMatch, genesisMatch, ks.TxBound, addressHex, addressMatch, order, order, order, order, maxOffset,
+		ks.TxIn, order, order, order, maxOffset,
 		blkEndHeight,
-		codehashMatch, genesisMatch, addressHex, addressMatch, maxOffset, maxOffset,
+		codehashMatch, genesisMatch, ks.TxBound, addressHex, addressMatch, order, order, order, order, maxOffset,
+		ks.TxIn, order, order, order, maxOffset,
 
 		blkStartHeight, blkEndHeight,
-		cursor, size)
-	return GetHistoryBySql(psql)
+		order, order, order, order,
+		offset, page.Size)
+	txOutsRsp, err = GetHistoryBySql(ctx, psql)
+	if page.IsPrev() {
+		reverseHistory(txOutsRsp)
+	}
+	return txOutsRsp, err
 }
 
-func GetHistoryBySql(psql string) (txOutHistoriesRsp []*model.TxOutHistoryResp, err error) {
-	txOutsRet, err := clickhouse.ScanAll(psql, txOutHistoryResultSRF)
+func GetHistoryBySql(ctx context.Context, psql string) (txOutHistoriesRsp []*model.TxOutHistoryResp, err error) {
+	txOutsRet, err := clickhouse.ScanAll(ctx, psql, txOutHistoryResultSRF)
 	if err != nil {
-		logger.Log.Info("query tx history by genesis failed", zap.Error(err))
+		logger.Ctx(ctx).Info("query tx history by genesis failed", zap.Error(err))
 		return nil, err
 	}
 	if txOutsRet == nil {
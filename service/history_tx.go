@@ -1,9 +1,11 @@
 package service
 
 import (
+	"context"
 	"encoding/hex"
 	"fmt"
 	"sensiblequery/dao/rdb"
+	"sensiblequery/lib/paging"
 	"sensiblequery/logger"
 	"sensiblequery/model"
 	"strconv"
@@ -14,13 +16,13 @@ import (
 )
 
 ////////////////
-func GetTxsHistoryInfoByAddress(addressPkh []byte) (addrRsp *model.AddressHistoryInfoResp, err error) {
+func GetTxsHistoryInfoByAddress(ctx context.Context, addressPkh []byte) (addrRsp *model.AddressHistoryInfoResp, err error) {
 	historyNum, err := rdb.RdbAddressClient.ZCard(ctx, "{ah"+string(addressPkh)+"}").Result()
 	if err != nil {
-		logger.Log.Info("get historyNum from redis failed", zap.Error(err))
+		logger.Ctx(ctx).Info("get historyNum from redis failed", zap.Error(err))
 		return
 	}
-	logger.Log.Info("historyNum", zap.Int64("n", historyNum))
+	logger.Ctx(ctx).Info("historyNum", zap.Int64("n", historyNum))
 
 	addrRsp = &model.AddressHistoryInfoResp{
 		Total: int(historyNum),
@@ -28,13 +30,29 @@ func GetTxsHistoryInfoByAddress(addressPkh []byte) (addrRsp *model.AddressHistor
 	return addrRsp, nil
 }
 
-func GetTxsHistoryByAddressAndTypeByHeightRangeFromPika(cursor, size int, addressPkh []byte) (txsRsp []*model.TxInfoResp, err error) {
-	addrTxWithHeightHistory, err := rdb.RdbAddressClient.ZRevRange(ctx, "{ah"+string(addressPkh)+"}", int64(cursor), int64(cursor+size)-1).Result()
-	if err == redis.Nil {
-		addrTxWithHeightHistory = nil
-	} else if err != nil {
-		logger.Log.Info("GetTxsHistoryByAddressAndTypeByHeightRangeFromPika failed", zap.Error(err))
-		return
+func GetTxsHistoryByAddressAndTypeByHeightRangeFromPika(ctx context.Context, page paging.Page, addressPkh []byte) (txsRsp []*model.TxInfoResp, next, prev string, err error) {
+	key := "{ah" + string(addressPkh) + "}"
+
+	var addrTxWithHeightHistory []string
+	if page.Token == nil && page.Offset > 0 {
+		// offset分页
+		addrTxWithHeightHistory, err = rdb.RdbAddressClient.ZRevRange(ctx, key, int64(page.Offset), int64(page.Offset+page.Size)-1).Result()
+		if err == redis.Nil {
+			addrTxWithHeightHistory = nil
+		} else if err != nil {
+			logger.Ctx(ctx).Info("GetTxsHistoryByAddressAndTypeByHeightRangeFromPika failed", zap.Error(err))
+			return
+		}
+	} else {
+		positions, err := paging.ZSegmentsPage(ctx, rdb.RdbAddressClient, []paging.ZSegment{{Key: key}}, page)
+		if err != nil {
+			logger.Ctx(ctx).Info("GetTxsHistoryByAddressAndTypeByHeightRangeFromPika failed", zap.Error(err))
+			return nil, "", "", err
+		}
+		for _, pos := range positions {
+			addrTxWithHeightHistory = append(addrTxWithHeightHistory, pos.Member.(string))
+		}
+		next, prev = paging.ZPageLinks(page, positions)
 	}
 
 	for _, historyPosition := range addrTxWithHeightHistory {
@@ -47,17 +65,17 @@ func GetTxsHistoryByAddressAndTypeByHeightRangeFromPika(cursor, size int, addres
 		})
 	}
 
-	return txsRsp, nil
+	return txsRsp, next, prev, nil
 }
 
 //////////////// address
-func GetTxsHistoryByAddressAndTypeByHeightRange(cursor, size int, addressPkh []byte, historyType model.HistoryType) (txsRsp []*model.TxInfoResp, err error) {
-	logger.Log.Info("query txinfo history for",
-		zap.Int("cursor", cursor),
-		zap.Int("size", size),
+func GetTxsHistoryByAddressAndTypeByHeightRange(ctx context.Context, page paging.Page, addressPkh []byte, historyType model.HistoryType) (txsRsp []*model.TxInfoResp, next, prev string, err error) {
+	logger.Ctx(ctx).Info("query txinfo history for",
+		zap.Int("cursor", page.Offset),
+		zap.Int("size", page.Size),
 		zap.String("address", hex.EncodeToString(addressPkh)))
 
-	txsRsp, err = GetTxsHistoryByAddressAndTypeByHeightRangeFromPika(cursor, size, addressPkh)
+	txsRsp, next, prev, err = GetTxsHistoryByAddressAndTypeByHeightRangeFromPika(ctx, page, addressPkh)
 	if err != nil || len(txsRsp) == 0 {
 		return
 	}
@@ -90,12 +108,13 @@ ORDER BY height DESC, txidx DESC
 
 		strings.Join(strHeightTxidList, ","))
 
-	return GetBlockTxsBySql(psql, true)
+	txsRsp, err = GetBlockTxsBySql(ctx, psql, true)
+	return txsRsp, next, prev, err
 }
 
 //////////////// genesis
-func GetTxsHistoryByGenesisByHeightRange(cursor, size, blkStartHeight, blkEndHeight int, codehashHex, genesisHex, addressHex string) (txsRsp []*model.TxInfoResp, err error) {
-	logger.Log.Info("query txinfo history by codehash/genesis for",
+func GetTxsHistoryByGenesisByHeightRange(ctx context.Context, cursor, size, blkStartHeight, blkEndHeight int, codehashHex, genesisHex, addressHex string) (txsRsp []*model.TxInfoResp, err error) {
+	logger.Ctx(ctx).Info("query txinfo history by codehash/genesis for",
 		zap.Int("cursor", cursor),
 		zap.Int("size", size),
 		zap.Int("blkStart", blkStartHeight),
@@ -179,5 +198,5 @@ LIMIT %d, %d
 
 		cursor, size)
 
-	return GetBlockTxsBySql(psql, true)
+	return GetBlockTxsBySql(ctx, psql, true)
 }
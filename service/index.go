@@ -0,0 +1,152 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sensiblequery/lib/metrics"
+	"sensiblequery/logger"
+	"sensiblequery/model"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// IndexLagConf 索引落后检查配置
+type IndexLagConf struct {
+	Interval     time.Duration // 检查间隔
+	MaxLagBlocks int           // 落后节点超过该区块数时为degraded，0为不检查
+	MaxTipAge    time.Duration // 已索引最新区块时间距今超过该时长时为degraded，0为不检查
+}
+
+// NodeHeightFunc 获取节点当前区块高度
+type NodeHeightFunc func(ctx context.Context) (int, error)
+
+var (
+	indexStatus  atomic.Value // *model.IndexStatusResp
+	indexLagConf atomic.Value // *IndexLagConf
+)
+
+// GetIndexStatus 最近一次检查结果，尚未检查时返回nil
+func GetIndexStatus() *model.IndexStatusResp {
+	status, _ := indexStatus.Load().(*model.IndexStatusResp)
+	return status
+}
+
+// IndexHeight 最近一次检查得到的索引高度，尚未检查时返回-1
+func IndexHeight() int {
+	status := GetIndexStatus()
+	if status == nil || status.CheckedAt == 0 {
+		return -1
+	}
+	return status.IndexHeight
+}
+
+// IndexDegraded 索引是否落后超过阈值
+func IndexDegraded() bool {
+	status := GetIndexStatus()
+	return status != nil && status.Degraded
+}
+
+// CheckIndexLag 比较索引与节点的区块高度及最新区块时间。
+// 检查失败时保留上一次的高度，只更新Error
+func CheckIndexLag(ctx context.Context, conf *IndexLagConf, nodeHeight NodeHeightFunc) *model.IndexStatusResp {
+	now := time.Now()
+	status := &model.IndexStatusResp{}
+	if last := GetIndexStatus(); last != nil {
+		*status = *last
+	}
+	status.Error = ""
+
+	fail := func(err error) *model.IndexStatusResp {
+		metrics.IndexCheckErrors.Inc()
+		logger.Ctx(ctx).Info("check index lag failed", zap.Error(err))
+		status.Error = err.Error()
+		indexStatus.Store(status)
+		return status
+	}
+
+	height, err := GetBestBlockHeight(ctx)
+	if err != nil {
+		return fail(err)
+	}
+	blk, err := GetBestBlockByHeight(ctx, height)
+	if err != nil {
+		return fail(fmt.Errorf("best block %d: %w", height, err))
+	}
+	node, err := nodeHeight(ctx)
+	if err != nil {
+		return fail(fmt.Errorf("node height: %w", err))
+	}
+
+	status.IndexHeight = height
+	status.NodeHeight = node
+	status.LagBlocks = node - height
+	if status.LagBlocks < 0 {
+		// 节点落后于索引时不视为索引落后
+		status.LagBlocks = 0
+	}
+	status.TipTime = blk.BlockTime
+	status.TipAge = now.Unix() - int64(blk.BlockTime)
+	status.CheckedAt = now.Unix()
+	status.Degraded = (conf.MaxLagBlocks > 0 && status.LagBlocks > conf.MaxLagBlocks) ||
+		(conf.MaxTipAge > 0 && status.TipAge > int64(conf.MaxTipAge.Seconds()))
+
+	metrics.IndexHeight.Set(float64(status.IndexHeight))
+	metrics.NodeHeight.Set(float64(status.NodeHeight))
+	metrics.IndexLagBlocks.Set(float64(status.LagBlocks))
+	metrics.IndexTipAge.Set(float64(status.TipAge))
+	if status.Degraded {
+		metrics.IndexDegraded.Set(1)
+		logger.Ctx(ctx).Warn("index degraded",
+			zap.Int("indexHeight", status.IndexHeight),
+			zap.Int("nodeHeight", status.NodeHeight),
+			zap.Int64("tipAge", status.TipAge),
+		)
+	} else {
+		metrics.IndexDegraded.Set(0)
+	}
+
+	indexStatus.Store(status)
+	return status
+}
+
+// UpdateNodeHeight 收到节点新区块通知时更新节点高度及落后区块数，不查询索引，
+// 索引追上后由下次检查恢复degraded
+func UpdateNodeHeight(height int) {
+	last := GetIndexStatus()
+	if last == nil || last.CheckedAt == 0 || height <= last.NodeHeight {
+		return
+	}
+	status := *last
+	status.NodeHeight = height
+	status.LagBlocks = height - status.IndexHeight
+	if status.LagBlocks < 0 {
+		status.LagBlocks = 0
+	}
+	if conf, _ := indexLagConf.Load().(*IndexLagConf); conf != nil && conf.MaxLagBlocks > 0 && status.LagBlocks > conf.MaxLagBlocks {
+		status.Degraded = true
+		metrics.IndexDegraded.Set(1)
+	}
+	metrics.NodeHeight.Set(float64(status.NodeHeight))
+	metrics.IndexLagBlocks.Set(float64(status.LagBlocks))
+	indexStatus.Store(&status)
+}
+
+// RunIndexMonitor 定期检查索引落后情况，直到ctx结束
+func RunIndexMonitor(ctx context.Context, conf *IndexLagConf, nodeHeight NodeHeightFunc) {
+	indexLagConf.Store(conf)
+	ticker := time.NewTicker(conf.Interval)
+	defer ticker.Stop()
+	for {
+		cctx, cancel := context.WithTimeout(ctx, conf.Interval)
+		CheckIndexLag(cctx, conf, nodeHeight)
+		cancel()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
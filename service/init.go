@@ -1,9 +0,0 @@
-package service
-
-import (
-	"context"
-)
-
-var (
-	ctx = context.Background()
-)
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"database/sql"
 	"encoding/hex"
 	"errors"
@@ -25,7 +26,7 @@ func nftInfoResultSRF(rows *sql.Rows) (interface{}, error) {
 	return &ret, nil
 }
 
-func getNFTMetaInfo(nftsRsp []*model.NFTInfoResp) {
+func getNFTMetaInfo(ctx context.Context, nftsRsp []*model.NFTInfoResp) {
 	pipe := rdb.BizClient.Pipeline()
 	nftinfoCmds := make([]*redis.StringStringMapCmd, 0)
 	for _, nft := range nftsRsp {
@@ -42,7 +43,7 @@ func getNFTMetaInfo(nftsRsp []*model.NFTInfoResp) {
 		if err == redis.Nil {
 			continue
 		} else if err != nil {
-			logger.Log.Info("getNFTDecimal redis failed", zap.Error(err))
+			logger.Ctx(ctx).Info("getNFTDecimal redis failed", zap.Error(err))
 		}
 		supply, _ := strconv.Atoi(nftinfo["supply"])
 		nft.Supply = supply
@@ -53,7 +54,7 @@ func getNFTMetaInfo(nftsRsp []*model.NFTInfoResp) {
 	}
 }
 
-func ListNFTInfoByGenesis(codeHashHex, genesisHex string) (nftRsp *model.NFTInfoResp, err error) {
+func ListNFTInfoByGenesis(ctx context.Context, codeHashHex, genesisHex string) (nftRsp *model.NFTInfoResp, err error) {
 	psql := fmt.Sprintf(`
 SELECT codehash, genesis, count(1), sum(in_times), sum(out_times), sum(in_satoshi), sum(out_satoshi) FROM (
      SELECT codehash, genesis, nft_idx,
@@ -66,18 +67,18 @@ GROUP BY codehash, genesis
 ORDER BY count(1) DESC
 `, codeHashHex, genesisHex)
 
-	nftsRsp, err := GetNFTInfoBySQL(psql)
+	nftsRsp, err := GetNFTInfoBySQL(ctx, psql)
 	if err != nil {
 		return
 	}
 	if len(nftsRsp) > 0 {
-		getNFTMetaInfo(nftsRsp)
+		getNFTMetaInfo(ctx, nftsRsp)
 		return nftsRsp[0], nil
 	}
 	return nil, errors.New("not exist")
 }
 
-func GetNFTSummary(codeHashHex string) (nftsRsp []*model.NFTInfoResp, err error) {
+func GetNFTSummary(ctx context.Context, codeHashHex string) (nftsRsp []*model.NFTInfoResp, err error) {
 	psql := fmt.Sprintf(`
 SELECT codehash, genesis, count(1), sum(in_times), sum(out_times), sum(in_satoshi), sum(out_satoshi) FROM (
      SELECT codehash, genesis, nft_idx,
@@ -90,15 +91,15 @@ GROUP BY codehash, genesis
 ORDER BY count(1) DESC
 `, codeHashHex)
 
-	nftsRsp, err = GetNFTInfoBySQL(psql)
+	nftsRsp, err = GetNFTInfoBySQL(ctx, psql)
 	if err != nil {
 		return
 	}
-	getNFTMetaInfo(nftsRsp)
+	getNFTMetaInfo(ctx, nftsRsp)
 	return
 }
 
-func GetNFTInfo() (nftsRsp []*model.NFTInfoResp, err error) {
+func GetNFTInfo(ctx context.Context) (nftsRsp []*model.NFTInfoResp, err error) {
 	psql := `
 SELECT codehash, genesis, count(1), sum(in_times), sum(out_times), sum(in_satoshi), sum(out_satoshi) FROM (
      SELECT codehash, genesis, nft_idx,
@@ -110,18 +111,18 @@ SELECT codehash, genesis, count(1), sum(in_times), sum(out_times), sum(in_satosh
 GROUP BY codehash, genesis
 ORDER BY count(1) DESC
 `
-	nftsRsp, err = GetNFTInfoBySQL(psql)
+	nftsRsp, err = GetNFTInfoBySQL(ctx, psql)
 	if err != nil {
 		return
 	}
-	getNFTMetaInfo(nftsRsp)
+	getNFTMetaInfo(ctx, nftsRsp)
 	return
 }
 
-func GetNFTInfoBySQL(psql string) (blksRsp []*model.NFTInfoResp, err error) {
-	blksRet, err := clickhouse.ScanAll(psql, nftInfoResultSRF)
+func GetNFTInfoBySQL(ctx context.Context, psql string) (blksRsp []*model.NFTInfoResp, err error) {
+	blksRet, err := clickhouse.ScanAll(ctx, psql, nftInfoResultSRF)
 	if err != nil {
-		logger.Log.Info("query blk failed", zap.Error(err))
+		logger.Ctx(ctx).Info("query blk failed", zap.Error(err))
 		return nil, err
 	}
 	if blksRet == nil {
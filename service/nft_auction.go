@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"encoding/hex"
 	"sensiblequery/dao/rdb"
 	"sensiblequery/lib/blkparser"
@@ -14,16 +15,16 @@ import (
 )
 
 //////////////// address utxo
-func GetNFTAuctionUtxoByNFTIDMerge(codeHash, nftId []byte, isReadyOnly bool) (nftAuctionsRsp []*model.NFTAuctionResp, err error) {
+func GetNFTAuctionUtxoByNFTIDMerge(ctx context.Context, codeHash, nftId []byte, isReadyOnly bool) (nftAuctionsRsp []*model.NFTAuctionResp, err error) {
 	// fixme: 可能被恶意创建sell utxo
 	key := "mp:nad" + string(codeHash) + string(nftId)
-	respMempool, err := GetNFTAuctionUtxoByKey(key)
+	respMempool, err := GetNFTAuctionUtxoByKey(ctx, key)
 	if err != nil {
 		return nil, err
 	}
 
 	key = "nad" + string(codeHash) + string(nftId)
-	resp, err := GetNFTAuctionUtxoByKey(key)
+	resp, err := GetNFTAuctionUtxoByKey(ctx, key)
 	if err != nil {
 		return nil, err
 	}
@@ -46,13 +47,13 @@ func GetNFTAuctionUtxoByNFTIDMerge(codeHash, nftId []byte, isReadyOnly bool) (nf
 	return
 }
 
-func GetNFTAuctionUtxoByKey(key string) (nftAuctionsRsp []*model.NFTAuctionResp, err error) {
+func GetNFTAuctionUtxoByKey(ctx context.Context, key string) (nftAuctionsRsp []*model.NFTAuctionResp, err error) {
 	utxoOutpoints, err := rdb.BizClient.ZRevRange(ctx, key, 0, 16).Result()
 	if err != nil {
-		logger.Log.Info("GetNFTAuctionUtxoByKey redis failed", zap.Error(err))
+		logger.Ctx(ctx).Info("GetNFTAuctionUtxoByKey redis failed", zap.Error(err))
 		return
 	}
-	nftAuctionsRsp, err = getNFTAuctionUtxoFromRedis(utxoOutpoints)
+	nftAuctionsRsp, err = getNFTAuctionUtxoFromRedis(ctx, utxoOutpoints)
 	if err != nil {
 		return nil, err
 	}
@@ -60,8 +61,8 @@ func GetNFTAuctionUtxoByKey(key string) (nftAuctionsRsp []*model.NFTAuctionResp,
 }
 
 ////////////////
-func getNFTAuctionUtxoFromRedis(utxoOutpoints []string) (nftAuctionsRsp []*model.NFTAuctionResp, err error) {
-	logger.Log.Info("getNFTAuctionUtxoFromRedis redis", zap.Int("nUTXO", len(utxoOutpoints)))
+func getNFTAuctionUtxoFromRedis(ctx context.Context, utxoOutpoints []string) (nftAuctionsRsp []*model.NFTAuctionResp, err error) {
+	logger.Ctx(ctx).Info("getNFTAuctionUtxoFromRedis redis", zap.Int("nUTXO", len(utxoOutpoints)))
 	nftAuctionsRsp = make([]*model.NFTAuctionResp, 0)
 	pipe := rdb.RdbUtxoClient.Pipeline()
 
@@ -78,7 +79,7 @@ func getNFTAuctionUtxoFromRedis(utxoOutpoints []string) (nftAuctionsRsp []*model
 		outpoint := utxoOutpoints[outpointIdx]
 		res, err := data.Result()
 		if err == redis.Nil {
-			logger.Log.Info("redis not found", zap.String("outpoint", hex.EncodeToString([]byte(outpoint))))
+			logger.Ctx(ctx).Info("redis not found", zap.String("outpoint", hex.EncodeToString([]byte(outpoint))))
 			continue
 		} else if err != nil {
 			panic(err)
@@ -114,7 +115,7 @@ func getNFTAuctionUtxoFromRedis(utxoOutpoints []string) (nftAuctionsRsp []*model
 
 			// 设置准备状态
 			contractHashAsAddressPkh := blkparser.GetHash160(txout.PkScript)
-			countRsp, err := GetNFTCountByCodeHashGenesisAddress(
+			countRsp, err := GetNFTCountByCodeHashGenesisAddress(ctx,
 				txo.NFTAuction.NFTCodeHash[:],
 				txo.NFTAuction.NFTID[:], contractHashAsAddressPkh)
 			if err == nil && countRsp.Count+countRsp.PendingCount > 0 {
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"encoding/hex"
 	"sensiblequery/dao/rdb"
 	"sensiblequery/lib/blkparser"
@@ -14,14 +15,14 @@ import (
 	"go.uber.org/zap"
 )
 
-func mergeUtxoByKeys(addressUtxoConfirmed, addressUtxoSpentUnconfirmed, oldUtxoKey, newUtxoKey, finalKey string) (err error) {
+func mergeUtxoByKeys(ctx context.Context, addressUtxoConfirmed, addressUtxoSpentUnconfirmed, oldUtxoKey, newUtxoKey, finalKey string) (err error) {
 	// 注意这里查询需要原子化，可使用pipeline
 	nDiff, err := rdb.BizClient.ZDiffStore(ctx, oldUtxoKey, addressUtxoConfirmed, addressUtxoSpentUnconfirmed).Result()
 	if err != nil {
-		logger.Log.Info("ZDiffStore redis failed", zap.Error(err))
+		logger.Ctx(ctx).Info("ZDiffStore redis failed", zap.Error(err))
 		return
 	}
-	logger.Log.Info("ZDiffStore", zap.Int64("n", nDiff))
+	logger.Ctx(ctx).Info("ZDiffStore", zap.Int64("n", nDiff))
 
 	finalZs := &redis.ZStore{
 		Keys: []string{
@@ -30,17 +31,17 @@ func mergeUtxoByKeys(addressUtxoConfirmed, addressUtxoSpentUnconfirmed, oldUtxoK
 	}
 	nUnion, err := rdb.BizClient.ZUnionStore(ctx, finalKey, finalZs).Result()
 	if err != nil {
-		logger.Log.Info("ZUnionStore redis failed", zap.Error(err))
+		logger.Ctx(ctx).Info("ZUnionStore redis failed", zap.Error(err))
 		return
 	}
-	logger.Log.Info("ZUnionStore", zap.Int64("n", nUnion))
+	logger.Ctx(ctx).Info("ZUnionStore", zap.Int64("n", nUnion))
 
 	return nil
 }
 
 ////////////////
-func getNFTSellUtxoFromRedis(utxoOutpoints []string) (nftSellsRsp []*model.NFTSellResp, err error) {
-	logger.Log.Info("getNFTSellUtxoFromRedis redis", zap.Int("nUTXO", len(utxoOutpoints)))
+func getNFTSellUtxoFromRedis(ctx context.Context, utxoOutpoints []string) (nftSellsRsp []*model.NFTSellResp, err error) {
+	logger.Ctx(ctx).Info("getNFTSellUtxoFromRedis redis", zap.Int("nUTXO", len(utxoOutpoints)))
 	nftSellsRsp = make([]*model.NFTSellResp, 0)
 	pipe := rdb.RdbUtxoClient.Pipeline()
 
@@ -57,7 +58,7 @@ func getNFTSellUtxoFromRedis(utxoOutpoints []string) (nftSellsRsp []*model.NFTSe
 		outpoint := utxoOutpoints[outpointIdx]
 		res, err := data.Result()
 		if err == redis.Nil {
-			logger.Log.Info("redis not found", zap.String("outpoint", hex.EncodeToString([]byte(outpoint))))
+			logger.Ctx(ctx).Info("redis not found", zap.String("outpoint", hex.EncodeToString([]byte(outpoint))))
 			continue
 		} else if err != nil {
 			panic(err)
@@ -83,7 +84,7 @@ func getNFTSellUtxoFromRedis(utxoOutpoints []string) (nftSellsRsp []*model.NFTSe
 
 			// 设置准备状态
 			contractHashAsAddressPkh := blkparser.GetHash160(txout.PkScript)
-			countRsp, err := GetNFTCountByCodeHashGenesisAddress(txo.CodeHash[:], txo.GenesisId[:txo.GenesisIdLen], contractHashAsAddressPkh)
+			countRsp, err := GetNFTCountByCodeHashGenesisAddress(ctx, txo.CodeHash[:], txo.GenesisId[:txo.GenesisIdLen], contractHashAsAddressPkh)
 			if err == nil && countRsp.Count+countRsp.PendingCount > 0 {
 				nftSellRsp.IsReady = true
 			}
@@ -92,12 +93,12 @@ func getNFTSellUtxoFromRedis(utxoOutpoints []string) (nftSellsRsp []*model.NFTSe
 		nftSellsRsp = append(nftSellsRsp, nftSellRsp)
 	}
 
-	getNFTMetaInfoForSell(nftSellsRsp)
+	getNFTMetaInfoForSell(ctx, nftSellsRsp)
 
 	return nftSellsRsp, nil
 }
 
-func getNFTMetaInfoForSell(nftSellsRsp []*model.NFTSellResp) {
+func getNFTMetaInfoForSell(ctx context.Context, nftSellsRsp []*model.NFTSellResp) {
 	pipe := rdb.BizClient.Pipeline()
 	nftInfoCmds := make([]*redis.StringStringMapCmd, 0)
 	for _, nft := range nftSellsRsp {
@@ -119,22 +120,22 @@ func getNFTMetaInfoForSell(nftSellsRsp []*model.NFTSellResp) {
 			nft.MetaTxIdHex = hex.EncodeToString([]byte(nftinfo["metatxid"]))
 			nft.SensibleIdHex = hex.EncodeToString([]byte(nftinfo["sensibleid"]))
 		} else if err == redis.Nil {
-			logger.Log.Info("getNFTMetaInfoForSell nftinfo not found")
+			logger.Ctx(ctx).Info("getNFTMetaInfoForSell nftinfo not found")
 		} else if err != nil {
-			logger.Log.Info("getNFTMetaInfoForSell redis failed", zap.Error(err))
+			logger.Ctx(ctx).Info("getNFTMetaInfoForSell redis failed", zap.Error(err))
 		}
 	}
 }
 
 ////////////////
-func GetNFTSellUtxo(cursor, size int) (nftSellsRsp []*model.NFTSellResp, err error) {
+func GetNFTSellUtxo(ctx context.Context, cursor, size int) (nftSellsRsp []*model.NFTSellResp, err error) {
 	addressUtxoConfirmed := "{sut}"
 	addressUtxoSpentUnconfirmed := "mp:s:{sut}"
 	oldUtxoKey := "mp:t:{sut}"
 	newUtxoKey := "mp:{sut}"
 	finalKey := "mp:z:{sut}"
 
-	if err := mergeUtxoByKeys(addressUtxoConfirmed, addressUtxoSpentUnconfirmed, oldUtxoKey, newUtxoKey, finalKey); err != nil {
+	if err := mergeUtxoByKeys(ctx, addressUtxoConfirmed, addressUtxoSpentUnconfirmed, oldUtxoKey, newUtxoKey, finalKey); err != nil {
 		return nil, err
 	}
 
@@ -142,14 +143,14 @@ func GetNFTSellUtxo(cursor, size int) (nftSellsRsp []*model.NFTSellResp, err err
 	if err == redis.Nil {
 		utxoOutpoints = nil
 	} else if err != nil {
-		logger.Log.Info("GetNFTSellUtxo redis failed", zap.Error(err))
+		logger.Ctx(ctx).Info("GetNFTSellUtxo redis failed", zap.Error(err))
 		return
 	}
-	return getNFTSellUtxoFromRedis(utxoOutpoints)
+	return getNFTSellUtxoFromRedis(ctx, utxoOutpoints)
 }
 
 //////////////// address
-func GetNFTSellUtxoByAddress(cursor, size int, addressPkh []byte) (nftSellsRsp []*model.NFTSellResp, err error) {
+func GetNFTSellUtxoByAddress(ctx context.Context, cursor, size int, addressPkh []byte) (nftSellsRsp []*model.NFTSellResp, err error) {
 	addressKey := string(addressPkh) + "}"
 
 	addressUtxoConfirmed := "{suta" + addressKey
@@ -158,7 +159,7 @@ func GetNFTSellUtxoByAddress(cursor, size int, addressPkh []byte) (nftSellsRsp [
 	newUtxoKey := "mp:{suta" + addressKey
 	finalKey := "mp:z:{suta" + addressKey
 
-	if err := mergeUtxoByKeys(addressUtxoConfirmed, addressUtxoSpentUnconfirmed, oldUtxoKey, newUtxoKey, finalKey); err != nil {
+	if err := mergeUtxoByKeys(ctx, addressUtxoConfirmed, addressUtxoSpentUnconfirmed, oldUtxoKey, newUtxoKey, finalKey); err != nil {
 		return nil, err
 	}
 
@@ -166,14 +167,14 @@ func GetNFTSellUtxoByAddress(cursor, size int, addressPkh []byte) (nftSellsRsp [
 	if err == redis.Nil {
 		utxoOutpoints = nil
 	} else if err != nil {
-		logger.Log.Info("GetNFTSellUtxoByAddress redis failed", zap.Error(err))
+		logger.Ctx(ctx).Info("GetNFTSellUtxoByAddress redis failed", zap.Error(err))
 		return
 	}
-	return getNFTSellUtxoFromRedis(utxoOutpoints)
+	return getNFTSellUtxoFromRedis(ctx, utxoOutpoints)
 }
 
 //////////////// genesisId
-func GetNFTSellUtxoByGenesis(cursor, size int, codeHash, genesisId []byte) (nftSellsRsp []*model.NFTSellResp, err error) {
+func GetNFTSellUtxoByGenesis(ctx context.Context, cursor, size int, codeHash, genesisId []byte) (nftSellsRsp []*model.NFTSellResp, err error) {
 	genesisKey := string(genesisId) + string(codeHash) + "}"
 
 	addressUtxoConfirmed := "{sutc" + genesisKey
@@ -182,7 +183,7 @@ func GetNFTSellUtxoByGenesis(cursor, size int, codeHash, genesisId []byte) (nftS
 	newUtxoKey := "mp:{sutc" + genesisKey
 	finalKey := "mp:z:{sutc" + genesisKey
 
-	if err := mergeUtxoByKeys(addressUtxoConfirmed, addressUtxoSpentUnconfirmed, oldUtxoKey, newUtxoKey, finalKey); err != nil {
+	if err := mergeUtxoByKeys(ctx, addressUtxoConfirmed, addressUtxoSpentUnconfirmed, oldUtxoKey, newUtxoKey, finalKey); err != nil {
 		return nil, err
 	}
 
@@ -190,23 +191,23 @@ func GetNFTSellUtxoByGenesis(cursor, size int, codeHash, genesisId []byte) (nftS
 	if err == redis.Nil {
 		utxoOutpoints = nil
 	} else if err != nil {
-		logger.Log.Info("GetNFTSellUtxoByGenesis redis failed", zap.Error(err))
+		logger.Ctx(ctx).Info("GetNFTSellUtxoByGenesis redis failed", zap.Error(err))
 		return
 	}
-	return getNFTSellUtxoFromRedis(utxoOutpoints)
+	return getNFTSellUtxoFromRedis(ctx, utxoOutpoints)
 }
 
 //////////////// address utxo
-func GetNFTSellUtxoByTokenIndexMerge(codeHash, genesisId []byte, tokenIndex string, isReadyOnly bool) (nftSellsRsp []*model.NFTSellResp, err error) {
+func GetNFTSellUtxoByTokenIndexMerge(ctx context.Context, codeHash, genesisId []byte, tokenIndex string, isReadyOnly bool) (nftSellsRsp []*model.NFTSellResp, err error) {
 	// fixme: 可能被恶意创建sell utxo
 	key := "mp:{suic" + string(genesisId) + string(codeHash) + "}"
-	respMp, err := GetNFTSellUtxoByTokenIndex(key, tokenIndex)
+	respMp, err := GetNFTSellUtxoByTokenIndex(ctx, key, tokenIndex)
 	if err != nil {
 		return nil, err
 	}
 
 	key = "{suic" + string(genesisId) + string(codeHash) + "}"
-	resp, err := GetNFTSellUtxoByTokenIndex(key, tokenIndex)
+	resp, err := GetNFTSellUtxoByTokenIndex(ctx, key, tokenIndex)
 	if err != nil {
 		return nil, err
 	}
@@ -229,7 +230,7 @@ func GetNFTSellUtxoByTokenIndexMerge(codeHash, genesisId []byte, tokenIndex stri
 	return
 }
 
-func GetNFTSellUtxoByTokenIndex(key string, tokenIndex string) (nftSellsRsp []*model.NFTSellResp, err error) {
+func GetNFTSellUtxoByTokenIndex(ctx context.Context, key string, tokenIndex string) (nftSellsRsp []*model.NFTSellResp, err error) {
 	op := &redis.ZRangeBy{
 		Min:    tokenIndex, // 最小分数
 		Max:    tokenIndex, // 最大分数
@@ -238,10 +239,10 @@ func GetNFTSellUtxoByTokenIndex(key string, tokenIndex string) (nftSellsRsp []*m
 	}
 	utxoOutpoints, err := rdb.BizClient.ZRangeByScore(ctx, key, op).Result()
 	if err != nil {
-		logger.Log.Info("GetUtxoByTokenIndex redis failed", zap.Error(err))
+		logger.Ctx(ctx).Info("GetUtxoByTokenIndex redis failed", zap.Error(err))
 		return
 	}
-	nftSellsRsp, err = getNFTSellUtxoFromRedis(utxoOutpoints)
+	nftSellsRsp, err = getNFTSellUtxoFromRedis(ctx, utxoOutpoints)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"fmt"
+	"sensiblequery/lib/paging"
+	"sensiblequery/model"
+	"strconv"
+	"strings"
+)
+
+//////////////// history keyset
+// historyKeyset 历史记录按(height, txidx, io_type, idx)的keyset分页过滤条件，均带前导AND
+type historyKeyset struct {
+	TxOut   string // txout行
+	TxIn    string // txin行
+	TxBound string // 按tx(height, utxidx)粗过滤
+}
+
+func tupleCmp(cols []string, op string, vals ...int) string {
+	strVals := make([]string, len(vals))
+	for idx, v := range vals {
+		strVals[idx] = strconv.Itoa(v)
+	}
+	return fmt.Sprintf("(%s) %s (%s)", strings.Join(cols, ", "), op, strings.Join(strVals, ", "))
+}
+
+// newHistoryKeyset 生成位于tok之后的记录的过滤条件，desc为遍历方向
+func newHistoryKeyset(tok *paging.Token, desc bool) (ks historyKeyset) {
+	if tok == nil {
+		return
+	}
+	lt, le, heightOp := "<", "<=", "<="
+	if !desc {
+		lt, le, heightOp = ">", ">=", ">="
+	}
+
+	outCols := []string{"height", "utxidx", "vout"}
+	inCols := []string{"height", "txidx", "idx"}
+	heightBound := fmt.Sprintf("height %s %d AND ", heightOp, tok.Height)
+
+	// 降序时同一tx内先输出(io_type=1)后输入(io_type=0)，升序反之
+	outputsFirst := desc
+	atOutput := tok.IOType == 1
+	switch {
+	case atOutput:
+		ks.TxOut = tupleCmp(outCols, lt, tok.Height, tok.TxIdx, tok.Idx)
+		if outputsFirst {
+			ks.TxIn = tupleCmp(inCols[:2], le, tok.Height, tok.TxIdx)
+		} else {
+			ks.TxIn = tupleCmp(inCols[:2], lt, tok.Height, tok.TxIdx)
+		}
+	default:
+		ks.TxIn = tupleCmp(inCols, lt, tok.Height, tok.TxIdx, tok.Idx)
+		if outputsFirst {
+			ks.TxOut = tupleCmp(outCols[:2], lt, tok.Height, tok.TxIdx)
+		} else {
+			ks.TxOut = tupleCmp(outCols[:2], le, tok.Height, tok.TxIdx)
+		}
+	}
+	ks.TxOut = heightBound + ks.TxOut + " AND"
+	ks.TxIn = heightBound + ks.TxIn + " AND"
+	ks.TxBound = heightBound + tupleCmp(outCols[:2], le, tok.Height, tok.TxIdx) + " AND"
+	return ks
+}
+
+// historyLimits 返回子查询的limit和最终的offset
+func historyLimits(page paging.Page) (maxOffset, offset int) {
+	if page.Token != nil {
+		return page.Size, 0
+	}
+	return page.Offset + page.Size, page.Offset
+}
+
+func historyOrder(desc bool) string {
+	if desc {
+		return "DESC"
+	}
+	return ""
+}
+
+func reverseHistory(rows []*model.TxOutHistoryResp) {
+	for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+		rows[i], rows[j] = rows[j], rows[i]
+	}
+}
+
+func historyToken(row *model.TxOutHistoryResp) *paging.Token {
+	return &paging.Token{
+		Height: row.Height,
+		TxIdx:  row.Idx,
+		IOType: row.IOType,
+		Idx:    row.Vout,
+	}
+}
+
+// HistoryPageLinks 生成历史记录的前后页游标
+func HistoryPageLinks(page paging.Page, rows []*model.TxOutHistoryResp) (next, prev string) {
+	if len(rows) == 0 {
+		return page.Links(nil, nil, 0)
+	}
+	return page.Links(historyToken(rows[0]), historyToken(rows[len(rows)-1]), len(rows))
+}
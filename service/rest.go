@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"sensiblequery/dao/clickhouse"
+	"sensiblequery/lib/rest"
+	"sensiblequery/logger"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// GetBlockRawTxsRange 区块内txidx在[start, start+count)之间的原始交易
+func GetBlockRawTxsRange(ctx context.Context, blkHeight, start, count int) (rawtxs [][]byte, err error) {
+	psql := fmt.Sprintf(`
+SELECT rawtx FROM blktx_height
+WHERE height = %d AND txidx >= %d AND txidx < %d
+ORDER BY txidx`, blkHeight, start, start+count)
+	rawtxsRet, err := clickhouse.ScanAll(ctx, psql, rawtxResultSRF)
+	if err != nil {
+		logger.Ctx(ctx).Info("query block rawtxs failed", zap.Error(err))
+		return nil, err
+	}
+	if rawtxsRet == nil {
+		return [][]byte{}, nil
+	}
+	return rawtxsRet.([][]byte), nil
+}
+
+func restTxoResultSRF(rows *sql.Rows) (interface{}, error) {
+	var ret rest.Txo
+	err := rows.Scan(&ret.TxId, &ret.Vout, &ret.Value, &ret.Script, &ret.Height)
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+func restSpendResultSRF(rows *sql.Rows) (interface{}, error) {
+	var ret rest.Spend
+	err := rows.Scan(&ret.TxIdPrefix, &ret.Vout, &ret.Height)
+	if err != nil {
+		return nil, err
+	}
+	return &ret, nil
+}
+
+// GetUnspentCoins bitcoind getutxos，返回与outpoints一一对应的utxo，不是utxo的为nil
+func GetUnspentCoins(ctx context.Context, outpoints []*rest.OutPoint, checkMempool bool) (coins []*rest.Coin, err error) {
+	var pairs, txidPrefixes, spentPrefixes []string
+	for _, outpoint := range outpoints {
+		txidHex := hex.EncodeToString(outpoint.TxId)
+		pairs = append(pairs, fmt.Sprintf("(unhex('%s'),%d)", txidHex, outpoint.Vout))
+		txidPrefixes = append(txidPrefixes, fmt.Sprintf("unhex('%s')", txidHex[:24]))
+		spentPrefixes = append(spentPrefixes, fmt.Sprintf("(unhex('%s'),%d)", txidHex[:24], outpoint.Vout))
+	}
+
+	psql := fmt.Sprintf(`
+SELECT utxid, vout, satoshi, script_pk, height FROM txout
+WHERE (utxid, vout) IN (%s) AND
+       (height == 4294967295 OR
+        height IN (
+            SELECT height FROM tx_height
+            WHERE txid IN (%s)
+       ))`, strings.Join(pairs, ","), strings.Join(txidPrefixes, ","))
+	txosRet, err := clickhouse.ScanAll(ctx, psql, restTxoResultSRF)
+	if err != nil {
+		logger.Ctx(ctx).Info("query txout failed", zap.Error(err))
+		return nil, err
+	}
+	var txos []*rest.Txo
+	if txosRet != nil {
+		txos = txosRet.([]*rest.Txo)
+	}
+
+	// txin_spent的utxid为txid前12字节
+	psql = fmt.Sprintf(`
+SELECT utxid, vout, height FROM txin_spent
+WHERE (utxid, vout) IN (%s) AND
+    (height = 4294967295 OR
+     height IN (
+        SELECT height FROM txout_spent_height
+        WHERE (utxid, vout) IN (%s)
+    ))`, strings.Join(spentPrefixes, ","), strings.Join(spentPrefixes, ","))
+	spendsRet, err := clickhouse.ScanAll(ctx, psql, restSpendResultSRF)
+	if err != nil {
+		logger.Ctx(ctx).Info("query txin spent failed", zap.Error(err))
+		return nil, err
+	}
+	var spends []*rest.Spend
+	if spendsRet != nil {
+		spends = spendsRet.([]*rest.Spend)
+	}
+
+	return rest.UnspentCoins(outpoints, txos, spends, checkMempool), nil
+}
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"sensiblequery/dao/rdb"
+	"sensiblequery/logger"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+)
+
+// 退出时未完成的本地广播任务，保存在user redis中，启动后重新执行
+const pendingBroadcastKey = "broadcast:pending"
+
+var draining int32
+
+// SetDraining 收到退出信号，就绪检查开始失败
+func SetDraining() {
+	atomic.StoreInt32(&draining, 1)
+}
+
+// Draining 是否正在退出
+func Draining() bool {
+	return atomic.LoadInt32(&draining) == 1
+}
+
+// BroadcastJob 一个待推送到本地节点的交易
+type BroadcastJob struct {
+	TxId  string `json:"txid"`
+	TxHex string `json:"txHex"`
+}
+
+// SavePendingBroadcasts 保存未完成的广播任务
+func SavePendingBroadcasts(ctx context.Context, jobs []*BroadcastJob) error {
+	if len(jobs) == 0 {
+		return nil
+	}
+	values := make([]interface{}, 0, len(jobs))
+	for _, job := range jobs {
+		data, err := json.Marshal(job)
+		if err != nil {
+			return err
+		}
+		values = append(values, data)
+	}
+	return rdb.UserClient.RPush(ctx, pendingBroadcastKey, values...).Err()
+}
+
+// TakePendingBroadcasts 取出并删除所有保存的广播任务
+func TakePendingBroadcasts(ctx context.Context) (jobs []*BroadcastJob, err error) {
+	pipe := rdb.UserClient.TxPipeline()
+	listCmd := pipe.LRange(ctx, pendingBroadcastKey, 0, -1)
+	pipe.Del(ctx, pendingBroadcastKey)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+
+	for _, data := range listCmd.Val() {
+		job := &BroadcastJob{}
+		if err := json.Unmarshal([]byte(data), job); err != nil {
+			logger.Ctx(ctx).Info("invalid pending broadcast", zap.String("data", data), zap.Error(err))
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
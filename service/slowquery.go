@@ -0,0 +1,199 @@
+package service
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"sensiblequery/dao/clickhouse"
+	"sensiblequery/dao/rdb"
+	"sensiblequery/lib/tracing"
+	"sensiblequery/logger"
+	"sensiblequery/model"
+	"sort"
+	"strconv"
+	"time"
+
+	redis "github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+// 慢查询统计在user redis中的key，使用{slowsql}保证cluster下在同一slot:
+//
+//	{slowsql}:z       zset，指纹hash，分数为累计耗时(毫秒)
+//	{slowsql}:<hash>  hash，指纹统计
+const (
+	slowQueryZKey   = "{slowsql}:z"
+	slowQueryPrefix = "{slowsql}:"
+	slowQueryKeep   = 1000
+	slowQueryTTL    = 7 * 24 * 3600
+
+	// system.query_log刷新间隔默认7.5秒
+	queryLogDelay = 10 * time.Second
+)
+
+var slowQueryScript = redis.NewScript(`
+local ms = tonumber(ARGV[7])
+local rows = tonumber(ARGV[8])
+redis.call('ZINCRBY', KEYS[1], ms, ARGV[1])
+redis.call('HSET', KEYS[2], 'fingerprint', ARGV[2], 'sql', ARGV[3], 'route', ARGV[4], 'op', ARGV[5], 'lastAt', ARGV[6])
+redis.call('HINCRBY', KEYS[2], 'count', 1)
+redis.call('HINCRBY', KEYS[2], 'totalMs', ms)
+if tonumber(redis.call('HGET', KEYS[2], 'maxMs') or '0') < ms then
+    redis.call('HSET', KEYS[2], 'maxMs', ms)
+end
+if tonumber(redis.call('HGET', KEYS[2], 'maxRows') or '0') < rows then
+    redis.call('HSET', KEYS[2], 'maxRows', rows)
+end
+if ARGV[9] ~= '' then
+    redis.call('HINCRBY', KEYS[2], 'errors', 1)
+    redis.call('HSET', KEYS[2], 'lastError', ARGV[9])
+end
+redis.call('EXPIRE', KEYS[2], ARGV[10])
+local n = redis.call('ZCARD', KEYS[1])
+if n > tonumber(ARGV[11]) then
+    redis.call('ZREMRANGEBYRANK', KEYS[1], 0, n - tonumber(ARGV[11]) - 1)
+end
+return 1
+`)
+
+// 同时查询system.query_log的数量
+var queryLogSem = make(chan struct{}, 4)
+
+func init() {
+	clickhouse.OnSlowQuery = recordSlowQuery
+}
+
+func slowQueryHash(fingerprint string) string {
+	h := sha1.Sum([]byte(fingerprint))
+	return hex.EncodeToString(h[:8])
+}
+
+// recordSlowQuery 记录慢查询日志并按SQL指纹累计
+func recordSlowQuery(ctx context.Context, q *clickhouse.SlowQuery) {
+	// 请求可能已结束，统计不随请求取消
+	ctx = tracing.Detach(ctx)
+	fingerprint := clickhouse.SqlFingerprint(q.Sql)
+	hash := slowQueryHash(fingerprint)
+	errMsg := ""
+	if q.Err != nil {
+		errMsg = q.Err.Error()
+	}
+	logger.Ctx(ctx).Warn("slow query",
+		zap.String("op", q.Op),
+		zap.String("sql", q.Sql),
+		zap.String("hash", hash),
+		zap.String("route", q.Route),
+		zap.String("replica", q.Replica),
+		zap.Duration("duration", q.Duration),
+		zap.Int("rows", q.Rows),
+		zap.String("error", errMsg),
+	)
+
+	err := slowQueryScript.Run(ctx, rdb.UserClient, []string{slowQueryZKey, slowQueryPrefix + hash},
+		hash, fingerprint, q.Sql, q.Route, q.Op, q.Start.Unix(), q.Duration.Milliseconds(), q.Rows,
+		errMsg, slowQueryTTL, slowQueryKeep).Err()
+	if err != nil {
+		logger.Ctx(ctx).Info("record slow query failed", zap.Error(err))
+		return
+	}
+
+	if !clickhouse.QueryLogEnabled || q.Replica == "" {
+		return
+	}
+	select {
+	case queryLogSem <- struct{}{}:
+	default:
+		return
+	}
+	go func() {
+		defer func() { <-queryLogSem }()
+		time.Sleep(queryLogDelay)
+		recordQueryLogStat(ctx, hash, q)
+	}()
+}
+
+// recordQueryLogStat 从system.query_log补充读取行数等统计
+func recordQueryLogStat(ctx context.Context, hash string, q *clickhouse.SlowQuery) {
+	stat, err := clickhouse.GetQueryLogStat(ctx, q.Replica, q.Sent, q.Start)
+	if err != nil {
+		logger.Ctx(ctx).Info("get query_log failed", zap.Error(err))
+		return
+	}
+	if stat == nil {
+		return
+	}
+	logger.Ctx(ctx).Info("slow query stat",
+		zap.String("hash", hash),
+		zap.Int64("readRows", stat.ReadRows),
+		zap.Int64("readBytes", stat.ReadBytes),
+		zap.Int64("memoryUsage", stat.MemoryUsage),
+	)
+	err = rdb.UserClient.HSet(ctx, slowQueryPrefix+hash,
+		"readRows", stat.ReadRows,
+		"readBytes", stat.ReadBytes,
+		"memoryUsage", stat.MemoryUsage,
+	).Err()
+	if err != nil {
+		logger.Ctx(ctx).Info("record slow query stat failed", zap.Error(err))
+	}
+}
+
+// ListSlowQueries 按sort(total/count/max)排序返回前limit个慢查询指纹
+func ListSlowQueries(ctx context.Context, sortBy string, limit int) (queriesRsp []*model.SlowQueryResp, err error) {
+	hashes, err := rdb.UserClient.ZRevRange(ctx, slowQueryZKey, 0, -1).Result()
+	if err != nil {
+		logger.Ctx(ctx).Info("list slow queries failed", zap.Error(err))
+		return nil, err
+	}
+
+	pipe := rdb.UserClient.Pipeline()
+	cmds := make([]*redis.StringStringMapCmd, len(hashes))
+	for idx, hash := range hashes {
+		cmds[idx] = pipe.HGetAll(ctx, slowQueryPrefix+hash)
+	}
+	if _, err = pipe.Exec(ctx); err != nil && err != redis.Nil {
+		logger.Ctx(ctx).Info("get slow queries failed", zap.Error(err))
+		return nil, err
+	}
+
+	queriesRsp = make([]*model.SlowQueryResp, 0, len(hashes))
+	for idx, cmd := range cmds {
+		info := cmd.Val()
+		if len(info) == 0 {
+			// 统计已过期
+			continue
+		}
+		num := func(field string) int64 {
+			n, _ := strconv.ParseInt(info[field], 10, 64)
+			return n
+		}
+		queriesRsp = append(queriesRsp, &model.SlowQueryResp{
+			Hash:        hashes[idx],
+			Fingerprint: info["fingerprint"],
+			Sql:         info["sql"],
+			Op:          info["op"],
+			Route:       info["route"],
+			Count:       num("count"),
+			Errors:      num("errors"),
+			TotalMs:     num("totalMs"),
+			MaxMs:       num("maxMs"),
+			MaxRows:     num("maxRows"),
+			ReadRows:    num("readRows"),
+			ReadBytes:   num("readBytes"),
+			MemoryUsage: num("memoryUsage"),
+			LastError:   info["lastError"],
+			LastAt:      num("lastAt"),
+		})
+	}
+
+	switch sortBy {
+	case "count":
+		sort.SliceStable(queriesRsp, func(i, j int) bool { return queriesRsp[i].Count > queriesRsp[j].Count })
+	case "max":
+		sort.SliceStable(queriesRsp, func(i, j int) bool { return queriesRsp[i].MaxMs > queriesRsp[j].MaxMs })
+	}
+	if len(queriesRsp) > limit {
+		queriesRsp = queriesRsp[:limit]
+	}
+	return queriesRsp, nil
+}
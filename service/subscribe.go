@@ -0,0 +1,264 @@
+package service
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"sensiblequery/dao/rdb"
+	"sensiblequery/lib/blkparser"
+	"sensiblequery/lib/metrics"
+	"sensiblequery/lib/utils"
+	"sensiblequery/lib/utxoset"
+	"sensiblequery/logger"
+	"sensiblequery/model"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// 轮询订阅地址的utxo集合的间隔
+	subscribePollInterval = time.Second
+	// 已确认utxo超过该数量的地址不比较已确认集合的成员
+	subscribeMaxConfirmed = 10000
+	// 每个连接待发送的事件数，超过时关闭连接
+	subscriberBuffer = 256
+	// MaxSubscribeAddresses 每个连接最多订阅的地址数
+	MaxSubscribeAddresses = 100
+)
+
+var (
+	ErrTooManyAddresses = errors.New("too many addresses")
+	ErrSubscriberClosed = errors.New("subscriber closed")
+)
+
+// Subscriber 一个连接的地址订阅。C在连接取消订阅、推送过慢或服务退出时关闭，原因见Reason
+type Subscriber struct {
+	C chan *model.AddressEventResp
+
+	addresses map[string]bool // addressPkh
+	closed    bool
+	reason    string
+}
+
+type watchedAddress struct {
+	address    string
+	addressPkh []byte
+	subs       map[*Subscriber]bool
+	snap       *utxoset.Snapshot
+}
+
+// 所有订阅，Subscriber的状态也由mu保护
+var subHub = struct {
+	mu      sync.Mutex
+	watched map[string]*watchedAddress
+	closed  bool
+}{watched: map[string]*watchedAddress{}}
+
+func NewSubscriber() *Subscriber {
+	return &Subscriber{
+		C:         make(chan *model.AddressEventResp, subscriberBuffer),
+		addresses: map[string]bool{},
+	}
+}
+
+// Reason C关闭的原因
+func (s *Subscriber) Reason() string {
+	subHub.mu.Lock()
+	defer subHub.mu.Unlock()
+	return s.reason
+}
+
+// Count 订阅的地址数
+func (s *Subscriber) Count() int {
+	subHub.mu.Lock()
+	defer subHub.mu.Unlock()
+	return len(s.addresses)
+}
+
+// Subscribe 订阅地址，已订阅的忽略
+func (s *Subscriber) Subscribe(addressPkh []byte) error {
+	subHub.mu.Lock()
+	defer subHub.mu.Unlock()
+	if s.closed || subHub.closed {
+		return ErrSubscriberClosed
+	}
+	key := string(addressPkh)
+	if s.addresses[key] {
+		return nil
+	}
+	if len(s.addresses) >= MaxSubscribeAddresses {
+		return ErrTooManyAddresses
+	}
+	w, ok := subHub.watched[key]
+	if !ok {
+		w = &watchedAddress{
+			address:    utils.EncodeAddress(addressPkh, utils.PubKeyHashAddrID),
+			addressPkh: addressPkh,
+			subs:       map[*Subscriber]bool{},
+		}
+		subHub.watched[key] = w
+		metrics.SubscribedAddresses.Set(float64(len(subHub.watched)))
+	}
+	w.subs[s] = true
+	s.addresses[key] = true
+	return nil
+}
+
+// Unsubscribe 取消订阅地址
+func (s *Subscriber) Unsubscribe(addressPkh []byte) {
+	subHub.mu.Lock()
+	defer subHub.mu.Unlock()
+	s.unsubscribeLocked(string(addressPkh))
+}
+
+func (s *Subscriber) unsubscribeLocked(key string) {
+	delete(s.addresses, key)
+	if w, ok := subHub.watched[key]; ok {
+		delete(w.subs, s)
+		if len(w.subs) == 0 {
+			delete(subHub.watched, key)
+			metrics.SubscribedAddresses.Set(float64(len(subHub.watched)))
+		}
+	}
+}
+
+// Close 取消所有订阅并关闭C
+func (s *Subscriber) Close() {
+	subHub.mu.Lock()
+	defer subHub.mu.Unlock()
+	s.closeLocked("closed")
+}
+
+func (s *Subscriber) closeLocked(reason string) {
+	if s.closed {
+		return
+	}
+	for key := range s.addresses {
+		s.unsubscribeLocked(key)
+	}
+	s.closed = true
+	s.reason = reason
+	close(s.C)
+}
+
+// sendLocked 不阻塞轮询，连接来不及发送时关闭
+func (s *Subscriber) sendLocked(event *model.AddressEventResp) {
+	if s.closed {
+		return
+	}
+	select {
+	case s.C <- event:
+		metrics.SubscriptionEvents.WithLabelValues(event.Type).Inc()
+	default:
+		logger.Log.Info("subscriber too slow, closed", zap.Int("addresses", len(s.addresses)))
+		s.closeLocked("too slow")
+	}
+}
+
+// CloseSubscriptions 服务退出，关闭所有地址及区块订阅连接
+func CloseSubscriptions() {
+	subHub.mu.Lock()
+	subHub.closed = true
+	for _, w := range subHub.watched {
+		for s := range w.subs {
+			s.closeLocked("shutting down")
+		}
+	}
+	subHub.mu.Unlock()
+	closeBlockSubscribers()
+}
+
+// StartSubscriptions 定期比较所有订阅地址的utxo集合并推送变化，直到ctx结束
+func StartSubscriptions(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(subscribePollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			start := time.Now()
+			pollSubscriptions(ctx)
+			metrics.SubscriptionPoll.Observe(time.Since(start).Seconds())
+		}
+	}()
+}
+
+func pollSubscriptions(ctx context.Context) {
+	subHub.mu.Lock()
+	watched := make([]*watchedAddress, 0, len(subHub.watched))
+	for _, w := range subHub.watched {
+		watched = append(watched, w)
+	}
+	subHub.mu.Unlock()
+
+	height := IndexHeight()
+	for _, w := range watched {
+		if ctx.Err() != nil {
+			return
+		}
+		src := utxoset.NewRedis(rdb.BizClient, rdb.RdbUtxoClient, nil, nil, w.addressPkh, "au")
+		// w.snap只在轮询中修改
+		snap, err := src.Snapshot(ctx, w.snap, height, subscribeMaxConfirmed)
+		if err != nil {
+			logger.Ctx(ctx).Info("subscription snapshot failed", zap.String("address", w.address), zap.Error(err))
+			continue
+		}
+
+		prev := w.snap
+		w.snap = snap
+		if prev == nil {
+			continue
+		}
+		events := addressEvents(w.address, prev, snap)
+		if len(events) == 0 {
+			continue
+		}
+
+		subHub.mu.Lock()
+		for s := range w.subs {
+			for _, event := range events {
+				s.sendLocked(event)
+			}
+		}
+		subHub.mu.Unlock()
+	}
+}
+
+func snapshotBalance(address string, snap *utxoset.Snapshot) *model.BalanceResp {
+	return &model.BalanceResp{
+		Address:        address,
+		Satoshi:        snap.Satoshi,
+		PendingSatoshi: snap.Pending,
+		UtxoCount:      int(snap.ConfirmedCount) + len(snap.Unconfirmed) - len(snap.SpentUnconfirmed),
+	}
+}
+
+// addressEvents utxo变化事件，余额变化时最后附balance事件
+func addressEvents(address string, prev, cur *utxoset.Snapshot) (events []*model.AddressEventResp) {
+	for _, change := range utxoset.Diff(prev, cur) {
+		if len(change.Outpoint) != 36 {
+			continue
+		}
+		txid := []byte(change.Outpoint[:32])
+		vout := int(binary.LittleEndian.Uint32([]byte(change.Outpoint[32:])))
+		events = append(events, &model.AddressEventResp{
+			Type:    change.Type,
+			Address: address,
+			TxId:    blkparser.HashString(txid),
+			Vout:    &vout,
+		})
+	}
+	if prev.Satoshi != cur.Satoshi || prev.Pending != cur.Pending {
+		events = append(events, &model.AddressEventResp{
+			Type:    model.EventBalance,
+			Address: address,
+			Balance: snapshotBalance(address, cur),
+		})
+	}
+	return events
+}
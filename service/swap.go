@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"sensiblequery/dao/clickhouse"
@@ -20,7 +21,7 @@ func contractSwapDataResultSRF(rows *sql.Rows) (interface{}, error) {
 	return &ret, nil
 }
 
-func GetContractSwapDataInBlocksByHeightRange(cursor, size, blkStartHeight, blkEndHeight int, codeHashHex, genesisHex string, codeType uint32) (blksRsp []*model.ContractSwapDataResp, err error) {
+func GetContractSwapDataInBlocksByHeightRange(ctx context.Context, cursor, size, blkStartHeight, blkEndHeight int, codeHashHex, genesisHex string, codeType uint32) (blksRsp []*model.ContractSwapDataResp, err error) {
 	if blkEndHeight == 0 {
 		blkEndHeight = 4294967295 + 1 // enable mempool
 	}
@@ -34,10 +35,28 @@ ORDER BY height DESC, txidx DESC
 LIMIT %d, %d`,
 		blkStartHeight, blkEndHeight,
 		codeType, codeHashHex, genesisHex, cursor, size)
+	return getContractSwapData(ctx, psql)
+}
+
+// getContractSwapDataAfter 按高度、txidx顺序读取(height, txidx)之后已确认的swap操作
+func getContractSwapDataAfter(ctx context.Context, height, txidx, size int, codeHashHex, genesisHex string, codeType uint32) (blksRsp []*model.ContractSwapDataResp, err error) {
+	psql := fmt.Sprintf(`
+SELECT height, blocktime, code_type, operation, in_value1, in_value2, in_value3, out_value1, out_value2, out_value3, txidx, txid FROM blktx_contract_height
+WHERE height >= %d AND height < 4294967295 AND (height > %d OR txidx > %d) AND
+    code_type = %d AND
+     codehash = unhex('%s') AND
+      genesis = unhex('%s')
+ORDER BY height ASC, txidx ASC
+LIMIT %d`,
+		height, height, txidx,
+		codeType, codeHashHex, genesisHex, size)
+	return getContractSwapData(ctx, psql)
+}
 
-	blksRet, err := clickhouse.ScanAll(psql, contractSwapDataResultSRF)
+func getContractSwapData(ctx context.Context, psql string) (blksRsp []*model.ContractSwapDataResp, err error) {
+	blksRet, err := clickhouse.ScanAll(ctx, psql, contractSwapDataResultSRF)
 	if err != nil {
-		logger.Log.Info("query blk failed", zap.Error(err))
+		logger.Ctx(ctx).Info("query blk failed", zap.Error(err))
 		return nil, err
 	}
 	if blksRet == nil {
@@ -74,7 +93,7 @@ func contractSwapAggregateResultSRF(rows *sql.Rows) (interface{}, error) {
 	return &ret, nil
 }
 
-func GetContractSwapAggregateInBlocksByHeightRange(interval, blkStartHeight, blkEndHeight int, codeHashHex, genesisHex string, codeType uint32) (blksRsp []*model.ContractSwapAggregateResp, err error) {
+func GetContractSwapAggregateInBlocksByHeightRange(ctx context.Context, interval, blkStartHeight, blkEndHeight int, codeHashHex, genesisHex string, codeType uint32) (blksRsp []*model.ContractSwapAggregateResp, err error) {
 	if blkEndHeight == 0 {
 		blkEndHeight = 4294967295 // disable mempool
 	}
@@ -119,9 +138,9 @@ ORDER BY height DESC
 		blkStartHeight, blkEndHeight, codeType, codeHashHex, genesisHex,
 		blkStartHeight, blkEndHeight)
 
-	blksRet, err := clickhouse.ScanAll(psql, contractSwapAggregateResultSRF)
+	blksRet, err := clickhouse.ScanAll(ctx, psql, contractSwapAggregateResultSRF)
 	if err != nil {
-		logger.Log.Info("query blk failed", zap.Error(err))
+		logger.Ctx(ctx).Info("query blk failed", zap.Error(err))
 		return nil, err
 	}
 	if blksRet == nil {
@@ -155,7 +174,7 @@ func contractSwapAggregateAmountResultSRF(rows *sql.Rows) (interface{}, error) {
 	return &ret, nil
 }
 
-func GetContractSwapAggregateAmountInBlocksByHeightRange(interval, blkStartHeight, blkEndHeight int, codeHashHex, genesisHex string, codeType uint32) (blksRsp []*model.ContractSwapAggregateAmountResp, err error) {
+func GetContractSwapAggregateAmountInBlocksByHeightRange(ctx context.Context, interval, blkStartHeight, blkEndHeight int, codeHashHex, genesisHex string, codeType uint32) (blksRsp []*model.ContractSwapAggregateAmountResp, err error) {
 	if blkEndHeight == 0 {
 		blkEndHeight = 4294967295 // disable mempool
 	}
@@ -196,9 +215,9 @@ ORDER BY height DESC
 		blkStartHeight, blkEndHeight, codeType, codeHashHex, genesisHex,
 		blkStartHeight, blkEndHeight)
 
-	blksRet, err := clickhouse.ScanAll(psql, contractSwapAggregateAmountResultSRF)
+	blksRet, err := clickhouse.ScanAll(ctx, psql, contractSwapAggregateAmountResultSRF)
 	if err != nil {
-		logger.Log.Info("query swap aggregate amount failed", zap.Error(err))
+		logger.Ctx(ctx).Info("query swap aggregate amount failed", zap.Error(err))
 		return nil, err
 	}
 	if blksRet == nil {
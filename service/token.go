@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"encoding/hex"
 	"sensiblequery/dao/rdb"
 	"sensiblequery/lib/utils"
@@ -14,13 +15,13 @@ import (
 
 ////////////////
 // ft balance
-func GetTokenOwnersByCodeHashGenesis(cursor, size int, codeHash, genesisId []byte) (ftOwnersRsp []*model.FTOwnerBalanceResp, err error) {
+func GetTokenOwnersByCodeHashGenesis(ctx context.Context, cursor, size int, codeHash, genesisId []byte) (ftOwnersRsp []*model.FTOwnerBalanceResp, err error) {
 	// get decimal from f info
 	decimal, err := rdb.BizClient.HGet(ctx, "fi"+string(codeHash)+string(genesisId), "decimal").Int()
 	if err == redis.Nil {
 		decimal = 0
 	} else if err != nil {
-		logger.Log.Info("GetTokenOwnersByCodeHashGenesis decimal, but redis failed", zap.Error(err))
+		logger.Ctx(ctx).Info("GetTokenOwnersByCodeHashGenesis decimal, but redis failed", zap.Error(err))
 		return
 	}
 
@@ -39,21 +40,21 @@ func GetTokenOwnersByCodeHashGenesis(cursor, size int, codeHash, genesisId []byt
 	// 合并已确认余额和未确认余额
 	nUnion, err := rdb.BizClient.ZUnionStore(ctx, finalKey, finalZs).Result()
 	if err != nil {
-		logger.Log.Info("ZUnionStore redis failed", zap.Error(err))
+		logger.Ctx(ctx).Info("ZUnionStore redis failed", zap.Error(err))
 		return
 	}
-	logger.Log.Info("ZUnionStore", zap.Int64("n", nUnion))
+	logger.Ctx(ctx).Info("ZUnionStore", zap.Int64("n", nUnion))
 
 	vals, err := rdb.BizClient.ZRevRangeWithScores(ctx, finalKey, int64(cursor), int64(cursor+size-1)).Result()
 	if err != nil {
-		logger.Log.Info("GetFTOwnersByCodeHashGenesis redis failed", zap.Error(err))
+		logger.Ctx(ctx).Info("GetFTOwnersByCodeHashGenesis redis failed", zap.Error(err))
 		return
 	}
 
 	pipe := rdb.BizClient.Pipeline()
 	pendingBalanceCmds := make([]*redis.FloatCmd, 0)
 	for _, val := range vals {
-		logger.Log.Info("GetFTOwnersByCodeHashGenesis", zap.Float64("balance", val.Score))
+		logger.Ctx(ctx).Info("GetFTOwnersByCodeHashGenesis", zap.Float64("balance", val.Score))
 		pendingBalanceCmds = append(pendingBalanceCmds, pipe.ZScore(ctx, newKey, val.Member.(string)))
 	}
 	_, err = pipe.Exec(ctx)
@@ -82,7 +83,7 @@ func GetTokenOwnersByCodeHashGenesis(cursor, size int, codeHash, genesisId []byt
 	return ftOwnersRsp, nil
 }
 
-func GetAllTokenBalanceByAddress(cursor, size int, addressPkh []byte) (ftOwnersRsp []*model.FTSummaryByAddressResp, total int, err error) {
+func GetAllTokenBalanceByAddress(ctx context.Context, cursor, size int, addressPkh []byte) (ftOwnersRsp []*model.FTSummaryByAddressResp, total int, err error) {
 	finalKey := "mp:z:{fs" + string(addressPkh) + "}"
 
 	oldKey := "{fs" + string(addressPkh) + "}"
@@ -97,10 +98,10 @@ func GetAllTokenBalanceByAddress(cursor, size int, addressPkh []byte) (ftOwnersR
 	// 合并已确认余额和未确认余额
 	nUnion, err := rdb.BizClient.ZUnionStore(ctx, finalKey, finalZs).Result()
 	if err != nil {
-		logger.Log.Info("ZUnionStore redis failed", zap.Error(err))
+		logger.Ctx(ctx).Info("ZUnionStore redis failed", zap.Error(err))
 		return
 	}
-	logger.Log.Info("ZUnionStore", zap.Int64("n", nUnion))
+	logger.Ctx(ctx).Info("ZUnionStore", zap.Int64("n", nUnion))
 
 	ftOwnersRsp = make([]*model.FTSummaryByAddressResp, 0)
 	total = int(nUnion)
@@ -110,7 +111,7 @@ func GetAllTokenBalanceByAddress(cursor, size int, addressPkh []byte) (ftOwnersR
 
 	vals, err := rdb.BizClient.ZRevRangeWithScores(ctx, finalKey, int64(cursor), int64(cursor+size-1)).Result()
 	if err != nil {
-		logger.Log.Info("GetAllTokenBalanceByAddress redis failed", zap.Error(err))
+		logger.Ctx(ctx).Info("GetAllTokenBalanceByAddress redis failed", zap.Error(err))
 		return
 	}
 
@@ -137,9 +138,9 @@ func GetAllTokenBalanceByAddress(cursor, size int, addressPkh []byte) (ftOwnersR
 		}
 
 		// // 计算utxo count
-		// utxoCount, _, _, _, err := GetUtxoCountByAddress(codeHash, genesisId, addressPkh, "fu")
+		// utxoCount, _, _, _, err := GetUtxoCountByAddress(ctx, codeHash, genesisId, addressPkh, "fu")
 		// if err != nil {
-		// 	logger.Log.Info("GetAllTokenBalanceByAddress utxo count, but redis failed", zap.Error(err))
+		// 	logger.Ctx(ctx).Info("GetAllTokenBalanceByAddress utxo count, but redis failed", zap.Error(err))
 		// } else {
 		// 	balanceRsp.UtxoCount = utxoCount
 		// }
@@ -149,7 +150,7 @@ func GetAllTokenBalanceByAddress(cursor, size int, addressPkh []byte) (ftOwnersR
 		// decimal
 		ftinfo, err := ftInfoCmds[idx].Result()
 		if err == redis.Nil {
-			logger.Log.Info("GetAllTokenBalanceByAddress ftinfo not found")
+			logger.Ctx(ctx).Info("GetAllTokenBalanceByAddress ftinfo not found")
 			ftinfo = map[string]string{
 				"decimal":    "0",
 				"name":       "",
@@ -180,39 +181,39 @@ func GetAllTokenBalanceByAddress(cursor, size int, addressPkh []byte) (ftOwnersR
 	return ftOwnersRsp, total, nil
 }
 
-func GetTokenBalanceByCodeHashGenesisAddress(codeHash, genesisId, addressPkh []byte) (balanceRsp *model.FTOwnerBalanceWithUtxoCountResp, err error) {
+func GetTokenBalanceByCodeHashGenesisAddress(ctx context.Context, codeHash, genesisId, addressPkh []byte) (balanceRsp *model.FTOwnerBalanceWithUtxoCountResp, err error) {
 	// get decimal from f info
 	decimal, err := rdb.BizClient.HGet(ctx, "fi"+string(codeHash)+string(genesisId), "decimal").Int()
 	if err == redis.Nil {
 		decimal = 0
 	} else if err != nil {
-		logger.Log.Info("GetTokenBalanceByCodeHashGenesisAddress decimal, but redis failed", zap.Error(err))
+		logger.Ctx(ctx).Info("GetTokenBalanceByCodeHashGenesisAddress decimal, but redis failed", zap.Error(err))
 		return
 	}
 
 	balance, err := rdb.BizClient.ZScore(ctx, "{fb"+string(genesisId)+string(codeHash)+"}", string(addressPkh)).Result()
 	if err == redis.Nil {
-		logger.Log.Info("GetTokenBalanceByCodeHashGenesisAddress fb, but not found")
+		logger.Ctx(ctx).Info("GetTokenBalanceByCodeHashGenesisAddress fb, but not found")
 		balance = 0
 	} else if err != nil {
-		logger.Log.Info("GetTokenBalanceByCodeHashGenesisAddress fb, but redis failed", zap.Error(err))
+		logger.Ctx(ctx).Info("GetTokenBalanceByCodeHashGenesisAddress fb, but redis failed", zap.Error(err))
 		return
 	}
-	logger.Log.Info("GetTokenBalanceByCodeHashGenesisAddress fb", zap.Float64("balance", balance))
+	logger.Ctx(ctx).Info("GetTokenBalanceByCodeHashGenesisAddress fb", zap.Float64("balance", balance))
 	mpBalance, err := rdb.BizClient.ZScore(ctx, "mp:{fb"+string(genesisId)+string(codeHash)+"}", string(addressPkh)).Result()
 	if err == redis.Nil {
-		logger.Log.Info("GetTokenBalanceByCodeHashGenesisAddress mp:fb, but not found")
+		logger.Ctx(ctx).Info("GetTokenBalanceByCodeHashGenesisAddress mp:fb, but not found")
 		mpBalance = 0
 	} else if err != nil {
-		logger.Log.Info("GetTokenBalanceByCodeHashGenesisAddress mp:fb, but redis mp failed", zap.Error(err))
+		logger.Ctx(ctx).Info("GetTokenBalanceByCodeHashGenesisAddress mp:fb, but redis mp failed", zap.Error(err))
 		return
 	}
-	logger.Log.Info("GetTokenBalanceByCodeHashGenesisAddress fb", zap.Float64("pendingBalance", mpBalance))
+	logger.Ctx(ctx).Info("GetTokenBalanceByCodeHashGenesisAddress fb", zap.Float64("pendingBalance", mpBalance))
 
 	// 计算utxo count
-	utxoCount, _, _, _, err := GetUtxoCountByAddress(codeHash, genesisId, addressPkh, "fu")
+	utxoCount, _, _, _, err := GetUtxoCountByAddress(ctx, codeHash, genesisId, addressPkh, "fu")
 	if err != nil {
-		logger.Log.Info("GetTokenBalanceByCodeHashGenesisAddress utxo count, but redis failed", zap.Error(err))
+		logger.Ctx(ctx).Info("GetTokenBalanceByCodeHashGenesisAddress utxo count, but redis failed", zap.Error(err))
 		return
 	}
 
@@ -228,7 +229,7 @@ func GetTokenBalanceByCodeHashGenesisAddress(codeHash, genesisId, addressPkh []b
 
 ////////////////
 // nft
-func GetNFTOwnersByCodeHashGenesis(cursor, size int, codeHash, genesisId []byte) (ownersRsp []*model.NFTOwnerResp, err error) {
+func GetNFTOwnersByCodeHashGenesis(ctx context.Context, cursor, size int, codeHash, genesisId []byte) (ownersRsp []*model.NFTOwnerResp, err error) {
 	finalKey := "mp:z:{no" + string(genesisId) + string(codeHash) + "}"
 
 	oldKey := "{no" + string(genesisId) + string(codeHash) + "}"
@@ -243,14 +244,14 @@ func GetNFTOwnersByCodeHashGenesis(cursor, size int, codeHash, genesisId []byte)
 	// 合并已确认数量和未确认数量
 	nUnion, err := rdb.BizClient.ZUnionStore(ctx, finalKey, finalZs).Result()
 	if err != nil {
-		logger.Log.Info("ZUnionStore redis failed", zap.Error(err))
+		logger.Ctx(ctx).Info("ZUnionStore redis failed", zap.Error(err))
 		return
 	}
-	logger.Log.Info("ZUnionStore", zap.Int64("n", nUnion))
+	logger.Ctx(ctx).Info("ZUnionStore", zap.Int64("n", nUnion))
 
 	vals, err := rdb.BizClient.ZRevRangeWithScores(ctx, finalKey, int64(cursor), int64(cursor+size-1)).Result()
 	if err != nil {
-		logger.Log.Info("GetNFTOwnersByCodeHashGenesis redis failed", zap.Error(err))
+		logger.Ctx(ctx).Info("GetNFTOwnersByCodeHashGenesis redis failed", zap.Error(err))
 		return
 	}
 
@@ -285,7 +286,7 @@ func GetNFTOwnersByCodeHashGenesis(cursor, size int, codeHash, genesisId []byte)
 	return ownersRsp, nil
 }
 
-func GetAllNFTBalanceByAddress(cursor, size int, addressPkh []byte) (nftOwnersRsp []*model.NFTSummaryByAddressResp, err error) {
+func GetAllNFTBalanceByAddress(ctx context.Context, cursor, size int, addressPkh []byte) (nftOwnersRsp []*model.NFTSummaryByAddressResp, err error) {
 	finalKey := "mp:z:{ns" + string(addressPkh) + "}"
 
 	oldKey := "{ns" + string(addressPkh) + "}"
@@ -300,14 +301,14 @@ func GetAllNFTBalanceByAddress(cursor, size int, addressPkh []byte) (nftOwnersRs
 	// 合并已确认数量和未确认数量
 	nUnion, err := rdb.BizClient.ZUnionStore(ctx, finalKey, finalZs).Result()
 	if err != nil {
-		logger.Log.Info("ZUnionStore redis failed", zap.Error(err))
+		logger.Ctx(ctx).Info("ZUnionStore redis failed", zap.Error(err))
 		return
 	}
-	logger.Log.Info("ZUnionStore", zap.Int64("n", nUnion))
+	logger.Ctx(ctx).Info("ZUnionStore", zap.Int64("n", nUnion))
 
 	vals, err := rdb.BizClient.ZRevRangeWithScores(ctx, finalKey, int64(cursor), int64(cursor+size-1)).Result()
 	if err != nil {
-		logger.Log.Info("GetAllNFTBalanceByAddress redis failed", zap.Error(err))
+		logger.Ctx(ctx).Info("GetAllNFTBalanceByAddress redis failed", zap.Error(err))
 		return
 	}
 
@@ -343,7 +344,7 @@ func GetAllNFTBalanceByAddress(cursor, size int, addressPkh []byte) (nftOwnersRs
 			countRsp.MetaTxIdHex = hex.EncodeToString([]byte(nftinfo["metatxid"]))
 			countRsp.SensibleIdHex = hex.EncodeToString([]byte(nftinfo["sensibleid"]))
 		} else if err == redis.Nil {
-			logger.Log.Info("GetAllTokenBalanceByAddress ftinfo not found")
+			logger.Ctx(ctx).Info("GetAllTokenBalanceByAddress ftinfo not found")
 		} else if err != nil {
 			panic(err)
 		}
@@ -362,12 +363,12 @@ func GetAllNFTBalanceByAddress(cursor, size int, addressPkh []byte) (nftOwnersRs
 	return nftOwnersRsp, nil
 }
 
-func GetNFTCountByCodeHashGenesisAddress(codeHash, genesisId, addressPkh []byte) (countRsp *model.NFTOwnerResp, err error) {
+func GetNFTCountByCodeHashGenesisAddress(ctx context.Context, codeHash, genesisId, addressPkh []byte) (countRsp *model.NFTOwnerResp, err error) {
 	score, err := rdb.BizClient.ZScore(ctx, "{no"+string(genesisId)+string(codeHash)+"}", string(addressPkh)).Result()
 	if err == redis.Nil {
 		score = 0
 	} else if err != nil {
-		logger.Log.Info("GetNFTCountByCodeHashGenesisAddress redis failed", zap.Error(err))
+		logger.Ctx(ctx).Info("GetNFTCountByCodeHashGenesisAddress redis failed", zap.Error(err))
 		return
 	}
 
@@ -375,7 +376,7 @@ func GetNFTCountByCodeHashGenesisAddress(codeHash, genesisId, addressPkh []byte)
 	if err == redis.Nil {
 		mpScore = 0
 	} else if err != nil {
-		logger.Log.Info("GetNFTCountByCodeHashGenesisAddress mp redis failed", zap.Error(err))
+		logger.Ctx(ctx).Info("GetNFTCountByCodeHashGenesisAddress mp redis failed", zap.Error(err))
 		return
 	}
 
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"database/sql"
 	"encoding/hex"
 	"errors"
@@ -22,7 +23,7 @@ func tokenInfoResultSRF(rows *sql.Rows) (interface{}, error) {
 	return &ret, nil
 }
 
-func GetTokenInfo() (blksRsp []*model.TokenInfoResp, err error) {
+func GetTokenInfo(ctx context.Context) (blksRsp []*model.TokenInfoResp, err error) {
 	psql := `
 SELECT codehash, genesis, count(nft_idx), sum(in_times), sum(out_times), sum(in_satoshi), sum(out_satoshi) FROM (
      SELECT codehash, genesis, nft_idx,
@@ -34,9 +35,9 @@ SELECT codehash, genesis, count(nft_idx), sum(in_times), sum(out_times), sum(in_
 GROUP BY codehash, genesis
 `
 
-	blksRet, err := clickhouse.ScanAll(psql, tokenInfoResultSRF)
+	blksRet, err := clickhouse.ScanAll(ctx, psql, tokenInfoResultSRF)
 	if err != nil {
-		logger.Log.Info("query blk failed", zap.Error(err))
+		logger.Ctx(ctx).Info("query blk failed", zap.Error(err))
 		return nil, err
 	}
 	if blksRet == nil {
@@ -58,7 +59,7 @@ func tokenCodeHashResultSRF(rows *sql.Rows) (interface{}, error) {
 	return &ret, nil
 }
 
-func GetTokenCodeHash(codeType uint32) (blksRsp []*model.TokenCodeHashResp, err error) {
+func GetTokenCodeHash(ctx context.Context, codeType uint32) (blksRsp []*model.TokenCodeHashResp, err error) {
 	psql := fmt.Sprintf(`
 SELECT codehash, count(1), sum(in_times), sum(out_times) FROM (
      SELECT codehash, genesis, nft_idx,
@@ -69,9 +70,9 @@ SELECT codehash, count(1), sum(in_times), sum(out_times) FROM (
 GROUP BY codehash
 ORDER BY count(1) DESC
 `, codeType)
-	blksRet, err := clickhouse.ScanAll(psql, tokenCodeHashResultSRF)
+	blksRet, err := clickhouse.ScanAll(ctx, psql, tokenCodeHashResultSRF)
 	if err != nil {
-		logger.Log.Info("query nft codehash failed", zap.Error(err))
+		logger.Ctx(ctx).Info("query nft codehash failed", zap.Error(err))
 		return nil, err
 	}
 	if blksRet == nil {
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -27,12 +28,12 @@ func txResultSRF(rows *sql.Rows) (interface{}, error) {
 	return &ret, nil
 }
 
-func GetBlockTxsByBlockHeight(cursor, size, blkHeight int) (txsRsp []*model.TxInfoResp, err error) {
+func GetBlockTxsByBlockHeight(ctx context.Context, cursor, size, blkHeight int) (txsRsp []*model.TxInfoResp, err error) {
 	psql := fmt.Sprintf("SELECT %s FROM blktx_height WHERE height = %d AND txidx >= %d ORDER BY txidx LIMIT %d", SQL_FIELEDS_TX, blkHeight, cursor, size)
-	return GetBlockTxsBySql(psql, false)
+	return GetBlockTxsBySql(ctx, psql, false)
 }
 
-func GetBlockTxsByBlockId(cursor, size int, blkidHex string) (txsRsp []*model.TxInfoResp, err error) {
+func GetBlockTxsByBlockId(ctx context.Context, cursor, size int, blkidHex string) (txsRsp []*model.TxInfoResp, err error) {
 	psql := fmt.Sprintf(`
 SELECT %s FROM blktx_height
 WHERE height IN (
@@ -42,20 +43,20 @@ WHERE height IN (
 ORDER BY txidx
 LIMIT %d`, SQL_FIELEDS_TX, blkidHex, cursor, size)
 
-	return GetBlockTxsBySql(psql, false)
+	return GetBlockTxsBySql(ctx, psql, false)
 }
 
-func GetBlockTxsBySql(psql string, withBlkId bool) (txsRsp []*model.TxInfoResp, err error) {
+func GetBlockTxsBySql(ctx context.Context, psql string, withBlkId bool) (txsRsp []*model.TxInfoResp, err error) {
 	// confirmations
-	bestHeight, err := GetBestBlockHeight()
+	bestHeight, err := GetBestBlockHeight(ctx)
 	if err != nil {
-		logger.Log.Info("best block failed", zap.Error(err))
+		logger.Ctx(ctx).Info("best block failed", zap.Error(err))
 	}
 
 	// txinfo
-	txsRet, err := clickhouse.ScanAll(psql, txResultSRF)
+	txsRet, err := clickhouse.ScanAll(ctx, psql, txResultSRF)
 	if err != nil {
-		logger.Log.Info("query txs by blkid failed", zap.Error(err))
+		logger.Ctx(ctx).Info("query txs by blkid failed", zap.Error(err))
 		return nil, err
 	}
 	if txsRet == nil {
@@ -94,7 +95,7 @@ func GetBlockTxsBySql(psql string, withBlkId bool) (txsRsp []*model.TxInfoResp,
 }
 
 ////////////////
-func GetTxById(txidHex string) (txRsp *model.TxInfoResp, err error) {
+func GetTxById(ctx context.Context, txidHex string) (txRsp *model.TxInfoResp, err error) {
 	psql := fmt.Sprintf(`
 SELECT %s FROM blktx_height
 LEFT JOIN  (
@@ -113,10 +114,10 @@ WHERE (height = 4294967295 OR
 )) AND txid = unhex('%s')
 ORDER BY height
 LIMIT 1`, SQL_FIELEDS_TX_TIMESTAMP, txidHex[:24], txidHex[:24], txidHex)
-	return GetTxBySql(psql)
+	return GetTxBySql(ctx, psql)
 }
 
-func GetTxByIdInsideHeight(blkHeight int, txidHex string) (txRsp *model.TxInfoResp, err error) {
+func GetTxByIdInsideHeight(ctx context.Context, blkHeight int, txidHex string) (txRsp *model.TxInfoResp, err error) {
 	psql := fmt.Sprintf(`
 SELECT %s FROM blktx_height
 LEFT JOIN (
@@ -127,20 +128,20 @@ LEFT JOIN (
 USING height
 WHERE height = %d AND txid = unhex('%s')
 LIMIT 1`, SQL_FIELEDS_TX_TIMESTAMP, blkHeight, blkHeight, txidHex)
-	return GetTxBySql(psql)
+	return GetTxBySql(ctx, psql)
 }
 
-func GetTxBySql(psql string) (txRsp *model.TxInfoResp, err error) {
+func GetTxBySql(ctx context.Context, psql string) (txRsp *model.TxInfoResp, err error) {
 	// confirmations
-	bestHeight, err := GetBestBlockHeight()
+	bestHeight, err := GetBestBlockHeight(ctx)
 	if err != nil {
-		logger.Log.Info("best block failed", zap.Error(err))
+		logger.Ctx(ctx).Info("best block failed", zap.Error(err))
 	}
 
 	// txinfo
-	txRet, err := clickhouse.ScanOne(psql, txResultSRF)
+	txRet, err := clickhouse.ScanOne(ctx, psql, txResultSRF)
 	if err != nil {
-		logger.Log.Info("query tx failed", zap.Error(err))
+		logger.Ctx(ctx).Info("query tx failed", zap.Error(err))
 		return nil, err
 	}
 	if txRet == nil {
@@ -184,7 +185,7 @@ func rawtxResultSRF(rows *sql.Rows) (interface{}, error) {
 	return ret, nil
 }
 
-func GetRawTxById(txidHex string) (txRsp []byte, err error) {
+func GetRawTxById(ctx context.Context, txidHex string) (txRsp []byte, err error) {
 	psql := fmt.Sprintf(`
 SELECT rawtx FROM blktx_height
 WHERE (height = 4294967295 OR
@@ -194,9 +195,9 @@ WHERE (height = 4294967295 OR
 )) AND txid = unhex('%s')
 LIMIT 1`, txidHex[:24], txidHex)
 
-	txRet, err := clickhouse.ScanOne(psql, rawtxResultSRF)
+	txRet, err := clickhouse.ScanOne(ctx, psql, rawtxResultSRF)
 	if err != nil {
-		logger.Log.Info("query tx failed", zap.Error(err))
+		logger.Ctx(ctx).Info("query tx failed", zap.Error(err))
 		return nil, err
 	}
 	if txRet == nil {
@@ -207,15 +208,15 @@ LIMIT 1`, txidHex[:24], txidHex)
 	return txRsp, nil
 }
 
-func GetRawTxByIdInsideHeight(blkHeight int, txidHex string) (txRsp []byte, err error) {
+func GetRawTxByIdInsideHeight(ctx context.Context, blkHeight int, txidHex string) (txRsp []byte, err error) {
 	psql := fmt.Sprintf(`
 SELECT rawtx FROM blktx_height
 WHERE height = %d AND txid = unhex('%s')
 LIMIT 1`, blkHeight, txidHex)
 
-	txRet, err := clickhouse.ScanOne(psql, rawtxResultSRF)
+	txRet, err := clickhouse.ScanOne(ctx, psql, rawtxResultSRF)
 	if err != nil {
-		logger.Log.Info("query tx failed", zap.Error(err))
+		logger.Ctx(ctx).Info("query tx failed", zap.Error(err))
 		return nil, err
 	}
 	if txRet == nil {
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"database/sql"
 	"encoding/hex"
 	"errors"
@@ -45,7 +46,7 @@ func txInResultSRF(rows *sql.Rows) (interface{}, error) {
 	return &ret, nil
 }
 
-func GetTxInputsByTxId(cursor, size int, txidHex string) (txInsRsp []*model.TxInResp, err error) {
+func GetTxInputsByTxId(ctx context.Context, cursor, size int, txidHex string) (txInsRsp []*model.TxInResp, err error) {
 	psql := fmt.Sprintf(`
 SELECT %s FROM txin
 WHERE txid = unhex('%s') AND
@@ -58,10 +59,10 @@ WHERE txid = unhex('%s') AND
 ORDER BY idx
 LIMIT %d`, SQL_FIELEDS_TXIN, txidHex, txidHex[:24], cursor, size)
 
-	return GetTxInputsBySql(psql)
+	return GetTxInputsBySql(ctx, psql)
 }
 
-func GetTxInputsByTxIdInsideHeight(cursor, size, blkHeight int, txidHex string) (txInsRsp []*model.TxInResp, err error) {
+func GetTxInputsByTxIdInsideHeight(ctx context.Context, cursor, size, blkHeight int, txidHex string) (txInsRsp []*model.TxInResp, err error) {
 	psql := fmt.Sprintf(`
 SELECT %s FROM txin
 WHERE txid = unhex('%s') AND
@@ -70,13 +71,13 @@ WHERE txid = unhex('%s') AND
 ORDER BY idx
 LIMIT %d`, SQL_FIELEDS_TXIN, txidHex, blkHeight, cursor, size)
 
-	return GetTxInputsBySql(psql)
+	return GetTxInputsBySql(ctx, psql)
 }
 
-func GetTxInputsBySql(psql string) (txInsRsp []*model.TxInResp, err error) {
-	txInsRet, err := clickhouse.ScanAll(psql, txInResultSRF)
+func GetTxInputsBySql(ctx context.Context, psql string) (txInsRsp []*model.TxInResp, err error) {
+	txInsRet, err := clickhouse.ScanAll(ctx, psql, txInResultSRF)
 	if err != nil {
-		logger.Log.Info("query txs by blkid failed", zap.Error(err))
+		logger.Ctx(ctx).Info("query txs by blkid failed", zap.Error(err))
 		return nil, err
 	}
 	if txInsRet == nil {
@@ -89,7 +90,7 @@ func GetTxInputsBySql(psql string) (txInsRsp []*model.TxInResp, err error) {
 	return
 }
 
-func GetTxInputByTxIdAndIdx(txidHex string, index int) (txInRsp *model.TxInResp, err error) {
+func GetTxInputByTxIdAndIdx(ctx context.Context, txidHex string, index int) (txInRsp *model.TxInResp, err error) {
 	psql := fmt.Sprintf(`
 SELECT %s FROM txin
 WHERE txid = unhex('%s') AND
@@ -101,10 +102,10 @@ WHERE txid = unhex('%s') AND
     ))
 LIMIT 1`, SQL_FIELEDS_TXIN, txidHex, index, txidHex[:24])
 
-	return GetTxInputBySql(psql)
+	return GetTxInputBySql(ctx, psql)
 }
 
-func GetTxInputByTxIdAndIdxInsideHeight(blkHeight int, txidHex string, index int) (txInRsp *model.TxInResp, err error) {
+func GetTxInputByTxIdAndIdxInsideHeight(ctx context.Context, blkHeight int, txidHex string, index int) (txInRsp *model.TxInResp, err error) {
 	psql := fmt.Sprintf(`
 SELECT %s FROM txin
 WHERE txid = unhex('%s') AND
@@ -112,13 +113,13 @@ WHERE txid = unhex('%s') AND
     height = %d
 LIMIT 1`, SQL_FIELEDS_TXIN, txidHex, index, blkHeight)
 
-	return GetTxInputBySql(psql)
+	return GetTxInputBySql(ctx, psql)
 }
 
-func GetTxInputBySql(psql string) (txInRsp *model.TxInResp, err error) {
-	txInRet, err := clickhouse.ScanOne(psql, txInResultSRF)
+func GetTxInputBySql(ctx context.Context, psql string) (txInRsp *model.TxInResp, err error) {
+	txInRet, err := clickhouse.ScanOne(ctx, psql, txInResultSRF)
 	if err != nil {
-		logger.Log.Info("query tx by blkid failed", zap.Error(err))
+		logger.Ctx(ctx).Info("query tx by blkid failed", zap.Error(err))
 		return nil, err
 	}
 	if txInRet == nil {
@@ -129,7 +130,7 @@ func GetTxInputBySql(psql string) (txInRsp *model.TxInResp, err error) {
 	return
 }
 
-func GetTxOutputSpentStatusByTxIdAndIdx(txidHex string, index int) (txInRsp *model.TxInSpentResp, err error) {
+func GetTxOutputSpentStatusByTxIdAndIdx(ctx context.Context, txidHex string, index int) (txInRsp *model.TxInSpentResp, err error) {
 	psql := fmt.Sprintf(`
 SELECT height, txid, idx, unhex('%s'), %d FROM txin_spent
 WHERE utxid = unhex('%s') AND
@@ -143,9 +144,9 @@ WHERE utxid = unhex('%s') AND
 LIMIT 1
 `, txidHex, index, txidHex[:24], index, txidHex[:24], index)
 
-	txInRet, err := clickhouse.ScanOne(psql, txInSpentResultSRF)
+	txInRet, err := clickhouse.ScanOne(ctx, psql, txInSpentResultSRF)
 	if err != nil {
-		logger.Log.Info("query tx by blkid failed", zap.Error(err))
+		logger.Ctx(ctx).Info("query tx by blkid failed", zap.Error(err))
 		return nil, err
 	}
 	if txInRet == nil {
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"database/sql"
 	"encoding/hex"
 	"errors"
@@ -34,7 +35,7 @@ func txOutStatusResultSRF(rows *sql.Rows) (interface{}, error) {
 	return &ret, nil
 }
 
-func GetTxOutputsByTxId(cursor, size int, txidHex string) (txOutsRsp []*model.TxOutStatusResp, err error) {
+func GetTxOutputsByTxId(ctx context.Context, cursor, size int, txidHex string) (txOutsRsp []*model.TxOutStatusResp, err error) {
 	psql := fmt.Sprintf(`
 SELECT utxid, vout, address, codehash, genesis, satoshi, script_type, script_pk, height, utxidx,
        u.txid, u.height FROM txout
@@ -65,10 +66,10 @@ LIMIT %d
 		txidHex[:24], cursor, txidHex[:24], cursor, size, size,
 		txidHex, cursor, txidHex[:24], size)
 
-	return GetTxOutputsBySql(psql)
+	return GetTxOutputsBySql(ctx, psql)
 }
 
-func GetTxOutputsByTxIdInsideHeight(cursor, size, blkHeight int, txidHex string) (txOutsRsp []*model.TxOutStatusResp, err error) {
+func GetTxOutputsByTxIdInsideHeight(ctx context.Context, cursor, size, blkHeight int, txidHex string) (txOutsRsp []*model.TxOutStatusResp, err error) {
 	psql := fmt.Sprintf(`
 SELECT utxid, vout, address, codehash, genesis, satoshi, script_type, script_pk, height, utxidx,
        u.txid, u.height FROM txout
@@ -98,13 +99,13 @@ LIMIT %d
 		txidHex[:24], cursor, txidHex[:24], cursor, size, size,
 		blkHeight, txidHex, cursor, size)
 
-	return GetTxOutputsBySql(psql)
+	return GetTxOutputsBySql(ctx, psql)
 }
 
-func GetTxOutputsBySql(psql string) (txOutsRsp []*model.TxOutStatusResp, err error) {
-	txOutsRet, err := clickhouse.ScanAll(psql, txOutStatusResultSRF)
+func GetTxOutputsBySql(ctx context.Context, psql string) (txOutsRsp []*model.TxOutStatusResp, err error) {
+	txOutsRet, err := clickhouse.ScanAll(ctx, psql, txOutStatusResultSRF)
 	if err != nil {
-		logger.Log.Info("query txouts by blkid failed", zap.Error(err))
+		logger.Ctx(ctx).Info("query txouts by blkid failed", zap.Error(err))
 		return nil, err
 	}
 	if txOutsRet == nil {
@@ -124,7 +125,7 @@ func GetTxOutputsBySql(psql string) (txOutsRsp []*model.TxOutStatusResp, err err
 	return
 }
 
-func GetTxOutputByTxIdAndIdx(txidHex string, index int) (txOutRsp *model.TxOutResp, err error) {
+func GetTxOutputByTxIdAndIdx(ctx context.Context, txidHex string, index int) (txOutRsp *model.TxOutResp, err error) {
 	psql := fmt.Sprintf(`
 SELECT %s FROM txout
 WHERE utxid = unhex('%s') AND
@@ -135,10 +136,10 @@ WHERE utxid = unhex('%s') AND
             WHERE txid = unhex('%s')
        ))
 LIMIT 1`, SQL_FIELEDS_TXOUT, txidHex, index, txidHex[:24])
-	return GetTxOutputBySql(psql)
+	return GetTxOutputBySql(ctx, psql)
 }
 
-func GetTxOutputByTxIdAndIdxInsideHeight(blkHeight int, txidHex string, index int) (txOutRsp *model.TxOutResp, err error) {
+func GetTxOutputByTxIdAndIdxInsideHeight(ctx context.Context, blkHeight int, txidHex string, index int) (txOutRsp *model.TxOutResp, err error) {
 	psql := fmt.Sprintf(`
 SELECT %s FROM txout
 WHERE utxid = unhex('%s') AND
@@ -146,7 +147,7 @@ WHERE utxid = unhex('%s') AND
      height = %d
 LIMIT 1`, SQL_FIELEDS_TXOUT, txidHex, index, blkHeight)
 
-	return GetTxOutputBySql(psql)
+	return GetTxOutputBySql(ctx, psql)
 }
 
 func txOutResultSRF(rows *sql.Rows) (interface{}, error) {
@@ -158,10 +159,10 @@ func txOutResultSRF(rows *sql.Rows) (interface{}, error) {
 	return &ret, nil
 }
 
-func GetTxOutputBySql(psql string) (txOutRsp *model.TxOutResp, err error) {
-	txOutRet, err := clickhouse.ScanOne(psql, txOutResultSRF)
+func GetTxOutputBySql(ctx context.Context, psql string) (txOutRsp *model.TxOutResp, err error) {
+	txOutRet, err := clickhouse.ScanOne(ctx, psql, txOutResultSRF)
 	if err != nil {
-		logger.Log.Info("query txout by blkid failed", zap.Error(err))
+		logger.Ctx(ctx).Info("query txout by blkid failed", zap.Error(err))
 		return nil, err
 	}
 	if txOutRet == nil {
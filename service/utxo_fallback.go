@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sensiblequery/dao/clickhouse"
+	"sensiblequery/dao/rdb"
+	"sensiblequery/lib/breaker"
+	"sensiblequery/lib/metrics"
+	"sensiblequery/lib/paging"
+	"sensiblequery/lib/utxoset"
+	"sensiblequery/logger"
+	"sensiblequery/model"
+	"time"
+
+	redis "github.com/go-redis/redis/v8"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+var (
+	// redis连续失败达到次数后熔断，改从ClickHouse计算，冷却后试探恢复
+	utxoFallback = true
+	utxoBreaker  = breaker.New(5, 30*time.Second)
+
+	errUtxoUnavailable = errors.New("utxo redis unavailable")
+)
+
+func init() {
+	initUtxoFallback("conf/utxo_fallback.yaml")
+}
+
+// initUtxoFallback 读取可选的降级配置
+func initUtxoFallback(filename string) {
+	if _, err := os.Stat(filename); err == nil {
+		v := viper.New()
+		v.SetConfigFile(filename)
+		if err := v.ReadInConfig(); err != nil {
+			panic(fmt.Errorf("Fatal error config file: %s \n", err))
+		}
+		v.SetDefault("fallback", true)
+		v.SetDefault("failures", 5)
+		v.SetDefault("cooldown", 30*time.Second)
+		utxoFallback = v.GetBool("fallback")
+		utxoBreaker = breaker.New(v.GetInt("failures"), v.GetDuration("cooldown"))
+	}
+	utxoBreaker.OnChange = func(from, to breaker.State) {
+		logger.Log.Warn("utxo redis breaker", zap.String("from", from.String()), zap.String("to", to.String()))
+		metrics.UtxoBreakerState.Set(float64(to))
+	}
+}
+
+// isRedisFailure redis本身的故障，查询结果为空、游标错误及请求取消不计入
+func isRedisFailure(ctx context.Context, err error) bool {
+	return err != nil && err != redis.Nil && err != paging.ErrInvalidCursor && ctx.Err() == nil
+}
+
+// withUtxoSource 在地址utxo集合上执行query，redis故障或熔断时改用ClickHouse计算的集合，
+// 此时source为model.SourceClickhouse
+func withUtxoSource(ctx context.Context, codeHash, genesisId, addressPkh []byte, key string, query func(src utxoset.Source) error) (source string, err error) {
+	if utxoBreaker.Allow() {
+		err = query(utxoset.NewRedis(rdb.BizClient, rdb.RdbUtxoClient, codeHash, genesisId, addressPkh, key))
+		if ctx.Err() != nil {
+			// 请求取消时redis是否正常未知，不上报成功或失败
+			utxoBreaker.Cancel()
+			return "", err
+		}
+		if !isRedisFailure(ctx, err) {
+			utxoBreaker.Success()
+			return "", err
+		}
+		utxoBreaker.Failure()
+		logger.Ctx(ctx).Warn("utxo redis failed", zap.Bool("fallback", utxoFallback), zap.Error(err))
+		if !utxoFallback {
+			return "", err
+		}
+	} else if !utxoFallback {
+		return "", errUtxoUnavailable
+	}
+
+	metrics.UtxoFallbacks.Inc()
+	mem, err := getUtxoSetFromClickhouse(ctx, codeHash, genesisId, addressPkh)
+	if err != nil {
+		return model.SourceClickhouse, err
+	}
+	return model.SourceClickhouse, query(mem)
+}
+
+// getUtxoSetFromClickhouse 由txout及txin_spent计算地址的utxo集合。
+// codeHash为空时为地址的普通utxo
+func getUtxoSetFromClickhouse(ctx context.Context, codeHash, genesisId, addressPkh []byte) (*utxoset.Mem, error) {
+	psql := utxoset.ClickhouseQuery(codeHash, genesisId, addressPkh)
+	txosRet, err := clickhouse.ScanAll(ctx, psql, utxoset.ScanClickhouseTxo)
+	if err != nil {
+		logger.Ctx(ctx).Info("query utxo from clickhouse failed", zap.Error(err))
+		return nil, err
+	}
+	var txos []*utxoset.Txo
+	if txosRet != nil {
+		txos = txosRet.([]*utxoset.Txo)
+	}
+	return utxoset.NewMem(txos), nil
+}
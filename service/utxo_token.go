@@ -1,9 +1,12 @@
 package service
 
 import (
+	"context"
 	"encoding/hex"
 	"errors"
 	"sensiblequery/dao/rdb"
+	"sensiblequery/lib/paging"
+	"sensiblequery/lib/utxoset"
 	"sensiblequery/logger"
 	"sensiblequery/model"
 	"sort"
@@ -14,18 +17,18 @@ import (
 )
 
 //////////////// address NFT utxo
-func GetUtxoByTokenIndex(codeHash, genesisId []byte, tokenIndex string) (txOutsRsp *model.TxOutResp, err error) {
+func GetUtxoByTokenIndex(ctx context.Context, codeHash, genesisId []byte, tokenIndex string) (txOutsRsp *model.TxOutResp, err error) {
 	key := "mp:nd" + string(codeHash) + string(genesisId)
-	resp, err := getNFTUtxoByTokenIndex(key, tokenIndex)
+	resp, err := getNFTUtxoByTokenIndex(ctx, key, tokenIndex)
 	if err == nil {
 		return resp, nil
 	}
 
 	key = "nd" + string(codeHash) + string(genesisId)
-	return getNFTUtxoByTokenIndex(key, tokenIndex)
+	return getNFTUtxoByTokenIndex(ctx, key, tokenIndex)
 }
 
-func getNFTUtxoByTokenIndex(key string, tokenIndex string) (txOutsRsp *model.TxOutResp, err error) {
+func getNFTUtxoByTokenIndex(ctx context.Context, key string, tokenIndex string) (txOutsRsp *model.TxOutResp, err error) {
 	op := &redis.ZRangeBy{
 		Min:    tokenIndex, // 最小分数
 		Max:    tokenIndex, // 最大分数
@@ -34,10 +37,10 @@ func getNFTUtxoByTokenIndex(key string, tokenIndex string) (txOutsRsp *model.TxO
 	}
 	utxoOutpoints, err := rdb.BizClient.ZRangeByScore(ctx, key, op).Result()
 	if err != nil {
-		logger.Log.Info("GetUtxoByTokenIndex redis failed", zap.Error(err))
+		logger.Ctx(ctx).Info("GetUtxoByTokenIndex redis failed", zap.Error(err))
 		return
 	}
-	result, err := getUtxoFromRedis(utxoOutpoints)
+	result, err := getUtxoFromRedis(ctx, utxoOutpoints)
 	if err != nil {
 		return nil, err
 	}
@@ -48,31 +51,19 @@ func getNFTUtxoByTokenIndex(key string, tokenIndex string) (txOutsRsp *model.TxO
 }
 
 ////////////////
-func getUtxoFromRedis(utxoOutpoints []string) (txOutsRsp []*model.TxOutResp, err error) {
-	logger.Log.Info("getUtxoFromRedis redis", zap.Int("nUTXO", len(utxoOutpoints)))
-	txOutsRsp = make([]*model.TxOutResp, 0)
-	pipe := rdb.RdbUtxoClient.Pipeline()
-
-	outpointsCmd := make([]*redis.StringCmd, 0)
-	for _, outpoint := range utxoOutpoints {
-		outpointsCmd = append(outpointsCmd, pipe.Get(ctx, "u"+outpoint))
-	}
-	_, err = pipe.Exec(ctx)
-	if err != nil && err != redis.Nil {
-		panic(err)
-	}
-
-	for outpointIdx, data := range outpointsCmd {
-		outpoint := utxoOutpoints[outpointIdx]
-		res, err := data.Result()
-		if err == redis.Nil {
-			logger.Log.Info("redis not found", zap.String("outpoint", hex.EncodeToString([]byte(outpoint))))
-			continue
-		} else if err != nil {
-			panic(err)
-		}
+func getUtxoFromRedis(ctx context.Context, utxoOutpoints []string) (txOutsRsp []*model.TxOutResp, err error) {
+	logger.Ctx(ctx).Info("getUtxoFromRedis redis", zap.Int("nUTXO", len(utxoOutpoints)))
+	txos, err := (&utxoset.Redis{Utxo: rdb.RdbUtxoClient}).Txos(ctx, utxoOutpoints)
+	if err != nil {
+		logger.Ctx(ctx).Info("getUtxoFromRedis redis failed", zap.Error(err))
+		return nil, err
+	}
+	return getUtxoResp(txos), nil
+}
 
-		txout := model.NewTxoData([]byte(outpoint), []byte(res))
+func getUtxoResp(txos []*model.TxoData) (txOutsRsp []*model.TxOutResp) {
+	txOutsRsp = make([]*model.TxOutResp, 0, len(txos))
+	for _, txout := range txos {
 		txOutDO := model.TxOutDO{
 			Height:     txout.BlockHeight,
 			Idx:        uint32(txout.TxIdx),
@@ -86,49 +77,55 @@ func getUtxoFromRedis(utxoOutpoints []string) (txOutsRsp []*model.TxOutResp, err
 		txOutRsp.ScriptPkHex = ""
 		txOutsRsp = append(txOutsRsp, txOutRsp)
 	}
-
-	return txOutsRsp, nil
+	return txOutsRsp
 }
 
 //////////////// address utxo
-func GetUtxoByCodeHashGenesisAddress(cursor, size int, codeHash, genesisId, addressPkh []byte, key string) (
-	txOutsRsp []*model.TxOutResp, total, totalConf, totalUnconf, totalUnconfSpend int, err error) {
-	logger.Log.Info("GetUtxoByCodeHashGenesisAddress",
+func GetUtxoByCodeHashGenesisAddress(ctx context.Context, page paging.Page, codeHash, genesisId, addressPkh []byte, key string) (
+	txOutsRsp []*model.TxOutResp, next, prev string, total, totalConf, totalUnconf, totalUnconfSpend int, source string, err error) {
+	logger.Ctx(ctx).Info("GetUtxoByCodeHashGenesisAddress",
 		zap.String("codehash", hex.EncodeToString(codeHash)),
 		zap.String("genesis", hex.EncodeToString(genesisId)),
 		zap.String("addressHex", hex.EncodeToString(addressPkh)),
 	)
 
-	utxoOutpoints, total, totalConf, totalUnconf, totalUnconfSpend, err := GetUtxoOutpointsByAddress(cursor, size, codeHash, genesisId, addressPkh, key)
-	if err != nil {
-		return
-	}
-
-	txOutsRsp, err = getUtxoFromRedis(utxoOutpoints)
-	return txOutsRsp, total, totalConf, totalUnconf, totalUnconfSpend, err
+	source, err = withUtxoSource(ctx, codeHash, genesisId, addressPkh, key, func(src utxoset.Source) (err error) {
+		var utxoOutpoints []string
+		utxoOutpoints, next, prev, total, totalConf, totalUnconf, totalUnconfSpend, err = src.Outpoints(ctx, page)
+		if err != nil {
+			return err
+		}
+		txos, err := src.Txos(ctx, utxoOutpoints)
+		if err != nil {
+			return err
+		}
+		txOutsRsp = getUtxoResp(txos)
+		return nil
+	})
+	return txOutsRsp, next, prev, total, totalConf, totalUnconf, totalUnconfSpend, source, err
 }
 
 //////////////// list NFT utxo
-func GetNFTUtxoByTokenIndexRange(cursor, size int, codeHash, genesisId []byte) (
+func GetNFTUtxoByTokenIndexRange(ctx context.Context, cursor, size int, codeHash, genesisId []byte) (
 	txOutsRsp []*model.TxOutResp, total, totalConf, totalUnconf int, err error) {
 	newUtxoKey := "mp:nd" + string(codeHash) + string(genesisId)
 
 	// unconfirmed count
 	newUtxoNum, err := rdb.BizClient.ZCard(ctx, newUtxoKey).Result()
 	if err != nil {
-		logger.Log.Info("get newUtxoNum from redis failed", zap.Error(err))
+		logger.Ctx(ctx).Info("get newUtxoNum from redis failed", zap.Error(err))
 		return
 	}
-	logger.Log.Info("newUtxoNum", zap.Int64("n", newUtxoNum))
+	logger.Ctx(ctx).Info("newUtxoNum", zap.Int64("n", newUtxoNum))
 
 	utxoKeyConfirmed := "nd" + string(codeHash) + string(genesisId)
 	// confirmed count
 	utxoConfirmedNum, err := rdb.BizClient.ZCard(ctx, utxoKeyConfirmed).Result()
 	if err != nil {
-		logger.Log.Info("get utxoConfirmedNum from redis failed", zap.Error(err))
+		logger.Ctx(ctx).Info("get utxoConfirmedNum from redis failed", zap.Error(err))
 		return
 	}
-	logger.Log.Info("utxoConfirmedNum", zap.Int64("n", utxoConfirmedNum))
+	logger.Ctx(ctx).Info("utxoConfirmedNum", zap.Int64("n", utxoConfirmedNum))
 
 	totalConf = int(utxoConfirmedNum)
 	totalUnconf = int(newUtxoNum)
@@ -143,13 +140,13 @@ func GetNFTUtxoByTokenIndexRange(cursor, size int, codeHash, genesisId []byte) (
 	}
 	utxoOutpointsUnconfirmed, err := rdb.BizClient.ZRangeByScoreWithScores(ctx, newUtxoKey, op).Result()
 	if err != nil {
-		logger.Log.Info("GetNFTUtxoByTokenIndexRange redis failed", zap.Error(err))
+		logger.Ctx(ctx).Info("GetNFTUtxoByTokenIndexRange redis failed", zap.Error(err))
 		return
 	}
 
 	utxoOutpointsWithScore, err := rdb.BizClient.ZRangeByScoreWithScores(ctx, utxoKeyConfirmed, op).Result()
 	if err != nil {
-		logger.Log.Info("GetNFTUtxoByTokenIndexRange redis failed", zap.Error(err))
+		logger.Ctx(ctx).Info("GetNFTUtxoByTokenIndexRange redis failed", zap.Error(err))
 		return
 	}
 
@@ -173,7 +170,7 @@ func GetNFTUtxoByTokenIndexRange(cursor, size int, codeHash, genesisId []byte) (
 	}
 
 	// get utxo data
-	result, err := getUtxoFromRedis(utxoOutpoints)
+	result, err := getUtxoFromRedis(ctx, utxoOutpoints)
 	if err != nil {
 		return
 	}
@@ -0,0 +1,614 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sensiblequery/dao/rdb"
+	"sensiblequery/lib/metrics"
+	"sensiblequery/lib/utils"
+	"sensiblequery/lib/webhook"
+	"sensiblequery/logger"
+	"sensiblequery/model"
+	"strconv"
+	"time"
+
+	redis "github.com/go-redis/redis/v8"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// webhook 在user redis中的key:
+//
+//	webhook:<id>                hash，url/secret/type/label/address/codehash/genesis/token_index/created
+//	webhooks                    zset，所有webhook，分数为注册时间
+//	webhook:event:<id>:<event>  已产生的事件，多个实例检测到同一事件时只投递一次
+//	webhook:delivery:<delivery> 投递内容及重试状态
+//	webhook:queue               zset，待投递，分数为下次尝试时间(毫秒)
+//	webhook:inflight            zset，已被实例认领正在投递，分数为租约到期时间(毫秒)，到期未完成的放回待投递
+//	webhook:dead                zset，重试耗尽的投递，分数为失败时间
+const (
+	webhooksKey        = "webhooks"
+	webhookQueueKey    = "webhook:queue"
+	webhookInflightKey = "webhook:inflight"
+	webhookDeadKey     = "webhook:dead"
+	webhookEventTTL    = 7 * 24 * time.Hour
+	webhookQueueBatch  = 100
+	// 认领投递的租约在投递超时之外的余量
+	webhookLeaseMargin = time.Minute
+	// 投递响应最多读取的字节数
+	webhookMaxResponse = 64 * 1024
+)
+
+var ErrWebhookNotExist = errors.New("webhook not exist")
+
+// webhook投递配置，见conf/webhook.yaml
+var webhookConf = struct {
+	MaxAttempts int
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+	Timeout     time.Duration
+	Workers     int
+	Poll        time.Duration // 余额、NFT、swap的检查间隔
+}{
+	MaxAttempts: 10,
+	Backoff:     10 * time.Second,
+	MaxBackoff:  time.Hour,
+	Timeout:     10 * time.Second,
+	Workers:     8,
+	Poll:        5 * time.Second,
+}
+
+var webhookClient = &http.Client{}
+
+// webhookEmitScript 标记事件并加入投递队列，标记已存在时不入队。
+// KEYS: 事件标记, 投递内容, 待投递队列。ARGV: 标记ttl(毫秒), 投递内容, 入队时间(毫秒), 投递id
+var webhookEmitScript = redis.NewScript(`
+if not redis.call('SET', KEYS[1], 1, 'NX', 'PX', ARGV[1]) then
+	return 0
+end
+redis.call('SET', KEYS[2], ARGV[2])
+redis.call('ZADD', KEYS[3], ARGV[3], ARGV[4])
+return 1
+`)
+
+// webhookClaimScript 将到期的投递从待投递队列移入inflight，已被其他实例认领时返回0。
+// KEYS: 待投递队列, inflight。ARGV: 投递id, 租约到期时间(毫秒)
+var webhookClaimScript = redis.NewScript(`
+if redis.call('ZREM', KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+redis.call('ZADD', KEYS[2], ARGV[2], ARGV[1])
+return 1
+`)
+
+// webhookReclaimScript 将租约到期的投递放回待投递队列，返回放回的数量。
+// KEYS: inflight, 待投递队列。ARGV: 当前时间(毫秒), 最多处理数量
+var webhookReclaimScript = redis.NewScript(`
+local ids = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+for _, id in ipairs(ids) do
+	redis.call('ZREM', KEYS[1], id)
+	redis.call('ZADD', KEYS[2], ARGV[1], id)
+end
+return #ids
+`)
+
+func init() {
+	initWebhook("conf/webhook.yaml")
+}
+
+// initWebhook 读取可选的webhook投递配置
+func initWebhook(filename string) {
+	if _, err := os.Stat(filename); err != nil {
+		return
+	}
+	v := viper.New()
+	v.SetConfigFile(filename)
+	if err := v.ReadInConfig(); err != nil {
+		panic(fmt.Errorf("Fatal error config file: %s \n", err))
+	}
+	v.SetDefault("max_attempts", webhookConf.MaxAttempts)
+	v.SetDefault("backoff", webhookConf.Backoff)
+	v.SetDefault("max_backoff", webhookConf.MaxBackoff)
+	v.SetDefault("timeout", webhookConf.Timeout)
+	v.SetDefault("workers", webhookConf.Workers)
+	v.SetDefault("poll", webhookConf.Poll)
+	webhookConf.MaxAttempts = v.GetInt("max_attempts")
+	webhookConf.Backoff = v.GetDuration("backoff")
+	webhookConf.MaxBackoff = v.GetDuration("max_backoff")
+	webhookConf.Timeout = v.GetDuration("timeout")
+	webhookConf.Workers = v.GetInt("workers")
+	webhookConf.Poll = v.GetDuration("poll")
+	if webhookConf.MaxAttempts < 1 || webhookConf.Backoff <= 0 || webhookConf.Timeout <= 0 ||
+		webhookConf.Workers < 1 || webhookConf.Poll <= 0 {
+		panic(fmt.Errorf("Fatal error config file: %s: values must be positive \n", filename))
+	}
+}
+
+// hookConf 已注册的webhook，secret不对外返回
+type hookConf struct {
+	model.WebhookResp
+	secret string
+}
+
+func randomHex(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func checkWebhookReq(req *model.WebhookReq) error {
+	u, err := url.Parse(req.Url)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url invalid")
+	}
+	checkHex := func(name, value string, size int) error {
+		data, err := hex.DecodeString(value)
+		if err != nil || len(data) != size {
+			return errors.New(name + " invalid")
+		}
+		return nil
+	}
+	switch req.Type {
+	case model.WebhookAddressPayment, model.WebhookFTBalance:
+		if _, err := utils.DecodeAddress(req.Address); err != nil {
+			return errors.New("address invalid")
+		}
+	}
+	switch req.Type {
+	case model.WebhookAddressPayment:
+		return nil
+	case model.WebhookFTBalance, model.WebhookNFTTransfer, model.WebhookSwap:
+		if err := checkHex("codehash", req.CodeHash, 20); err != nil {
+			return err
+		}
+		if req.Genesis == "" {
+			return errors.New("genesis invalid")
+		}
+		if _, err := hex.DecodeString(req.Genesis); err != nil {
+			return errors.New("genesis invalid")
+		}
+	default:
+		return errors.New("type invalid")
+	}
+	if req.Type == model.WebhookNFTTransfer {
+		if _, err := strconv.ParseUint(req.TokenIndex, 10, 64); err != nil {
+			return errors.New("tokenIndex invalid")
+		}
+	}
+	return nil
+}
+
+// CreateWebhook 注册webhook，签名密钥只在返回中出现一次
+func CreateWebhook(ctx context.Context, req *model.WebhookReq) (hookRsp *model.WebhookResp, err error) {
+	if err := checkWebhookReq(req); err != nil {
+		return nil, err
+	}
+	id, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := randomHex(20)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().Unix()
+
+	pipe := rdb.UserClient.TxPipeline()
+	pipe.HSet(ctx, "webhook:"+id,
+		"url", req.Url,
+		"secret", secret,
+		"type", req.Type,
+		"label", req.Label,
+		"address", req.Address,
+		"codehash", req.CodeHash,
+		"genesis", req.Genesis,
+		"token_index", req.TokenIndex,
+		"created", now,
+	)
+	pipe.ZAdd(ctx, webhooksKey, &redis.Z{Score: float64(now), Member: id})
+	if _, err := pipe.Exec(ctx); err != nil {
+		logger.Ctx(ctx).Info("create webhook failed", zap.Error(err))
+		return nil, err
+	}
+	hookRsp, err = GetWebhook(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	hookRsp.Secret = secret
+	return hookRsp, nil
+}
+
+func getWebhook(ctx context.Context, id string) (*hookConf, error) {
+	fields, err := rdb.UserClient.HGetAll(ctx, "webhook:"+id).Result()
+	if err != nil {
+		logger.Ctx(ctx).Info("get webhook failed", zap.Error(err))
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, ErrWebhookNotExist
+	}
+	created, _ := strconv.ParseInt(fields["created"], 10, 64)
+	return &hookConf{
+		WebhookResp: model.WebhookResp{
+			Id:         id,
+			Url:        fields["url"],
+			Type:       fields["type"],
+			Label:      fields["label"],
+			Address:    fields["address"],
+			CodeHash:   fields["codehash"],
+			Genesis:    fields["genesis"],
+			TokenIndex: fields["token_index"],
+			CreatedAt:  created,
+		},
+		secret: fields["secret"],
+	}, nil
+}
+
+func GetWebhook(ctx context.Context, id string) (hookRsp *model.WebhookResp, err error) {
+	hook, err := getWebhook(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return &hook.WebhookResp, nil
+}
+
+// loadWebhooks 读取所有webhook
+func loadWebhooks(ctx context.Context) (hooks []*hookConf, err error) {
+	ids, err := rdb.UserClient.ZRange(ctx, webhooksKey, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		hook, err := getWebhook(ctx, id)
+		if err == ErrWebhookNotExist {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, hook)
+	}
+	return hooks, nil
+}
+
+// ListWebhooks 按注册时间倒序列出webhook
+func ListWebhooks(ctx context.Context, cursor, size int) (hooksRsp []*model.WebhookResp, total int, err error) {
+	pipe := rdb.UserClient.Pipeline()
+	idsCmd := pipe.ZRevRange(ctx, webhooksKey, int64(cursor), int64(cursor+size-1))
+	totalCmd := pipe.ZCard(ctx, webhooksKey)
+	if _, err := pipe.Exec(ctx); err != nil {
+		logger.Ctx(ctx).Info("list webhooks failed", zap.Error(err))
+		return nil, 0, err
+	}
+	hooksRsp = make([]*model.WebhookResp, 0, len(idsCmd.Val()))
+	for _, id := range idsCmd.Val() {
+		hook, err := GetWebhook(ctx, id)
+		if err == ErrWebhookNotExist {
+			continue
+		} else if err != nil {
+			return nil, 0, err
+		}
+		hooksRsp = append(hooksRsp, hook)
+	}
+	return hooksRsp, int(totalCmd.Val()), nil
+}
+
+// DeleteWebhook 删除webhook，未投递的事件在投递时丢弃
+func DeleteWebhook(ctx context.Context, id string) error {
+	pipe := rdb.UserClient.TxPipeline()
+	delCmd := pipe.Del(ctx, "webhook:"+id)
+	pipe.ZRem(ctx, webhooksKey, id)
+	if _, err := pipe.Exec(ctx); err != nil {
+		logger.Ctx(ctx).Info("delete webhook failed", zap.Error(err))
+		return err
+	}
+	if delCmd.Val() == 0 {
+		return ErrWebhookNotExist
+	}
+	return nil
+}
+
+// emitWebhookEvent 记录事件并加入投递队列，同一webhook的同一事件只加入一次。
+// 标记与入队在同一脚本中完成，入队失败时事件不会被标记
+func emitWebhookEvent(ctx context.Context, hook *hookConf, eventId string, data interface{}) error {
+	now := time.Now()
+	payload, err := json.Marshal(&model.WebhookEventResp{
+		Id:        eventId,
+		Webhook:   hook.Id,
+		Type:      hook.Type,
+		Timestamp: now.Unix(),
+		Data:      data,
+	})
+	if err != nil {
+		return err
+	}
+	deliveryId, err := randomHex(16)
+	if err != nil {
+		return err
+	}
+	delivery, _ := json.Marshal(&model.WebhookDeliveryResp{
+		Id:        deliveryId,
+		Webhook:   hook.Id,
+		Payload:   payload,
+		CreatedAt: now.Unix(),
+	})
+
+	fresh, err := webhookEmitScript.Run(ctx, rdb.UserClient,
+		[]string{"webhook:event:" + hook.Id + ":" + eventId, "webhook:delivery:" + deliveryId, webhookQueueKey},
+		webhookEventTTL.Milliseconds(), delivery, now.UnixNano()/1e6, deliveryId,
+	).Int()
+	if err != nil {
+		logger.Ctx(ctx).Info("queue webhook event failed", zap.Error(err))
+		return err
+	}
+	if fresh == 1 {
+		metrics.WebhookEvents.WithLabelValues(hook.Type).Inc()
+	}
+	return nil
+}
+
+func getWebhookDelivery(ctx context.Context, deliveryId string) (*model.WebhookDeliveryResp, error) {
+	data, err := rdb.UserClient.Get(ctx, "webhook:delivery:"+deliveryId).Bytes()
+	if err != nil {
+		return nil, err
+	}
+	delivery := &model.WebhookDeliveryResp{}
+	if err := json.Unmarshal(data, delivery); err != nil {
+		return nil, err
+	}
+	return delivery, nil
+}
+
+// postWebhook 发送一次投递，2xx为成功
+func postWebhook(ctx context.Context, hook *hookConf, delivery *model.WebhookDeliveryResp) error {
+	ctx, cancel := context.WithTimeout(ctx, webhookConf.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.Url, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return err
+	}
+	webhook.SetHeaders(req, hook.Id, delivery.Id, hook.secret, time.Now(), delivery.Payload)
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, webhookMaxResponse))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// requeueWebhook 未完成的投递从inflight放回队列，服务退出时ctx已取消，使用独立的超时。
+// 放回失败时由租约到期后放回
+func requeueWebhook(deliveryId string, at time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	pipe := rdb.UserClient.TxPipeline()
+	pipe.ZAdd(ctx, webhookQueueKey, &redis.Z{Score: float64(at.UnixNano() / 1e6), Member: deliveryId})
+	pipe.ZRem(ctx, webhookInflightKey, deliveryId)
+	if _, err := pipe.Exec(ctx); err != nil {
+		logger.Log.Warn("requeue webhook delivery failed", zap.String("delivery", deliveryId), zap.Error(err))
+	}
+}
+
+// finishWebhook 删除已完成或无需投递的投递
+func finishWebhook(ctx context.Context, deliveryId string) {
+	pipe := rdb.UserClient.TxPipeline()
+	pipe.Del(ctx, "webhook:delivery:"+deliveryId)
+	pipe.ZRem(ctx, webhookInflightKey, deliveryId)
+	if _, err := pipe.Exec(ctx); err != nil {
+		logger.Ctx(ctx).Info("finish webhook delivery failed", zap.String("delivery", deliveryId), zap.Error(err))
+	}
+}
+
+// deliverWebhook 投递已认领到inflight的一项，失败时按退避重新入队，重试耗尽后进入死信列表
+func deliverWebhook(ctx context.Context, deliveryId string) {
+	delivery, err := getWebhookDelivery(ctx, deliveryId)
+	if err != nil {
+		if err != redis.Nil {
+			logger.Ctx(ctx).Info("get webhook delivery failed", zap.String("delivery", deliveryId), zap.Error(err))
+			requeueWebhook(deliveryId, time.Now().Add(webhookConf.Backoff))
+		} else {
+			finishWebhook(ctx, deliveryId)
+		}
+		return
+	}
+	hook, err := getWebhook(ctx, delivery.Webhook)
+	if err == ErrWebhookNotExist {
+		finishWebhook(ctx, deliveryId)
+		return
+	} else if err != nil {
+		requeueWebhook(deliveryId, time.Now().Add(webhookConf.Backoff))
+		return
+	}
+
+	start := time.Now()
+	err = postWebhook(ctx, hook, delivery)
+	metrics.WebhookDeliveryDuration.Observe(time.Since(start).Seconds())
+	if err == nil {
+		metrics.WebhookDeliveries.WithLabelValues("ok").Inc()
+		finishWebhook(ctx, deliveryId)
+		return
+	}
+	if ctx.Err() != nil {
+		// 服务退出中断的投递不计入重试次数
+		requeueWebhook(deliveryId, time.Now())
+		return
+	}
+
+	delivery.Attempts++
+	delivery.LastError = err.Error()
+	now := time.Now()
+	pipe := rdb.UserClient.TxPipeline()
+	if delivery.Attempts >= webhookConf.MaxAttempts {
+		metrics.WebhookDeliveries.WithLabelValues("dead").Inc()
+		logger.Ctx(ctx).Warn("webhook delivery dead",
+			zap.String("webhook", hook.Id),
+			zap.String("delivery", deliveryId),
+			zap.Int("attempts", delivery.Attempts),
+			zap.Error(err),
+		)
+		delivery.FailedAt = now.Unix()
+		pipe.ZAdd(ctx, webhookDeadKey, &redis.Z{Score: float64(now.Unix()), Member: deliveryId})
+	} else {
+		metrics.WebhookDeliveries.WithLabelValues("retry").Inc()
+		next := now.Add(webhook.Backoff(delivery.Attempts, webhookConf.Backoff, webhookConf.MaxBackoff))
+		pipe.ZAdd(ctx, webhookQueueKey, &redis.Z{Score: float64(next.UnixNano() / 1e6), Member: deliveryId})
+	}
+	data, _ := json.Marshal(delivery)
+	pipe.Set(ctx, "webhook:delivery:"+deliveryId, data, 0)
+	pipe.ZRem(ctx, webhookInflightKey, deliveryId)
+	if _, err := pipe.Exec(ctx); err != nil {
+		logger.Ctx(ctx).Info("update webhook delivery failed", zap.String("delivery", deliveryId), zap.Error(err))
+	}
+}
+
+// runWebhookQueue 取出到期的投递并发送。多个实例通过脚本将同一项从待投递移入inflight认领，
+// 实例在投递中退出时，租约到期后由其他实例放回待投递队列
+func runWebhookQueue(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	slots := make(chan struct{}, webhookConf.Workers)
+	lease := webhookConf.Timeout + webhookLeaseMargin
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		now := time.Now().UnixNano() / 1e6
+		if n, err := webhookReclaimScript.Run(ctx, rdb.UserClient,
+			[]string{webhookInflightKey, webhookQueueKey}, now, webhookQueueBatch).Int(); err != nil {
+			if ctx.Err() == nil {
+				logger.Ctx(ctx).Info("reclaim webhook deliveries failed", zap.Error(err))
+			}
+		} else if n > 0 {
+			logger.Ctx(ctx).Info("reclaim webhook deliveries", zap.Int("count", n))
+		}
+
+		due, err := rdb.UserClient.ZRangeByScore(ctx, webhookQueueKey, &redis.ZRangeBy{
+			Min:   "-inf",
+			Max:   strconv.FormatInt(now, 10),
+			Count: webhookQueueBatch,
+		}).Result()
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.Ctx(ctx).Info("webhook queue failed", zap.Error(err))
+			}
+			continue
+		}
+		for _, deliveryId := range due {
+			// 有空闲worker时才认领，租约从认领开始计算
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			deadline := time.Now().Add(lease).UnixNano() / 1e6
+			claimed, err := webhookClaimScript.Run(ctx, rdb.UserClient,
+				[]string{webhookQueueKey, webhookInflightKey}, deliveryId, deadline).Int()
+			if err != nil || claimed == 0 {
+				<-slots
+				continue
+			}
+			go func(deliveryId string) {
+				defer func() { <-slots }()
+				deliverWebhook(ctx, deliveryId)
+			}(deliveryId)
+		}
+	}
+}
+
+// ListWebhookDead 按失败时间倒序列出死信，webhook不为空时只返回该webhook的
+func ListWebhookDead(ctx context.Context, cursor, size int, webhookId string) (deliveriesRsp []*model.WebhookDeliveryResp, total int, err error) {
+	var ids []string
+	if webhookId == "" {
+		pipe := rdb.UserClient.Pipeline()
+		idsCmd := pipe.ZRevRange(ctx, webhookDeadKey, int64(cursor), int64(cursor+size-1))
+		totalCmd := pipe.ZCard(ctx, webhookDeadKey)
+		_, err = pipe.Exec(ctx)
+		ids, total = idsCmd.Val(), int(totalCmd.Val())
+	} else {
+		// 按webhook过滤需要读取所有死信
+		ids, err = rdb.UserClient.ZRevRange(ctx, webhookDeadKey, 0, -1).Result()
+	}
+	if err != nil {
+		logger.Ctx(ctx).Info("list webhook dead failed", zap.Error(err))
+		return nil, 0, err
+	}
+
+	deliveriesRsp = make([]*model.WebhookDeliveryResp, 0)
+	matched := 0
+	for _, id := range ids {
+		delivery, err := getWebhookDelivery(ctx, id)
+		if err == redis.Nil {
+			continue
+		} else if err != nil {
+			return nil, 0, err
+		}
+		if webhookId == "" {
+			deliveriesRsp = append(deliveriesRsp, delivery)
+			continue
+		}
+		if delivery.Webhook != webhookId {
+			continue
+		}
+		if matched >= cursor && len(deliveriesRsp) < size {
+			deliveriesRsp = append(deliveriesRsp, delivery)
+		}
+		matched++
+	}
+	if webhookId != "" {
+		total = matched
+	}
+	return deliveriesRsp, total, nil
+}
+
+// ReplayWebhookDead 将死信重新加入投递队列，重试次数清零
+func ReplayWebhookDead(ctx context.Context, deliveryId string) error {
+	delivery, err := getWebhookDelivery(ctx, deliveryId)
+	if err == redis.Nil {
+		return errors.New("delivery not exist")
+	} else if err != nil {
+		return err
+	}
+	removed, err := rdb.UserClient.ZRem(ctx, webhookDeadKey, deliveryId).Result()
+	if err != nil {
+		return err
+	}
+	if removed == 0 {
+		return errors.New("delivery not dead")
+	}
+
+	delivery.Attempts = 0
+	delivery.FailedAt = 0
+	data, _ := json.Marshal(delivery)
+	pipe := rdb.UserClient.TxPipeline()
+	pipe.Set(ctx, "webhook:delivery:"+deliveryId, data, 0)
+	pipe.ZAdd(ctx, webhookQueueKey, &redis.Z{Score: float64(time.Now().UnixNano() / 1e6), Member: deliveryId})
+	if _, err := pipe.Exec(ctx); err != nil {
+		logger.Ctx(ctx).Info("replay webhook failed", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// StartWebhooks 检测已注册webhook的事件并投递，直到ctx结束
+func StartWebhooks(ctx context.Context) {
+	go runWebhookQueue(ctx)
+	go runWebhookWatchers(ctx)
+}
@@ -0,0 +1,283 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"sensiblequery/lib/metrics"
+	"sensiblequery/lib/utils"
+	"sensiblequery/lib/utxoset"
+	"sensiblequery/logger"
+	"sensiblequery/model"
+	"strconv"
+	"strings"
+	"time"
+
+	scriptDecoder "github.com/sensible-contract/sensible-script-decoder"
+	"go.uber.org/zap"
+)
+
+const (
+	// 重新读取webhook列表的间隔，其他实例注册或删除的webhook在此时间内生效
+	webhookSyncInterval = 10 * time.Second
+	// 每次检查最多读取的swap操作页数
+	webhookSwapPages = 10
+	webhookSwapPage  = 100
+)
+
+// webhookEventId 同一事件在所有实例上得到相同的id
+func webhookEventId(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "|")))
+	return hex.EncodeToString(sum[:16])
+}
+
+// runWebhookWatchers 定期同步webhook列表，为每个webhook启动检测，删除的停止检测
+func runWebhookWatchers(ctx context.Context) {
+	watchers := map[string]context.CancelFunc{}
+	ticker := time.NewTicker(webhookSyncInterval)
+	defer ticker.Stop()
+	for {
+		hooks, err := loadWebhooks(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.Ctx(ctx).Info("load webhooks failed", zap.Error(err))
+			}
+		} else {
+			current := map[string]bool{}
+			for _, hook := range hooks {
+				current[hook.Id] = true
+				if _, ok := watchers[hook.Id]; ok {
+					continue
+				}
+				hookCtx, cancel := context.WithCancel(ctx)
+				watchers[hook.Id] = cancel
+				go watchWebhook(hookCtx, hook)
+			}
+			for id, cancel := range watchers {
+				if !current[id] {
+					cancel()
+					delete(watchers, id)
+				}
+			}
+			metrics.WebhookWatchers.Set(float64(len(watchers)))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func watchWebhook(ctx context.Context, hook *hookConf) {
+	switch hook.Type {
+	case model.WebhookAddressPayment:
+		watchAddressPayment(ctx, hook)
+	case model.WebhookFTBalance:
+		pollWebhook(ctx, hook, ftBalanceWatcher(hook))
+	case model.WebhookNFTTransfer:
+		pollWebhook(ctx, hook, nftTransferWatcher(hook))
+	case model.WebhookSwap:
+		pollWebhook(ctx, hook, swapWatcher(hook))
+	}
+}
+
+func emitOrLog(ctx context.Context, hook *hookConf, eventId string, data interface{}) error {
+	err := emitWebhookEvent(ctx, hook, eventId, data)
+	if err != nil && ctx.Err() == nil {
+		logger.Ctx(ctx).Info("emit webhook event failed", zap.String("webhook", hook.Id), zap.Error(err))
+	}
+	return err
+}
+
+// watchAddressPayment 通过地址订阅检测新的utxo，推送过慢被关闭时重新订阅
+func watchAddressPayment(ctx context.Context, hook *hookConf) {
+	addressPkh, err := utils.DecodeAddress(hook.Address)
+	if err != nil {
+		return
+	}
+	for ctx.Err() == nil {
+		sub := NewSubscriber()
+		if err := sub.Subscribe(addressPkh); err != nil {
+			// 服务退出
+			sub.Close()
+			return
+		}
+	receive:
+		for {
+			select {
+			case <-ctx.Done():
+				sub.Close()
+				return
+			case event, ok := <-sub.C:
+				if !ok {
+					break receive
+				}
+				if event.Type != utxoset.ChangeMempool && event.Type != utxoset.ChangeConfirmed {
+					continue
+				}
+				payment := &model.WebhookPaymentResp{
+					Address:   hook.Address,
+					TxId:      event.TxId,
+					Vout:      *event.Vout,
+					Confirmed: event.Type == utxoset.ChangeConfirmed,
+				}
+				if txid, err := hex.DecodeString(event.TxId); err == nil {
+					vout := make([]byte, 4)
+					binary.LittleEndian.PutUint32(vout, uint32(payment.Vout))
+					outpoint := string(utils.ReverseBytes(txid)) + string(vout)
+					if txouts, err := getUtxoFromRedis(ctx, []string{outpoint}); err == nil && len(txouts) > 0 {
+						payment.Satoshi = txouts[0].Satoshi
+					}
+				}
+				emitOrLog(ctx, hook, webhookEventId(hook.Id, event.Type, event.TxId, strconv.Itoa(payment.Vout)), payment)
+			}
+		}
+	}
+}
+
+// pollWebhook 按webhookConf.Poll间隔调用check，直到ctx结束
+func pollWebhook(ctx context.Context, hook *hookConf, check func(ctx context.Context)) {
+	ticker := time.NewTicker(webhookConf.Poll)
+	defer ticker.Stop()
+	for {
+		check(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ftBalanceWatcher 比较地址FT余额，首次检查只记录。
+// 事件id使用已索引最高区块id，处于同一区块的实例得到相同的id
+func ftBalanceWatcher(hook *hookConf) func(ctx context.Context) {
+	codeHash, _ := hex.DecodeString(hook.CodeHash)
+	genesisId, _ := hex.DecodeString(hook.Genesis)
+	addressPkh, _ := utils.DecodeAddress(hook.Address)
+	var prev *model.FTOwnerBalanceWithUtxoCountResp
+	return func(ctx context.Context) {
+		tipId := IndexTipId()
+		if tipId == "" {
+			return
+		}
+		cur, err := GetTokenBalanceByCodeHashGenesisAddress(ctx, codeHash, genesisId, addressPkh)
+		if err != nil {
+			return
+		}
+		if prev != nil && (prev.Balance != cur.Balance || prev.PendingBalance != cur.PendingBalance) {
+			eventId := webhookEventId(hook.Id, tipId,
+				strconv.Itoa(prev.Balance), strconv.Itoa(prev.PendingBalance),
+				strconv.Itoa(cur.Balance), strconv.Itoa(cur.PendingBalance))
+			err := emitOrLog(ctx, hook, eventId, &model.WebhookFTBalanceResp{
+				Address:            hook.Address,
+				CodeHashHex:        hook.CodeHash,
+				GenesisHex:         hook.Genesis,
+				Balance:            cur.Balance,
+				PendingBalance:     cur.PendingBalance,
+				PrevBalance:        prev.Balance,
+				PrevPendingBalance: prev.PendingBalance,
+				Decimal:            cur.Decimal,
+			})
+			if err != nil {
+				// 下次检查重新比较
+				return
+			}
+		}
+		prev = cur
+	}
+}
+
+// nftTransferWatcher 比较NFT所在的utxo，转移及确认时通知，首次检查只记录
+func nftTransferWatcher(hook *hookConf) func(ctx context.Context) {
+	codeHash, _ := hex.DecodeString(hook.CodeHash)
+	genesisId, _ := hex.DecodeString(hook.Genesis)
+	var prev *model.TxOutResp
+	return func(ctx context.Context) {
+		cur, err := GetUtxoByTokenIndex(ctx, codeHash, genesisId, hook.TokenIndex)
+		if err != nil {
+			return
+		}
+		confirmed := cur.Height != utxoset.MempoolHeight
+		if prev != nil && (prev.TxIdHex != cur.TxIdHex || prev.Vout != cur.Vout || (prev.Height != utxoset.MempoolHeight) != confirmed) {
+			eventId := webhookEventId(hook.Id, cur.TxIdHex, strconv.Itoa(cur.Vout), strconv.FormatBool(confirmed))
+			transfer := &model.WebhookNFTTransferResp{
+				CodeHashHex: hook.CodeHash,
+				GenesisHex:  hook.Genesis,
+				TokenIndex:  hook.TokenIndex,
+				TxId:        cur.TxIdHex,
+				Vout:        cur.Vout,
+				Address:     cur.Address,
+				PrevAddress: prev.Address,
+				Confirmed:   confirmed,
+			}
+			if prev.TxIdHex == cur.TxIdHex && prev.Vout == cur.Vout {
+				// 只是确认，之前的持有人不变
+				transfer.PrevAddress = ""
+			}
+			if err := emitOrLog(ctx, hook, eventId, transfer); err != nil {
+				return
+			}
+		}
+		prev = cur
+	}
+}
+
+// swapWatcher 通知注册后新的swap操作，未确认及确认的同一交易只通知一次。
+// 已确认的按(height, txidx)升序分页读取，记录读到的位置，操作较多时分多次检查读完；
+// 未确认的每次读取，由事件id去重
+func swapWatcher(hook *hookConf) func(ctx context.Context) {
+	height, txidx := -1, -1
+	return func(ctx context.Context) {
+		if height < 0 {
+			best, err := GetBestBlockHeight(ctx)
+			if err != nil {
+				return
+			}
+			height = best + 1
+		}
+		emit := func(op *model.ContractSwapDataResp) error {
+			return emitOrLog(ctx, hook, webhookEventId(hook.Id, op.TxIdHex), &model.WebhookSwapResp{
+				CodeHashHex:          hook.CodeHash,
+				GenesisHex:           hook.Genesis,
+				Confirmed:            op.Height != utxoset.MempoolHeight,
+				ContractSwapDataResp: op,
+			})
+		}
+
+		for page := 0; page < webhookSwapPages; page++ {
+			ops, err := getContractSwapDataAfter(ctx, height, txidx, webhookSwapPage,
+				hook.CodeHash, hook.Genesis, scriptDecoder.CodeType_UNIQUE)
+			if err != nil {
+				return
+			}
+			for _, op := range ops {
+				// 加入队列失败时不前进，下次检查重新读取
+				if err := emit(op); err != nil {
+					return
+				}
+				height, txidx = op.Height, op.Idx
+			}
+			if len(ops) < webhookSwapPage {
+				break
+			}
+		}
+
+		for page := 0; page < webhookSwapPages; page++ {
+			ops, err := GetContractSwapDataInBlocksByHeightRange(ctx, page*webhookSwapPage, webhookSwapPage,
+				utxoset.MempoolHeight, 0, hook.CodeHash, hook.Genesis, scriptDecoder.CodeType_UNIQUE)
+			if err != nil {
+				return
+			}
+			for _, op := range ops {
+				emit(op)
+			}
+			if len(ops) < webhookSwapPage {
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sensiblequery/lib/blkparser"
+	"sensiblequery/lib/metrics"
+	"sensiblequery/lib/zmq"
+	"sensiblequery/logger"
+	"sensiblequery/model"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// ZmqConf bitcoind ZMQ通知配置，见conf/zmq.yaml
+var ZmqConf = struct {
+	Enabled      bool
+	HashBlock    string        // -zmqpubhashblock的地址
+	RawTx        string        // -zmqpubrawtx的地址，空时不订阅交易
+	Reconnect    time.Duration // 连接断开后重连的间隔
+	MaxFrameSize int           // 单个帧的最大字节数，超过时断开重连
+}{
+	Reconnect:    5 * time.Second,
+	MaxFrameSize: zmq.DefaultMaxFrameSize,
+}
+
+func init() {
+	initZmq("conf/zmq.yaml")
+}
+
+// initZmq 读取可选的ZMQ通知配置
+func initZmq(filename string) {
+	if _, err := os.Stat(filename); err != nil {
+		return
+	}
+	v := viper.New()
+	v.SetConfigFile(filename)
+	if err := v.ReadInConfig(); err != nil {
+		panic(fmt.Errorf("Fatal error config file: %s \n", err))
+	}
+	v.SetDefault("reconnect", ZmqConf.Reconnect)
+	v.SetDefault("max_frame_size", ZmqConf.MaxFrameSize)
+	ZmqConf.Enabled = v.GetBool("enabled")
+	ZmqConf.HashBlock = v.GetString("hashblock")
+	ZmqConf.RawTx = v.GetString("rawtx")
+	ZmqConf.Reconnect = v.GetDuration("reconnect")
+	ZmqConf.MaxFrameSize = int(v.GetSizeInBytes("max_frame_size"))
+	if ZmqConf.Enabled && ZmqConf.HashBlock == "" {
+		panic(fmt.Errorf("Fatal error config file: %s: hashblock required \n", filename))
+	}
+	if ZmqConf.MaxFrameSize <= 0 {
+		panic(fmt.Errorf("Fatal error config file: %s: max_frame_size must be positive \n", filename))
+	}
+}
+
+// NodeHeaderFunc 按区块ID获取节点的区块头
+type NodeHeaderFunc func(ctx context.Context, blkIdHex string) (*model.NodeBlockResp, error)
+
+var nodeTip atomic.Value // *model.NodeBlockResp
+
+// NodeTip 最近一次hashblock通知的区块，未启用或尚未收到时返回nil
+func NodeTip() *model.NodeBlockResp {
+	tip, _ := nodeTip.Load().(*model.NodeBlockResp)
+	return tip
+}
+
+// StartZmq 订阅bitcoind的hashblock及rawtx通知，断开后重连，直到ctx结束。
+// 新区块更新节点高度、推送node_block事件并立即检查索引的新区块；
+// 交易中向订阅地址的P2PKH输出在索引前推送node_tx事件
+func StartZmq(ctx context.Context, header NodeHeaderFunc) {
+	if !ZmqConf.Enabled {
+		return
+	}
+	// 同一地址的主题共用一个连接
+	topics := map[string][]string{ZmqConf.HashBlock: {zmq.TopicHashBlock}}
+	if ZmqConf.RawTx != "" {
+		topics[ZmqConf.RawTx] = append(topics[ZmqConf.RawTx], zmq.TopicRawTx)
+	}
+	handle := func(msg *zmq.Message) {
+		switch msg.Topic {
+		case zmq.TopicHashBlock:
+			onNodeBlock(ctx, msg.Body, header)
+		case zmq.TopicRawTx:
+			onNodeTx(msg.Body)
+		}
+	}
+	for addr, t := range topics {
+		go runZmq(ctx, addr, t, handle)
+	}
+}
+
+func runZmq(ctx context.Context, addr string, topics []string, handle func(*zmq.Message)) {
+	for {
+		err := subscribeZmq(ctx, addr, topics, handle)
+		if ctx.Err() != nil {
+			return
+		}
+		metrics.ZmqReconnects.WithLabelValues(addr).Inc()
+		logger.Log.Info("zmq disconnected", zap.String("address", addr), zap.Error(err))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(ZmqConf.Reconnect):
+		}
+	}
+}
+
+func subscribeZmq(ctx context.Context, addr string, topics []string, handle func(*zmq.Message)) error {
+	dctx, cancel := context.WithTimeout(ctx, ZmqConf.Reconnect)
+	sub, err := zmq.Dial(dctx, addr, ZmqConf.MaxFrameSize, topics...)
+	cancel()
+	if err != nil {
+		return err
+	}
+	logger.Log.Info("zmq connected", zap.String("address", addr), zap.Strings("topics", topics))
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-stop:
+		}
+		sub.Close()
+	}()
+
+	// 序号不连续说明丢失了通知，轮询会补上
+	next := map[string]uint32{}
+	for {
+		msg, err := sub.Recv()
+		if err != nil {
+			return err
+		}
+		if seq, ok := next[msg.Topic]; ok && msg.Seq != seq {
+			metrics.ZmqMissed.WithLabelValues(msg.Topic).Add(float64(msg.Seq - seq))
+		}
+		next[msg.Topic] = msg.Seq + 1
+		metrics.ZmqMessages.WithLabelValues(msg.Topic).Inc()
+		handle(msg)
+	}
+}
+
+func onNodeBlock(ctx context.Context, hash []byte, header NodeHeaderFunc) {
+	if len(hash) != 32 {
+		return
+	}
+	// hashblock与rpc的字节序相同
+	hctx, cancel := context.WithTimeout(ctx, ZmqConf.Reconnect)
+	blk, err := header(hctx, hex.EncodeToString(hash))
+	cancel()
+	if err != nil {
+		logger.Log.Info("zmq block header failed", zap.String("blkid", hex.EncodeToString(hash)), zap.Error(err))
+		return
+	}
+	if tip := NodeTip(); tip != nil && tip.BlockIdHex == blk.BlockIdHex {
+		return
+	}
+	nodeTip.Store(blk)
+	UpdateNodeHeight(blk.Height)
+	publishNodeBlock(blk)
+	wakeBlockStream()
+}
+
+// p2pkhAddress P2PKH锁定脚本中的地址pkh，其他脚本返回nil
+func p2pkhAddress(pkscript []byte) []byte {
+	if len(pkscript) == 25 && bytes.HasPrefix(pkscript, []byte{0x76, 0xa9, 0x14}) &&
+		bytes.HasSuffix(pkscript, []byte{0x88, 0xac}) {
+		return pkscript[3:23]
+	}
+	return nil
+}
+
+func onNodeTx(rawtx []byte) {
+	tx, _ := blkparser.NewTx(rawtx)
+	if tx == nil {
+		return
+	}
+	txid := blkparser.HashString(blkparser.GetHash256(rawtx))
+
+	subHub.mu.Lock()
+	defer subHub.mu.Unlock()
+	if len(subHub.watched) == 0 {
+		return
+	}
+	for vout, output := range tx.TxOuts {
+		addressPkh := p2pkhAddress(output.Pkscript)
+		if addressPkh == nil {
+			continue
+		}
+		w, ok := subHub.watched[string(addressPkh)]
+		if !ok {
+			continue
+		}
+		n := vout
+		event := &model.AddressEventResp{
+			Type:    model.EventNodeTx,
+			Address: w.address,
+			TxId:    txid,
+			Vout:    &n,
+		}
+		for s := range w.subs {
+			s.sendLocked(event)
+		}
+	}
+}